@@ -13,7 +13,7 @@ import (
 	"strings"
 
 	caps "github.com/open-policy-agent/opa/capabilities"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa/capabilities"
+	"github.com/open-policy-agent/opa/sdk/wasm/capabilities"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -30,6 +30,8 @@ type typeChecker struct {
 	ss           *SchemaSet
 	allowNet     []string
 	input        types.Type
+	ruleTypes    map[*Rule]checkedRule           // records the type inferred for each rule, if set
+	reuseType    func(*Rule) (checkedRule, bool) // returns the previously inferred type of rules that need not be checked again
 }
 
 // newTypeChecker returns a new typeChecker object that has no errors.
@@ -80,6 +82,15 @@ func (tc *typeChecker) WithInputType(tpe types.Type) *typeChecker {
 	return tc
 }
 
+// WithRuleTypes makes CheckTypes record the type inferred for each rule in
+// record. Rules for which reuse returns a type are not checked again; the
+// returned type is merged into the environment instead.
+func (tc *typeChecker) WithRuleTypes(record map[*Rule]checkedRule, reuse func(*Rule) (checkedRule, bool)) *typeChecker {
+	tc.ruleTypes = record
+	tc.reuseType = reuse
+	return tc
+}
+
 // Env returns a type environment for the specified built-ins with any other
 // global types configured on the checker. In practice, this is the default
 // environment that other statements will be checked against.
@@ -175,6 +186,16 @@ func (tc *typeChecker) checkClosures(env *TypeEnv, expr *Expr) Errors {
 
 func (tc *typeChecker) checkRule(env *TypeEnv, as *AnnotationSet, rule *Rule) {
 
+	if tc.reuseType != nil {
+		if cr, ok := tc.reuseType(rule); ok {
+			if tc.ruleTypes != nil {
+				tc.ruleTypes[rule] = cr
+			}
+			mergeRuleType(env, rule, cr)
+			return
+		}
+	}
+
 	env = env.wrap()
 
 	if schemaAnnots := getRuleAnnotation(as, rule); schemaAnnots != nil {
@@ -203,19 +224,15 @@ func (tc *typeChecker) checkRule(env *TypeEnv, as *AnnotationSet, rule *Rule) {
 
 	cpy, err := tc.CheckBody(env, rule.Body)
 	env = env.next
-	path := rule.Ref()
+
+	var cr checkedRule
 
 	if len(err) > 0 {
 		// if the rule/function contains an error, add it to the type env so
 		// that expressions that refer to this rule/function do not encounter
 		// type errors.
-		env.tree.Put(path, types.A)
-		return
-	}
-
-	var tpe types.Type
-
-	if len(rule.Head.Args) > 0 {
+		cr.failed = true
+	} else if len(rule.Head.Args) > 0 {
 		// If args are not referred to in body, infer as any.
 		WalkVars(rule.Head.Args, func(v Var) bool {
 			if cpy.Get(v) == nil {
@@ -230,22 +247,65 @@ func (tc *typeChecker) checkRule(env *TypeEnv, as *AnnotationSet, rule *Rule) {
 			args[i] = cpy.Get(rule.Head.Args[i])
 		}
 
-		f := types.NewFunction(args, cpy.Get(rule.Head.Value))
+		cr.value = types.NewFunction(args, cpy.Get(rule.Head.Value))
+
+	} else {
+		switch rule.Head.RuleKind() {
+		case SingleValue:
+			cr.value = cpy.Get(rule.Head.Value)
+			if path := rule.Ref(); !path[len(path)-1].IsGround() {
+				cr.key = cpy.Get(path[len(path)-1])
+			}
+		case MultiValue:
+			cr.key = cpy.Get(rule.Head.Key)
+		}
+	}
+
+	if tc.ruleTypes != nil {
+		tc.ruleTypes[rule] = cr
+	}
+
+	mergeRuleType(env, rule, cr)
+}
+
+// checkedRule is the type inferred for a single rule, before it is merged with
+// the types of the other rules defining the same document. For functions and
+// single-value rules, value holds the function or value type; key holds the
+// type of the last ref element of partial object rules or of the key of
+// multi-value rules.
+type checkedRule struct {
+	failed bool
+	key    types.Type
+	value  types.Type
+}
+
+// mergeRuleType merges the type inferred for rule into env.
+func mergeRuleType(env *TypeEnv, rule *Rule, cr checkedRule) {
+
+	path := rule.Ref()
+
+	if cr.failed {
+		env.tree.Put(path, types.A)
+		return
+	}
+
+	var tpe types.Type
 
+	if len(rule.Head.Args) > 0 {
 		// Union with existing.
 		exist := env.tree.Get(path)
-		tpe = types.Or(exist, f)
+		tpe = types.Or(exist, cr.value)
 
 	} else {
 		switch rule.Head.RuleKind() {
 		case SingleValue:
-			typeV := cpy.Get(rule.Head.Value)
+			typeV := cr.value
 			if last := path[len(path)-1]; !last.IsGround() {
 
 				// e.g. store object[string: whatever] at data.p.q.r, not data.p.q.r[x]
 				path = path.GroundPrefix()
 
-				typeK := cpy.Get(last)
+				typeK := cr.key
 				if typeK != nil && typeV != nil {
 					exist := env.tree.Get(path)
 					typeV = types.Or(types.Values(exist), typeV)
@@ -259,7 +319,7 @@ func (tc *typeChecker) checkRule(env *TypeEnv, as *AnnotationSet, rule *Rule) {
 				}
 			}
 		case MultiValue:
-			typeK := cpy.Get(rule.Head.Key)
+			typeK := cr.key
 			if typeK != nil {
 				exist := env.tree.Get(path)
 				typeK = types.Or(types.Keys(exist), typeK)
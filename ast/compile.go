@@ -123,6 +123,12 @@ type Compiler struct {
 	keepModules             bool                          // whether to keep the unprocessed, parse modules (below)
 	parsedModules           map[string]*Module            // parsed, but otherwise unprocessed modules, kept track of when keepModules is true
 	useTypeCheckAnnotations bool                          // whether to provide annotated information (schemas) to the type checker
+	incremental             bool                          // whether to reuse compiled modules from prev (below)
+	prev                    *Compiler                     // previously compiled compiler to reuse unchanged modules from
+	incr                    *incrementalBase              // state carried forward from prev while compiling, if modules were reused
+	ruleTypes               map[*Rule]checkedRule         // types inferred for each rule, kept track of when incremental is true
+	pending                 []string                      // sorted list of module names processed by module-local stages
+	regoMetadataCalled      bool                          // indicates if rego.metadata built-ins are called by any module
 }
 
 // CompilerStage defines the interface for stages in the compiler.
@@ -408,6 +414,24 @@ func (c *Compiler) WithKeepModules(y bool) *Compiler {
 	return c
 }
 
+// WithIncremental enables incremental compilation against prev, which should
+// be the most recent compiler used for the same set of policies. When Compile
+// is called, modules that are unchanged since prev compiled them, and that do
+// not depend on changed modules, are reused as-is. Module-local stages (e.g.,
+// reference resolution, variable rewriting, safety checks) only process the
+// changed modules and their dependents. The rule tree, the dependency graph,
+// the type environment and the rule indices are carried forward from prev and
+// only updated for the changed rules and the rules depending on them.
+// Incremental compilers keep the parsed modules (see WithKeepModules) so that
+// they can serve as prev for the next compilation. If prev is nil, failed, was
+// configured differently, or either compiler has stages registered with
+// WithStageAfter, all modules are compiled.
+func (c *Compiler) WithIncremental(prev *Compiler) *Compiler {
+	c.incremental = true
+	c.prev = prev
+	return c
+}
+
 // WithUseTypeCheckAnnotations use schema annotations during type checking
 func (c *Compiler) WithUseTypeCheckAnnotations(enabled bool) *Compiler {
 	c.useTypeCheckAnnotations = enabled
@@ -415,7 +439,8 @@ func (c *Compiler) WithUseTypeCheckAnnotations(enabled bool) *Compiler {
 }
 
 // ParsedModules returns the parsed, unprocessed modules from the compiler.
-// It is `nil` if keeping modules wasn't enabled via `WithKeepModules(true)`.
+// It is `nil` if keeping modules wasn't enabled via `WithKeepModules(true)`
+// or `WithIncremental`.
 // The map includes all modules loaded via the ModuleLoader, if one was used.
 func (c *Compiler) ParsedModules() map[string]*Module {
 	return c.parsedModules
@@ -437,15 +462,23 @@ func (c *Compiler) Compile(modules map[string]*Module) {
 
 	c.Modules = make(map[string]*Module, len(modules))
 	c.sorted = make([]string, 0, len(modules))
+	c.pending = make([]string, 0, len(modules))
 
-	if c.keepModules {
+	if c.keepModules || c.incremental {
 		c.parsedModules = make(map[string]*Module, len(modules))
 	} else {
 		c.parsedModules = nil
 	}
 
+	reuse := c.reusableModules(modules)
+
 	for k, v := range modules {
-		c.Modules[k] = v.Copy()
+		if compiled, ok := reuse[k]; ok {
+			c.Modules[k] = compiled
+		} else {
+			c.Modules[k] = v.Copy()
+			c.pending = append(c.pending, k)
+		}
 		c.sorted = append(c.sorted, k)
 		if c.parsedModules != nil {
 			c.parsedModules[k] = v
@@ -453,8 +486,23 @@ func (c *Compiler) Compile(modules map[string]*Module) {
 	}
 
 	sort.Strings(c.sorted)
+	sort.Strings(c.pending)
+
+	if len(reuse) > 0 {
+		for k, v := range c.prev.RewrittenVars {
+			c.RewrittenVars[k] = v
+		}
+		c.counterAdd(compileIncrementalModulesReused, uint64(len(reuse)))
+		c.incr = newIncrementalBase(c.prev, reuse)
+	}
+
+	// Release the previous compiler so that chains of incremental compilers
+	// do not keep old module sets alive.
+	c.prev = nil
 
 	c.compile()
+
+	c.incr = nil
 }
 
 // WithSchemas sets a schemaSet to the compiler
@@ -804,6 +852,13 @@ func (c *Compiler) buildRuleIndices() {
 			}
 		}
 
+		if path := rules[0].Ref().GroundPrefix(); c.incr != nil && c.incr.indexUnchanged(path, rules) {
+			if index, ok := c.incr.ruleIndices.Get(path); ok {
+				c.ruleIndices.Put(path, index)
+			}
+			return hasNonGroundKey
+		}
+
 		index := newBaseDocEqIndex(func(ref Ref) bool {
 			return isVirtual(c.RuleTree, ref.GroundPrefix())
 		})
@@ -987,7 +1042,7 @@ func (c *Compiler) checkRuleConflicts() {
 }
 
 func (c *Compiler) checkUndefinedFuncs() {
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		m := c.Modules[name]
 		for _, err := range checkUndefinedFuncs(c.TypeEnv, m, c.GetArity, c.RewrittenVars) {
 			c.err(err)
@@ -1047,7 +1102,7 @@ func arityMismatchError(env *TypeEnv, f Ref, expr *Expr, exp, act int) *Error {
 // positions of built-in expressions will be bound when evaluating the rule from left
 // to right, re-ordering as necessary.
 func (c *Compiler) checkSafetyRuleBodies() {
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		m := c.Modules[name]
 		WalkRules(m, func(r *Rule) bool {
 			safe := ReservedVars.Copy()
@@ -1081,7 +1136,7 @@ var SafetyCheckVisitorParams = VarVisitorParams{
 // rule also appear in the body.
 func (c *Compiler) checkSafetyRuleHeads() {
 
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		m := c.Modules[name]
 		WalkRules(m, func(r *Rule) bool {
 			safe := r.Body.Vars(SafetyCheckVisitorParams)
@@ -1350,6 +1405,16 @@ func (c *Compiler) checkTypes() {
 	if c.useTypeCheckAnnotations {
 		as = c.annotationSet
 	}
+	if c.incremental {
+		c.ruleTypes = make(map[*Rule]checkedRule, len(sorted))
+		var reuse func(*Rule) (checkedRule, bool)
+		if c.incr != nil && !c.useTypeCheckAnnotations {
+			// Schema annotations may apply to rules in other modules, so
+			// types are only reused if annotations are not used.
+			reuse = c.incr.reusableRuleTypes(c)
+		}
+		checker = checker.WithRuleTypes(c.ruleTypes, reuse)
+	}
 	env, errs := checker.CheckTypes(c.TypeEnv, sorted, as)
 	for _, err := range errs {
 		c.err(err)
@@ -1358,7 +1423,7 @@ func (c *Compiler) checkTypes() {
 }
 
 func (c *Compiler) checkUnsafeBuiltins() {
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		errs := checkUnsafeBuiltins(c.unsafeBuiltinsMap, c.Modules[name])
 		for _, err := range errs {
 			c.err(err)
@@ -1367,7 +1432,7 @@ func (c *Compiler) checkUnsafeBuiltins() {
 }
 
 func (c *Compiler) checkDeprecatedBuiltins() {
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		errs := checkDeprecatedBuiltins(c.deprecatedBuiltinsMap, c.Modules[name], c.strict)
 		for _, err := range errs {
 			c.err(err)
@@ -1506,7 +1571,7 @@ func (c *Compiler) checkDuplicateImports() {
 		return
 	}
 
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		processedImports := map[Var]*Import{}
 
@@ -1523,7 +1588,7 @@ func (c *Compiler) checkDuplicateImports() {
 }
 
 func (c *Compiler) checkKeywordOverrides() {
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		errs := checkKeywordOverrides(mod, c.strict)
 		for _, err := range errs {
@@ -1582,7 +1647,7 @@ func (c *Compiler) resolveAllRefs() {
 
 	rules := c.getExports()
 
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 
 		var ruleExports []Ref
@@ -1631,18 +1696,20 @@ func (c *Compiler) resolveAllRefs() {
 		for id, module := range parsed {
 			c.Modules[id] = module.Copy()
 			c.sorted = append(c.sorted, id)
+			c.pending = append(c.pending, id)
 			if c.parsedModules != nil {
 				c.parsedModules[id] = module
 			}
 		}
 
 		sort.Strings(c.sorted)
+		sort.Strings(c.pending)
 		c.resolveAllRefs()
 	}
 }
 
 func (c *Compiler) removeImports() {
-	for name := range c.Modules {
+	for _, name := range c.pending {
 		c.Modules[name].Imports = nil
 	}
 }
@@ -1653,14 +1720,14 @@ func (c *Compiler) initLocalVarGen() {
 
 func (c *Compiler) rewriteComprehensionTerms() {
 	f := newEqualityFactory(c.localvargen)
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		_, _ = rewriteComprehensionTerms(f, mod) // ignore error
 	}
 }
 
 func (c *Compiler) rewriteExprTerms() {
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		WalkRules(mod, func(rule *Rule) bool {
 			rewriteExprTermsInHead(c.localvargen, rule)
@@ -1672,7 +1739,7 @@ func (c *Compiler) rewriteExprTerms() {
 
 func (c *Compiler) rewriteRuleHeadRefs() {
 	f := newEqualityFactory(c.localvargen)
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		WalkRules(c.Modules[name], func(rule *Rule) bool {
 
 			ref := rule.Head.Ref()
@@ -1730,7 +1797,7 @@ func (c *Compiler) rewriteRuleHeadRefs() {
 }
 
 func (c *Compiler) checkVoidCalls() {
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		for _, err := range checkVoidCalls(c.TypeEnv, mod) {
 			c.err(err)
@@ -1740,12 +1807,12 @@ func (c *Compiler) checkVoidCalls() {
 
 func (c *Compiler) rewritePrintCalls() {
 	if !c.enablePrintStatements {
-		for _, name := range c.sorted {
+		for _, name := range c.pending {
 			erasePrintCalls(c.Modules[name])
 		}
 		return
 	}
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		WalkRules(mod, func(r *Rule) bool {
 			safe := r.Head.Args.Vars()
@@ -1939,7 +2006,7 @@ func isPrintCall(x *Expr) bool {
 // p[__local0__] { i < 100; __local0__ = {"foo": data.foo[i]} }
 func (c *Compiler) rewriteRefsInHead() {
 	f := newEqualityFactory(c.localvargen)
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		WalkRules(mod, func(rule *Rule) bool {
 			if requiresEval(rule.Head.Key) {
@@ -1965,7 +2032,7 @@ func (c *Compiler) rewriteRefsInHead() {
 }
 
 func (c *Compiler) rewriteEquals() {
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		rewriteEquals(mod)
 	}
@@ -1973,7 +2040,7 @@ func (c *Compiler) rewriteEquals() {
 
 func (c *Compiler) rewriteDynamicTerms() {
 	f := newEqualityFactory(c.localvargen)
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		WalkRules(mod, func(rule *Rule) bool {
 			rule.Body = rewriteDynamics(f, rule.Body)
@@ -1999,6 +2066,8 @@ func (c *Compiler) parseMetadataBlocks() {
 		}
 	}
 
+	c.regoMetadataCalled = regoMetadataCalled
+
 	if regoMetadataCalled {
 		// NOTE: Possible optimization: only parse annotations for modules on the path of rego.metadata-calling module
 		for _, name := range c.sorted {
@@ -2022,7 +2091,7 @@ func (c *Compiler) rewriteRegoMetadataCalls() {
 	_, chainFuncAllowed := c.builtins[RegoMetadataChain.Name]
 	_, ruleFuncAllowed := c.builtins[RegoMetadataRule.Name]
 
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 
 		WalkRules(mod, func(rule *Rule) bool {
@@ -2200,7 +2269,7 @@ func createMetadataChain(chain []*AnnotationsRef) (*Term, *Error) {
 
 func (c *Compiler) rewriteLocalVars() {
 
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		gen := c.localvargen
 
@@ -2455,7 +2524,7 @@ func (vis *ruleArgLocalRewriter) Visit(x interface{}) Visitor {
 
 func (c *Compiler) rewriteWithModifiers() {
 	f := newEqualityFactory(c.localvargen)
-	for _, name := range c.sorted {
+	for _, name := range c.pending {
 		mod := c.Modules[name]
 		t := NewGenericTransformer(func(x interface{}) (interface{}, error) {
 			body, ok := x.(Body)
@@ -2478,6 +2547,10 @@ func (c *Compiler) setModuleTree() {
 }
 
 func (c *Compiler) setRuleTree() {
+	if c.incr != nil {
+		c.RuleTree = c.incr.updateRuleTree(c)
+		return
+	}
 	c.RuleTree = NewRuleTree(c.ModuleTree)
 }
 
@@ -2485,6 +2558,10 @@ func (c *Compiler) setGraph() {
 	list := func(r Ref) []*Rule {
 		return c.GetRulesDynamicWithOpts(r, RulesOptions{IncludeHiddenModules: true})
 	}
+	if c.incr != nil {
+		c.Graph = c.incr.updateGraph(c, list)
+		return
+	}
 	c.Graph = NewGraph(c.Modules, list)
 }
 
@@ -3305,47 +3382,55 @@ type Graph struct {
 // the rules referred to directly by the ref.
 func NewGraph(modules map[string]*Module, list func(Ref) []*Rule) *Graph {
 
-	graph := &Graph{
+	graph := newGraph()
+
+	// Walk over all rules, add them to graph, and build adjacency lists.
+	for _, module := range modules {
+		WalkRules(module, func(a *Rule) bool {
+			graph.addRule(a, list)
+			return false
+		})
+	}
+
+	return graph
+}
+
+func newGraph() *Graph {
+	return &Graph{
 		adj:    map[util.T]map[util.T]struct{}{},
 		radj:   map[util.T]map[util.T]struct{}{},
 		nodes:  map[util.T]struct{}{},
 		sorted: nil,
 	}
+}
+
+// addRule adds a to the graph along with an edge for each rule that a refers
+// to.
+func (g *Graph) addRule(a *Rule, list func(Ref) []*Rule) {
+
+	g.addNode(a)
 
 	// Create visitor to walk a rule AST and add edges to the rule graph for
 	// each dependency.
-	vis := func(a *Rule) *GenericVisitor {
-		stop := false
-		return NewGenericVisitor(func(x interface{}) bool {
-			switch x := x.(type) {
-			case Ref:
-				for _, b := range list(x) {
-					for node := b; node != nil; node = node.Else {
-						graph.addDependency(a, node)
-					}
-				}
-			case *Rule:
-				if stop {
-					// Do not recurse into else clauses (which will be handled
-					// by the outer visitor.)
-					return true
+	stop := false
+	NewGenericVisitor(func(x interface{}) bool {
+		switch x := x.(type) {
+		case Ref:
+			for _, b := range list(x) {
+				for node := b; node != nil; node = node.Else {
+					g.addDependency(a, node)
 				}
-				stop = true
 			}
-			return false
-		})
-	}
-
-	// Walk over all rules, add them to graph, and build adjacency lists.
-	for _, module := range modules {
-		WalkRules(module, func(a *Rule) bool {
-			graph.addNode(a)
-			vis(a).Walk(a)
-			return false
-		})
-	}
-
-	return graph
+		case *Rule:
+			if stop {
+				// Do not recurse into else clauses (which will be handled
+				// by the outer visitor.)
+				return true
+			}
+			stop = true
+		}
+		return false
+	}).Walk(a)
 }
 
 // Dependencies returns the set of rules that x depends on.
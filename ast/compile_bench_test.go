@@ -45,3 +45,55 @@ func makeQueriesForRewriteDynamicsBenchmark(sizes []int, body Body) [][]Body {
 
 	return queries
 }
+
+func BenchmarkCompileIncremental(b *testing.B) {
+
+	sizes := []int{10, 100, 1000}
+
+	for _, n := range sizes {
+		modules := make(map[string]*Module, n)
+		for i := 0; i < n; i++ {
+			modules[fmt.Sprintf("m%d.rego", i)] = MustParseModule(fmt.Sprintf(`package p%d
+
+allow { input.user == data.users[_].name; input.method == "GET" }
+allow { data.p%d.admins[input.user] }
+admins[x] { x := data.users[_]; x.role == "admin" }
+f(x) = y { y := x + %d }
+q := f(1)`, i, i, i))
+		}
+
+		updated := make(map[string]*Module, n)
+		for k, v := range modules {
+			updated[k] = v
+		}
+		updated["m0.rego"] = MustParseModule(`package p0
+
+allow { input.user == "alice" }
+admins[x] { x := data.users[_]; x.role == "admin" }
+f(x) = y { y := x + 1 }
+q := f(2)`)
+
+		b.Run(fmt.Sprintf("full/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c := NewCompiler()
+				if c.Compile(updated); c.Failed() {
+					b.Fatal(c.Errors)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("incremental/%d", n), func(b *testing.B) {
+			prev := NewCompiler().WithIncremental(nil)
+			if prev.Compile(modules); prev.Failed() {
+				b.Fatal(prev.Errors)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c := NewCompiler().WithIncremental(prev)
+				if c.Compile(updated); c.Failed() {
+					b.Fatal(c.Errors)
+				}
+			}
+		})
+	}
+}
@@ -8757,6 +8757,7 @@ func compileStages(c *Compiler, upto func()) {
 	c.localvargen = newLocalVarGeneratorForModuleSet(c.sorted, c.Modules)
 
 	sort.Strings(c.sorted)
+	c.pending = append([]string(nil), c.sorted...)
 	c.SetErrorLimit(0)
 
 	if upto == nil {
@@ -9146,6 +9147,362 @@ func TestKeepModules(t *testing.T) {
 	})
 }
 
+func TestCompilerIncremental(t *testing.T) {
+
+	parse := func(mods map[string]string) map[string]*Module {
+		parsed := make(map[string]*Module, len(mods))
+		for name, src := range mods {
+			parsed[name] = MustParseModule(src)
+		}
+		return parsed
+	}
+
+	base := map[string]string{
+		"a.rego": `package a
+f(x) = x
+p { f(1) }`,
+		"b.rego": `package b
+import data.a
+q { a.p }`,
+		"c.rego": `package c
+r { x := 1; x > 0 }`,
+		"d.rego": `package a
+s { true }`,
+	}
+
+	t.Run("reuse unchanged", func(t *testing.T) {
+		prev := NewCompiler().WithIncremental(nil)
+		prev.Compile(parse(base))
+		assertNotFailed(t, prev)
+
+		c := NewCompiler().WithIncremental(prev).WithMetrics(metrics.New())
+		c.Compile(parse(base))
+		assertNotFailed(t, c)
+
+		for name := range base {
+			if c.Modules[name] != prev.Modules[name] {
+				t.Errorf("expected module %v to be reused", name)
+			}
+		}
+
+		if exp, act := uint64(len(base)), c.metrics.Counter(compileIncrementalModulesReused).Value().(uint64); exp != act {
+			t.Errorf("expected %d reused modules, got %d", exp, act)
+		}
+	})
+
+	t.Run("recompile changed and dependents", func(t *testing.T) {
+		prev := NewCompiler().WithIncremental(nil)
+		prev.Compile(parse(base))
+		assertNotFailed(t, prev)
+
+		changed := map[string]string{}
+		for k, v := range base {
+			changed[k] = v
+		}
+		changed["a.rego"] = `package a
+f(x) = x
+p { f(2) }`
+
+		c := NewCompiler().WithIncremental(prev)
+		c.Compile(parse(changed))
+		assertNotFailed(t, c)
+
+		for name, reused := range map[string]bool{"a.rego": false, "b.rego": false, "c.rego": true, "d.rego": false} {
+			if act := c.Modules[name] == prev.Modules[name]; act != reused {
+				t.Errorf("expected module %v reused to be %v", name, reused)
+			}
+		}
+
+		full := NewCompiler()
+		full.Compile(parse(changed))
+		assertNotFailed(t, full)
+
+		for name := range changed {
+			if !full.Modules[name].Equal(c.Modules[name]) {
+				t.Errorf("expected module %v to equal full compile:\n\nExpected:\n%v\n\nGot:\n%v", name, full.Modules[name], c.Modules[name])
+			}
+		}
+	})
+
+	t.Run("moved rule", func(t *testing.T) {
+		prev := NewCompiler().WithIncremental(nil)
+		prev.Compile(parse(base))
+		assertNotFailed(t, prev)
+
+		changed := map[string]string{}
+		for k, v := range base {
+			changed[k] = v
+		}
+		changed["c.rego"] = `package c
+
+r { x := 1; x > 0 }`
+
+		c := NewCompiler().WithIncremental(prev)
+		c.Compile(parse(changed))
+		assertNotFailed(t, c)
+
+		if c.Modules["c.rego"] == prev.Modules["c.rego"] {
+			t.Fatal("expected module with new locations to be recompiled")
+		}
+		if exp, act := 3, c.Modules["c.rego"].Rules[0].Location.Row; exp != act {
+			t.Errorf("expected rule on row %d, got %d", exp, act)
+		}
+	})
+
+	t.Run("removed dependency", func(t *testing.T) {
+		prev := NewCompiler().WithIncremental(nil)
+		prev.Compile(parse(map[string]string{
+			"x.rego": `package x
+f(x) = x`,
+			"y.rego": `package y
+import data.x
+p { x.f(1) }`,
+		}))
+		assertNotFailed(t, prev)
+
+		c := NewCompiler().WithIncremental(prev)
+		c.Compile(parse(map[string]string{
+			"y.rego": `package y
+import data.x
+p { x.f(1) }`,
+		}))
+
+		if !c.Failed() {
+			t.Fatal("expected error")
+		}
+		if exp := "rego_type_error: undefined function data.x.f"; !strings.Contains(c.Errors.Error(), exp) {
+			t.Fatalf("expected error containing %q, got %v", exp, c.Errors)
+		}
+	})
+
+	t.Run("incompatible", func(t *testing.T) {
+		prev := NewCompiler().WithIncremental(nil)
+		prev.Compile(parse(base))
+		assertNotFailed(t, prev)
+
+		c := NewCompiler().WithIncremental(prev).WithStrict(true)
+		c.Compile(parse(base))
+		assertNotFailed(t, c)
+
+		for name := range base {
+			if c.Modules[name] == prev.Modules[name] {
+				t.Errorf("expected module %v to be recompiled", name)
+			}
+		}
+	})
+
+	t.Run("after stages", func(t *testing.T) {
+		stage := CompilerStageDefinition{Name: "Noop", MetricName: "noop", Stage: func(*Compiler) *Error { return nil }}
+
+		prev := NewCompiler().WithIncremental(nil).WithStageAfter("CheckTypes", stage)
+		prev.Compile(parse(base))
+		assertNotFailed(t, prev)
+
+		c := NewCompiler().WithIncremental(prev).WithStageAfter("CheckTypes", stage)
+		c.Compile(parse(base))
+		assertNotFailed(t, c)
+
+		for name := range base {
+			if c.Modules[name] == prev.Modules[name] {
+				t.Errorf("expected module %v to be recompiled", name)
+			}
+		}
+	})
+
+	t.Run("shared rule tree", func(t *testing.T) {
+		prev := NewCompiler().WithIncremental(nil)
+		prev.Compile(parse(base))
+		assertNotFailed(t, prev)
+
+		changed := map[string]string{}
+		for k, v := range base {
+			changed[k] = v
+		}
+		changed["a.rego"] = `package a
+f(x) = x
+p { f(2) }`
+
+		c := NewCompiler().WithIncremental(prev)
+		c.Compile(parse(changed))
+		assertNotFailed(t, c)
+
+		path := MustParseRef("data.c")
+		if c.RuleTree.Find(path) != prev.RuleTree.Find(path) {
+			t.Errorf("expected rule tree node for %v to be shared", path)
+		}
+		if c.RuleTree.Find(MustParseRef("data.a")) == prev.RuleTree.Find(MustParseRef("data.a")) {
+			t.Errorf("expected rule tree node for data.a to be rebuilt")
+		}
+
+		full := NewCompiler()
+		full.Compile(parse(changed))
+		assertNotFailed(t, full)
+		assertCompilersEqual(t, full, c)
+	})
+
+	t.Run("incremental updates equal full compile", func(t *testing.T) {
+
+		modules := map[string]string{
+			"x.rego": `package x
+import future.keywords
+p[k] = v { some k, v in input.xs }
+q contains v if some v in input.ys
+r.s.t := 1 { input.a == 1 }
+r.s.u := 2 { input.a == 2 }
+f(x) := x + 1`,
+			"y.rego": `package y
+q { data.x.f(1) > 0 }
+r = data.x.r.s.t
+s { data.z.t + 1 > 0 }
+u { input.b == data.x.p.a }
+u { input.b == 1 }`,
+			"z.rego": `package w
+v := count(data.y)`,
+		}
+
+		updates := []map[string]string{
+			// Change a rule that others depend on.
+			{"x.rego": strings.Replace(modules["x.rego"], "x + 1", "x + 2", 1)},
+			// Add a rule that an unchanged rule refers to.
+			{"t.rego": `package z
+t := 1`},
+			// Remove a module.
+			{"z.rego": ""},
+			// Add a module with a ref head rule into an existing package.
+			{"v.rego": `package x
+r.s.v := 3`},
+			// Add a module to the system tree.
+			{"sys.rego": `package system
+main := data.y.r`},
+		}
+
+		prev := NewCompiler().WithIncremental(nil)
+		prev.Compile(parse(modules))
+		assertNotFailed(t, prev)
+
+		for i, update := range updates {
+			for name, src := range update {
+				if src == "" {
+					delete(modules, name)
+				} else {
+					modules[name] = src
+				}
+			}
+
+			c := NewCompiler().WithIncremental(prev)
+			c.Compile(parse(modules))
+			assertNotFailed(t, c)
+
+			full := NewCompiler()
+			full.Compile(parse(modules))
+			assertNotFailed(t, full)
+
+			t.Run(fmt.Sprint(i), func(t *testing.T) {
+				assertCompilersEqual(t, full, c)
+			})
+
+			prev = c
+		}
+	})
+
+	t.Run("type error in reused rule", func(t *testing.T) {
+		prev := NewCompiler().WithIncremental(nil)
+		prev.Compile(parse(map[string]string{
+			"y.rego": `package y
+p { data.x.y + 1 > 0 }`,
+		}))
+		assertNotFailed(t, prev)
+
+		c := NewCompiler().WithIncremental(prev)
+		c.Compile(parse(map[string]string{
+			"x.rego": `package x
+y := "s"`,
+			"y.rego": `package y
+p { data.x.y + 1 > 0 }`,
+		}))
+
+		if !c.Failed() {
+			t.Fatal("expected error")
+		}
+		if exp := "rego_type_error: plus: invalid argument(s)"; !strings.Contains(c.Errors.Error(), exp) {
+			t.Fatalf("expected error containing %q, got %v", exp, c.Errors)
+		}
+	})
+}
+
+// assertCompilersEqual checks that the rule trees, dependency graphs, types
+// and rule indices built by the two compilers are the same.
+func assertCompilersEqual(t *testing.T, exp, act *Compiler) {
+	t.Helper()
+
+	if e, a := ruleTreeString(exp.RuleTree), ruleTreeString(act.RuleTree); e != a {
+		t.Fatalf("expected rule tree:\n\n%v\n\nGot:\n\n%v", e, a)
+	}
+
+	rules := map[string]*Rule{}
+	exp.RuleTree.DepthFirst(func(node *TreeNode) bool {
+		for _, v := range node.Values {
+			for r := v.(*Rule); r != nil; r = r.Else {
+				rules[r.Location.String()] = r
+			}
+		}
+		return false
+	})
+
+	act.RuleTree.DepthFirst(func(node *TreeNode) bool {
+		for _, v := range node.Values {
+			for r := v.(*Rule); r != nil; r = r.Else {
+				e, ok := rules[r.Location.String()]
+				if !ok {
+					t.Fatalf("unexpected rule %v", r.Location)
+				}
+
+				if de, da := ruleDepsString(exp.Graph, e), ruleDepsString(act.Graph, r); de != da {
+					t.Errorf("expected dependencies of %v to be %v, got %v", r.Location, de, da)
+				}
+			}
+
+			path := v.(*Rule).Ref().GroundPrefix()
+			if te, ta := exp.TypeEnv.Get(path), act.TypeEnv.Get(path); types.Compare(te, ta) != 0 {
+				t.Errorf("expected type of %v to be %v, got %v", path, te, ta)
+			}
+
+			_, ie := exp.ruleIndices.Get(path)
+			_, ia := act.ruleIndices.Get(path)
+			if ie != ia {
+				t.Errorf("expected rule index for %v: %v, got %v", path, ie, ia)
+			}
+		}
+		return false
+	})
+}
+
+func ruleTreeString(node *TreeNode) string {
+	var buf bytes.Buffer
+	var rec func(*TreeNode, int)
+	rec = func(node *TreeNode, depth int) {
+		fmt.Fprintf(&buf, "%v%v hide:%v", strings.Repeat("  ", depth), node.Key, node.Hide)
+		for _, v := range node.Values {
+			fmt.Fprintf(&buf, " %v", v.(*Rule).Location)
+		}
+		buf.WriteString("\n")
+		for _, k := range node.Sorted {
+			rec(node.Children[k], depth+1)
+		}
+	}
+	rec(node, 0)
+	return buf.String()
+}
+
+func ruleDepsString(g *Graph, r *Rule) string {
+	deps := []string{}
+	for dep := range g.Dependencies(r) {
+		deps = append(deps, dep.(*Rule).Location.String())
+	}
+	sort.Strings(deps)
+	return strings.Join(deps, ", ")
+}
+
 // see https://github.com/open-policy-agent/opa/issues/5166
 func TestCompilerWithRecursiveSchema(t *testing.T) {
 
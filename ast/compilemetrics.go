@@ -6,4 +6,5 @@ package ast
 
 const (
 	compileStageComprehensionIndexBuild = "compile_stage_comprehension_index_build"
+	compileIncrementalModulesReused     = "compile_incremental_modules_reused"
 )
@@ -0,0 +1,413 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package ast
+
+import (
+	"bytes"
+
+	"github.com/open-policy-agent/opa/types"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// reusableModules returns the compiled modules from c.prev that can be reused
+// as-is when compiling modules. A module can be reused if its parsed form is
+// unchanged since c.prev compiled it and if none of the modules it depends on
+// changed. Changes to a package also invalidate every other module in the same
+// package because references are resolved against all rules in the package.
+func (c *Compiler) reusableModules(modules map[string]*Module) map[string]*Module {
+
+	prev := c.prev
+	if prev == nil || prev.Failed() || prev.parsedModules == nil || c.moduleLoader != nil || !c.compatibleWith(prev) {
+		return nil
+	}
+
+	// rego.metadata calls depend on annotations from other modules; fall back
+	// to compiling everything rather than tracking annotation scopes.
+	if prev.regoMetadataCalled {
+		return nil
+	}
+
+	dirtyPkgs := map[string]struct{}{}
+	dirtyRules := map[util.T]struct{}{}
+	queue := []util.T{}
+
+	invalidate := func(compiled *Module) {
+		dirtyPkgs[compiled.Package.Path.String()] = struct{}{}
+		WalkRules(compiled, func(r *Rule) bool {
+			if _, ok := dirtyRules[r]; !ok {
+				dirtyRules[r] = struct{}{}
+				queue = append(queue, r)
+			}
+			return false
+		})
+	}
+
+	for name, mod := range modules {
+		parsed, ok := prev.parsedModules[name]
+		if ok && moduleUnchanged(parsed, mod) {
+			continue
+		}
+		if callsRegoMetadata(mod) {
+			return nil
+		}
+		dirtyPkgs[mod.Package.Path.String()] = struct{}{}
+		if ok {
+			invalidate(prev.Modules[name])
+		}
+	}
+
+	for name := range prev.parsedModules {
+		if _, ok := modules[name]; !ok {
+			invalidate(prev.Modules[name])
+		}
+	}
+
+	// Every rule that (transitively) depends on a changed rule has to be
+	// recompiled, e.g., because the arity of a function it calls may differ.
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		for dep := range prev.Graph.Dependents(r) {
+			if _, ok := dirtyRules[dep]; !ok {
+				dirtyRules[dep] = struct{}{}
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	dirtyModules := map[string]struct{}{}
+	for name, compiled := range prev.Modules {
+		WalkRules(compiled, func(r *Rule) bool {
+			if _, ok := dirtyRules[r]; ok {
+				dirtyModules[name] = struct{}{}
+				return true
+			}
+			return false
+		})
+	}
+
+	reuse := make(map[string]*Module, len(modules))
+
+	for name, mod := range modules {
+		parsed, ok := prev.parsedModules[name]
+		if !ok || !moduleUnchanged(parsed, mod) {
+			continue
+		}
+		if _, ok := dirtyModules[name]; ok {
+			continue
+		}
+		compiled := prev.Modules[name]
+		if _, ok := dirtyPkgs[compiled.Package.Path.String()]; ok {
+			continue
+		}
+		reuse[name] = compiled
+	}
+
+	return reuse
+}
+
+// compatibleWith returns true if the modules compiled by other would have been
+// compiled the same way by c. Stages registered with WithStageAfter cannot be
+// compared, so compilers using them are never compatible.
+func (c *Compiler) compatibleWith(other *Compiler) bool {
+
+	if len(c.after) > 0 || len(other.after) > 0 {
+		return false
+	}
+
+	if c.strict != other.strict ||
+		c.enablePrintStatements != other.enablePrintStatements ||
+		c.useTypeCheckAnnotations != other.useTypeCheckAnnotations ||
+		c.schemaSet != other.schemaSet ||
+		len(c.builtins) != len(other.builtins) ||
+		len(c.unsafeBuiltinsMap) != len(other.unsafeBuiltinsMap) ||
+		len(c.capabilities.Features) != len(other.capabilities.Features) {
+		return false
+	}
+
+	for name, bi := range c.builtins {
+		if x, ok := other.builtins[name]; !ok || types.Compare(x.Decl, bi.Decl) != 0 {
+			return false
+		}
+	}
+
+	for name := range c.unsafeBuiltinsMap {
+		if _, ok := other.unsafeBuiltinsMap[name]; !ok {
+			return false
+		}
+	}
+
+	for i := range c.capabilities.Features {
+		if c.capabilities.Features[i] != other.capabilities.Features[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// moduleUnchanged returns true if a and b are the same module. Unlike Equal,
+// this also considers locations so that errors and traces produced with the
+// reused module refer to the current source.
+func moduleUnchanged(a, b *Module) bool {
+
+	if a == b {
+		return true
+	}
+
+	if !a.Equal(b) || !locationUnchanged(a.Package.Location, b.Package.Location) || len(a.Comments) != len(b.Comments) {
+		return false
+	}
+
+	for i := range a.Imports {
+		if !locationUnchanged(a.Imports[i].Location, b.Imports[i].Location) {
+			return false
+		}
+	}
+
+	for i := range a.Rules {
+		if !locationUnchanged(a.Rules[i].Location, b.Rules[i].Location) {
+			return false
+		}
+	}
+
+	for i := range a.Comments {
+		if !locationUnchanged(a.Comments[i].Location, b.Comments[i].Location) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// locationUnchanged compares the position and text of two locations. Because
+// the text of a rule covers its entire definition, equal rule locations imply
+// equal locations for all nodes inside the rule.
+func locationUnchanged(a, b *Location) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.File == b.File && a.Row == b.Row && a.Col == b.Col && bytes.Equal(a.Text, b.Text)
+}
+
+func callsRegoMetadata(mod *Module) bool {
+	var found bool
+	WalkExprs(mod, func(expr *Expr) bool {
+		if isRegoMetadataChainCall(expr) || isRegoMetadataRuleCall(expr) {
+			found = true
+		}
+		return found
+	})
+	return found
+}
+
+// incrementalBase is the state of the previous compilation that the stages
+// building the rule tree, the dependency graph, the type environment and the
+// rule indices carry forward. Only the parts that changed modules contribute
+// to are rebuilt.
+type incrementalBase struct {
+	ruleTree    *TreeNode
+	graph       *Graph
+	ruleTypes   map[*Rule]checkedRule
+	ruleIndices *util.HashMap
+	paths       []Ref                  // package paths of the changed modules, old and new
+	shared      map[*TreeNode]struct{} // roots of the rule subtrees carried forward, set by updateRuleTree
+	changed     map[*Rule]struct{}     // rules whose dependencies were looked up again, set by updateGraph
+}
+
+func newIncrementalBase(prev *Compiler, reuse map[string]*Module) *incrementalBase {
+	b := &incrementalBase{
+		ruleTree:    prev.RuleTree,
+		graph:       prev.Graph,
+		ruleTypes:   prev.ruleTypes,
+		ruleIndices: prev.ruleIndices,
+	}
+	for name, mod := range prev.Modules {
+		if reuse[name] != mod {
+			b.paths = append(b.paths, mod.Package.Path)
+		}
+	}
+	return b
+}
+
+// overlaps returns true if a changed module may define rules at or under
+// path, or at a path that path refers into.
+func (b *incrementalBase) overlaps(path Ref) bool {
+	for _, p := range b.paths {
+		if path.HasPrefix(p) || p.HasPrefix(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateRuleTree returns the rule tree for the modules compiled by c. Subtrees
+// of the previous rule tree that no changed module contributes to are shared
+// with the new tree, the rest of the tree is rebuilt from the modules.
+func (b *incrementalBase) updateRuleTree(c *Compiler) *TreeNode {
+
+	for _, name := range c.pending {
+		b.paths = append(b.paths, c.Modules[name].Package.Path)
+	}
+
+	b.shared = map[*TreeNode]struct{}{}
+	root := b.copyTreeNode(b.ruleTree, Ref{})
+
+	for _, name := range c.sorted {
+		mod := c.Modules[name]
+		// Rules are defined under the package path, so they cannot be part
+		// of a shared subtree if the package overlaps a changed module.
+		if !b.overlaps(mod.Package.Path) {
+			continue
+		}
+		if len(mod.Rules) == 0 {
+			root.add(mod.Package.Path, nil)
+		}
+		for _, rule := range mod.Rules {
+			if path := rule.Ref().GroundPrefix(); b.overlaps(path) {
+				root.add(path, rule)
+			}
+		}
+	}
+
+	// ensure that data.system's TreeNode is hidden
+	node, tail := root.find(DefaultRootRef.Append(NewTerm(SystemDocumentKey)))
+	if len(tail) == 0 && !node.Hide {
+		node.Hide = true
+	}
+
+	root.DepthFirst(func(x *TreeNode) bool {
+		if _, ok := b.shared[x]; ok {
+			return true
+		}
+		x.sort()
+		return false
+	})
+
+	return root
+}
+
+// copyTreeNode returns node if no changed module contributes to it. Otherwise,
+// it returns a copy of node without any rules, that shares the unaffected
+// subtrees of node. Copies that end up empty are dropped by the caller.
+func (b *incrementalBase) copyTreeNode(node *TreeNode, path Ref) *TreeNode {
+
+	if !b.overlaps(path) {
+		b.shared[node] = struct{}{}
+		return node
+	}
+
+	cpy := &TreeNode{Key: node.Key, Hide: node.Hide}
+
+	for _, k := range node.Sorted {
+		child := b.copyTreeNode(node.Children[k], path.Append(NewTerm(k)))
+		if _, ok := b.shared[child]; !ok && len(child.Values) == 0 && len(child.Children) == 0 {
+			continue
+		}
+		if cpy.Children == nil {
+			cpy.Children = make(map[Value]*TreeNode, len(node.Children))
+		}
+		cpy.Children[k] = child
+		cpy.Sorted = append(cpy.Sorted, k)
+	}
+
+	return cpy
+}
+
+// updateGraph returns the dependency graph for the modules compiled by c. The
+// dependencies of reused rules are copied from the previous graph unless they
+// refer to a changed module.
+func (b *incrementalBase) updateGraph(c *Compiler, list func(Ref) []*Rule) *Graph {
+
+	pending := make(map[string]struct{}, len(c.pending))
+	for _, name := range c.pending {
+		pending[name] = struct{}{}
+	}
+
+	b.changed = map[*Rule]struct{}{}
+	graph := newGraph()
+
+	for name, mod := range c.Modules {
+		_, recompiled := pending[name]
+		WalkRules(mod, func(a *Rule) bool {
+			if recompiled || b.refersToChanged(a) {
+				b.changed[a] = struct{}{}
+				graph.addRule(a, list)
+				return false
+			}
+			graph.addNode(a)
+			for dep := range b.graph.Dependencies(a) {
+				graph.addDependency(a, dep)
+			}
+			return false
+		})
+	}
+
+	return graph
+}
+
+// refersToChanged returns true if rule refers to documents that a changed
+// module may define.
+func (b *incrementalBase) refersToChanged(rule *Rule) bool {
+	var found bool
+	vis := NewGenericVisitor(func(x interface{}) bool {
+		if ref, ok := x.(Ref); ok && ref[0].Equal(DefaultRootDocument) && b.overlaps(ref.GroundPrefix()) {
+			found = true
+		}
+		return found
+	})
+	vis.Walk(rule.Head)
+	vis.Walk(rule.Body)
+	return found
+}
+
+// reusableRuleTypes returns a function that returns the previously inferred
+// type of the rules that have not changed and that do not (transitively)
+// depend on changed rules.
+func (b *incrementalBase) reusableRuleTypes(c *Compiler) func(*Rule) (checkedRule, bool) {
+
+	dirty := make(map[util.T]struct{}, len(b.changed))
+	queue := make([]util.T, 0, len(b.changed))
+	for r := range b.changed {
+		dirty[r] = struct{}{}
+		queue = append(queue, r)
+	}
+
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		for dep := range c.Graph.Dependents(r) {
+			if _, ok := dirty[dep]; !ok {
+				dirty[dep] = struct{}{}
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	return func(r *Rule) (checkedRule, bool) {
+		if _, ok := dirty[r]; ok {
+			return checkedRule{}, false
+		}
+		cr, ok := b.ruleTypes[r]
+		return cr, ok
+	}
+}
+
+// indexUnchanged returns true if the previous rule index for the rules at path
+// can be reused, i.e., no changed module defines rules at path and none of the
+// rules refer to changed modules.
+func (b *incrementalBase) indexUnchanged(path Ref, rules []*Rule) bool {
+	if b.overlaps(path) {
+		return false
+	}
+	for _, r := range rules {
+		for ; r != nil; r = r.Else {
+			if _, ok := b.changed[r]; ok {
+				return false
+			}
+		}
+	}
+	return true
+}
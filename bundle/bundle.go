@@ -526,12 +526,12 @@ func (r *Reader) Read() (Bundle, error) {
 	bundle.lazyLoadingMode = r.lazyLoadingMode
 	bundle.sizeLimitBytes = r.sizeLimitBytes
 
-	if bundle.Type() == SnapshotBundleType {
-		err = r.checkSignaturesAndDescriptors(bundle.Signatures)
-		if err != nil {
-			return bundle, err
-		}
+	err = r.checkSignaturesAndDescriptors(bundle.Signatures)
+	if err != nil {
+		return bundle, err
+	}
 
+	if bundle.Type() == SnapshotBundleType {
 		bundle.Data = map[string]interface{}{}
 	}
 
@@ -542,7 +542,7 @@ func (r *Reader) Read() (Bundle, error) {
 		}
 
 		// verify the file content
-		if bundle.Type() == SnapshotBundleType && !bundle.Signatures.isEmpty() {
+		if !bundle.Signatures.isEmpty() {
 			path := f.Path()
 			if r.baseDir != "" {
 				path = f.URL()
@@ -667,7 +667,7 @@ func (r *Reader) Read() (Bundle, error) {
 	}
 
 	// check if the bundle signatures specify any files that weren't found in the bundle
-	if bundle.Type() == SnapshotBundleType && len(r.files) != 0 {
+	if len(r.files) != 0 {
 		extra := []string{}
 		for k := range r.files {
 			extra = append(extra, k)
@@ -850,6 +850,10 @@ func (w *Writer) Write(bundle Bundle) error {
 		if err := writePatch(tw, bundle); err != nil {
 			return err
 		}
+
+		if err := writeSignatures(tw, bundle); err != nil {
+			return err
+		}
 	}
 
 	if err := writeManifest(tw, bundle); err != nil {
@@ -946,11 +950,31 @@ func hashBundleFiles(hash SignatureHasher, b *Bundle) ([]FileInfo, error) {
 
 	files := []FileInfo{}
 
-	bs, err := hash.HashFile(b.Data)
-	if err != nil {
-		return files, err
+	// Delta bundles contain the patch instead of data. Like the manifest, the
+	// patch is hashed as a JSON structure.
+	if b.Type() == DeltaBundleType {
+		pbs, err := json.Marshal(b.Patch)
+		if err != nil {
+			return files, err
+		}
+
+		var result map[string]interface{}
+		if err := util.Unmarshal(pbs, &result); err != nil {
+			return files, err
+		}
+
+		bs, err := hash.HashFile(result)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, NewFile(patchFile, hex.EncodeToString(bs), defaultHashingAlg))
+	} else {
+		bs, err := hash.HashFile(b.Data)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, NewFile(strings.TrimPrefix("data.json", "/"), hex.EncodeToString(bs), defaultHashingAlg))
 	}
-	files = append(files, NewFile(strings.TrimPrefix("data.json", "/"), hex.EncodeToString(bs), defaultHashingAlg))
 
 	if len(b.Wasm) != 0 {
 		bs, err := hash.HashFile(b.Wasm)
@@ -992,7 +1016,7 @@ func hashBundleFiles(hash SignatureHasher, b *Bundle) ([]FileInfo, error) {
 			return files, err
 		}
 
-		bs, err = hash.HashFile(result)
+		bs, err := hash.HashFile(result)
 		if err != nil {
 			return files, err
 		}
@@ -1000,7 +1024,7 @@ func hashBundleFiles(hash SignatureHasher, b *Bundle) ([]FileInfo, error) {
 		files = append(files, NewFile(strings.TrimPrefix(ManifestExt, "/"), hex.EncodeToString(bs), defaultHashingAlg))
 	}
 
-	return files, err
+	return files, nil
 }
 
 // FormatModules formats Rego modules
@@ -1390,7 +1414,8 @@ func modulePathWithPrefix(bundleName string, modulePath string) string {
 // IsStructuredDoc checks if the file name equals a structured file extension ex. ".json"
 func IsStructuredDoc(name string) bool {
 	return filepath.Base(name) == dataFile || filepath.Base(name) == yamlDataFile ||
-		filepath.Base(name) == SignaturesFile || filepath.Base(name) == ManifestExt
+		filepath.Base(name) == SignaturesFile || filepath.Base(name) == ManifestExt ||
+		filepath.Base(name) == patchFile
 }
 
 func preProcessBundle(loader DirectoryLoader, skipVerify bool, sizeLimitBytes int64) (SignaturesConfig, Patch, []*Descriptor, error) {
@@ -0,0 +1,169 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/util"
+)
+
+// Diff returns a delta bundle that transforms the data of the old snapshot
+// bundle into the data of the new snapshot bundle. The delta bundle carries the
+// manifest of the new bundle. Since delta bundles can only update data, Diff
+// returns an error if the bundles contain different policies or wasm modules,
+// or if their roots or wasm resolvers differ. If the data of the bundles is
+// equal, the patch of the returned bundle is empty.
+func Diff(old, new Bundle) (Bundle, error) {
+
+	if old.Type() != SnapshotBundleType || new.Type() != SnapshotBundleType {
+		return Bundle{}, fmt.Errorf("delta bundles can only be computed between snapshot bundles")
+	}
+
+	oldManifest, newManifest := old.Manifest.Copy(), new.Manifest.Copy()
+	oldManifest.Init()
+	newManifest.Init()
+
+	if !oldManifest.equalWasmResolversAndRoots(newManifest) {
+		return Bundle{}, fmt.Errorf("delta bundles cannot change the bundle roots or wasm resolvers")
+	}
+
+	if err := diffModules(old, new); err != nil {
+		return Bundle{}, err
+	}
+
+	var ops []PatchOperation
+	diffData(*newManifest.Roots, nil, old.Data, new.Data, &ops)
+
+	return Bundle{
+		Manifest: new.Manifest.Copy(),
+		Patch:    Patch{Data: ops},
+	}, nil
+}
+
+func diffModules(old, new Bundle) error {
+
+	oldModules := make(map[string]ModuleFile, len(old.Modules))
+	for _, mf := range old.Modules {
+		oldModules[strings.TrimPrefix(mf.Path, "/")] = mf
+	}
+
+	for _, mf := range new.Modules {
+		path := strings.TrimPrefix(mf.Path, "/")
+		other, ok := oldModules[path]
+		if !ok {
+			return fmt.Errorf("delta bundles cannot update policies but %v was added", path)
+		}
+		if !equalModuleFiles(mf, other) {
+			return fmt.Errorf("delta bundles cannot update policies but %v was changed", path)
+		}
+		delete(oldModules, path)
+	}
+
+	for _, mf := range old.Modules {
+		path := strings.TrimPrefix(mf.Path, "/")
+		if _, ok := oldModules[path]; ok {
+			return fmt.Errorf("delta bundles cannot update policies but %v was removed", path)
+		}
+	}
+
+	if !bytes.Equal(old.Wasm, new.Wasm) || len(old.WasmModules) != len(new.WasmModules) {
+		return fmt.Errorf("delta bundles cannot update wasm modules")
+	}
+
+	for i := range new.WasmModules {
+		if old.WasmModules[i].Path != new.WasmModules[i].Path || !bytes.Equal(old.WasmModules[i].Raw, new.WasmModules[i].Raw) {
+			return fmt.Errorf("delta bundles cannot update wasm modules")
+		}
+	}
+
+	if len(old.PlanModules) != len(new.PlanModules) {
+		return fmt.Errorf("delta bundles cannot update plan files")
+	}
+
+	for i := range new.PlanModules {
+		if old.PlanModules[i].Path != new.PlanModules[i].Path || !bytes.Equal(old.PlanModules[i].Raw, new.PlanModules[i].Raw) {
+			return fmt.Errorf("delta bundles cannot update plan files")
+		}
+	}
+
+	return nil
+}
+
+// equalModuleFiles compares the parsed modules if available, so that modules
+// that only differ in formatting are considered equal.
+func equalModuleFiles(a, b ModuleFile) bool {
+	if a.Parsed != nil && b.Parsed != nil {
+		return a.Parsed.Equal(b.Parsed)
+	}
+	return bytes.Equal(a.Raw, b.Raw)
+}
+
+// diffData appends the operations that transform old into new to ops. Objects
+// are compared key by key, all other values are replaced as a whole. Paths that
+// are not contained in any of the bundle roots are only descended into, as the
+// patch must not touch data outside of the roots.
+func diffData(roots []string, path []string, old, new interface{}, ops *[]PatchOperation) {
+
+	oldObj, oldIsObj := old.(map[string]interface{})
+	newObj, newIsObj := new.(map[string]interface{})
+
+	contained := len(path) > 0 && RootPathsContain(roots, strings.Join(path, "/"))
+
+	if contained && (!oldIsObj || !newIsObj) {
+		if util.Compare(old, new) != 0 {
+			*ops = append(*ops, PatchOperation{Op: "replace", Path: patchPath(path), Value: new})
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(oldObj)+len(newObj))
+	for key := range oldObj {
+		keys = append(keys, key)
+	}
+	for key := range newObj {
+		if _, ok := oldObj[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := append(path[:len(path):len(path)], key)
+		oldChild, inOld := oldObj[key]
+		newChild, inNew := newObj[key]
+
+		if !RootPathsContain(roots, strings.Join(childPath, "/")) {
+			diffData(roots, childPath, oldChild, newChild, ops)
+			continue
+		}
+
+		switch {
+		case !inNew:
+			*ops = append(*ops, PatchOperation{Op: "remove", Path: patchPath(childPath)})
+		case !inOld:
+			*ops = append(*ops, PatchOperation{Op: "upsert", Path: patchPath(childPath), Value: newChild})
+		default:
+			diffData(roots, childPath, oldChild, newChild, ops)
+		}
+	}
+}
+
+// patchPath returns the path of a patch operation. Keys are escaped as JSON
+// pointer tokens and then URL path escaped, i.e., the inverse of how
+// applyPatches parses the paths.
+func patchPath(path []string) string {
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	var sb strings.Builder
+	for _, key := range path {
+		sb.WriteByte('/')
+		sb.WriteString(url.PathEscape(escaper.Replace(key)))
+	}
+	return sb.String()
+}
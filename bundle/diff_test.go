@@ -0,0 +1,274 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/internal/storage/mock"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/util"
+)
+
+func TestDiff(t *testing.T) {
+
+	tests := []struct {
+		note  string
+		roots []string
+		old   string
+		new   string
+		exp   string
+	}{
+		{
+			note: "equal",
+			old:  `{"a": {"b": 1}}`,
+			new:  `{"a": {"b": 1}}`,
+			exp:  `[]`,
+		},
+		{
+			note: "numbers compared by value",
+			old:  `{"a": 1.0}`,
+			new:  `{"a": 1}`,
+			exp:  `[]`,
+		},
+		{
+			note: "nested changes",
+			old:  `{"a": {"b": 1, "c": {"d": true}, "e": [1, 2]}, "x": "y"}`,
+			new:  `{"a": {"b": 2, "c": {"f": null}, "e": [1, 2, 3]}, "z": {"w": 1}}`,
+			exp: `[
+				{"op": "replace", "path": "/a/b", "value": 2},
+				{"op": "remove", "path": "/a/c/d"},
+				{"op": "upsert", "path": "/a/c/f", "value": null},
+				{"op": "replace", "path": "/a/e", "value": [1, 2, 3]},
+				{"op": "remove", "path": "/x"},
+				{"op": "upsert", "path": "/z", "value": {"w": 1}}
+			]`,
+		},
+		{
+			note: "type change",
+			old:  `{"a": {"b": 1}}`,
+			new:  `{"a": "b"}`,
+			exp:  `[{"op": "replace", "path": "/a", "value": "b"}]`,
+		},
+		{
+			note: "escaped keys",
+			old:  `{}`,
+			new:  `{"a/b": {"c~d": 1, "e f": 2}}`,
+			exp:  `[{"op": "upsert", "path": "/a~1b", "value": {"c~d": 1, "e f": 2}}]`,
+		},
+		{
+			note:  "roots",
+			roots: []string{"a/b", "c"},
+			old:   `{"a": {"b": {"x": 1}}, "c": 1}`,
+			new:   `{"a": {}, "c": 2}`,
+			exp: `[
+				{"op": "remove", "path": "/a/b"},
+				{"op": "replace", "path": "/c", "value": 2}
+			]`,
+		},
+		{
+			note:  "roots added",
+			roots: []string{"a/b"},
+			old:   `{}`,
+			new:   `{"a": {"b": {"x": 1}}}`,
+			exp:   `[{"op": "upsert", "path": "/a/b", "value": {"x": 1}}]`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			manifest := Manifest{Revision: "new"}
+			if tc.roots != nil {
+				manifest.Roots = &tc.roots
+			}
+
+			old := Bundle{Manifest: Manifest{Revision: "old", Roots: manifest.Roots}, Data: util.MustUnmarshalJSON([]byte(tc.old)).(map[string]interface{})}
+			new := Bundle{Manifest: manifest, Data: util.MustUnmarshalJSON([]byte(tc.new)).(map[string]interface{})}
+
+			delta, err := Diff(old, new)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !delta.Manifest.Equal(manifest) {
+				t.Fatalf("expected manifest %v but got %v", manifest, delta.Manifest)
+			}
+
+			var exp []PatchOperation
+			if err := util.UnmarshalJSON([]byte(tc.exp), &exp); err != nil {
+				t.Fatal(err)
+			}
+
+			ops := delta.Patch.Data
+			if ops == nil {
+				ops = []PatchOperation{}
+			}
+
+			actual := util.MustUnmarshalJSON(util.MustMarshalJSON(ops))
+			if expected := util.MustUnmarshalJSON(util.MustMarshalJSON(exp)); util.Compare(expected, actual) != 0 {
+				t.Fatalf("expected %v but got %v", expected, actual)
+			}
+
+			// Applying the patch to the old data must yield the new data.
+			ctx := context.Background()
+			store := mock.New()
+			txn := storage.NewTransactionOrDie(ctx, store, storage.WriteParams)
+
+			if err := store.Write(ctx, txn, storage.AddOp, storage.Path{}, old.Data); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := applyPatches(ctx, store, txn, delta.Patch.Data); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := store.Read(ctx, txn, storage.Path{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if util.Compare(result, new.Data) != 0 {
+				t.Fatalf("expected %v after applying the patch but got %v", new.Data, result)
+			}
+		})
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+
+	module := func(path, src string) ModuleFile {
+		return ModuleFile{URL: path, Path: path, Raw: []byte(src), Parsed: ast.MustParseModule(src)}
+	}
+
+	base := Bundle{
+		Manifest: Manifest{Roots: &[]string{"a"}},
+		Modules:  []ModuleFile{module("/a/x.rego", "package a\np = 1")},
+		Data:     map[string]interface{}{},
+	}
+
+	tests := []struct {
+		note string
+		new  Bundle
+		err  string
+	}{
+		{
+			note: "roots changed",
+			new:  Bundle{Manifest: Manifest{Roots: &[]string{"b"}}, Modules: base.Modules},
+			err:  "delta bundles cannot change the bundle roots or wasm resolvers",
+		},
+		{
+			note: "policy changed",
+			new:  Bundle{Manifest: base.Manifest, Modules: []ModuleFile{module("/a/x.rego", "package a\np = 2")}},
+			err:  "delta bundles cannot update policies but a/x.rego was changed",
+		},
+		{
+			note: "policy added",
+			new:  Bundle{Manifest: base.Manifest, Modules: append([]ModuleFile{module("/a/y.rego", "package a")}, base.Modules...)},
+			err:  "delta bundles cannot update policies but a/y.rego was added",
+		},
+		{
+			note: "policy removed",
+			new:  Bundle{Manifest: base.Manifest},
+			err:  "delta bundles cannot update policies but a/x.rego was removed",
+		},
+		{
+			note: "wasm changed",
+			new:  Bundle{Manifest: base.Manifest, Modules: base.Modules, WasmModules: []WasmModuleFile{{Path: "/policy.wasm", Raw: []byte("wasm")}}},
+			err:  "delta bundles cannot update wasm modules",
+		},
+		{
+			note: "delta bundle",
+			new:  Bundle{Manifest: base.Manifest, Modules: base.Modules, Patch: Patch{Data: []PatchOperation{{Op: "remove", Path: "/a"}}}},
+			err:  "delta bundles can only be computed between snapshot bundles",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := Diff(base, tc.new)
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("expected error %q but got: %v", tc.err, err)
+			}
+		})
+	}
+
+	// Modules that only differ in formatting are equal.
+	reformatted := Bundle{Manifest: base.Manifest, Modules: []ModuleFile{module("/a/x.rego", "package a\n\np = 1\n")}}
+	if _, err := Diff(base, reformatted); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffSignedRoundtrip(t *testing.T) {
+
+	old := Bundle{
+		Manifest: Manifest{Revision: "r1", Roots: &[]string{"a"}},
+		Data:     map[string]interface{}{"a": map[string]interface{}{"b": util.MustUnmarshalJSON([]byte(`{"x": [1, 2, 3]}`)), "c": "x"}},
+	}
+
+	new := Bundle{
+		Manifest: Manifest{Revision: "r2", Roots: &[]string{"a"}},
+		Data:     map[string]interface{}{"a": map[string]interface{}{"b": util.MustUnmarshalJSON([]byte(`{"x": [1, 2, 3]}`)), "d": "y"}},
+	}
+
+	delta, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := delta.GenerateSignature(NewSigningConfig("secret", "HS256", ""), "foo", false); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Write(delta); err != nil {
+		t.Fatal(err)
+	}
+
+	vc := NewVerificationConfig(map[string]*KeyConfig{"foo": {Key: "secret", Algorithm: "HS256"}}, "foo", "", nil)
+
+	result, err := NewReader(bytes.NewReader(buf.Bytes())).WithBundleVerificationConfig(vc).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Type() != DeltaBundleType || result.Manifest.Revision != "r2" {
+		t.Fatalf("expected delta bundle with revision r2 but got %v bundle with revision %v", result.Type(), result.Manifest.Revision)
+	}
+
+	if !reflect.DeepEqual(result.Signatures, delta.Signatures) {
+		t.Fatal("expected signatures to be the same")
+	}
+
+	// Tampering with the patch must fail verification.
+	delta.Patch.Data[0].Op = "upsert"
+	buf.Reset()
+	if err := NewWriter(&buf).Write(delta); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewReader(&buf).WithBundleVerificationConfig(vc).Read()
+	if err == nil || !strings.Contains(err.Error(), "patch.json: digest mismatch") {
+		t.Fatalf("expected digest mismatch but got: %v", err)
+	}
+
+	// Unsigned delta bundles are rejected if verification is required.
+	delta.Signatures = SignaturesConfig{}
+	buf.Reset()
+	if err := NewWriter(&buf).Write(delta); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewReader(&buf).WithBundleVerificationConfig(vc).Read()
+	if err == nil || err.Error() != "bundle missing .signatures.json file" {
+		t.Fatalf("expected missing signatures error but got: %v", err)
+	}
+}
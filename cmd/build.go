@@ -18,6 +18,7 @@ import (
 	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/compile"
 	"github.com/open-policy-agent/opa/keys"
+	"github.com/open-policy-agent/opa/loader"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -43,12 +44,15 @@ type buildParams struct {
 	excludeVerifyFiles []string
 	plugin             string
 	ns                 string
+	deltaFrom          string
+	goPackage          string
 }
 
 func newBuildParams() buildParams {
 	return buildParams{
 		capabilities: newcapabilitiesFlag(),
 		target:       util.NewEnumFlag(compile.TargetRego, compile.Targets),
+		goPackage:    "policy",
 	}
 }
 
@@ -123,6 +127,12 @@ The 'build' command supports targets (specified by -t):
             This is for further processing, OPA cannot evaluate a "plan bundle" like it
             can evaluate a wasm or rego bundle.
 
+    go      The go target emits the source code of a Go package (instead of a bundle)
+            compiled from the input files for each specified entrypoint. The package
+            embeds the data files and evaluates the entrypoints with the runtime in
+            github.com/open-policy-agent/opa/sdk/golang. The output file defaults to
+            "policy.go" and the package name can be set with --go-package.
+
 The -e flag tells the 'build' command which documents (entrypoints) will be queried by 
 the software asking for policy decisions, so that it can focus optimization efforts and 
 ensure that document is not eliminated by the optimizer.
@@ -176,6 +186,22 @@ containing optional claims.
 For more information on the format of the ".signatures.json" file
 see https://www.openpolicyagent.org/docs/latest/management-bundles/#signature-format.
 
+Delta Bundles
+-------------
+
+The 'build' command can output a delta bundle instead of a snapshot bundle. Delta
+bundles contain the data changes since a previous snapshot bundle as a list of patch
+operations. Use the --delta-from flag to provide the previous bundle:
+
+    $ opa build --bundle ./policies --revision v2 --delta-from v1.tar.gz -o v2-delta.tar.gz
+
+The delta bundle carries the manifest of the new bundle, e.g., its revision. Since delta
+bundles can only update data, the policies, wasm modules, and roots of both bundles must
+be the same. Delta bundles can be signed like snapshot bundles.
+
+For more information on delta bundles, see
+https://www.openpolicyagent.org/docs/latest/management-bundles/#delta-bundles.
+
 Capabilities
 ------------
 
@@ -221,6 +247,9 @@ against OPA v0.22.0:
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
+			if buildParams.target.String() == compile.TargetGo && !cmd.Flags().Changed("output") {
+				buildParams.outputFile = "policy.go"
+			}
 			if err := dobuild(buildParams, args); err != nil {
 				fmt.Println("error:", err)
 				os.Exit(1)
@@ -236,6 +265,8 @@ against OPA v0.22.0:
 	buildCommand.Flags().VarP(&buildParams.revision, "revision", "r", "set output bundle revision")
 	buildCommand.Flags().StringVarP(&buildParams.outputFile, "output", "o", "bundle.tar.gz", "set the output filename")
 	buildCommand.Flags().StringVar(&buildParams.ns, "partial-namespace", "partial", "set the namespace to use for partially evaluated files in an optimized bundle")
+	buildCommand.Flags().StringVar(&buildParams.deltaFrom, "delta-from", "", "output a delta bundle with the data changes since the given bundle")
+	buildCommand.Flags().StringVar(&buildParams.goPackage, "go-package", "policy", "set the package name of the generated Go source code (go target only)")
 
 	addBundleModeFlag(buildCommand.Flags(), &buildParams.bundleMode, false)
 	addIgnoreFlag(buildCommand.Flags(), &buildParams.ignore)
@@ -298,7 +329,8 @@ func dobuild(params buildParams, args []string) error {
 		WithFilter(buildCommandLoaderFilter(params.bundleMode, params.ignore)).
 		WithBundleVerificationConfig(bvc).
 		WithBundleSigningConfig(bsc).
-		WithPartialNamespace(params.ns)
+		WithPartialNamespace(params.ns).
+		WithGoPackage(params.goPackage)
 
 	if params.revision.isSet {
 		compiler = compiler.WithRevision(*params.revision.v)
@@ -316,6 +348,16 @@ func dobuild(params buildParams, args []string) error {
 		compiler = compiler.WithEnablePrintStatements(true)
 	}
 
+	if params.deltaFrom != "" {
+		// The previous bundle is typically the output of an earlier build, so
+		// its signatures are not verified again.
+		b, err := loader.NewFileLoader().WithSkipBundleVerification(true).AsBundle(params.deltaFrom)
+		if err != nil {
+			return fmt.Errorf("failed to load delta bundle base: %w", err)
+		}
+		compiler = compiler.WithDeltaFrom(b)
+	}
+
 	err = compiler.Build(context.Background())
 	if err != nil {
 		return err
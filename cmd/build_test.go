@@ -14,6 +14,7 @@ import (
 	"testing"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/loader"
 	"github.com/open-policy-agent/opa/util"
 	"github.com/open-policy-agent/opa/util/test"
@@ -620,6 +621,45 @@ f(x) { p[x] }
 	}
 }
 
+func TestBuildGoTarget(t *testing.T) {
+	files := map[string]string{
+		"test.rego": `
+			package test
+
+			p { input.user == data.admin }
+		`,
+		"data.json": `{"admin": "alice"}`,
+	}
+
+	test.WithTempFS(files, func(root string) {
+		params := newBuildParams()
+		if err := params.target.Set("go"); err != nil {
+			t.Fatal(err)
+		}
+		params.entrypoints.v = []string{"test/p"}
+		params.goPackage = "authz"
+		params.outputFile = path.Join(root, "policy.go")
+
+		err := dobuild(params, []string{root})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bs, err := os.ReadFile(params.outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		src := string(bs)
+
+		for _, exp := range []string{"package authz\n", `{Name: "test/p", Eval: plan0}`} {
+			if !strings.Contains(src, exp) {
+				t.Fatalf("expected generated source code to contain %q, got:\n%s", exp, src)
+			}
+		}
+	})
+}
+
 func TestBuildWasmWithAnnotations(t *testing.T) {
 	tests := []struct {
 		note        string
@@ -976,3 +1016,95 @@ func TestBuildBundleModeIgnoreFlag(t *testing.T) {
 		}
 	})
 }
+
+func TestBuildDeltaBundle(t *testing.T) {
+
+	files := map[string]string{
+		"/src/.manifest":     `{"roots": ["a"]}`,
+		"/src/a/data.json":   `{"b": 1, "c": {"d": true}}`,
+		"/src/a/policy.rego": "package a\n p = data.a.b",
+	}
+
+	test.WithTempFS(files, func(root string) {
+		src := path.Join(root, "src")
+
+		writeFile := func(name, content string) {
+			if err := os.WriteFile(path.Join(src, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		params := newBuildParams()
+		params.outputFile = path.Join(root, "v1.tar.gz")
+		params.bundleMode = true
+		params.revision.Set("v1")
+
+		if err := dobuild(params, []string{src}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Delta bundles without changes are rejected.
+		params = newBuildParams()
+		params.outputFile = path.Join(root, "v2.tar.gz")
+		params.bundleMode = true
+		params.revision.Set("v2")
+		params.deltaFrom = path.Join(root, "v1.tar.gz")
+		params.key = "secret"
+		params.algorithm = "HS256"
+
+		err := dobuild(params, []string{src})
+		if err == nil || !strings.Contains(err.Error(), "no data changes since the previous bundle") {
+			t.Fatalf("expected empty delta error but got: %v", err)
+		}
+
+		if _, err := os.Stat(params.outputFile); !os.IsNotExist(err) {
+			t.Fatalf("expected no output file but got: %v", err)
+		}
+
+		// Reformatting policies does not prevent delta bundles.
+		writeFile("a/data.json", `{"b": 2, "c": {}}`)
+		writeFile("a/policy.rego", "package a\n\np = data.a.b\n")
+
+		if err := dobuild(params, []string{src}); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(params.outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		vc := bundle.NewVerificationConfig(map[string]*bundle.KeyConfig{defaultPublicKeyID: {Key: "secret", Algorithm: "HS256"}}, defaultPublicKeyID, "", nil)
+
+		b, err := bundle.NewReader(f).WithBundleVerificationConfig(vc).Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if b.Type() != bundle.DeltaBundleType {
+			t.Fatalf("expected delta bundle but got %v", b.Type())
+		}
+
+		if b.Manifest.Revision != "v2" || !reflect.DeepEqual(*b.Manifest.Roots, []string{"a"}) {
+			t.Fatalf("unexpected manifest: %v", b.Manifest)
+		}
+
+		exp := []bundle.PatchOperation{
+			{Op: "replace", Path: "/a/b", Value: json.Number("2")},
+			{Op: "remove", Path: "/a/c/d"},
+		}
+
+		if !reflect.DeepEqual(b.Patch.Data, exp) {
+			t.Fatalf("expected patch %v but got %v", exp, b.Patch.Data)
+		}
+
+		// Delta bundles cannot update policies.
+		writeFile("a/policy.rego", "package a\n p = 1")
+
+		err = dobuild(params, []string{src})
+		if err == nil || !strings.Contains(err.Error(), "delta bundles cannot update policies") {
+			t.Fatalf("expected policy update error but got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/open-policy-agent/opa/debug"
+)
+
+type debugCommandParams struct {
+	addr string
+}
+
+func init() {
+
+	var params debugCommandParams
+
+	var debugCommand = &cobra.Command{
+		Use:   "debug",
+		Short: "Start a debug adapter for stepping through policies",
+		Long: `Start a debug adapter for stepping through policies.
+
+The 'debug' command serves the Debug Adapter Protocol (DAP) so that editors and other
+DAP clients can step through the evaluation of a query. By default, the protocol is
+served over stdin and stdout. With --addr, the command listens for TCP connections
+and serves one debug session per connection.
+
+The client launches the evaluation with a 'launch' request. The arguments of the
+request are:
+
+    query        query to evaluate, e.g., "data.authz.allow" (required)
+    input        input document
+    inputPath    path of a JSON or YAML file containing the input document
+    dataPaths    paths of policy and data files or directories to load
+    bundlePaths  paths of bundles to load
+    stopOnEntry  stop the evaluation before the first expression is evaluated
+
+Breakpoints are set on lines of the loaded policy files and may have a condition.
+The condition is a Rego query that is evaluated in the stopped frame: the
+evaluation is only stopped if the query is defined.
+
+Example:
+
+    $ opa debug --addr localhost:4711
+`,
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := doDebug(context.Background(), params, os.Stdin, os.Stdout, os.Stderr); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	debugCommand.Flags().StringVar(&params.addr, "addr", "", "listen for DAP clients on the TCP address instead of serving stdin and stdout")
+	RootCommand.AddCommand(debugCommand)
+}
+
+func doDebug(ctx context.Context, params debugCommandParams, stdin io.Reader, stdout, stderr io.Writer) error {
+
+	if params.addr == "" {
+		return debug.NewServer(stdin, stdout).Serve(ctx)
+	}
+
+	l, err := net.Listen("tcp", params.addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	fmt.Fprintf(stderr, "Listening for DAP clients on %v\n", l.Addr())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		if err := debug.NewServer(conn, conn).Serve(ctx); err != nil {
+			fmt.Fprintln(stderr, "error:", err)
+		}
+
+		conn.Close()
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDoDebugStdio(t *testing.T) {
+
+	var stdin, stdout, stderr bytes.Buffer
+
+	for i, req := range []string{
+		`{"seq": 1, "type": "request", "command": "initialize", "arguments": {"adapterID": "opa"}}`,
+		`{"seq": 2, "type": "request", "command": "disconnect"}`,
+	} {
+		fmt.Fprintf(&stdin, "Content-Length: %d\r\n\r\n%s", len(req), req)
+		if i == 0 {
+			// Blank lines between messages are ignored.
+			stdin.WriteString("\n")
+		}
+	}
+
+	if err := doDebug(context.Background(), debugCommandParams{}, &stdin, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, exp := range []string{
+		`"command":"initialize"`,
+		`"event":"initialized"`,
+		`"command":"disconnect"`,
+	} {
+		if !strings.Contains(stdout.String(), exp) {
+			t.Fatalf("Expected %v in output:\n%v", exp, stdout.String())
+		}
+	}
+
+	if stderr.Len() > 0 {
+		t.Fatalf("Unexpected output on stderr: %v", stderr.String())
+	}
+}
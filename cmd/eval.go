@@ -22,6 +22,7 @@ import (
 	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/compile"
 	"github.com/open-policy-agent/opa/cover"
+	"github.com/open-policy-agent/opa/internal/explain"
 	fileurl "github.com/open-policy-agent/opa/internal/file/url"
 	pr "github.com/open-policy-agent/opa/internal/presentation"
 	"github.com/open-policy-agent/opa/internal/runtime"
@@ -31,6 +32,7 @@ import (
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/open-policy-agent/opa/topdown"
 	"github.com/open-policy-agent/opa/topdown/lineage"
+	"github.com/open-policy-agent/opa/translate"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -41,6 +43,7 @@ type evalCommandParams struct {
 	unknowns            []string
 	disableInlining     []string
 	shallowInlining     bool
+	validate            bool
 	disableIndexing     bool
 	disableEarlyExit    bool
 	strictBuiltinErrors bool
@@ -75,15 +78,15 @@ type evalCommandParams struct {
 func newEvalCommandParams() evalCommandParams {
 	return evalCommandParams{
 		capabilities: newcapabilitiesFlag(),
-		outputFormat: util.NewEnumFlag(evalJSONOutput, []string{
+		outputFormat: util.NewEnumFlag(evalJSONOutput, append([]string{
 			evalJSONOutput,
 			evalValuesOutput,
 			evalBindingsOutput,
 			evalPrettyOutput,
 			evalSourceOutput,
 			evalRawOutput,
-		}),
-		explain:         newExplainFlag([]string{explainModeOff, explainModeFull, explainModeNotes, explainModeFails, explainModeDebug}),
+		}, translate.Targets()...)),
+		explain:         newExplainFlag([]string{explainModeOff, explainModeFull, explainModeNotes, explainModeFails, explainModeDebug, explainModeRules}),
 		target:          util.NewEnumFlag(compile.TargetRego, []string{compile.TargetRego, compile.TargetWasm}),
 		count:           1,
 		profileCriteria: newrepeatedStringFlag([]string{}),
@@ -111,10 +114,13 @@ func validateEvalParams(p *evalCommandParams, cmdArgs []string) error {
 		return errors.New("specify --fail or --fail-defined but not both")
 	}
 	of := p.outputFormat.String()
-	if p.partial && of != evalPrettyOutput && of != evalJSONOutput && of != evalSourceOutput {
+	_, translated := p.translationTarget()
+	if p.partial && of != evalPrettyOutput && of != evalJSONOutput && of != evalSourceOutput && !translated {
 		return errors.New("invalid output format for partial evaluation")
-	} else if !p.partial && of == evalSourceOutput {
+	} else if !p.partial && (of == evalSourceOutput || translated) {
 		return errors.New("invalid output format for evaluation")
+	} else if p.validate && !translated {
+		return errors.New("validation requires a translation target for --format")
 	}
 
 	if p.optimizationLevel > 0 {
@@ -135,6 +141,13 @@ func validateEvalParams(p *evalCommandParams, cmdArgs []string) error {
 	return nil
 }
 
+// translationTarget returns the target that partial evaluation results are
+// translated into if the output format names one.
+func (p *evalCommandParams) translationTarget() (translate.Target, bool) {
+	target, err := translate.ParseTarget(p.outputFormat.String())
+	return target, err == nil
+}
+
 const (
 	evalJSONOutput     = "json"
 	evalValuesOutput   = "values"
@@ -233,6 +246,20 @@ Set the output format with the --format flag.
     --format=source    : output partial evaluation results in a source format
     --format=raw       : output the values from query results in a scripting friendly format
 
+Partial evaluation results can be translated into queries for external data stores:
+
+    --format=sql+postgres  : output a parameterized PostgreSQL WHERE clause as JSON
+    --format=sql+mysql     : output a parameterized MySQL WHERE clause as JSON
+    --format=sql+sqlite    : output a parameterized SQLite WHERE clause as JSON
+    --format=elasticsearch : output an Elasticsearch query as JSON
+
+Column references in the partial evaluation results must refer to a table and a
+column, e.g., input.pets.owner, when unknowns are declared with --unknowns=input.pets.
+Results that cannot be translated are reported as errors. With --validate, partial
+evaluation is restricted to the subset of Rego that the target supports, i.e., policies
+that apply unsupported built-in functions or the with keyword to the unknowns are
+rejected before partial evaluation.
+
 Schema
 ------
 
@@ -288,6 +315,7 @@ access.
 	evalCommand.Flags().BoolVarP(&params.coverage, "coverage", "", false, "report coverage")
 	evalCommand.Flags().StringArrayVarP(&params.disableInlining, "disable-inlining", "", []string{}, "set paths of documents to exclude from inlining")
 	evalCommand.Flags().BoolVarP(&params.shallowInlining, "shallow-inlining", "", false, "disable inlining of rules that depend on unknowns")
+	evalCommand.Flags().BoolVarP(&params.validate, "validate", "", false, "restrict partial evaluation to the subset of Rego that the --format translation target supports")
 	evalCommand.Flags().BoolVar(&params.disableIndexing, "disable-indexing", false, "disable indexing optimizations")
 	evalCommand.Flags().BoolVar(&params.disableEarlyExit, "disable-early-exit", false, "disable 'early exit' optimizations")
 	evalCommand.Flags().BoolVarP(&params.strictBuiltinErrors, "strict-builtin-errors", "", false, "treat the first built-in function error encountered as fatal")
@@ -394,6 +422,8 @@ func eval(args []string, params evalCommandParams, w io.Writer) (bool, error) {
 		err = pr.Source(w, result)
 	case evalRawOutput:
 		err = pr.Raw(w, result)
+	case string(translate.Postgres), string(translate.MySQL), string(translate.SQLite), string(translate.Elasticsearch):
+		err = pr.Translation(w, result)
 	default:
 		err = pr.JSON(w, result)
 	}
@@ -442,6 +472,10 @@ func evalOnce(ctx context.Context, ectx *evalContext) pr.Output {
 		if resultErr == nil {
 			parsedModules = pq.Modules()
 			result.Partial, resultErr = pq.Partial(ctx, ectx.evalArgs...)
+			if target, ok := ectx.params.translationTarget(); ok && resultErr == nil {
+				// Translate before the locations are reset so that errors refer to the source.
+				result.Translation, resultErr = translate.Translate(result.Partial, target, ectx.unknowns)
+			}
 			resetExprLocations(result.Partial)
 		}
 	}
@@ -464,6 +498,8 @@ func evalOnce(ctx context.Context, ectx *evalContext) pr.Output {
 			result.Explanation = lineage.Notes(*(ectx.tracer))
 		case explainModeFails:
 			result.Explanation = lineage.Fails(*(ectx.tracer))
+		case explainModeRules:
+			result.RuleExplanation = explain.New(*(ectx.tracer))
 		}
 	}
 
@@ -498,6 +534,7 @@ type evalContext struct {
 	regoArgs         []func(*rego.Rego)
 	evalArgs         []rego.EvalOption
 	builtInErrorList *[]topdown.Error
+	unknowns         []*ast.Term
 }
 
 func setupEval(args []string, params evalCommandParams) (*evalContext, error) {
@@ -600,6 +637,12 @@ func setupEval(args []string, params evalCommandParams) (*evalContext, error) {
 		tracer = topdown.NewBufferTracer()
 		evalArgs = append(evalArgs, rego.EvalQueryTracer(tracer))
 
+		// Rule indexing skips bodies that cannot match the input, so they would
+		// be missing from the explanation.
+		if params.explain.String() == explainModeRules {
+			evalArgs = append(evalArgs, rego.EvalRuleIndexing(false))
+		}
+
 		if params.target.String() == compile.TargetWasm {
 			fmt.Fprintf(os.Stderr, "warning: explain mode \"%v\" is not supported with wasm target\n", params.explain.String())
 		}
@@ -625,12 +668,24 @@ func setupEval(args []string, params evalCommandParams) (*evalContext, error) {
 		evalArgs = append(evalArgs, rego.EvalQueryTracer(&rp))
 	}
 
+	var unknowns []*ast.Term
 	if params.partial {
-		regoArgs = append(regoArgs, rego.Unknowns(params.unknowns))
+		for _, u := range params.unknowns {
+			term, err := ast.ParseTerm(u)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse unknown: %s", err.Error())
+			}
+			unknowns = append(unknowns, term)
+		}
+		regoArgs = append(regoArgs, rego.ParsedUnknowns(unknowns))
 	}
 
 	regoArgs = append(regoArgs, rego.DisableInlining(params.disableInlining), rego.ShallowInlining(params.shallowInlining))
 
+	if target, ok := params.translationTarget(); ok && params.validate {
+		regoArgs = append(regoArgs, translate.Restrict(target))
+	}
+
 	var c *cover.Cover
 
 	if params.coverage {
@@ -667,6 +722,7 @@ func setupEval(args []string, params evalCommandParams) (*evalContext, error) {
 		regoArgs:         regoArgs,
 		evalArgs:         evalArgs,
 		builtInErrorList: &builtInErrors,
+		unknowns:         unknowns,
 	}
 
 	return evalCtx, nil
@@ -9,6 +9,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -19,10 +20,12 @@ import (
 	"testing"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/internal/explain"
 	"github.com/open-policy-agent/opa/internal/presentation"
 	"github.com/open-policy-agent/opa/loader"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/translate"
 	"github.com/open-policy-agent/opa/util"
 	"github.com/open-policy-agent/opa/util/test"
 )
@@ -1210,6 +1213,203 @@ func TestEvalDebugTraceJSONOutput(t *testing.T) {
 	}
 }
 
+func TestEvalRuleExplanationJSONOutput(t *testing.T) {
+	params := newEvalCommandParams()
+	err := params.outputFormat.Set(evalJSONOutput)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	err = params.explain.Set(explainModeRules)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	mod := `package x
+
+	default p := false
+
+	p {
+		input.x == 1
+	}
+
+	p {
+		input.y == 1
+	}
+	`
+
+	files := map[string]string{
+		"policy.rego": mod,
+		"input.json":  `{"x": 2}`,
+	}
+
+	var buf bytes.Buffer
+
+	test.WithTempFS(files, func(path string) {
+		params.inputPath = filepath.Join(path, "input.json")
+		err := params.dataPaths.Set(filepath.Join(path, "policy.rego"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		_, err = eval([]string{"data.x.p"}, params, &buf)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	})
+
+	var output struct {
+		RuleExplanation *explain.Explanation `json:"rule_explanation"`
+	}
+
+	if err := util.NewJSONDecoder(&buf).Decode(&output); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.RuleExplanation == nil || len(output.RuleExplanation.Rules) != 1 {
+		t.Fatalf("Expected explanation of one rule but got: %v", output.RuleExplanation)
+	}
+
+	rule := output.RuleExplanation.Rules[0]
+
+	// Both bodies are explained even though rule indexing would skip the second.
+	if rule.Name != "data.x.p" || len(rule.Bodies) != 2 || rule.Default == nil {
+		t.Fatalf("Unexpected rule explanation: %+v", rule)
+	}
+
+	failed := rule.Bodies[0].Failed
+	if failed == nil || failed.Text != "input.x == 1" || !reflect.DeepEqual(failed.Bindings, map[string]interface{}{"input.x": json.Number("2")}) {
+		t.Fatalf("Unexpected failed expression: %+v", failed)
+	}
+}
+
+func TestEvalPartialTranslation(t *testing.T) {
+
+	files := map[string]string{
+		"policy.rego": `package pets
+
+		allow {
+			input.pets.owner == input.subject
+			input.pets.age < 10
+		}
+
+		unsupported {
+			count(input.pets.name) > 3
+		}
+		`,
+		"input.json": `{"subject": "bob"}`,
+	}
+
+	tests := []struct {
+		note     string
+		format   string
+		query    string
+		validate bool
+		exp      string
+		err      string
+	}{
+		{
+			note:   "postgres",
+			format: string(translate.Postgres),
+			query:  "data.pets.allow == true",
+			exp: `{
+  "where": "pets.owner = $1 AND pets.age < $2",
+  "args": [
+    "bob",
+    10
+  ]
+}
+`,
+		},
+		{
+			note:   "elasticsearch",
+			format: string(translate.Elasticsearch),
+			query:  "data.pets.allow == true",
+			exp: `{
+  "bool": {
+    "filter": [
+      {
+        "term": {
+          "owner": "bob"
+        }
+      },
+      {
+        "range": {
+          "age": {
+            "lt": 10
+          }
+        }
+      }
+    ]
+  }
+}
+`,
+		},
+		{
+			note:   "unsupported",
+			format: string(translate.MySQL),
+			query:  "data.pets.unsupported == true",
+			err:    "policy.rego:9: rego_translation_error: comparison does not refer to a field: gt(count(input.pets.name), 3)",
+		},
+		{
+			note:     "validate",
+			format:   string(translate.SQLite),
+			query:    "data.pets.allow == true",
+			validate: true,
+			exp: `{
+  "where": "pets.owner = ? AND pets.age < ?",
+  "args": [
+    "bob",
+    10
+  ]
+}
+`,
+		},
+		{
+			note:     "validate unsupported",
+			format:   string(translate.MySQL),
+			query:    "data.pets.unsupported == true",
+			validate: true,
+			err:      "policy.rego:9: rego_translation_error: built-in function count cannot be translated: count(input.pets.name)",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			test.WithTempFS(files, func(path string) {
+				params := newEvalCommandParams()
+				params.partial = true
+				params.inputPath = filepath.Join(path, "input.json")
+				params.unknowns = []string{"input.pets"}
+				params.validate = tc.validate
+				if err := params.outputFormat.Set(tc.format); err != nil {
+					t.Fatal(err)
+				}
+				if err := params.dataPaths.Set(filepath.Join(path, "policy.rego")); err != nil {
+					t.Fatal(err)
+				}
+
+				var buf bytes.Buffer
+
+				_, err := eval([]string{tc.query}, params, &buf)
+
+				if tc.err != "" {
+					if err == nil || !strings.Contains(buf.String(), tc.err) {
+						t.Fatalf("Expected error %q but got: %v\n%v", tc.err, err, buf.String())
+					}
+					return
+				} else if err != nil {
+					t.Fatal(err)
+				}
+
+				if buf.String() != tc.exp {
+					t.Fatalf("Expected:\n\n%v\n\nGot:\n\n%v", tc.exp, buf.String())
+				}
+			})
+		})
+	}
+}
+
 func TestResetExprLocations(t *testing.T) {
 
 	// Make sure no panic if passed nil.
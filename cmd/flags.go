@@ -163,6 +163,7 @@ const (
 	explainModeNotes = "notes"
 	explainModeFails = "fails"
 	explainModeDebug = "debug"
+	explainModeRules = "rules"
 )
 
 func newExplainFlag(modes []string) *util.EnumFlag {
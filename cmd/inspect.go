@@ -29,6 +29,7 @@ const pageWidth = 80
 type inspectCommandParams struct {
 	outputFormat    *util.EnumFlag
 	listAnnotations bool
+	diff            bool
 }
 
 func newInspectCommandParams() inspectCommandParams {
@@ -69,12 +70,36 @@ Example:
 
 You can provide exactly one OPA bundle or path to the 'inspect' command on the command-line. If you provide a path
 referring to a directory, the 'inspect' command will load that path as a bundle and summarize its structure and contents.
+
+Diff
+----
+
+The --diff flag compares two bundles (e.g., two revisions of the same bundle) and lists the
+changes between them:
+
+* modules that were added, removed or modified, and for modified modules, the rules that changed
+* data paths that were added, removed or modified
+* manifest changes (revision, roots, metadata and Wasm entrypoints)
+* signature changes (key ID, scope, issuer and the signed files)
+
+Policies are compared semantically, i.e., formatting changes are not reported. Signatures are
+not verified.
+
+Example:
+
+    $ opa inspect --diff v1.tar.gz v2.tar.gz
 `,
 		PreRunE: func(_ *cobra.Command, args []string) error {
 			return validateInspectParams(&params, args)
 		},
 		Run: func(_ *cobra.Command, args []string) {
-			if err := doInspect(params, args[0], os.Stdout); err != nil {
+			var err error
+			if params.diff {
+				err = doInspectDiff(params, args[0], args[1], os.Stdout)
+			} else {
+				err = doInspect(params, args[0], os.Stdout)
+			}
+			if err != nil {
 				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
 			}
@@ -83,6 +108,7 @@ referring to a directory, the 'inspect' command will load that path as a bundle
 
 	addOutputFormat(inspectCommand.Flags(), params.outputFormat)
 	addListAnnotations(inspectCommand.Flags(), &params.listAnnotations)
+	inspectCommand.Flags().BoolVar(&params.diff, "diff", false, "list the changes between two bundles")
 	RootCommand.AddCommand(inspectCommand)
 }
 
@@ -119,8 +145,50 @@ func doInspect(params inspectCommandParams, path string, out io.Writer) error {
 	}
 }
 
+func doInspectDiff(params inspectCommandParams, oldPath, newPath string, out io.Writer) error {
+	d, err := ib.FileDiff(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	switch params.outputFormat.String() {
+	case evalJSONOutput:
+		return pr.JSON(out, d)
+
+	default:
+		if d.Empty() {
+			fmt.Fprintln(out, "No changes.")
+			return nil
+		}
+
+		if d.Manifest != nil {
+			if err := populateManifestDiff(out, d.Manifest); err != nil {
+				return err
+			}
+		}
+
+		if len(d.Modules) != 0 {
+			populateModulesDiff(out, d.Modules)
+		}
+
+		if len(d.Data) != 0 {
+			populateChanges(out, "DATA:", "path", d.Data)
+		}
+
+		if d.Signatures != nil {
+			populateSignaturesDiff(out, d.Signatures)
+		}
+
+		return nil
+	}
+}
+
 func validateInspectParams(p *inspectCommandParams, args []string) error {
-	if len(args) != 1 {
+	if p.diff {
+		if len(args) != 2 {
+			return fmt.Errorf("specify exactly two OPA bundles or paths to compare")
+		}
+	} else if len(args) != 1 {
 		return fmt.Errorf("specify exactly one OPA bundle or path")
 	}
 
@@ -170,6 +238,127 @@ func populateManifest(out io.Writer, m bundle.Manifest) error {
 	return nil
 }
 
+func populateManifestDiff(out io.Writer, m *ib.ManifestDiff) error {
+	t := generateTableWithKeys(out, "field", "old", "new")
+	var lines [][]string
+
+	if m.Revision != nil {
+		lines = append(lines, []string{"Revision", truncateTableStr(m.Revision.Old), truncateTableStr(m.Revision.New)})
+	}
+
+	lines = append(lines, setChangeLines("Roots", m.Roots)...)
+
+	if m.Metadata != nil {
+		oldMetadata, err := json.Marshal(m.Metadata.Old)
+		if err != nil {
+			return err
+		}
+		newMetadata, err := json.Marshal(m.Metadata.New)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, []string{"Metadata", truncateTableStr(string(oldMetadata)), truncateTableStr(string(newMetadata))})
+	}
+
+	lines = append(lines, setChangeLines("Wasm Entrypoints", m.WasmEntrypoints)...)
+
+	// Rows with the same field are not merged as that would hide the
+	// old and new values.
+	t.SetAutoMergeCells(false)
+	t.AppendBulk(lines)
+	if t.NumLines() > 0 {
+		fmt.Fprintln(out, "MANIFEST:")
+		t.Render()
+	}
+
+	return nil
+}
+
+func setChangeLines(field string, c *ib.SetChange) [][]string {
+	if c == nil {
+		return nil
+	}
+	var lines [][]string
+	for _, s := range c.Removed {
+		lines = append(lines, []string{field, truncateFileName(s), ""})
+	}
+	for _, s := range c.Added {
+		lines = append(lines, []string{field, "", truncateFileName(s)})
+	}
+	return lines
+}
+
+func populateModulesDiff(out io.Writer, modules []ib.ModuleDiff) {
+	t := generateTableWithKeys(out, "file", "change", "rule")
+	// only auto-merge the file column
+	t.SetAutoMergeCells(false)
+	t.SetAutoMergeCellsByColumnIndex([]int{0})
+	var lines [][]string
+
+	for _, m := range modules {
+		if len(m.Rules) == 0 {
+			lines = append(lines, []string{truncateFileName(m.Path), m.Change, ""})
+			continue
+		}
+		for _, r := range m.Rules {
+			lines = append(lines, []string{truncateFileName(m.Path), r.Change, truncateTableStr(r.Name)})
+		}
+	}
+
+	t.AppendBulk(lines)
+	if t.NumLines() > 0 {
+		fmt.Fprintln(out, "MODULES:")
+		t.Render()
+	}
+}
+
+func populateChanges(out io.Writer, title, key string, changes []ib.Change) {
+	t := generateTableWithKeys(out, key, "change")
+	t.SetAutoMergeCells(false)
+	var lines [][]string
+
+	for _, c := range changes {
+		lines = append(lines, []string{truncateFileName(c.Name), c.Change})
+	}
+
+	t.AppendBulk(lines)
+	if t.NumLines() > 0 {
+		fmt.Fprintln(out, title)
+		t.Render()
+	}
+}
+
+func populateSignaturesDiff(out io.Writer, s *ib.SignaturesDiff) {
+	t := generateTableWithKeys(out, "field", "old", "new")
+	t.SetAutoMergeCells(false)
+	var lines [][]string
+
+	for _, f := range []struct {
+		name   string
+		change *ib.StringChange
+	}{
+		{"Signed", s.Signed},
+		{"Key ID", s.KeyID},
+		{"Scope", s.Scope},
+		{"Issuer", s.Issuer},
+		{"Plugin", s.Plugin},
+	} {
+		if f.change != nil {
+			lines = append(lines, []string{f.name, truncateTableStr(f.change.Old), truncateTableStr(f.change.New)})
+		}
+	}
+
+	t.AppendBulk(lines)
+	if t.NumLines() > 0 {
+		fmt.Fprintln(out, "SIGNATURES:")
+		t.Render()
+	}
+
+	if len(s.Files) != 0 {
+		populateChanges(out, "SIGNED FILES:", "file", s.Files)
+	}
+}
+
 func populateNamespaces(out io.Writer, n map[string][]string) error {
 	t := generateTableWithKeys(out, "namespace", "file")
 	// only auto-merge the namespace column
@@ -564,3 +564,89 @@ Custom:
 
 	})
 }
+
+func TestDoInspectDiffPretty(t *testing.T) {
+
+	oldFiles := [][2]string{
+		{"/.manifest", `{"revision": "v1", "roots": ["a", "http"], "wasm": [{"entrypoint": "http/example/authz", "module": "/policy.wasm"}]}`},
+		{"/data.json", `{"a": {"b": 1, "c": [1, 2]}}`},
+		{"/a/a.rego", "package a\np = 1\nq = 2"},
+		{"/a/b.rego", "package a\nr = 1"},
+		{"/policy.wasm", `modules-compiled-as-wasm-binary`},
+	}
+
+	newFiles := [][2]string{
+		{"/.manifest", `{"revision": "v2", "roots": ["a", "http"], "wasm": [{"entrypoint": "http/example/allow", "module": "/policy.wasm"}]}`},
+		{"/data.json", `{"a": {"c": [1, 2], "d": {}}}`},
+		{"/a/a.rego", "package a\n\np = 1\n\nq = 3\n"},
+		{"/a/c.rego", "package a\ns = 1"},
+		{"/policy.wasm", `modules-compiled-as-wasm-binary`},
+	}
+
+	test.WithTempFS(nil, func(rootDir string) {
+		oldFile := filepath.Join(rootDir, "v1.tar.gz")
+		newFile := filepath.Join(rootDir, "v2.tar.gz")
+
+		if err := os.WriteFile(oldFile, archive.MustWriteTarGz(oldFiles).Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(newFile, archive.MustWriteTarGz(newFiles).Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		if err := doInspectDiff(newInspectCommandParams(), oldFile, newFile, &out); err != nil {
+			t.Fatal(err)
+		}
+
+		output := strings.TrimSpace(out.String())
+		expected := strings.TrimSpace(`
+MANIFEST:
++------------------+--------------------+--------------------+
+|      FIELD       |        OLD         |        NEW         |
++------------------+--------------------+--------------------+
+| Revision         | v1                 | v2                 |
+| Wasm Entrypoints | http/example/authz |                    |
+| Wasm Entrypoints |                    | http/example/allow |
++------------------+--------------------+--------------------+
+MODULES:
++----------+----------+----------+
+|   FILE   |  CHANGE  |   RULE   |
++----------+----------+----------+
+| a/a.rego | modified | data.a.q |
+| a/b.rego | removed  |          |
+| a/c.rego | added    |          |
++----------+----------+----------+
+DATA:
++------+---------+
+| PATH | CHANGE  |
++------+---------+
+| /a/b | removed |
+| /a/d | added   |
++------+---------+
+`)
+
+		if output != expected {
+			t.Fatalf("Unexpected output. Expected:\n\n%v\n\nGot:\n\n%v", expected, output)
+		}
+
+		out.Reset()
+		if err := doInspectDiff(newInspectCommandParams(), newFile, newFile, &out); err != nil {
+			t.Fatal(err)
+		}
+
+		if output := strings.TrimSpace(out.String()); output != "No changes." {
+			t.Fatalf("Unexpected output: %v", output)
+		}
+	})
+}
+
+func TestInspectDiffArgsError(t *testing.T) {
+	params := newInspectCommandParams()
+	params.diff = true
+	err := validateInspectParams(&params, []string{"a.tar.gz"})
+	if err == nil || err.Error() != "specify exactly two OPA bundles or paths to compare" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
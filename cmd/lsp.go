@@ -0,0 +1,73 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	internal_logging "github.com/open-policy-agent/opa/internal/logging"
+	"github.com/open-policy-agent/opa/internal/lsp"
+	"github.com/open-policy-agent/opa/logging"
+	"github.com/open-policy-agent/opa/util"
+)
+
+type lspCommandParams struct {
+	logLevel *util.EnumFlag
+}
+
+func init() {
+
+	var params lspCommandParams
+
+	params.logLevel = util.NewEnumFlag("error", []string{"debug", "info", "error"})
+
+	lspCommand := &cobra.Command{
+		Use:   "lsp",
+		Short: "Start a Rego language server",
+		Long: `Start a Rego language server.
+
+The 'lsp' command starts a server speaking the Language Server Protocol over
+stdin and stdout. Editors can use it to provide Rego support. The server loads
+all .rego files in the workspace folders provided by the editor and keeps them
+compiled as files change. It supports:
+
+	- diagnostics for parse, compile and type errors
+	- go to definition
+	- hover information for rules and built-in functions
+	- formatting (equivalent to 'opa fmt')
+	- renaming packages and their references
+
+Logs are written to stderr.
+`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runLSP(params); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	lspCommand.Flags().VarP(params.logLevel, "log-level", "l", "set log level")
+	RootCommand.AddCommand(lspCommand)
+}
+
+func runLSP(params lspCommandParams) error {
+
+	lvl, err := internal_logging.GetLevel(params.logLevel.String())
+	if err != nil {
+		return err
+	}
+
+	logger := logging.New()
+	logger.SetLevel(lvl)
+	logger.SetOutput(os.Stderr)
+
+	return lsp.New().WithLogger(logger).Serve(context.Background(), os.Stdin, os.Stdout)
+}
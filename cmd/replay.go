@@ -0,0 +1,231 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	pr "github.com/open-policy-agent/opa/internal/presentation"
+	initload "github.com/open-policy-agent/opa/internal/runtime/init"
+	"github.com/open-policy-agent/opa/replay"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/util"
+)
+
+type replayCommandParams struct {
+	bundlePaths  repeatedStringFlag
+	outputFormat *util.EnumFlag
+	fail         bool
+}
+
+func newReplayCommandParams() replayCommandParams {
+	return replayCommandParams{
+		outputFormat: util.NewEnumFlag(evalPrettyOutput, []string{
+			evalJSONOutput,
+			evalPrettyOutput,
+		}),
+	}
+}
+
+// errReplayChanged is returned if decisions changed and --fail was set.
+var errReplayChanged = errors.New("decisions changed")
+
+func init() {
+
+	params := newReplayCommandParams()
+
+	var replayCommand = &cobra.Command{
+		Use:   "replay --bundle <path> <decision log> [<decision log> [...]]",
+		Short: "Replay recorded decisions against a candidate bundle",
+		Long: `Replay recorded decisions against a candidate bundle.
+
+The 'replay' command reads decision log events, evaluates the path and input of each
+event against the candidate bundle(s) and compares the result with the recorded result.
+The changed decisions are reported grouped by path.
+
+Decision logs are read from files containing one event per line (NDJSON), as produced by
+the console decision logger, or JSON arrays of events, as uploaded to decision log
+services. Use '-' to read from stdin.
+
+Example:
+
+    $ opa replay --bundle bundle.tar.gz decisions.ndjson
+
+The values of non-deterministic built-in functions such as time.now_ns and http.send are
+replayed from the nd_builtin_cache of the events, if present. Enable the nd_builtin_cache
+decision logs option to record them.
+
+Decisions for ad-hoc queries and decisions whose input was erased or masked cannot be
+replayed and are reported as skipped.
+
+The --fail flag makes the command exit with status 1 if any decision changed. Errors
+exit with status 2.
+`,
+		PreRunE: func(_ *cobra.Command, args []string) error {
+			return validateReplayParams(&params, args)
+		},
+		Run: func(_ *cobra.Command, args []string) {
+			if err := doReplay(context.Background(), params, args, os.Stdout); err != nil {
+				if err == errReplayChanged {
+					os.Exit(1)
+				}
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(2)
+			}
+		},
+	}
+
+	addBundleFlag(replayCommand.Flags(), &params.bundlePaths)
+	addOutputFormat(replayCommand.Flags(), params.outputFormat)
+	replayCommand.Flags().BoolVar(&params.fail, "fail", false, "exits with non-zero exit code if any decision changed")
+	RootCommand.AddCommand(replayCommand)
+}
+
+func validateReplayParams(p *replayCommandParams, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("specify at least one decision log file")
+	}
+	if len(p.bundlePaths.v) == 0 {
+		return fmt.Errorf("specify the candidate bundle with --bundle")
+	}
+	of := p.outputFormat.String()
+	if of == evalJSONOutput || of == evalPrettyOutput {
+		return nil
+	}
+	return fmt.Errorf("invalid output format for replay command")
+}
+
+func doReplay(ctx context.Context, params replayCommandParams, args []string, out io.Writer) error {
+
+	loaded, err := initload.LoadPaths(params.bundlePaths.v, nil, true, nil, true, false, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	store := inmem.New()
+	txn, err := store.NewTransaction(ctx, storage.WriteParams)
+	if err != nil {
+		return err
+	}
+
+	result, err := initload.InsertAndCompile(ctx, initload.InsertAndCompileOptions{
+		Store:   store,
+		Txn:     txn,
+		Files:   loaded.Files,
+		Bundles: loaded.Bundles,
+	})
+	if err != nil {
+		store.Abort(ctx, txn)
+		return err
+	}
+
+	if err := store.Commit(ctx, txn); err != nil {
+		return err
+	}
+
+	r := replay.NewReplayer().SetCompiler(result.Compiler).SetStore(store)
+
+	for _, path := range args {
+		if err := replayFile(ctx, r, path); err != nil {
+			return err
+		}
+	}
+
+	report := r.Report()
+
+	switch params.outputFormat.String() {
+	case evalJSONOutput:
+		err = pr.JSON(out, report)
+	default:
+		err = printReplayReport(out, report)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if params.fail && report.Changed > 0 {
+		return errReplayChanged
+	}
+
+	return nil
+}
+
+func replayFile(ctx context.Context, r *replay.Replayer, path string) error {
+
+	if path == "-" {
+		return r.ReplayReader(ctx, os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := r.ReplayReader(ctx, f); err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+
+	return nil
+}
+
+func printReplayReport(out io.Writer, report replay.Report) error {
+
+	fmt.Fprintln(out, "DECISIONS:")
+	t := generateTableWithKeys(out, "path", "total", "changed", "skipped")
+	for _, p := range report.Paths {
+		t.Append([]string{replayPath(p.Path), strconv.Itoa(p.Total), strconv.Itoa(p.Changed), strconv.Itoa(p.Skipped)})
+	}
+	if t.NumLines() > 0 {
+		t.Render()
+	}
+
+	fmt.Fprintf(out, "%d decisions, %d changed, %d skipped\n", report.Total, report.Changed, report.Skipped)
+
+	for _, p := range report.Paths {
+		for _, d := range p.Decisions {
+			fmt.Fprintln(out)
+			fmt.Fprintf(out, "CHANGED: %v (decision %v)\n", replayPath(d.Path), d.DecisionID)
+			switch {
+			case d.RecordedError != "" || d.CandidateError != "":
+				fmt.Fprintf(out, "  recorded:  %v\n", replayValue(d.Recorded, d.RecordedError))
+				fmt.Fprintf(out, "  candidate: %v\n", replayValue(d.Candidate, d.CandidateError))
+			default:
+				for _, vd := range d.Diff {
+					fmt.Fprintf(out, "  %v: %v => %v\n", vd.Path, replayValue(vd.Recorded, ""), replayValue(vd.Candidate, ""))
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func replayPath(path string) string {
+	if path == "" {
+		return "<query>"
+	}
+	return path
+}
+
+func replayValue(v *interface{}, errMsg string) string {
+	switch {
+	case errMsg != "":
+		return "error: " + errMsg
+	case v == nil:
+		return "undefined"
+	default:
+		return string(util.MustMarshalJSON(*v))
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-policy-agent/opa/util"
+	"github.com/open-policy-agent/opa/util/test"
+)
+
+func TestDoReplay(t *testing.T) {
+
+	files := map[string]string{
+		"bundle/authz/policy.rego": `package authz
+
+		default allow = false
+
+		allow {
+			input.user == data.authz.admins[_]
+		}`,
+		"bundle/authz/data.json": `{"admins": ["alice"]}`,
+		"decisions.ndjson": `{"decision_id": "1", "path": "authz/allow", "input": {"user": "alice"}, "result": true}
+{"decision_id": "2", "path": "authz/allow", "input": {"user": "bob"}, "result": true}
+{"decision_id": "3", "query": "data.authz.allow", "input": {"user": "bob"}, "result": true}
+`,
+	}
+
+	test.WithTempFS(files, func(rootDir string) {
+
+		params := newReplayCommandParams()
+		params.bundlePaths = newrepeatedStringFlag([]string{filepath.Join(rootDir, "bundle")})
+		args := []string{filepath.Join(rootDir, "decisions.ndjson")}
+
+		var buf bytes.Buffer
+		if err := doReplay(context.Background(), params, args, &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		exp := `DECISIONS:
++-------------+-------+---------+---------+
+|    PATH     | TOTAL | CHANGED | SKIPPED |
++-------------+-------+---------+---------+
+| <query>     | 1     | 0       | 1       |
+| authz/allow | 2     | 1       | 0       |
++-------------+-------+---------+---------+
+3 decisions, 1 changed, 1 skipped
+
+CHANGED: authz/allow (decision 2)
+  /: true => false
+`
+
+		if buf.String() != exp {
+			t.Fatalf("expected output:\n\n%v\n\ngot:\n\n%v", exp, buf.String())
+		}
+
+		buf.Reset()
+		params.fail = true
+		_ = params.outputFormat.Set(evalJSONOutput)
+
+		if err := doReplay(context.Background(), params, args, &buf); err != errReplayChanged {
+			t.Fatalf("expected %v but got: %v", errReplayChanged, err)
+		}
+
+		var report struct {
+			Total   int `json:"total"`
+			Changed int `json:"changed"`
+			Skipped int `json:"skipped"`
+		}
+		if err := util.UnmarshalJSON(buf.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+
+		if report.Total != 3 || report.Changed != 1 || report.Skipped != 1 {
+			t.Fatalf("unexpected report: %v", buf.String())
+		}
+	})
+}
+
+func TestReplayParamsErrors(t *testing.T) {
+
+	params := newReplayCommandParams()
+	if err := validateReplayParams(&params, []string{"decisions.ndjson"}); err == nil || err.Error() != "specify the candidate bundle with --bundle" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params.bundlePaths = newrepeatedStringFlag([]string{"bundle"})
+	if err := validateReplayParams(&params, nil); err == nil || err.Error() != "specify at least one decision log file" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
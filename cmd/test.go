@@ -36,6 +36,11 @@ import (
 const (
 	testPrettyOutput = "pretty"
 	testJSONOutput   = "json"
+	testJUnitOutput  = "junit"
+	testTAPOutput    = "tap"
+
+	testLCOVOutput      = "lcov"
+	testCoberturaOutput = "cobertura"
 )
 
 type testCommandParams struct {
@@ -57,6 +62,7 @@ type testCommandParams struct {
 	capabilities *capabilitiesFlag
 	schema       *schemaFlags
 	watch        bool
+	mutate       bool
 	stopChan     chan os.Signal
 	output       io.Writer
 	errOutput    io.Writer
@@ -64,7 +70,7 @@ type testCommandParams struct {
 
 func newTestCommandParams() testCommandParams {
 	return testCommandParams{
-		outputFormat: util.NewEnumFlag(testPrettyOutput, []string{testPrettyOutput, testJSONOutput, benchmarkGoBenchOutput}),
+		outputFormat: util.NewEnumFlag(testPrettyOutput, []string{testPrettyOutput, testJSONOutput, testJUnitOutput, testTAPOutput, benchmarkGoBenchOutput, testLCOVOutput, testCoberturaOutput}),
 		explain:      newExplainFlag([]string{explainModeFails, explainModeFull, explainModeNotes, explainModeDebug}),
 		target:       util.NewEnumFlag(compile.TargetRego, []string{compile.TargetRego, compile.TargetWasm}),
 		capabilities: newcapabilitiesFlag(),
@@ -87,6 +93,19 @@ func opaTest(args []string, testParams testCommandParams) (int, error) {
 		return 0, fmt.Errorf(errMsg, benchmarkGoBenchOutput)
 	}
 
+	if format := testParams.outputFormat.String(); (format == testLCOVOutput || format == testCoberturaOutput) && !testParams.coverage {
+		errMsg := "cannot use output format %s without reporting coverage (--coverage)\n"
+		fmt.Fprintf(testParams.errOutput, errMsg, format)
+		return 0, fmt.Errorf(errMsg, format)
+	}
+
+	if testParams.mutate {
+		if err := validateMutateParams(testParams); err != nil {
+			fmt.Fprintln(testParams.errOutput, err)
+			return 1, err
+		}
+	}
+
 	if !isThresholdValid(testParams.threshold) {
 		fmt.Fprintln(testParams.errOutput, "Code coverage threshold must be between 0 and 100")
 		return 1, err
@@ -125,6 +144,11 @@ func opaTest(args []string, testParams testCommandParams) (int, error) {
 		return 1, err
 	}
 
+	if testParams.mutate {
+		defer store.Abort(ctx, txn)
+		return runMutations(ctx, txn, runner, testParams, store)
+	}
+
 	success := true
 	for i := 0; i < testParams.count; i++ {
 		exitCode, err := runTests(ctx, txn, runner, reporter, testParams)
@@ -204,6 +228,70 @@ func runTests(ctx context.Context, txn storage.Transaction, runner *tester.Runne
 	return exitCode, err
 }
 
+func validateMutateParams(testParams testCommandParams) error {
+	switch {
+	case testParams.bundleMode:
+		return fmt.Errorf("mutation testing is not supported for bundles (--bundle)")
+	case testParams.benchmark:
+		return fmt.Errorf("mutation testing is not supported when benchmarking tests (--bench)")
+	case testParams.coverage || testParams.threshold > 0:
+		return fmt.Errorf("coverage reporting is not supported with mutation testing (--mutate)")
+	case testParams.watch:
+		return fmt.Errorf("mutation testing is not supported when watching for changes (--watch)")
+	}
+	if format := testParams.outputFormat.String(); format != testPrettyOutput && format != testJSONOutput {
+		return fmt.Errorf("cannot use output format %s with mutation testing (--mutate)", format)
+	}
+	return nil
+}
+
+func runMutations(ctx context.Context, txn storage.Transaction, runner *tester.Runner, testParams testCommandParams, store storage.Store) (int, error) {
+
+	newCompiler, err := testCompilerFactory(ctx, testParams, store, txn)
+	if err != nil {
+		fmt.Fprintln(testParams.errOutput, err)
+		return 1, err
+	}
+
+	ch, err := runner.RunMutations(ctx, txn, tester.MutationOptions{NewCompiler: newCompiler})
+	if err != nil {
+		fmt.Fprintln(testParams.errOutput, err)
+		return 1, err
+	}
+
+	var reporter tester.MutationReporter
+	if testParams.outputFormat.String() == testJSONOutput {
+		reporter = tester.JSONMutationReporter{
+			Output: testParams.output,
+		}
+	} else {
+		reporter = tester.PrettyMutationReporter{
+			Output:  testParams.output,
+			Verbose: testParams.verbose,
+		}
+	}
+
+	exitCode := 0
+	dup := make(chan *tester.MutationResult)
+
+	go func() {
+		defer close(dup)
+		for mr := range ch {
+			if mr.Status == tester.MutantSurvived {
+				exitCode = 2
+			}
+			dup <- mr
+		}
+	}()
+
+	if err := reporter.Report(dup); err != nil {
+		fmt.Fprintln(testParams.errOutput, err)
+		return 1, err
+	}
+
+	return exitCode, nil
+}
+
 func filterTrace(params *testCommandParams, trace []*topdown.Event) []*topdown.Event {
 	// If an explain mode was specified, filter based
 	// on the mode. If no explain mode was specified,
@@ -273,7 +361,7 @@ func processWatcherUpdate(ctx context.Context, testParams testCommandParams, pat
 
 	var loadResult *initload.LoadPathsResult
 
-	err := pathwatcher.ProcessWatcherUpdate(ctx, paths, removed, store, filter.Apply, testParams.bundleMode,
+	err := pathwatcher.ProcessWatcherUpdate(ctx, paths, removed, store, tester.ExcludeFixtureFiles(filter.Apply), testParams.bundleMode,
 		func(ctx context.Context, txn storage.Transaction, loaded *initload.LoadPathsResult) error {
 			if len(loaded.Files.Documents) > 0 || removed != "" {
 				if err := store.Write(ctx, txn, storage.AddOp, storage.Path{}, loaded.Files.Documents); err != nil {
@@ -316,7 +404,9 @@ func processWatcherUpdate(ctx context.Context, testParams testCommandParams, pat
 	}
 }
 
-func compileAndSetupTests(ctx context.Context, testParams testCommandParams, store storage.Store, txn storage.Transaction, modules map[string]*ast.Module, bundles map[string]*bundle.Bundle) (*tester.Runner, tester.Reporter, error) {
+// testCompilerFactory returns a function that creates the compilers used to
+// compile the modules under test.
+func testCompilerFactory(ctx context.Context, testParams testCommandParams, store storage.Store, txn storage.Transaction) (func() *ast.Compiler, error) {
 
 	var capabilities *ast.Capabilities
 	// if capabilities are not provided as a cmd flag,
@@ -331,18 +421,28 @@ func compileAndSetupTests(ctx context.Context, testParams testCommandParams, sto
 	//	-s {file} (one input schema file)
 	//	-s {directory} (one schema directory with input and data schema files)
 	schemaSet, err := loader.Schemas(testParams.schema.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() *ast.Compiler {
+		return ast.NewCompiler().
+			SetErrorLimit(testParams.errLimit).
+			WithPathConflictsCheck(storage.NonEmpty(ctx, store, txn)).
+			WithEnablePrintStatements(!testParams.benchmark).
+			WithCapabilities(capabilities).
+			WithSchemas(schemaSet).
+			WithUseTypeCheckAnnotations(true)
+	}, nil
+}
+
+func compileAndSetupTests(ctx context.Context, testParams testCommandParams, store storage.Store, txn storage.Transaction, modules map[string]*ast.Module, bundles map[string]*bundle.Bundle) (*tester.Runner, tester.Reporter, error) {
+
+	newCompiler, err := testCompilerFactory(ctx, testParams, store, txn)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	compiler := ast.NewCompiler().
-		SetErrorLimit(testParams.errLimit).
-		WithPathConflictsCheck(storage.NonEmpty(ctx, store, txn)).
-		WithEnablePrintStatements(!testParams.benchmark).
-		WithCapabilities(capabilities).
-		WithSchemas(schemaSet).
-		WithUseTypeCheckAnnotations(true)
-
 	info, err := runtime.Term(runtime.Params{})
 	if err != nil {
 		return nil, nil, err
@@ -374,7 +474,7 @@ func compileAndSetupTests(ctx context.Context, testParams testCommandParams, sto
 	}
 
 	runner := tester.NewRunner().
-		SetCompiler(compiler).
+		SetCompiler(newCompiler()).
 		SetStore(store).
 		CapturePrintOutput(true).
 		EnableTracing(testParams.verbose).
@@ -396,6 +496,14 @@ func compileAndSetupTests(ctx context.Context, testParams testCommandParams, sto
 			reporter = tester.JSONReporter{
 				Output: testParams.output,
 			}
+		case testJUnitOutput:
+			reporter = tester.JUnitReporter{
+				Output: testParams.output,
+			}
+		case testTAPOutput:
+			reporter = tester.TAPReporter{
+				Output: testParams.output,
+			}
 		case benchmarkGoBenchOutput:
 			goBench = true
 			fallthrough
@@ -409,11 +517,28 @@ func compileAndSetupTests(ctx context.Context, testParams testCommandParams, sto
 			}
 		}
 	} else {
-		reporter = tester.JSONCoverageReporter{
-			Cover:     cov,
-			Modules:   modules,
-			Output:    testParams.output,
-			Threshold: testParams.threshold,
+		switch testParams.outputFormat.String() {
+		case testLCOVOutput:
+			reporter = tester.LCOVCoverageReporter{
+				Cover:     cov,
+				Modules:   modules,
+				Output:    testParams.output,
+				Threshold: testParams.threshold,
+			}
+		case testCoberturaOutput:
+			reporter = tester.CoberturaCoverageReporter{
+				Cover:     cov,
+				Modules:   modules,
+				Output:    testParams.output,
+				Threshold: testParams.threshold,
+			}
+		default:
+			reporter = tester.JSONCoverageReporter{
+				Cover:     cov,
+				Modules:   modules,
+				Output:    testParams.output,
+				Threshold: testParams.threshold,
+			}
 		}
 	}
 
@@ -493,6 +618,14 @@ Example benchmark run:
 
 The optional "gobench" output format conforms to the Go Benchmark Data Format.
 
+If used with the '--mutate' option then the tests are run against mutants of the
+policies, e.g., policies with comparisons flipped or expressions removed. Mutants
+that no test detects are reported along with their locations.
+
+Example mutation testing run:
+
+	$ opa test --mutate ./example/
+
 The --watch flag can be used to monitor policy and data file-system changes. When a change is detected, OPA reloads
 the policy and data and then re-runs the tests. Watching individual files (rather than directories) is generally not
 recommended as some updates might cause them to be dropped by OPA.
@@ -526,6 +659,7 @@ recommended as some updates might cause them to be dropped by OPA.
 	testCommand.Flags().BoolVar(&testParams.benchmark, "bench", false, "benchmark the unit tests")
 	testCommand.Flags().StringVarP(&testParams.runRegex, "run", "r", "", "run only test cases matching the regular expression.")
 	testCommand.Flags().BoolVarP(&testParams.watch, "watch", "w", false, "watch command line files for changes")
+	testCommand.Flags().BoolVar(&testParams.mutate, "mutate", false, "run the tests against mutated policies and report mutants that survive")
 
 	// Shared flags
 	addBundleModeFlag(testCommand.Flags(), &testParams.bundleMode, false)
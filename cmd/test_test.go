@@ -774,3 +774,72 @@ func (w *blockingWriter) Reset() {
 	defer w.m.Unlock()
 	w.buf.Reset()
 }
+
+func TestMutate(t *testing.T) {
+
+	files := map[string]string{
+		"policy.rego": `package authz
+
+default allow := false
+
+allow {
+	input.user == "admin"
+}
+`,
+		"policy_test.rego": `package authz
+
+test_admin {
+	allow with input as {"user": "admin"}
+}
+`,
+	}
+
+	test.WithTempFS(files, func(root string) {
+		var buf bytes.Buffer
+
+		testParams := newTestCommandParams()
+		testParams.mutate = true
+		testParams.count = 1
+		testParams.output = &buf
+		testParams.errOutput = io.Discard
+
+		exitCode, err := opaTest([]string{root}, testParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if exitCode != 2 {
+			t.Fatalf("expected exit code 2 for surviving mutants but got %d", exitCode)
+		}
+
+		policy := filepath.Join(root, "policy.rego")
+		exp := `SURVIVED MUTANTS
+--------------------------------------------------------------------------------
+` + policy + `:3: swap-default: replaced default value false with true
+  false
+` + policy + `:6: drop-expression: removed expression
+  input.user == "admin"
+--------------------------------------------------------------------------------
+KILLED: 3/5
+SURVIVED: 2/5
+MUTATION SCORE: 60.00%
+`
+
+		if buf.String() != exp {
+			t.Fatalf("expected:\n\n%v\n\ngot:\n\n%v", exp, buf.String())
+		}
+	})
+}
+
+func TestMutateInvalidParams(t *testing.T) {
+
+	testParams := newTestCommandParams()
+	testParams.mutate = true
+	testParams.coverage = true
+	testParams.errOutput = io.Discard
+
+	exitCode, err := opaTest([]string{"."}, testParams)
+	if exitCode != 1 || err == nil || !strings.Contains(err.Error(), "coverage reporting is not supported with mutation testing") {
+		t.Fatalf("expected error but got exit code %d and %v", exitCode, err)
+	}
+}
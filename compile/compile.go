@@ -20,6 +20,7 @@ import (
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/internal/compiler/golang"
 	"github.com/open-policy-agent/opa/internal/compiler/wasm"
 	"github.com/open-policy-agent/opa/internal/debug"
 	"github.com/open-policy-agent/opa/internal/planner"
@@ -46,6 +47,12 @@ const (
 	// TargetPlan is an altertive target that compiles the policy into an
 	// imperative query plan that can be further transpiled or interpreted.
 	TargetPlan = "plan"
+
+	// TargetGo is an alternative target that compiles the policy into the
+	// source code of a Go package. The package evaluates the entrypoints with
+	// the runtime in sdk/golang. The target supports base documents, which are
+	// embedded into the generated code.
+	TargetGo = "go"
 )
 
 // Targets contains the list of targets supported by the compiler.
@@ -53,6 +60,7 @@ var Targets = []string{
 	TargetRego,
 	TargetWasm,
 	TargetPlan,
+	TargetGo,
 }
 
 const resultVar = ast.Var("result")
@@ -81,7 +89,10 @@ type Compiler struct {
 	keyID                        string                     // represents the name of the default key used to verify a signed bundle
 	metadata                     *map[string]interface{}    // represents additional data included in .manifest file
 	fsys                         fs.FS                      // file system to use when loading paths
+	deltaFrom                    *bundle.Bundle             // the bundle to compute a delta bundle against
 	ns                           string
+	goPackage                    string // package name of the generated Go source code
+	goSource                     []byte // generated Go source code when the go target is enabled
 }
 
 // New returns a new compiler instance that can be invoked.
@@ -91,6 +102,7 @@ func New() *Compiler {
 		optimizationLevel: 0,
 		target:            TargetRego,
 		debug:             debug.Discard(),
+		goPackage:         "policy",
 	}
 }
 
@@ -229,12 +241,26 @@ func (c *Compiler) WithFS(fsys fs.FS) *Compiler {
 	return c
 }
 
+// WithDeltaFrom configures the compiler to output a delta bundle that contains
+// the data changes from the given snapshot bundle instead of a snapshot bundle.
+func (c *Compiler) WithDeltaFrom(b *bundle.Bundle) *Compiler {
+	c.deltaFrom = b
+	return c
+}
+
 // WithPartialNamespace sets the namespace to use for partial evaluation results
 func (c *Compiler) WithPartialNamespace(ns string) *Compiler {
 	c.ns = ns
 	return c
 }
 
+// WithGoPackage sets the package name of the Go source code generated for the
+// go target. Defaults to "policy".
+func (c *Compiler) WithGoPackage(name string) *Compiler {
+	c.goPackage = name
+	return c
+}
+
 func addEntrypointsFromAnnotations(c *Compiler, ar []*ast.AnnotationsRef) error {
 	for _, ref := range ar {
 		var entrypoint ast.Ref
@@ -337,6 +363,19 @@ func (c *Compiler) Build(ctx context.Context) error {
 			URL:  bundle.PlanFile,
 			Raw:  bs,
 		})
+	case TargetGo:
+		if err := c.compileGo(ctx); err != nil {
+			return err
+		}
+
+		// The output of the go target is the generated source code, not a
+		// bundle.
+		if c.output == nil {
+			return nil
+		}
+
+		_, err := (*c.output).Write(c.goSource)
+		return err
 	case TargetRego:
 		// nop
 	}
@@ -353,6 +392,19 @@ func (c *Compiler) Build(ctx context.Context) error {
 		return err
 	}
 
+	if c.deltaFrom != nil {
+		delta, err := bundle.Diff(*c.deltaFrom, *c.bundle)
+		if err != nil {
+			return err
+		}
+
+		if len(delta.Patch.Data) == 0 {
+			return fmt.Errorf("delta bundle would be empty: no data changes since the previous bundle")
+		}
+
+		c.bundle = &delta
+	}
+
 	if c.bsc != nil {
 		if err := c.bundle.GenerateSignature(c.bsc, c.keyID, false); err != nil {
 			return err
@@ -416,6 +468,11 @@ func (c *Compiler) Bundle() *bundle.Bundle {
 	return c.bundle
 }
 
+// GoSource returns the Go source code generated for the go target.
+func (c *Compiler) GoSource() []byte {
+	return c.goSource
+}
+
 func (c *Compiler) initBundle() error {
 	// If the bundle is already set, skip file loading.
 	if c.bundle != nil {
@@ -683,6 +740,36 @@ func (c *Compiler) compileWasm(ctx context.Context) error {
 	return pruneBundleEntrypoints(c.bundle, c.entrypointrefs)
 }
 
+func (c *Compiler) compileGo(ctx context.Context) error {
+
+	if err := c.compilePlan(ctx); err != nil {
+		return err
+	}
+
+	var data []byte
+
+	if len(c.bundle.Data) > 0 {
+		var err error
+		data, err = json.Marshal(c.bundle.Data)
+		if err != nil {
+			return err
+		}
+	}
+
+	src, err := golang.New().
+		WithPolicy(c.policy).
+		WithPackage(c.goPackage).
+		WithData(data).
+		Compile()
+	if err != nil {
+		return err
+	}
+
+	c.goSource = src
+
+	return nil
+}
+
 func (c *Compiler) isPackage(term *ast.Term) bool {
 	for _, m := range c.compiler.Modules {
 		if m.Package.Path.Equal(term.Value) {
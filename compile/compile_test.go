@@ -1061,6 +1061,73 @@ func TestCompilerPlanTargetUnmatchedEntrypoints(t *testing.T) {
 	}
 }
 
+func TestCompilerGoTarget(t *testing.T) {
+	files := map[string]string{
+		"test.rego": `package test
+
+		p = 7
+		q = p+1`,
+		"data.json": `{"roles": ["admin"]}`,
+	}
+
+	for _, useMemoryFS := range []bool{false, true} {
+		test.WithTestFS(files, useMemoryFS, func(root string, fsys fs.FS) {
+
+			var buf bytes.Buffer
+
+			compiler := New().
+				WithFS(fsys).
+				WithPaths(root).
+				WithTarget("go").
+				WithGoPackage("authz").
+				WithEntrypoints("test/p", "test/q").
+				WithOutput(&buf)
+			err := compiler.Build(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), compiler.GoSource()) {
+				t.Fatal("expected generated source code to be written to output")
+			}
+
+			src := string(compiler.GoSource())
+
+			for _, exp := range []string{
+				"package authz\n",
+				`{Name: "test/p", Eval: plan0}`,
+				`{Name: "test/q", Eval: plan1}`,
+				`"{\"roles\":[\"admin\"]}"`,
+			} {
+				if !strings.Contains(src, exp) {
+					t.Fatalf("expected generated source code to contain %q, got:\n%s", exp, src)
+				}
+			}
+		})
+	}
+}
+
+func TestCompilerGoTargetInvalidPackage(t *testing.T) {
+	files := map[string]string{
+		"test.rego": `package test
+
+		p = 7`,
+	}
+
+	test.WithTestFS(files, false, func(root string, fsys fs.FS) {
+		compiler := New().
+			WithFS(fsys).
+			WithPaths(root).
+			WithTarget("go").
+			WithGoPackage("not-valid").
+			WithEntrypoints("test/p")
+		err := compiler.Build(context.Background())
+		if err == nil || err.Error() != `invalid package name: "not-valid"` {
+			t.Fatalf("expected invalid package name error, got: %v", err)
+		}
+	})
+}
+
 func TestCompilerRegoEntrypointAnnotations(t *testing.T) {
 	tests := []struct {
 		note            string
@@ -39,9 +39,11 @@ type Config struct {
 	DistributedTracing           json.RawMessage            `json:"distributed_tracing,omitempty"`
 	Server                       *struct {
 		Encoding json.RawMessage `json:"encoding,omitempty"`
+		Shadow   json.RawMessage `json:"shadow,omitempty"`
 	} `json:"server,omitempty"`
 	Storage *struct {
-		Disk json.RawMessage `json:"disk,omitempty"`
+		Disk  json.RawMessage `json:"disk,omitempty"`
+		Inmem json.RawMessage `json:"inmem,omitempty"`
 	} `json:"storage,omitempty"`
 	Extra map[string]json.RawMessage `json:"-"`
 }
@@ -16,13 +16,23 @@ import (
 
 // Cover computes and reports on coverage.
 type Cover struct {
-	hits map[string]map[Position]struct{}
+	hits  map[string]map[Position]struct{}
+	exprs map[*ast.Expr]*exprStats
+}
+
+// exprStats counts the evaluations of an expression. Every evaluation either
+// fails or succeeds at least once, so the expression was true at least once if
+// it was evaluated more often than it failed.
+type exprStats struct {
+	evals int
+	fails int
 }
 
 // New returns a new Cover object.
 func New() *Cover {
 	return &Cover{
-		hits: map[string]map[Position]struct{}{},
+		hits:  map[string]map[Position]struct{}{},
+		exprs: map[*ast.Expr]*exprStats{},
 	}
 }
 
@@ -54,6 +64,7 @@ func (c *Cover) Report(modules map[string]*ast.Module) (report Report) {
 		}
 		fr.Covered = sortedPositionSliceToRangeSlice(covered)
 	}
+	exprs := c.exprReports()
 	for file, module := range modules {
 		notCovered := PositionSlice{}
 		ast.WalkRules(module, func(x *ast.Rule) bool {
@@ -79,6 +90,7 @@ func (c *Cover) Report(modules map[string]*ast.Module) (report Report) {
 			report.Files[file] = fr
 		}
 		fr.NotCovered = sortedPositionSliceToRangeSlice(notCovered)
+		fr.Bodies = bodyReports(module, exprs)
 	}
 
 	var coveredLoc, notCoveredLoc int
@@ -119,10 +131,84 @@ func (c *Cover) TraceEvent(event topdown.Event) {
 	case topdown.EvalOp:
 		if expr := event.Node.(*ast.Expr); expr != nil {
 			c.setHit(expr.Location)
+			c.stats(expr).evals++
+		}
+	case topdown.FailOp:
+		if expr, ok := event.Node.(*ast.Expr); ok {
+			c.stats(expr).fails++
 		}
 	}
 }
 
+func (c *Cover) stats(expr *ast.Expr) *exprStats {
+	stats, ok := c.exprs[expr]
+	if !ok {
+		stats = &exprStats{}
+		c.exprs[expr] = stats
+	}
+	return stats
+}
+
+type exprKey struct {
+	file     string
+	row, col int
+}
+
+// exprReports returns the coverage of the evaluated expressions by location.
+// Expressions are reported by location because the compiler copies and
+// rewrites modules, e.g., a single expression may be evaluated as several
+// expressions that share its location. An expression was true at least once if
+// all of them were.
+func (c *Cover) exprReports() map[exprKey]*ExprReport {
+
+	exprs := map[exprKey]*ExprReport{}
+	for expr, stats := range c.exprs {
+		if !hasFileLocation(expr.Location) || stats.evals == 0 {
+			continue
+		}
+		key := exprKey{expr.Location.File, expr.Location.Row, expr.Location.Col}
+		er, ok := exprs[key]
+		if !ok {
+			er = &ExprReport{Reached: true, Satisfied: true}
+			exprs[key] = er
+		}
+		er.Satisfied = er.Satisfied && stats.evals > stats.fails
+	}
+
+	return exprs
+}
+
+// bodyReports returns the expression coverage of the rule bodies in module.
+func bodyReports(module *ast.Module, exprs map[exprKey]*ExprReport) []BodyReport {
+
+	var result []BodyReport
+
+	ast.WalkRules(module, func(x *ast.Rule) bool {
+		if !hasFileLocation(x.Location) {
+			return false
+		}
+		br := BodyReport{Row: x.Location.Row}
+		ast.WalkExprs(x.Body, func(expr *ast.Expr) bool {
+			if includeExprInCoverage(expr) {
+				er := ExprReport{
+					Row:  expr.Location.Row,
+					Col:  expr.Location.Col,
+					Text: string(expr.Location.Text),
+				}
+				if hit, ok := exprs[exprKey{expr.Location.File, expr.Location.Row, expr.Location.Col}]; ok {
+					er.Reached, er.Satisfied = hit.Reached, hit.Satisfied
+				}
+				br.Expressions = append(br.Expressions, er)
+			}
+			return false
+		})
+		result = append(result, br)
+		return false
+	})
+
+	return result
+}
+
 func (c *Cover) setHit(loc *ast.Location) {
 	if hasFileLocation(loc) {
 		hits, ok := c.hits[loc.File]
@@ -162,11 +248,30 @@ func (r Range) In(row int) bool {
 
 // FileReport represents a coverage report for a single file.
 type FileReport struct {
-	Covered         []Range `json:"covered,omitempty"`
-	NotCovered      []Range `json:"not_covered,omitempty"`
-	CoveredLines    int     `json:"covered_lines,omitempty"`
-	NotCoveredLines int     `json:"not_covered_lines,omitempty"`
-	Coverage        float64 `json:"coverage,omitempty"`
+	Covered         []Range      `json:"covered,omitempty"`
+	NotCovered      []Range      `json:"not_covered,omitempty"`
+	CoveredLines    int          `json:"covered_lines,omitempty"`
+	NotCoveredLines int          `json:"not_covered_lines,omitempty"`
+	Coverage        float64      `json:"coverage,omitempty"`
+	Bodies          []BodyReport `json:"bodies,omitempty"`
+}
+
+// BodyReport represents the expression coverage of a rule body.
+type BodyReport struct {
+	Row         int          `json:"row"`
+	Expressions []ExprReport `json:"expressions,omitempty"`
+}
+
+// ExprReport represents the coverage of an expression. The expression was
+// reached if it was evaluated and satisfied if it evaluated to true at least
+// once. Expressions that were reached but never satisfied are only partially
+// covered.
+type ExprReport struct {
+	Row       int    `json:"row"`
+	Col       int    `json:"col"`
+	Text      string `json:"text,omitempty"`
+	Reached   bool   `json:"reached"`
+	Satisfied bool   `json:"satisfied"`
 }
 
 // IsCovered returns true if the row is marked as covered in the report.
@@ -232,6 +232,73 @@ allow { true }
 	}
 }
 
+func TestCoverExpressions(t *testing.T) {
+
+	cover := New()
+
+	module := `package test
+
+p {
+	x := input.xs[_]
+	x > 1
+	count(input.xs) > 10 # expect reached but never true
+}
+
+q {
+	not r
+}
+
+r { true }
+
+s { false } # expect not reached
+`
+
+	parsedModule, err := ast.ParseModule("test.rego", module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	for _, query := range []string{"data.test.p", "data.test.q"} {
+		_, err := rego.New(
+			rego.Module("test.rego", module),
+			rego.Query(query),
+			rego.Input(map[string]interface{}{"xs": []interface{}{1, 2}}),
+			rego.QueryTracer(cover),
+		).Eval(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := cover.Report(map[string]*ast.Module{
+		"test.rego": parsedModule,
+	})
+
+	exp := []BodyReport{
+		{Row: 3, Expressions: []ExprReport{
+			{Row: 4, Col: 2, Text: "x := input.xs[_]", Reached: true, Satisfied: true},
+			{Row: 5, Col: 2, Text: "x > 1", Reached: true, Satisfied: true},
+			{Row: 6, Col: 2, Text: "count(input.xs) > 10", Reached: true},
+		}},
+		{Row: 9, Expressions: []ExprReport{
+			{Row: 10, Col: 2, Text: "not r", Reached: true},
+		}},
+		{Row: 13, Expressions: []ExprReport{
+			{Row: 13, Col: 5, Text: "true", Reached: true, Satisfied: true},
+		}},
+		{Row: 15, Expressions: []ExprReport{
+			{Row: 15, Col: 5, Text: "false"},
+		}},
+	}
+
+	if !reflect.DeepEqual(exp, report.Files["test.rego"].Bodies) {
+		bs, _ := json.MarshalIndent(report.Files["test.rego"].Bodies, "", "  ")
+		t.Fatalf("Unexpected body reports:\n%s", bs)
+	}
+}
+
 func TestCoverTraceConfig(t *testing.T) {
 	ct := topdown.QueryTracer(New())
 	conf := ct.Config()
@@ -0,0 +1,271 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cover
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/open-policy-agent/opa/version"
+)
+
+// WriteLCOV writes the report to w in the LCOV tracefile format. The
+// expressions of every rule body are reported as branches of a block that are
+// taken if the expression evaluated to true at least once.
+func (r Report) WriteLCOV(w io.Writer) error {
+
+	bw := bufio.NewWriter(w)
+
+	for _, file := range r.sortedFiles() {
+		fr := r.Files[file]
+
+		fmt.Fprintln(bw, "TN:")
+		fmt.Fprintf(bw, "SF:%v\n", file)
+
+		var found, hit int
+		for block, body := range fr.Bodies {
+			for branch, expr := range body.Expressions {
+				taken := "-"
+				if expr.Reached {
+					taken = "0"
+				}
+				if expr.Satisfied {
+					taken = "1"
+					hit++
+				}
+				found++
+				fmt.Fprintf(bw, "BRDA:%d,%d,%d,%v\n", expr.Row, block, branch, taken)
+			}
+		}
+
+		fmt.Fprintf(bw, "BRF:%d\n", found)
+		fmt.Fprintf(bw, "BRH:%d\n", hit)
+
+		for _, line := range fr.lines() {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line.row, line.hits)
+		}
+
+		fmt.Fprintf(bw, "LF:%d\n", fr.CoveredLines+fr.NotCoveredLines)
+		fmt.Fprintf(bw, "LH:%d\n", fr.CoveredLines)
+		fmt.Fprintln(bw, "end_of_record")
+	}
+
+	return bw.Flush()
+}
+
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        float64            `xml:"line-rate,attr"`
+	BranchRate      float64            `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      int                `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   float64          `xml:"line-rate,attr"`
+	BranchRate float64          `xml:"branch-rate,attr"`
+	Complexity int              `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+	counts     coberturaCounts
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   float64         `xml:"line-rate,attr"`
+	BranchRate float64         `xml:"branch-rate,attr"`
+	Complexity int             `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number            int    `xml:"number,attr"`
+	Hits              int    `xml:"hits,attr"`
+	Branch            bool   `xml:"branch,attr"`
+	ConditionCoverage string `xml:"condition-coverage,attr,omitempty"`
+}
+
+type coberturaCounts struct {
+	linesCovered, linesValid       int
+	branchesCovered, branchesValid int
+}
+
+func (c *coberturaCounts) add(other coberturaCounts) {
+	c.linesCovered += other.linesCovered
+	c.linesValid += other.linesValid
+	c.branchesCovered += other.branchesCovered
+	c.branchesValid += other.branchesValid
+}
+
+func (c coberturaCounts) lineRate() float64 {
+	return rate(c.linesCovered, c.linesValid)
+}
+
+func (c coberturaCounts) branchRate() float64 {
+	return rate(c.branchesCovered, c.branchesValid)
+}
+
+// WriteCobertura writes the report to w in the Cobertura XML format. Files are
+// reported as classes of a package named after their directory. Lines with
+// expressions are reported as branches whose conditions are covered if the
+// expressions evaluated to true at least once.
+func (r Report) WriteCobertura(w io.Writer) error {
+
+	report := coberturaCoverage{
+		Version:   version.Version,
+		Timestamp: time.Now().Unix(),
+	}
+
+	var total coberturaCounts
+	packages := map[string]*coberturaPackage{}
+	var names []string
+
+	for _, file := range r.sortedFiles() {
+		fr := r.Files[file]
+
+		class, counts := fr.coberturaClass(file)
+
+		name := filepath.Dir(file)
+		pkg, ok := packages[name]
+		if !ok {
+			pkg = &coberturaPackage{Name: name}
+			packages[name] = pkg
+			names = append(names, name)
+		}
+
+		pkg.Classes = append(pkg.Classes, class)
+		pkg.counts.add(counts)
+		total.add(counts)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		pkg := packages[name]
+		pkg.LineRate = pkg.counts.lineRate()
+		pkg.BranchRate = pkg.counts.branchRate()
+		report.Packages = append(report.Packages, *pkg)
+	}
+
+	report.LineRate = total.lineRate()
+	report.BranchRate = total.branchRate()
+	report.LinesCovered = total.linesCovered
+	report.LinesValid = total.linesValid
+	report.BranchesCovered = total.branchesCovered
+	report.BranchesValid = total.branchesValid
+
+	bs, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprint(w, xml.Header); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(bs))
+	return err
+}
+
+func (fr *FileReport) coberturaClass(file string) (coberturaClass, coberturaCounts) {
+
+	type conditions struct{ covered, total int }
+
+	byRow := map[int]*conditions{}
+	for _, body := range fr.Bodies {
+		for _, expr := range body.Expressions {
+			c, ok := byRow[expr.Row]
+			if !ok {
+				c = &conditions{}
+				byRow[expr.Row] = c
+			}
+			c.total++
+			if expr.Satisfied {
+				c.covered++
+			}
+		}
+	}
+
+	class := coberturaClass{
+		Name:     filepath.Base(file),
+		Filename: file,
+	}
+
+	var counts coberturaCounts
+
+	for _, line := range fr.lines() {
+		cl := coberturaLine{Number: line.row, Hits: line.hits}
+		if c, ok := byRow[line.row]; ok {
+			cl.Branch = true
+			cl.ConditionCoverage = fmt.Sprintf("%d%% (%d/%d)", 100*c.covered/c.total, c.covered, c.total)
+			counts.branchesCovered += c.covered
+			counts.branchesValid += c.total
+		}
+		if line.hits > 0 {
+			counts.linesCovered++
+		}
+		counts.linesValid++
+		class.Lines = append(class.Lines, cl)
+	}
+
+	class.LineRate = counts.lineRate()
+	class.BranchRate = counts.branchRate()
+
+	return class, counts
+}
+
+type lineHits struct {
+	row  int
+	hits int
+}
+
+// lines returns the covered and not covered lines of the file sorted by row.
+func (fr *FileReport) lines() []lineHits {
+	var result []lineHits
+	for _, r := range fr.Covered {
+		for row := r.Start.Row; row <= r.End.Row; row++ {
+			result = append(result, lineHits{row: row, hits: 1})
+		}
+	}
+	for _, r := range fr.NotCovered {
+		for row := r.Start.Row; row <= r.End.Row; row++ {
+			result = append(result, lineHits{row: row})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].row < result[j].row
+	})
+	return result
+}
+
+func (r Report) sortedFiles() []string {
+	files := make([]string, 0, len(r.Files))
+	for file := range r.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func rate(covered, valid int) float64 {
+	if valid == 0 {
+		return 0
+	}
+	return math.Round(10000*float64(covered)/float64(valid)) / 10000
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package cover
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/open-policy-agent/opa/version"
+)
+
+func getExportTestReport() Report {
+	return Report{
+		Files: map[string]*FileReport{
+			"policies/test.rego": {
+				Covered:         []Range{{Position{3}, Position{4}}},
+				NotCovered:      []Range{{Position{7}, Position{8}}},
+				CoveredLines:    2,
+				NotCoveredLines: 2,
+				Bodies: []BodyReport{
+					{Row: 3, Expressions: []ExprReport{
+						{Row: 4, Col: 2, Reached: true, Satisfied: true},
+						{Row: 4, Col: 10, Reached: true},
+					}},
+					{Row: 7, Expressions: []ExprReport{
+						{Row: 8, Col: 2},
+					}},
+				},
+			},
+			"policies/util/strings.rego": {
+				Covered:      []Range{{Position{3}, Position{3}}},
+				CoveredLines: 1,
+				Bodies: []BodyReport{
+					{Row: 3, Expressions: []ExprReport{
+						{Row: 3, Col: 5, Reached: true, Satisfied: true},
+					}},
+				},
+			},
+		},
+		CoveredLines:    3,
+		NotCoveredLines: 2,
+		Coverage:        60,
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	if err := getExportTestReport().WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `TN:
+SF:policies/test.rego
+BRDA:4,0,0,1
+BRDA:4,0,1,0
+BRDA:8,1,0,-
+BRF:3
+BRH:1
+DA:3,1
+DA:4,1
+DA:7,0
+DA:8,0
+LF:4
+LH:2
+end_of_record
+TN:
+SF:policies/util/strings.rego
+BRDA:3,0,0,1
+BRF:1
+BRH:1
+DA:3,1
+LF:1
+LH:1
+end_of_record
+`
+
+	if buf.String() != exp {
+		t.Fatalf("Expected:\n\n%v\n\nGot:\n\n%v", exp, buf.String())
+	}
+}
+
+func TestWriteCobertura(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	if err := getExportTestReport().WriteCobertura(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `<?xml version="1.0" encoding="UTF-8"?>
+<coverage line-rate="0.6" branch-rate="0.5" lines-covered="3" lines-valid="5" branches-covered="2" branches-valid="4" complexity="0" version="` + version.Version + `" timestamp="0">
+  <packages>
+    <package name="policies" line-rate="0.5" branch-rate="0.3333" complexity="0">
+      <classes>
+        <class name="test.rego" filename="policies/test.rego" line-rate="0.5" branch-rate="0.3333" complexity="0">
+          <methods></methods>
+          <lines>
+            <line number="3" hits="1" branch="false"></line>
+            <line number="4" hits="1" branch="true" condition-coverage="50% (1/2)"></line>
+            <line number="7" hits="0" branch="false"></line>
+            <line number="8" hits="0" branch="true" condition-coverage="0% (0/1)"></line>
+          </lines>
+        </class>
+      </classes>
+    </package>
+    <package name="policies/util" line-rate="1" branch-rate="1" complexity="0">
+      <classes>
+        <class name="strings.rego" filename="policies/util/strings.rego" line-rate="1" branch-rate="1" complexity="0">
+          <methods></methods>
+          <lines>
+            <line number="3" hits="1" branch="true" condition-coverage="100% (1/1)"></line>
+          </lines>
+        </class>
+      </classes>
+    </package>
+  </packages>
+</coverage>
+`
+
+	result := regexp.MustCompile(`timestamp="\d+"`).ReplaceAllString(buf.String(), `timestamp="0"`)
+
+	if result != exp {
+		t.Fatalf("Expected:\n\n%v\n\nGot:\n\n%v", exp, result)
+	}
+}
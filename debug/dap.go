@@ -0,0 +1,856 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/open-policy-agent/opa/ast"
+	initload "github.com/open-policy-agent/opa/internal/runtime/init"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/topdown/print"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// threadID is the ID of the only thread of the debuggee.
+const threadID = 1
+
+// maxValueLength limits the length of the values displayed by the client.
+// Compound values can be expanded to see their elements.
+const maxValueLength = 256
+
+// Server implements the Debug Adapter Protocol (DAP) for a single debug
+// session. The client launches the evaluation of a query against a set of
+// data files and bundles, sets breakpoints and controls the evaluation.
+//
+// See https://microsoft.github.io/debug-adapter-protocol/ for the protocol.
+type Server struct {
+	r    *bufio.Reader
+	w    io.Writer
+	wmtx sync.Mutex
+	seq  int
+
+	mtx           sync.Mutex
+	launch        *launchArgs
+	configured    bool
+	store         storage.Store
+	compiler      *ast.Compiler
+	input         ast.Value
+	session       *Session
+	breakpoints   map[string][]*Breakpoint // breakpoints by source path
+	breakpointIDs map[*Breakpoint]int
+	stop          *Stop
+	vars          []variables // expandable variables of the current stop
+}
+
+// NewServer returns a new DAP server reading requests from r and writing
+// responses and events to w.
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{
+		r:             bufio.NewReader(r),
+		w:             w,
+		breakpoints:   map[string][]*Breakpoint{},
+		breakpointIDs: map[*Breakpoint]int{},
+	}
+}
+
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type launchArgs struct {
+	Query       string          `json:"query"`
+	Input       json.RawMessage `json:"input,omitempty"`
+	InputPath   string          `json:"inputPath,omitempty"`
+	DataPaths   []string        `json:"dataPaths,omitempty"`
+	BundlePaths []string        `json:"bundlePaths,omitempty"`
+	StopOnEntry bool            `json:"stopOnEntry,omitempty"`
+}
+
+type source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type sourceBreakpoint struct {
+	Line      int    `json:"line"`
+	Condition string `json:"condition,omitempty"`
+}
+
+type setBreakpointsArgs struct {
+	Source      source             `json:"source"`
+	Breakpoints []sourceBreakpoint `json:"breakpoints"`
+}
+
+type breakpoint struct {
+	ID       int     `json:"id,omitempty"`
+	Verified bool    `json:"verified"`
+	Message  string  `json:"message,omitempty"`
+	Source   *source `json:"source,omitempty"`
+	Line     int     `json:"line,omitempty"`
+}
+
+type stackFrame struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Source *source `json:"source,omitempty"`
+	Line   int     `json:"line"`
+	Column int     `json:"column"`
+}
+
+type scope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type frameArgs struct {
+	FrameID int `json:"frameId"`
+}
+
+type variablesArgs struct {
+	VariablesReference int `json:"variablesReference"`
+}
+
+type evaluateArgs struct {
+	Expression string `json:"expression"`
+	FrameID    int    `json:"frameId,omitempty"`
+}
+
+// variables are the children of an expandable variable: either the local
+// variables of a frame, the data in the store, or the elements of a compound
+// value.
+type variables struct {
+	locals []Variable
+	data   bool
+	value  ast.Value
+}
+
+// handler handles a request. The returned function, if any, is called after
+// the response has been sent.
+type handler func(ctx context.Context, args json.RawMessage) (interface{}, func(), error)
+
+// Serve handles requests until the client disconnects or closes the
+// connection.
+func (s *Server) Serve(ctx context.Context) error {
+
+	handlers := map[string]handler{
+		"initialize":              s.initialize,
+		"launch":                  s.launchRequest,
+		"setBreakpoints":          s.setBreakpoints,
+		"setExceptionBreakpoints": s.setExceptionBreakpoints,
+		"configurationDone":       s.configurationDone,
+		"threads":                 s.threads,
+		"stackTrace":              s.stackTrace,
+		"scopes":                  s.scopes,
+		"variables":               s.variables,
+		"evaluate":                s.evaluate,
+		"continue":                s.resume(Continue),
+		"next":                    s.resume(StepOver),
+		"stepIn":                  s.resume(StepIn),
+		"stepOut":                 s.resume(StepOut),
+		"terminate":               s.terminate,
+	}
+
+	defer s.terminateSession()
+
+	for {
+		req, err := s.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if req.Command == "disconnect" {
+			s.terminateSession()
+			return s.respond(req, nil, nil)
+		}
+
+		h, ok := handlers[req.Command]
+		if !ok {
+			if err := s.respond(req, nil, fmt.Errorf("unsupported command %q", req.Command)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		body, then, err := h(ctx, req.Arguments)
+		if err := s.respond(req, body, err); err != nil {
+			return err
+		}
+
+		if then != nil {
+			then()
+		}
+	}
+}
+
+func (s *Server) initialize(context.Context, json.RawMessage) (interface{}, func(), error) {
+	capabilities := map[string]interface{}{
+		"supportsConfigurationDoneRequest": true,
+		"supportsConditionalBreakpoints":   true,
+		"supportsTerminateRequest":         true,
+	}
+	return capabilities, func() {
+		s.sendEvent("initialized", nil)
+	}, nil
+}
+
+func (s *Server) launchRequest(ctx context.Context, raw json.RawMessage) (interface{}, func(), error) {
+
+	var args launchArgs
+	if err := util.Unmarshal(raw, &args); err != nil {
+		return nil, nil, err
+	}
+
+	if args.Query == "" {
+		return nil, nil, errors.New("launch: query is required")
+	}
+
+	if err := s.load(ctx, &args); err != nil {
+		return nil, nil, err
+	}
+
+	s.mtx.Lock()
+	s.launch = &args
+	s.mtx.Unlock()
+
+	return nil, func() {
+		s.start(ctx)
+	}, nil
+}
+
+// load loads the data files, bundles and input of the launch request.
+func (s *Server) load(ctx context.Context, args *launchArgs) error {
+
+	data, err := initload.LoadPaths(args.DataPaths, nil, false, nil, true, false, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	bundles, err := initload.LoadPaths(args.BundlePaths, nil, true, nil, true, false, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	store := inmem.New()
+	txn, err := store.NewTransaction(ctx, storage.WriteParams)
+	if err != nil {
+		return err
+	}
+
+	result, err := initload.InsertAndCompile(ctx, initload.InsertAndCompileOptions{
+		Store:                 store,
+		Txn:                   txn,
+		Files:                 data.Files,
+		Bundles:               bundles.Bundles,
+		MaxErrors:             -1,
+		EnablePrintStatements: true,
+	})
+	if err != nil {
+		store.Abort(ctx, txn)
+		return err
+	}
+
+	if err := store.Commit(ctx, txn); err != nil {
+		return err
+	}
+
+	var input ast.Value
+
+	raw := []byte(args.Input)
+	if args.InputPath != "" {
+		if raw, err = os.ReadFile(args.InputPath); err != nil {
+			return err
+		}
+	}
+
+	if len(raw) > 0 {
+		var x interface{}
+		if err := util.Unmarshal(raw, &x); err != nil {
+			return fmt.Errorf("input: %w", err)
+		}
+		if input, err = ast.InterfaceToValue(x); err != nil {
+			return fmt.Errorf("input: %w", err)
+		}
+	}
+
+	s.mtx.Lock()
+	s.store = store
+	s.compiler = result.Compiler
+	s.input = input
+	s.mtx.Unlock()
+
+	return nil
+}
+
+func (s *Server) setBreakpoints(_ context.Context, raw json.RawMessage) (interface{}, func(), error) {
+
+	var args setBreakpointsArgs
+	if err := util.Unmarshal(raw, &args); err != nil {
+		return nil, nil, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, b := range s.breakpoints[args.Source.Path] {
+		delete(s.breakpointIDs, b)
+	}
+
+	result := make([]breakpoint, 0, len(args.Breakpoints))
+	set := make([]*Breakpoint, 0, len(args.Breakpoints))
+
+	for _, sb := range args.Breakpoints {
+		b, err := NewBreakpoint(args.Source.Path, sb.Line, sb.Condition)
+		if err != nil {
+			result = append(result, breakpoint{Line: sb.Line, Message: err.Error()})
+			continue
+		}
+		id := len(s.breakpointIDs) + 1
+		for _, other := range s.breakpointIDs {
+			if other >= id {
+				id = other + 1
+			}
+		}
+		s.breakpointIDs[b] = id
+		set = append(set, b)
+		result = append(result, breakpoint{
+			ID:       id,
+			Verified: true,
+			Source:   &args.Source,
+			Line:     sb.Line,
+		})
+	}
+
+	s.breakpoints[args.Source.Path] = set
+
+	if s.session != nil {
+		s.session.SetBreakpoints(s.allBreakpoints())
+	}
+
+	return map[string]interface{}{"breakpoints": result}, nil, nil
+}
+
+func (s *Server) allBreakpoints() []*Breakpoint {
+	var result []*Breakpoint
+	for _, bs := range s.breakpoints {
+		result = append(result, bs...)
+	}
+	return result
+}
+
+func (*Server) setExceptionBreakpoints(context.Context, json.RawMessage) (interface{}, func(), error) {
+	return nil, nil, nil
+}
+
+func (s *Server) configurationDone(ctx context.Context, _ json.RawMessage) (interface{}, func(), error) {
+	s.mtx.Lock()
+	s.configured = true
+	s.mtx.Unlock()
+	return nil, func() {
+		s.start(ctx)
+	}, nil
+}
+
+// start starts the evaluation once the evaluation has been launched and the
+// client is done with the configuration, i.e., has set the breakpoints.
+func (s *Server) start(ctx context.Context) {
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.launch == nil || !s.configured || s.session != nil {
+		return
+	}
+
+	txn, err := s.store.NewTransaction(ctx)
+	if err != nil {
+		s.sendOutput("stderr", err.Error())
+		s.sendExit(2)
+		return
+	}
+
+	session := NewSession().
+		WithCompiler(s.compiler).
+		WithStore(s.store).
+		WithTransaction(txn).
+		WithStopOnEntry(s.launch.StopOnEntry)
+	session.SetBreakpoints(s.allBreakpoints())
+
+	s.session = session
+
+	args := []func(*rego.Rego){
+		rego.Query(s.launch.Query),
+		rego.Compiler(s.compiler),
+		rego.Store(s.store),
+		rego.Transaction(txn),
+		rego.QueryTracer(session),
+		rego.EnablePrintStatements(true),
+		rego.PrintHook(s),
+	}
+
+	if s.input != nil {
+		args = append(args, rego.ParsedInput(s.input))
+	}
+
+	var rs rego.ResultSet
+
+	session.Start(ctx, func(ctx context.Context) error {
+		var err error
+		rs, err = rego.New(args...).Eval(ctx)
+		return err
+	})
+
+	go func() {
+		for stop := session.Wait(); stop != nil; stop = session.Wait() {
+			s.mtx.Lock()
+			s.stop = stop
+			s.vars = nil
+			s.mtx.Unlock()
+
+			if stop.Err != nil {
+				s.sendOutput("stderr", fmt.Sprintf("breakpoint condition %v: %v", stop.Breakpoint.Condition, stop.Err))
+			}
+
+			body := map[string]interface{}{
+				"reason":            stop.Reason,
+				"threadId":          threadID,
+				"allThreadsStopped": true,
+			}
+			if stop.Breakpoint != nil {
+				s.mtx.Lock()
+				if id, ok := s.breakpointIDs[stop.Breakpoint]; ok {
+					body["hitBreakpointIds"] = []int{id}
+				}
+				s.mtx.Unlock()
+			}
+			s.sendEvent("stopped", body)
+		}
+
+		s.store.Abort(ctx, txn)
+
+		if err := session.Err(); err != nil {
+			s.sendOutput("stderr", err.Error())
+			s.sendExit(2)
+			return
+		}
+
+		bs, err := json.MarshalIndent(rs, "", "  ")
+		if err != nil {
+			s.sendOutput("stderr", err.Error())
+			s.sendExit(2)
+			return
+		}
+
+		s.sendOutput("stdout", string(bs))
+		s.sendExit(0)
+	}()
+}
+
+// Print implements the print.Hook interface. The output of print statements
+// is sent to the client.
+func (s *Server) Print(_ print.Context, msg string) error {
+	s.sendOutput("stdout", msg)
+	return nil
+}
+
+func (s *Server) sendOutput(category, output string) {
+	s.sendEvent("output", map[string]interface{}{
+		"category": category,
+		"output":   output + "\n",
+	})
+}
+
+func (s *Server) sendExit(code int) {
+	s.sendEvent("exited", map[string]interface{}{"exitCode": code})
+	s.sendEvent("terminated", nil)
+}
+
+func (*Server) threads(context.Context, json.RawMessage) (interface{}, func(), error) {
+	return map[string]interface{}{
+		"threads": []map[string]interface{}{{"id": threadID, "name": "main"}},
+	}, nil, nil
+}
+
+func (s *Server) stackTrace(context.Context, json.RawMessage) (interface{}, func(), error) {
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.stop == nil {
+		return nil, nil, ErrNotStopped
+	}
+
+	frames := make([]stackFrame, len(s.stop.Frames))
+	for i, f := range s.stop.Frames {
+		frames[i] = stackFrame{ID: i + 1, Name: f.Name}
+		if f.Location != nil {
+			frames[i].Line = f.Location.Row
+			frames[i].Column = f.Location.Col
+			if f.Location.File != "" {
+				frames[i].Source = &source{Name: filepath.Base(f.Location.File), Path: f.Location.File}
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"stackFrames": frames,
+		"totalFrames": len(frames),
+	}, nil, nil
+}
+
+// frame returns the frame with the ID of the stack trace. The innermost
+// frame is returned if the ID is 0. The lock must be held.
+func (s *Server) frame(id int) (*Frame, error) {
+	if s.stop == nil {
+		return nil, ErrNotStopped
+	}
+	if id == 0 {
+		id = 1
+	}
+	if id < 1 || id > len(s.stop.Frames) {
+		return nil, fmt.Errorf("invalid frame %d", id)
+	}
+	return s.stop.Frames[id-1], nil
+}
+
+func (s *Server) scopes(_ context.Context, raw json.RawMessage) (interface{}, func(), error) {
+
+	var args frameArgs
+	if err := util.Unmarshal(raw, &args); err != nil {
+		return nil, nil, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	frame, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scopes := []scope{{Name: "Locals", VariablesReference: s.expandable(variables{locals: frame.Locals()})}}
+
+	if input := frame.Input(); input != nil {
+		scopes = append(scopes, scope{Name: "Input", VariablesReference: s.expandable(variables{value: input})})
+	}
+
+	scopes = append(scopes, scope{Name: "Data", VariablesReference: s.expandable(variables{data: true}), Expensive: true})
+
+	return map[string]interface{}{"scopes": scopes}, nil, nil
+}
+
+// expandable registers the variables and returns their reference. The lock
+// must be held.
+func (s *Server) expandable(vs variables) int {
+	s.vars = append(s.vars, vs)
+	return len(s.vars)
+}
+
+func (s *Server) variables(ctx context.Context, raw json.RawMessage) (interface{}, func(), error) {
+
+	var args variablesArgs
+	if err := util.Unmarshal(raw, &args); err != nil {
+		return nil, nil, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.stop == nil {
+		return nil, nil, ErrNotStopped
+	}
+
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.vars) {
+		return nil, nil, fmt.Errorf("invalid variables reference %d", args.VariablesReference)
+	}
+
+	vs := s.vars[args.VariablesReference-1]
+	result := []variable{}
+
+	switch {
+	case vs.locals != nil:
+		for _, v := range vs.locals {
+			result = append(result, s.variable(v.Name, v.Value))
+		}
+		return map[string]interface{}{"variables": result}, nil, nil
+	case vs.data:
+		data, err := s.store.Read(ctx, s.session.txn, storage.Path{})
+		if err != nil {
+			return nil, nil, err
+		}
+		if vs.value, err = ast.InterfaceToValue(data); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	switch v := vs.value.(type) {
+	case ast.Object:
+		keys := v.Keys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].Value.Compare(keys[j].Value) < 0
+		})
+		for _, k := range keys {
+			name := k.String()
+			if str, ok := k.Value.(ast.String); ok {
+				name = string(str)
+			}
+			result = append(result, s.variable(name, v.Get(k).Value))
+		}
+	case *ast.Array:
+		for i := 0; i < v.Len(); i++ {
+			result = append(result, s.variable(strconv.Itoa(i), v.Elem(i).Value))
+		}
+	case ast.Set:
+		elems := v.Sorted()
+		for i := 0; i < elems.Len(); i++ {
+			result = append(result, s.variable(strconv.Itoa(i), elems.Elem(i).Value))
+		}
+	}
+
+	return map[string]interface{}{"variables": result}, nil, nil
+}
+
+// variable returns the variable with the value. Non-empty compound values are
+// expandable. The lock must be held.
+func (s *Server) variable(name string, value ast.Value) variable {
+	v := variable{Name: name, Value: truncate(value.String()), Type: ast.TypeName(value)}
+	switch x := value.(type) {
+	case ast.Object:
+		if x.Len() > 0 {
+			v.VariablesReference = s.expandable(variables{value: value})
+		}
+	case *ast.Array:
+		if x.Len() > 0 {
+			v.VariablesReference = s.expandable(variables{value: value})
+		}
+	case ast.Set:
+		if x.Len() > 0 {
+			v.VariablesReference = s.expandable(variables{value: value})
+		}
+	}
+	return v
+}
+
+func truncate(s string) string {
+	if len(s) <= maxValueLength {
+		return s
+	}
+	return s[:maxValueLength] + "..."
+}
+
+func (s *Server) evaluate(ctx context.Context, raw json.RawMessage) (interface{}, func(), error) {
+
+	var args evaluateArgs
+	if err := util.Unmarshal(raw, &args); err != nil {
+		return nil, nil, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	frame, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rs, err := s.session.Eval(ctx, frame, args.Expression)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(rs) == 0 {
+		return map[string]interface{}{"result": "undefined", "variablesReference": 0}, nil, nil
+	}
+
+	// Single expressions evaluate to their value, queries with variables to
+	// the bindings of each result.
+	var x interface{}
+	if len(rs) == 1 && len(rs[0].Bindings) == 0 && len(rs[0].Expressions) == 1 {
+		x = rs[0].Expressions[0].Value
+	} else {
+		results := make([]interface{}, len(rs))
+		for i := range rs {
+			if len(rs[i].Bindings) > 0 {
+				results[i] = rs[i].Bindings
+			} else {
+				results[i] = rs[i].Expressions
+			}
+		}
+		x = results
+	}
+
+	value, err := ast.InterfaceToValue(x)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v := s.variable("", value)
+
+	return map[string]interface{}{
+		"result":             v.Value,
+		"type":               v.Type,
+		"variablesReference": v.VariablesReference,
+	}, nil, nil
+}
+
+func (s *Server) resume(action Action) handler {
+	return func(context.Context, json.RawMessage) (interface{}, func(), error) {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		if s.stop == nil {
+			return nil, nil, ErrNotStopped
+		}
+
+		s.stop = nil
+		s.vars = nil
+		session := s.session
+
+		var body interface{}
+		if action == Continue {
+			body = map[string]interface{}{"allThreadsContinued": true}
+		}
+
+		return body, func() {
+			_ = session.Resume(action)
+		}, nil
+	}
+}
+
+func (s *Server) terminate(context.Context, json.RawMessage) (interface{}, func(), error) {
+	return nil, s.terminateSession, nil
+}
+
+func (s *Server) terminateSession() {
+	s.mtx.Lock()
+	session := s.session
+	s.stop = nil
+	s.mtx.Unlock()
+
+	if session != nil {
+		session.Terminate()
+		<-session.Done()
+	}
+}
+
+func (s *Server) read() (*request, error) {
+
+	length := -1
+
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if length >= 0 {
+				break
+			}
+			continue
+		}
+
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid header %q", line)
+			}
+		}
+	}
+
+	bs := make([]byte, length)
+	if _, err := io.ReadFull(s.r, bs); err != nil {
+		return nil, err
+	}
+
+	var req request
+	if err := json.Unmarshal(bs, &req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+func (s *Server) respond(req *request, body interface{}, err error) error {
+	resp := response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Body:       body,
+	}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	return s.write(&resp, &resp.Seq)
+}
+
+func (s *Server) sendEvent(name string, body interface{}) {
+	evt := event{Type: "event", Event: name, Body: body}
+	_ = s.write(&evt, &evt.Seq)
+}
+
+// write writes the message. The sequence number of the message is assigned
+// when it is written, so that messages are numbered in the order they are
+// sent.
+func (s *Server) write(msg interface{}, seq *int) error {
+	s.wmtx.Lock()
+	defer s.wmtx.Unlock()
+
+	s.seq++
+	*seq = s.seq
+
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(bs), bs)
+	return err
+}
@@ -0,0 +1,253 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testClient struct {
+	t       *testing.T
+	w       io.Writer
+	r       *bufio.Reader
+	seq     int
+	pending []map[string]interface{}
+}
+
+func (c *testClient) send(command string, args interface{}) {
+	c.t.Helper()
+
+	c.seq++
+	bs, err := json.Marshal(map[string]interface{}{
+		"seq":       c.seq,
+		"type":      "request",
+		"command":   command,
+		"arguments": args,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(bs), bs); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) read() map[string]interface{} {
+	c.t.Helper()
+
+	var length int
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if length, err = strconv.Atoi(strings.TrimPrefix(line, "Content-Length: ")); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+
+	bs := make([]byte, length)
+	if _, err := io.ReadFull(c.r, bs); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(bs, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return msg
+}
+
+// request sends the request and returns the body of the response. Events
+// received in the meantime are kept for expectEvent.
+func (c *testClient) request(command string, args interface{}) map[string]interface{} {
+	c.t.Helper()
+
+	c.send(command, args)
+
+	for {
+		msg := c.read()
+		if msg["type"] == "event" {
+			c.pending = append(c.pending, msg)
+			continue
+		}
+		if msg["command"] != command || msg["success"] != true {
+			c.t.Fatalf("Expected successful %v response but got %v", command, msg)
+		}
+		body, _ := msg["body"].(map[string]interface{})
+		return body
+	}
+}
+
+func (c *testClient) expectEvent(name string) map[string]interface{} {
+	c.t.Helper()
+
+	for {
+		var msg map[string]interface{}
+		if len(c.pending) > 0 {
+			msg, c.pending = c.pending[0], c.pending[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg["type"] != "event" {
+			c.t.Fatalf("Expected %v event but got %v", name, msg)
+		}
+		if msg["event"] == name {
+			body, _ := msg["body"].(map[string]interface{})
+			return body
+		}
+	}
+}
+
+func (c *testClient) variables(ref interface{}) map[string]string {
+	c.t.Helper()
+
+	body := c.request("variables", map[string]interface{}{"variablesReference": ref})
+	result := map[string]string{}
+	for _, v := range body["variables"].([]interface{}) {
+		v := v.(map[string]interface{})
+		result[v["name"].(string)] = v["value"].(string)
+	}
+	return result
+}
+
+func TestServer(t *testing.T) {
+
+	dir := t.TempDir()
+	policy := filepath.Join(dir, "test.rego")
+
+	if err := os.WriteFile(policy, []byte(testModule), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "data.json"), []byte(`{"limits": {"max": 10}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	served := make(chan error)
+	go func() {
+		served <- NewServer(serverR, serverW).Serve(context.Background())
+		serverW.Close()
+	}()
+
+	c := &testClient{t: t, w: clientW, r: bufio.NewReader(clientR)}
+
+	body := c.request("initialize", map[string]interface{}{"adapterID": "opa"})
+	if body["supportsConditionalBreakpoints"] != true {
+		t.Fatalf("Unexpected capabilities: %v", body)
+	}
+	c.expectEvent("initialized")
+
+	c.request("launch", map[string]interface{}{
+		"query":     "data.test.allow",
+		"input":     map[string]interface{}{"x": 3},
+		"dataPaths": []string{dir},
+	})
+
+	body = c.request("setBreakpoints", map[string]interface{}{
+		"source": map[string]interface{}{"path": policy},
+		"breakpoints": []map[string]interface{}{
+			{"line": 10, "condition": "a == 3"},
+			{"line": 4, "condition": "x =="},
+		},
+	})
+
+	bps := body["breakpoints"].([]interface{})
+	if len(bps) != 2 || bps[0].(map[string]interface{})["verified"] != true || bps[1].(map[string]interface{})["verified"] != false {
+		t.Fatalf("Unexpected breakpoints: %v", bps)
+	}
+
+	c.request("configurationDone", nil)
+
+	stopped := c.expectEvent("stopped")
+	if stopped["reason"] != "breakpoint" || fmt.Sprint(stopped["hitBreakpointIds"]) != "[1]" {
+		t.Fatalf("Unexpected stopped event: %v", stopped)
+	}
+
+	body = c.request("stackTrace", map[string]interface{}{"threadId": 1})
+	frames := body["stackFrames"].([]interface{})
+	var names []string
+	for _, f := range frames {
+		names = append(names, f.(map[string]interface{})["name"].(string))
+	}
+	if strings.Join(names, ",") != "data.test.double,data.test.allow,query" {
+		t.Fatalf("Unexpected stack frames: %v", frames)
+	}
+	if top := frames[0].(map[string]interface{}); top["line"] != float64(10) || top["source"].(map[string]interface{})["path"] != policy {
+		t.Fatalf("Unexpected top frame: %v", top)
+	}
+
+	body = c.request("scopes", map[string]interface{}{"frameId": frames[0].(map[string]interface{})["id"]})
+	scopes := map[string]interface{}{}
+	for _, s := range body["scopes"].([]interface{}) {
+		s := s.(map[string]interface{})
+		scopes[s["name"].(string)] = s["variablesReference"]
+	}
+
+	if locals := c.variables(scopes["Locals"]); len(locals) != 1 || locals["a"] != "3" {
+		t.Fatalf("Unexpected locals: %v", locals)
+	}
+
+	if input := c.variables(scopes["Input"]); len(input) != 1 || input["x"] != "3" {
+		t.Fatalf("Unexpected input: %v", input)
+	}
+
+	if data := c.variables(scopes["Data"]); data["limits"] != `{"max": 10}` {
+		t.Fatalf("Unexpected data: %v", data)
+	}
+
+	body = c.request("evaluate", map[string]interface{}{"expression": "a * data.limits.max", "frameId": 1})
+	if body["result"] != "30" {
+		t.Fatalf("Unexpected evaluation result: %v", body)
+	}
+
+	c.request("stepOut", map[string]interface{}{"threadId": 1})
+
+	if stopped := c.expectEvent("stopped"); stopped["reason"] != "step" {
+		t.Fatalf("Unexpected stopped event: %v", stopped)
+	}
+
+	body = c.request("stackTrace", map[string]interface{}{"threadId": 1})
+	if top := body["stackFrames"].([]interface{})[0].(map[string]interface{}); top["name"] != "data.test.allow" || top["line"] != float64(6) {
+		t.Fatalf("Unexpected top frame: %v", top)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": 1})
+
+	output := c.expectEvent("output")
+	if output["category"] != "stdout" || !strings.Contains(output["output"].(string), `"value": true`) {
+		t.Fatalf("Unexpected output: %v", output)
+	}
+
+	if exited := c.expectEvent("exited"); exited["exitCode"] != float64(0) {
+		t.Fatalf("Unexpected exited event: %v", exited)
+	}
+
+	c.expectEvent("terminated")
+
+	c.request("disconnect", nil)
+
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,613 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package debug implements an interactive debugger for Rego policies.
+//
+// The debugger is built on the topdown.QueryTracer interface: a Session is
+// passed to the evaluation as query tracer and pauses the evaluation inside
+// the tracer whenever a breakpoint is hit or a step completes. While the
+// evaluation is paused, the client inspects the stack frames and resumes the
+// evaluation with one of the actions of the session.
+package debug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/topdown"
+)
+
+// Action describes how a paused evaluation is resumed.
+type Action int
+
+const (
+	// Continue resumes the evaluation until the next breakpoint is hit.
+	Continue Action = iota
+
+	// StepIn resumes the evaluation until the next expression or rule is
+	// evaluated.
+	StepIn
+
+	// StepOver resumes the evaluation until the next expression is evaluated
+	// in the current frame or in one of its callers.
+	StepOver
+
+	// StepOut resumes the evaluation until the next expression is evaluated
+	// in one of the callers of the current frame.
+	StepOut
+)
+
+// Reasons for stopping the evaluation. The values match the reasons of the
+// Debug Adapter Protocol.
+const (
+	ReasonEntry      = "entry"
+	ReasonBreakpoint = "breakpoint"
+	ReasonStep       = "step"
+)
+
+// ErrNotStopped is returned when a paused evaluation is required but the
+// evaluation is running or has finished.
+var ErrNotStopped = errors.New("evaluation is not stopped")
+
+// Breakpoint stops the evaluation at a line of a policy file. If the
+// breakpoint has a condition, the evaluation is only stopped if the
+// condition, evaluated in the stopped frame, is defined.
+type Breakpoint struct {
+	File      string
+	Line      int
+	Condition string
+
+	condition ast.Body
+}
+
+// NewBreakpoint returns a new breakpoint. An error is returned if the
+// condition cannot be parsed.
+func NewBreakpoint(file string, line int, condition string) (*Breakpoint, error) {
+	if line <= 0 {
+		return nil, fmt.Errorf("invalid line %d", line)
+	}
+	b := &Breakpoint{File: file, Line: line, Condition: condition}
+	if condition != "" {
+		body, err := ast.ParseBody(condition)
+		if err != nil {
+			return nil, err
+		}
+		b.condition = body
+	}
+	return b, nil
+}
+
+func (b *Breakpoint) String() string {
+	if b.Condition != "" {
+		return fmt.Sprintf("%v:%d if %v", b.File, b.Line, b.Condition)
+	}
+	return fmt.Sprintf("%v:%d", b.File, b.Line)
+}
+
+// matches returns true if the breakpoint is set on the location. The file of
+// the breakpoint matches if it is equal to the file of the location or if
+// either is a path suffix of the other. This accounts for clients that refer
+// to files by absolute path while policies are loaded by relative path, and
+// vice versa.
+func (b *Breakpoint) matches(loc *ast.Location) bool {
+	if loc == nil || loc.Row != b.Line {
+		return false
+	}
+	return matchFile(b.File, loc.File)
+}
+
+func matchFile(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	a, b = filepath.ToSlash(filepath.Clean(a)), filepath.ToSlash(filepath.Clean(b))
+	return a == b || strings.HasSuffix(a, "/"+strings.TrimPrefix(b, "/")) || strings.HasSuffix(b, "/"+strings.TrimPrefix(a, "/"))
+}
+
+// Stop describes a paused evaluation.
+type Stop struct {
+	Reason     string
+	Breakpoint *Breakpoint // breakpoint that was hit, if the reason is ReasonBreakpoint
+	Err        error       // error evaluating the condition of the breakpoint, if any
+	Frames     []*Frame    // stack frames, innermost first
+}
+
+// Frame is a stack frame of a paused evaluation. There is a frame for the
+// query and one for each rule or function that is being evaluated.
+type Frame struct {
+	ID       uint64        // query ID of the frame
+	Name     string        // name of the rule or function, or "query"
+	Location *ast.Location // location of the node being evaluated
+
+	module *ast.Module // module of the rule, nil for the query
+	event  topdown.Event
+}
+
+// Variable is a variable bound in a stack frame.
+type Variable struct {
+	Name  string
+	Value ast.Value
+}
+
+// Locals returns the local variables bound in the frame, sorted by name.
+// Variables generated by the compiler are omitted.
+func (f *Frame) Locals() []Variable {
+
+	vars := make([]ast.Var, 0, len(f.event.LocalMetadata))
+	for v := range f.event.LocalMetadata {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Compare(vars[j]) < 0
+	})
+
+	seen := map[ast.Var]struct{}{}
+	result := []Variable{}
+
+	for _, v := range vars {
+		md := f.event.LocalMetadata[v]
+		if md.Name.IsGenerated() || md.Name.IsWildcard() || f.event.Locals == nil || f.event.Locals.Get(v) == nil {
+			continue
+		}
+		if _, ok := seen[md.Name]; ok {
+			continue
+		}
+		seen[md.Name] = struct{}{}
+		result = append(result, Variable{
+			Name:  string(md.Name),
+			Value: f.event.Plug(ast.NewTerm(v)).Value,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// Input returns the input document of the evaluation, or nil if there is no
+// input.
+func (f *Frame) Input() ast.Value {
+	if input := f.event.Input(); input != nil {
+		return input.Value
+	}
+	return nil
+}
+
+// query contains the state of a query that has been entered by the
+// evaluation.
+type query struct {
+	parent uint64
+	enter  ast.Node      // node the query was entered with
+	last   topdown.Event // last event of the query
+}
+
+// position identifies a line in a policy.
+type position struct {
+	file string
+	row  int
+}
+
+// Session debugs the evaluation of a single query. The session must be
+// passed to the evaluation as query tracer and the evaluation must be run
+// with Start.
+type Session struct {
+	compiler    *ast.Compiler
+	store       storage.Store
+	txn         storage.Transaction
+	stopOnEntry bool
+
+	mtx         sync.Mutex
+	ctx         context.Context
+	cancel      context.CancelFunc
+	breakpoints []*Breakpoint
+	queries     map[uint64]*query
+	action      Action
+	entered     bool
+	origin      uint64              // query the evaluation was last paused in
+	depth       int                 // number of frames when the evaluation was last paused
+	suppressed  map[uint64]position // lines of the frames the evaluation was last paused in
+	stop        *Stop
+	err         error
+
+	stops      chan *Stop
+	resume     chan Action
+	done       chan struct{}
+	terminated chan struct{}
+	terminate  sync.Once
+}
+
+// NewSession returns a new debug session.
+func NewSession() *Session {
+	return &Session{
+		queries:    map[uint64]*query{},
+		suppressed: map[uint64]position{},
+		stops:      make(chan *Stop, 1),
+		resume:     make(chan Action),
+		done:       make(chan struct{}),
+		terminated: make(chan struct{}),
+	}
+}
+
+// WithCompiler sets the compiler that the query is evaluated with. The
+// compiler is used to evaluate breakpoint conditions and expressions.
+func (s *Session) WithCompiler(compiler *ast.Compiler) *Session {
+	s.compiler = compiler
+	return s
+}
+
+// WithStore sets the store that the query is evaluated against.
+func (s *Session) WithStore(store storage.Store) *Session {
+	s.store = store
+	return s
+}
+
+// WithTransaction sets the transaction that the query is evaluated in.
+// Breakpoint conditions and expressions are evaluated in the same
+// transaction.
+func (s *Session) WithTransaction(txn storage.Transaction) *Session {
+	s.txn = txn
+	return s
+}
+
+// WithStopOnEntry makes the session stop the evaluation before the first
+// expression is evaluated.
+func (s *Session) WithStopOnEntry(yes bool) *Session {
+	s.stopOnEntry = yes
+	return s
+}
+
+// SetBreakpoints replaces the breakpoints of the session. Breakpoints can be
+// set while the evaluation is running.
+func (s *Session) SetBreakpoints(breakpoints []*Breakpoint) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.breakpoints = breakpoints
+}
+
+// Start runs the evaluation in a new goroutine. The eval function must
+// evaluate the query with the session as query tracer and with the context
+// it is called with; the context is canceled when the session is
+// terminated.
+func (s *Session) Start(ctx context.Context, eval func(context.Context) error) {
+	s.mtx.Lock()
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.mtx.Unlock()
+
+	go func() {
+		err := eval(s.ctx)
+		s.mtx.Lock()
+		s.err = err
+		s.stop = nil
+		s.mtx.Unlock()
+		s.cancel()
+		close(s.done)
+	}()
+}
+
+// Wait blocks until the evaluation is stopped or has finished. It returns
+// nil once the evaluation has finished.
+func (s *Session) Wait() *Stop {
+	select {
+	case stop := <-s.stops:
+		return stop
+	case <-s.done:
+		return nil
+	}
+}
+
+// Done returns a channel that is closed once the evaluation has finished.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error returned by the evaluation. It must only be called
+// after the evaluation has finished.
+func (s *Session) Err() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.err
+}
+
+// Stopped returns the current stop, or nil if the evaluation is not stopped.
+func (s *Session) Stopped() *Stop {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.stop
+}
+
+// Resume resumes the stopped evaluation with the action.
+func (s *Session) Resume(action Action) error {
+	s.mtx.Lock()
+	if s.stop == nil {
+		s.mtx.Unlock()
+		return ErrNotStopped
+	}
+	s.stop = nil
+	s.mtx.Unlock()
+
+	select {
+	case s.resume <- action:
+	case <-s.terminated:
+	}
+
+	return nil
+}
+
+// Terminate cancels the evaluation. Breakpoints are no longer hit once the
+// session has been terminated.
+func (s *Session) Terminate() {
+	s.terminate.Do(func() {
+		close(s.terminated)
+		s.mtx.Lock()
+		if s.cancel != nil {
+			s.cancel()
+		}
+		s.mtx.Unlock()
+	})
+}
+
+// Eval evaluates the query in the context of the frame: the local variables
+// of the frame are bound, the input of the evaluation is used and, for
+// frames of rules, the package and imports of the module of the rule apply.
+func (s *Session) Eval(ctx context.Context, frame *Frame, query string) (rego.ResultSet, error) {
+	body, err := ast.ParseBody(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.eval(ctx, frame, body)
+}
+
+func (s *Session) eval(ctx context.Context, frame *Frame, body ast.Body) (rego.ResultSet, error) {
+
+	// Bind the local variables referred to by the query.
+	locals := map[ast.Var]ast.Value{}
+	for _, v := range frame.Locals() {
+		locals[ast.Var(v.Name)] = v.Value
+	}
+
+	query := ast.NewBody()
+	var bound []ast.Var
+
+	ast.WalkVars(body, func(v ast.Var) bool {
+		if value, ok := locals[v]; ok {
+			query.Append(ast.Equality.Expr(ast.NewTerm(v), ast.NewTerm(value)))
+			bound = append(bound, v)
+			delete(locals, v)
+		}
+		return false
+	})
+
+	for _, expr := range body {
+		query.Append(expr)
+	}
+
+	args := []func(*rego.Rego){
+		rego.ParsedQuery(query),
+		rego.Compiler(s.compiler),
+		rego.Store(s.store),
+		rego.Transaction(s.txn),
+	}
+
+	if input := frame.Input(); input != nil {
+		args = append(args, rego.ParsedInput(input))
+	}
+
+	if frame.module != nil {
+		args = append(args,
+			rego.ParsedPackage(frame.module.Package),
+			rego.ParsedImports(frame.module.Imports))
+	}
+
+	rs, err := rego.New(args...).Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hide the bindings of the local variables from the results.
+	for i := range rs {
+		rs[i].Expressions = rs[i].Expressions[len(bound):]
+		for _, v := range bound {
+			delete(rs[i].Bindings, string(v))
+		}
+	}
+
+	return rs, nil
+}
+
+// Enabled always returns true.
+func (*Session) Enabled() bool {
+	return true
+}
+
+// Config returns the tracer configuration. The session requires the local
+// variables to be plugged.
+func (*Session) Config() topdown.TraceConfig {
+	return topdown.TraceConfig{PlugLocalVars: true}
+}
+
+// TraceEvent pauses the evaluation if the event hits a breakpoint or
+// completes a step.
+func (s *Session) TraceEvent(evt topdown.Event) {
+
+	select {
+	case <-s.terminated:
+		return
+	default:
+	}
+
+	s.mtx.Lock()
+
+	q, ok := s.queries[evt.QueryID]
+	if !ok {
+		q = &query{parent: evt.ParentID}
+		s.queries[evt.QueryID] = q
+	}
+	if q.enter == nil && evt.Op == topdown.EnterOp {
+		q.enter = evt.Node
+	}
+	q.last = evt
+
+	// The evaluation is not paused again on the lines of the frames it was
+	// last paused in, e.g., when an expression calls a function and the
+	// function returns, until the frames move on to other lines.
+	if p, ok := s.suppressed[evt.QueryID]; ok && evt.Location != nil &&
+		(p.row != evt.Location.Row || p.file != evt.Location.File) {
+		delete(s.suppressed, evt.QueryID)
+	}
+
+	if !stoppable(evt) {
+		s.mtx.Unlock()
+		return
+	}
+
+	stop := s.check(evt)
+	if stop == nil {
+		s.mtx.Unlock()
+		return
+	}
+
+	s.origin = evt.QueryID
+	s.depth = len(stop.Frames)
+	s.suppressed = make(map[uint64]position, len(stop.Frames))
+	for _, f := range stop.Frames {
+		if f.Location != nil {
+			s.suppressed[f.ID] = position{file: f.Location.File, row: f.Location.Row}
+		}
+	}
+	s.stop = stop
+	s.mtx.Unlock()
+
+	// Discard a stop that the client did not wait for.
+	select {
+	case <-s.stops:
+	default:
+	}
+
+	s.stops <- stop
+
+	select {
+	case action := <-s.resume:
+		s.mtx.Lock()
+		s.action = action
+		s.mtx.Unlock()
+	case <-s.terminated:
+	}
+}
+
+// check returns a stop if the evaluation must be paused at the event.
+func (s *Session) check(evt topdown.Event) *Stop {
+
+	frames := s.frames(evt)
+
+	if !s.entered {
+		s.entered = true
+		s.action = Continue
+		if s.stopOnEntry {
+			return &Stop{Reason: ReasonEntry, Frames: frames}
+		}
+	}
+
+	if _, ok := s.suppressed[evt.QueryID]; ok {
+		return nil
+	}
+
+	for _, b := range s.breakpoints {
+		if !b.matches(evt.Location) {
+			continue
+		}
+		if b.condition == nil {
+			return &Stop{Reason: ReasonBreakpoint, Breakpoint: b, Frames: frames}
+		}
+		rs, err := s.eval(s.ctx, frames[0], b.condition)
+		if err != nil || len(rs) > 0 {
+			return &Stop{Reason: ReasonBreakpoint, Breakpoint: b, Err: err, Frames: frames}
+		}
+	}
+
+	switch s.action {
+	case StepIn:
+		return &Stop{Reason: ReasonStep, Frames: frames}
+	case StepOver:
+		if evt.QueryID == s.origin || len(frames) < s.depth {
+			return &Stop{Reason: ReasonStep, Frames: frames}
+		}
+	case StepOut:
+		if len(frames) < s.depth {
+			return &Stop{Reason: ReasonStep, Frames: frames}
+		}
+	}
+
+	return nil
+}
+
+// frames returns the stack frames for the event, innermost first.
+func (s *Session) frames(evt topdown.Event) []*Frame {
+
+	var frames []*Frame
+	id := evt.QueryID
+
+	for {
+		q, ok := s.queries[id]
+		if !ok {
+			break
+		}
+
+		frame := &Frame{ID: id, Location: q.last.Location, event: q.last}
+		if rule, ok := q.enter.(*ast.Rule); ok {
+			frame.module = rule.Module
+			if rule.Module != nil {
+				frame.Name = rule.Ref().String()
+			} else {
+				frame.Name = rule.Head.Ref().String()
+			}
+		}
+
+		frames = append(frames, frame)
+
+		if id == q.parent {
+			break
+		}
+		id = q.parent
+	}
+
+	// Queries that are not entered with a rule, e.g., the bodies of
+	// comprehensions, are named after the frame they are evaluated in.
+	name := "query"
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].Name == "" {
+			frames[i].Name = name
+		} else {
+			name = frames[i].Name
+		}
+	}
+
+	return frames
+}
+
+// stoppable returns true if the evaluation can be paused at the event. The
+// evaluation is paused before expressions are evaluated and when rules are
+// entered.
+func stoppable(evt topdown.Event) bool {
+	if evt.Location == nil {
+		return false
+	}
+	switch evt.Op {
+	case topdown.EvalOp:
+		_, ok := evt.Node.(*ast.Expr)
+		return ok
+	case topdown.EnterOp:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,331 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const testModule = `package test
+
+allow {
+	x := input.x
+	y := double(x)
+	y > 2
+}
+
+double(a) = b {
+	b := a * 2
+}
+`
+
+type testEval struct {
+	session *Session
+	rs      rego.ResultSet
+}
+
+func startTestEval(t *testing.T, input interface{}, stopOnEntry bool, breakpoints ...*Breakpoint) *testEval {
+	t.Helper()
+
+	ctx := context.Background()
+
+	compiler := ast.MustCompileModules(map[string]string{"/policies/test.rego": testModule})
+	store := inmem.New()
+
+	txn := storage.NewTransactionOrDie(ctx, store)
+	t.Cleanup(func() {
+		store.Abort(ctx, txn)
+	})
+
+	e := &testEval{}
+	e.session = NewSession().
+		WithCompiler(compiler).
+		WithStore(store).
+		WithTransaction(txn).
+		WithStopOnEntry(stopOnEntry)
+	e.session.SetBreakpoints(breakpoints)
+
+	e.session.Start(ctx, func(ctx context.Context) error {
+		var err error
+		e.rs, err = rego.New(
+			rego.Query("data.test.allow"),
+			rego.Compiler(compiler),
+			rego.Store(store),
+			rego.Transaction(txn),
+			rego.Input(input),
+			rego.QueryTracer(e.session),
+		).Eval(ctx)
+		return err
+	})
+
+	return e
+}
+
+func mustBreakpoint(t *testing.T, file string, line int, condition string) *Breakpoint {
+	t.Helper()
+	b, err := NewBreakpoint(file, line, condition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func expectStop(t *testing.T, stop *Stop, reason string, line int, frames ...string) {
+	t.Helper()
+
+	if stop == nil {
+		t.Fatal("Expected evaluation to stop but it finished")
+	}
+
+	if stop.Reason != reason {
+		t.Fatalf("Expected reason %q but got %q", reason, stop.Reason)
+	}
+
+	if stop.Frames[0].Location.Row != line {
+		t.Fatalf("Expected stop at line %d but got %v", line, stop.Frames[0].Location)
+	}
+
+	if len(stop.Frames) != len(frames) {
+		t.Fatalf("Expected %d frames but got %d", len(frames), len(stop.Frames))
+	}
+
+	for i := range frames {
+		if stop.Frames[i].Name != frames[i] {
+			t.Fatalf("Expected frame %d to be %q but got %q", i, frames[i], stop.Frames[i].Name)
+		}
+	}
+}
+
+func expectLocals(t *testing.T, frame *Frame, exp map[string]string) {
+	t.Helper()
+
+	locals := frame.Locals()
+	if len(locals) != len(exp) {
+		t.Fatalf("Expected locals %v but got %v", exp, locals)
+	}
+
+	for _, v := range locals {
+		if exp[v.Name] != v.Value.String() {
+			t.Fatalf("Expected locals %v but got %v", exp, locals)
+		}
+	}
+}
+
+func resume(t *testing.T, s *Session, action Action) *Stop {
+	t.Helper()
+	if err := s.Resume(action); err != nil {
+		t.Fatal(err)
+	}
+	return s.Wait()
+}
+
+func expectResult(t *testing.T, e *testEval, exp interface{}) {
+	t.Helper()
+
+	if stop := e.session.Wait(); stop != nil {
+		t.Fatalf("Expected evaluation to finish but it stopped at %v", stop.Frames[0].Location)
+	}
+
+	if err := e.session.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp == nil {
+		if len(e.rs) != 0 {
+			t.Fatalf("Expected undefined result but got %v", e.rs)
+		}
+		return
+	}
+
+	if len(e.rs) != 1 || e.rs[0].Expressions[0].Value != exp {
+		t.Fatalf("Expected %v but got %v", exp, e.rs)
+	}
+}
+
+func TestSessionBreakpointAndStep(t *testing.T) {
+
+	e := startTestEval(t, map[string]interface{}{"x": 3}, false, mustBreakpoint(t, "test.rego", 5, ""))
+	s := e.session
+
+	stop := s.Wait()
+	expectStop(t, stop, ReasonBreakpoint, 5, "data.test.allow", "query")
+	expectLocals(t, stop.Frames[0], map[string]string{"x": "3"})
+
+	if stop.Frames[0].Input().String() != `{"x": 3}` {
+		t.Fatalf("Unexpected input: %v", stop.Frames[0].Input())
+	}
+
+	// Step into the function.
+	stop = resume(t, s, StepIn)
+	expectStop(t, stop, ReasonStep, 9, "data.test.double", "data.test.allow", "query")
+
+	stop = resume(t, s, StepIn)
+	expectStop(t, stop, ReasonStep, 10, "data.test.double", "data.test.allow", "query")
+	expectLocals(t, stop.Frames[0], map[string]string{"a": "3"})
+
+	// Step out of the function back into the rule.
+	stop = resume(t, s, StepOut)
+	expectStop(t, stop, ReasonStep, 6, "data.test.allow", "query")
+	expectLocals(t, stop.Frames[0], map[string]string{"x": "3", "y": "6"})
+
+	if err := resume(t, s, Continue); err != nil {
+		t.Fatalf("Expected evaluation to finish but it stopped at %v", err.Frames[0].Location)
+	}
+
+	expectResult(t, e, true)
+
+	if err := s.Resume(Continue); err != ErrNotStopped {
+		t.Fatalf("Expected ErrNotStopped but got %v", err)
+	}
+}
+
+func TestSessionStepOver(t *testing.T) {
+
+	e := startTestEval(t, map[string]interface{}{"x": 1}, false, mustBreakpoint(t, "/policies/test.rego", 4, ""))
+	s := e.session
+
+	expectStop(t, s.Wait(), ReasonBreakpoint, 4, "data.test.allow", "query")
+	expectStop(t, resume(t, s, StepOver), ReasonStep, 5, "data.test.allow", "query")
+	expectStop(t, resume(t, s, StepOver), ReasonStep, 6, "data.test.allow", "query")
+
+	// The rule is undefined for the input. Stepping over the last expression
+	// returns to the line of the query the rule was called on, so the
+	// evaluation finishes.
+	if err := s.Resume(StepOver); err != nil {
+		t.Fatal(err)
+	}
+
+	expectResult(t, e, nil)
+}
+
+func TestSessionStopOnEntry(t *testing.T) {
+
+	e := startTestEval(t, map[string]interface{}{"x": 3}, true)
+	s := e.session
+
+	stop := s.Wait()
+	if stop == nil || stop.Reason != ReasonEntry || len(stop.Frames) != 1 || stop.Frames[0].Name != "query" {
+		t.Fatalf("Expected stop on entry but got %+v", stop)
+	}
+
+	expectStop(t, resume(t, s, StepIn), ReasonStep, 3, "data.test.allow", "query")
+
+	if err := s.Resume(Continue); err != nil {
+		t.Fatal(err)
+	}
+
+	expectResult(t, e, true)
+}
+
+func TestSessionConditionalBreakpoint(t *testing.T) {
+
+	tests := []struct {
+		note      string
+		condition string
+		stop      bool
+	}{
+		{note: "condition false", condition: "a > 5"},
+		{note: "condition true", condition: "a == 3", stop: true},
+		{note: "input", condition: "input.x == 3", stop: true},
+		{note: "data", condition: "data.test.allow", stop: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			e := startTestEval(t, map[string]interface{}{"x": 3}, false, mustBreakpoint(t, "test.rego", 10, tc.condition))
+
+			if tc.stop {
+				stop := e.session.Wait()
+				expectStop(t, stop, ReasonBreakpoint, 10, "data.test.double", "data.test.allow", "query")
+				if stop.Err != nil {
+					t.Fatal(stop.Err)
+				}
+				if err := e.session.Resume(Continue); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expectResult(t, e, true)
+		})
+	}
+
+	if _, err := NewBreakpoint("test.rego", 10, "a =="); err == nil {
+		t.Fatal("Expected error for invalid condition")
+	}
+}
+
+func TestSessionEval(t *testing.T) {
+
+	ctx := context.Background()
+
+	e := startTestEval(t, map[string]interface{}{"x": 3}, false, mustBreakpoint(t, "test.rego", 6, ""))
+	s := e.session
+
+	stop := s.Wait()
+	expectStop(t, stop, ReasonBreakpoint, 6, "data.test.allow", "query")
+
+	// Rules are referred to relative to the package of the frame.
+	rs, err := s.Eval(ctx, stop.Frames[0], "z := [x, y, double(input.x)]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []interface{}{json.Number("3"), json.Number("6"), json.Number("6")}
+	if len(rs) != 1 || util.Compare(rs[0].Bindings["z"], exp) != 0 {
+		t.Fatalf("Unexpected result: %v", rs)
+	}
+
+	if err := s.Resume(Continue); err != nil {
+		t.Fatal(err)
+	}
+
+	expectResult(t, e, true)
+}
+
+func TestSessionTerminate(t *testing.T) {
+
+	e := startTestEval(t, map[string]interface{}{"x": 3}, false,
+		mustBreakpoint(t, "test.rego", 4, ""),
+		mustBreakpoint(t, "test.rego", 5, ""))
+	s := e.session
+
+	expectStop(t, s.Wait(), ReasonBreakpoint, 4, "data.test.allow", "query")
+
+	// The evaluation is canceled and breakpoints are no longer hit.
+	s.Terminate()
+
+	if stop := s.Wait(); stop != nil {
+		t.Fatalf("Expected evaluation to finish but it stopped at %v", stop.Frames[0].Location)
+	}
+}
+
+func TestMatchFile(t *testing.T) {
+	tests := []struct {
+		a, b string
+		exp  bool
+	}{
+		{"test.rego", "test.rego", true},
+		{"/policies/test.rego", "test.rego", true},
+		{"test.rego", "/policies/test.rego", true},
+		{"policies/test.rego", "/policies/test.rego", true},
+		{"/policies/test.rego", "/authz/test.rego", false},
+		{"mytest.rego", "test.rego", false},
+		{"", "test.rego", false},
+	}
+
+	for _, tc := range tests {
+		if got := matchFile(tc.a, tc.b); got != tc.exp {
+			t.Errorf("matchFile(%q, %q): expected %v but got %v", tc.a, tc.b, tc.exp, got)
+		}
+	}
+}
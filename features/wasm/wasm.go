@@ -10,7 +10,7 @@ import (
 	"context"
 
 	"github.com/open-policy-agent/opa/internal/rego/opa"
-	wopa "github.com/open-policy-agent/opa/internal/wasm/sdk/opa"
+	wopa "github.com/open-policy-agent/opa/sdk/wasm"
 )
 
 func init() {
@@ -0,0 +1,492 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package inspect
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/internal/jwx/jws"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// Kinds of changes reported by Diff.
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Modified = "modified"
+)
+
+// Diff represents the changes between two bundles. Only the parts of the
+// bundles that changed are set.
+type Diff struct {
+	Manifest   *ManifestDiff   `json:"manifest,omitempty"`
+	Modules    []ModuleDiff    `json:"modules,omitempty"`
+	Data       []Change        `json:"data,omitempty"`
+	Signatures *SignaturesDiff `json:"signatures,omitempty"`
+}
+
+// Empty returns true if the bundles are the same.
+func (d *Diff) Empty() bool {
+	return d.Manifest == nil && len(d.Modules) == 0 && len(d.Data) == 0 && d.Signatures == nil
+}
+
+// ManifestDiff represents the changes to the bundle manifest.
+type ManifestDiff struct {
+	Revision        *StringChange   `json:"revision,omitempty"`
+	Roots           *SetChange      `json:"roots,omitempty"`
+	Metadata        *MetadataChange `json:"metadata,omitempty"`
+	WasmEntrypoints *SetChange      `json:"wasm_entrypoints,omitempty"`
+}
+
+// ModuleDiff represents an added, removed or modified module. The rules are
+// only set for modified modules. Modules can be modified without any rule
+// changes, e.g., if imports were changed.
+type ModuleDiff struct {
+	Path   string   `json:"path"`
+	Change string   `json:"change"`
+	Rules  []Change `json:"rules,omitempty"`
+}
+
+// Change represents an added, removed or modified item, e.g., a data path or
+// a rule.
+type Change struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+}
+
+// StringChange represents a changed value.
+type StringChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// SetChange represents the values added to and removed from a set.
+type SetChange struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// MetadataChange represents changed manifest metadata.
+type MetadataChange struct {
+	Old map[string]interface{} `json:"old"`
+	New map[string]interface{} `json:"new"`
+}
+
+// SignaturesDiff represents the changes to the bundle signatures. The
+// signatures are decoded but not verified. Files lists the files whose signed
+// hashes changed.
+type SignaturesDiff struct {
+	Signed *StringChange `json:"signed,omitempty"`
+	KeyID  *StringChange `json:"keyid,omitempty"`
+	Scope  *StringChange `json:"scope,omitempty"`
+	Issuer *StringChange `json:"iss,omitempty"`
+	Plugin *StringChange `json:"plugin,omitempty"`
+	Files  []Change      `json:"files,omitempty"`
+}
+
+// FileDiff returns the changes between the bundles at oldPath and newPath.
+// Either path may refer to a bundle file or directory.
+func FileDiff(oldPath, newPath string) (*Diff, error) {
+
+	oldBundle, oldInfo, err := load(oldPath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := oldInfo.getBundleDataWasmAndSignatures(oldPath); err != nil {
+		return nil, err
+	}
+
+	newBundle, newInfo, err := load(newPath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := newInfo.getBundleDataWasmAndSignatures(newPath); err != nil {
+		return nil, err
+	}
+
+	d := &Diff{
+		Manifest: diffManifests(oldBundle.Manifest, newBundle.Manifest),
+		Modules:  diffModules(modulesByPath(oldPath, oldBundle), modulesByPath(newPath, newBundle)),
+	}
+
+	diffData(nil, oldBundle.Data, newBundle.Data, &d.Data)
+
+	d.Signatures, err = diffSignatures(oldInfo.Signatures, newInfo.Signatures)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func diffManifests(old, new bundle.Manifest) *ManifestDiff {
+
+	var d ManifestDiff
+	changed := false
+
+	if old.Revision != new.Revision {
+		d.Revision = &StringChange{Old: old.Revision, New: new.Revision}
+		changed = true
+	}
+
+	var oldRoots, newRoots []string
+	if old.Roots != nil {
+		oldRoots = *old.Roots
+	}
+	if new.Roots != nil {
+		newRoots = *new.Roots
+	}
+
+	if d.Roots = diffSets(oldRoots, newRoots); d.Roots != nil {
+		changed = true
+	}
+
+	if util.Compare(old.Metadata, new.Metadata) != 0 {
+		d.Metadata = &MetadataChange{Old: old.Metadata, New: new.Metadata}
+		changed = true
+	}
+
+	if d.WasmEntrypoints = diffSets(wasmEntrypoints(old), wasmEntrypoints(new)); d.WasmEntrypoints != nil {
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return &d
+}
+
+func wasmEntrypoints(m bundle.Manifest) []string {
+	result := make([]string, 0, len(m.WasmResolvers))
+	for _, wr := range m.WasmResolvers {
+		result = append(result, wr.Entrypoint)
+	}
+	return result
+}
+
+func diffSets(old, new []string) *SetChange {
+
+	oldSet := make(map[string]struct{}, len(old))
+	for _, s := range old {
+		oldSet[s] = struct{}{}
+	}
+
+	newSet := make(map[string]struct{}, len(new))
+	for _, s := range new {
+		newSet[s] = struct{}{}
+	}
+
+	var d SetChange
+
+	for s := range newSet {
+		if _, ok := oldSet[s]; !ok {
+			d.Added = append(d.Added, s)
+		}
+	}
+
+	for s := range oldSet {
+		if _, ok := newSet[s]; !ok {
+			d.Removed = append(d.Removed, s)
+		}
+	}
+
+	if len(d.Added) == 0 && len(d.Removed) == 0 {
+		return nil
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+
+	return &d
+}
+
+// modulesByPath returns the modules of b keyed by their path inside of the
+// bundle, so that the modules of bundle files and directories can be compared.
+func modulesByPath(path string, b *bundle.Bundle) map[string]*ast.Module {
+
+	var dir string
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		dir = filepath.Clean(path)
+	}
+
+	result := make(map[string]*ast.Module, len(b.Modules))
+	for _, mf := range b.Modules {
+		p := filepath.Clean(mf.Path)
+		if dir != "" {
+			if rel, err := filepath.Rel(dir, p); err == nil {
+				p = rel
+			}
+		}
+		result[strings.TrimPrefix(filepath.ToSlash(p), "/")] = mf.Parsed
+	}
+
+	return result
+}
+
+func diffModules(old, new map[string]*ast.Module) []ModuleDiff {
+
+	var result []ModuleDiff
+
+	paths := make([]string, 0, len(old)+len(new))
+	for path := range old {
+		paths = append(paths, path)
+	}
+	for path := range new {
+		paths = append(paths, path)
+	}
+
+	for _, path := range sortedUnique(paths) {
+		oldModule, inOld := old[path]
+		newModule, inNew := new[path]
+
+		switch {
+		case !inNew:
+			result = append(result, ModuleDiff{Path: path, Change: Removed})
+		case !inOld:
+			result = append(result, ModuleDiff{Path: path, Change: Added})
+		case !oldModule.Equal(newModule):
+			result = append(result, ModuleDiff{Path: path, Change: Modified, Rules: diffRules(oldModule, newModule)})
+		}
+	}
+
+	return result
+}
+
+// diffRules compares the rules of two modules. Rules are identified by their
+// fully qualified reference, so all definitions of a rule (including default
+// rules and functions) are compared together.
+func diffRules(old, new *ast.Module) []Change {
+
+	oldRules, newRules := rulesByRef(old), rulesByRef(new)
+
+	var result []Change
+
+	names := make([]string, 0, len(oldRules)+len(newRules))
+	for name := range oldRules {
+		names = append(names, name)
+	}
+	for name := range newRules {
+		names = append(names, name)
+	}
+
+	for _, name := range sortedUnique(names) {
+		oldDefs, inOld := oldRules[name]
+		newDefs, inNew := newRules[name]
+
+		switch {
+		case !inNew:
+			result = append(result, Change{Name: name, Change: Removed})
+		case !inOld:
+			result = append(result, Change{Name: name, Change: Added})
+		case !equalRules(oldDefs, newDefs):
+			result = append(result, Change{Name: name, Change: Modified})
+		}
+	}
+
+	return result
+}
+
+func rulesByRef(module *ast.Module) map[string][]*ast.Rule {
+	result := map[string][]*ast.Rule{}
+	for _, rule := range module.Rules {
+		name := rule.Path().String()
+		result[name] = append(result[name], rule)
+	}
+	return result
+}
+
+func equalRules(a, b []*ast.Rule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// diffData appends the changes between old and new to result. Objects are
+// compared key by key, all other values are compared as a whole.
+func diffData(path []string, old, new interface{}, result *[]Change) {
+
+	oldObj, oldIsObj := old.(map[string]interface{})
+	newObj, newIsObj := new.(map[string]interface{})
+
+	if !oldIsObj || !newIsObj {
+		if util.Compare(old, new) != 0 {
+			*result = append(*result, Change{Name: "/" + strings.Join(path, "/"), Change: Modified})
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(oldObj)+len(newObj))
+	for key := range oldObj {
+		keys = append(keys, key)
+	}
+	for key := range newObj {
+		keys = append(keys, key)
+	}
+
+	for _, key := range sortedUnique(keys) {
+		childPath := append(path[:len(path):len(path)], key)
+		oldChild, inOld := oldObj[key]
+		newChild, inNew := newObj[key]
+
+		switch {
+		case !inNew:
+			*result = append(*result, Change{Name: "/" + strings.Join(childPath, "/"), Change: Removed})
+		case !inOld:
+			*result = append(*result, Change{Name: "/" + strings.Join(childPath, "/"), Change: Added})
+		default:
+			diffData(childPath, oldChild, newChild, result)
+		}
+	}
+}
+
+func diffSignatures(old, new bundle.SignaturesConfig) (*SignaturesDiff, error) {
+
+	oldSig, err := decodeSignatures(old)
+	if err != nil {
+		return nil, err
+	}
+
+	newSig, err := decodeSignatures(new)
+	if err != nil {
+		return nil, err
+	}
+
+	var d SignaturesDiff
+	changed := false
+
+	diffString := func(old, new string) *StringChange {
+		if old == new {
+			return nil
+		}
+		changed = true
+		return &StringChange{Old: old, New: new}
+	}
+
+	d.Signed = diffString(signedString(old), signedString(new))
+	d.KeyID = diffString(oldSig.keyID, newSig.keyID)
+	d.Scope = diffString(oldSig.Scope, newSig.Scope)
+	d.Issuer = diffString(oldSig.Issuer, newSig.Issuer)
+	d.Plugin = diffString(old.Plugin, new.Plugin)
+
+	oldFiles, newFiles := oldSig.files(), newSig.files()
+
+	names := make([]string, 0, len(oldFiles)+len(newFiles))
+	for name := range oldFiles {
+		names = append(names, name)
+	}
+	for name := range newFiles {
+		names = append(names, name)
+	}
+
+	for _, name := range sortedUnique(names) {
+		oldFile, inOld := oldFiles[name]
+		newFile, inNew := newFiles[name]
+
+		switch {
+		case !inNew:
+			d.Files = append(d.Files, Change{Name: name, Change: Removed})
+		case !inOld:
+			d.Files = append(d.Files, Change{Name: name, Change: Added})
+		case oldFile.Hash != newFile.Hash || oldFile.Algorithm != newFile.Algorithm:
+			d.Files = append(d.Files, Change{Name: name, Change: Modified})
+		}
+	}
+
+	if !changed && len(d.Files) == 0 {
+		return nil, nil
+	}
+
+	return &d, nil
+}
+
+func signedString(sc bundle.SignaturesConfig) string {
+	if len(sc.Signatures) == 0 {
+		return "no"
+	}
+	return "yes"
+}
+
+type decodedSignature struct {
+	bundle.DecodedSignature
+	keyID string
+}
+
+func (ds decodedSignature) files() map[string]bundle.FileInfo {
+	result := make(map[string]bundle.FileInfo, len(ds.Files))
+	for _, f := range ds.Files {
+		result[f.Name] = f
+	}
+	return result
+}
+
+// decodeSignatures decodes the (first) signature of a bundle without verifying
+// it, since only the claims are compared.
+func decodeSignatures(sc bundle.SignaturesConfig) (decodedSignature, error) {
+
+	var result decodedSignature
+
+	if len(sc.Signatures) == 0 {
+		return result, nil
+	}
+
+	parts, err := jws.SplitCompact(sc.Signatures[0])
+	if err != nil {
+		return result, err
+	}
+
+	bs, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return result, err
+	}
+
+	var hdr jws.StandardHeaders
+	if err := json.Unmarshal(bs, &hdr); err != nil {
+		return result, err
+	}
+
+	bs, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return result, err
+	}
+
+	if err := json.Unmarshal(bs, &result.DecodedSignature); err != nil {
+		return result, err
+	}
+
+	result.keyID = hdr.KeyID
+	if result.keyID == "" {
+		result.keyID = result.KeyID
+	}
+
+	return result, nil
+}
+
+// sortedUnique sorts the strings and removes duplicates in place.
+func sortedUnique(strs []string) []string {
+	sort.Strings(strs)
+	result := strs[:0]
+	for i, s := range strs {
+		if i == 0 || s != strs[i-1] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package inspect
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/util"
+	"github.com/open-policy-agent/opa/util/test"
+)
+
+func TestFileDiff(t *testing.T) {
+
+	files := map[string]string{
+		"/old/.manifest":      `{"revision": "v1", "roots": ["a", "c"], "metadata": {"owner": "x"}}`,
+		"/old/a/data.json":    `{"b": 1, "c": {"d": true}, "e": [1]}`,
+		"/old/a/policy.rego":  "package a\np = 1\nq { input.x }\ndefault r = false\nr { input.y }",
+		"/old/c/c.rego":       "package c\nx = 1",
+		"/new/.manifest":      `{"revision": "v2", "roots": ["a", "d"], "metadata": {"owner": "x"}}`,
+		"/new/a/data.json":    `{"b": 2, "c": {"f": null}, "e": [1]}`,
+		"/new/a/policy.rego":  "package a\n\np = 1\n\nq { input.z }\n\ndefault r = false\n\ns = 2\n",
+		"/new/d/d.rego":       "package d\ny = 1",
+		"/same/.manifest":     `{"revision": "v1", "roots": ["a", "c"], "metadata": {"owner": "x"}}`,
+		"/same/a/data.json":   `{"e": [1.0], "c": {"d": true}, "b": 1}`,
+		"/same/a/policy.rego": "package a\n\np = 1\n\nq {\n\tinput.x\n}\n\ndefault r = false\n\nr {\n\tinput.y\n}\n",
+		"/same/c/c.rego":      "package c\n\nx = 1\n",
+	}
+
+	test.WithTempFS(files, func(rootDir string) {
+
+		d, err := FileDiff(filepath.Join(rootDir, "old"), filepath.Join(rootDir, "new"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := `{
+			"manifest": {
+				"revision": {"old": "v1", "new": "v2"},
+				"roots": {"added": ["d"], "removed": ["c"]}
+			},
+			"modules": [
+				{"path": "a/policy.rego", "change": "modified", "rules": [
+					{"name": "data.a.q", "change": "modified"},
+					{"name": "data.a.r", "change": "modified"},
+					{"name": "data.a.s", "change": "added"}
+				]},
+				{"path": "c/c.rego", "change": "removed"},
+				{"path": "d/d.rego", "change": "added"}
+			],
+			"data": [
+				{"name": "/a/b", "change": "modified"},
+				{"name": "/a/c/d", "change": "removed"},
+				{"name": "/a/c/f", "change": "added"}
+			]
+		}`
+
+		assertDiff(t, d, exp)
+
+		// Formatting changes and the order of keys are not reported.
+		d, err = FileDiff(filepath.Join(rootDir, "old"), filepath.Join(rootDir, "same"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !d.Empty() {
+			t.Fatalf("expected no changes but got %v", string(util.MustMarshalJSON(d)))
+		}
+	})
+}
+
+func TestFileDiffSignatures(t *testing.T) {
+
+	module := "package a\np = 1"
+
+	b := bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: "v1", Roots: &[]string{"a"}},
+		Data:     map[string]interface{}{"a": map[string]interface{}{"x": 1}},
+		Modules: []bundle.ModuleFile{
+			{URL: "/a/policy.rego", Path: "/a/policy.rego", Raw: []byte(module), Parsed: ast.MustParseModule(module)},
+		},
+	}
+
+	test.WithTempFS(nil, func(rootDir string) {
+
+		write := func(name string, b bundle.Bundle) string {
+			var buf bytes.Buffer
+			if err := bundle.NewWriter(&buf).Write(b); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(rootDir, name)
+			if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			return path
+		}
+
+		unsigned := write("unsigned.tar.gz", b)
+
+		if err := b.GenerateSignature(bundle.NewSigningConfig("secret", "HS256", ""), "foo", false); err != nil {
+			t.Fatal(err)
+		}
+
+		signed := write("signed.tar.gz", b)
+
+		b.Data = map[string]interface{}{"a": map[string]interface{}{"x": 2}}
+		if err := b.GenerateSignature(bundle.NewSigningConfig("secret", "HS256", ""), "bar", false); err != nil {
+			t.Fatal(err)
+		}
+
+		resigned := write("resigned.tar.gz", b)
+
+		d, err := FileDiff(unsigned, signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertDiff(t, d, `{
+			"signatures": {
+				"signed": {"old": "no", "new": "yes"},
+				"keyid": {"old": "", "new": "foo"},
+				"plugin": {"old": "", "new": "_default"},
+				"files": [
+					{"name": ".manifest", "change": "added"},
+					{"name": "a/policy.rego", "change": "added"},
+					{"name": "data.json", "change": "added"}
+				]
+			}
+		}`)
+
+		d, err = FileDiff(signed, resigned)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertDiff(t, d, `{
+			"data": [{"name": "/a/x", "change": "modified"}],
+			"signatures": {
+				"keyid": {"old": "foo", "new": "bar"},
+				"files": [{"name": "data.json", "change": "modified"}]
+			}
+		}`)
+	})
+}
+
+func assertDiff(t *testing.T, d *Diff, exp string) {
+	t.Helper()
+	expected := util.MustUnmarshalJSON([]byte(exp))
+	if actual := util.MustUnmarshalJSON(util.MustMarshalJSON(d)); util.Compare(expected, actual) != 0 {
+		t.Fatalf("expected diff:\n\n%v\n\ngot:\n\n%v", string(util.MustMarshalJSON(expected)), string(util.MustMarshalJSON(actual)))
+	}
+}
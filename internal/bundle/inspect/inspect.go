@@ -29,6 +29,12 @@ type Info struct {
 }
 
 func File(path string, includeAnnotations bool) (*Info, error) {
+	_, bi, err := load(path, includeAnnotations)
+	return bi, err
+}
+
+// load returns the bundle at path along with its information.
+func load(path string, includeAnnotations bool) (*bundle.Bundle, *Info, error) {
 	b, err := loader.NewFileLoader().
 		WithSkipBundleVerification(true).
 		WithProcessAnnotation(true). // Always process annotations, for enriching namespace listing
@@ -42,7 +48,7 @@ func File(path string, includeAnnotations bool) (*Info, error) {
 		}).
 		AsBundle(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	bi := &Info{Manifest: b.Manifest}
@@ -58,7 +64,7 @@ func File(path string, includeAnnotations bool) (*Info, error) {
 	if includeAnnotations {
 		as, errs := ast.BuildAnnotationSet(modules)
 		if len(errs) > 0 {
-			return nil, errs
+			return nil, nil, errs
 		}
 		flattened := as.Flatten()
 
@@ -66,7 +72,7 @@ func File(path string, includeAnnotations bool) (*Info, error) {
 			if as := wr.Annotations; len(as) > 0 {
 				path, err := ast.PtrRef(ast.DefaultRootDocument, wr.Entrypoint)
 				if err != nil {
-					return nil, fmt.Errorf("failed to parse Wasm entrypoint in manifest: %s", err)
+					return nil, nil, fmt.Errorf("failed to parse Wasm entrypoint in manifest: %s", err)
 				}
 				for _, a := range as {
 					ar := ast.NewAnnotationsRef(a)
@@ -82,7 +88,7 @@ func File(path string, includeAnnotations bool) (*Info, error) {
 
 	err = bi.getBundleDataWasmAndSignatures(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	wasmModules := make([]map[string]interface{}, 0, len(b.WasmModules))
@@ -102,7 +108,7 @@ func File(path string, includeAnnotations bool) (*Info, error) {
 	}
 	bi.WasmModules = wasmModules
 
-	return bi, nil
+	return b, bi, nil
 }
 
 func (bi *Info) getBundleDataWasmAndSignatures(name string) error {
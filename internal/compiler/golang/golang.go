@@ -0,0 +1,764 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package golang contains an IR->Go source code compiler backend. The
+// generated package evaluates the plans of the policy with the runtime in
+// sdk/golang.
+//
+// Each plan and function is compiled into a Go function. Locals are elements
+// of an array of values, undefined locals are nil. The blocks of the IR are
+// not translated into Go blocks: a break out of a block is a goto to a label
+// at its end, or a continue of the loop that implements a scan statement.
+// The nesting of blocks mirrors the wasm backend so that break indices have
+// the same meaning.
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ir"
+)
+
+const runtimePkg = "github.com/open-policy-agent/opa/sdk/golang"
+
+// Compiler implements an IR->Go source code compiler backend.
+type Compiler struct {
+	policy   *ir.Policy
+	pkg      string
+	data     []byte
+	funcs    map[string]int // function name -> index
+	builtins map[string]int // built-in function name -> index
+}
+
+// New returns a new compiler object.
+func New() *Compiler {
+	return &Compiler{
+		pkg: "policy",
+	}
+}
+
+// WithPolicy sets the policy to compile.
+func (c *Compiler) WithPolicy(p *ir.Policy) *Compiler {
+	c.policy = p
+	return c
+}
+
+// WithPackage sets the name of the generated package. Defaults to "policy".
+func (c *Compiler) WithPackage(name string) *Compiler {
+	c.pkg = name
+	return c
+}
+
+// WithData sets the JSON serialized base document embedded in the generated
+// package.
+func (c *Compiler) WithData(bs []byte) *Compiler {
+	c.data = bs
+	return c
+}
+
+// Compile returns the formatted source code of the generated package.
+func (c *Compiler) Compile() ([]byte, error) {
+
+	if !token.IsIdentifier(c.pkg) {
+		return nil, fmt.Errorf("invalid package name: %q", c.pkg)
+	}
+
+	c.funcs = map[string]int{}
+	c.builtins = map[string]int{}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by opa build -t go. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", c.pkg)
+	fmt.Fprintf(&buf, "import (\n%q\n%q\n)\n\n", "github.com/open-policy-agent/opa/ast", runtimePkg)
+
+	for i, fn := range c.funcList() {
+		c.funcs[fn.Name] = i
+	}
+
+	if c.policy.Static != nil {
+		for i, bi := range c.policy.Static.BuiltinFuncs {
+			c.builtins[bi.Name] = i
+		}
+	}
+
+	c.emitNew(&buf)
+	c.emitStrings(&buf)
+
+	if c.policy.Plans != nil {
+		for i, plan := range c.policy.Plans.Plans {
+			if err := c.emitPlan(&buf, i, plan); err != nil {
+				return nil, fmt.Errorf("plan %v: %w", plan.Name, err)
+			}
+		}
+	}
+
+	for i, fn := range c.funcList() {
+		if err := c.emitFunc(&buf, i, fn); err != nil {
+			return nil, fmt.Errorf("function %v: %w", fn.Name, err)
+		}
+	}
+
+	bs, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+
+	return bs, nil
+}
+
+func (c *Compiler) funcList() []*ir.Func {
+	if c.policy.Funcs == nil {
+		return nil
+	}
+	return c.policy.Funcs.Funcs
+}
+
+func (c *Compiler) emitNew(buf *bytes.Buffer) {
+
+	fmt.Fprintf(buf, "// New returns a new instance of the compiled policy.\n")
+	fmt.Fprintf(buf, "func New() *golang.Policy {\n")
+	fmt.Fprintf(buf, "return golang.NewPolicy(golang.Compiled{\n")
+
+	fmt.Fprintf(buf, "Entrypoints: []golang.Entrypoint{\n")
+	if c.policy.Plans != nil {
+		for i, plan := range c.policy.Plans.Plans {
+			fmt.Fprintf(buf, "{Name: %q, Eval: plan%d},\n", plan.Name, i)
+		}
+	}
+	fmt.Fprintf(buf, "},\n")
+
+	fmt.Fprintf(buf, "Funcs: []golang.MappedFunc{\n")
+	for i, fn := range c.funcList() {
+		if len(fn.Path) == 0 || len(fn.Params) != 2 {
+			continue
+		}
+		path := make([]string, len(fn.Path))
+		for j := range fn.Path {
+			path[j] = strconv.Quote(fn.Path[j])
+		}
+		fmt.Fprintf(buf, "{Path: []string{%s}, Func: f%d},\n", strings.Join(path, ", "), i)
+	}
+	fmt.Fprintf(buf, "},\n")
+
+	fmt.Fprintf(buf, "Builtins: []string{\n")
+	if c.policy.Static != nil {
+		for _, bi := range c.policy.Static.BuiltinFuncs {
+			fmt.Fprintf(buf, "%q,\n", bi.Name)
+		}
+	}
+	fmt.Fprintf(buf, "},\n")
+
+	if len(c.data) > 0 {
+		fmt.Fprintf(buf, "Data: %q,\n", c.data)
+	}
+
+	fmt.Fprintf(buf, "})\n}\n\n")
+}
+
+func (c *Compiler) emitStrings(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "var strs = [...]ast.Value{\n")
+	if c.policy.Static != nil {
+		for _, s := range c.policy.Static.Strings {
+			fmt.Fprintf(buf, "ast.String(%q),\n", s.Value)
+		}
+	}
+	fmt.Fprintf(buf, "}\n\n")
+}
+
+func (c *Compiler) emitPlan(buf *bytes.Buffer, index int, plan *ir.Plan) error {
+
+	f := &function{c: c, memo: -1, nlocal: int(ir.Data) + 1}
+
+	var body bytes.Buffer
+
+	for _, block := range plan.Blocks {
+		if _, err := f.block(&body, block); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(buf, "// plan%d evaluates the %q entrypoint.\n", index, plan.Name)
+	fmt.Fprintf(buf, "func plan%d(c *golang.Context, input, data ast.Value) {\n", index)
+	f.emitLocals(buf)
+	fmt.Fprintf(buf, "l[%d], l[%d] = input, data\n", ir.Input, ir.Data)
+	buf.Write(body.Bytes())
+	fmt.Fprintf(buf, "}\n\n")
+
+	return nil
+}
+
+func (c *Compiler) emitFunc(buf *bytes.Buffer, index int, fn *ir.Func) error {
+
+	if len(fn.Params) == 0 {
+		return fmt.Errorf("illegal function: zero args")
+	}
+
+	f := &function{c: c, memo: -1}
+
+	// Rules (functions of the input and data only) are memoized, like in the
+	// wasm backend.
+	if len(fn.Params) == 2 {
+		f.memo = index
+	}
+
+	params := make([]string, len(fn.Params))
+	locals := make([]string, len(fn.Params))
+	for i := range fn.Params {
+		params[i] = fmt.Sprintf("a%d", i)
+		locals[i] = f.local(fn.Params[i])
+	}
+
+	ret := f.local(fn.Return)
+
+	var body bytes.Buffer
+	var done bool
+
+	for _, block := range fn.Blocks {
+		var err error
+		if done, err = f.block(&body, block); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(buf, "// f%d implements %v.\n", index, fn.Name)
+	fmt.Fprintf(buf, "func f%d(c *golang.Context, %s ast.Value) ast.Value {\n", index, strings.Join(params, ", "))
+	if f.memo >= 0 {
+		fmt.Fprintf(buf, "if v, ok := c.Memo(%d); ok {\nreturn v\n}\n", f.memo)
+	}
+	f.emitLocals(buf)
+	fmt.Fprintf(buf, "%s = %s\n", strings.Join(locals, ", "), strings.Join(params, ", "))
+	buf.Write(body.Bytes())
+	if !done {
+		fmt.Fprintf(buf, "return %s\n", ret)
+	}
+	fmt.Fprintf(buf, "}\n\n")
+
+	return nil
+}
+
+func (c *Compiler) location(loc *ir.Location) string {
+	var file string
+	if c.policy.Static != nil && loc.File >= 0 && loc.File < len(c.policy.Static.Files) {
+		file = c.policy.Static.Files[loc.File].Value
+	}
+	return fmt.Sprintf("%q, %d, %d", file, loc.Row, loc.Col)
+}
+
+// function holds the state of the compilation of a plan or function.
+type function struct {
+	c      *Compiler
+	memo   int // index to memoize the result with, or -1
+	nlocal int
+	ntemp  int
+	nlabel int
+	levels []*level
+}
+
+// level is a block that can be broken out of.
+type level struct {
+	label string
+	loop  bool // breaking out of the loop body continues the loop
+	used  bool
+}
+
+func (f *function) emitLocals(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "var l [%d]ast.Value\n", f.nlocal)
+	if f.ntemp > 0 {
+		fmt.Fprintf(buf, "var t [%d]ast.Value\n", f.ntemp)
+	}
+}
+
+func (f *function) push(loop bool) *level {
+	lv := &level{label: fmt.Sprintf("L%d", f.nlabel), loop: loop}
+	f.nlabel++
+	f.levels = append(f.levels, lv)
+	return lv
+}
+
+func (f *function) pop() {
+	f.levels = f.levels[:len(f.levels)-1]
+}
+
+// jump returns the statement that breaks out of the level with the given
+// index, counting from the innermost level.
+func (f *function) jump(index uint32) (string, error) {
+	if int(index) >= len(f.levels) {
+		return "", fmt.Errorf("illegal break index: %d", index)
+	}
+	lv := f.levels[len(f.levels)-1-int(index)]
+	lv.used = true
+	if lv.loop {
+		return "continue " + lv.label, nil
+	}
+	return "goto " + lv.label, nil
+}
+
+func (f *function) local(l ir.Local) string {
+	if int(l) >= f.nlocal {
+		f.nlocal = int(l) + 1
+	}
+	return fmt.Sprintf("l[%d]", l)
+}
+
+func (f *function) temp() string {
+	f.ntemp++
+	return fmt.Sprintf("t[%d]", f.ntemp-1)
+}
+
+func (f *function) operand(op ir.Operand) (string, error) {
+	switch v := op.Value.(type) {
+	case ir.Local:
+		return f.local(v), nil
+	case ir.StringIndex:
+		return fmt.Sprintf("strs[%d]", v), nil
+	case ir.Bool:
+		return fmt.Sprintf("ast.Boolean(%v)", bool(v)), nil
+	}
+	return "", fmt.Errorf("illegal operand: %v", op.Value)
+}
+
+func (f *function) operands(ops []ir.Operand) (string, error) {
+	strs := make([]string, len(ops))
+	for i := range ops {
+		var err error
+		if strs[i], err = f.operand(ops[i]); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(strs, ", "), nil
+}
+
+// block compiles a block. It returns true if the end of the block cannot be
+// reached.
+func (f *function) block(buf *bytes.Buffer, block *ir.Block) (bool, error) {
+	lv := f.push(false)
+	done, err := f.stmts(buf, block.Stmts)
+	f.pop()
+	if err != nil {
+		return false, err
+	}
+	if lv.used {
+		fmt.Fprintf(buf, "%s:\n", lv.label)
+		return false, nil
+	}
+	return done, nil
+}
+
+// stmts compiles a sequence of statements. Statements following an
+// unconditional break or return are not compiled.
+func (f *function) stmts(buf *bytes.Buffer, stmts []ir.Stmt) (bool, error) {
+	for _, stmt := range stmts {
+		done, err := f.stmt(buf, stmt)
+		if err != nil {
+			return false, err
+		}
+		if done {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// undefined emits a conditional break out of the current block.
+func (f *function) undefined(buf *bytes.Buffer, cond string) error {
+	j, err := f.jump(0)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(buf, "if %s {\n%s\n}\n", cond, j)
+	return nil
+}
+
+// stmt compiles a statement. It returns true if the statement always breaks
+// out of the current block or returns.
+func (f *function) stmt(buf *bytes.Buffer, stmt ir.Stmt) (bool, error) {
+	switch stmt := stmt.(type) {
+	case *ir.ResultSetAddStmt:
+		fmt.Fprintf(buf, "c.Result(%s)\n", f.local(stmt.Value))
+	case *ir.ReturnLocalStmt:
+		if f.memo >= 0 {
+			fmt.Fprintf(buf, "return c.Memoize(%d, %s)\n", f.memo, f.local(stmt.Source))
+		} else {
+			fmt.Fprintf(buf, "return %s\n", f.local(stmt.Source))
+		}
+		return true, nil
+	case *ir.BlockStmt:
+		for _, block := range stmt.Blocks {
+			done, err := f.block(buf, block)
+			if err != nil || done {
+				return done, err
+			}
+		}
+	case *ir.BreakStmt:
+		j, err := f.jump(stmt.Index)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintln(buf, j)
+		return true, nil
+	case *ir.CallStmt:
+		return false, f.call(buf, stmt)
+	case *ir.CallDynamicStmt:
+		return false, f.callDynamic(buf, stmt)
+	case *ir.WithStmt:
+		return f.with(buf, stmt)
+	case *ir.AssignVarStmt:
+		src, err := f.operand(stmt.Source)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(buf, "%s = %s\n", f.local(stmt.Target), src)
+	case *ir.AssignVarOnceStmt:
+		src, err := f.operand(stmt.Source)
+		if err != nil {
+			return false, err
+		}
+		target := f.local(stmt.Target)
+		fmt.Fprintf(buf, "if %s != nil && !golang.Equal(%s, %s) {\nc.Conflict(%q, %s)\n}\n", target, target, src, "var assignment conflict", f.c.location(&stmt.Location))
+		fmt.Fprintf(buf, "%s = %s\n", target, src)
+	case *ir.AssignIntStmt:
+		fmt.Fprintf(buf, "%s = ast.Number(%q)\n", f.local(stmt.Target), strconv.FormatInt(stmt.Value, 10))
+	case *ir.ScanStmt:
+		return false, f.scan(buf, stmt)
+	case *ir.NopStmt:
+	case *ir.NotStmt:
+		return f.not(buf, stmt)
+	case *ir.DotStmt:
+		source, ok := stmt.Source.Value.(ir.Local)
+		if !ok {
+			// Lookups on scalar constants are always undefined.
+			j, err := f.jump(0)
+			if err != nil {
+				return false, err
+			}
+			fmt.Fprintln(buf, j)
+			return true, nil
+		}
+		key, err := f.operand(stmt.Key)
+		if err != nil {
+			return false, err
+		}
+		target := f.local(stmt.Target)
+		cond := fmt.Sprintf("%s = golang.Dot(%s, %s); %s == nil", target, f.local(source), key, target)
+		return false, f.undefined(buf, cond)
+	case *ir.LenStmt:
+		src, err := f.operand(stmt.Source)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(buf, "%s = golang.Len(%s)\n", f.local(stmt.Target), src)
+	case *ir.EqualStmt:
+		if stmt.A == stmt.B {
+			break
+		}
+		ops, err := f.operands([]ir.Operand{stmt.A, stmt.B})
+		if err != nil {
+			return false, err
+		}
+		return false, f.undefined(buf, fmt.Sprintf("!golang.Equal(%s)", ops))
+	case *ir.NotEqualStmt:
+		if stmt.A == stmt.B {
+			j, err := f.jump(0)
+			if err != nil {
+				return false, err
+			}
+			fmt.Fprintln(buf, j)
+			return true, nil
+		}
+		if constants(stmt.A, stmt.B) {
+			// Distinct constants of the same type are not equal.
+			break
+		}
+		ops, err := f.operands([]ir.Operand{stmt.A, stmt.B})
+		if err != nil {
+			return false, err
+		}
+		return false, f.undefined(buf, fmt.Sprintf("golang.Equal(%s)", ops))
+	case *ir.MakeNullStmt:
+		fmt.Fprintf(buf, "%s = ast.Null{}\n", f.local(stmt.Target))
+	case *ir.MakeNumberIntStmt:
+		fmt.Fprintf(buf, "%s = ast.Number(%q)\n", f.local(stmt.Target), strconv.FormatInt(stmt.Value, 10))
+	case *ir.MakeNumberRefStmt:
+		if f.c.policy.Static == nil || stmt.Index < 0 || stmt.Index >= len(f.c.policy.Static.Strings) {
+			return false, fmt.Errorf("illegal number reference: %d", stmt.Index)
+		}
+		fmt.Fprintf(buf, "%s = ast.Number(%q)\n", f.local(stmt.Target), f.c.policy.Static.Strings[stmt.Index].Value)
+	case *ir.MakeArrayStmt:
+		fmt.Fprintf(buf, "%s = golang.NewArray(%d)\n", f.local(stmt.Target), stmt.Capacity)
+	case *ir.MakeObjectStmt:
+		fmt.Fprintf(buf, "%s = ast.NewObject()\n", f.local(stmt.Target))
+	case *ir.MakeSetStmt:
+		fmt.Fprintf(buf, "%s = ast.NewSet()\n", f.local(stmt.Target))
+	case *ir.IsArrayStmt:
+		return f.isType(buf, stmt.Source, "*ast.Array")
+	case *ir.IsObjectStmt:
+		return f.isType(buf, stmt.Source, "ast.Object")
+	case *ir.IsDefinedStmt:
+		return false, f.undefined(buf, f.local(stmt.Source)+" == nil")
+	case *ir.IsUndefinedStmt:
+		return false, f.undefined(buf, f.local(stmt.Source)+" != nil")
+	case *ir.ResetLocalStmt:
+		fmt.Fprintf(buf, "%s = nil\n", f.local(stmt.Target))
+	case *ir.ArrayAppendStmt:
+		value, err := f.operand(stmt.Value)
+		if err != nil {
+			return false, err
+		}
+		array := f.local(stmt.Array)
+		fmt.Fprintf(buf, "%s = golang.Append(%s, %s)\n", array, array, value)
+	case *ir.ObjectInsertStmt:
+		ops, err := f.operands([]ir.Operand{stmt.Key, stmt.Value})
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(buf, "golang.Insert(%s, %s)\n", f.local(stmt.Object), ops)
+	case *ir.ObjectInsertOnceStmt:
+		key, err := f.operand(stmt.Key)
+		if err != nil {
+			return false, err
+		}
+		value, err := f.operand(stmt.Value)
+		if err != nil {
+			return false, err
+		}
+		object := f.local(stmt.Object)
+		fmt.Fprintf(buf, "if v := golang.Dot(%s, %s); v != nil && !golang.Equal(v, %s) {\nc.Conflict(%q, %s)\n}\n", object, key, value, "object insert conflict", f.c.location(&stmt.Location))
+		fmt.Fprintf(buf, "golang.Insert(%s, %s, %s)\n", object, key, value)
+	case *ir.ObjectMergeStmt:
+		fmt.Fprintf(buf, "%s = golang.Merge(%s, %s)\n", f.local(stmt.Target), f.local(stmt.A), f.local(stmt.B))
+	case *ir.SetAddStmt:
+		value, err := f.operand(stmt.Value)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(buf, "golang.Add(%s, %s)\n", f.local(stmt.Set), value)
+	default:
+		var b bytes.Buffer
+		if err := ir.Pretty(&b, stmt); err != nil {
+			return false, err
+		}
+		return false, fmt.Errorf("illegal statement: %v", b.String())
+	}
+
+	return false, nil
+}
+
+// constants returns true if a and b are both boolean or both string
+// constants.
+func constants(a, b ir.Operand) bool {
+	switch a.Value.(type) {
+	case ir.Bool:
+		_, ok := b.Value.(ir.Bool)
+		return ok
+	case ir.StringIndex:
+		_, ok := b.Value.(ir.StringIndex)
+		return ok
+	}
+	return false
+}
+
+func (f *function) isType(buf *bytes.Buffer, op ir.Operand, tpe string) (bool, error) {
+	source, ok := op.Value.(ir.Local)
+	if !ok {
+		j, err := f.jump(0)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintln(buf, j)
+		return true, nil
+	}
+	return false, f.undefined(buf, fmt.Sprintf("_, ok := %s.(%s); !ok", f.local(source), tpe))
+}
+
+func (f *function) call(buf *bytes.Buffer, stmt *ir.CallStmt) error {
+
+	args, err := f.operands(stmt.Args)
+	if err != nil {
+		return err
+	}
+
+	result := f.local(stmt.Result)
+
+	if index, ok := f.c.funcs[stmt.Func]; ok {
+		return f.undefined(buf, fmt.Sprintf("%s = f%d(c, %s); %s == nil", result, index, args, result))
+	}
+
+	index, ok := f.c.builtins[stmt.Func]
+	if !ok {
+		return fmt.Errorf("undefined function: %q", stmt.Func)
+	}
+
+	if len(args) > 0 {
+		args = ", " + args
+	}
+
+	if decl := f.c.policy.Static.BuiltinFuncs[index].Decl; decl != nil && decl.Result() == nil {
+		fmt.Fprintf(buf, "c.Call(%d%s)\n", index, args)
+		return nil
+	}
+
+	return f.undefined(buf, fmt.Sprintf("%s = c.Call(%d%s); %s == nil", result, index, args, result))
+}
+
+func (f *function) callDynamic(buf *bytes.Buffer, stmt *ir.CallDynamicStmt) error {
+
+	if len(stmt.Args) != 2 {
+		return fmt.Errorf("illegal dynamic call: %d args", len(stmt.Args))
+	}
+
+	path, err := f.operands(stmt.Path)
+	if err != nil {
+		return err
+	}
+
+	// If the path does not refer to a function, break out of the current
+	// block, otherwise an undefined result breaks out of three blocks (see
+	// the planner.)
+	notFound, err := f.jump(0)
+	if err != nil {
+		return err
+	}
+
+	undefined, err := f.jump(3)
+	if err != nil {
+		return err
+	}
+
+	result := f.local(stmt.Result)
+
+	fmt.Fprintf(buf, "if fn := c.Lookup(%s); fn == nil {\n%s\n} else if %s = fn(c, %s, %s); %s == nil {\n%s\n}\n",
+		path, notFound, result, f.local(stmt.Args[0]), f.local(stmt.Args[1]), result, undefined)
+
+	return nil
+}
+
+func (f *function) scan(buf *bytes.Buffer, scan *ir.ScanStmt) error {
+
+	// Breaking out of the loop body continues with the next element, breaking
+	// out of the enclosing level ends the scan.
+	exit := f.push(false)
+	loop := f.push(true)
+
+	var body bytes.Buffer
+	_, err := f.stmts(&body, scan.Block.Stmts)
+	f.pop()
+	f.pop()
+	if err != nil {
+		return err
+	}
+
+	if loop.used {
+		fmt.Fprintf(buf, "%s:\n", loop.label)
+	}
+
+	fmt.Fprintf(buf, "for it := c.Iter(%s); it.Next(); {\n", f.local(scan.Source))
+	fmt.Fprintf(buf, "%s, %s = it.Key(), it.Value()\n", f.local(scan.Key), f.local(scan.Value))
+	buf.Write(body.Bytes())
+	fmt.Fprintf(buf, "}\n")
+
+	if exit.used {
+		fmt.Fprintf(buf, "%s:\n", exit.label)
+	}
+
+	return nil
+}
+
+func (f *function) not(buf *bytes.Buffer, not *ir.NotStmt) (bool, error) {
+
+	lv := f.push(false)
+	done, err := f.stmts(buf, not.Block.Stmts)
+	f.pop()
+	if err != nil {
+		return false, err
+	}
+
+	// If the end of the negated block is reached, the statement is undefined.
+	if !done {
+		j, err := f.jump(0)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintln(buf, j)
+	}
+
+	if !lv.used {
+		return true, nil
+	}
+
+	fmt.Fprintf(buf, "%s:\n", lv.label)
+	return false, nil
+}
+
+func (f *function) with(buf *bytes.Buffer, with *ir.WithStmt) (bool, error) {
+
+	value, err := f.operand(with.Value)
+	if err != nil {
+		return false, err
+	}
+
+	local := f.local(with.Local)
+	save := f.temp()
+
+	fmt.Fprintf(buf, "%s = %s\n", save, local)
+	fmt.Fprintf(buf, "c.PushMemo()\n")
+
+	if len(with.Path) == 0 {
+		fmt.Fprintf(buf, "%s = %s\n", local, value)
+	} else {
+		path := make([]ir.Operand, len(with.Path))
+		for i := range with.Path {
+			path[i] = ir.Operand{Value: ir.StringIndex(with.Path[i])}
+		}
+		ops, err := f.operands(path)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(buf, "%s = golang.Upsert(%s, %s, %s)\n", local, local, value, ops)
+	}
+
+	lv := f.push(false)
+	done, err := f.stmts(buf, with.Block.Stmts)
+	f.pop()
+	if err != nil {
+		return false, err
+	}
+
+	restore := fmt.Sprintf("%s = %s\nc.PopMemo()\n", local, save)
+
+	if !done {
+		buf.WriteString(restore)
+	}
+
+	if !lv.used {
+		return done, nil
+	}
+
+	// If the block is undefined, restore the local and break out of the
+	// current block.
+	var end string
+	if !done {
+		end = fmt.Sprintf("L%d", f.nlabel)
+		f.nlabel++
+		fmt.Fprintf(buf, "goto %s\n", end)
+	}
+
+	j, err := f.jump(0)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(buf, "%s:\n%s%s\n", lv.label, restore, j)
+
+	if !done {
+		fmt.Fprintf(buf, "%s:\n", end)
+	}
+
+	return done, nil
+}
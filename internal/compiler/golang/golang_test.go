@@ -0,0 +1,167 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/internal/planner"
+	"github.com/open-policy-agent/opa/ir"
+)
+
+func plan(t *testing.T, query string, modules ...string) *ir.Policy {
+	t.Helper()
+
+	mods := make(map[string]*ast.Module, len(modules))
+	for i := range modules {
+		name := fmt.Sprintf("module-%d.rego", i)
+		module, err := ast.ParseModule(name, modules[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		mods[name] = module
+	}
+
+	compiler := ast.NewCompiler()
+	if compiler.Compile(mods); compiler.Failed() {
+		t.Fatal(compiler.Errors)
+	}
+
+	modList := make([]*ast.Module, 0, len(compiler.Modules))
+	for _, m := range compiler.Modules {
+		modList = append(modList, m)
+	}
+
+	qc := compiler.QueryCompiler()
+	body, err := qc.Compile(ast.MustParseBody(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := planner.New().
+		WithQueries([]planner.QuerySet{
+			{
+				Name:          "test",
+				Queries:       []ast.Body{body},
+				RewrittenVars: qc.RewrittenVars(),
+			},
+		}).
+		WithModules(modList).
+		WithBuiltinDecls(ast.BuiltinMap).
+		Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return policy
+}
+
+func TestCompilerGeneratesValidSource(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		query   string
+		modules []string
+		exp     []string
+	}{
+		{
+			note:  "hello world",
+			query: `input.foo = 1`,
+			exp:   []string{"func plan0(c *golang.Context, input, data ast.Value)"},
+		},
+		{
+			note:  "builtin",
+			query: `x := upper(input.x)`,
+			exp:   []string{`"upper",`, "c.Call(0, "},
+		},
+		{
+			note:  "scan and negation",
+			query: `x := input.xs[_]; not x == 1`,
+			exp:   []string{"for it := c.Iter("},
+		},
+		{
+			note:  "rules, functions and with",
+			query: `x := data.test.p with input.x as 1`,
+			modules: []string{`package test
+
+p[x] { x := f(input.x) }
+p[x] { x := data.test.q }
+q := {"a": input.y}
+f(x) := x + 1`},
+			exp: []string{
+				"c.PushMemo()",
+				"c.PopMemo()",
+				`{Path: []string{"g0", "test", "q"}, Func: `,
+				"return c.Memoize(",
+			},
+		},
+		{
+			note:  "conflict",
+			query: `x := data.test.p`,
+			modules: []string{`package test
+
+p := input.x
+p := input.y`},
+			exp: []string{`c.Conflict("var assignment conflict", "module-0.rego", `},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			src, err := New().WithPolicy(plan(t, tc.query, tc.modules...)).WithData([]byte(`{"x": 1}`)).Compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := parser.ParseFile(token.NewFileSet(), "policy.go", src, parser.AllErrors); err != nil {
+				t.Fatalf("invalid source code: %v\n%s", err, src)
+			}
+
+			for _, exp := range tc.exp {
+				if !strings.Contains(string(src), exp) {
+					t.Fatalf("expected source code to contain %q, got:\n%s", exp, src)
+				}
+			}
+		})
+	}
+}
+
+func TestCompilerInvalidPackage(t *testing.T) {
+	_, err := New().WithPolicy(plan(t, `input.foo = 1`)).WithPackage("1x").Compile()
+	if err == nil || err.Error() != `invalid package name: "1x"` {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestCompilerUndefinedFunction(t *testing.T) {
+	policy := &ir.Policy{
+		Static: &ir.Static{},
+		Plans: &ir.Plans{
+			Plans: []*ir.Plan{
+				{
+					Name: "test",
+					Blocks: []*ir.Block{
+						{
+							Stmts: []ir.Stmt{
+								&ir.CallStmt{Func: "unknown", Result: 2},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	_, err := New().WithPolicy(policy).Compile()
+	if err == nil || err.Error() != `plan test: undefined function: "unknown"` {
+		t.Fatal("unexpected error:", err)
+	}
+}
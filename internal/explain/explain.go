@@ -0,0 +1,447 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package explain reconstructs rule-level explanations from evaluation traces.
+//
+// An explanation is a tree of the rules evaluated by a query. For every rule,
+// it lists the bodies that were evaluated and whether they succeeded. Failed
+// bodies include the first expression that failed along with the values bound
+// to its variables and input references. If the default value of a rule was
+// used, the explanation says so.
+//
+// Rule indexing prevents bodies from being evaluated at all, so traces used
+// for explanations should be recorded with indexing disabled.
+package explain
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown"
+)
+
+// Result describes the outcome of evaluating a rule body.
+type Result string
+
+const (
+	// Success indicates that the body was satisfied at least once.
+	Success Result = "success"
+
+	// Failure indicates that the body was never satisfied.
+	Failure Result = "fail"
+)
+
+// Explanation contains the rules evaluated by a query.
+type Explanation struct {
+	Rules []*Rule `json:"rules,omitempty"`
+}
+
+// Rule describes the evaluation of a rule from an expression.
+type Rule struct {
+	Name     string        `json:"name"`
+	Location *ast.Location `json:"location,omitempty"` // location of the expression that referred to the rule
+	Bodies   []*Body       `json:"bodies,omitempty"`
+	Default  *Body         `json:"default,omitempty"` // set if the default value was used
+}
+
+// Body describes the evaluation of a rule body.
+type Body struct {
+	Location *ast.Location `json:"location,omitempty"`
+	Result   Result        `json:"result"`
+	Values   []interface{} `json:"values,omitempty"` // values produced by a successful body
+	Failed   *Expr         `json:"failed,omitempty"` // first expression that failed in a failed body
+	Rules    []*Rule       `json:"rules,omitempty"`  // rules evaluated by the body
+}
+
+// Expr describes an expression along with the values bound to its variables
+// and input references when it was evaluated.
+type Expr struct {
+	Location *ast.Location          `json:"location,omitempty"`
+	Text     string                 `json:"text"`
+	Bindings map[string]interface{} `json:"bindings,omitempty"`
+}
+
+// New returns the explanation of the evaluation recorded in trace.
+func New(trace []*topdown.Event) *Explanation {
+
+	b := builder{
+		result:   &Explanation{},
+		parents:  map[uint64]uint64{},
+		bodies:   map[uint64]*Body{},
+		lastEval: map[uint64]*topdown.Event{},
+		groups:   map[groupKey]*Rule{},
+	}
+
+	for _, event := range trace {
+		b.add(event)
+	}
+
+	b.finish(b.result.Rules)
+
+	return b.result
+}
+
+// groupKey identifies the bodies of a rule that are evaluated by a single
+// evaluation of an expression.
+type groupKey struct {
+	eval *topdown.Event
+	path string
+}
+
+type builder struct {
+	result   *Explanation
+	parents  map[uint64]uint64
+	bodies   map[uint64]*Body // bodies by query ID
+	lastEval map[uint64]*topdown.Event
+	groups   map[groupKey]*Rule
+}
+
+func (b *builder) add(event *topdown.Event) {
+
+	if _, ok := b.parents[event.QueryID]; !ok {
+		b.parents[event.QueryID] = event.ParentID
+	}
+
+	switch event.Op {
+	case topdown.EvalOp:
+		if event.HasExpr() {
+			b.lastEval[event.QueryID] = event
+		}
+
+	case topdown.EnterOp:
+		rule, ok := event.Node.(*ast.Rule)
+		if !ok || rule.Module == nil {
+			return
+		}
+
+		group := b.group(event, rule)
+		body := &Body{Location: rule.Location, Result: Failure}
+
+		if rule.Default {
+			group.Default = body
+		} else {
+			group.Bodies = append(group.Bodies, body)
+		}
+
+		b.bodies[event.QueryID] = body
+
+	case topdown.ExitOp:
+		rule, ok := event.Node.(*ast.Rule)
+		if !ok {
+			return
+		}
+
+		if body := b.bodies[event.QueryID]; body != nil {
+			body.Result = Success
+			if v := ruleValue(rule, event.Locals); v != nil {
+				body.Values = appendValue(body.Values, v)
+			}
+		}
+
+	case topdown.FailOp:
+		if !event.HasExpr() {
+			return
+		}
+
+		if body := b.bodies[event.QueryID]; body != nil && body.Failed == nil {
+			body.Failed = newExpr(event)
+		}
+	}
+}
+
+// group returns the rule that the body entered by event belongs to.
+func (b *builder) group(event *topdown.Event, rule *ast.Rule) *Rule {
+
+	key := groupKey{eval: b.lastEval[event.ParentID], path: rule.Path().String()}
+
+	if group, ok := b.groups[key]; ok {
+		return group
+	}
+
+	group := &Rule{Name: key.path}
+
+	if key.eval != nil {
+		group.Location = key.eval.Location
+	}
+
+	if owner := b.owner(event.ParentID); owner != nil {
+		owner.Rules = append(owner.Rules, group)
+	} else {
+		b.result.Rules = append(b.result.Rules, group)
+	}
+
+	b.groups[key] = group
+
+	return group
+}
+
+// owner returns the innermost rule body enclosing query qid, if any. Queries
+// such as negated expressions and comprehensions are attributed to the rule
+// body they are evaluated in.
+func (b *builder) owner(qid uint64) *Body {
+	for {
+		if body, ok := b.bodies[qid]; ok {
+			return body
+		}
+		parent, ok := b.parents[qid]
+		if !ok || parent == qid {
+			return nil
+		}
+		qid = parent
+	}
+}
+
+// finish drops failure details from bodies that eventually succeeded, e.g.,
+// because some, but not all, iterations failed. Bodies are sorted by location
+// because evaluation order does not necessarily follow the source.
+func (b *builder) finish(rules []*Rule) {
+	for _, rule := range rules {
+		sort.SliceStable(rule.Bodies, func(i, j int) bool {
+			return rule.Bodies[i].Location.Compare(rule.Bodies[j].Location) < 0
+		})
+		for _, body := range rule.Bodies {
+			if body.Result == Success {
+				body.Failed = nil
+			}
+			b.finish(body.Rules)
+		}
+		if rule.Default != nil {
+			rule.Default.Failed = nil
+			b.finish(rule.Default.Rules)
+		}
+	}
+}
+
+func ruleValue(rule *ast.Rule, locals *ast.ValueMap) interface{} {
+
+	var term *ast.Term
+
+	switch rule.Head.DocKind() {
+	case ast.PartialSetDoc:
+		term = rule.Head.Key
+	case ast.PartialObjectDoc:
+		term = ast.ObjectTerm(ast.Item(rule.Head.Key, rule.Head.Value))
+	default:
+		term = rule.Head.Value
+	}
+
+	return toJSON(plug(term, locals))
+}
+
+func appendValue(values []interface{}, v interface{}) []interface{} {
+	for _, other := range values {
+		if fmt.Sprint(other) == fmt.Sprint(v) {
+			return values
+		}
+	}
+	return append(values, v)
+}
+
+func newExpr(event *topdown.Event) *Expr {
+
+	expr := event.Node.(*ast.Expr)
+
+	result := &Expr{
+		Location: expr.Location,
+		Text:     exprText(event, expr),
+		Bindings: map[string]interface{}{},
+	}
+
+	ast.WalkTerms(expr, func(term *ast.Term) bool {
+		switch v := term.Value.(type) {
+		case ast.Var:
+			name, ok := varName(event, v)
+			if !ok {
+				return false
+			}
+			if value := event.Locals.Get(v); value != nil {
+				result.Bindings[string(name)] = toJSON(ast.NewTerm(value))
+			}
+		case ast.Ref:
+			if !v.HasPrefix(ast.InputRootRef) || event.Input() == nil {
+				return false
+			}
+			ref := plug(term, event.Locals).Value.(ast.Ref)
+			if !ref.IsGround() {
+				return false
+			}
+			value, err := event.Input().Value.Find(ref[1:])
+			if err != nil {
+				return false
+			}
+			result.Bindings[refName(event, v)] = toJSON(ast.NewTerm(value))
+			// Variables in the reference have been resolved already.
+			return true
+		}
+		return false
+	})
+
+	if len(result.Bindings) == 0 {
+		result.Bindings = nil
+	}
+
+	return result
+}
+
+// exprText returns the source text of expr. If the source is not available,
+// e.g., because the expression was generated by the compiler, the expression
+// is printed with the variables renamed back to their original names.
+func exprText(event *topdown.Event, expr *ast.Expr) string {
+
+	if expr.Location != nil && len(expr.Location.Text) > 0 && !expr.Generated {
+		return string(expr.Location.Text)
+	}
+
+	cpy := expr.Copy()
+
+	x, _ := ast.TransformVars(cpy, func(v ast.Var) (ast.Value, error) {
+		if name, ok := varName(event, v); ok {
+			return name, nil
+		}
+		return v, nil
+	})
+
+	return x.(*ast.Expr).String()
+}
+
+func varName(event *topdown.Event, v ast.Var) (ast.Var, bool) {
+	name := v
+	if meta, ok := event.LocalMetadata[v]; ok {
+		name = meta.Name
+	}
+	if name.IsGenerated() || name.IsWildcard() {
+		return "", false
+	}
+	return name, true
+}
+
+func refName(event *topdown.Event, ref ast.Ref) string {
+	cpy := ref.Copy()
+	for i := range cpy {
+		if v, ok := cpy[i].Value.(ast.Var); ok && i > 0 {
+			if name, ok := varName(event, v); ok {
+				cpy[i] = ast.VarTerm(string(name))
+			}
+		}
+	}
+	return cpy.String()
+}
+
+// plug replaces the variables in term that have local bindings.
+func plug(term *ast.Term, locals *ast.ValueMap) *ast.Term {
+	if locals == nil {
+		return term
+	}
+	x, _ := ast.TransformVars(term.Copy().Value, func(v ast.Var) (ast.Value, error) {
+		if value := locals.Get(v); value != nil {
+			return value, nil
+		}
+		return v, nil
+	})
+	return ast.NewTerm(x.(ast.Value))
+}
+
+func toJSON(term *ast.Term) interface{} {
+	if v, err := ast.JSON(term.Value); err == nil {
+		return v
+	}
+	return term.String()
+}
+
+// Pretty writes the explanation to w as a tree.
+func Pretty(w io.Writer, e *Explanation) error {
+	p := printer{w: w}
+	for _, rule := range e.Rules {
+		p.rule(rule, 0)
+	}
+	return p.err
+}
+
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) printf(depth int, format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, strings.Repeat("  ", depth)+format+"\n", args...)
+}
+
+func (p *printer) rule(rule *Rule, depth int) {
+
+	if rule.Location != nil {
+		p.printf(depth, "%v (%v)", rule.Name, formatLocation(rule.Location))
+	} else {
+		p.printf(depth, "%v", rule.Name)
+	}
+
+	for _, body := range rule.Bodies {
+		switch {
+		case body.Result == Failure:
+			p.printf(depth+1, "%v: body failed", formatLocation(body.Location))
+		case len(body.Values) > 0:
+			p.printf(depth+1, "%v: body succeeded => %v", formatLocation(body.Location), formatValues(body.Values))
+		default:
+			p.printf(depth+1, "%v: body succeeded", formatLocation(body.Location))
+		}
+		p.body(body, depth+2)
+	}
+
+	if rule.Default != nil {
+		p.printf(depth+1, "%v: no body succeeded, default value used => %v", formatLocation(rule.Default.Location), formatValues(rule.Default.Values))
+		p.body(rule.Default, depth+2)
+	}
+}
+
+func (p *printer) body(body *Body, depth int) {
+
+	for _, rule := range body.Rules {
+		p.rule(rule, depth)
+	}
+
+	if body.Failed != nil {
+		p.printf(depth, "%v: failed: %v", formatLocation(body.Failed.Location), body.Failed.Text)
+
+		keys := make([]string, 0, len(body.Failed.Bindings))
+		for k := range body.Failed.Bindings {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			p.printf(depth+1, "%v = %v", k, formatValue(body.Failed.Bindings[k]))
+		}
+	}
+}
+
+func formatLocation(loc *ast.Location) string {
+	if loc == nil {
+		return "?"
+	}
+	if loc.File == "" {
+		return fmt.Sprintf("query:%v", loc.Row)
+	}
+	return fmt.Sprintf("%v:%v", loc.File, loc.Row)
+}
+
+func formatValues(values []interface{}) string {
+	strs := make([]string, len(values))
+	for i := range values {
+		strs[i] = formatValue(values[i])
+	}
+	return strings.Join(strs, ", ")
+}
+
+func formatValue(v interface{}) string {
+	if term, err := ast.InterfaceToValue(v); err == nil {
+		return term.String()
+	}
+	return fmt.Sprint(v)
+}
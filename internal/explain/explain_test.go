@@ -0,0 +1,151 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package explain
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const testModule = `package authz
+
+default allow := false
+
+allow {
+	input.user == "admin"
+}
+
+allow {
+	is_owner
+	input.method == "GET"
+}
+
+is_owner {
+	u := input.user
+	u == input.owner
+}
+
+roles[r] {
+	r := ["reader", "writer"][_]
+}
+`
+
+func TestExplanation(t *testing.T) {
+
+	tests := []struct {
+		note  string
+		query string
+		input string
+		exp   string
+	}{
+		{
+			note:  "default used",
+			query: "data.authz.allow",
+			input: `{"user": "bob", "owner": "bob", "method": "POST"}`,
+			exp: `data.authz.allow (query:1)
+  test.rego:5: body failed
+    test.rego:6: failed: input.user == "admin"
+      input.user = "bob"
+  test.rego:9: body failed
+    data.authz.is_owner (test.rego:10)
+      test.rego:14: body succeeded => true
+    test.rego:11: failed: input.method == "GET"
+      input.method = "POST"
+  test.rego:3: no body succeeded, default value used => false
+`,
+		},
+		{
+			note:  "bindings",
+			query: "data.authz.is_owner",
+			input: `{"user": "bob", "owner": "alice"}`,
+			exp: `data.authz.is_owner (query:1)
+  test.rego:14: body failed
+    test.rego:16: failed: u == input.owner
+      input.owner = "alice"
+      u = "bob"
+`,
+		},
+		{
+			note:  "success",
+			query: "data.authz.allow",
+			input: `{"user": "admin"}`,
+			exp: `data.authz.allow (query:1)
+  test.rego:5: body succeeded => true
+  test.rego:9: body failed
+    data.authz.is_owner (test.rego:10)
+      test.rego:14: body failed
+        test.rego:16: failed: u == input.owner
+          u = "admin"
+    test.rego:10: failed: is_owner
+`,
+		},
+		{
+			note:  "partial set",
+			query: "data.authz.roles",
+			exp: `data.authz.roles (query:1)
+  test.rego:19: body succeeded => "reader", "writer"
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			tracer := topdown.NewBufferTracer()
+
+			opts := []func(*rego.Rego){
+				rego.Query(tc.query),
+				rego.Module("test.rego", testModule),
+			}
+
+			if tc.input != "" {
+				opts = append(opts, rego.Input(util.MustUnmarshalJSON([]byte(tc.input))))
+			}
+
+			pq, err := rego.New(opts...).PrepareForEval(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = pq.Eval(context.Background(), rego.EvalQueryTracer(tracer), rego.EvalRuleIndexing(false))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := Pretty(&buf, New(*tracer)); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.String() != tc.exp {
+				t.Fatalf("expected:\n\n%v\n\ngot:\n\n%v", tc.exp, buf.String())
+			}
+		})
+	}
+}
+
+func TestExplanationGeneratedExpr(t *testing.T) {
+
+	expr := ast.MustParseExpr(`__local0__ == input.x`)
+	expr.Generated = true
+
+	event := &topdown.Event{
+		Op:   topdown.FailOp,
+		Node: expr,
+		LocalMetadata: map[ast.Var]topdown.VarMetadata{
+			ast.Var("__local0__"): {Name: ast.Var("y")},
+		},
+	}
+
+	if text := exprText(event, expr); text != "equal(y, input.x)" {
+		t.Fatalf("expected original variable names but got %q", text)
+	}
+}
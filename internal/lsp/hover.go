@@ -0,0 +1,137 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/types"
+)
+
+// hover returns information on the built-in function or rule referred to at
+// the requested position. Rules are described by their type and the title and
+// description of their annotations.
+func (s *Server) hover(params textDocumentPositionParams) (interface{}, error) {
+
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	c, module := s.ws.compiled(doc)
+	if module == nil {
+		return nil, nil
+	}
+
+	off := positionToOffset(doc.text, params.Position)
+
+	// Refs in the compiled module have been resolved against imports and the
+	// package, and built-in calls have been rewritten into call terms that keep
+	// the location of the operator.
+	term := findInnermostRef(module, off)
+	if term == nil {
+		return nil, nil
+	}
+
+	ref := term.Value.(ast.Ref)
+
+	var contents string
+
+	if bi := findBuiltin(c, ref); bi != nil {
+		contents = describeBuiltin(bi)
+	} else if rules := c.GetRulesExact(ref.ConstantPrefix()); len(rules) > 0 {
+		contents = describeRule(c, rules[0])
+	} else {
+		return nil, nil
+	}
+
+	r := locationRange(doc.text, term.Location)
+
+	return hover{
+		Contents: markupContent{Kind: markupKindMarkdown, Value: contents},
+		Range:    &r,
+	}, nil
+}
+
+// findInnermostRef returns the innermost ref term in module that contains the
+// byte offset off.
+func findInnermostRef(module *ast.Module, off int) *ast.Term {
+
+	var match *ast.Term
+
+	ast.WalkTerms(module, func(t *ast.Term) bool {
+		if t.Location == nil || off < t.Location.Offset || off >= t.Location.Offset+len(t.Location.Text) {
+			// Generated terms may not cover their children, so keep looking.
+			return t.Location != nil && t.Location.Text != nil
+		}
+		if _, ok := t.Value.(ast.Ref); ok {
+			match = t
+		}
+		return false
+	})
+
+	return match
+}
+
+func findBuiltin(c *ast.Compiler, ref ast.Ref) *ast.Builtin {
+	name := ref.String()
+	for _, bi := range c.Capabilities().Builtins {
+		if bi.Name == name {
+			return bi
+		}
+	}
+	return nil
+}
+
+func describeBuiltin(bi *ast.Builtin) string {
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "```rego\n%v%v => %v\n```", bi.Name, bi.Decl.NamedFuncArgs(), types.Sprint(bi.Decl.NamedResult()))
+
+	if bi.Description != "" {
+		fmt.Fprintf(&b, "\n\n%v", strings.TrimSpace(bi.Description))
+	}
+
+	if bi.IsDeprecated() {
+		b.WriteString("\n\n**Deprecated**")
+	}
+
+	return b.String()
+}
+
+func describeRule(c *ast.Compiler, rule *ast.Rule) string {
+
+	var b strings.Builder
+
+	path := rule.Path()
+
+	b.WriteString("```rego\n")
+	b.WriteString(path.String())
+	if tpe := c.TypeEnv.Get(path); tpe != nil {
+		fmt.Fprintf(&b, ": %v", types.Sprint(tpe))
+	}
+	b.WriteString("\n```")
+
+	if as := c.GetAnnotationSet(); as != nil {
+		for _, ref := range as.Chain(rule) {
+			a := ref.Annotations
+			if a == nil || a.Scope != "rule" && a.Scope != "document" {
+				continue
+			}
+			if a.Title != "" {
+				fmt.Fprintf(&b, "\n\n**%v**", a.Title)
+			}
+			if a.Description != "" {
+				fmt.Fprintf(&b, "\n\n%v", a.Description)
+			}
+			break
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC error codes used by the server.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+	codeRequestFailed  = -32803
+)
+
+// message is a JSON-RPC request or notification received from the client.
+// Notifications do not carry an ID.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  *interface{}     `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+func newResponseError(code int, f string, a ...interface{}) *responseError {
+	return &responseError{Code: code, Message: fmt.Sprintf(f, a...)}
+}
+
+// conn reads and writes JSON-RPC messages framed by a Content-Length header
+// as described by the Language Server Protocol base protocol.
+type conn struct {
+	r   *textproto.Reader
+	w   io.Writer
+	mtx sync.Mutex
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: textproto.NewReader(bufio.NewReader(r)), w: w}
+}
+
+// read returns the content of the next message. It returns io.EOF if the
+// stream ends before a new message starts.
+func (c *conn) read() ([]byte, error) {
+
+	hdr, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(hdr) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("malformed header: %w", err)
+	}
+
+	length, err := strconv.Atoi(hdr.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("malformed header: invalid Content-Length %q", hdr.Get("Content-Length"))
+	}
+
+	bs := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, bs); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+func (c *conn) write(x interface{}) error {
+
+	bs, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(bs)); err != nil {
+		return err
+	}
+
+	_, err = c.w.Write(bs)
+	return err
+}
+
+func (c *conn) reply(id *json.RawMessage, result interface{}, err *responseError) error {
+	resp := response{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		resp.Error = err
+	} else {
+		resp.Result = &result
+	}
+	return c.write(resp)
+}
+
+func (c *conn) notify(method string, params interface{}) error {
+	return c.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
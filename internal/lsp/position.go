@@ -0,0 +1,123 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	fileurl "github.com/open-policy-agent/opa/internal/file/url"
+)
+
+// LSP positions count characters in UTF-16 code units whereas AST locations
+// and offsets count bytes. The helpers below convert between the two using
+// the text of the document the position refers to.
+
+// positionToOffset returns the byte offset of pos in text. Positions past the
+// end of a line refer to the end of that line.
+func positionToOffset(text string, pos position) int {
+
+	off := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[off:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		off += i + 1
+	}
+
+	units := 0
+	for i, r := range text[off:] {
+		if units >= pos.Character || r == '\n' {
+			return off + i
+		}
+		units += utf16Len(r)
+	}
+
+	return len(text)
+}
+
+// offsetToPosition returns the position of the byte offset off in text.
+func offsetToPosition(text string, off int) position {
+
+	if off > len(text) {
+		off = len(text)
+	} else if off < 0 {
+		off = 0
+	}
+
+	var pos position
+	start := 0
+
+	for i := strings.IndexByte(text[:off], '\n'); i >= 0; i = strings.IndexByte(text[start:off], '\n') {
+		start += i + 1
+		pos.Line++
+	}
+
+	for _, r := range text[start:off] {
+		pos.Character += utf16Len(r)
+	}
+
+	return pos
+}
+
+// locationRange returns the range covered by the text of loc.
+func locationRange(text string, loc *ast.Location) textRange {
+
+	if loc == nil {
+		return textRange{}
+	}
+
+	off := 0
+	for row := 1; row < loc.Row; row++ {
+		i := strings.IndexByte(text[off:], '\n')
+		if i < 0 {
+			off = len(text)
+			break
+		}
+		off += i + 1
+	}
+
+	if loc.Col > 1 {
+		off += loc.Col - 1
+	}
+
+	return textRange{
+		Start: offsetToPosition(text, off),
+		End:   offsetToPosition(text, off+len(loc.Text)),
+	}
+}
+
+// fullRange returns the range covering all of text.
+func fullRange(text string) textRange {
+	return textRange{End: offsetToPosition(text, len(text))}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// uriToPath returns the file system path for a file:// URI.
+func uriToPath(uri string) (string, error) {
+	path, err := fileurl.Clean(uri)
+	if err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// pathToURI returns the file:// URI for a file system path.
+func pathToURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
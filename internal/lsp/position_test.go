@@ -0,0 +1,75 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+func TestPositionOffsetConversion(t *testing.T) {
+
+	text := "package x\n\np = \"héllo 😀\" { true }\n"
+
+	tests := []struct {
+		note   string
+		pos    position
+		offset int
+	}{
+		{note: "start", pos: position{}, offset: 0},
+		{note: "second line", pos: position{Line: 1}, offset: 10},
+		{note: "multi-byte rune", pos: position{Line: 2, Character: 7}, offset: 19},
+		{note: "surrogate pair", pos: position{Line: 2, Character: 13}, offset: 27},
+		{note: "end of line", pos: position{Line: 2, Character: 23}, offset: 37},
+		{note: "end", pos: position{Line: 3}, offset: 38},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			if off := positionToOffset(text, tc.pos); off != tc.offset {
+				t.Fatalf("expected offset %d, got %d", tc.offset, off)
+			}
+			if pos := offsetToPosition(text, tc.offset); pos != tc.pos {
+				t.Fatalf("expected position %+v, got %+v", tc.pos, pos)
+			}
+		})
+	}
+
+	// Positions past the end of a line are clamped to the end of the line.
+	if off := positionToOffset(text, position{Line: 0, Character: 100}); off != 9 {
+		t.Fatalf("expected offset 9, got %d", off)
+	}
+}
+
+func TestLocationRange(t *testing.T) {
+
+	text := "package x\n\np = \"😀\" { true }\n"
+
+	loc := &ast.Location{Row: 3, Col: 12, Text: []byte("{ true }")}
+
+	exp := textRange{Start: position{Line: 2, Character: 9}, End: position{Line: 2, Character: 17}}
+
+	if r := locationRange(text, loc); r != exp {
+		t.Fatalf("expected %+v, got %+v", exp, r)
+	}
+}
+
+func TestURIPathConversion(t *testing.T) {
+
+	uri := pathToURI("/tmp/some dir/x.rego")
+	if exp := "file:///tmp/some%20dir/x.rego"; uri != exp {
+		t.Fatalf("expected %v, got %v", exp, uri)
+	}
+
+	path, err := uriToPath(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := "/tmp/some dir/x.rego"; path != exp {
+		t.Fatalf("expected %v, got %v", exp, path)
+	}
+}
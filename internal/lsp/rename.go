@@ -0,0 +1,107 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/format"
+	"github.com/open-policy-agent/opa/refactor"
+)
+
+// rename renames the package referred to at the requested position, either
+// by the package declaration or an import, and rewrites all references to
+// it across the workspace. The new name is the package path without the
+// leading 'data'. Modified modules are reformatted.
+func (s *Server) rename(params renameParams) (interface{}, error) {
+
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range s.ws.docs {
+		if len(doc.errs) > 0 {
+			return nil, fmt.Errorf("cannot rename: %v contains errors", doc.path)
+		}
+	}
+
+	src := packageAt(doc.module, positionToOffset(doc.text, params.Position))
+	if src == nil {
+		return nil, newResponseError(codeRequestFailed, "rename is only supported for packages")
+	}
+
+	name := strings.TrimPrefix(params.NewName, "data.")
+	dst, err := ast.ParseRef("data." + name)
+	if err != nil || !dst.IsGround() {
+		return nil, newResponseError(codeRequestFailed, "invalid package name: %v", params.NewName)
+	}
+
+	// Move rewrites the modules in place, so operate on copies.
+	modules := s.ws.modules()
+	for path, mod := range modules {
+		modules[path] = mod.Copy()
+	}
+
+	result, err := refactor.New().Move(refactor.MoveQuery{
+		Modules:       modules,
+		SrcDstMapping: map[string]string{src.String(): dst.String()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	edit := workspaceEdit{Changes: map[string][]textEdit{}}
+
+	for path, mod := range result.Result {
+		doc := s.ws.docs[path]
+		if mod.Equal(doc.module) {
+			continue
+		}
+		bs, err := format.Ast(mod)
+		if err != nil {
+			return nil, err
+		}
+		edit.Changes[pathToURI(path)] = []textEdit{{Range: fullRange(doc.text), NewText: string(bs)}}
+	}
+
+	return edit, nil
+}
+
+// packageAt returns the package path referred to by the package declaration
+// or import at the byte offset off in module.
+func packageAt(module *ast.Module, off int) ast.Ref {
+
+	if module == nil {
+		return nil
+	}
+
+	contains := func(loc *ast.Location) bool {
+		return loc != nil && off >= loc.Offset && off < loc.Offset+len(loc.Text)
+	}
+
+	if contains(module.Package.Location) {
+		return module.Package.Path
+	}
+
+	for _, term := range module.Package.Path {
+		if contains(term.Location) {
+			return module.Package.Path
+		}
+	}
+
+	for _, imp := range module.Imports {
+		if !contains(imp.Location) {
+			continue
+		}
+		if ref, ok := imp.Path.Value.(ast.Ref); ok && ref.HasPrefix(ast.DefaultRootRef) && len(ref) > 1 {
+			return ref
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,376 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package lsp implements a Language Server Protocol server for Rego.
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/format"
+	"github.com/open-policy-agent/opa/internal/oracle"
+	"github.com/open-policy-agent/opa/logging"
+	"github.com/open-policy-agent/opa/version"
+)
+
+// ErrExitWithoutShutdown is returned by Serve if the client sent the exit
+// notification without requesting a shutdown first.
+var ErrExitWithoutShutdown = errors.New("exit notification received before shutdown request")
+
+// Server implements a Language Server Protocol server for Rego. The server
+// supports diagnostics, go to definition, hover, formatting and renaming of
+// packages. Only full document synchronization is supported.
+type Server struct {
+	logger   logging.Logger
+	ws       *workspace
+	oracle   *oracle.Oracle
+	conn     *conn
+	shutdown bool
+}
+
+// New returns a new Server.
+func New() *Server {
+	return &Server{
+		logger: logging.NewNoOpLogger(),
+		ws:     newWorkspace(),
+		oracle: oracle.New(),
+	}
+}
+
+// WithLogger sets the logger used to report errors that cannot be returned
+// to the client.
+func (s *Server) WithLogger(logger logging.Logger) *Server {
+	s.logger = logger
+	return s
+}
+
+// Serve reads requests and notifications from r and writes responses and
+// notifications to w until the client sends the exit notification, r is
+// exhausted, or ctx is done.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+
+	s.conn = newConn(r, w)
+
+	for ctx.Err() == nil {
+
+		bs, err := s.conn.read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(bs, &msg); err != nil {
+			if err := s.conn.reply(nil, nil, newResponseError(codeParseError, "%v", err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+
+		result, rerr := s.handle(msg)
+
+		// Notifications are never answered.
+		if msg.ID == nil {
+			if rerr != nil {
+				s.logger.Error("Failed to handle %v notification: %v", msg.Method, rerr)
+			}
+			continue
+		}
+
+		if err := s.conn.reply(msg.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (s *Server) handle(msg message) (interface{}, *responseError) {
+
+	if msg.JSONRPC != "2.0" {
+		return nil, newResponseError(codeInvalidRequest, "unsupported jsonrpc version %q", msg.JSONRPC)
+	}
+
+	switch msg.Method {
+	case "initialize":
+		var params initializeParams
+		return s.dispatch(msg.Params, &params, func() (interface{}, error) { return s.initialize(params) })
+	case "initialized":
+		return nil, s.publishDiagnostics()
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenTextDocumentParams
+		return s.dispatch(msg.Params, &params, func() (interface{}, error) { return nil, s.didOpen(params) })
+	case "textDocument/didChange":
+		var params didChangeTextDocumentParams
+		return s.dispatch(msg.Params, &params, func() (interface{}, error) { return nil, s.didChange(params) })
+	case "textDocument/didClose":
+		var params didCloseTextDocumentParams
+		return s.dispatch(msg.Params, &params, func() (interface{}, error) { return nil, s.didClose(params) })
+	case "workspace/didChangeWatchedFiles":
+		var params didChangeWatchedFilesParams
+		return s.dispatch(msg.Params, &params, func() (interface{}, error) { return nil, s.didChangeWatchedFiles(params) })
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		return s.dispatch(msg.Params, &params, func() (interface{}, error) { return s.definition(params) })
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		return s.dispatch(msg.Params, &params, func() (interface{}, error) { return s.hover(params) })
+	case "textDocument/formatting":
+		var params documentFormattingParams
+		return s.dispatch(msg.Params, &params, func() (interface{}, error) { return s.formatting(params) })
+	case "textDocument/rename":
+		var params renameParams
+		return s.dispatch(msg.Params, &params, func() (interface{}, error) { return s.rename(params) })
+	}
+
+	// Notifications and requests starting with '$/' are optional.
+	if msg.ID == nil || strings.HasPrefix(msg.Method, "$/") {
+		return nil, nil
+	}
+
+	return nil, newResponseError(codeMethodNotFound, "method not found: %v", msg.Method)
+}
+
+func (s *Server) dispatch(raw json.RawMessage, params interface{}, f func() (interface{}, error)) (interface{}, *responseError) {
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, params); err != nil {
+			return nil, newResponseError(codeInvalidParams, "invalid params: %v", err)
+		}
+	}
+
+	result, err := f()
+	if err != nil {
+		var rerr *responseError
+		if errors.As(err, &rerr) {
+			return nil, rerr
+		}
+		return nil, newResponseError(codeRequestFailed, "%v", err)
+	}
+
+	return result, nil
+}
+
+func (s *Server) initialize(params initializeParams) (interface{}, error) {
+
+	var roots []string
+
+	for _, folder := range params.WorkspaceFolders {
+		roots = append(roots, folder.URI)
+	}
+
+	if len(roots) == 0 {
+		if params.RootURI != "" {
+			roots = append(roots, params.RootURI)
+		} else if params.RootPath != "" {
+			roots = append(roots, params.RootPath)
+		}
+	}
+
+	for _, root := range roots {
+		path, err := uriToPath(root)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.ws.load(path); err != nil {
+			return nil, newResponseError(codeInternalError, "failed to load workspace: %v", err)
+		}
+	}
+
+	s.ws.compile()
+
+	return initializeResult{
+		Capabilities: serverCapabilities{
+			TextDocumentSync: textDocumentSyncOptions{
+				OpenClose: true,
+				Change:    textDocumentSyncKindFull,
+			},
+			DefinitionProvider:         true,
+			HoverProvider:              true,
+			DocumentFormattingProvider: true,
+			RenameProvider:             true,
+		},
+		ServerInfo: serverInfo{
+			Name:    "opa",
+			Version: version.Version,
+		},
+	}, nil
+}
+
+func (s *Server) publishDiagnostics() *responseError {
+
+	diags := s.ws.diagnostics()
+
+	paths := make([]string, 0, len(diags))
+	for path := range diags {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		err := s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         pathToURI(path),
+			Diagnostics: diags[path],
+		})
+		if err != nil {
+			return newResponseError(codeInternalError, "%v", err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) changed() error {
+	s.ws.compile()
+	if err := s.publishDiagnostics(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) didOpen(params didOpenTextDocumentParams) error {
+	path, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	s.ws.update(path, params.TextDocument.Text, true)
+	return s.changed()
+}
+
+func (s *Server) didChange(params didChangeTextDocumentParams) error {
+	if len(params.ContentChanges) == 0 {
+		return nil
+	}
+	path, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	// With full document synchronization the last change holds the entire
+	// content of the document.
+	s.ws.update(path, params.ContentChanges[len(params.ContentChanges)-1].Text, true)
+	return s.changed()
+}
+
+func (s *Server) didClose(params didCloseTextDocumentParams) error {
+	path, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	if doc, ok := s.ws.docs[path]; ok {
+		doc.open = false
+	}
+	// Unsaved changes are discarded when the document is closed.
+	if err := s.ws.reload(path); err != nil {
+		return err
+	}
+	return s.changed()
+}
+
+func (s *Server) didChangeWatchedFiles(params didChangeWatchedFilesParams) error {
+	for _, event := range params.Changes {
+		path, err := uriToPath(event.URI)
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(path, ".rego") {
+			continue
+		}
+		if err := s.ws.reload(path); err != nil {
+			return err
+		}
+	}
+	return s.changed()
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	path, err := uriToPath(uri)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := s.ws.docs[path]
+	if !ok {
+		return nil, fmt.Errorf("unknown document: %v", uri)
+	}
+	return doc, nil
+}
+
+func (s *Server) definition(params textDocumentPositionParams) (interface{}, error) {
+
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	if !doc.parsed() {
+		return nil, nil
+	}
+
+	// Definitions are looked up with the workspace compiler, which is kept up
+	// to date incrementally. If the workspace does not compile, the oracle
+	// compiles the modules up to the rule tree instead.
+	q := oracle.DefinitionQuery{
+		Filename: doc.path,
+		Pos:      positionToOffset(doc.text, params.Position),
+	}
+	if c, _ := s.ws.compiled(doc); c != nil {
+		q.Compiler = c
+	} else {
+		q.Modules = s.ws.modules()
+	}
+
+	result, err := s.oracle.FindDefinition(q)
+	if err != nil {
+		// The oracle reports positions without a definition as well as
+		// workspaces that do not compile as errors. Neither is an error from
+		// the client's point of view.
+		s.logger.Debug("No definition found: %v", err)
+		return nil, nil
+	}
+
+	text := doc.text
+	if target, ok := s.ws.docs[result.Result.File]; ok {
+		text = target.text
+	}
+
+	return location{
+		URI:   pathToURI(result.Result.File),
+		Range: locationRange(text, result.Result),
+	}, nil
+}
+
+func (s *Server) formatting(params documentFormattingParams) (interface{}, error) {
+
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := format.Source(doc.path, []byte(doc.text))
+	if err != nil {
+		return nil, err
+	}
+
+	if string(bs) == doc.text {
+		return []textEdit{}, nil
+	}
+
+	return []textEdit{{Range: fullRange(doc.text), NewText: string(bs)}}, nil
+}
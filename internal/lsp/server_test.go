@@ -0,0 +1,500 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/util/test"
+)
+
+// testClient drives a Server over in-memory pipes.
+type testClient struct {
+	t      *testing.T
+	conn   *conn
+	nextID int
+	notifs chan message
+	resps  chan json.RawMessage
+	done   chan error
+	diags  map[string][][]diagnostic
+}
+
+func newTestClient(t *testing.T) *testClient {
+	t.Helper()
+
+	cr, sw := io.Pipe()
+	sr, cw := io.Pipe()
+
+	c := &testClient{
+		t:      t,
+		conn:   newConn(cr, cw),
+		notifs: make(chan message, 100),
+		resps:  make(chan json.RawMessage, 100),
+		done:   make(chan error, 1),
+		diags:  map[string][][]diagnostic{},
+	}
+
+	go func() {
+		c.done <- New().Serve(context.Background(), sr, sw)
+		sw.Close()
+	}()
+
+	go func() {
+		for {
+			bs, err := c.conn.read()
+			if err != nil {
+				close(c.resps)
+				return
+			}
+			var msg message
+			if err := json.Unmarshal(bs, &msg); err != nil {
+				panic(err)
+			}
+			if msg.ID == nil {
+				c.notifs <- msg
+			} else {
+				c.resps <- bs
+			}
+		}
+	}()
+
+	t.Cleanup(func() {
+		cw.Close()
+	})
+
+	return c
+}
+
+func (c *testClient) call(method string, params interface{}, result interface{}) *responseError {
+	c.t.Helper()
+
+	c.nextID++
+	id := json.RawMessage(fmt.Sprint(c.nextID))
+
+	if err := c.conn.write(struct {
+		message
+		Params interface{} `json:"params"`
+	}{message: message{JSONRPC: "2.0", ID: &id, Method: method}, Params: params}); err != nil {
+		c.t.Fatal(err)
+	}
+
+	select {
+	case bs := <-c.resps:
+		var resp struct {
+			Result json.RawMessage `json:"result"`
+			Error  *responseError  `json:"error"`
+		}
+		if err := json.Unmarshal(bs, &resp); err != nil {
+			c.t.Fatal(err)
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return nil
+	case <-time.After(10 * time.Second):
+		c.t.Fatalf("timed out waiting for %v response", method)
+	}
+
+	return nil
+}
+
+func (c *testClient) notify(method string, params interface{}) {
+	c.t.Helper()
+	if err := c.conn.notify(method, params); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// diagnostics returns the next diagnostics published for uri. Diagnostics
+// published for other documents in the meantime are kept for later calls.
+func (c *testClient) diagnostics(uri string) []diagnostic {
+	c.t.Helper()
+	for {
+		if pending := c.diags[uri]; len(pending) > 0 {
+			c.diags[uri] = pending[1:]
+			return pending[0]
+		}
+		select {
+		case msg := <-c.notifs:
+			if msg.Method != "textDocument/publishDiagnostics" {
+				continue
+			}
+			var params publishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				c.t.Fatal(err)
+			}
+			c.diags[params.URI] = append(c.diags[params.URI], params.Diagnostics)
+		case <-time.After(10 * time.Second):
+			c.t.Fatalf("timed out waiting for diagnostics for %v", uri)
+		}
+	}
+}
+
+func (c *testClient) initialize(root string) {
+	c.t.Helper()
+	var result initializeResult
+	if err := c.call("initialize", initializeParams{RootURI: pathToURI(root)}, &result); err != nil {
+		c.t.Fatal(err)
+	}
+	if !result.Capabilities.DefinitionProvider || result.Capabilities.TextDocumentSync.Change != textDocumentSyncKindFull {
+		c.t.Fatalf("unexpected capabilities: %+v", result.Capabilities)
+	}
+	c.notify("initialized", struct{}{})
+}
+
+func (c *testClient) shutdown() {
+	c.t.Helper()
+	if err := c.call("shutdown", nil, nil); err != nil {
+		c.t.Fatal(err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestServerDiagnostics(t *testing.T) {
+
+	files := map[string]string{
+		"a.rego": `package a
+
+p { data.b.f(1, 2, 3) }`,
+		"b.rego": `package b
+
+f(x) = x`,
+	}
+
+	test.WithTempFS(files, func(root string) {
+
+		c := newTestClient(t)
+		c.initialize(root)
+
+		uriA := pathToURI(filepath.Join(root, "a.rego"))
+		uriB := pathToURI(filepath.Join(root, "b.rego"))
+
+		diags := c.diagnostics(uriA)
+		if len(diags) != 1 || diags[0].Code != "rego_type_error" {
+			t.Fatalf("unexpected diagnostics: %+v", diags)
+		}
+
+		if exp := (textRange{Start: position{Line: 2, Character: 4}, End: position{Line: 2, Character: 21}}); diags[0].Range != exp {
+			t.Fatalf("expected range %+v, got %+v", exp, diags[0].Range)
+		}
+
+		// Fixing the function clears the diagnostics of the calling module.
+		c.notify("textDocument/didOpen", didOpenTextDocumentParams{
+			TextDocument: textDocumentItem{URI: uriB, LanguageID: "rego", Text: files["b.rego"]},
+		})
+
+		if diags := c.diagnostics(uriA); len(diags) != 1 {
+			t.Fatalf("unexpected diagnostics: %+v", diags)
+		}
+
+		c.notify("textDocument/didChange", didChangeTextDocumentParams{
+			TextDocument:   textDocumentIdentifier{URI: uriB},
+			ContentChanges: []textDocumentContentChangeEvent{{Text: "package b\n\nf(x, y) = x"}},
+		})
+
+		if diags := c.diagnostics(uriA); len(diags) != 0 {
+			t.Fatalf("expected diagnostics to be cleared, got: %+v", diags)
+		}
+
+		// Parse errors are reported against the document being edited.
+		c.notify("textDocument/didChange", didChangeTextDocumentParams{
+			TextDocument:   textDocumentIdentifier{URI: uriB},
+			ContentChanges: []textDocumentContentChangeEvent{{Text: "package b\n\nf(x, y) = "}},
+		})
+
+		diags = c.diagnostics(uriB)
+		if len(diags) == 0 {
+			t.Fatal("expected diagnostics")
+		}
+
+		for _, d := range diags {
+			if d.Code != "rego_parse_error" {
+				t.Fatalf("unexpected diagnostics: %+v", diags)
+			}
+		}
+
+		// Closing the document reverts to the content on disk.
+		c.notify("textDocument/didClose", didCloseTextDocumentParams{TextDocument: textDocumentIdentifier{URI: uriB}})
+
+		if diags := c.diagnostics(uriB); len(diags) != 0 {
+			t.Fatalf("expected diagnostics to be cleared, got: %+v", diags)
+		}
+
+		if diags := c.diagnostics(uriA); len(diags) != 1 {
+			t.Fatalf("unexpected diagnostics: %+v", diags)
+		}
+
+		c.shutdown()
+	})
+}
+
+func TestServerDefinition(t *testing.T) {
+
+	files := map[string]string{
+		"a.rego": `package a
+
+import data.b
+
+p { b.q }`,
+		"b.rego": `package b
+
+q = true`,
+	}
+
+	test.WithTempFS(files, func(root string) {
+
+		c := newTestClient(t)
+		c.initialize(root)
+
+		var loc location
+		err := c.call("textDocument/definition", textDocumentPositionParams{
+			TextDocument: textDocumentIdentifier{URI: pathToURI(filepath.Join(root, "a.rego"))},
+			Position:     position{Line: 4, Character: 6},
+		}, &loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := location{
+			URI:   pathToURI(filepath.Join(root, "b.rego")),
+			Range: textRange{Start: position{Line: 2}, End: position{Line: 2, Character: 8}},
+		}
+
+		if loc != exp {
+			t.Fatalf("expected %+v, got %+v", exp, loc)
+		}
+
+		var result *location
+		err = c.call("textDocument/definition", textDocumentPositionParams{
+			TextDocument: textDocumentIdentifier{URI: pathToURI(filepath.Join(root, "a.rego"))},
+			Position:     position{Line: 0, Character: 0},
+		}, &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result != nil {
+			t.Fatalf("expected no result, got %+v", result)
+		}
+
+		// Definitions reflect unsaved changes to other documents.
+		uriB := pathToURI(filepath.Join(root, "b.rego"))
+		c.notify("textDocument/didOpen", didOpenTextDocumentParams{
+			TextDocument: textDocumentItem{URI: uriB, LanguageID: "rego", Text: "package b\n\n\nq = true"},
+		})
+
+		err = c.call("textDocument/definition", textDocumentPositionParams{
+			TextDocument: textDocumentIdentifier{URI: pathToURI(filepath.Join(root, "a.rego"))},
+			Position:     position{Line: 4, Character: 6},
+		}, &loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if exp := (textRange{Start: position{Line: 3}, End: position{Line: 3, Character: 8}}); loc.URI != uriB || loc.Range != exp {
+			t.Fatalf("expected %v %+v, got %+v", uriB, exp, loc)
+		}
+
+		c.shutdown()
+	})
+}
+
+func TestServerHover(t *testing.T) {
+
+	files := map[string]string{
+		"a.rego": `package a
+
+import data.b
+
+p { count(b.q) > 0 }`,
+		"b.rego": `package b
+
+# METADATA
+# title: Q
+# description: Some values.
+q = {"x"}`,
+	}
+
+	test.WithTempFS(files, func(root string) {
+
+		c := newTestClient(t)
+		c.initialize(root)
+
+		uri := pathToURI(filepath.Join(root, "a.rego"))
+
+		tests := []struct {
+			note string
+			pos  position
+			exp  string
+			rng  textRange
+		}{
+			{
+				note: "builtin",
+				pos:  position{Line: 4, Character: 5},
+				exp:  "```rego\ncount(collection: any<string, array[any], object[any: any], set[any]>) => n: number\n```",
+				rng:  textRange{Start: position{Line: 4, Character: 4}, End: position{Line: 4, Character: 9}},
+			},
+			{
+				note: "rule",
+				pos:  position{Line: 4, Character: 11},
+				exp:  "```rego\ndata.b.q: set[string]\n```\n\n**Q**\n\nSome values.",
+				rng:  textRange{Start: position{Line: 4, Character: 10}, End: position{Line: 4, Character: 13}},
+			},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.note, func(t *testing.T) {
+				var result hover
+				err := c.call("textDocument/hover", textDocumentPositionParams{
+					TextDocument: textDocumentIdentifier{URI: uri},
+					Position:     tc.pos,
+				}, &result)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(result.Contents.Value, tc.exp) {
+					t.Fatalf("expected contents starting with:\n%v\n\ngot:\n%v", tc.exp, result.Contents.Value)
+				}
+				if result.Range == nil || *result.Range != tc.rng {
+					t.Fatalf("expected range %+v, got %+v", tc.rng, result.Range)
+				}
+			})
+		}
+
+		c.shutdown()
+	})
+}
+
+func TestServerFormatting(t *testing.T) {
+
+	files := map[string]string{
+		"a.rego": "package a\np{true}",
+	}
+
+	test.WithTempFS(files, func(root string) {
+
+		c := newTestClient(t)
+		c.initialize(root)
+
+		var edits []textEdit
+		err := c.call("textDocument/formatting", documentFormattingParams{
+			TextDocument: textDocumentIdentifier{URI: pathToURI(filepath.Join(root, "a.rego"))},
+		}, &edits)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := []textEdit{{
+			Range:   textRange{End: position{Line: 1, Character: 7}},
+			NewText: "package a\n\np = true\n",
+		}}
+
+		if len(edits) != 1 || edits[0] != exp[0] {
+			t.Fatalf("expected %+v, got %+v", exp, edits)
+		}
+
+		c.shutdown()
+	})
+}
+
+func TestServerRename(t *testing.T) {
+
+	files := map[string]string{
+		"a.rego": `package a
+
+import data.b
+
+p { b.q }
+`,
+		"b.rego": `package b
+
+q = true
+`,
+		"c.rego": `package c
+
+r = true
+`,
+	}
+
+	test.WithTempFS(files, func(root string) {
+
+		c := newTestClient(t)
+		c.initialize(root)
+
+		var edit workspaceEdit
+		err := c.call("textDocument/rename", renameParams{
+			TextDocument: textDocumentIdentifier{URI: pathToURI(filepath.Join(root, "b.rego"))},
+			Position:     position{Line: 0, Character: 8},
+			NewName:      "lib.b",
+		}, &edit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exp := map[string]string{
+			"a.rego": "package a\n\nimport data.lib.b\n\np {\n\tb.q\n}\n",
+			"b.rego": "package lib.b\n\nq = true\n",
+		}
+
+		if len(edit.Changes) != len(exp) {
+			t.Fatalf("expected changes for %d files, got: %+v", len(exp), edit.Changes)
+		}
+
+		for file, text := range exp {
+			edits := edit.Changes[pathToURI(filepath.Join(root, file))]
+			if len(edits) != 1 || edits[0].NewText != text {
+				t.Fatalf("expected %v to be rewritten to:\n%v\n\ngot: %+v", file, text, edits)
+			}
+		}
+
+		rerr := c.call("textDocument/rename", renameParams{
+			TextDocument: textDocumentIdentifier{URI: pathToURI(filepath.Join(root, "c.rego"))},
+			Position:     position{Line: 2, Character: 0},
+			NewName:      "s",
+		}, nil)
+		if rerr == nil || rerr.Code != codeRequestFailed {
+			t.Fatalf("expected request failure, got: %v", rerr)
+		}
+
+		c.shutdown()
+	})
+}
+
+func TestServerExitWithoutShutdown(t *testing.T) {
+
+	c := newTestClient(t)
+	c.notify("exit", nil)
+
+	if err := <-c.done; err != ErrExitWithoutShutdown {
+		t.Fatalf("expected %v, got %v", ErrExitWithoutShutdown, err)
+	}
+}
+
+func TestServerMethodNotFound(t *testing.T) {
+
+	c := newTestClient(t)
+
+	err := c.call("textDocument/unknown", nil, nil)
+	if err == nil || err.Code != codeMethodNotFound {
+		t.Fatalf("expected method not found, got: %v", err)
+	}
+
+	c.shutdown()
+}
@@ -0,0 +1,224 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package lsp
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// document is a Rego file known to the server, either loaded from disk or
+// opened (and possibly modified) by the client.
+type document struct {
+	path   string
+	text   string
+	open   bool
+	module *ast.Module // last successfully parsed module, if any
+	errs   ast.Errors  // errors from parsing text
+}
+
+// parsed returns true if the module reflects the current text.
+func (d *document) parsed() bool {
+	return d.module != nil && len(d.errs) == 0
+}
+
+// workspace holds the documents of the workspace and the compiler used for
+// diagnostics and hover information. The compiler is updated incrementally
+// whenever documents change so that only the modules affected by a change
+// are recompiled.
+type workspace struct {
+	docs      map[string]*document
+	compiler  *ast.Compiler // most recent compiler
+	last      *ast.Compiler // most recent compiler that succeeded
+	published map[string]struct{}
+}
+
+func newWorkspace() *workspace {
+	return &workspace{
+		docs:      map[string]*document{},
+		published: map[string]struct{}{},
+	}
+}
+
+// load adds all Rego files under root to the workspace. Hidden directories
+// (e.g., .git) are skipped.
+func (w *workspace) load(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".rego" {
+			return nil
+		}
+		if doc, ok := w.docs[path]; ok && doc.open {
+			return nil
+		}
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		w.update(path, string(bs), false)
+		return nil
+	})
+}
+
+// reload re-reads the document at path from disk unless the client has it
+// open. Documents whose file no longer exists are removed.
+func (w *workspace) reload(path string) error {
+	if doc, ok := w.docs[path]; ok && doc.open {
+		return nil
+	}
+	bs, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		delete(w.docs, path)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	w.update(path, string(bs), false)
+	return nil
+}
+
+// update sets the text of the document at path and parses it. If the text
+// cannot be parsed, the previously parsed module is kept so that the rest of
+// the workspace still compiles against it.
+func (w *workspace) update(path, text string, open bool) *document {
+
+	doc, ok := w.docs[path]
+	if !ok {
+		doc = &document{path: path}
+		w.docs[path] = doc
+	}
+
+	doc.text = text
+	doc.open = open
+
+	module, err := ast.ParseModuleWithOpts(path, text, ast.ParserOptions{ProcessAnnotation: true})
+	if err != nil {
+		if errs, ok := err.(ast.Errors); ok {
+			doc.errs = errs
+		} else {
+			doc.errs = ast.Errors{ast.NewError(ast.ParseErr, &ast.Location{File: path, Row: 1, Col: 1}, err.Error())}
+		}
+		return doc
+	}
+
+	doc.errs = nil
+
+	// Empty files parse to a nil module.
+	doc.module = module
+
+	return doc
+}
+
+// modules returns the most recently parsed module of every document.
+func (w *workspace) modules() map[string]*ast.Module {
+	modules := make(map[string]*ast.Module, len(w.docs))
+	for path, doc := range w.docs {
+		if doc.module != nil {
+			modules[path] = doc.module
+		}
+	}
+	return modules
+}
+
+// compile compiles the workspace, reusing the modules compiled by the last
+// successful compilation that were not affected by changes since.
+func (w *workspace) compile() {
+
+	c := ast.NewCompiler().
+		SetErrorLimit(0).
+		WithIncremental(w.last)
+
+	c.Compile(w.modules())
+
+	w.compiler = c
+	if !c.Failed() {
+		w.last = c
+	}
+}
+
+// compiled returns the compiled module for doc if the compiler is up to date
+// with the text of doc.
+func (w *workspace) compiled(doc *document) (*ast.Compiler, *ast.Module) {
+	if w.compiler == nil || w.compiler.Failed() || !doc.parsed() {
+		return nil, nil
+	}
+	if w.compiler.ParsedModules()[doc.path] != doc.module {
+		return nil, nil
+	}
+	return w.compiler, w.compiler.Modules[doc.path]
+}
+
+// diagnostics returns the diagnostics for every document whose diagnostics
+// changed, keyed by path. Documents that previously had diagnostics are
+// included with an empty list so that clients clear them.
+func (w *workspace) diagnostics() map[string][]diagnostic {
+
+	result := map[string][]diagnostic{}
+
+	for path := range w.published {
+		result[path] = []diagnostic{}
+	}
+
+	add := func(doc *document, errs ast.Errors) {
+		for _, e := range errs {
+			result[doc.path] = append(result[doc.path], diagnostic{
+				Range:    locationRange(doc.text, e.Location),
+				Severity: diagnosticSeverityError,
+				Code:     e.Code,
+				Source:   "opa",
+				Message:  e.Message,
+			})
+		}
+	}
+
+	var compileErrs map[string]ast.Errors
+	if w.compiler != nil {
+		compileErrs = map[string]ast.Errors{}
+		for _, e := range w.compiler.Errors {
+			if e.Location != nil {
+				compileErrs[e.Location.File] = append(compileErrs[e.Location.File], e)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(w.docs))
+	for path := range w.docs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		doc := w.docs[path]
+		if len(doc.errs) > 0 {
+			// Compile errors refer to the previously parsed text, so only the
+			// parse errors are meaningful until the document parses again.
+			add(doc, doc.errs)
+		} else {
+			add(doc, compileErrs[path])
+		}
+	}
+
+	w.published = map[string]struct{}{}
+	for path, diags := range result {
+		if len(diags) > 0 {
+			w.published[path] = struct{}{}
+		}
+	}
+
+	return result
+}
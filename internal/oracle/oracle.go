@@ -2,6 +2,7 @@ package oracle
 
 import (
 	"errors"
+	"sort"
 
 	"github.com/open-policy-agent/opa/ast"
 )
@@ -30,6 +31,7 @@ type DefinitionQuery struct {
 	Pos      int                    // position to search for
 	Modules  map[string]*ast.Module // workspace modules; buffer may shadow a file inside the workspace
 	Buffer   []byte                 // buffer that overrides module with filename
+	Compiler *ast.Compiler          // compiler that keeps the parsed workspace modules; if set, Modules and Buffer are ignored
 }
 
 var (
@@ -49,12 +51,7 @@ type DefinitionQueryResult struct {
 // at the position in q.
 func (o *Oracle) FindDefinition(q DefinitionQuery) (*DefinitionQueryResult, error) {
 
-	// TODO(tsandall): how can we cache the results of compilation and parsing so that
-	// multiple queries can be executed without having to re-compute the same values?
-	// Ditto for caching across runs. Avoid repeating the same work.
-
-	// NOTE(sr): "SetRuleTree" because it's needed for compiler.GetRulesExact() below
-	compiler, parsed, err := compileUpto("SetRuleTree", q.Modules, q.Buffer, q.Filename)
+	compiler, parsed, err := o.compile(q)
 	if err != nil {
 		return nil, err
 	}
@@ -70,26 +67,27 @@ func (o *Oracle) FindDefinition(q DefinitionQuery) (*DefinitionQueryResult, erro
 	// Walk outwards from the match location, attempting to find the definition via
 	// references to imports or other rules. This handles intra-module, intra-package,
 	// and inter-package references.
-	for i := len(stack) - 1; i >= 0; i-- {
-		if term, ok := stack[i].(*ast.Term); ok {
-			if ref, ok := term.Value.(ast.Ref); ok {
-				prefix := ref.ConstantPrefix()
-				if rules := compiler.GetRulesExact(prefix); len(rules) > 0 {
-					return &DefinitionQueryResult{rules[0].Location}, nil
-				}
-				for _, imp := range parsed.Imports {
-					if path, ok := imp.Path.Value.(ast.Ref); ok {
-						if prefix.HasPrefix(path) {
-							return &DefinitionQueryResult{imp.Path.Location}, nil
-						}
-					}
+	for _, ref := range containingRefs(stack) {
+		prefix := ref.ConstantPrefix()
+		if rules := compiler.GetRulesExact(prefix); len(rules) > 0 {
+			return &DefinitionQueryResult{rules[0].Location}, nil
+		}
+		for _, imp := range parsed.Imports {
+			if path, ok := imp.Path.Value.(ast.Ref); ok {
+				if prefix.HasPrefix(path) {
+					return &DefinitionQueryResult{imp.Path.Location}, nil
 				}
 			}
 		}
 	}
 
 	// If the match is a variable, walk inward to find the first occurrence of the variable
-	// in function arguments or the body.
+	// in function arguments or the body. Compilation rewrites variables, so the parsed
+	// module is searched.
+	stack = findContainingNodeStack(parsed, q.Pos)
+	if len(stack) == 0 {
+		return nil, ErrNoDefinitionFound
+	}
 	top := stack[len(stack)-1]
 	if term, ok := top.(*ast.Term); ok {
 		if name, ok := term.Value.(ast.Var); ok {
@@ -111,6 +109,47 @@ func (o *Oracle) FindDefinition(q DefinitionQuery) (*DefinitionQueryResult, erro
 	return nil, ErrNoDefinitionFound
 }
 
+func (o *Oracle) compile(q DefinitionQuery) (*ast.Compiler, *ast.Module, error) {
+
+	if q.Compiler != nil {
+		// The compiled modules have been rewritten by later stages, e.g., local
+		// variables are renamed and some declarations removed. The parsed module
+		// is used to find variables, the compiled module to resolve references.
+		parsed, ok := q.Compiler.ParsedModules()[q.Filename]
+		if !ok {
+			return nil, nil, ErrNoMatchFound
+		}
+		return q.Compiler, parsed, nil
+	}
+
+	// NOTE(sr): "SetRuleTree" because it's needed for compiler.GetRulesExact() below
+	return compileUpto("SetRuleTree", q.Modules, q.Buffer, q.Filename)
+}
+
+// containingRefs returns the references in stack from the innermost to the
+// outermost. Later compiler stages move nested terms into generated expressions,
+// e.g., the reference t in s[t] may be assigned to a local variable before s is
+// referenced, so references are ordered by the size of their location instead of
+// their position in the stack.
+func containingRefs(stack []ast.Node) []ast.Ref {
+	var terms []*ast.Term
+	for i := len(stack) - 1; i >= 0; i-- {
+		if term, ok := stack[i].(*ast.Term); ok {
+			if _, ok := term.Value.(ast.Ref); ok {
+				terms = append(terms, term)
+			}
+		}
+	}
+	sort.SliceStable(terms, func(i, j int) bool {
+		return len(terms[i].Location.Text) < len(terms[j].Location.Text)
+	})
+	refs := make([]ast.Ref, len(terms))
+	for i := range terms {
+		refs[i] = terms[i].Value.(ast.Ref)
+	}
+	return refs
+}
+
 func walkToFirstOccurrence(node ast.Node, needle ast.Var) (match *ast.Term) {
 	ast.WalkNodes(node, func(x ast.Node) bool {
 		if match == nil {
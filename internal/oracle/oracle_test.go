@@ -414,6 +414,23 @@ q[x.y] = 10 {
 				}
 				t.Fatalf("\n\nwant:\n\n\t%#v\n\ngot:\n\n\t%#v\n\nwant (text):\n\n\t%q\n\ngot (text):\n\n\t%q", tc.exp, result, expText, gotText)
 			}
+
+			// The same definition is found with a compiler for the modules.
+			compiler := ast.NewCompiler().WithKeepModules(true)
+			if compiler.Compile(modules); compiler.Failed() {
+				t.Fatal(compiler.Errors)
+			}
+			result, err = o.FindDefinition(DefinitionQuery{
+				Filename: "buffer.rego",
+				Pos:      tc.pos,
+				Compiler: compiler,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.exp.Compare(result.Result) != 0 {
+				t.Fatalf("expected %v but got %v with compiler", tc.exp, result.Result)
+			}
 		})
 	}
 }
@@ -520,3 +537,53 @@ func TestCompileUptoBadStageName(t *testing.T) {
 		t.Fatal("expected halt error but got:", err)
 	}
 }
+
+func TestOracleFindDefinitionCompiler(t *testing.T) {
+
+	modules := map[string]*ast.Module{
+		"a.rego": mustParse(t, "a.rego", "package a\n\nimport data.b.q as r\n\np { r }\n\nf(x) {\n\tsome y\n\ty = x\n\ty > 1\n}"),
+		"b.rego": mustParse(t, "b.rego", "package b\nq = true"),
+	}
+
+	compiler := ast.NewCompiler().WithKeepModules(true)
+	if compiler.Compile(modules); compiler.Failed() {
+		t.Fatal(compiler.Errors)
+	}
+
+	tests := []struct {
+		note string
+		pos  int
+		file string
+		row  int
+		col  int
+	}{
+		{"rule in other module", 37, "b.rego", 2, 1},
+		{"function argument", 62, "a.rego", 7, 3},
+		{"some decl", 65, "a.rego", 8, 7},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			result, err := New().FindDefinition(DefinitionQuery{Filename: "a.rego", Pos: tc.pos, Compiler: compiler})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc := result.Result; loc.File != tc.file || loc.Row != tc.row || loc.Col != tc.col {
+				t.Fatalf("expected %v:%d:%d but got %v", tc.file, tc.row, tc.col, loc)
+			}
+		})
+	}
+
+	if _, err := New().FindDefinition(DefinitionQuery{Filename: "c.rego", Compiler: compiler}); err != ErrNoMatchFound {
+		t.Fatal("expected no match error but got:", err)
+	}
+}
+
+func mustParse(t *testing.T, filename, src string) *ast.Module {
+	t.Helper()
+	mod, err := ast.ParseModule(filename, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mod
+}
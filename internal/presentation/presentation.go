@@ -21,6 +21,7 @@ import (
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/cover"
 	"github.com/open-policy-agent/opa/format"
+	"github.com/open-policy-agent/opa/internal/explain"
 	"github.com/open-policy-agent/opa/loader"
 	"github.com/open-policy-agent/opa/metrics"
 	"github.com/open-policy-agent/opa/profiler"
@@ -115,9 +116,11 @@ type Output struct {
 	Metrics           metrics.Metrics                `json:"metrics,omitempty"`
 	AggregatedMetrics map[string]interface{}         `json:"aggregated_metrics,omitempty"`
 	Explanation       []*topdown.Event               `json:"explanation,omitempty"`
+	RuleExplanation   *explain.Explanation           `json:"rule_explanation,omitempty"`
 	Profile           []profiler.ExprStats           `json:"profile,omitempty"`
 	AggregatedProfile []profiler.ExprStatsAggregated `json:"aggregated_profile,omitempty"`
 	Coverage          *cover.Report                  `json:"coverage,omitempty"`
+	Translation       interface{}                    `json:"translation,omitempty"`
 	limit             int
 }
 
@@ -294,6 +297,11 @@ func Pretty(w io.Writer, r Output) error {
 			return err
 		}
 	}
+	if r.RuleExplanation != nil {
+		if err := explain.Pretty(w, r.RuleExplanation); err != nil {
+			return err
+		}
+	}
 	if r.Errors != nil {
 		if err := prettyError(w, r.Errors); err != nil {
 			return err
@@ -366,6 +374,18 @@ func Source(w io.Writer, r Output) error {
 	return nil
 }
 
+// Translation prints the translation of the partial evaluation results in r
+// to w as JSON.
+func Translation(w io.Writer, r Output) error {
+	if r.Errors != nil {
+		return prettyError(w, r.Errors)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false) // SQL operators such as < and > must not be escaped.
+	return encoder.Encode(r.Translation)
+}
+
 // Raw prints the values from r to w.  Each result is written on a separate
 // line, and the expressions are separated by spaces.  If the values are
 // strings, they are written directly rather than formatted as compact
@@ -54,7 +54,8 @@ func InsertAndCompile(ctx context.Context, opts InsertAndCompileOptions) (*Inser
 	compiler := ast.NewCompiler().
 		SetErrorLimit(opts.MaxErrors).
 		WithPathConflictsCheck(storage.NonEmpty(ctx, opts.Store, opts.Txn)).
-		WithEnablePrintStatements(opts.EnablePrintStatements)
+		WithEnablePrintStatements(opts.EnablePrintStatements).
+		WithIncremental(nil)
 	m := metrics.New()
 
 	activation := &bundle.ActivateOpts{
@@ -150,6 +150,10 @@ type Source struct {
 	Signing        *bundle.VerificationConfig `json:"signing"`
 	Persist        bool                       `json:"persist"`
 	SizeLimitBytes int64                      `json:"size_limit_bytes"`
+
+	// Shadow bundles are activated in a separate store and compiler. They
+	// are not used for decisions but evaluated next to the live bundles.
+	Shadow bool `json:"shadow"`
 }
 
 // IsMultiBundle returns whether or not the config is the newer multi-bundle
@@ -65,6 +65,7 @@ type Plugin struct {
 	ready             bool
 	bundlePersistPath string
 	stopped           bool
+	shadow            *Shadow // store and compiler for shadow bundles
 }
 
 // New returns a new Plugin with the given config.
@@ -84,6 +85,7 @@ func New(parsedConfig *Config, manager *plugins.Manager) *Plugin {
 		etags:       make(map[string]string),
 		ready:       false,
 		logger:      manager.Logger(),
+		shadow:      newShadow(),
 	}
 
 	manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateNotReady})
@@ -156,9 +158,27 @@ func (p *Plugin) Reconfigure(ctx context.Context, config interface{}) {
 	// Look for any bundles that have had their config changed, are new, or have been removed
 	newConfig := config.(*Config)
 	newBundles, updatedBundles, deletedBundles := p.configDelta(newConfig)
+
+	// Bundles are deactivated in the store they were activated in. Bundles
+	// that were moved from or to the shadow store are deactivated as well.
+	deletedShadowBundles := map[string]struct{}{}
+	for name := range deletedBundles {
+		if p.IsShadow(name) {
+			deletedShadowBundles[name] = struct{}{}
+			delete(deletedBundles, name)
+		}
+	}
+	for name, source := range updatedBundles {
+		if p.IsShadow(name) && !source.Shadow {
+			deletedShadowBundles[name] = struct{}{}
+		} else if !p.IsShadow(name) && source.Shadow {
+			deletedBundles[name] = struct{}{}
+		}
+	}
+
 	p.config = *newConfig
 
-	if len(updatedBundles) == 0 && len(newBundles) == 0 && len(deletedBundles) == 0 {
+	if len(updatedBundles) == 0 && len(newBundles) == 0 && len(deletedBundles) == 0 && len(deletedShadowBundles) == 0 {
 		// no relevant config changes
 		return
 	}
@@ -167,7 +187,8 @@ func (p *Plugin) Reconfigure(ctx context.Context, config interface{}) {
 	for name, dl := range p.downloaders {
 		_, updated := updatedBundles[name]
 		_, deleted := deletedBundles[name]
-		if updated || deleted {
+		_, deletedShadow := deletedShadowBundles[name]
+		if updated || deleted || deletedShadow {
 			dl.Stop(ctx)
 		}
 	}
@@ -179,7 +200,9 @@ func (p *Plugin) Reconfigure(ctx context.Context, config interface{}) {
 
 	// Cleanup existing downloaders that are deleted
 	for name := range p.downloaders {
-		if _, deleted := deletedBundles[name]; deleted {
+		_, deleted := deletedBundles[name]
+		_, deletedShadow := deletedShadowBundles[name]
+		if _, updated := updatedBundles[name]; !updated && (deleted || deletedShadow) {
 			p.log(name).Info("Bundle loader configuration removed. Stopping bundle loader.")
 			delete(p.downloaders, name)
 			delete(p.status, name)
@@ -210,6 +233,14 @@ func (p *Plugin) Reconfigure(ctx context.Context, config interface{}) {
 		panic(errors.New("Unable deactivate bundle: " + err.Error()))
 	}
 
+	if len(deletedShadowBundles) > 0 {
+		if err := p.deactivateShadow(ctx, deletedShadowBundles); err != nil {
+			// Shadow bundles do not affect decisions, so there is no need
+			// to stop here.
+			p.manager.Logger().Error(fmt.Sprint(deletedShadowBundles), "Failed to deactivate shadow bundles: %s", err)
+		}
+	}
+
 	readyNow := p.ready
 
 	for name, source := range p.config.Bundles {
@@ -328,9 +359,10 @@ func (p *Plugin) initDownloaders(ctx context.Context) {
 
 func (p *Plugin) readBundleEtagFromStore(ctx context.Context, name string) string {
 	var etag string
-	err := storage.Txn(ctx, p.manager.Store, storage.TransactionParams{}, func(txn storage.Transaction) error {
+	store := p.storeFor(name)
+	err := storage.Txn(ctx, store, storage.TransactionParams{}, func(txn storage.Transaction) error {
 		var loadErr error
-		etag, loadErr = bundle.ReadBundleEtagFromStore(ctx, p.manager.Store, txn, name)
+		etag, loadErr = bundle.ReadBundleEtagFromStore(ctx, store, txn, name)
 		if loadErr != nil && !storage.IsNotFound(loadErr) {
 			p.log(name).Error("Failed to load bundle etag from store: %v", loadErr)
 			return loadErr
@@ -546,7 +578,12 @@ func (p *Plugin) process(ctx context.Context, name string, u download.Update) {
 func (p *Plugin) checkPluginReadiness() {
 	if !p.ready {
 		readyNow := true // optimistically
-		for _, status := range p.status {
+		for name, status := range p.status {
+			// Shadow bundles are not used for decisions, so they do not
+			// affect readiness.
+			if p.IsShadow(name) {
+				continue
+			}
 			if len(status.Errors) > 0 || (status.LastSuccessfulActivation == time.Time{}) {
 				readyNow = false // Not ready yet, check again on next bundle activation.
 				break
@@ -561,6 +598,10 @@ func (p *Plugin) checkPluginReadiness() {
 }
 
 func (p *Plugin) activate(ctx context.Context, name string, b *bundle.Bundle) error {
+	if p.IsShadow(name) {
+		return p.activateShadow(ctx, name, b)
+	}
+
 	p.log(name).Debug("Bundle activation in progress (%v). Opening storage transaction.", b.Manifest.Revision)
 
 	params := storage.WriteParams
@@ -580,7 +621,7 @@ func (p *Plugin) activate(ctx context.Context, name string, b *bundle.Bundle) er
 		}
 
 		if compiler == nil {
-			compiler = ast.NewCompiler()
+			compiler = ast.NewCompiler().WithIncremental(p.manager.GetCompiler())
 		}
 
 		compiler = compiler.WithPathConflictsCheck(storage.NonEmpty(ctx, p.manager.Store, txn)).
@@ -0,0 +1,166 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"context"
+	"sync"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+)
+
+// Shadow contains the store and the compiler that shadow bundles are
+// activated in. Shadow bundles are kept apart from the bundles that decisions
+// are made with, so that a candidate bundle can be evaluated next to the live
+// bundles without affecting them.
+type Shadow struct {
+	store    storage.Store
+	mtx      sync.RWMutex
+	compiler *ast.Compiler
+}
+
+func newShadow() *Shadow {
+	return &Shadow{store: inmem.New()}
+}
+
+// Store returns the store that shadow bundles are activated in.
+func (s *Shadow) Store() storage.Store {
+	return s.store
+}
+
+// Compiler returns the compiler for the shadow bundles. It returns nil if no
+// shadow bundle is active.
+func (s *Shadow) Compiler() *ast.Compiler {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.compiler
+}
+
+func (s *Shadow) setCompiler(compiler *ast.Compiler) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.compiler = compiler
+}
+
+// IsShadow returns true if the named bundle is configured as a shadow bundle.
+func (p *Plugin) IsShadow(name string) bool {
+	src := p.config.Bundles[name]
+	return src != nil && src.Shadow
+}
+
+// Shadow returns the store and compiler that shadow bundles are activated in.
+func (p *Plugin) Shadow() *Shadow {
+	return p.shadow
+}
+
+// storeFor returns the store that the named bundle is activated in.
+func (p *Plugin) storeFor(name string) storage.Store {
+	if p.IsShadow(name) {
+		return p.shadow.store
+	}
+	return p.manager.Store
+}
+
+func (p *Plugin) activateShadow(ctx context.Context, name string, b *bundle.Bundle) error {
+	p.log(name).Debug("Shadow bundle activation in progress (%v).", b.Manifest.Revision)
+
+	params := storage.WriteParams
+	params.Context = storage.NewContext().WithMetrics(p.status[name].Metrics)
+
+	var compiler *ast.Compiler
+
+	err := storage.Txn(ctx, p.shadow.store, params, func(txn storage.Transaction) error {
+
+		if b.Type() == bundle.DeltaBundleType {
+			compiler = p.shadow.Compiler()
+		}
+
+		if compiler == nil {
+			compiler = ast.NewCompiler().WithIncremental(p.shadow.Compiler())
+		}
+
+		compiler = compiler.WithPathConflictsCheck(storage.NonEmpty(ctx, p.shadow.store, txn)).
+			WithEnablePrintStatements(p.manager.EnablePrintStatements())
+
+		return bundle.Activate(&bundle.ActivateOpts{
+			Ctx:      ctx,
+			Store:    p.shadow.store,
+			Txn:      txn,
+			TxnCtx:   params.Context,
+			Compiler: compiler,
+			Metrics:  p.status[name].Metrics,
+			Bundles:  map[string]*bundle.Bundle{name: b},
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	p.shadow.setCompiler(compiler)
+	return nil
+}
+
+// deactivateShadow removes the named shadow bundles from the shadow store and
+// recompiles the remaining shadow policies.
+func (p *Plugin) deactivateShadow(ctx context.Context, names map[string]struct{}) error {
+
+	var compiler *ast.Compiler
+
+	err := storage.Txn(ctx, p.shadow.store, storage.WriteParams, func(txn storage.Transaction) error {
+
+		err := bundle.Deactivate(&bundle.DeactivateOpts{
+			Ctx:         ctx,
+			Store:       p.shadow.store,
+			Txn:         txn,
+			BundleNames: names,
+		})
+		if err != nil {
+			return err
+		}
+
+		// The compiler is reset when the last shadow bundle is removed.
+		names, err := bundle.ReadBundleNamesFromStore(ctx, p.shadow.store, txn)
+		if err != nil && !storage.IsNotFound(err) {
+			return err
+		}
+		if len(names) == 0 {
+			return nil
+		}
+
+		ids, err := p.shadow.store.ListPolicies(ctx, txn)
+		if err != nil {
+			return err
+		}
+
+		modules := make(map[string]*ast.Module, len(ids))
+		for _, id := range ids {
+			bs, err := p.shadow.store.GetPolicy(ctx, txn, id)
+			if err != nil {
+				return err
+			}
+			if modules[id], err = ast.ParseModule(id, string(bs)); err != nil {
+				return err
+			}
+		}
+
+		compiler = ast.NewCompiler().WithEnablePrintStatements(p.manager.EnablePrintStatements())
+		if compiler.Compile(modules); compiler.Failed() {
+			return compiler.Errors
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	p.shadow.setCompiler(compiler)
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/download"
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/util"
+)
+
+func TestPluginOneShotShadowBundle(t *testing.T) {
+
+	ctx := context.Background()
+	manager := getTestManager()
+	plugin := New(&Config{Bundles: map[string]*Source{
+		"live":   {},
+		"canary": {Shadow: true},
+	}}, manager)
+
+	for _, name := range []string{"live", "canary"} {
+		plugin.status[name] = &Status{Name: name, Metrics: metrics.New()}
+		plugin.downloaders[name] = download.New(download.Config{}, plugin.manager.Client(""), name)
+	}
+
+	newBundle := func(revision, module string) *bundle.Bundle {
+		b := bundle.Bundle{
+			Manifest: bundle.Manifest{Revision: revision},
+			Data:     map[string]interface{}{},
+			Modules: []bundle.ModuleFile{
+				{
+					Path:   "/authz.rego",
+					Parsed: ast.MustParseModule(module),
+					Raw:    []byte(module),
+				},
+			},
+		}
+		b.Manifest.Init()
+		return &b
+	}
+
+	// The shadow bundle is activated first and must not make the plugin ready.
+	plugin.oneShot(ctx, "canary", download.Update{Bundle: newBundle("v2", "package authz\n\nallow = false"), Metrics: metrics.New()})
+
+	ensurePluginState(t, plugin, plugins.StateNotReady)
+
+	if plugin.Shadow().Compiler() == nil {
+		t.Fatal("Expected shadow compiler to be set")
+	}
+
+	if plugin.manager.GetCompiler() != nil && len(plugin.manager.GetCompiler().Modules) > 0 {
+		t.Fatal("Expected shadow policies to be kept out of the live compiler")
+	}
+
+	plugin.oneShot(ctx, "live", download.Update{Bundle: newBundle("v1", "package authz\n\nallow = true"), Metrics: metrics.New()})
+
+	ensurePluginState(t, plugin, plugins.StateOK)
+
+	// The live and the shadow store both contain a single bundle.
+	for _, tc := range []struct {
+		store    storage.Store
+		revision string
+	}{
+		{store: manager.Store, revision: "v1"},
+		{store: plugin.Shadow().Store(), revision: "v2"},
+	} {
+		txn := storage.NewTransactionOrDie(ctx, tc.store)
+
+		names, err := bundle.ReadBundleNamesFromStore(ctx, tc.store, txn)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(names) != 1 {
+			t.Fatalf("Expected 1 bundle but got %v", names)
+		}
+
+		revision, err := bundle.ReadBundleRevisionFromStore(ctx, tc.store, txn, names[0])
+		if err != nil {
+			t.Fatal(err)
+		} else if revision != tc.revision {
+			t.Fatalf("Expected revision %q but got %q", tc.revision, revision)
+		}
+
+		tc.store.Abort(ctx, txn)
+	}
+
+	rules := plugin.Shadow().Compiler().GetRulesExact(ast.MustParseRef("data.authz.allow"))
+	if len(rules) != 1 || !rules[0].Head.Value.Equal(ast.BooleanTerm(false)) {
+		t.Fatalf("Expected shadow policy to be compiled but got %v", rules)
+	}
+
+	// Removing the shadow bundle resets the shadow compiler and keeps the live
+	// bundle in place. The downloaders were never started, so they cannot
+	// be stopped.
+	plugin.downloaders = map[string]Loader{}
+	plugin.Reconfigure(ctx, &Config{Bundles: map[string]*Source{
+		"live": {},
+	}})
+
+	if plugin.Shadow().Compiler() != nil {
+		t.Fatal("Expected shadow compiler to be reset")
+	}
+
+	txn := storage.NewTransactionOrDie(ctx, plugin.Shadow().Store())
+	defer plugin.Shadow().Store().Abort(ctx, txn)
+
+	data, err := plugin.Shadow().Store().Read(ctx, txn, storage.Path{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := util.MustUnmarshalJSON([]byte(`{"system": {"bundles": {}}}`))
+	if !reflect.DeepEqual(data, exp) {
+		t.Fatalf("Expected empty shadow store but got %v", data)
+	}
+
+	ensurePluginState(t, plugin, plugins.StateOK)
+}
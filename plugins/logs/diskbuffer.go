@@ -0,0 +1,590 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultDiskBufferSegmentSizeBytes = int64(4 * 1024 * 1024) // 4MiB
+	diskBufferSegmentExt              = ".wal"
+	diskBufferCursorFile              = "cursor.json"
+	diskBufferRecordHeaderSize        = 8 // payload length and CRC-32 of the payload
+)
+
+var errDiskBufferClosed = errors.New("disk buffer closed")
+
+// DiskBufferConfig represents the configuration of the on-disk decision log
+// buffer.
+type DiskBufferConfig struct {
+	Directory        string `json:"directory"`                    // directory holding the buffer segments
+	SegmentSizeBytes *int64 `json:"segment_size_bytes,omitempty"` // size at which a new segment is started
+}
+
+func (c *DiskBufferConfig) validateAndInjectDefaults() error {
+
+	if c.Directory == "" {
+		return fmt.Errorf("missing directory in decision_logs disk buffer")
+	}
+
+	if c.SegmentSizeBytes == nil {
+		size := defaultDiskBufferSegmentSizeBytes
+		c.SegmentSizeBytes = &size
+	} else if *c.SegmentSizeBytes <= 0 {
+		return fmt.Errorf("segment_size_bytes must be positive in decision_logs disk buffer")
+	}
+
+	return nil
+}
+
+// diskPos identifies a record in the disk buffer by the segment holding it and
+// its offset in the segment.
+type diskPos struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+func (p diskPos) less(other diskPos) bool {
+	return p.Segment < other.Segment || (p.Segment == other.Segment && p.Offset < other.Offset)
+}
+
+// diskRecord is a record read from the disk buffer. next is the position
+// following the record; acknowledging it removes the record from the buffer.
+type diskRecord struct {
+	bs   []byte
+	next diskPos
+}
+
+type diskSegment struct {
+	id   uint64
+	size int64
+}
+
+// diskBuffer implements a write-ahead log of encoded decision log events. The
+// log is split into segment files named after their sequence number. A cursor
+// file records the position of the first event that has not been acknowledged
+// yet; segments that only hold acknowledged events are removed. If the limit
+// is exceeded, the oldest events are dropped.
+//
+// Every record consists of the payload length and CRC-32 followed by the
+// payload. When the buffer is opened, incomplete or corrupted records at the
+// end of a segment (e.g., because OPA was killed during a write) are
+// truncated.
+type diskBuffer struct {
+	mtx      sync.Mutex
+	dir      string
+	limit    int64
+	segSize  int64
+	segments []diskSegment // ordered by id; the last one is being appended to
+	active   *os.File
+	head     diskPos // first unacknowledged record
+	usage    int64   // bytes held by unacknowledged records
+	count    int64   // number of unacknowledged records
+	closed   bool
+}
+
+func openDiskBuffer(dir string, limit int64, segSize int64) (*diskBuffer, error) {
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	b := &diskBuffer{
+		dir:     dir,
+		limit:   limit,
+		segSize: segSize,
+	}
+
+	if err := b.readCursor(); err != nil {
+		return nil, err
+	}
+
+	if err := b.recover(); err != nil {
+		return nil, err
+	}
+
+	last := b.segments[len(b.segments)-1]
+
+	f, err := os.OpenFile(b.segmentPath(last.id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	b.active = f
+
+	return b, nil
+}
+
+// Push appends bs to the buffer. If the limit would be exceeded, the oldest
+// records are dropped first and their number is returned.
+func (b *diskBuffer) Push(bs []byte) (dropped int, err error) {
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.closed {
+		return 0, errDiskBufferClosed
+	}
+
+	size := int64(diskBufferRecordHeaderSize + len(bs))
+
+	if b.limit > 0 && b.count > 0 && b.usage+size > b.limit {
+		pos := b.head
+		err := b.scan(b.head, false, func(r diskRecord, n int64) bool {
+			pos = r.next
+			dropped++
+			b.usage -= n
+			b.count--
+			return b.count > 0 && b.usage+size > b.limit
+		})
+		if err != nil {
+			return dropped, err
+		}
+		if err := b.advance(pos); err != nil {
+			return dropped, err
+		}
+	}
+
+	last := &b.segments[len(b.segments)-1]
+
+	if last.size > 0 && last.size+size > b.segSize {
+		if err := b.roll(); err != nil {
+			return dropped, err
+		}
+		last = &b.segments[len(b.segments)-1]
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(bs)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(bs))
+	copy(buf[diskBufferRecordHeaderSize:], bs)
+
+	// A single write keeps the segment readable up to the last complete
+	// record if OPA is stopped in the middle of it.
+	n, err := b.active.Write(buf)
+	last.size += int64(n)
+	if err != nil {
+		return dropped, err
+	}
+
+	b.usage += size
+	b.count++
+
+	return dropped, nil
+}
+
+// Peek returns the oldest unacknowledged records without removing them. It
+// returns at least one record if the buffer is not empty, and stops before the
+// payload total exceeds maxBytes.
+func (b *diskBuffer) Peek(maxBytes int64) ([]diskRecord, error) {
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.closed {
+		return nil, errDiskBufferClosed
+	}
+
+	var result []diskRecord
+	var total int64
+
+	err := b.scan(b.head, true, func(r diskRecord, _ int64) bool {
+		if len(result) > 0 && total+int64(len(r.bs)) > maxBytes {
+			return false
+		}
+		result = append(result, r)
+		total += int64(len(r.bs))
+		return true
+	})
+
+	return result, err
+}
+
+// Ack removes all records before pos from the buffer. Records that have been
+// dropped in the meantime are skipped.
+func (b *diskBuffer) Ack(pos diskPos) error {
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.closed {
+		return errDiskBufferClosed
+	}
+
+	if !b.head.less(pos) {
+		return nil
+	}
+
+	err := b.scan(b.head, false, func(r diskRecord, n int64) bool {
+		if pos.less(r.next) {
+			return false
+		}
+		b.usage -= n
+		b.count--
+		return r.next.less(pos)
+	})
+	if err != nil {
+		return err
+	}
+
+	return b.advance(pos)
+}
+
+// Len returns the number of unacknowledged records.
+func (b *diskBuffer) Len() int64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.count
+}
+
+// Size returns the number of bytes held by unacknowledged records.
+func (b *diskBuffer) Size() int64 {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.usage
+}
+
+// SetLimit updates the size limit. It is enforced on the next push.
+func (b *diskBuffer) SetLimit(limit int64) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.limit = limit
+}
+
+func (b *diskBuffer) Close() error {
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	b.closed = true
+
+	if err := b.active.Sync(); err != nil {
+		b.active.Close()
+		return err
+	}
+
+	return b.active.Close()
+}
+
+// scan calls fn with every record from pos onwards along with its size on
+// disk until fn returns false. The payload is only read if payload is true.
+func (b *diskBuffer) scan(pos diskPos, payload bool, fn func(diskRecord, int64) bool) error {
+
+	for _, seg := range b.segments {
+
+		if seg.id < pos.Segment {
+			continue
+		}
+
+		offset := int64(0)
+		if seg.id == pos.Segment {
+			offset = pos.Offset
+		}
+
+		if offset >= seg.size {
+			continue
+		}
+
+		cont, err := b.scanSegment(seg, offset, payload, fn)
+		if err != nil {
+			return err
+		}
+
+		if !cont {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (b *diskBuffer) scanSegment(seg diskSegment, offset int64, payload bool, fn func(diskRecord, int64) bool) (bool, error) {
+
+	f, err := os.Open(b.segmentPath(seg.id))
+	if err != nil {
+		return false, err
+	}
+
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	r := bufio.NewReader(f)
+	var header [diskBufferRecordHeaderSize]byte
+
+	for offset < seg.size {
+
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return false, err
+		}
+
+		n := int64(binary.BigEndian.Uint32(header[0:4]))
+
+		var bs []byte
+		if payload {
+			bs = make([]byte, n)
+			if _, err := io.ReadFull(r, bs); err != nil {
+				return false, err
+			}
+		} else if _, err := r.Discard(int(n)); err != nil {
+			return false, err
+		}
+
+		offset += diskBufferRecordHeaderSize + n
+
+		if !fn(diskRecord{bs: bs, next: diskPos{Segment: seg.id, Offset: offset}}, diskBufferRecordHeaderSize+n) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// advance moves the head to pos, persists it and removes the segments that
+// precede it.
+func (b *diskBuffer) advance(pos diskPos) error {
+
+	b.head = pos
+
+	// Move past the end of a completed segment so that it can be removed.
+	for i := 0; i < len(b.segments)-1; i++ {
+		if b.segments[i].id == b.head.Segment && b.head.Offset >= b.segments[i].size {
+			b.head = diskPos{Segment: b.segments[i+1].id}
+		}
+	}
+
+	if err := b.writeCursor(); err != nil {
+		return err
+	}
+
+	var i int
+	for i < len(b.segments)-1 && b.segments[i].id < b.head.Segment {
+		if err := os.Remove(b.segmentPath(b.segments[i].id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		i++
+	}
+
+	b.segments = b.segments[i:]
+
+	return nil
+}
+
+// roll closes the active segment and starts a new one.
+func (b *diskBuffer) roll() error {
+
+	if err := b.active.Sync(); err != nil {
+		return err
+	}
+
+	if err := b.active.Close(); err != nil {
+		return err
+	}
+
+	id := b.segments[len(b.segments)-1].id + 1
+
+	f, err := os.OpenFile(b.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	b.active = f
+	b.segments = append(b.segments, diskSegment{id: id})
+
+	return nil
+}
+
+// recover loads the segments following the cursor, truncates segments at the
+// first invalid record and computes the backlog. Segments preceding the cursor
+// are removed.
+func (b *diskBuffer) recover() error {
+
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, diskBufferSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, diskBufferSegmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+		if id < b.head.Segment {
+			if err := os.Remove(filepath.Join(b.dir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+		b.segments = append(b.segments, diskSegment{id: id})
+	}
+
+	sort.Slice(b.segments, func(i, j int) bool {
+		return b.segments[i].id < b.segments[j].id
+	})
+
+	if len(b.segments) == 0 {
+		id := b.head.Segment
+		if b.head.Offset > 0 {
+			id++
+		}
+		b.segments = []diskSegment{{id: id}}
+		b.head = diskPos{Segment: id}
+		return nil
+	}
+
+	if b.segments[0].id != b.head.Segment {
+		b.head = diskPos{Segment: b.segments[0].id}
+	}
+
+	for i := range b.segments {
+
+		offset := int64(0)
+		if i == 0 {
+			offset = b.head.Offset
+		}
+
+		size, usage, count, err := b.verifySegment(b.segments[i].id, offset)
+		if err != nil {
+			return err
+		}
+
+		if i == 0 && size < offset {
+			b.head.Offset = size
+		}
+
+		b.segments[i].size = size
+		b.usage += usage
+		b.count += count
+	}
+
+	return nil
+}
+
+// verifySegment reads the records of segment id from offset onwards and
+// truncates the segment after the last valid record. It returns the resulting
+// size of the segment, along with the size and number of the records read.
+func (b *diskBuffer) verifySegment(id uint64, offset int64) (size int64, usage int64, count int64, err error) {
+
+	path := b.segmentPath(id)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, 0, 0, err
+	}
+
+	if info.Size() < offset {
+		f.Close()
+		return info.Size(), 0, 0, nil
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return 0, 0, 0, err
+	}
+
+	r := bufio.NewReader(f)
+	var header [diskBufferRecordHeaderSize]byte
+	size = offset
+
+	for size < info.Size() {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			break
+		}
+		n := int64(binary.BigEndian.Uint32(header[0:4]))
+		if size+diskBufferRecordHeaderSize+n > info.Size() {
+			break
+		}
+		bs := make([]byte, n)
+		if _, err := io.ReadFull(r, bs); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(bs) != binary.BigEndian.Uint32(header[4:8]) {
+			break
+		}
+		size += diskBufferRecordHeaderSize + n
+		usage += diskBufferRecordHeaderSize + n
+		count++
+	}
+
+	if err := f.Close(); err != nil {
+		return 0, 0, 0, err
+	}
+
+	if size < info.Size() {
+		if err := os.Truncate(path, size); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	return size, usage, count, nil
+}
+
+func (b *diskBuffer) readCursor() error {
+
+	bs, err := os.ReadFile(filepath.Join(b.dir, diskBufferCursorFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(bs, &b.head); err != nil {
+		return fmt.Errorf("corrupted disk buffer cursor: %w", err)
+	}
+
+	return nil
+}
+
+// writeCursor persists the head. The cursor is replaced atomically so that a
+// partial write cannot corrupt it.
+func (b *diskBuffer) writeCursor() error {
+
+	bs, err := json.Marshal(b.head)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(b.dir, diskBufferCursorFile)
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, bs, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (b *diskBuffer) segmentPath(id uint64) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%016x%s", id, diskBufferSegmentExt))
+}
@@ -0,0 +1,273 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiskBuffer(t *testing.T) {
+
+	dir := t.TempDir()
+
+	b, err := openDiskBuffer(dir, 0, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Records are 8 + 19 bytes, so every segment holds two of them.
+	for i := 0; i < 5; i++ {
+		if _, err := b.Push([]byte(fmt.Sprintf(`{"decision_id":"%d"}`, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertDiskBuffer(t, b, 5, 3)
+
+	records, err := b.Peek(45)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertRecords(t, records, "0", "1")
+
+	if err := b.Ack(records[len(records)-1].next); err != nil {
+		t.Fatal(err)
+	}
+
+	assertDiskBuffer(t, b, 3, 2)
+
+	records, err = b.Peek(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertRecords(t, records, "2")
+
+	// Acknowledge the first record after reopening the buffer so that its
+	// upload is repeated, i.e., delivery is at-least-once.
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = openDiskBuffer(dir, 0, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer b.Close()
+
+	assertDiskBuffer(t, b, 3, 2)
+
+	all, err := b.Peek(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertRecords(t, all, "2", "3", "4")
+
+	if err := b.Ack(records[0].next); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Push([]byte(`{"decision_id":"5"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Ack(all[len(all)-1].next); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err = b.Peek(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertRecords(t, all, "5")
+	assertDiskBuffer(t, b, 1, 1)
+}
+
+func TestDiskBufferLimit(t *testing.T) {
+
+	b, err := openDiskBuffer(t.TempDir(), 60, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer b.Close()
+
+	var dropped int
+
+	for i := 0; i < 5; i++ {
+		n, err := b.Push([]byte(fmt.Sprintf(`{"decision_id":"%d"}`, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dropped += n
+	}
+
+	if dropped != 3 {
+		t.Fatalf("expected 3 dropped records, got %v", dropped)
+	}
+
+	if b.Size() != 54 {
+		t.Fatalf("expected usage of 54 bytes, got %v", b.Size())
+	}
+
+	records, err := b.Peek(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertRecords(t, records, "3", "4")
+	assertDiskBuffer(t, b, 2, 2)
+
+	// Acknowledging dropped records has no effect.
+	if err := b.Ack(diskPos{}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertDiskBuffer(t, b, 2, 2)
+}
+
+func TestDiskBufferRecoverTornWrite(t *testing.T) {
+
+	dir := t.TempDir()
+
+	b, err := openDiskBuffer(dir, 0, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := b.Push([]byte(fmt.Sprintf(`{"decision_id":"%d"}`, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a write that was interrupted after the record header.
+	f, err := os.OpenFile(b.segmentPath(0), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write([]byte{0, 0, 0, 20, 1, 2, 3, 4, '{'}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = openDiskBuffer(dir, 0, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer b.Close()
+
+	if _, err := b.Push([]byte(`{"decision_id":"2"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := b.Peek(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertRecords(t, records, "0", "1", "2")
+	assertDiskBuffer(t, b, 3, 1)
+}
+
+func TestEncodeChunk(t *testing.T) {
+
+	var events [][]byte
+	for i := 0; i < 100; i++ {
+		bs, err := encodeEvent(EventV1{DecisionID: fmt.Sprintf("decision-%d-%s", i, strings.Repeat("x", i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, bs)
+	}
+
+	var decoded []EventV1
+
+	for len(events) > 0 {
+		chunk, n, err := encodeChunk(events, 200)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(chunk) > 200 {
+			t.Fatalf("expected chunk within limit, got %v bytes", len(chunk))
+		}
+
+		result, err := newChunkDecoder(chunk).decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result) != n {
+			t.Fatalf("expected %v events in chunk, got %v", n, len(result))
+		}
+
+		decoded = append(decoded, result...)
+		events = events[n:]
+	}
+
+	for i, event := range decoded {
+		if exp := fmt.Sprintf("decision-%d-%s", i, strings.Repeat("x", i)); event.DecisionID != exp {
+			t.Fatalf("expected %v but got %v", exp, event.DecisionID)
+		}
+	}
+
+	if _, _, err := encodeChunk([][]byte{[]byte(`"` + strings.Repeat("x", 100) + `"`)}, 20); err == nil {
+		t.Fatal("expected error for event exceeding the limit")
+	}
+}
+
+func assertDiskBuffer(t *testing.T, b *diskBuffer, count int64, segments int) {
+	t.Helper()
+
+	if b.Len() != count {
+		t.Fatalf("expected %v records, got %v", count, b.Len())
+	}
+
+	files, err := filepath.Glob(filepath.Join(b.dir, "*"+diskBufferSegmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != segments || len(b.segments) != segments {
+		t.Fatalf("expected %v segments, got %v (%v tracked)", segments, len(files), len(b.segments))
+	}
+}
+
+func assertRecords(t *testing.T, records []diskRecord, ids ...string) {
+	t.Helper()
+
+	var result []string
+	for _, r := range records {
+		result = append(result, string(r.bs))
+	}
+
+	var exp []string
+	for _, id := range ids {
+		exp = append(exp, fmt.Sprintf(`{"decision_id":"%s"}`, id))
+	}
+
+	if !reflect.DeepEqual(result, exp) {
+		t.Fatalf("expected records %v, got %v", exp, result)
+	}
+}
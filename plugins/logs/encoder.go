@@ -22,6 +22,10 @@ const (
 	encSoftLimitScaleUpCounterName     = "enc_soft_limit_scale_up"
 	encSoftLimitScaleDownCounterName   = "enc_soft_limit_scale_down"
 	encSoftLimitStableCounterName      = "enc_soft_limit_stable"
+
+	// encChunkCloseOverhead bounds the bytes added to a flushed chunk by the
+	// closing bracket and the gzip footer.
+	encChunkCloseOverhead = 16
 )
 
 // chunkEncoder implements log buffer chunking and compression. Log events are
@@ -55,13 +59,21 @@ func (enc *chunkEncoder) WithMetrics(m metrics.Metrics) *chunkEncoder {
 	return enc
 }
 
-func (enc *chunkEncoder) Write(event EventV1) (result [][]byte, err error) {
+// encodeEvent returns the JSON encoding of event followed by a newline. The
+// same encoding is used for uploaded chunks and for the local sinks.
+func encodeEvent(event EventV1) ([]byte, error) {
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(event); err != nil {
 		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	bs := buf.Bytes()
+func (enc *chunkEncoder) Write(event EventV1) (result [][]byte, err error) {
+	bs, err := encodeEvent(event)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(bs) == 0 {
 		return nil, nil
@@ -124,6 +136,79 @@ func (enc *chunkEncoder) Flush() ([][]byte, error) {
 	return enc.reset()
 }
 
+// encodeChunk encodes the longest prefix of the encoded events that fits in an
+// upload chunk of at most limit bytes. It returns the chunk and the number of
+// events it holds. Unlike the chunkEncoder, it keeps track of which events are
+// part of the chunk so that they can be acknowledged once it has been uploaded.
+func encodeChunk(events [][]byte, limit int64) ([]byte, int, error) {
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	n := 0
+
+	// Flushing after every event gives an upper bound of the compressed size.
+	for n < len(events) {
+		sep := []byte(`,`)
+		if n == 0 {
+			sep = []byte(`[`)
+		}
+		if _, err := w.Write(sep); err != nil {
+			return nil, 0, err
+		}
+		if _, err := w.Write(events[n]); err != nil {
+			return nil, 0, err
+		}
+		if err := w.Flush(); err != nil {
+			return nil, 0, err
+		}
+		if int64(buf.Len()+encChunkCloseOverhead) > limit {
+			break
+		}
+		n++
+	}
+
+	for ; n > 0; n-- {
+		chunk, err := writeChunk(events[:n])
+		if err != nil {
+			return nil, 0, err
+		}
+		if int64(len(chunk)) <= limit {
+			return chunk, n, nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("upload chunk size exceeds upload_size_limit_bytes (%d)", limit)
+}
+
+func writeChunk(events [][]byte) ([]byte, error) {
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+
+	for i, bs := range events {
+		sep := []byte(`,`)
+		if i == 0 {
+			sep = []byte(`[`)
+		}
+		if _, err := w.Write(sep); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(bs); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := w.Write([]byte(`]`)); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
 //nolint:unconvert
 func (enc *chunkEncoder) reset() ([][]byte, error) {
 
@@ -0,0 +1,284 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFileSinkMaxSizeBytes = int64(100 * 1024 * 1024) // 100MiB
+	fileSinkBackupTimeFormat    = "2006-01-02T15-04-05.000"
+	fileSinkCompressedExt       = ".gz"
+)
+
+// FileSinkConfig represents the configuration of the rotating file sink.
+type FileSinkConfig struct {
+	Path          string `json:"path"`                      // path of the active log file
+	MaxSizeBytes  *int64 `json:"max_size_bytes,omitempty"`  // rotate once the active file would exceed this size
+	MaxAgeSeconds int64  `json:"max_age_seconds,omitempty"` // rotate once the active file is older than this; 0 disables age based rotation
+	MaxBackups    int    `json:"max_backups,omitempty"`     // number of rotated files to retain; 0 retains all
+	Compress      bool   `json:"compress,omitempty"`        // gzip rotated files
+}
+
+func (c *FileSinkConfig) validateAndInjectDefaults() error {
+
+	if c.Path == "" {
+		return fmt.Errorf("missing path in decision_logs file sink")
+	}
+
+	if c.MaxSizeBytes == nil {
+		size := defaultFileSinkMaxSizeBytes
+		c.MaxSizeBytes = &size
+	} else if *c.MaxSizeBytes <= 0 {
+		return fmt.Errorf("max_size_bytes must be positive in decision_logs file sink")
+	}
+
+	if c.MaxAgeSeconds < 0 {
+		return fmt.Errorf("max_age_seconds must not be negative in decision_logs file sink")
+	}
+
+	if c.MaxBackups < 0 {
+		return fmt.Errorf("max_backups must not be negative in decision_logs file sink")
+	}
+
+	return nil
+}
+
+// fileSink appends events to a file and rotates it when it reaches the
+// configured size or age. Rotated files are renamed to include the time of
+// rotation, e.g., decisions-2023-01-02T15-04-05.000.log, and optionally
+// compressed.
+type fileSink struct {
+	config  FileSinkConfig
+	mtx     sync.Mutex
+	f       *os.File
+	size    int64
+	created time.Time
+	wg      sync.WaitGroup // tracks rotated files being compressed
+	now     func() time.Time
+}
+
+func newFileSink(config *FileSinkConfig) *fileSink {
+	return &fileSink{config: *config, now: time.Now}
+}
+
+func (s *fileSink) Name() string {
+	return "file"
+}
+
+func (s *fileSink) Write(bs []byte) error {
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.size > 0 && (s.size+int64(len(bs)) > *s.config.MaxSizeBytes || s.expired()) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.f.Write(bs)
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileSink) Close() error {
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var err error
+	if s.f != nil {
+		err = s.f.Close()
+		s.f = nil
+	}
+
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *fileSink) expired() bool {
+	if s.config.MaxAgeSeconds == 0 {
+		return false
+	}
+	return s.now().Sub(s.created) >= time.Duration(s.config.MaxAgeSeconds)*time.Second
+}
+
+// open opens the active log file for appending, creating it if needed. The age
+// of an existing file is taken from its modification time.
+func (s *fileSink) open() error {
+
+	if err := os.MkdirAll(filepath.Dir(s.config.Path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f = f
+	s.size = info.Size()
+	s.created = s.now()
+
+	if s.size > 0 {
+		s.created = info.ModTime()
+	}
+
+	return nil
+}
+
+func (s *fileSink) rotate() error {
+
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+
+	s.f = nil
+
+	backup := s.backupName(s.now())
+	if err := os.Rename(s.config.Path, backup); err != nil {
+		return err
+	}
+
+	if s.config.Compress {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			// Errors are dropped here: the uncompressed backup is kept and
+			// remains subject to the retention limit.
+			if err := compressFile(backup); err == nil {
+				_ = s.prune()
+			}
+		}()
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	return s.prune()
+}
+
+func (s *fileSink) backupName(t time.Time) string {
+	dir, base := filepath.Split(s.config.Path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext)
+	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, t.UTC().Format(fileSinkBackupTimeFormat), ext))
+}
+
+// backups returns the rotated files of the sink ordered from oldest to newest.
+func (s *fileSink) backups() ([]string, error) {
+
+	dir, base := filepath.Split(s.config.Path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), fileSinkCompressedExt)
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		if _, err := time.Parse(fileSinkBackupTimeFormat, ts); err != nil {
+			continue
+		}
+		result = append(result, filepath.Join(dir, e.Name()))
+	}
+
+	// The timestamp format sorts chronologically.
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// prune removes the oldest rotated files exceeding the retention limit.
+func (s *fileSink) prune() error {
+
+	if s.config.MaxBackups == 0 {
+		return nil
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(backups)-s.config.MaxBackups; i++ {
+		if err := os.Remove(backups[i]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func compressFile(path string) error {
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+fileSinkCompressedExt, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := gzip.NewWriter(dst)
+
+	if _, err := io.Copy(w, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+
+	return os.Remove(path)
+}
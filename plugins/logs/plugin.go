@@ -64,10 +64,51 @@ type EventV1 struct {
 	Timestamp      time.Time               `json:"timestamp"`
 	Metrics        map[string]interface{}  `json:"metrics,omitempty"`
 	RequestID      uint64                  `json:"req_id,omitempty"`
+	Shadow         *ShadowV1               `json:"shadow,omitempty"`
 
 	inputAST ast.Value
 }
 
+// ShadowV1 describes the evaluation of a decision against the shadow bundles.
+// It is only set on the events logged for decisions whose shadow evaluation
+// diverged from the live decision.
+type ShadowV1 struct {
+	Bundles map[string]BundleInfoV1 `json:"bundles,omitempty"`
+	Result  *interface{}            `json:"result,omitempty"`
+	Error   error                   `json:"error,omitempty"`
+}
+
+// AST returns the ShadowV1 as an AST value
+func (s *ShadowV1) AST() (ast.Value, error) {
+	result := ast.NewObject()
+
+	if len(s.Bundles) > 0 {
+		bundlesObj := ast.NewObject()
+		for k, v := range s.Bundles {
+			bundlesObj.Insert(ast.StringTerm(k), ast.NewTerm(v.AST()))
+		}
+		result.Insert(bundlesKey, ast.NewTerm(bundlesObj))
+	}
+
+	if s.Result != nil {
+		results, err := roundtripJSONToAST(s.Result)
+		if err != nil {
+			return nil, err
+		}
+		result.Insert(resultKey, ast.NewTerm(results))
+	}
+
+	if s.Error != nil {
+		evalErr, err := roundtripJSONToAST(s.Error)
+		if err != nil {
+			return nil, err
+		}
+		result.Insert(errorKey, ast.NewTerm(evalErr))
+	}
+
+	return result, nil
+}
+
 // BundleInfoV1 describes a bundle associated with a decision log event.
 type BundleInfoV1 struct {
 	Revision string `json:"revision,omitempty"`
@@ -100,6 +141,7 @@ var requestedByKey = ast.StringTerm("requested_by")
 var timestampKey = ast.StringTerm("timestamp")
 var metricsKey = ast.StringTerm("metrics")
 var requestIDKey = ast.StringTerm("req_id")
+var shadowKey = ast.StringTerm("shadow")
 
 // AST returns the Rego AST representation for a given EventV1 object.
 // This avoids having to round trip through JSON while applying a decision log
@@ -222,6 +264,14 @@ func (e *EventV1) AST() (ast.Value, error) {
 		event.Insert(requestIDKey, ast.UIntNumberTerm(e.RequestID))
 	}
 
+	if e.Shadow != nil {
+		shadow, err := e.Shadow.AST()
+		if err != nil {
+			return nil, err
+		}
+		event.Insert(shadowKey, ast.NewTerm(shadow))
+	}
+
 	return event, nil
 }
 
@@ -249,30 +299,39 @@ const (
 	logNDBDropCounterName               = "decision_logs_nd_builtin_cache_dropped"
 	logBufferSizeLimitExDropCounterName = "decision_logs_dropped_buffer_size_limit_bytes_exceeded"
 	logEncodingFailureCounterName       = "decision_logs_encoding_failure"
+	logSinkFailureCounterName           = "decision_logs_sink_failure"
+	logSinkDropCounterName              = "decision_logs_sink_dropped"
+	logDiskBufferDropCounterName        = "decision_logs_disk_buffer_dropped_events"
+	logDiskBufferFailureCounterName     = "decision_logs_disk_buffer_failure"
+	diskBufferReadFactor                = 10 // uncompressed bytes read from the disk buffer per byte of upload limit
 	defaultResourcePath                 = "/logs"
 )
 
 // ReportingConfig represents configuration for the plugin's reporting behaviour.
 type ReportingConfig struct {
-	BufferSizeLimitBytes  *int64               `json:"buffer_size_limit_bytes,omitempty"`  // max size of in-memory buffer
+	BufferSizeLimitBytes  *int64               `json:"buffer_size_limit_bytes,omitempty"`  // max size of in-memory or disk buffer
 	UploadSizeLimitBytes  *int64               `json:"upload_size_limit_bytes,omitempty"`  // max size of upload payload
 	MinDelaySeconds       *int64               `json:"min_delay_seconds,omitempty"`        // min amount of time to wait between successful poll attempts
 	MaxDelaySeconds       *int64               `json:"max_delay_seconds,omitempty"`        // max amount of time to wait between poll attempts
 	MaxDecisionsPerSecond *float64             `json:"max_decisions_per_second,omitempty"` // max number of decision logs to buffer per second
 	Trigger               *plugins.TriggerMode `json:"trigger,omitempty"`                  // trigger mode
+	DiskBuffer            *DiskBufferConfig    `json:"disk_buffer,omitempty"`              // persist buffered decisions on disk
 }
 
 // Config represents the plugin configuration.
 type Config struct {
-	Plugin          *string         `json:"plugin"`
-	Service         string          `json:"service"`
-	PartitionName   string          `json:"partition_name,omitempty"`
-	Reporting       ReportingConfig `json:"reporting"`
-	MaskDecision    *string         `json:"mask_decision"`
-	DropDecision    *string         `json:"drop_decision"`
-	ConsoleLogs     bool            `json:"console"`
-	Resource        *string         `json:"resource"`
-	NDBuiltinCache  bool            `json:"nd_builtin_cache,omitempty"`
+	Plugin          *string           `json:"plugin"`
+	Service         string            `json:"service"`
+	PartitionName   string            `json:"partition_name,omitempty"`
+	Reporting       ReportingConfig   `json:"reporting"`
+	MaskDecision    *string           `json:"mask_decision"`
+	DropDecision    *string           `json:"drop_decision"`
+	ConsoleLogs     bool              `json:"console"`
+	File            *FileSinkConfig   `json:"file,omitempty"`
+	Syslog          *SyslogSinkConfig `json:"syslog,omitempty"`
+	Stdout          bool              `json:"stdout,omitempty"`
+	Resource        *string           `json:"resource"`
+	NDBuiltinCache  bool              `json:"nd_builtin_cache,omitempty"`
 	maskDecisionRef ast.Ref
 	dropDecisionRef ast.Ref
 }
@@ -290,11 +349,12 @@ func (c *Config) validateAndInjectDefaults(services []string, pluginsList []stri
 		if !found {
 			return fmt.Errorf("invalid plugin name %q in decision_logs", *c.Plugin)
 		}
-	} else if c.Service == "" && len(services) != 0 && !c.ConsoleLogs {
+	} else if c.Service == "" && len(services) != 0 && !c.ConsoleLogs && !c.localSinks() {
 		// For backwards compatibility allow defaulting to the first
-		// service listed, but only if console logging is disabled. If enabled
-		// we can't tell if the deployer wanted to use only console logs or
-		// both console logs and the default service option.
+		// service listed, but only if console logging and local sinks are
+		// disabled. If enabled we can't tell if the deployer wanted to use
+		// only local logging or both local logging and the default service
+		// option.
 		c.Service = services[0]
 	} else if c.Service != "" {
 		found := false
@@ -311,6 +371,18 @@ func (c *Config) validateAndInjectDefaults(services []string, pluginsList []stri
 		}
 	}
 
+	if c.File != nil {
+		if err := c.File.validateAndInjectDefaults(); err != nil {
+			return err
+		}
+	}
+
+	if c.Syslog != nil {
+		if err := c.Syslog.validateAndInjectDefaults(); err != nil {
+			return err
+		}
+	}
+
 	t, err := plugins.ValidateAndInjectDefaultsForTriggerMode(trigger, c.Reporting.Trigger)
 	if err != nil {
 		return fmt.Errorf("invalid decision_log config: %w", err)
@@ -360,6 +432,12 @@ func (c *Config) validateAndInjectDefaults(services []string, pluginsList []stri
 
 	c.Reporting.BufferSizeLimitBytes = &bufferLimit
 
+	if c.Reporting.DiskBuffer != nil {
+		if err := c.Reporting.DiskBuffer.validateAndInjectDefaults(); err != nil {
+			return err
+		}
+	}
+
 	if c.MaskDecision == nil {
 		maskDecision := defaultMaskDecisionPath
 		c.MaskDecision = &maskDecision
@@ -395,12 +473,19 @@ func (c *Config) validateAndInjectDefaults(services []string, pluginsList []stri
 	return nil
 }
 
+// localSinks returns true if any of the file, syslog or stdout sinks is
+// enabled.
+func (c *Config) localSinks() bool {
+	return c.File != nil || c.Syslog != nil || c.Stdout
+}
+
 // Plugin implements decision log buffering and uploading.
 type Plugin struct {
 	manager   *plugins.Manager
 	config    Config
 	buffer    *logBuffer
 	enc       *chunkEncoder
+	disk      *diskBuffer
 	mtx       sync.Mutex
 	stop      chan chan struct{}
 	reconfig  chan reconfigure
@@ -412,6 +497,9 @@ type Plugin struct {
 	metrics   metrics.Metrics
 	logger    logging.Logger
 	status    *lstat.Status
+	sinks     []sink
+	queues    []*sinkQueue // deliver events to sinks once the plugin is started
+	sinksMtx  sync.RWMutex
 }
 
 type reconfigure struct {
@@ -479,7 +567,7 @@ func (b *ConfigBuilder) Parse() (*Config, error) {
 		return nil, err
 	}
 
-	if parsedConfig.Plugin == nil && parsedConfig.Service == "" && len(b.services) == 0 && !parsedConfig.ConsoleLogs {
+	if parsedConfig.Plugin == nil && parsedConfig.Service == "" && len(b.services) == 0 && !parsedConfig.ConsoleLogs && !parsedConfig.localSinks() {
 		// Nothing to validate or inject
 		return nil, nil
 	}
@@ -503,6 +591,7 @@ func New(parsedConfig *Config, manager *plugins.Manager) *Plugin {
 		reconfig: make(chan reconfigure),
 		logger:   manager.Logger().WithFields(map[string]interface{}{"plugin": Name}),
 		status:   &lstat.Status{},
+		sinks:    newSinks(parsedConfig),
 	}
 
 	if parsedConfig.Reporting.MaxDecisionsPerSecond != nil {
@@ -538,6 +627,12 @@ func Lookup(manager *plugins.Manager) *Plugin {
 // Start starts the plugin.
 func (p *Plugin) Start(ctx context.Context) error {
 	p.logger.Info("Starting decision logger.")
+	if err := p.openDiskBuffer(); err != nil {
+		return err
+	}
+	p.sinksMtx.Lock()
+	p.queues = p.startSinkQueues()
+	p.sinksMtx.Unlock()
 	go p.loop()
 	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateOK})
 	return nil
@@ -556,6 +651,16 @@ func (p *Plugin) Stop(ctx context.Context) {
 	done := make(chan struct{})
 	p.stop <- done
 	<-done
+
+	p.sinksMtx.Lock()
+	queues := p.queues
+	p.sinks, p.queues = nil, nil
+	p.sinksMtx.Unlock()
+
+	p.closeSinkQueues(ctx, queues)
+
+	p.closeDiskBuffer()
+
 	p.manager.UpdatePluginStatus(Name, &plugins.Status{State: plugins.StateNotReady})
 }
 
@@ -615,6 +720,17 @@ func (p *Plugin) Log(ctx context.Context, decision *server.Info) error {
 		inputAST:       decision.InputAST,
 	}
 
+	if decision.Shadow != nil {
+		event.Shadow = &ShadowV1{
+			Bundles: map[string]BundleInfoV1{},
+			Result:  decision.Shadow.Results,
+			Error:   decision.Shadow.Error,
+		}
+		for name, info := range decision.Shadow.Bundles {
+			event.Shadow.Bundles[name] = BundleInfoV1{Revision: info.Revision}
+		}
+	}
+
 	input, err := event.AST()
 	if err != nil {
 		return err
@@ -651,6 +767,8 @@ func (p *Plugin) Log(ctx context.Context, decision *server.Info) error {
 		}
 	}
 
+	p.writeToSinks(event)
+
 	if p.config.Service != "" {
 		p.mtx.Lock()
 		p.encodeAndBufferEvent(event)
@@ -784,6 +902,10 @@ func (p *Plugin) doOneShot(ctx context.Context) error {
 	// increased latency for OPA clients
 	p.mtx.Lock()
 	p.status.SetError(err)
+	if p.disk != nil {
+		p.status.BacklogEvents = p.disk.Len()
+		p.status.BacklogBytes = p.disk.Size()
+	}
 	oldStatus := p.status
 	p.mtx.Unlock()
 
@@ -802,6 +924,25 @@ func (p *Plugin) doOneShot(ctx context.Context) error {
 }
 
 func (p *Plugin) oneShot(ctx context.Context) (ok bool, err error) {
+
+	ok, err = p.uploadMemoryBuffer(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	p.mtx.Lock()
+	disk := p.disk
+	p.mtx.Unlock()
+
+	if disk == nil {
+		return ok, nil
+	}
+
+	uploaded, err := p.uploadDiskBuffer(ctx, disk)
+	return ok || uploaded, err
+}
+
+func (p *Plugin) uploadMemoryBuffer(ctx context.Context) (ok bool, err error) {
 	// Make a local copy of the plugins's encoder and buffer and create
 	// a new encoder and buffer. This is needed as locking the buffer for
 	// the upload duration will block policy evaluation and result in
@@ -858,6 +999,58 @@ func (p *Plugin) oneShot(ctx context.Context) (ok bool, err error) {
 	return err == nil, err
 }
 
+// uploadDiskBuffer uploads the events in the disk buffer. Events are removed
+// from the buffer once the chunk holding them has been uploaded, so they are
+// delivered at least once: if OPA stops between the upload of a chunk and its
+// acknowledgement, the chunk is uploaded again.
+func (p *Plugin) uploadDiskBuffer(ctx context.Context, disk *diskBuffer) (bool, error) {
+
+	limit := *p.config.Reporting.UploadSizeLimitBytes
+	client := p.manager.Client(p.config.Service)
+
+	var uploaded bool
+
+	for {
+		records, err := disk.Peek(limit * diskBufferReadFactor)
+		if err != nil {
+			return uploaded, err
+		}
+
+		if len(records) == 0 {
+			return uploaded, nil
+		}
+
+		events := make([][]byte, len(records))
+		for i := range records {
+			events[i] = records[i].bs
+		}
+
+		chunk, n, err := encodeChunk(events, limit)
+		if err != nil {
+			// The event does not fit in a chunk, e.g., because the upload size
+			// limit has been lowered. It would block all the other events.
+			if p.metrics != nil {
+				p.metrics.Counter(logEncodingFailureCounterName).Incr()
+			}
+			p.logger.Error("Log encoding failed: %v.", err)
+			if err := disk.Ack(records[0].next); err != nil {
+				return uploaded, err
+			}
+			continue
+		}
+
+		if err := uploadChunk(ctx, client, *p.config.Resource, chunk); err != nil {
+			return uploaded, err
+		}
+
+		if err := disk.Ack(records[n-1].next); err != nil {
+			return true, err
+		}
+
+		uploaded = true
+	}
+}
+
 func (p *Plugin) reconfigure(config interface{}) {
 
 	newConfig := config.(*Config)
@@ -868,7 +1061,139 @@ func (p *Plugin) reconfigure(config interface{}) {
 	}
 
 	p.logger.Info("Decision log uploader configuration changed.")
+	oldConfig := p.config
 	p.config = *newConfig
+
+	if !reflect.DeepEqual(oldConfig.Reporting.DiskBuffer, newConfig.Reporting.DiskBuffer) {
+		// Events left in the previous buffer are uploaded once it is used
+		// again. Events that are in memory are uploaded as usual.
+		p.closeDiskBuffer()
+		if err := p.openDiskBuffer(); err != nil {
+			p.logger.Error("%v. Buffering decisions in memory.", err)
+		}
+	} else {
+		p.mtx.Lock()
+		if p.disk != nil {
+			p.disk.SetLimit(*newConfig.Reporting.BufferSizeLimitBytes)
+		}
+		p.mtx.Unlock()
+	}
+
+	p.sinksMtx.Lock()
+	sinks, queues := p.sinks, p.queues
+	p.sinks = newSinks(newConfig)
+	if queues != nil {
+		p.queues = p.startSinkQueues()
+	}
+	p.sinksMtx.Unlock()
+
+	if queues == nil {
+		for _, s := range sinks {
+			if err := s.Close(); err != nil {
+				p.logger.Error("Failed to close %v sink: %v.", s.Name(), err)
+			}
+		}
+		return
+	}
+
+	// Events queued for the previous sinks are delivered in the background
+	// so that uploads are not held up by slow sinks.
+	go p.closeSinkQueues(context.Background(), queues)
+}
+
+// writeToSinks queues event for every local sink. Events are dropped and
+// counted if a sink cannot keep up; failures do not fail the decision.
+func (p *Plugin) writeToSinks(event EventV1) {
+
+	p.sinksMtx.RLock()
+	defer p.sinksMtx.RUnlock()
+
+	if len(p.queues) == 0 {
+		return
+	}
+
+	bs, err := encodeEvent(event)
+	if err != nil {
+		if p.metrics != nil {
+			p.metrics.Counter(logEncodingFailureCounterName).Incr()
+		}
+		p.logger.Error("Log encoding failed: %v.", err)
+		return
+	}
+
+	for _, q := range p.queues {
+		if !q.enqueue(bs) && p.metrics != nil {
+			p.metrics.Counter(logSinkDropCounterName).Incr()
+		}
+	}
+}
+
+// startSinkQueues starts delivering events to the configured sinks. The caller
+// must hold the sinks lock.
+func (p *Plugin) startSinkQueues() []*sinkQueue {
+	queues := make([]*sinkQueue, len(p.sinks))
+	for i := range p.sinks {
+		queues[i] = newSinkQueue(p.sinks[i], sinkQueueSize, p.sinkFailed)
+	}
+	return queues
+}
+
+func (p *Plugin) sinkFailed(s sink, err error) {
+	if p.metrics != nil {
+		p.metrics.Counter(logSinkFailureCounterName).Incr()
+	}
+	p.logger.Error("Failed to write decision log to %v sink: %v.", s.Name(), err)
+}
+
+// closeSinkQueues waits until the events queued for the sinks have been
+// delivered and the sinks have been closed, or until ctx is done.
+func (p *Plugin) closeSinkQueues(ctx context.Context, queues []*sinkQueue) {
+	for _, q := range queues {
+		if err := q.close(ctx); err != nil {
+			p.logger.Warn("Decision logs for %v sink not delivered before shutdown: %v.", q.sink.Name(), err)
+		}
+	}
+}
+
+// openDiskBuffer opens the disk buffer if one is configured. Events that were
+// buffered before OPA stopped are uploaded along with new events.
+func (p *Plugin) openDiskBuffer() error {
+
+	c := p.config.Reporting.DiskBuffer
+	if c == nil {
+		return nil
+	}
+
+	disk, err := openDiskBuffer(c.Directory, *p.config.Reporting.BufferSizeLimitBytes, *c.SegmentSizeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to open decision log disk buffer: %w", err)
+	}
+
+	if n := disk.Len(); n > 0 {
+		p.logger.Info("Found %v buffered decisions in %v.", n, c.Directory)
+	}
+
+	p.mtx.Lock()
+	p.disk = disk
+	p.mtx.Unlock()
+
+	return nil
+}
+
+func (p *Plugin) closeDiskBuffer() {
+
+	p.mtx.Lock()
+	disk := p.disk
+	p.disk = nil
+	p.mtx.Unlock()
+
+	if disk == nil {
+		return
+	}
+
+	if err := disk.Close(); err != nil {
+		p.logger.Error("Failed to close decision log disk buffer: %v.", err)
+	}
 }
 
 // NOTE(philipc): Because ND builtins caching can cause unbounded growth in
@@ -886,6 +1211,11 @@ func (p *Plugin) encodeAndBufferEvent(event EventV1) {
 		}
 	}
 
+	if p.disk != nil {
+		p.persistEvent(event)
+		return
+	}
+
 	result, err := p.enc.Write(event)
 	if err != nil {
 		// If there's no ND builtins cache in the event, then we don't
@@ -925,6 +1255,54 @@ func (p *Plugin) encodeAndBufferEvent(event EventV1) {
 	}
 }
 
+// persistEvent appends event to the disk buffer. As for the in-memory buffer,
+// the ND builtins cache is dropped if the event does not fit in an upload
+// chunk otherwise.
+func (p *Plugin) persistEvent(event EventV1) {
+
+	limit := *p.config.Reporting.UploadSizeLimitBytes
+
+	bs, err := encodeEvent(event)
+	if err == nil && int64(len(bs)+2) > limit && event.NDBuiltinCache != nil {
+		newEvent := event
+		newEvent.NDBuiltinCache = nil
+		bs, err = encodeEvent(newEvent)
+		if err == nil && int64(len(bs)+2) <= limit {
+			p.logger.Error("ND builtins cache dropped from this event to fit under maximum upload size limits. Increase upload size limit or change usage of non-deterministic builtins.")
+			if p.metrics != nil {
+				p.metrics.Counter(logNDBDropCounterName).Incr()
+			}
+		}
+	}
+
+	if err == nil && int64(len(bs)+2) > limit {
+		err = fmt.Errorf("upload chunk size (%d) exceeds upload_size_limit_bytes (%d)", int64(len(bs)+2), limit)
+	}
+
+	if err != nil {
+		if p.metrics != nil {
+			p.metrics.Counter(logEncodingFailureCounterName).Incr()
+		}
+		p.logger.Error("Log encoding failed: %v.", err)
+		return
+	}
+
+	dropped, err := p.disk.Push(bs)
+	if dropped > 0 {
+		if p.metrics != nil {
+			p.metrics.Counter(logDiskBufferDropCounterName).Add(uint64(dropped))
+		}
+		p.logger.Error("Dropped %v decisions from disk buffer. Reduce reporting interval or increase buffer size.", dropped)
+	}
+
+	if err != nil {
+		if p.metrics != nil {
+			p.metrics.Counter(logDiskBufferFailureCounterName).Incr()
+		}
+		p.logger.Error("Failed to write decision to disk buffer: %v.", err)
+	}
+}
+
 func (p *Plugin) bufferChunk(buffer *logBuffer, bs []byte) {
 	dropped := buffer.Push(bs)
 	if dropped > 0 {
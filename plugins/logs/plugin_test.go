@@ -507,6 +507,88 @@ func TestPluginRequeue(t *testing.T) {
 	}
 }
 
+func TestPluginDiskBufferReplay(t *testing.T) {
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	config := map[string]interface{}{
+		"reporting": map[string]interface{}{
+			"disk_buffer": map[string]interface{}{"directory": dir},
+		},
+	}
+
+	fixture := newTestFixture(t, testFixtureOptions{ExtraConfig: config})
+	defer fixture.server.stop()
+
+	fixture.server.ch = make(chan []EventV1, 1)
+
+	if err := fixture.plugin.openDiskBuffer(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := fixture.plugin.Log(ctx, logServerInfo(id, nil, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fixture.server.expCode = 500
+
+	if _, err := fixture.plugin.oneShot(ctx); err == nil {
+		t.Fatal("Expected error")
+	}
+
+	<-fixture.server.ch
+
+	if err := fixture.plugin.doOneShot(ctx); err == nil {
+		t.Fatal("Expected error")
+	}
+
+	<-fixture.server.ch
+
+	if fixture.plugin.status.BacklogEvents != 3 || fixture.plugin.status.BacklogBytes == 0 {
+		t.Fatalf("Unexpected backlog in status: %+v", fixture.plugin.status)
+	}
+
+	fixture.plugin.closeDiskBuffer()
+
+	// A new plugin using the same directory uploads the buffered events.
+	fixture = newTestFixture(t, testFixtureOptions{ExtraConfig: config})
+	defer fixture.server.stop()
+
+	fixture.server.ch = make(chan []EventV1, 1)
+
+	if err := fixture.plugin.openDiskBuffer(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer fixture.plugin.closeDiskBuffer()
+
+	uploaded, err := fixture.plugin.oneShot(ctx)
+	if !uploaded || err != nil {
+		t.Fatalf("Expected upload, err: %v", err)
+	}
+
+	var ids []string
+	for _, event := range <-fixture.server.ch {
+		ids = append(ids, event.DecisionID)
+	}
+
+	if exp := []string{"a", "b", "c"}; !reflect.DeepEqual(ids, exp) {
+		t.Fatalf("Expected %v but got %v", exp, ids)
+	}
+
+	if n := fixture.plugin.disk.Len(); n != 0 {
+		t.Fatalf("Expected empty disk buffer, got %v events", n)
+	}
+
+	uploaded, err = fixture.plugin.oneShot(ctx)
+	if uploaded || err != nil {
+		t.Fatalf("Unexpected error or upload, err: %v", err)
+	}
+}
+
 func logServerInfo(id string, input interface{}, result interface{}) *server.Info {
 	return &server.Info{
 		DecisionID: id,
@@ -2658,6 +2740,39 @@ func TestEventV1ToAST(t *testing.T) {
 				inputAST:    astInput,
 			},
 		},
+		{
+			note: "event with shadow",
+			event: EventV1{
+				Labels:      map[string]string{"foo": "1", "bar": "2"},
+				DecisionID:  "1234567890",
+				Input:       &goInput,
+				Path:        "/http/authz/allow",
+				RequestedBy: "[::1]:59943",
+				Result:      &result,
+				Timestamp:   time.Now(),
+				inputAST:    astInput,
+				Shadow: &ShadowV1{
+					Bundles: map[string]BundleInfoV1{"candidate": {"revision8"}},
+					Error: rego.Errors{&topdown.Error{
+						Code:    topdown.ConflictErr,
+						Message: "complete rules must not produce multiple outputs",
+					}},
+				},
+			},
+		},
+		{
+			note: "event with shadow result",
+			event: EventV1{
+				Labels:      map[string]string{"foo": "1", "bar": "2"},
+				DecisionID:  "1234567890",
+				Path:        "/http/authz/allow",
+				RequestedBy: "[::1]:59943",
+				Timestamp:   time.Now(),
+				Shadow: &ShadowV1{
+					Result: &result,
+				},
+			},
+		},
 	}
 
 	for _, tc := range cases {
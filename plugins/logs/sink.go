@@ -0,0 +1,134 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// sinkQueueSize is the number of encoded events buffered for each sink before
+// events are dropped.
+const sinkQueueSize = 1024
+
+// sink is a local destination for decision log events. Events are written to
+// the sinks after masking and drop decisions have been applied, in the same
+// JSON encoding used for uploads. Sinks must be safe for concurrent use.
+type sink interface {
+	// Name identifies the sink in logs and errors.
+	Name() string
+
+	// Write writes the encoded event bs, including the trailing newline.
+	Write(bs []byte) error
+
+	// Close releases all resources held by the sink.
+	Close() error
+}
+
+// newSinks returns the sinks enabled in config.
+func newSinks(config *Config) []sink {
+
+	var sinks []sink
+
+	if config.File != nil {
+		sinks = append(sinks, newFileSink(config.File))
+	}
+
+	if config.Syslog != nil {
+		sinks = append(sinks, newSyslogSink(config.Syslog))
+	}
+
+	if config.Stdout {
+		sinks = append(sinks, newWriterSink("stdout", os.Stdout))
+	}
+
+	return sinks
+}
+
+// writerSink writes newline-delimited JSON events to an io.Writer.
+type writerSink struct {
+	name string
+	mtx  sync.Mutex
+	w    io.Writer
+}
+
+func newWriterSink(name string, w io.Writer) *writerSink {
+	return &writerSink{name: name, w: w}
+}
+
+func (s *writerSink) Name() string {
+	return s.name
+}
+
+func (s *writerSink) Write(bs []byte) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, err := s.w.Write(bs)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// sinkQueue delivers encoded events to a sink from a separate goroutine, so
+// that slow sinks, e.g., a syslog server that cannot be reached or a file that
+// is being rotated, never block decisions. Events are dropped if the queue is
+// full. The goroutine closes the sink once the queue is closed and drained.
+type sinkQueue struct {
+	sink sink
+	ch   chan []byte
+	done chan struct{}
+}
+
+// newSinkQueue starts delivering events to s. Failed writes are reported to
+// onError.
+func newSinkQueue(s sink, size int, onError func(sink, error)) *sinkQueue {
+	q := &sinkQueue{
+		sink: s,
+		ch:   make(chan []byte, size),
+		done: make(chan struct{}),
+	}
+	go q.run(onError)
+	return q
+}
+
+func (q *sinkQueue) run(onError func(sink, error)) {
+	defer close(q.done)
+	for bs := range q.ch {
+		if err := q.sink.Write(bs); err != nil {
+			onError(q.sink, err)
+		}
+	}
+	if err := q.sink.Close(); err != nil {
+		onError(q.sink, err)
+	}
+}
+
+// enqueue adds bs to the queue without blocking. It returns false if the queue
+// is full and bs was dropped. enqueue must not be called after close.
+func (q *sinkQueue) enqueue(bs []byte) bool {
+	select {
+	case q.ch <- bs:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops accepting events and waits until the queued events have been
+// delivered and the sink has been closed, or until ctx is done. In the latter
+// case, the remaining events are still delivered in the background.
+func (q *sinkQueue) close(ctx context.Context) error {
+	close(q.ch)
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,473 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/plugins"
+	"github.com/open-policy-agent/opa/server"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+)
+
+func TestParseConfigSinks(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		config  string
+		wantErr string
+		check   func(*testing.T, *Config)
+	}{
+		{
+			note:   "file defaults",
+			config: `{"file": {"path": "/tmp/decisions.log"}}`,
+			check: func(t *testing.T, c *Config) {
+				if *c.File.MaxSizeBytes != defaultFileSinkMaxSizeBytes {
+					t.Errorf("expected default max size, got %d", *c.File.MaxSizeBytes)
+				}
+				if c.Service != "" {
+					t.Errorf("expected no default service, got %q", c.Service)
+				}
+			},
+		},
+		{
+			note:    "file missing path",
+			config:  `{"file": {}}`,
+			wantErr: "missing path in decision_logs file sink",
+		},
+		{
+			note:    "file bad size",
+			config:  `{"file": {"path": "x.log", "max_size_bytes": 0}}`,
+			wantErr: "max_size_bytes must be positive",
+		},
+		{
+			note:   "syslog defaults",
+			config: `{"syslog": {"address": "localhost:514"}}`,
+			check: func(t *testing.T, c *Config) {
+				if c.Syslog.Network != "udp" || c.Syslog.Facility != "local0" || c.Syslog.Severity != "info" || c.Syslog.AppName != "opa" {
+					t.Errorf("unexpected defaults: %+v", c.Syslog)
+				}
+				if c.Syslog.priority != 134 {
+					t.Errorf("expected priority 134, got %d", c.Syslog.priority)
+				}
+			},
+		},
+		{
+			note:    "syslog bad network",
+			config:  `{"syslog": {"network": "http", "address": "localhost:514"}}`,
+			wantErr: `invalid network "http"`,
+		},
+		{
+			note:    "syslog bad facility",
+			config:  `{"syslog": {"address": "localhost:514", "facility": "local9"}}`,
+			wantErr: `invalid facility "local9"`,
+		},
+		{
+			note:   "stdout with service",
+			config: `{"stdout": true, "service": "s0"}`,
+			check: func(t *testing.T, c *Config) {
+				if !c.Stdout || c.Service != "s0" {
+					t.Errorf("unexpected config: %+v", c)
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tc.config), []string{"s0"}, nil)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.check(t, config)
+		})
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "decisions.log")
+	maxSize := int64(20)
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	s := newFileSink(&FileSinkConfig{Path: path, MaxSizeBytes: &maxSize, MaxBackups: 2})
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		if err := s.Write([]byte(`{"decision_id":"x"}` + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{
+		filepath.Join(dir, "decisions-2023-01-02T03-04-07.000.log"),
+		filepath.Join(dir, "decisions-2023-01-02T03-04-08.000.log"),
+	}
+
+	if len(backups) != len(exp) || backups[0] != exp[0] || backups[1] != exp[1] {
+		t.Fatalf("expected backups %v, got %v", exp, backups)
+	}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(bs) != `{"decision_id":"x"}`+"\n" {
+		t.Fatalf("unexpected content: %q", bs)
+	}
+}
+
+func TestFileSinkRotationByAge(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "decisions.log")
+
+	maxSize := defaultFileSinkMaxSizeBytes
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	s := newFileSink(&FileSinkConfig{Path: path, MaxSizeBytes: &maxSize, MaxAgeSeconds: 60, Compress: true})
+	s.now = func() time.Time { return now }
+
+	for _, d := range []time.Duration{0, 30 * time.Second, 31 * time.Second} {
+		now = now.Add(d)
+		if err := s.Write([]byte("{}\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := s.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := filepath.Join(dir, "decisions-2023-01-02T03-05-06.000.log.gz"); len(backups) != 1 || backups[0] != exp {
+		t.Fatalf("expected backup %v, got %v", exp, backups)
+	}
+
+	f, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(bs) != "{}\n{}\n" {
+		t.Fatalf("unexpected content: %q", bs)
+	}
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	config := &SyslogSinkConfig{Address: pc.LocalAddr().String()}
+	if err := config.validateAndInjectDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSyslogSink(config)
+	s.hostname = "host"
+	s.pid = "42"
+	s.now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 6000, time.UTC) }
+	defer s.Close()
+
+	if err := s.Write([]byte(`{"decision_id":"x"}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `<134>1 2023-01-02T03:04:05.000006Z host opa 42 decision - {"decision_id":"x"}`
+	if string(buf[:n]) != exp {
+		t.Fatalf("expected:\n%v\n\ngot:\n%v", exp, string(buf[:n]))
+	}
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan string, 2)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			// Octet counting framing: MSG-LEN SP SYSLOG-MSG
+			prefix, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(prefix))
+			if err != nil {
+				return
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+
+	config := &SyslogSinkConfig{Network: "tcp", Address: l.Addr().String(), Facility: "auth", Severity: "notice", AppName: "authz"}
+	if err := config.validateAndInjectDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSyslogSink(config)
+	defer s.Close()
+
+	for _, id := range []string{"a", "b"} {
+		if err := s.Write([]byte(`{"decision_id":"` + id + `"}` + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"a", "b"} {
+		select {
+		case msg := <-received:
+			if !strings.HasPrefix(msg, "<37>1 ") || !strings.HasSuffix(msg, ` authz `+s.pid+` decision - {"decision_id":"`+id+`"}`) {
+				t.Fatalf("unexpected message: %v", msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
+
+func TestPluginLocalSinks(t *testing.T) {
+
+	ctx := context.Background()
+	store := inmem.New()
+
+	err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		return store.UpsertPolicy(ctx, txn, "test.rego", []byte(`
+			package system.log
+
+			drop { input.path == "dropped" }
+
+			mask["/input/password"]`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := plugins.New(nil, "test", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "decisions.log")
+
+	config, err := ParseConfig([]byte(`{"file": {"path": "`+filepath.ToSlash(path)+`"}}`), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := New(config, manager)
+
+	var stdout bytes.Buffer
+	plugin.sinks = append(plugin.sinks, newWriterSink("stdout", &stdout))
+
+	if err := plugin.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var input interface{} = map[string]interface{}{"user": "alice", "password": "secret"}
+
+	for _, p := range []string{"kept", "dropped"} {
+		if err := plugin.Log(ctx, &server.Info{DecisionID: p, Path: p, Input: &input}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin.Stop(ctx)
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(bs, stdout.Bytes()) {
+		t.Fatalf("expected sinks to receive the same events:\n%s\n%s", bs, stdout.Bytes())
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(bs), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("expected one event, got: %s", bs)
+	}
+
+	var event EventV1
+	if err := json.Unmarshal(lines[0], &event); err != nil {
+		t.Fatal(err)
+	}
+
+	if event.DecisionID != "kept" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	if exp := map[string]interface{}{"user": "alice"}; !equalJSON(*event.Input, exp) {
+		t.Fatalf("expected masked input %v, got %v", exp, *event.Input)
+	}
+
+	if len(event.Erased) != 1 || event.Erased[0] != "/input/password" {
+		t.Fatalf("unexpected erased fields: %v", event.Erased)
+	}
+}
+
+func equalJSON(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+type blockingSink struct {
+	release chan struct{}
+	written chan string
+	closed  chan struct{}
+}
+
+func (*blockingSink) Name() string {
+	return "blocking"
+}
+
+func (s *blockingSink) Write(bs []byte) error {
+	<-s.release
+	s.written <- string(bs)
+	return nil
+}
+
+func (s *blockingSink) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestPluginSinkQueueFull(t *testing.T) {
+
+	ctx := context.Background()
+
+	manager, err := plugins.New(nil, "test", inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ParseConfig([]byte(`{"stdout": true}`), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := metrics.New()
+	plugin := New(config, manager).WithMetrics(m)
+
+	s := &blockingSink{release: make(chan struct{}), written: make(chan string, 10), closed: make(chan struct{})}
+	plugin.sinks = []sink{s}
+	plugin.queues = []*sinkQueue{newSinkQueue(s, 1, plugin.sinkFailed)}
+
+	// The sink blocks, so at most two events are accepted: one being written
+	// and one in the queue. Logging must not block regardless.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, id := range []string{"a", "b", "c"} {
+			plugin.writeToSinks(EventV1{DecisionID: id})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writing to a blocked sink did not return")
+	}
+
+	dropped := m.Counter(logSinkDropCounterName).Value().(uint64)
+	if dropped == 0 {
+		t.Fatal("expected dropped events")
+	}
+
+	close(s.release)
+
+	if err := plugin.queues[0].close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-s.closed:
+	default:
+		t.Fatal("expected sink to be closed")
+	}
+
+	if exp, act := 3-int(dropped), len(s.written); exp != act {
+		t.Fatalf("expected %d events to be written, got %d", exp, act)
+	}
+}
@@ -24,6 +24,11 @@ type Status struct {
 	Message  string          `json:"message,omitempty"`
 	HTTPCode json.Number     `json:"http_code,omitempty"`
 	Metrics  metrics.Metrics `json:"metrics,omitempty"`
+
+	// BacklogEvents and BacklogBytes report the decisions in the disk buffer
+	// that have not been uploaded yet.
+	BacklogEvents int64 `json:"backlog_events,omitempty"`
+	BacklogBytes  int64 `json:"backlog_bytes,omitempty"`
 }
 
 // SetError updates the status object to reflect a failure to upload or
@@ -0,0 +1,188 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSyslogNetwork  = "udp"
+	defaultSyslogFacility = "local0"
+	defaultSyslogSeverity = "info"
+	defaultSyslogAppName  = "opa"
+	syslogMsgID           = "decision"
+	syslogDialTimeout     = 5 * time.Second
+	syslogTimestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var syslogSeverities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// SyslogSinkConfig represents the configuration of the syslog sink.
+type SyslogSinkConfig struct {
+	Network  string `json:"network,omitempty"`  // one of udp, tcp, unix or unixgram
+	Address  string `json:"address"`            // host:port or socket path
+	Facility string `json:"facility,omitempty"` // syslog facility keyword, e.g., local0
+	Severity string `json:"severity,omitempty"` // syslog severity keyword, e.g., info
+	AppName  string `json:"app_name,omitempty"` // APP-NAME field of messages
+
+	priority int
+}
+
+func (c *SyslogSinkConfig) validateAndInjectDefaults() error {
+
+	if c.Address == "" {
+		return fmt.Errorf("missing address in decision_logs syslog sink")
+	}
+
+	if c.Network == "" {
+		c.Network = defaultSyslogNetwork
+	}
+
+	switch c.Network {
+	case "udp", "tcp", "unix", "unixgram":
+	default:
+		return fmt.Errorf("invalid network %q in decision_logs syslog sink", c.Network)
+	}
+
+	if c.Facility == "" {
+		c.Facility = defaultSyslogFacility
+	}
+
+	facility, ok := syslogFacilities[c.Facility]
+	if !ok {
+		return fmt.Errorf("invalid facility %q in decision_logs syslog sink", c.Facility)
+	}
+
+	if c.Severity == "" {
+		c.Severity = defaultSyslogSeverity
+	}
+
+	severity, ok := syslogSeverities[c.Severity]
+	if !ok {
+		return fmt.Errorf("invalid severity %q in decision_logs syslog sink", c.Severity)
+	}
+
+	if c.AppName == "" {
+		c.AppName = defaultSyslogAppName
+	} else if len(c.AppName) > 48 || strings.ContainsAny(c.AppName, " \t\n") {
+		return fmt.Errorf("invalid app_name %q in decision_logs syslog sink", c.AppName)
+	}
+
+	c.priority = facility*8 + severity
+
+	return nil
+}
+
+// syslogSink sends every event as an RFC 5424 message with the event as the
+// message body. Stream connections (tcp and unix) use octet counting framing
+// (RFC 6587). The connection is established on first use and re-established
+// once if a write fails.
+type syslogSink struct {
+	config   SyslogSinkConfig
+	mtx      sync.Mutex
+	conn     net.Conn
+	hostname string
+	pid      string
+	now      func() time.Time
+}
+
+func newSyslogSink(config *SyslogSinkConfig) *syslogSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSink{
+		config:   *config,
+		hostname: hostname,
+		pid:      strconv.Itoa(os.Getpid()),
+		now:      time.Now,
+	}
+}
+
+func (s *syslogSink) Name() string {
+	return "syslog"
+}
+
+func (s *syslogSink) Write(bs []byte) error {
+
+	msg := s.format(bytes.TrimSuffix(bs, []byte("\n")))
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var err error
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			s.conn, err = net.DialTimeout(s.config.Network, s.config.Address, syslogDialTimeout)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err = s.conn.Write(msg); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *syslogSink) stream() bool {
+	return s.config.Network == "tcp" || s.config.Network == "unix"
+}
+
+// format returns the RFC 5424 message for body:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *syslogSink) format(body []byte) []byte {
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %s %s - ",
+		s.config.priority,
+		s.now().Format(syslogTimestampFormat),
+		s.hostname,
+		s.config.AppName,
+		s.pid,
+		syslogMsgID,
+	)
+
+	buf.Write(body)
+
+	if !s.stream() {
+		return buf.Bytes()
+	}
+
+	return append([]byte(strconv.Itoa(buf.Len())+" "), buf.Bytes()...)
+}
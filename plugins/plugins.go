@@ -811,7 +811,7 @@ func (m *Manager) onCommit(ctx context.Context, txn storage.Transaction, event s
 	// compiler on the context but the server does not (nor would users
 	// implementing their own policy loading.)
 	if compiler == nil && event.PolicyChanged() {
-		compiler, _ = loadCompilerFromStore(ctx, m.Store, txn, m.enablePrintStatements)
+		compiler, _ = loadCompilerFromStore(ctx, m.Store, txn, m.enablePrintStatements, m.GetCompiler())
 	}
 
 	if compiler != nil {
@@ -843,7 +843,7 @@ func (m *Manager) onCommit(ctx context.Context, txn storage.Transaction, event s
 	}
 }
 
-func loadCompilerFromStore(ctx context.Context, store storage.Store, txn storage.Transaction, enablePrintStatements bool) (*ast.Compiler, error) {
+func loadCompilerFromStore(ctx context.Context, store storage.Store, txn storage.Transaction, enablePrintStatements bool, prev *ast.Compiler) (*ast.Compiler, error) {
 	policies, err := store.ListPolicies(ctx, txn)
 	if err != nil {
 		return nil, err
@@ -862,7 +862,9 @@ func loadCompilerFromStore(ctx context.Context, store storage.Store, txn storage
 		modules[policy] = module
 	}
 
-	compiler := ast.NewCompiler().WithEnablePrintStatements(enablePrintStatements)
+	compiler := ast.NewCompiler().
+		WithEnablePrintStatements(enablePrintStatements).
+		WithIncremental(prev)
 	compiler.Compile(modules)
 	return compiler, nil
 }
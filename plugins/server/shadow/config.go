@@ -0,0 +1,68 @@
+// Package shadow implements the configuration of the server's shadow mode.
+package shadow
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/util"
+)
+
+var defaultMaxConcurrentEvaluations = 10
+var defaultTimeoutSeconds = int64(10)
+
+// Config represents the configuration for the Server.Shadow settings. Shadow
+// evaluation is performed for the bundles configured with `shadow: true`.
+type Config struct {
+	Disabled                 bool   `json:"disabled,omitempty"`                   // disables shadow evaluation even if shadow bundles are configured
+	MaxConcurrentEvaluations *int   `json:"max_concurrent_evaluations,omitempty"` // shadow evaluations beyond this limit are dropped
+	TimeoutSeconds           *int64 `json:"timeout_seconds,omitempty"`            // the timeout of a single shadow evaluation
+}
+
+// ConfigBuilder assists in the construction of the plugin configuration.
+type ConfigBuilder struct {
+	raw []byte
+}
+
+// NewConfigBuilder returns a new ConfigBuilder to build and parse the server config
+func NewConfigBuilder() *ConfigBuilder {
+	return &ConfigBuilder{}
+}
+
+// WithBytes sets the raw server config
+func (b *ConfigBuilder) WithBytes(config []byte) *ConfigBuilder {
+	b.raw = config
+	return b
+}
+
+// Parse returns a valid Config object with defaults injected.
+func (b *ConfigBuilder) Parse() (*Config, error) {
+	var result Config
+
+	if b.raw != nil {
+		if err := util.Unmarshal(b.raw, &result); err != nil {
+			return nil, err
+		}
+	}
+
+	return &result, result.validateAndInjectDefaults()
+}
+
+func (c *Config) validateAndInjectDefaults() error {
+	if c.MaxConcurrentEvaluations == nil {
+		c.MaxConcurrentEvaluations = &defaultMaxConcurrentEvaluations
+	}
+
+	if c.TimeoutSeconds == nil {
+		c.TimeoutSeconds = &defaultTimeoutSeconds
+	}
+
+	if *c.MaxConcurrentEvaluations <= 0 {
+		return fmt.Errorf("invalid value for server.shadow.max_concurrent_evaluations field, should be a positive number")
+	}
+
+	if *c.TimeoutSeconds <= 0 {
+		return fmt.Errorf("invalid value for server.shadow.timeout_seconds field, should be a positive number")
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package shadow
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{
+			input:   `{}`,
+			wantErr: false,
+		},
+		{
+			input:   `{"max_concurrent_evaluations": 0}`,
+			wantErr: true,
+		},
+		{
+			input:   `{"max_concurrent_evaluations": "1"}`,
+			wantErr: true,
+		},
+		{
+			input:   `{"timeout_seconds": -1}`,
+			wantErr: true,
+		},
+		{
+			input:   `{"disabled": true, "max_concurrent_evaluations": 1, "timeout_seconds": 1}`,
+			wantErr: false,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("TestConfigValidation_case_%d", i), func(t *testing.T) {
+			_, err := NewConfigBuilder().WithBytes([]byte(test.input)).Parse()
+			if err != nil && !test.wantErr {
+				t.Fail()
+			}
+			if err == nil && test.wantErr {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	for _, input := range []string{"", `{}`} {
+		var raw []byte
+		if input != "" {
+			raw = []byte(input)
+		}
+
+		config, err := NewConfigBuilder().WithBytes(raw).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if config.Disabled || *config.MaxConcurrentEvaluations != defaultMaxConcurrentEvaluations || *config.TimeoutSeconds != defaultTimeoutSeconds {
+			t.Fatalf("unexpected config for %q: %+v", input, config)
+		}
+	}
+}
@@ -55,6 +55,16 @@ var (
 			Help: "Gauge for the last success bundle request."},
 		[]string{"name"},
 	)
+	decisionLogsBacklogEvents = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "decision_logs_backlog_events",
+			Help: "Gauge for the number of decisions in the decision log disk buffer."},
+	)
+	decisionLogsBacklogBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "decision_logs_backlog_bytes",
+			Help: "Gauge for the size of the decision log disk buffer."},
+	)
 	bundleLoadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "bundle_loading_duration_ns",
 		Help:    "Histogram for the bundle loading duration by stage.",
@@ -74,6 +84,8 @@ var (
 		lastSuccessfulDownload,
 		lastSuccessfulRequest,
 		bundleLoadDuration,
+		decisionLogsBacklogEvents,
+		decisionLogsBacklogBytes,
 	}
 )
 
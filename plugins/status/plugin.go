@@ -524,6 +524,10 @@ func updatePrometheusMetrics(u *UpdateRequestV1) {
 	for name, plugin := range u.Plugins {
 		pluginStatus.WithLabelValues(name, string(plugin.State)).Set(1)
 	}
+	if u.DecisionLogs != nil {
+		decisionLogsBacklogEvents.Set(float64(u.DecisionLogs.BacklogEvents))
+		decisionLogsBacklogBytes.Set(float64(u.DecisionLogs.BacklogBytes))
+	}
 	lastSuccessfulActivation.Reset()
 	for _, bundle := range u.Bundles {
 		if bundle.Code == "" && !bundle.LastSuccessfulActivation.IsZero() {
@@ -86,8 +86,14 @@ func TestPluginPrometheus(t *testing.T) {
 	if registerMock.Collectors[bundleLoadDuration] != true {
 		t.Fatalf("Bundle Load Duration metric was not registered on prometheus")
 	}
-	if len(registerMock.Collectors) != 9 {
-		t.Fatalf("Number of collectors expected (%v), got %v", 9, len(registerMock.Collectors))
+	if registerMock.Collectors[decisionLogsBacklogEvents] != true {
+		t.Fatalf("Decision logs backlog events metric was not registered on prometheus")
+	}
+	if registerMock.Collectors[decisionLogsBacklogBytes] != true {
+		t.Fatalf("Decision logs backlog bytes metric was not registered on prometheus")
+	}
+	if len(registerMock.Collectors) != 11 {
+		t.Fatalf("Number of collectors expected (%v), got %v", 11, len(registerMock.Collectors))
 	}
 
 	lastRequestMetricResult := time.UnixMilli(int64(testutil.ToFloat64(lastRequest) / 1e6))
@@ -143,8 +149,8 @@ func TestPluginPrometheus(t *testing.T) {
 	fixture.plugin.Reconfigure(ctx, prometheusReenabledConfig)
 	eventually(t, func() bool { return fixture.plugin.config.Prometheus == true })
 
-	if len(registerMock.Collectors) != 9 {
-		t.Fatalf("Number of collectors expected (%v), got %v", 9, len(registerMock.Collectors))
+	if len(registerMock.Collectors) != 11 {
+		t.Fatalf("Number of collectors expected (%v), got %v", 11, len(registerMock.Collectors))
 	}
 }
 
@@ -156,16 +162,15 @@ func eventually(t *testing.T, predicate func() bool) {
 }
 
 func assertOpInformationGauge(t *testing.T, registerMock *prometheusRegisterMock) {
-	gauges := filterGauges(registerMock)
-	if len(gauges) != 1 {
-		t.Fatalf("Expected one registered gauge on prometheus but got %v", len(gauges))
+	var gauge prometheus.Gauge
+	for _, g := range filterGauges(registerMock) {
+		if getName(g) == "opa_info" {
+			gauge = g
+		}
 	}
 
-	gauge := gauges[0]
-
-	fqName := getName(gauge)
-	if fqName != "opa_info" {
-		t.Fatalf("Expected gauge to have name opa_info but was %s", fqName)
+	if gauge == nil {
+		t.Fatal("Expected opa_info gauge to be registered on prometheus")
 	}
 
 	labels := getConstLabels(gauge)
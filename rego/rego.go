@@ -552,6 +552,7 @@ type Rego struct {
 	shallowInlining        bool
 	skipPartialNamespace   bool
 	partialNamespace       string
+	partialCheck           func(*ast.Compiler, ast.Body, []*ast.Term) error
 	modules                []rawModule
 	parsedModules          map[string]*ast.Module
 	compiler               *ast.Compiler
@@ -904,6 +905,16 @@ func PartialNamespace(ns string) func(r *Rego) {
 	}
 }
 
+// PartialCheck sets a function that is called with the compiler, the compiled
+// query and the unknowns before partial evaluation. If the function returns an
+// error, partial evaluation is not performed and the error is returned. Checks
+// can be used to restrict partial evaluation to a subset of Rego.
+func PartialCheck(f func(*ast.Compiler, ast.Body, []*ast.Term) error) func(r *Rego) {
+	return func(r *Rego) {
+		r.partialCheck = f
+	}
+}
+
 // Module returns an argument that adds a Rego module.
 func Module(filename, input string) func(r *Rego) {
 	return func(r *Rego) {
@@ -2303,6 +2314,12 @@ func (r *Rego) partial(ctx context.Context, ectx *EvalContext) (*PartialQueries,
 		unknowns = []*ast.Term{ast.NewTerm(ast.InputRootRef)}
 	}
 
+	if r.partialCheck != nil {
+		if err := r.partialCheck(r.compiler, ectx.compiledQuery.query, unknowns); err != nil {
+			return nil, err
+		}
+	}
+
 	q := topdown.NewQuery(ectx.compiledQuery.query).
 		WithQueryCompiler(ectx.compiledQuery.compiler).
 		WithCompiler(r.compiler).
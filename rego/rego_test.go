@@ -2025,6 +2025,31 @@ func TestShallowInliningOption(t *testing.T) {
 	}
 }
 
+func TestPartialCheckOption(t *testing.T) {
+	var unknowns []*ast.Term
+
+	r := New(Query("data.test.p = true"), Module("example.rego", `
+		package test
+
+		p { input.x = 7 }
+	`), Unknowns([]string{"input.x"}), PartialCheck(func(c *ast.Compiler, query ast.Body, u []*ast.Term) error {
+		if len(c.GetRulesExact(ast.MustParseRef("data.test.p"))) != 1 {
+			t.Fatal("expected compiler with rule data.test.p")
+		}
+		unknowns = u
+		return fmt.Errorf("rejected %v", query)
+	}))
+
+	_, err := r.Partial(context.Background())
+	if err == nil || !strings.HasPrefix(err.Error(), "rejected ") {
+		t.Fatal("expected error from check but got:", err)
+	}
+
+	if len(unknowns) != 1 || !unknowns[0].Equal(ast.MustParseTerm("input.x")) {
+		t.Fatal("expected unknowns to be passed to check but got:", unknowns)
+	}
+}
+
 func TestRegoPartialResultSortedRules(t *testing.T) {
 	r := New(Query("data.test.p"), Module("example.rego", `
 		package test
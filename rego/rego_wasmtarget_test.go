@@ -21,7 +21,7 @@ import (
 	"github.com/fortytw2/leaktest"
 
 	"github.com/open-policy-agent/opa/ast"
-	sdk_errors "github.com/open-policy-agent/opa/internal/wasm/sdk/opa/errors"
+	sdk_errors "github.com/open-policy-agent/opa/sdk/wasm/errors"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/topdown"
 	"github.com/open-policy-agent/opa/topdown/cache"
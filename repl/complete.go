@@ -0,0 +1,206 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package repl
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/types"
+)
+
+var refKeyRegexp = regexp.MustCompile("^[[:alpha:]_][[:alpha:][:digit:]_]*$")
+
+// completeWord returns the completions for the word before pos in the line.
+// References to data and input are completed from the rule tree, the base
+// documents in the store and the types known to the compiler. Names are
+// completed from the rules of the active package, the imports, and the
+// commands if the word is at the start of the line.
+func (r *REPL) completeWord(line string, pos int) (string, []string, string) {
+
+	runes := []rune(line)
+	if pos > len(runes) {
+		pos = len(runes)
+	}
+
+	start := pos
+	for start > 0 && isRefRune(runes[start-1]) {
+		start--
+	}
+
+	head, word, tail := string(runes[:start]), string(runes[start:pos]), string(runes[pos:])
+
+	set := map[string]struct{}{}
+
+	for _, c := range r.complete(word) {
+		set[c] = struct{}{}
+	}
+
+	for _, c := range r.completeRef(word) {
+		set[c] = struct{}{}
+	}
+
+	if strings.TrimSpace(head) == "" {
+		for _, c := range builtin {
+			if strings.HasPrefix(c.name, word) && !strings.Contains(c.name, " ") {
+				set[c.name] = struct{}{}
+			}
+		}
+	}
+
+	completions := make([]string, 0, len(set))
+	for c := range set {
+		completions = append(completions, c)
+	}
+
+	sort.Strings(completions)
+
+	return head, completions, tail
+}
+
+func isRefRune(c rune) bool {
+	return c == '_' || c == '.' || c == '-' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// completeRef returns the completions of the last key of the reference.
+func (r *REPL) completeRef(word string) []string {
+
+	ctx := context.Background()
+
+	txn, err := r.store.NewTransaction(ctx)
+	if err != nil {
+		return nil
+	}
+
+	defer r.store.Abort(ctx, txn)
+
+	compiler, err := r.compileModules(ctx, txn, r.modules)
+	if err != nil {
+		return nil
+	}
+
+	pkg := r.getCurrentOrDefaultModule().Package.Path
+
+	i := strings.LastIndex(word, ".")
+	if i < 0 {
+		names := []string{ast.DefaultRootDocument.String(), ast.InputRootDocument.String()}
+		if node := compiler.RuleTree.Find(pkg); node != nil {
+			names = append(names, treeKeys(node)...)
+		}
+		return withPrefix(names, word, "")
+	}
+
+	base, partial := word[:i], word[i+1:]
+
+	term, err := ast.ParseTerm(base)
+	if err != nil {
+		return nil
+	}
+
+	var ref ast.Ref
+
+	switch v := term.Value.(type) {
+	case ast.Var:
+		ref = ast.Ref{term}
+	case ast.Ref:
+		ref = v
+	default:
+		return nil
+	}
+
+	ref = r.resolveRef(pkg, ref)
+	keys := refKeys(ctx, r.store, txn, compiler, ref)
+
+	if ref.HasPrefix(ast.InputRootRef) {
+		// Input defined in the shell is the data.repl.input document.
+		input := defaultPackage().Path.Append(ast.StringTerm(ast.InputRootDocument.String())).Concat(ref[1:])
+		keys = append(keys, refKeys(ctx, r.store, txn, compiler, input)...)
+	}
+
+	return withPrefix(keys, partial, base+".")
+}
+
+// resolveRef returns the absolute reference for references relative to the
+// imports or the package of the active module.
+func (r *REPL) resolveRef(pkg ast.Ref, ref ast.Ref) ast.Ref {
+
+	head, ok := ref[0].Value.(ast.Var)
+	if !ok || ast.RootDocumentNames.Contains(ref[0]) {
+		return ref
+	}
+
+	for _, imp := range r.getCurrentOrDefaultModule().Imports {
+		if imp.Name().Equal(head) {
+			if path, ok := imp.Path.Value.(ast.Ref); ok {
+				return path.Concat(ref[1:])
+			}
+		}
+	}
+
+	return pkg.Append(ast.StringTerm(string(head))).Concat(ref[1:])
+}
+
+// refKeys returns the keys of the document referred to by ref that are known
+// without evaluating rules.
+func refKeys(ctx context.Context, store storage.Store, txn storage.Transaction, compiler *ast.Compiler, ref ast.Ref) []string {
+
+	var keys []string
+
+	if node := compiler.RuleTree.Find(ref); node != nil {
+		keys = append(keys, treeKeys(node)...)
+	}
+
+	if ref.HasPrefix(ast.DefaultRootRef) {
+		if path, err := storage.NewPathForRef(ref); err == nil {
+			if doc, err := store.Read(ctx, txn, path); err == nil {
+				if obj, ok := doc.(map[string]interface{}); ok {
+					for key := range obj {
+						keys = append(keys, key)
+					}
+				}
+			}
+		}
+	}
+
+	if obj, ok := compiler.TypeEnv.Get(ref).(*types.Object); ok {
+		for _, prop := range obj.StaticProperties() {
+			if key, ok := prop.Key.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys
+}
+
+func treeKeys(node *ast.TreeNode) []string {
+	var keys []string
+	for _, child := range node.Children {
+		if child.Hide {
+			continue
+		}
+		if key, ok := child.Key.(ast.String); ok {
+			keys = append(keys, string(key))
+		}
+	}
+	return keys
+}
+
+// withPrefix returns the keys that start with prefix and can be used in a
+// reference, prepended with base.
+func withPrefix(keys []string, prefix string, base string) []string {
+	var result []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) && refKeyRegexp.MatchString(key) && !ast.IsKeyword(key) {
+			result = append(result, base+key)
+		}
+	}
+	return result
+}
@@ -0,0 +1,314 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package repl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/debug"
+	pr "github.com/open-policy-agent/opa/internal/presentation"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+)
+
+// debugging represents an evaluation that has been started with breakpoints
+// set. The evaluation runs in the background and keeps its own transaction
+// open until it finishes.
+type debugging struct {
+	session *debug.Session
+	txn     storage.Transaction
+	finish  func() error // prints the output of the finished evaluation
+}
+
+func (r *REPL) startDebugging(ctx context.Context, compiler *ast.Compiler, args []func(*rego.Rego), output func(rego.ResultSet, error) error) error {
+
+	txn, err := r.store.NewTransaction(ctx)
+	if err != nil {
+		return err
+	}
+
+	session := debug.NewSession().
+		WithCompiler(compiler).
+		WithStore(r.store).
+		WithTransaction(txn)
+	session.SetBreakpoints(r.breakpoints)
+
+	args = append(args, rego.Transaction(txn), rego.QueryTracer(session))
+
+	var rs rego.ResultSet
+
+	session.Start(ctx, func(ctx context.Context) error {
+		var err error
+		rs, err = rego.New(args...).Eval(ctx)
+		return err
+	})
+
+	r.debugging = &debugging{
+		session: session,
+		txn:     txn,
+		finish: func() error {
+			return output(rs, session.Err())
+		},
+	}
+
+	return r.waitDebugging(ctx)
+}
+
+// waitDebugging waits until the evaluation stops or finishes and prints the
+// location it stopped at or the output of the evaluation.
+func (r *REPL) waitDebugging(ctx context.Context) error {
+
+	d := r.debugging
+
+	stop := d.session.Wait()
+	if stop == nil {
+		r.debugging = nil
+		r.store.Abort(ctx, d.txn)
+		return d.finish()
+	}
+
+	printStop(r.output, stop, r.sourceLine(ctx, d.txn, stop.Frames[0].Location))
+	return nil
+}
+
+// sourceLine returns the line of the policy stored in the store that the
+// location refers to. If the policy is not found, the text of the location is
+// returned instead.
+func (r *REPL) sourceLine(ctx context.Context, txn storage.Transaction, loc *ast.Location) string {
+
+	if loc == nil {
+		return ""
+	}
+
+	if bs, err := r.store.GetPolicy(ctx, txn, loc.File); err == nil {
+		lines := strings.Split(string(bs), "\n")
+		if loc.Row > 0 && loc.Row <= len(lines) {
+			return strings.TrimSpace(lines[loc.Row-1])
+		}
+	}
+
+	text, _, _ := strings.Cut(string(loc.Text), "\n")
+	return text
+}
+
+// stopDebugging terminates the stopped evaluation, if any.
+func (r *REPL) stopDebugging(ctx context.Context) {
+
+	d := r.debugging
+	if d == nil {
+		return
+	}
+
+	d.session.Terminate()
+	<-d.session.Done()
+	r.store.Abort(ctx, d.txn)
+	r.debugging = nil
+}
+
+func (r *REPL) cmdBreak(line string) error {
+
+	spec := strings.TrimSpace(strings.TrimSpace(line)[len("break"):])
+	if spec == "" {
+		if len(r.breakpoints) == 0 {
+			fmt.Fprintln(r.output, "No breakpoints set.")
+		}
+		for _, b := range r.breakpoints {
+			fmt.Fprintln(r.output, b)
+		}
+		return nil
+	}
+
+	loc, condition, hasCondition := strings.Cut(spec, " if ")
+	loc = strings.TrimSpace(loc)
+	condition = strings.TrimSpace(condition)
+
+	if hasCondition && condition == "" {
+		return fmt.Errorf("missing breakpoint condition")
+	}
+
+	i := strings.LastIndex(loc, ":")
+	if i <= 0 {
+		return fmt.Errorf("invalid breakpoint location %q: expected <file>:<line>", loc)
+	}
+
+	file := loc[:i]
+	row, err := strconv.Atoi(loc[i+1:])
+	if err != nil {
+		return fmt.Errorf("invalid breakpoint location %q: expected <file>:<line>", loc)
+	}
+
+	// The breakpoints are copied because the session of a stopped evaluation
+	// may still refer to the old ones.
+	breakpoints := make([]*debug.Breakpoint, 0, len(r.breakpoints)+1)
+	var existing bool
+
+	for _, b := range r.breakpoints {
+		if b.File == file && b.Line == row {
+			existing = true
+			continue
+		}
+		breakpoints = append(breakpoints, b)
+	}
+
+	if existing && !hasCondition {
+		fmt.Fprintf(r.output, "Breakpoint removed at %v:%d\n", file, row)
+	} else {
+		b, err := debug.NewBreakpoint(file, row, condition)
+		if err != nil {
+			return err
+		}
+		breakpoints = append(breakpoints, b)
+		fmt.Fprintf(r.output, "Breakpoint set at %v\n", b)
+	}
+
+	r.breakpoints = breakpoints
+
+	if r.debugging != nil {
+		r.debugging.session.SetBreakpoints(breakpoints)
+	}
+
+	return nil
+}
+
+func (r *REPL) cmdStep(ctx context.Context, args []string) error {
+
+	action := debug.StepIn
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "in":
+		case "over":
+			action = debug.StepOver
+		case "out":
+			action = debug.StepOut
+		default:
+			return fmt.Errorf("unknown step mode %q: expected over or out", args[0])
+		}
+	}
+
+	return r.resumeDebugging(ctx, action)
+}
+
+func (r *REPL) cmdContinue(ctx context.Context) error {
+	return r.resumeDebugging(ctx, debug.Continue)
+}
+
+func (r *REPL) resumeDebugging(ctx context.Context, action debug.Action) error {
+
+	if r.debugging == nil {
+		return debug.ErrNotStopped
+	}
+
+	if err := r.debugging.session.Resume(action); err != nil {
+		return err
+	}
+
+	return r.waitDebugging(ctx)
+}
+
+// evalStopped evaluates the query in the innermost frame of the stopped
+// evaluation.
+func (r *REPL) evalStopped(ctx context.Context, line string) error {
+
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+
+	session := r.debugging.session
+	rs, err := session.Eval(ctx, session.Stopped().Frames[0], line)
+
+	output := pr.Output{
+		Errors: pr.NewOutputErrors(err),
+		Result: rs,
+	}
+
+	output = output.WithLimit(r.prettyLimit)
+
+	switch r.outputFormat {
+	case "json":
+		return pr.JSON(r.output, output)
+	default:
+		return pr.Pretty(r.output, output)
+	}
+}
+
+func printStop(w io.Writer, stop *debug.Stop, source string) {
+
+	frame := stop.Frames[0]
+
+	var reason string
+	switch stop.Reason {
+	case debug.ReasonEntry:
+		reason = "on entry"
+	case debug.ReasonBreakpoint:
+		reason = "at breakpoint"
+	default:
+		reason = "after step"
+	}
+
+	fmt.Fprintf(w, "Stopped %v in %v (%v)\n", reason, frame.Name, frame.Location)
+
+	if source != "" {
+		fmt.Fprintf(w, "\n\t%v\n\n", source)
+	}
+
+	if stop.Err != nil {
+		fmt.Fprintf(w, "breakpoint condition error: %v\n", stop.Err)
+	}
+
+	for _, v := range frame.Locals() {
+		fmt.Fprintf(w, "%v = %v\n", v.Name, v.Value)
+	}
+}
+
+func printHelpDebug(output io.Writer) error {
+
+	printHelpTitle(output, "Debugging")
+
+	txt := strings.TrimSpace(`
+Queries can be stepped through by setting breakpoints on lines of the loaded
+policy files. When breakpoints are set, queries stop at the first breakpoint
+they hit. While stopped, the local variables of the stopped rule are printed
+and statements are evaluated in the context of the stopped rule.
+
+Breakpoints may have a condition. The evaluation only stops at the breakpoint
+if the condition is defined.
+
+For example:
+
+	# Set a breakpoint on line 10 of the policy file.
+	> break authz.rego:10
+
+	# Set a breakpoint that is only hit for some users.
+	> break authz.rego:14 if input.user == "alice"
+
+	# List breakpoints.
+	> break
+
+	# Evaluate a query. The evaluation stops at the first breakpoint.
+	> data.authz.allow
+
+	# Evaluate an expression in the stopped rule.
+	> count(roles)
+
+	# Step into, over, or out of the next expression.
+	> step
+	> step over
+	> step out
+
+	# Resume the evaluation until the next breakpoint is hit.
+	> continue
+
+	# Remove the breakpoint on line 10.
+	> break authz.rego:10`) + "\n"
+
+	fmt.Fprintln(output, txt)
+	return nil
+}
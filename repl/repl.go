@@ -9,6 +9,7 @@
 package repl
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -25,6 +26,7 @@ import (
 	"github.com/peterh/liner"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/debug"
 	"github.com/open-policy-agent/opa/format"
 	"github.com/open-policy-agent/opa/internal/future"
 	pr "github.com/open-policy-agent/opa/internal/presentation"
@@ -58,6 +60,8 @@ type REPL struct {
 	explain           explainMode
 	instrument        bool
 	historyPath       string
+	history           []string
+	sessionPath       string
 	initPrompt        string
 	bufferPrompt      string
 	banner            string
@@ -69,6 +73,8 @@ type REPL struct {
 	prettyLimit       int
 	report            [][2]string
 	target            string // target type (wasm, rego, etc.)
+	breakpoints       []*debug.Breakpoint
+	debugging         *debugging // evaluation stopped by the debugger, if any
 	mtx               sync.Mutex
 }
 
@@ -172,7 +178,11 @@ func (r *REPL) Loop(ctx context.Context) {
 		fmt.Fprintln(r.output, r.banner)
 	}
 
-	line.SetCompleter(r.complete)
+	line.SetWordCompleter(r.completeWord)
+
+	if err := r.restoreSession(ctx); err != nil {
+		fmt.Fprintln(r.output, "error restoring session:", err)
+	}
 
 loop:
 	for {
@@ -205,6 +215,7 @@ loop:
 		}
 
 		line.AppendHistory(input)
+		r.history = append(r.history, input)
 	}
 
 exitPrompt:
@@ -239,6 +250,10 @@ exitPrompt:
 
 exit:
 	r.saveHistory(line)
+
+	if err := r.saveSession(); err != nil {
+		fmt.Fprintln(r.output, "error saving session:", err)
+	}
 }
 
 // OneShot evaluates the line and prints the result. If an error occurs it is
@@ -251,7 +266,10 @@ func (r *REPL) OneShot(ctx context.Context, line string) error {
 		return err
 	}
 
-	defer r.store.Abort(ctx, r.txn)
+	// The transaction is reopened by commands that write to the store.
+	defer func() {
+		r.store.Abort(ctx, r.txn)
+	}()
 
 	if r.metrics != nil {
 		defer r.metrics.Clear()
@@ -260,8 +278,22 @@ func (r *REPL) OneShot(ctx context.Context, line string) error {
 	if len(r.buffer) == 0 {
 		if cmd := newCommand(line); cmd != nil {
 			switch cmd.op {
+			case "break":
+				return r.cmdBreak(line)
+			case "step":
+				return r.cmdStep(ctx, cmd.args)
+			case "continue":
+				return r.cmdContinue(ctx)
 			case "dump":
 				return r.cmdDump(ctx, cmd.args)
+			case "load":
+				return r.cmdLoad(ctx, cmd.args)
+			case "save":
+				return r.cmdSave(cmd.args)
+			case "import-input":
+				return r.cmdImportInput(ctx, cmd.args)
+			case "history":
+				return r.cmdHistory(cmd.args)
 			case "json":
 				return r.cmdFormat("json")
 			case "show":
@@ -308,10 +340,17 @@ func (r *REPL) OneShot(ctx context.Context, line string) error {
 			case "help":
 				return r.cmdHelp(cmd.args)
 			case "exit":
+				r.stopDebugging(ctx)
 				return r.cmdExit()
 			}
 		}
 
+		// While the evaluation is stopped, statements are evaluated in
+		// the stopped frame.
+		if r.debugging != nil {
+			return r.evalStopped(ctx, line)
+		}
+
 		r.buffer = append(r.buffer, line)
 		return r.evalBufferOne(ctx)
 	}
@@ -344,6 +383,14 @@ func (r *REPL) WithRuntime(term *ast.Term) *REPL {
 	return r
 }
 
+// WithSession sets the path of the file the session is persisted in. The
+// modules defined in the shell and its settings are restored from the file when
+// the loop starts and saved to the file when it exits.
+func (r *REPL) WithSession(path string) *REPL {
+	r.sessionPath = path
+	return r
+}
+
 // SetOPAVersionReport sets the information about the latest OPA release.
 func (r *REPL) SetOPAVersionReport(report [][2]string) {
 	r.mtx.Lock()
@@ -674,7 +721,7 @@ func (r *REPL) unsetRule(ctx context.Context, name ast.Var) (bool, error) {
 
 	cpy := mod.Copy()
 	cpy.Rules = rules
-	err := r.recompile(ctx, cpy)
+	err := r.recompile(ctx, r.currentModuleID, cpy)
 	if err != nil {
 		return false, err
 	}
@@ -711,16 +758,16 @@ func (r *REPL) timerStop(msg string) {
 	}
 }
 
-func (r *REPL) recompile(ctx context.Context, cpy *ast.Module) error {
+func (r *REPL) recompile(ctx context.Context, moduleID string, cpy *ast.Module) error {
 	policies, err := r.loadModules(ctx, r.txn)
 	if err != nil {
 		return err
 	}
 
-	policies[r.currentModuleID] = cpy
+	policies[moduleID] = cpy
 
 	for id, mod := range r.modules {
-		if id != r.currentModuleID {
+		if id != moduleID {
 			policies[id] = mod
 		}
 	}
@@ -738,7 +785,7 @@ func (r *REPL) recompile(ctx context.Context, cpy *ast.Module) error {
 		return compiler.Errors
 	}
 
-	r.modules[r.currentModuleID] = cpy
+	r.modules[moduleID] = cpy
 	return nil
 }
 
@@ -903,12 +950,18 @@ func (r *REPL) loadCompiler(ctx context.Context) (*ast.Compiler, error) {
 	r.timerStart(metrics.RegoModuleCompile)
 	defer r.timerStop(metrics.RegoModuleCompile)
 
-	policies, err := r.loadModules(ctx, r.txn)
+	return r.compileModules(ctx, r.txn, r.modules)
+}
+
+// compileModules compiles the modules with the policies in the store.
+func (r *REPL) compileModules(ctx context.Context, txn storage.Transaction, modules map[string]*ast.Module) (*ast.Compiler, error) {
+
+	policies, err := r.loadModules(ctx, txn)
 	if err != nil {
 		return nil, err
 	}
 
-	for id, mod := range r.modules {
+	for id, mod := range modules {
 		policies[id] = mod
 	}
 
@@ -1023,30 +1076,47 @@ func (r *REPL) evalBody(ctx context.Context, compiler *ast.Compiler, input ast.V
 		args = append(args, rego.QueryTracer(prof))
 	}
 
+	output := func(rs rego.ResultSet, err error) error {
+		return r.printBodyOutput(rs, err, tracebuf, prof)
+	}
+
+	if len(r.breakpoints) > 0 && r.target == compile.TargetRego {
+		return r.startDebugging(ctx, compiler, args, output)
+	}
+
 	eval := rego.New(args...)
 	rs, err := eval.Eval(ctx)
 
+	return output(rs, err)
+}
+
+func (r *REPL) printBodyOutput(rs rego.ResultSet, err error, tracebuf *topdown.BufferTracer, prof *profiler.Profiler) error {
+
 	output := pr.Output{
 		Errors:  pr.NewOutputErrors(err),
 		Result:  rs,
 		Metrics: r.metrics,
 	}
 
-	if r.profiler {
+	// The settings may have been changed while the evaluation was stopped by
+	// the debugger, so the tracers are checked instead.
+	if prof != nil {
 		output.Profile = prof.ReportTopNResults(-1, pr.DefaultProfileSortOrder)
 	}
 
 	output = output.WithLimit(r.prettyLimit)
 
-	switch r.explain {
-	case explainDebug:
-		output.Explanation = lineage.Debug(*tracebuf)
-	case explainFull:
-		output.Explanation = lineage.Full(*tracebuf)
-	case explainNotes:
-		output.Explanation = lineage.Notes(*tracebuf)
-	case explainFails:
-		output.Explanation = lineage.Fails(*tracebuf)
+	if tracebuf != nil {
+		switch r.explain {
+		case explainDebug:
+			output.Explanation = lineage.Debug(*tracebuf)
+		case explainFull:
+			output.Explanation = lineage.Full(*tracebuf)
+		case explainNotes:
+			output.Explanation = lineage.Notes(*tracebuf)
+		case explainFails:
+			output.Explanation = lineage.Fails(*tracebuf)
+		}
 	}
 
 	switch r.outputFormat {
@@ -1220,9 +1290,9 @@ func (r *REPL) getPrompt() string {
 }
 
 func (r *REPL) loadHistory(prompt *liner.State) {
-	if f, err := os.Open(r.historyPath); err == nil {
-		_, _ = prompt.ReadHistory(f) // ignore error
-		f.Close()
+	if bs, err := os.ReadFile(r.historyPath); err == nil {
+		_, _ = prompt.ReadHistory(bytes.NewReader(bs)) // ignore error
+		r.history = strings.FieldsFunc(string(bs), func(c rune) bool { return c == '\n' })
 	}
 }
 
@@ -1315,6 +1385,9 @@ var extra = [...]commandDesc{
 }
 
 var builtin = [...]commandDesc{
+	{"break", []string{"[<file>:<line> [if <cond>]]"}, "toggle breakpoint or list breakpoints"},
+	{"step", []string{"[over|out]"}, "step into (or over, out of) the next expression"},
+	{"continue", []string{}, "resume the stopped evaluation"},
 	{"show", []string{""}, "show active module definition"},
 	{"show debug", []string{""}, "show REPL settings"},
 	{"unset", []string{"<var>"}, "unset rules in currently active module"},
@@ -1332,6 +1405,10 @@ var builtin = [...]commandDesc{
 	{"unknown", []string{"[ref-1 [ref-2 [...]]]"}, "toggle partial evaluation mode"},
 	{"strict-builtin-errors", []string{}, "toggle strict built-in error mode"},
 	{"dump", []string{"[path]"}, "dump raw data in storage"},
+	{"load", []string{"[-b] <path>"}, "load policy and data files (or a bundle with -b) into storage"},
+	{"save", []string{"<path>"}, "save modules defined in the shell to a file"},
+	{"import-input", []string{"<path>"}, "set input document to the contents of a JSON or YAML file"},
+	{"history", []string{"[text]"}, "list history entries containing the text (or ctrl+r)"},
 	{"help", []string{"[topic]"}, "print this message"},
 	{"target", []string{"[mode]"}, "set the runtime to exercise {rego,wasm} (default rego)"},
 	{"exit", []string{}, "exit out of shell (or ctrl+d)"},
@@ -1346,6 +1423,7 @@ type topicDesc struct {
 var topics = map[string]topicDesc{
 	"input":   {printHelpInput, "how to set input document"},
 	"partial": {printHelpPartial, "how to use partial evaluation"},
+	"debug":   {printHelpDebug, "how to step through the evaluation"},
 }
 
 type command struct {
@@ -19,10 +19,12 @@ import (
 	"testing"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/debug"
 	"github.com/open-policy-agent/opa/internal/presentation"
 	"github.com/open-policy-agent/opa/storage"
 	inmem "github.com/open-policy-agent/opa/storage/inmem/test"
 	"github.com/open-policy-agent/opa/util"
+	"github.com/open-policy-agent/opa/util/test"
 )
 
 func TestFunction(t *testing.T) {
@@ -257,6 +259,72 @@ r = 3 { true }`)
 	}
 }
 
+func TestCompleteWord(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore()
+	txn := storage.NewTransactionOrDie(ctx, store, storage.WriteParams)
+
+	mod := []byte(`package a.b
+
+p = {"x": 1, "y": {"z": 2}} { true }
+q = 2 { true }`)
+
+	if err := store.UpsertPolicy(ctx, txn, "mod", mod); err != nil {
+		panic(err)
+	}
+
+	if err := store.Commit(ctx, txn); err != nil {
+		panic(err)
+	}
+
+	var buf bytes.Buffer
+	repl := newRepl(store, &buf)
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.yaml")
+	if err := os.WriteFile(inputPath, []byte("user:\n  name: alice\n  roles: [admin]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"package a.b", "import data.a.b.p as pp", "r = q + 1", "import-input " + inputPath} {
+		if err := repl.OneShot(ctx, line); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		note string
+		line string
+		pos  int
+		head string
+		exp  []string
+		tail string
+	}{
+		{note: "commands", line: "un", head: "", exp: []string{"unknown", "unset", "unset-package"}},
+		{note: "base documents", line: "data.", exp: []string{"data.a", "data.a.b.p", "data.a.b.q", "data.a.b.r", "data.repl", "data.repl.input"}},
+		{note: "nested base documents", line: "data.a[0].b.", head: "data.a[0]", exp: nil},
+		{note: "rules", line: "data.a.b.", exp: []string{"data.a.b.p", "data.a.b.q", "data.a.b.r"}},
+		{note: "rule types", line: "data.a.b.p.y.", exp: []string{"data.a.b.p.y.z"}},
+		{note: "package rules", line: "x := q", head: "x := ", exp: []string{"q"}},
+		{note: "import", line: "pp.", exp: []string{"pp.x", "pp.y"}},
+		{note: "input", line: "count(input.user.r", head: "count(", exp: []string{"input.user.roles"}},
+		{note: "tail", line: "data.a.b.r == 3", pos: 9, exp: []string{"data.a.b.p", "data.a.b.q", "data.a.b.r"}, tail: "r == 3"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			pos := tc.pos
+			if pos == 0 {
+				pos = len(tc.line)
+			}
+			head, result, tail := repl.completeWord(tc.line, pos)
+			if head != tc.head || tail != tc.tail || !reflect.DeepEqual(result, tc.exp) && (len(result) > 0 || len(tc.exp) > 0) {
+				t.Fatalf("Expected %q %v %q but got %q %v %q", tc.head, tc.exp, tc.tail, head, result, tail)
+			}
+		})
+	}
+}
+
 func TestDump(t *testing.T) {
 	ctx := context.Background()
 	input := `{"a": [1,2,3,4]}`
@@ -2777,6 +2845,287 @@ func expectOutput(t *testing.T, output string, expected string) {
 	}
 }
 
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore()
+	var buffer bytes.Buffer
+	repl := newRepl(store, &buffer)
+
+	files := map[string]string{
+		"policies/authz.rego":      "package authz\n\nallow { data.roles[input.user] == \"admin\" }\n",
+		"policies/roles.json":      `{"roles": {"alice": "admin"}}`,
+		"bundle/.manifest":         `{"roots": ["bundled"]}`,
+		"bundle/bundled.rego":      "package bundled\n\np = 7\n",
+		"bundle/bundled/data.json": `{"x": 1}`,
+	}
+
+	test.WithTempFS(files, func(root string) {
+
+		if err := repl.OneShot(ctx, "load "+filepath.Join(root, "policies")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if err := repl.OneShot(ctx, `data.authz.allow with input.user as "alice"`); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expectOutput(t, buffer.String(), "true\n")
+		buffer.Reset()
+
+		// Documents at other top-level keys are kept.
+		if err := repl.OneShot(ctx, "data.a[0].b.c[0]"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expectOutput(t, buffer.String(), "true\n")
+		buffer.Reset()
+
+		if err := repl.OneShot(ctx, "load -b "+filepath.Join(root, "bundle")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if err := repl.OneShot(ctx, "[data.bundled.p, data.bundled.x, data.roles.alice]"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expectOutput(t, buffer.String(), "[\n  7,\n  1,\n  \"admin\"\n]\n")
+		buffer.Reset()
+
+		if err := repl.OneShot(ctx, "load"); err == nil || !strings.Contains(err.Error(), "expects exactly one path") {
+			t.Fatalf("Expected bad arguments error but got: %v", err)
+		}
+	})
+}
+
+func TestSave(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore()
+	var buffer bytes.Buffer
+	repl := newRepl(store, &buffer)
+
+	if err := repl.OneShot(ctx, "save x.rego"); err == nil || err.Error() != "no rules defined" {
+		t.Fatalf("Expected error but got: %v", err)
+	}
+
+	for _, line := range []string{"package a", "p {   true }", "package b", "import data.a", "q := a.p"} {
+		if err := repl.OneShot(ctx, line); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "session.rego")
+
+	if err := repl.OneShot(ctx, "save "+path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `package a
+
+p = true
+
+package b
+
+import data.a
+
+q := a.p
+`
+
+	expectOutput(t, string(bs), exp)
+}
+
+func TestImportInput(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore()
+	var buffer bytes.Buffer
+	repl := newRepl(store, &buffer)
+
+	path := filepath.Join(t.TempDir(), "input.json")
+	if err := os.WriteFile(path, []byte(`{"user": "alice"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"package x", "p { input.user == \"alice\" }", "import-input " + path, "import-input " + path} {
+		if err := repl.OneShot(ctx, line); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	buffer.Reset()
+
+	// The input is defined in the repl package, the active package is kept.
+	for _, line := range []string{"p", "show"} {
+		if err := repl.OneShot(ctx, line); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	expectOutput(t, buffer.String(), "true\npackage x\n\np {\n\tinput.user == \"alice\"\n}\n")
+
+	if err := repl.OneShot(ctx, "import-input "+filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("Expected error for missing file")
+	}
+}
+
+func TestSessionRestore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore()
+	var buffer bytes.Buffer
+
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	repl := newRepl(store, &buffer).WithSession(path)
+
+	// A missing session file is not an error.
+	if err := repl.restoreSession(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"package a", "import future.keywords.in", "p { 1 in [1] }", "package b", "q := 1", "unknown input.x", "target wasm"} {
+		if err := repl.OneShot(ctx, line); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if err := repl.saveSession(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newRepl(store, &buffer).WithSession(path)
+
+	if err := restored.restoreSession(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.currentModuleID != "data.b" || restored.target != "wasm" || len(restored.unknowns) != 1 || restored.unknowns[0].String() != "input.x" {
+		t.Fatalf("Unexpected session settings: %v %v %v", restored.currentModuleID, restored.target, restored.unknowns)
+	}
+
+	buffer.Reset()
+
+	for _, line := range []string{"target rego", "unknown", "data.a.p", "show"} {
+		if err := restored.OneShot(ctx, line); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	expectOutput(t, buffer.String(), "true\npackage b\n\nq := 1\n")
+
+	// Sessions that do not compile are not restored.
+	if err := os.WriteFile(path, []byte(`{"modules": {"data.c": "package c\n\np { q }"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restored.restoreSession(ctx); err == nil {
+		t.Fatal("Expected compile error")
+	}
+
+	if _, ok := restored.modules["data.b"]; !ok {
+		t.Fatal("Expected modules to be kept")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore()
+	var buffer bytes.Buffer
+	repl := newRepl(store, &buffer)
+	repl.history = []string{"data.a", "x := 1", "data.a[0]"}
+
+	if err := repl.OneShot(ctx, "history data"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectOutput(t, buffer.String(), "    1  data.a\n    3  data.a[0]\n")
+}
+
+func TestDebug(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.New()
+	var buffer bytes.Buffer
+	repl := newRepl(store, &buffer)
+
+	testMod := []byte(`package test
+
+allow {
+	x := input.x
+	y := double(x)
+	y > 2
+}
+
+double(a) = b {
+	b := a * 2
+}`)
+
+	txn := storage.NewTransactionOrDie(ctx, store, storage.WriteParams)
+
+	if err := store.UpsertPolicy(ctx, txn, "/policies/test.rego", testMod); err != nil {
+		panic(err)
+	}
+
+	if err := store.Commit(ctx, txn); err != nil {
+		panic(err)
+	}
+
+	expectOutput := func(line, exp string) {
+		t.Helper()
+		buffer.Reset()
+		if err := repl.OneShot(ctx, line); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if buffer.String() != exp {
+			t.Fatalf("Expected output for %q:\n\n%v\n\nGot:\n\n%v", line, exp, buffer.String())
+		}
+	}
+
+	if err := repl.OneShot(ctx, "step"); err != debug.ErrNotStopped {
+		t.Fatalf("Expected ErrNotStopped but got: %v", err)
+	}
+
+	expectOutput("break", "No breakpoints set.\n")
+	expectOutput("break test.rego:5", "Breakpoint set at test.rego:5\n")
+	expectOutput("break test.rego:10 if a > 5", "Breakpoint set at test.rego:10 if a > 5\n")
+	expectOutput("break", "test.rego:5\ntest.rego:10 if a > 5\n")
+
+	expectOutput(`data.test.allow with input as {"x": 3}`, `Stopped at breakpoint in data.test.allow (/policies/test.rego:5)
+
+	y := double(x)
+
+x = 3
+`)
+
+	// Statements are evaluated in the stopped rule.
+	expectOutput("x + 1", "4\n")
+
+	expectOutput("step", `Stopped after step in data.test.double (/policies/test.rego:9)
+
+	double(a) = b {
+
+`)
+
+	expectOutput("step out", `Stopped after step in data.test.allow (/policies/test.rego:6)
+
+	y > 2
+
+x = 3
+y = 6
+`)
+
+	// The conditional breakpoint is not hit anymore, so the evaluation
+	// finishes.
+	expectOutput("break test.rego:5", "Breakpoint removed at test.rego:5\n")
+	expectOutput("continue", "true\n")
+	expectOutput(`data.test.allow with input as {"x": 3}`, "true\n")
+
+	if err := repl.OneShot(ctx, "continue"); err != debug.ErrNotStopped {
+		t.Fatalf("Expected ErrNotStopped but got: %v", err)
+	}
+}
+
 func newRepl(store storage.Store, buffer *bytes.Buffer) *REPL {
 	repl := New(store, "", buffer, "", 0, "")
 	return repl
@@ -0,0 +1,321 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package repl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/format"
+	initload "github.com/open-policy-agent/opa/internal/runtime/init"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// session is the state of the REPL that is persisted between runs.
+type session struct {
+	Modules       map[string]string `json:"modules,omitempty"` // formatted modules keyed by module ID
+	CurrentModule string            `json:"current_module,omitempty"`
+	Unknowns      []string          `json:"unknowns,omitempty"`
+	Target        string            `json:"target,omitempty"`
+}
+
+func (r *REPL) cmdLoad(ctx context.Context, args []string) error {
+
+	asBundle := len(args) == 2 && args[0] == "-b"
+	if asBundle {
+		args = args[1:]
+	}
+
+	if len(args) != 1 {
+		return newBadArgsErr("load [-b] <path>: expects exactly one path")
+	}
+
+	loaded, err := initload.LoadPaths(args, nil, asBundle, nil, true, false, r.capabilities, nil)
+	if err != nil {
+		return err
+	}
+
+	return r.write(ctx, func(txn storage.Transaction) error {
+
+		// Documents replace the documents at the same top-level keys instead
+		// of all data in the store.
+		for key, doc := range loaded.Files.Documents {
+			if err := r.store.Write(ctx, txn, storage.AddOp, storage.Path{key}, doc); err != nil {
+				return fmt.Errorf("storage error: %w", err)
+			}
+		}
+
+		files := loaded.Files
+		files.Documents = nil
+
+		_, err := initload.InsertAndCompile(ctx, initload.InsertAndCompileOptions{
+			Store:                 r.store,
+			Txn:                   txn,
+			Files:                 files,
+			Bundles:               loaded.Bundles,
+			MaxErrors:             r.errLimit,
+			EnablePrintStatements: true,
+		})
+		return err
+	})
+}
+
+// write runs f in a write transaction. The transaction of the current command
+// is closed first because the store does not allow writes while other
+// transactions are open.
+func (r *REPL) write(ctx context.Context, f func(storage.Transaction) error) error {
+
+	if r.debugging != nil {
+		return fmt.Errorf("cannot write to storage while the evaluation is stopped")
+	}
+
+	r.store.Abort(ctx, r.txn)
+	err := storage.Txn(ctx, r.store, storage.WriteParams, f)
+	r.txn = storage.NewTransactionOrDie(ctx, r.store)
+
+	return err
+}
+
+func (r *REPL) cmdSave(args []string) error {
+
+	if len(args) != 1 {
+		return newBadArgsErr("save <path>: expects exactly one argument")
+	}
+
+	if len(r.modules) == 0 {
+		return fmt.Errorf("no rules defined")
+	}
+
+	formatted, err := r.formatModules()
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(formatted))
+	for id := range formatted {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	var buf bytes.Buffer
+
+	for i, id := range ids {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(formatted[id])
+	}
+
+	return os.WriteFile(args[0], buf.Bytes(), 0644)
+}
+
+// formatModules returns the modules defined in the shell formatted and keyed
+// by module ID.
+func (r *REPL) formatModules() (map[string]string, error) {
+
+	formatted := make(map[string]string, len(r.modules))
+
+	for id, mod := range r.modules {
+		bs, err := format.Ast(mod)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", id, err)
+		}
+		formatted[id] = string(bs)
+	}
+
+	return formatted, nil
+}
+
+func (r *REPL) cmdImportInput(ctx context.Context, args []string) error {
+
+	if len(args) != 1 {
+		return newBadArgsErr("import-input <path>: expects exactly one argument")
+	}
+
+	bs, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var x interface{}
+	if err := util.Unmarshal(bs, &x); err != nil {
+		return fmt.Errorf("%v: %w", args[0], err)
+	}
+
+	value, err := ast.InterfaceToValue(x)
+	if err != nil {
+		return err
+	}
+
+	// The input is defined as the data.repl.input document, like input
+	// defined in the shell, so that it is saved along with the other rules.
+	rule, err := ast.ParseRule(fmt.Sprintf("input = %v { true }", value))
+	if err != nil {
+		return err
+	}
+
+	pkg := defaultPackage()
+	moduleID := pkg.Path.String()
+
+	mod, ok := r.modules[moduleID]
+	if !ok {
+		mod = &ast.Module{Package: pkg}
+	}
+
+	cpy := mod.Copy()
+	cpy.Rules = nil
+
+	for _, rule := range mod.Rules {
+		if !rule.Head.Name.Equal(ast.Var("input")) {
+			cpy.Rules = append(cpy.Rules, rule)
+		}
+	}
+
+	cpy.Rules = append(cpy.Rules, rule)
+
+	ast.WalkRules(cpy, func(r *ast.Rule) bool {
+		r.Module = cpy
+		return false
+	})
+
+	if err := r.recompile(ctx, moduleID, cpy); err != nil {
+		return err
+	}
+
+	switch r.outputFormat {
+	case "json":
+	default:
+		fmt.Fprintf(r.output, "Input document set to the contents of %v. Type 'input' to see it.\n", args[0])
+	}
+
+	return nil
+}
+
+func (r *REPL) cmdHistory(args []string) error {
+
+	text := strings.Join(args, " ")
+
+	for i, entry := range r.history {
+		if strings.Contains(entry, text) {
+			fmt.Fprintf(r.output, "%5d  %v\n", i+1, entry)
+		}
+	}
+
+	return nil
+}
+
+// saveSession writes the modules defined in the shell and its settings to the
+// session file, if any.
+func (r *REPL) saveSession() error {
+
+	if r.sessionPath == "" {
+		return nil
+	}
+
+	modules, err := r.formatModules()
+	if err != nil {
+		return err
+	}
+
+	s := session{
+		Modules:       modules,
+		CurrentModule: r.currentModuleID,
+		Target:        r.target,
+	}
+
+	for _, u := range r.unknowns {
+		s.Unknowns = append(s.Unknowns, u.String())
+	}
+
+	bs, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(r.sessionPath, bs, 0600)
+}
+
+// restoreSession restores the modules and settings from the session file, if
+// it exists. The session is not restored if its modules do not compile with the
+// policies in the store.
+func (r *REPL) restoreSession(ctx context.Context) error {
+
+	if r.sessionPath == "" {
+		return nil
+	}
+
+	bs, err := os.ReadFile(r.sessionPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var s session
+	if err := util.Unmarshal(bs, &s); err != nil {
+		return fmt.Errorf("%v: %w", r.sessionPath, err)
+	}
+
+	modules := make(map[string]*ast.Module, len(s.Modules))
+
+	for id, src := range s.Modules {
+		mod, err := ast.ParseModule("", src)
+		if err != nil {
+			return err
+		}
+		modules[id] = mod
+	}
+
+	if _, ok := modules[s.CurrentModule]; !ok && s.CurrentModule != "" {
+		return fmt.Errorf("%v: unknown current module %v", r.sessionPath, s.CurrentModule)
+	}
+
+	unknowns := make([]*ast.Term, len(s.Unknowns))
+
+	for i := range s.Unknowns {
+		ref, err := ast.ParseRef(s.Unknowns[i])
+		if err != nil {
+			return err
+		}
+		unknowns[i] = ast.NewTerm(ref)
+	}
+
+	if s.Target != "" && !allowedTargets[s.Target] {
+		return fmt.Errorf("%v: invalid target %q", r.sessionPath, s.Target)
+	}
+
+	txn, err := r.store.NewTransaction(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer r.store.Abort(ctx, txn)
+
+	if _, err := r.compileModules(ctx, txn, modules); err != nil {
+		return err
+	}
+
+	r.modules = modules
+	r.currentModuleID = s.CurrentModule
+
+	if len(unknowns) > 0 {
+		r.unknowns = unknowns
+	}
+
+	if s.Target != "" {
+		r.target = s.Target
+	}
+
+	return nil
+}
@@ -0,0 +1,451 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package replay contains utilities for replaying recorded decisions against
+// a candidate policy to find out which decisions would change.
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/internal/ref"
+	"github.com/open-policy-agent/opa/plugins/logs"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// Reasons for skipping recorded decisions.
+const (
+	SkipQuery       = "ad-hoc query"
+	SkipInputErased = "input erased"
+	SkipInputMasked = "input masked"
+	SkipShadow      = "shadow evaluation"
+)
+
+// Decision is the outcome of replaying a recorded decision.
+type Decision struct {
+	DecisionID     string       `json:"decision_id"`
+	Path           string       `json:"path"`
+	Input          *interface{} `json:"input,omitempty"`
+	Recorded       *interface{} `json:"recorded,omitempty"`
+	RecordedError  string       `json:"recorded_error,omitempty"`
+	Candidate      *interface{} `json:"candidate,omitempty"`
+	CandidateError string       `json:"candidate_error,omitempty"`
+	Changed        bool         `json:"changed"`
+	Diff           []ValueDiff  `json:"diff,omitempty"`
+	Skipped        string       `json:"skipped,omitempty"`
+}
+
+// ValueDiff describes a difference between the recorded and the candidate
+// result. Path is a JSON pointer into the results, and a nil value means that
+// the value is undefined.
+type ValueDiff struct {
+	Path      string       `json:"path"`
+	Recorded  *interface{} `json:"recorded,omitempty"`
+	Candidate *interface{} `json:"candidate,omitempty"`
+}
+
+// Report summarizes the replayed decisions.
+type Report struct {
+	Total   int           `json:"total"`
+	Changed int           `json:"changed"`
+	Skipped int           `json:"skipped"`
+	Paths   []*PathReport `json:"paths,omitempty"`
+}
+
+// PathReport summarizes the replayed decisions for a single path. Only the
+// changed decisions are included.
+type PathReport struct {
+	Path      string     `json:"path"`
+	Total     int        `json:"total"`
+	Changed   int        `json:"changed"`
+	Skipped   int        `json:"skipped"`
+	Decisions []Decision `json:"changed_decisions,omitempty"`
+}
+
+// Replayer evaluates recorded decisions against a candidate policy and
+// compares the results with the recorded ones.
+type Replayer struct {
+	compiler *ast.Compiler
+	store    storage.Store
+	options  []func(*rego.Rego)
+	prepared map[string]*rego.PreparedEvalQuery
+	paths    map[string]*PathReport
+	report   Report
+}
+
+// NewReplayer returns a new replayer.
+func NewReplayer() *Replayer {
+	return &Replayer{
+		prepared: map[string]*rego.PreparedEvalQuery{},
+		paths:    map[string]*PathReport{},
+	}
+}
+
+// SetCompiler sets the compiler containing the candidate policy.
+func (r *Replayer) SetCompiler(compiler *ast.Compiler) *Replayer {
+	r.compiler = compiler
+	return r
+}
+
+// SetStore sets the store containing the candidate data.
+func (r *Replayer) SetStore(store storage.Store) *Replayer {
+	r.store = store
+	return r
+}
+
+// AddOptions adds options used to prepare the queries for the recorded
+// decisions, e.g., to provide custom built-in functions.
+func (r *Replayer) AddOptions(options ...func(*rego.Rego)) *Replayer {
+	r.options = append(r.options, options...)
+	return r
+}
+
+// Replay replays a single recorded decision. Decisions for ad-hoc queries and
+// decisions whose input was erased or masked are skipped since they cannot be
+// evaluated faithfully, as are the events logged for shadow evaluations. The
+// decision is added to the report.
+func (r *Replayer) Replay(ctx context.Context, event *logs.EventV1) (*Decision, error) {
+
+	path := strings.Trim(event.Path, "/")
+
+	d := &Decision{
+		DecisionID: event.DecisionID,
+		Path:       path,
+		Input:      event.Input,
+		Recorded:   event.Result,
+	}
+
+	if event.Error != nil {
+		d.RecordedError = event.Error.Error()
+	}
+
+	if d.Skipped = skipReason(event); d.Skipped == "" {
+		if err := r.eval(ctx, event, d); err != nil {
+			return nil, err
+		}
+	}
+
+	r.add(d)
+
+	return d, nil
+}
+
+// ReplayReader replays the recorded decisions read from rd. The decisions are
+// expected to be decision log events, one JSON object per line (NDJSON) as
+// produced by the console decision logger, or a JSON array of events as
+// uploaded to decision log services.
+func (r *Replayer) ReplayReader(ctx context.Context, rd io.Reader) error {
+
+	br := bufio.NewReader(rd)
+	decoder := util.NewJSONDecoder(br)
+
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read decision: %w", err)
+		}
+
+		var events []json.RawMessage
+		if len(raw) > 0 && raw[0] == '[' {
+			if err := util.UnmarshalJSON(raw, &events); err != nil {
+				return fmt.Errorf("failed to read decisions: %w", err)
+			}
+		} else {
+			events = []json.RawMessage{raw}
+		}
+
+		for _, bs := range events {
+			event, err := decodeEvent(bs)
+			if err != nil {
+				return err
+			}
+
+			if _, err := r.Replay(ctx, event); err != nil {
+				return fmt.Errorf("decision %v: %w", event.DecisionID, err)
+			}
+		}
+	}
+}
+
+// Report returns the report for the decisions replayed so far. The paths are
+// sorted.
+func (r *Replayer) Report() Report {
+	result := r.report
+	result.Paths = make([]*PathReport, 0, len(r.paths))
+	for _, pr := range r.paths {
+		result.Paths = append(result.Paths, pr)
+	}
+	sort.Slice(result.Paths, func(i, j int) bool {
+		return result.Paths[i].Path < result.Paths[j].Path
+	})
+	return result
+}
+
+func (r *Replayer) add(d *Decision) {
+
+	pr, ok := r.paths[d.Path]
+	if !ok {
+		pr = &PathReport{Path: d.Path}
+		r.paths[d.Path] = pr
+	}
+
+	r.report.Total++
+	pr.Total++
+
+	switch {
+	case d.Skipped != "":
+		r.report.Skipped++
+		pr.Skipped++
+	case d.Changed:
+		r.report.Changed++
+		pr.Changed++
+		pr.Decisions = append(pr.Decisions, *d)
+	}
+}
+
+func (r *Replayer) eval(ctx context.Context, event *logs.EventV1, d *Decision) error {
+
+	pq, err := r.prepare(ctx, d.Path)
+	if err != nil {
+		return err
+	}
+
+	// The recorded values of non-deterministic built-in functions, e.g.,
+	// time.now_ns and http.send, are replayed. Calls that were not recorded
+	// are evaluated.
+	cache, err := ndBuiltinCache(event.NDBuiltinCache)
+	if err != nil {
+		return fmt.Errorf("invalid nd_builtin_cache: %w", err)
+	}
+
+	opts := []rego.EvalOption{rego.EvalNDBuiltinCache(cache)}
+	if event.Input != nil {
+		opts = append(opts, rego.EvalInput(*event.Input))
+	}
+
+	rs, err := pq.Eval(ctx, opts...)
+	if err != nil {
+		d.CandidateError = err.Error()
+	} else if len(rs) > 0 && len(rs[0].Expressions) > 0 {
+		// Results are converted like in the decision logs, so that they
+		// can be compared with the recorded ones.
+		var result interface{}
+		if err := util.RoundTrip(&rs[0].Expressions[0].Value); err != nil {
+			return err
+		}
+		result = rs[0].Expressions[0].Value
+		d.Candidate = &result
+	}
+
+	switch {
+	case d.RecordedError != "" || d.CandidateError != "":
+		d.Changed = (d.RecordedError == "") != (d.CandidateError == "")
+	default:
+		diffValues("", d.Recorded, d.Candidate, &d.Diff)
+		d.Changed = len(d.Diff) > 0
+	}
+
+	return nil
+}
+
+func (r *Replayer) prepare(ctx context.Context, path string) (*rego.PreparedEvalQuery, error) {
+
+	if pq, ok := r.prepared[path]; ok {
+		return pq, nil
+	}
+
+	query, err := ref.ParseDataPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %v: %w", path, err)
+	}
+
+	opts := []func(*rego.Rego){rego.ParsedQuery(ast.NewBody(ast.NewExpr(ast.NewTerm(query))))}
+	if r.compiler != nil {
+		opts = append(opts, rego.Compiler(r.compiler))
+	}
+	if r.store != nil {
+		opts = append(opts, rego.Store(r.store))
+	}
+	opts = append(opts, r.options...)
+
+	pq, err := rego.New(opts...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.prepared[path] = &pq
+
+	return &pq, nil
+}
+
+func skipReason(event *logs.EventV1) string {
+
+	if event.Query != "" {
+		return SkipQuery
+	}
+
+	// Shadow events repeat a decision that is logged separately.
+	if event.Shadow != nil {
+		return SkipShadow
+	}
+
+	for _, p := range event.Erased {
+		if p == "/input" || strings.HasPrefix(p, "/input/") {
+			return SkipInputErased
+		}
+	}
+
+	for _, p := range event.Masked {
+		if p == "/input" || strings.HasPrefix(p, "/input/") {
+			return SkipInputMasked
+		}
+	}
+
+	return ""
+}
+
+// ndBuiltinCache converts the recorded cache into a builtins.NDBCache. The
+// arguments of the built-in calls are recorded as object keys, i.e., as
+// strings, and must be parsed to look up the calls during evaluation.
+func ndBuiltinCache(recorded *interface{}) (builtins.NDBCache, error) {
+
+	cache := builtins.NDBCache{}
+	if recorded == nil {
+		return cache, nil
+	}
+
+	calls, ok := (*recorded).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected object")
+	}
+
+	for name, x := range calls {
+		entries, ok := x.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v: expected object", name)
+		}
+		for key, value := range entries {
+			args, err := ast.ParseTerm(key)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", name, err)
+			}
+			v, err := ast.InterfaceToValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", name, err)
+			}
+			cache.Put(name, args.Value, v)
+		}
+	}
+
+	return cache, nil
+}
+
+// recordedEvent is used to decode decision log events. The error and the
+// shadow evaluation of the event are decoded separately since logs.EventV1
+// cannot unmarshal errors.
+type recordedEvent struct {
+	logs.EventV1
+	Error  json.RawMessage `json:"error,omitempty"`
+	Shadow json.RawMessage `json:"shadow,omitempty"`
+}
+
+func decodeEvent(bs []byte) (*logs.EventV1, error) {
+
+	var e recordedEvent
+	if err := util.UnmarshalJSON(bs, &e); err != nil {
+		return nil, fmt.Errorf("failed to read decision: %w", err)
+	}
+
+	if len(e.Error) > 0 && string(e.Error) != "null" {
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(e.Error, &msg); err == nil && msg.Message != "" {
+			e.EventV1.Error = errors.New(msg.Message)
+		} else {
+			e.EventV1.Error = errors.New(string(e.Error))
+		}
+	}
+
+	if len(e.Shadow) > 0 && string(e.Shadow) != "null" {
+		e.EventV1.Shadow = &logs.ShadowV1{}
+	}
+
+	return &e.EventV1, nil
+}
+
+// diffValues appends the differences between the recorded and the candidate
+// value to result. Objects are compared key by key, and arrays of the same
+// length element by element. All other values are compared as a whole.
+func diffValues(path string, recorded, candidate *interface{}, result *[]ValueDiff) {
+
+	if recorded == nil || candidate == nil {
+		if recorded != candidate {
+			*result = append(*result, ValueDiff{Path: pointer(path), Recorded: recorded, Candidate: candidate})
+		}
+		return
+	}
+
+	switch a := (*recorded).(type) {
+	case map[string]interface{}:
+		if b, ok := (*candidate).(map[string]interface{}); ok {
+			keys := make([]string, 0, len(a)+len(b))
+			for k := range a {
+				keys = append(keys, k)
+			}
+			for k := range b {
+				if _, ok := a[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				diffValues(path+"/"+escapePointer(k), lookup(a, k), lookup(b, k), result)
+			}
+			return
+		}
+	case []interface{}:
+		if b, ok := (*candidate).([]interface{}); ok && len(a) == len(b) {
+			for i := range a {
+				diffValues(fmt.Sprintf("%v/%d", path, i), &a[i], &b[i], result)
+			}
+			return
+		}
+	}
+
+	if util.Compare(*recorded, *candidate) != 0 {
+		*result = append(*result, ValueDiff{Path: pointer(path), Recorded: recorded, Candidate: candidate})
+	}
+}
+
+func lookup(obj map[string]interface{}, key string) *interface{} {
+	if v, ok := obj[key]; ok {
+		return &v
+	}
+	return nil
+}
+
+func pointer(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
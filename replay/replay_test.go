@@ -0,0 +1,211 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/util"
+)
+
+func TestReplayReader(t *testing.T) {
+
+	module := `package authz
+
+	default allow = false
+
+	allow {
+		input.user == "alice"
+	}
+
+	allow {
+		input.user == data.admins[_]
+	}
+
+	reasons[msg] {
+		not allow
+		msg := sprintf("denied %v", [input.user])
+	}
+
+	now := time.now_ns()
+
+	conflict = x {
+		x := input.conflict[_]
+	}`
+
+	events := `
+{"decision_id": "1", "path": "authz/allow", "input": {"user": "alice"}, "result": true}
+{"decision_id": "2", "path": "authz/allow", "input": {"user": "bob"}, "result": false}
+{"decision_id": "3", "path": "/authz/allow", "input": {"user": "carol"}, "result": true}
+{"decision_id": "4", "path": "authz", "input": {"user": "bob"}, "result": {"allow": false, "reasons": ["denied bob"], "now": 1}, "nd_builtin_cache": {"time.now_ns": {"[]": 1}}}
+{"decision_id": "5", "path": "authz/missing", "input": {}}
+{"decision_id": "6", "query": "data.authz.allow", "input": {"user": "carol"}, "result": true}
+{"decision_id": "7", "path": "authz/allow", "input": {"user": "carol"}, "erased": ["/input/user"]}
+{"decision_id": "7", "path": "authz/allow", "input": {"user": "carol"}, "result": true, "shadow": {"error": {"code": "eval_conflict_error"}}}
+[{"decision_id": "8", "path": "authz/now", "result": 2, "nd_builtin_cache": {"time.now_ns": {"[]": 2}}},
+ {"decision_id": "9", "path": "authz/conflict", "input": {"conflict": [1, 2]}, "error": {"code": "internal_error", "message": "eval_conflict_error"}}]
+`
+
+	ctx := context.Background()
+	compiler := ast.MustCompileModules(map[string]string{"authz.rego": module})
+	store := inmem.NewFromObject(map[string]interface{}{"admins": []interface{}{"bob"}})
+
+	r := NewReplayer().SetCompiler(compiler).SetStore(store)
+
+	if err := r.ReplayReader(ctx, strings.NewReader(events)); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `{
+		"total": 10,
+		"changed": 3,
+		"skipped": 3,
+		"paths": [
+			{"path": "authz", "total": 1, "changed": 1, "skipped": 0, "changed_decisions": [
+				{
+					"decision_id": "4",
+					"path": "authz",
+					"input": {"user": "bob"},
+					"recorded": {"allow": false, "reasons": ["denied bob"], "now": 1},
+					"candidate": {"allow": true, "reasons": [], "now": 1},
+					"changed": true,
+					"diff": [
+						{"path": "/allow", "recorded": false, "candidate": true},
+						{"path": "/reasons", "recorded": ["denied bob"], "candidate": []}
+					]
+				}
+			]},
+			{"path": "authz/allow", "total": 5, "changed": 2, "skipped": 2, "changed_decisions": [
+				{
+					"decision_id": "2",
+					"path": "authz/allow",
+					"input": {"user": "bob"},
+					"recorded": false,
+					"candidate": true,
+					"changed": true,
+					"diff": [{"path": "/", "recorded": false, "candidate": true}]
+				},
+				{
+					"decision_id": "3",
+					"path": "authz/allow",
+					"input": {"user": "carol"},
+					"recorded": true,
+					"candidate": false,
+					"changed": true,
+					"diff": [{"path": "/", "recorded": true, "candidate": false}]
+				}
+			]},
+			{"path": "authz/conflict", "total": 1, "changed": 0, "skipped": 0},
+			{"path": "authz/missing", "total": 1, "changed": 0, "skipped": 0},
+			{"path": "authz/now", "total": 1, "changed": 0, "skipped": 0}
+		]
+	}`
+
+	// The ad-hoc query is reported under the empty path.
+	report := r.Report()
+	if len(report.Paths) != 6 || report.Paths[0].Path != "" || report.Paths[0].Skipped != 1 {
+		t.Fatalf("expected skipped ad-hoc query first but got: %v", string(util.MustMarshalJSON(report)))
+	}
+	report.Paths = report.Paths[1:]
+
+	expected := util.MustUnmarshalJSON([]byte(exp))
+	if actual := util.MustUnmarshalJSON(util.MustMarshalJSON(report)); util.Compare(expected, actual) != 0 {
+		t.Fatalf("expected report:\n\n%v\n\ngot:\n\n%v", string(util.MustMarshalJSON(expected)), string(util.MustMarshalJSON(actual)))
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+
+	ctx := context.Background()
+	compiler := ast.MustCompileModules(map[string]string{"x.rego": `package x
+
+	p = x {
+		x := input.x[_]
+	}`})
+
+	tests := []struct {
+		note    string
+		event   string
+		changed bool
+		err     string
+	}{
+		{
+			note:    "new error",
+			event:   `{"decision_id": "1", "path": "x/p", "input": {"x": [1, 2]}, "result": 1}`,
+			changed: true,
+			err:     "complete rules must not produce multiple outputs",
+		},
+		{
+			note:  "recorded error",
+			event: `{"decision_id": "2", "path": "x/p", "input": {"x": [1, 2]}, "error": {"message": "complete rules must not produce multiple outputs"}}`,
+			err:   "complete rules must not produce multiple outputs",
+		},
+		{
+			note:    "fixed error",
+			event:   `{"decision_id": "3", "path": "x/p", "input": {"x": [1]}, "error": "complete rules must not produce multiple outputs"}`,
+			changed: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			event, err := decodeEvent([]byte(tc.event))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d, err := NewReplayer().SetCompiler(compiler).Replay(ctx, event)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if d.Changed != tc.changed {
+				t.Fatalf("expected changed to be %v but got: %v", tc.changed, d.Changed)
+			}
+
+			if !strings.Contains(d.CandidateError, tc.err) || (tc.err == "") != (d.CandidateError == "") {
+				t.Fatalf("expected candidate error %q but got: %q", tc.err, d.CandidateError)
+			}
+		})
+	}
+}
+
+func TestReplayHTTPSend(t *testing.T) {
+
+	ctx := context.Background()
+	compiler := ast.MustCompileModules(map[string]string{"x.rego": `package x
+
+	status = http.send({"method": "get", "url": "http://replay.invalid/status"}).body.status`})
+
+	// The response is replayed from the recorded cache, the URL is never
+	// requested.
+	event, err := decodeEvent([]byte(`{
+		"decision_id": "1",
+		"path": "x/status",
+		"result": "ok",
+		"nd_builtin_cache": {
+			"http.send": {
+				"[{\"method\":\"get\",\"url\":\"http://replay.invalid/status\"}]": {"status_code": 200, "body": {"status": "ok"}}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewReplayer().SetCompiler(compiler).Replay(ctx, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Changed || d.CandidateError != "" {
+		t.Fatalf("expected unchanged decision but got: %v", string(util.MustMarshalJSON(d)))
+	}
+}
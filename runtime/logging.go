@@ -248,6 +248,14 @@ func (r *recorder) WriteHeader(s int) {
 	r.inner.WriteHeader(s)
 }
 
+// Flush implements http.Flusher so that streaming handlers behind the
+// logging handler can flush partial responses to the client.
+func (r *recorder) Flush() {
+	if f, ok := r.inner.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func readBody(r io.ReadCloser) ([]byte, io.ReadCloser, error) {
 	if r == http.NoBody {
 		return nil, r, nil
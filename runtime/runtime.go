@@ -120,6 +120,10 @@ type Params struct {
 	// input history.
 	HistoryPath string
 
+	// SessionPath is the filename to persist the interactive shell session
+	// in. If set, the session is restored on startup and saved on exit.
+	SessionPath string
+
 	// Output format controls how the REPL will print query results.
 	// Default: "pretty".
 	OutputFormat string
@@ -356,7 +360,18 @@ func NewRuntime(ctx context.Context, params Params) (*Runtime, error) {
 			return nil, fmt.Errorf("initialize disk store: %w", err)
 		}
 	} else {
-		store = inmem.NewWithOpts(inmem.OptRoundTripOnWrite(false))
+		opts := []inmem.Opt{inmem.OptRoundTripOnWrite(false)}
+		durability, err := inmem.DurabilityConfigFromConfig(config, params.ID)
+		if err != nil {
+			return nil, fmt.Errorf("parse inmem store configuration: %w", err)
+		}
+		if durability != nil {
+			opts = append(opts, inmem.OptDurability(*durability))
+		}
+		store, err = inmem.Open(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("initialize inmem store: %w", err)
+		}
 	}
 
 	traceExporter, tracerProvider, err := internal_tracing.Init(ctx, config, params.ID)
@@ -630,7 +645,8 @@ func (rt *Runtime) StartREPL(ctx context.Context) {
 
 	banner := rt.getBanner()
 	repl := repl.New(rt.Store, rt.Params.HistoryPath, rt.Params.Output, rt.Params.OutputFormat, rt.Params.ErrorLimit, banner).
-		WithRuntime(rt.Manager.Info)
+		WithRuntime(rt.Manager.Info).
+		WithSession(rt.Params.SessionPath)
 
 	if rt.Params.Watch {
 		if err := rt.startWatcher(ctx, rt.Params.Paths, onReloadPrinter(rt.Params.Output)); err != nil {
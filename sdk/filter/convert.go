@@ -0,0 +1,342 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// ConversionErr indicates that a partial evaluation result cannot be
+// converted into a filter expression.
+const ConversionErr = "filter_conversion_error"
+
+// Converter converts partial evaluation results into filter expressions. It
+// is used by the Mapper and by packages that translate partial evaluation
+// results into query languages.
+//
+// Results are converted if every residual expression is a comparison between
+// a field and a constant (or another field, if enabled), a string match with
+// the startswith, endswith or contains built-in functions, a membership test
+// of a field in an array or set of constants, or a reference to a boolean
+// field. Results that contain support rules, i.e., rules that could not be
+// inlined, are not supported.
+type Converter struct {
+	// Field returns the path of the field that ref refers to. The path is nil
+	// if ref does not refer to a field. An error is returned if ref refers to a
+	// field that is not supported.
+	Field func(ref ast.Ref) (Path, error)
+
+	// CompareFields enables comparisons between fields.
+	CompareFields bool
+}
+
+// FieldsOf returns a Field function for fields of unknown. The paths of the
+// fields are relative to unknown, e.g., input.pets.owner refers to the field
+// ["owner"] of the unknown input.pets.
+func FieldsOf(unknown ast.Ref) func(ast.Ref) (Path, error) {
+	return func(ref ast.Ref) (Path, error) {
+		if len(ref) <= len(unknown) || !ref.HasPrefix(unknown) {
+			return nil, nil
+		}
+		return stringPath(ref[len(unknown):]), nil
+	}
+}
+
+// stringPath returns ref as a Path if all of its terms are strings.
+func stringPath(ref ast.Ref) Path {
+	path := make(Path, 0, len(ref))
+	for _, x := range ref {
+		s, ok := x.Value.(ast.String)
+		if !ok {
+			return nil
+		}
+		path = append(path, string(s))
+	}
+	return path
+}
+
+// Convert converts pq into an Expr. The queries are converted into an Or of
+// Ands, which is simplified if the result is unconditional or consists of a
+// single expression. If pq cannot be converted, the returned ast.Errors
+// contain every unsupported construct.
+func (c *Converter) Convert(pq *rego.PartialQueries) (Expr, error) {
+
+	conv := &conversion{Converter: c}
+
+	for _, mod := range pq.Support {
+		for _, rule := range mod.Rules {
+			conv.errorf(rule.Location, "support rule %v cannot be converted (rules that are not inlined are not supported)", rule.Path())
+		}
+	}
+
+	result := make(Or, 0, len(pq.Queries))
+
+	for _, body := range pq.Queries {
+		conj := make(And, 0, len(body))
+		for _, expr := range body {
+			if x := conv.expr(expr); x != nil {
+				conj = append(conj, x)
+			}
+		}
+		result = append(result, conj)
+	}
+
+	if len(conv.errs) > 0 {
+		return nil, conv.errs
+	}
+
+	return simplify(result), nil
+}
+
+// conversion records an error for every construct that is not supported.
+type conversion struct {
+	*Converter
+	errs ast.Errors
+}
+
+func (c *conversion) errorf(loc *ast.Location, f string, a ...interface{}) {
+	c.errs = append(c.errs, ast.NewError(ConversionErr, loc, f, a...))
+}
+
+var compareOps = map[string]Op{
+	ast.Equality.Name:      OpEq,
+	ast.Equal.Name:         OpEq,
+	ast.NotEqual.Name:      OpNeq,
+	ast.LessThan.Name:      OpLt,
+	ast.LessThanEq.Name:    OpLte,
+	ast.GreaterThan.Name:   OpGt,
+	ast.GreaterThanEq.Name: OpGte,
+}
+
+var mirroredOps = map[Op]Op{
+	OpEq:  OpEq,
+	OpNeq: OpNeq,
+	OpLt:  OpGt,
+	OpLte: OpGte,
+	OpGt:  OpLt,
+	OpGte: OpLte,
+}
+
+var matchOps = map[string]Op{
+	ast.StartsWith.Name: OpStartsWith,
+	ast.EndsWith.Name:   OpEndsWith,
+	ast.Contains.Name:   OpContains,
+}
+
+func (c *conversion) expr(expr *ast.Expr) Expr {
+
+	if len(expr.With) > 0 {
+		c.errorf(expr.Location, "with keyword cannot be converted: %v", expr)
+		return nil
+	}
+
+	var result Expr
+
+	switch terms := expr.Terms.(type) {
+	case *ast.Term:
+		result = c.term(expr, terms)
+	case []*ast.Term:
+		result = c.call(expr, terms)
+	default:
+		c.errorf(expr.Location, "expression cannot be converted: %v", expr)
+	}
+
+	if result != nil && expr.Negated {
+		return Not{Expr: result}
+	}
+
+	return result
+}
+
+// term converts a reference to a boolean field.
+func (c *conversion) term(expr *ast.Expr, term *ast.Term) Expr {
+	if b, ok := term.Value.(ast.Boolean); ok {
+		if b {
+			return And{}
+		}
+		return Or{}
+	}
+	path, err := c.field(term)
+	if err != nil {
+		return c.fieldError(term, err)
+	} else if path == nil {
+		c.errorf(expr.Location, "expression cannot be converted: %v", expr)
+		return nil
+	}
+	return Compare{Operator: OpEq, Field: path, Value: true}
+}
+
+func (c *conversion) call(expr *ast.Expr, terms []*ast.Term) Expr {
+
+	name := expr.Operator().String()
+	operands := terms[1:]
+
+	if len(operands) != 2 {
+		c.errorf(expr.Location, "built-in function %v cannot be converted: %v", name, expr)
+		return nil
+	}
+
+	if op, ok := compareOps[name]; ok {
+		fields := make([]Path, len(operands))
+		for i := range operands {
+			path, err := c.field(operands[i])
+			if err != nil {
+				return c.fieldError(operands[i], err)
+			}
+			fields[i] = path
+		}
+		path, otherPath, other := fields[0], fields[1], operands[1]
+		if path == nil {
+			if otherPath == nil {
+				c.errorf(expr.Location, "comparison does not refer to a field: %v", expr)
+				return nil
+			}
+			path, otherPath, other = otherPath, nil, operands[0]
+			op = mirroredOps[op]
+		}
+		if otherPath != nil {
+			if !c.CompareFields {
+				c.errorf(expr.Location, "comparison between fields cannot be converted: %v", expr)
+				return nil
+			}
+			return Compare{Operator: op, Field: path, Other: otherPath}
+		}
+		value, ok := constant(other)
+		if !ok {
+			c.errorf(expr.Location, "field can only be compared with a constant: %v", expr)
+			return nil
+		}
+		if value == nil && op != OpEq && op != OpNeq {
+			c.errorf(expr.Location, "field cannot be ordered with null: %v", expr)
+			return nil
+		}
+		return Compare{Operator: op, Field: path, Value: value}
+	}
+
+	if op, ok := matchOps[name]; ok {
+		path, err := c.field(operands[0])
+		if err != nil {
+			return c.fieldError(operands[0], err)
+		} else if path == nil {
+			c.errorf(expr.Location, "first argument of %v must be a field: %v", name, expr)
+			return nil
+		}
+		s, ok := operands[1].Value.(ast.String)
+		if !ok {
+			c.errorf(expr.Location, "second argument of %v must be a string: %v", name, expr)
+			return nil
+		}
+		return StringMatch{Operator: op, Field: path, Value: string(s)}
+	}
+
+	if name == ast.Member.Name {
+		path, err := c.field(operands[0])
+		if err != nil {
+			return c.fieldError(operands[0], err)
+		} else if path == nil {
+			c.errorf(expr.Location, "membership test does not refer to a field: %v", expr)
+			return nil
+		}
+		values, ok := collection(operands[1])
+		if !ok {
+			c.errorf(expr.Location, "field can only be tested for membership in an array or set of constants: %v", expr)
+			return nil
+		}
+		return In{Field: path, Values: values}
+	}
+
+	c.errorf(expr.Location, "built-in function %v cannot be converted: %v", name, expr)
+	return nil
+}
+
+// field returns the path of the field that term refers to or nil if term
+// does not refer to a field.
+func (c *conversion) field(term *ast.Term) (Path, error) {
+	ref, ok := term.Value.(ast.Ref)
+	if !ok {
+		return nil, nil
+	}
+	return c.Field(ref)
+}
+
+func (c *conversion) fieldError(term *ast.Term, err error) Expr {
+	c.errorf(term.Location, "%v", err)
+	return nil
+}
+
+// constant returns term as a JSON value if it is a scalar.
+func constant(term *ast.Term) (interface{}, bool) {
+	if !ast.IsScalar(term.Value) {
+		return nil, false
+	}
+	value, err := ast.JSON(term.Value)
+	return value, err == nil
+}
+
+// collection returns the elements of term if it is an array or set of
+// constants other than null.
+func collection(term *ast.Term) ([]interface{}, bool) {
+
+	var elems []*ast.Term
+
+	switch v := term.Value.(type) {
+	case *ast.Array:
+		v.Foreach(func(x *ast.Term) { elems = append(elems, x) })
+	case ast.Set:
+		v.Sorted().Foreach(func(x *ast.Term) { elems = append(elems, x) })
+	default:
+		return nil, false
+	}
+
+	values := make([]interface{}, 0, len(elems))
+	for _, elem := range elems {
+		value, ok := constant(elem)
+		if !ok || value == nil {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+
+	return values, true
+}
+
+// simplify collapses compound expressions that are always or never satisfied
+// and that contain a single expression.
+func simplify(expr Expr) Expr {
+	switch x := expr.(type) {
+	case Or:
+		result := make(Or, 0, len(x))
+		for _, e := range x {
+			e = simplify(e)
+			if IsTrue(e) {
+				return And{}
+			} else if !IsFalse(e) {
+				result = append(result, e)
+			}
+		}
+		if len(result) == 1 {
+			return result[0]
+		}
+		return result
+	case And:
+		result := make(And, 0, len(x))
+		for _, e := range x {
+			e = simplify(e)
+			if IsFalse(e) {
+				return Or{}
+			} else if !IsTrue(e) {
+				result = append(result, e)
+			}
+		}
+		if len(result) == 1 {
+			return result[0]
+		}
+		return result
+	case Not:
+		return Not{Expr: simplify(x.Expr)}
+	}
+	return expr
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// ToJSON returns the JSON encoding of expr as a Go value, i.e., as nested
+// maps and slices.
+func ToJSON(expr Expr) (interface{}, error) {
+	bs, err := json.Marshal(expr)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	return result, util.UnmarshalJSON(bs, &result)
+}
+
+// Match returns true if item satisfies expr. The item can be any value that
+// can be represented as JSON, e.g., a map or a struct, in which case the
+// field paths refer to the JSON field names. Values are compared with the same
+// semantics as in Rego, e.g., comparisons with fields that do not exist are
+// not satisfied.
+func Match(expr Expr, item interface{}) (bool, error) {
+	v, err := ast.InterfaceToValue(item)
+	if err != nil {
+		return false, err
+	}
+	return match(expr, v)
+}
+
+// Filter returns a new slice with the elements of items that satisfy expr.
+// The items must be a slice, the result has the same type as items.
+func Filter(expr Expr, items interface{}) (interface{}, error) {
+
+	rv := reflect.ValueOf(items)
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("filter: expected slice but got %T", items)
+	}
+
+	result := reflect.MakeSlice(rv.Type(), 0, rv.Len())
+
+	for i := 0; i < rv.Len(); i++ {
+		ok, err := Match(expr, rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = reflect.Append(result, rv.Index(i))
+		}
+	}
+
+	return result.Interface(), nil
+}
+
+func match(expr Expr, item ast.Value) (bool, error) {
+	switch x := expr.(type) {
+	case And:
+		for _, e := range x {
+			if ok, err := match(e, item); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case Or:
+		for _, e := range x {
+			if ok, err := match(e, item); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case Not:
+		ok, err := match(x.Expr, item)
+		return !ok, err
+	case Compare:
+		v := lookup(item, x.Field)
+		if v == nil {
+			return false, nil
+		}
+		var other ast.Value
+		if x.Other != nil {
+			if other = lookup(item, x.Other); other == nil {
+				return false, nil
+			}
+		} else {
+			var err error
+			if other, err = ast.InterfaceToValue(x.Value); err != nil {
+				return false, err
+			}
+		}
+		cmp := ast.Compare(v, other)
+		switch x.Operator {
+		case OpEq:
+			return cmp == 0, nil
+		case OpNeq:
+			return cmp != 0, nil
+		case OpLt:
+			return cmp < 0, nil
+		case OpLte:
+			return cmp <= 0, nil
+		case OpGt:
+			return cmp > 0, nil
+		case OpGte:
+			return cmp >= 0, nil
+		}
+		return false, fmt.Errorf("filter: unknown operator %q", x.Operator)
+	case StringMatch:
+		s, ok := lookup(item, x.Field).(ast.String)
+		if !ok {
+			return false, nil
+		}
+		switch x.Operator {
+		case OpStartsWith:
+			return strings.HasPrefix(string(s), x.Value), nil
+		case OpEndsWith:
+			return strings.HasSuffix(string(s), x.Value), nil
+		case OpContains:
+			return strings.Contains(string(s), x.Value), nil
+		}
+		return false, fmt.Errorf("filter: unknown operator %q", x.Operator)
+	case In:
+		v := lookup(item, x.Field)
+		if v == nil {
+			return false, nil
+		}
+		for _, value := range x.Values {
+			other, err := ast.InterfaceToValue(value)
+			if err != nil {
+				return false, err
+			}
+			if ast.Compare(v, other) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("filter: unknown expression type %T", expr)
+}
+
+// lookup returns the value at path in v or nil if it does not exist.
+func lookup(v ast.Value, path Path) ast.Value {
+	for _, key := range path {
+		obj, ok := v.(ast.Object)
+		if !ok {
+			return nil
+		}
+		term := obj.Get(ast.StringTerm(key))
+		if term == nil {
+			return nil
+		}
+		v = term.Value
+	}
+	return v
+}
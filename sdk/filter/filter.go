@@ -0,0 +1,289 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package filter contains a neutral representation of data filters derived
+// from partial evaluation results.
+//
+// A filter is a tree of expressions that refer to the fields of an unknown,
+// e.g., the pets collection in input.pets. Filters can be encoded as JSON,
+// translated into query languages by consumers, or applied to collections of
+// Go values in memory with Match and Filter. Use the Mapper with the SDK's
+// Partial function to obtain filters:
+//
+//	result, err := opa.Partial(ctx, sdk.PartialOptions{
+//		Query:    "data.pets.allow == true",
+//		Input:    input,
+//		Unknowns: []string{"input.pets"},
+//		Mapper:   &filter.Mapper{Unknown: "input.pets"},
+//	})
+//	...
+//	pets, err := filter.Filter(result.Result.(filter.Expr), pets)
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/util"
+)
+
+// Op names the operator of an expression.
+type Op string
+
+const (
+	// OpAnd is the operator of And expressions.
+	OpAnd Op = "and"
+
+	// OpOr is the operator of Or expressions.
+	OpOr Op = "or"
+
+	// OpNot is the operator of Not expressions.
+	OpNot Op = "not"
+
+	// OpIn is the operator of In expressions.
+	OpIn Op = "in"
+
+	// OpEq tests if a field is equal to a value.
+	OpEq Op = "eq"
+
+	// OpNeq tests if a field is not equal to a value.
+	OpNeq Op = "neq"
+
+	// OpLt tests if a field is less than a value.
+	OpLt Op = "lt"
+
+	// OpLte tests if a field is less than or equal to a value.
+	OpLte Op = "lte"
+
+	// OpGt tests if a field is greater than a value.
+	OpGt Op = "gt"
+
+	// OpGte tests if a field is greater than or equal to a value.
+	OpGte Op = "gte"
+
+	// OpStartsWith tests if a string field starts with a value.
+	OpStartsWith Op = "startswith"
+
+	// OpEndsWith tests if a string field ends with a value.
+	OpEndsWith Op = "endswith"
+
+	// OpContains tests if a string field contains a value.
+	OpContains Op = "contains"
+)
+
+// Expr is a filter expression. An Expr is one of And, Or, Not, Compare,
+// StringMatch or In.
+type Expr interface {
+	Op() Op
+}
+
+// Path is the path of a field below the unknown, e.g., ["owner", "name"]
+// refers to input.pets.owner.name if the unknown is input.pets.
+type Path []string
+
+type (
+	// And is satisfied if all of its expressions are satisfied. An empty And
+	// is always satisfied.
+	And []Expr
+
+	// Or is satisfied if any of its expressions is satisfied. An empty Or is
+	// never satisfied.
+	Or []Expr
+
+	// Not is satisfied if its expression is not satisfied.
+	Not struct {
+		Expr Expr
+	}
+
+	// Compare compares a field with a value or with another field. The value
+	// is a JSON value, i.e., nil, a bool, a string or a json.Number.
+	// Comparisons are never satisfied if a field does not exist.
+	Compare struct {
+		Operator Op // one of OpEq, OpNeq, OpLt, OpLte, OpGt or OpGte
+		Field    Path
+		Value    interface{}
+		Other    Path // set if the field is compared with another field
+	}
+
+	// StringMatch matches a string field against a value. Matches are never
+	// satisfied if the field does not exist or is not a string.
+	StringMatch struct {
+		Operator Op // one of OpStartsWith, OpEndsWith or OpContains
+		Field    Path
+		Value    string
+	}
+
+	// In is satisfied if a field is equal to any of the values.
+	In struct {
+		Field  Path
+		Values []interface{}
+	}
+)
+
+// Op returns OpAnd.
+func (And) Op() Op { return OpAnd }
+
+// Op returns OpOr.
+func (Or) Op() Op { return OpOr }
+
+// Op returns OpNot.
+func (Not) Op() Op { return OpNot }
+
+// Op returns the comparison operator.
+func (c Compare) Op() Op { return c.Operator }
+
+// Op returns the string matching operator.
+func (m StringMatch) Op() Op { return m.Operator }
+
+// Op returns OpIn.
+func (In) Op() Op { return OpIn }
+
+// IsTrue returns true if expr is always satisfied.
+func IsTrue(expr Expr) bool {
+	x, ok := expr.(And)
+	return ok && len(x) == 0
+}
+
+// IsFalse returns true if expr is never satisfied.
+func IsFalse(expr Expr) bool {
+	x, ok := expr.(Or)
+	return ok && len(x) == 0
+}
+
+// jsonExpr is the JSON encoding of all expressions. Compound expressions set
+// Args, Not sets Arg and the others set Field and Value, Values or Other.
+type jsonExpr struct {
+	Op     Op                `json:"op"`
+	Args   []json.RawMessage `json:"args,omitempty"`
+	Arg    json.RawMessage   `json:"arg,omitempty"`
+	Field  Path              `json:"field,omitempty"`
+	Value  interface{}       `json:"value,omitempty"`
+	Values []interface{}     `json:"values,omitempty"`
+	Other  Path              `json:"other,omitempty"`
+}
+
+// MarshalJSON encodes the expression as {"op": "and", "args": [...]}.
+func (x And) MarshalJSON() ([]byte, error) {
+	return marshalCompound(OpAnd, x)
+}
+
+// MarshalJSON encodes the expression as {"op": "or", "args": [...]}.
+func (x Or) MarshalJSON() ([]byte, error) {
+	return marshalCompound(OpOr, x)
+}
+
+// MarshalJSON encodes the expression as {"op": "not", "arg": ...}.
+func (x Not) MarshalJSON() ([]byte, error) {
+	bs, err := json.Marshal(x.Expr)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonExpr{Op: OpNot, Arg: bs})
+}
+
+// MarshalJSON encodes the expression as {"op": "eq", "field": [...], "value": ...}
+// or, if the field is compared with another field, as {"op": "eq", "field": [...], "other": [...]}.
+func (x Compare) MarshalJSON() ([]byte, error) {
+	if x.Other != nil {
+		return json.Marshal(jsonExpr{Op: x.Operator, Field: x.Field, Other: x.Other})
+	}
+	// Null values have to be encoded explicitly.
+	return json.Marshal(struct {
+		Op    Op          `json:"op"`
+		Field Path        `json:"field"`
+		Value interface{} `json:"value"`
+	}{x.Operator, x.Field, x.Value})
+}
+
+// MarshalJSON encodes the expression as {"op": "startswith", "field": [...], "value": "..."}.
+func (x StringMatch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Op    Op     `json:"op"`
+		Field Path   `json:"field"`
+		Value string `json:"value"`
+	}{x.Operator, x.Field, x.Value})
+}
+
+// MarshalJSON encodes the expression as {"op": "in", "field": [...], "values": [...]}.
+func (x In) MarshalJSON() ([]byte, error) {
+	values := x.Values
+	if values == nil {
+		values = []interface{}{}
+	}
+	return json.Marshal(struct {
+		Op     Op            `json:"op"`
+		Field  Path          `json:"field"`
+		Values []interface{} `json:"values"`
+	}{OpIn, x.Field, values})
+}
+
+func marshalCompound(op Op, exprs []Expr) ([]byte, error) {
+	args := make([]json.RawMessage, len(exprs))
+	for i := range exprs {
+		bs, err := json.Marshal(exprs[i])
+		if err != nil {
+			return nil, err
+		}
+		args[i] = bs
+	}
+	return json.Marshal(struct {
+		Op   Op                `json:"op"`
+		Args []json.RawMessage `json:"args"`
+	}{op, args})
+}
+
+// Unmarshal decodes the JSON encoding of an expression. Numbers are decoded
+// as json.Number values.
+func Unmarshal(bs []byte) (Expr, error) {
+	var x jsonExpr
+	if err := util.UnmarshalJSON(bs, &x); err != nil {
+		return nil, err
+	}
+
+	switch x.Op {
+	case OpAnd, OpOr:
+		exprs := make([]Expr, 0, len(x.Args))
+		for _, arg := range x.Args {
+			expr, err := Unmarshal(arg)
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, expr)
+		}
+		if x.Op == OpAnd {
+			return And(exprs), nil
+		}
+		return Or(exprs), nil
+	case OpNot:
+		if x.Arg == nil {
+			return nil, fmt.Errorf("filter: not expression requires an argument")
+		}
+		expr, err := Unmarshal(x.Arg)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: expr}, nil
+	case OpIn:
+		if len(x.Field) == 0 {
+			return nil, fmt.Errorf("filter: in expression requires a field")
+		}
+		return In{Field: x.Field, Values: x.Values}, nil
+	case OpEq, OpNeq, OpLt, OpLte, OpGt, OpGte:
+		if len(x.Field) == 0 {
+			return nil, fmt.Errorf("filter: %v expression requires a field", x.Op)
+		}
+		return Compare{Operator: x.Op, Field: x.Field, Value: x.Value, Other: x.Other}, nil
+	case OpStartsWith, OpEndsWith, OpContains:
+		if len(x.Field) == 0 {
+			return nil, fmt.Errorf("filter: %v expression requires a field", x.Op)
+		}
+		value, ok := x.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("filter: %v expression requires a string value", x.Op)
+		}
+		return StringMatch{Operator: x.Op, Field: x.Field, Value: value}, nil
+	}
+
+	return nil, fmt.Errorf("filter: unknown operator %q", x.Op)
+}
@@ -0,0 +1,313 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const testPolicy = `package pets
+
+import future.keywords.in
+
+allow {
+	input.pets.owner == input.subject
+}
+
+allow {
+	input.pets.public
+	input.pets.kind in {"dog", "cat"}
+	not input.pets.age > 10
+}
+
+nested {
+	input.pets.vet.name != null
+}
+
+old {
+	8 <= input.pets.age
+}
+
+never {
+	input.pets.owner == input.subject
+	false
+}
+
+always {
+	input.subject == "bob"
+}
+
+named {
+	startswith(input.pets.name, "f")
+}
+
+unsupported {
+	count(input.pets.owner) > 3
+}
+`
+
+func partial(t *testing.T, query string) *rego.PartialQueries {
+	t.Helper()
+
+	pq, err := rego.New(
+		rego.Query(query),
+		rego.Module("pets.rego", testPolicy),
+		rego.Input(map[string]interface{}{"subject": "bob"}),
+		rego.Unknowns([]string{"input.pets"}),
+	).Partial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pq
+}
+
+func TestMapper(t *testing.T) {
+
+	tests := []struct {
+		note  string
+		query string
+		exp   string
+	}{
+		{
+			note:  "allow",
+			query: "data.pets.allow == true",
+			exp: `{"op": "or", "args": [
+				{"op": "eq", "field": ["owner"], "value": "bob"},
+				{"op": "and", "args": [
+					{"op": "eq", "field": ["public"], "value": true},
+					{"op": "in", "field": ["kind"], "values": ["cat", "dog"]},
+					{"op": "not", "arg": {"op": "gt", "field": ["age"], "value": 10}}
+				]}
+			]}`,
+		},
+		{
+			note:  "nested",
+			query: "data.pets.nested == true",
+			exp:   `{"op": "neq", "field": ["vet", "name"], "value": null}`,
+		},
+		{
+			note:  "constant on the left",
+			query: "data.pets.old == true",
+			exp:   `{"op": "gte", "field": ["age"], "value": 8}`,
+		},
+		{
+			note:  "string match",
+			query: "data.pets.named == true",
+			exp:   `{"op": "startswith", "field": ["name"], "value": "f"}`,
+		},
+		{
+			note:  "never",
+			query: "data.pets.never == true",
+			exp:   `{"op": "or", "args": []}`,
+		},
+		{
+			note:  "always",
+			query: "data.pets.always == true",
+			exp:   `{"op": "and", "args": []}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			m := &Mapper{Unknown: "input.pets"}
+
+			result, err := m.MapResults(partial(t, tc.query))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := m.ResultToJSON(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if exp := util.MustUnmarshalJSON([]byte(tc.exp)); !reflect.DeepEqual(exp, actual) {
+				t.Fatalf("expected:\n\n%v\n\ngot:\n\n%v", exp, actual)
+			}
+
+			// Verify that the JSON encoding round trips.
+			bs, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expr, err := Unmarshal(bs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(expr, result) {
+				t.Fatalf("expected %#v but got %#v", result, expr)
+			}
+		})
+	}
+}
+
+func TestMapperErrors(t *testing.T) {
+
+	m := &Mapper{Unknown: "input.pets"}
+
+	_, err := m.MapResults(partial(t, "data.pets.unsupported == true"))
+	if err == nil || err.Error() != "1 error occurred: pets.rego:37: filter_conversion_error: comparison does not refer to a field: gt(count(input.pets.owner), 3)" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m = &Mapper{Unknown: "input.users"}
+
+	_, err = m.MapResults(partial(t, "data.pets.nested == true"))
+	if err == nil || !strings.Contains(err.Error(), "comparison does not refer to a field") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+type pet struct {
+	Name   string `json:"name"`
+	Owner  string `json:"owner"`
+	Kind   string `json:"kind"`
+	Age    int    `json:"age,omitempty"`
+	Public bool   `json:"public"`
+}
+
+func TestFilter(t *testing.T) {
+
+	result, err := (&Mapper{Unknown: "input.pets"}).MapResults(partial(t, "data.pets.allow == true"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr := result.(Expr)
+
+	pets := []pet{
+		{Name: "rex", Owner: "bob", Kind: "fish", Age: 12},
+		{Name: "fido", Owner: "alice", Kind: "dog", Age: 3, Public: true},
+		{Name: "tom", Owner: "alice", Kind: "cat", Age: 11, Public: true},
+		{Name: "kitty", Owner: "alice", Kind: "cat", Public: true},
+		{Name: "nemo", Owner: "alice", Kind: "fish", Public: true},
+	}
+
+	filtered, err := Filter(expr, pets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, p := range filtered.([]pet) {
+		names = append(names, p.Name)
+	}
+
+	// Note that kitty has no age, so "not input.pets.age > 10" is satisfied.
+	if exp := []string{"rex", "fido", "kitty"}; !reflect.DeepEqual(names, exp) {
+		t.Fatalf("expected %v but got %v", exp, names)
+	}
+
+	maps := []map[string]interface{}{
+		{"owner": "bob"},
+		{"owner": "alice", "kind": "dog", "public": true, "age": 10.0},
+		{"owner": "alice", "kind": "dog", "public": "yes"},
+	}
+
+	filtered, err = Filter(expr, maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := maps[:2]; !reflect.DeepEqual(filtered, exp) {
+		t.Fatalf("expected %v but got %v", exp, filtered)
+	}
+
+	if _, err := Filter(expr, pets[0]); err == nil {
+		t.Fatal("expected error for non-slice")
+	}
+}
+
+func TestMatchNested(t *testing.T) {
+
+	expr, err := Unmarshal([]byte(`{"op": "neq", "field": ["vet", "name"], "value": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		item interface{}
+		exp  bool
+	}{
+		{map[string]interface{}{"vet": map[string]interface{}{"name": "dr. who"}}, true},
+		{map[string]interface{}{"vet": map[string]interface{}{"name": nil}}, false},
+		{map[string]interface{}{"vet": "dr. who"}, false},
+		{map[string]interface{}{}, false},
+	}
+
+	for _, tc := range tests {
+		if ok, err := Match(expr, tc.item); err != nil {
+			t.Fatal(err)
+		} else if ok != tc.exp {
+			t.Errorf("expected %v for %v but got %v", tc.exp, tc.item, ok)
+		}
+	}
+}
+
+func TestMatchOperators(t *testing.T) {
+
+	item := map[string]interface{}{"name": "fido", "owner": "alice", "vet": "alice", "age": 3}
+
+	tests := []struct {
+		expr string
+		exp  bool
+	}{
+		{`{"op": "startswith", "field": ["name"], "value": "fi"}`, true},
+		{`{"op": "endswith", "field": ["name"], "value": "fi"}`, false},
+		{`{"op": "contains", "field": ["name"], "value": "id"}`, true},
+		{`{"op": "contains", "field": ["age"], "value": "3"}`, false},
+		{`{"op": "startswith", "field": ["missing"], "value": ""}`, false},
+		{`{"op": "eq", "field": ["owner"], "other": ["vet"]}`, true},
+		{`{"op": "neq", "field": ["owner"], "other": ["name"]}`, true},
+		{`{"op": "eq", "field": ["owner"], "other": ["missing"]}`, false},
+	}
+
+	for _, tc := range tests {
+		expr, err := Unmarshal([]byte(tc.expr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := Match(expr, item); err != nil {
+			t.Fatal(err)
+		} else if ok != tc.exp {
+			t.Errorf("expected %v for %v but got %v", tc.exp, tc.expr, ok)
+		}
+		bs, err := json.Marshal(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp, actual := util.MustUnmarshalJSON([]byte(tc.expr)), util.MustUnmarshalJSON(bs); !reflect.DeepEqual(exp, actual) {
+			t.Errorf("expected %v but got %v", exp, actual)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+
+	tests := map[string]string{
+		`{"op": "xor"}`:            `filter: unknown operator "xor"`,
+		`{"op": "not"}`:            "filter: not expression requires an argument",
+		`{"op": "eq", "value": 1}`: "filter: eq expression requires a field",
+		`{"op": "in"}`:             "filter: in expression requires a field",
+		`{"op": "contains"}`:       "filter: contains expression requires a field",
+		`{"op": "startswith", "field": ["name"], "value": 1}`: "filter: startswith expression requires a string value",
+	}
+
+	for input, exp := range tests {
+		if _, err := Unmarshal([]byte(input)); err == nil || err.Error() != exp {
+			t.Errorf("expected %q for %v but got: %v", exp, input, err)
+		}
+	}
+}
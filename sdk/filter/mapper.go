@@ -0,0 +1,43 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// Mapper converts partial evaluation results into filter expressions. It
+// implements the SDK's PartialQueryMapper interface. Field paths are relative
+// to the unknown and fields cannot be compared with other fields. See the
+// Converter for the supported expressions.
+type Mapper struct {
+	Unknown string // specifies the unknown that field paths are relative to, e.g., input.pets
+}
+
+// MapResults converts pq into an Expr. If pq cannot be converted, the
+// returned ast.Errors contain every unsupported construct.
+func (m *Mapper) MapResults(pq *rego.PartialQueries) (interface{}, error) {
+
+	unknown, err := ast.ParseRef(m.Unknown)
+	if err != nil {
+		return nil, fmt.Errorf("filter: invalid unknown: %w", err)
+	}
+
+	c := &Converter{Field: FieldsOf(unknown)}
+
+	return c.Convert(pq)
+}
+
+// ResultToJSON returns the JSON representation of an Expr.
+func (m *Mapper) ResultToJSON(result interface{}) (interface{}, error) {
+	expr, ok := result.(Expr)
+	if !ok {
+		return nil, fmt.Errorf("filter: unexpected result type %T", result)
+	}
+	return ToJSON(expr)
+}
@@ -0,0 +1,283 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+)
+
+// Context holds the state of a single evaluation. The generated code uses it
+// to call built-in functions and dynamically called rules, to memoize rule
+// results and to collect the result set.
+type Context struct {
+	policy  *Policy
+	bctx    topdown.BuiltinContext
+	strict  bool
+	done    chan struct{}
+	memo    []map[int]ast.Value
+	results ast.Set
+}
+
+// abort is raised (as a panic) to stop the evaluation with an error, e.g.,
+// on conflicts or when a built-in function halts.
+type abort struct {
+	err error
+}
+
+func newContext(ctx context.Context, p *Policy, opts EvalOpts) *Context {
+
+	ns := opts.Time
+	if ns.IsZero() {
+		ns = time.Now()
+	}
+
+	seed := opts.Seed
+	if seed == nil {
+		seed = rand.Reader
+	}
+
+	m := opts.Metrics
+	if m == nil {
+		m = metrics.New()
+	}
+
+	c := &Context{
+		policy: p,
+		bctx: topdown.BuiltinContext{
+			Context:                ctx,
+			Metrics:                m,
+			Seed:                   seed,
+			Time:                   ast.NumberTerm(json.Number(strconv.FormatInt(ns.UnixNano(), 10))),
+			Cancel:                 topdown.NewCancel(),
+			Cache:                  make(builtins.Cache),
+			InterQueryBuiltinCache: opts.InterQueryBuiltinCache,
+			NDBuiltinCache:         opts.NDBuiltinCache,
+			PrintHook:              opts.PrintHook,
+			Capabilities:           opts.Capabilities,
+		},
+		strict:  opts.StrictBuiltinErrors,
+		done:    make(chan struct{}),
+		memo:    []map[int]ast.Value{{}},
+		results: ast.NewSet(),
+	}
+
+	// Bridge ctx <-> topdown.Cancel, so that long-running built-in functions
+	// are aborted when the evaluation is cancelled.
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				c.bctx.Cancel.Cancel()
+			}
+		}()
+	}
+
+	return c
+}
+
+func (c *Context) close() {
+	close(c.done)
+}
+
+func (c *Context) eval(plan PlanFunc, input, data ast.Value) (result ast.Set, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			a, ok := r.(abort)
+			if !ok {
+				panic(r)
+			}
+			result, err = nil, a.err
+		}
+	}()
+
+	plan(c, input, data)
+
+	return c.results, nil
+}
+
+// Result adds a value to the result set.
+func (c *Context) Result(v ast.Value) {
+	c.results.Add(ast.NewTerm(v))
+}
+
+// Call calls the built-in function with the given index in the list of
+// built-in functions of the policy. It returns nil if the result is
+// undefined; the result of a relation is the array of its outputs. Errors
+// halt the evaluation if the built-in function halts or strict built-in
+// errors are enabled; otherwise the result is undefined.
+func (c *Context) Call(index int, args ...ast.Value) ast.Value {
+
+	c.checkCancel()
+
+	operands := make([]*ast.Term, len(args))
+	for i := range args {
+		operands[i] = ast.NewTerm(args[i])
+	}
+
+	var output *ast.Term
+	var outputs []*ast.Term
+
+	// The outputs of relations are collected into an array, the plan scans
+	// the array.
+	relation := c.policy.relations[index]
+
+	err := c.policy.impls[index](c.bctx, operands, func(t *ast.Term) error {
+		if relation {
+			outputs = append(outputs, t)
+		} else {
+			output = t
+		}
+		return nil
+	})
+	if err != nil {
+		var halt topdown.Halt
+		if errors.As(err, &halt) {
+			panic(abort{err: halt.Err})
+		}
+		if c.strict {
+			panic(abort{err: err})
+		}
+		return nil
+	}
+
+	if relation {
+		return ast.NewArray(outputs...)
+	}
+
+	if output == nil {
+		return nil
+	}
+
+	return output.Value
+}
+
+// Lookup returns the rule producing the document at path, or nil if path
+// does not refer to a compiled rule.
+func (c *Context) Lookup(path ...ast.Value) Func {
+	return c.policy.mapping.lookup(path)
+}
+
+// Memo returns the memoized result of the rule with the given index.
+func (c *Context) Memo(index int) (ast.Value, bool) {
+	v, ok := c.memo[len(c.memo)-1][index]
+	return v, ok
+}
+
+// Memoize memoizes and returns the result of the rule with the given index.
+func (c *Context) Memoize(index int, v ast.Value) ast.Value {
+	c.memo[len(c.memo)-1][index] = v
+	return v
+}
+
+// PushMemo starts a new memoization scope, e.g., when the input or data is
+// replaced by a with statement.
+func (c *Context) PushMemo() {
+	c.memo = append(c.memo, map[int]ast.Value{})
+}
+
+// PopMemo ends the current memoization scope.
+func (c *Context) PopMemo() {
+	c.memo = c.memo[:len(c.memo)-1]
+}
+
+// Conflict halts the evaluation with a conflict error raised by the
+// statement at the given location.
+func (c *Context) Conflict(msg string, file string, row, col int) {
+	panic(abort{err: &topdown.Error{
+		Code:     topdown.ConflictErr,
+		Message:  msg,
+		Location: ast.NewLocation(nil, file, row, col),
+	}})
+}
+
+// Iter returns an iterator over the keys and values of a collection. Scalar
+// values have no keys.
+func (c *Context) Iter(v ast.Value) Iterator {
+	c.checkCancel()
+
+	it := Iterator{c: c}
+
+	switch v := v.(type) {
+	case *ast.Array:
+		it.arr = v
+		it.n = v.Len()
+	case ast.Object:
+		it.obj = v
+		it.keys = v.Keys()
+		it.n = len(it.keys)
+	case ast.Set:
+		it.keys = v.Slice()
+		it.n = len(it.keys)
+	}
+
+	return it
+}
+
+func (c *Context) checkCancel() {
+	select {
+	case <-c.bctx.Context.Done():
+		panic(abort{err: &topdown.Error{
+			Code:    topdown.CancelErr,
+			Message: "caller cancelled query execution",
+		}})
+	default:
+	}
+}
+
+// Iterator iterates over the keys and values of a collection.
+type Iterator struct {
+	c          *Context
+	arr        *ast.Array
+	obj        ast.Object
+	keys       []*ast.Term
+	n, i       int
+	key, value ast.Value
+}
+
+// Next advances the iterator. It returns false when there are no more
+// elements.
+func (it *Iterator) Next() bool {
+	if it.i >= it.n {
+		return false
+	}
+
+	it.c.checkCancel()
+
+	switch {
+	case it.arr != nil:
+		it.key = ast.IntNumberTerm(it.i).Value
+		it.value = it.arr.Elem(it.i).Value
+	case it.obj != nil:
+		it.key = it.keys[it.i].Value
+		it.value = it.obj.Get(it.keys[it.i]).Value
+	default:
+		it.key = it.keys[it.i].Value
+		it.value = it.key
+	}
+
+	it.i++
+	return true
+}
+
+// Key returns the key of the current element.
+func (it *Iterator) Key() ast.Value {
+	return it.key
+}
+
+// Value returns the value of the current element.
+func (it *Iterator) Value() ast.Value {
+	return it.value
+}
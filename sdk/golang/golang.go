@@ -0,0 +1,223 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package golang evaluates Rego policies compiled to Go source code, see
+// compile.TargetGo. The generated packages call into this package to look up
+// values, call built-in functions and collect results; applications use it to
+// configure and evaluate the compiled policy.
+package golang
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/open-policy-agent/opa/topdown/cache"
+	"github.com/open-policy-agent/opa/topdown/print"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// PlanFunc evaluates an entrypoint of a compiled policy. Results are added
+// to the context.
+type PlanFunc func(c *Context, input, data ast.Value)
+
+// Func is a compiled rule that can be called dynamically. It returns nil if
+// the rule is undefined.
+type Func func(c *Context, input, data ast.Value) ast.Value
+
+// Entrypoint is a named plan of a compiled policy.
+type Entrypoint struct {
+	Name string
+	Eval PlanFunc
+}
+
+// MappedFunc is a compiled rule and the path of the document it produces.
+type MappedFunc struct {
+	Path []string
+	Func Func
+}
+
+// Compiled holds the generated parts of a compiled policy.
+type Compiled struct {
+	Entrypoints []Entrypoint
+	Funcs       []MappedFunc
+	Builtins    []string
+	Data        string // JSON serialized base document, optional.
+}
+
+// Builtin is the Go implementation of a built-in function called by the
+// policy. It returns nil if the result of the call is undefined.
+type Builtin func(bctx topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error)
+
+// EvalOpts contains the parameters for an evaluation.
+type EvalOpts struct {
+	Entrypoint             string // Defaults to the first entrypoint.
+	Input                  *interface{}
+	Metrics                metrics.Metrics
+	Time                   time.Time
+	Seed                   io.Reader
+	InterQueryBuiltinCache cache.InterQueryCache
+	NDBuiltinCache         builtins.NDBCache
+	PrintHook              print.Hook
+	Capabilities           *ast.Capabilities
+	StrictBuiltinErrors    bool
+}
+
+// Policy is a compiled policy. Once configured, it is safe for concurrent
+// use.
+type Policy struct {
+	entrypoints []Entrypoint
+	mapping     *mapping
+	builtins    []string
+	impls       []topdown.BuiltinFunc
+	relations   []bool
+	mutex       sync.RWMutex // To serialize access to the data.
+	data        ast.Value
+}
+
+// NewPolicy returns the policy for the generated code. It is called by the
+// New function of the generated package.
+func NewPolicy(compiled Compiled) *Policy {
+	p := &Policy{
+		entrypoints: compiled.Entrypoints,
+		mapping:     newMapping(compiled.Funcs),
+		builtins:    compiled.Builtins,
+		impls:       make([]topdown.BuiltinFunc, len(compiled.Builtins)),
+		relations:   make([]bool, len(compiled.Builtins)),
+		data:        ast.NewObject(),
+	}
+
+	for i, name := range compiled.Builtins {
+		p.impls[i] = topdown.GetBuiltin(name)
+		if bi, ok := ast.BuiltinMap[name]; ok {
+			p.relations[i] = bi.Relation
+		}
+	}
+
+	if compiled.Data != "" {
+		v, err := ast.ValueFromReader(strings.NewReader(compiled.Data))
+		if err != nil {
+			panic(fmt.Sprintf("illegal compiled data: %v", err))
+		}
+		p.data = v
+	}
+
+	return p
+}
+
+// WithBuiltin sets the implementation of a built-in function called by the
+// policy, replacing the implementation registered with topdown, if any. It
+// must be called before the policy is evaluated.
+func (p *Policy) WithBuiltin(name string, builtin Builtin) *Policy {
+	for i := range p.builtins {
+		if p.builtins[i] == name {
+			p.impls[i] = func(bctx topdown.BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error {
+				result, err := builtin(bctx, operands)
+				if err != nil {
+					return err
+				}
+				if result == nil {
+					return nil
+				}
+				return iter(result)
+			}
+		}
+	}
+	return p
+}
+
+// SetData replaces the base document for the subsequent Eval calls. The
+// evaluations in flight complete with the previous data.
+func (p *Policy) SetData(v interface{}) error {
+	data, err := toValue(v)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.data = data
+	return nil
+}
+
+// Entrypoints returns the names of the entrypoints of the policy.
+func (p *Policy) Entrypoints() []string {
+	names := make([]string, len(p.entrypoints))
+	for i := range p.entrypoints {
+		names[i] = p.entrypoints[i].Name
+	}
+	return names
+}
+
+// Eval evaluates an entrypoint of the policy with the given input. It
+// returns the result set: one object binding the variables of the
+// entrypoint query per result.
+func (p *Policy) Eval(ctx context.Context, opts EvalOpts) (ast.Set, error) {
+
+	plan, err := p.entrypoint(opts.Entrypoint)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range p.impls {
+		if p.impls[i] == nil {
+			return nil, fmt.Errorf("missing built-in function: %v", p.builtins[i])
+		}
+	}
+
+	var input ast.Value
+
+	if opts.Input != nil {
+		input, err = toValue(*opts.Input)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.mutex.RLock()
+	data := p.data
+	p.mutex.RUnlock()
+
+	c := newContext(ctx, p, opts)
+	defer c.close()
+
+	return c.eval(plan, input, data)
+}
+
+func (p *Policy) entrypoint(name string) (PlanFunc, error) {
+	if name == "" && len(p.entrypoints) > 0 {
+		return p.entrypoints[0].Eval, nil
+	}
+
+	for i := range p.entrypoints {
+		if p.entrypoints[i].Name == name {
+			return p.entrypoints[i].Eval, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown entrypoint: %q", name)
+}
+
+func toValue(x interface{}) (ast.Value, error) {
+	switch x := x.(type) {
+	case ast.Value:
+		return x, nil
+	case *ast.Term:
+		return x.Value, nil
+	}
+
+	if err := util.RoundTrip(&x); err != nil {
+		return nil, err
+	}
+
+	return ast.InterfaceToValue(x)
+}
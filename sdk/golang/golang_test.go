@@ -0,0 +1,298 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/topdown"
+)
+
+// The plans below are written the way the go target generates them.
+
+// allow: input.user == data.admin
+func allow(c *Context, input, data ast.Value) {
+	var l [4]ast.Value
+	l[0], l[1] = input, data
+	if l[2] = Dot(l[0], ast.String("user")); l[2] == nil {
+		goto L0
+	}
+	if l[3] = Dot(l[1], ast.String("admin")); l[3] == nil {
+		goto L0
+	}
+	if !Equal(l[2], l[3]) {
+		goto L0
+	}
+	c.Result(ast.NewObject(ast.Item(ast.StringTerm("x"), ast.BooleanTerm(true))))
+L0:
+}
+
+// upper: x := upper(input.s)
+func upper(c *Context, input, data ast.Value) {
+	var l [4]ast.Value
+	l[0], l[1] = input, data
+	if l[2] = Dot(l[0], ast.String("s")); l[2] == nil {
+		goto L0
+	}
+	if l[3] = c.Call(0, l[2]); l[3] == nil {
+		goto L0
+	}
+	c.Result(ast.NewObject(ast.Item(ast.StringTerm("x"), ast.NewTerm(l[3]))))
+L0:
+}
+
+// conflict: x := input.xs[_] with complete rule semantics.
+func conflict(c *Context, input, data ast.Value) {
+	var l [6]ast.Value
+	l[0], l[1] = input, data
+	if l[2] = Dot(l[0], ast.String("xs")); l[2] == nil {
+		goto L0
+	}
+	for it := c.Iter(l[2]); it.Next(); {
+		l[3], l[4] = it.Key(), it.Value()
+		if l[5] != nil && !Equal(l[5], l[4]) {
+			c.Conflict("var assignment conflict", "test.rego", 3, 1)
+		}
+		l[5] = l[4]
+	}
+	c.Result(ast.NewObject(ast.Item(ast.StringTerm("x"), ast.NewTerm(l[5]))))
+L0:
+}
+
+// dynamic: x := data.test[input.rule]
+func dynamic(c *Context, input, data ast.Value) {
+	var l [4]ast.Value
+	l[0], l[1] = input, data
+	if l[2] = Dot(l[0], ast.String("rule")); l[2] == nil {
+		goto L0
+	}
+	if fn := c.Lookup(ast.String("test"), l[2]); fn == nil {
+		goto L0
+	} else if l[3] = fn(c, l[0], l[1]); l[3] == nil {
+		goto L0
+	}
+	c.Result(ast.NewObject(ast.Item(ast.StringTerm("x"), ast.NewTerm(l[3]))))
+L0:
+}
+
+var calls int
+
+func memoized(c *Context, input, data ast.Value) ast.Value {
+	if v, ok := c.Memo(0); ok {
+		return v
+	}
+	calls++
+	return c.Memoize(0, ast.String("p"))
+}
+
+func newTestPolicy() *Policy {
+	return NewPolicy(Compiled{
+		Entrypoints: []Entrypoint{
+			{Name: "test/allow", Eval: allow},
+			{Name: "test/upper", Eval: upper},
+			{Name: "test/conflict", Eval: conflict},
+			{Name: "test/dynamic", Eval: dynamic},
+		},
+		Funcs: []MappedFunc{
+			{Path: []string{"test", "p"}, Func: memoized},
+		},
+		Builtins: []string{"upper"},
+		Data:     `{"admin": "alice"}`,
+	})
+}
+
+func eval(t *testing.T, p *Policy, entrypoint string, input interface{}) ast.Set {
+	t.Helper()
+	rs, err := p.Eval(context.Background(), EvalOpts{Entrypoint: entrypoint, Input: &input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func assertResult(t *testing.T, exp string, rs ast.Set) {
+	t.Helper()
+	if exp := ast.MustParseTerm(exp).Value; exp.Compare(rs) != 0 {
+		t.Fatalf("expected %v but got %v", exp, rs)
+	}
+}
+
+func TestPolicyEntrypoints(t *testing.T) {
+	exp := fmt.Sprint([]string{"test/allow", "test/upper", "test/conflict", "test/dynamic"})
+	if got := fmt.Sprint(newTestPolicy().Entrypoints()); got != exp {
+		t.Fatalf("expected %v but got %v", exp, got)
+	}
+}
+
+func TestPolicyEval(t *testing.T) {
+	p := newTestPolicy()
+
+	assertResult(t, `{{"x": true}}`, eval(t, p, "", map[string]interface{}{"user": "alice"}))
+	assertResult(t, `set()`, eval(t, p, "test/allow", map[string]interface{}{"user": "bob"}))
+	assertResult(t, `{{"x": "FOO"}}`, eval(t, p, "test/upper", map[string]interface{}{"s": "foo"}))
+	assertResult(t, `{{"x": 1}}`, eval(t, p, "test/conflict", map[string]interface{}{"xs": []int{1, 1}}))
+
+	// Values are accepted as input too.
+	assertResult(t, `{{"x": "FOO"}}`, eval(t, p, "test/upper", ast.MustParseTerm(`{"s": "foo"}`)))
+}
+
+func TestPolicyEvalNoInput(t *testing.T) {
+	rs, err := newTestPolicy().Eval(context.Background(), EvalOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertResult(t, `set()`, rs)
+}
+
+func TestPolicyEvalUnknownEntrypoint(t *testing.T) {
+	_, err := newTestPolicy().Eval(context.Background(), EvalOpts{Entrypoint: "test/missing"})
+	if err == nil || err.Error() != `unknown entrypoint: "test/missing"` {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestPolicyEvalConflict(t *testing.T) {
+	var input interface{} = map[string]interface{}{"xs": []int{1, 2}}
+	_, err := newTestPolicy().Eval(context.Background(), EvalOpts{Entrypoint: "test/conflict", Input: &input})
+
+	var topdownErr *topdown.Error
+	if !errors.As(err, &topdownErr) || topdownErr.Code != topdown.ConflictErr {
+		t.Fatal("expected conflict error but got:", err)
+	}
+
+	if exp := "test.rego:3: eval_conflict_error: var assignment conflict"; err.Error() != exp {
+		t.Fatalf("expected %q but got %q", exp, err.Error())
+	}
+}
+
+func TestPolicyEvalCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var input interface{} = map[string]interface{}{"xs": []int{1}}
+	_, err := newTestPolicy().Eval(ctx, EvalOpts{Entrypoint: "test/conflict", Input: &input})
+
+	var topdownErr *topdown.Error
+	if !errors.As(err, &topdownErr) || topdownErr.Code != topdown.CancelErr {
+		t.Fatal("expected cancel error but got:", err)
+	}
+}
+
+func TestPolicyEvalDynamic(t *testing.T) {
+	calls = 0
+	p := newTestPolicy()
+
+	assertResult(t, `{{"x": "p"}}`, eval(t, p, "test/dynamic", map[string]interface{}{"rule": "p"}))
+	assertResult(t, `set()`, eval(t, p, "test/dynamic", map[string]interface{}{"rule": "q"}))
+	assertResult(t, `set()`, eval(t, p, "test/dynamic", map[string]interface{}{"rule": 1}))
+
+	if calls != 1 {
+		t.Fatalf("expected 1 call but got %d", calls)
+	}
+}
+
+func TestContextMemo(t *testing.T) {
+	c := &Context{memo: []map[int]ast.Value{{}}}
+
+	if _, ok := c.Memo(0); ok {
+		t.Fatal("expected no memoized value")
+	}
+
+	c.Memoize(0, ast.String("a"))
+	c.PushMemo()
+
+	if _, ok := c.Memo(0); ok {
+		t.Fatal("expected no memoized value in new scope")
+	}
+
+	c.Memoize(0, ast.String("b"))
+	c.PopMemo()
+
+	if v, ok := c.Memo(0); !ok || !Equal(v, ast.String("a")) {
+		t.Fatalf("expected memoized value %v but got %v", ast.String("a"), v)
+	}
+}
+
+func TestPolicySetData(t *testing.T) {
+	p := newTestPolicy()
+
+	if err := p.SetData(map[string]interface{}{"admin": "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertResult(t, `set()`, eval(t, p, "", map[string]interface{}{"user": "alice"}))
+	assertResult(t, `{{"x": true}}`, eval(t, p, "", map[string]interface{}{"user": "bob"}))
+}
+
+func TestPolicyWithBuiltin(t *testing.T) {
+	p := newTestPolicy().WithBuiltin("upper", func(_ topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error) {
+		if operands[0].Value.Compare(ast.String("halt")) == 0 {
+			return nil, topdown.Halt{Err: fmt.Errorf("halted")}
+		}
+		if operands[0].Value.Compare(ast.String("fail")) == 0 {
+			return nil, fmt.Errorf("failed")
+		}
+		if operands[0].Value.Compare(ast.String("undefined")) == 0 {
+			return nil, nil
+		}
+		return ast.StringTerm("custom"), nil
+	})
+
+	assertResult(t, `{{"x": "custom"}}`, eval(t, p, "test/upper", map[string]interface{}{"s": "foo"}))
+	assertResult(t, `set()`, eval(t, p, "test/upper", map[string]interface{}{"s": "undefined"}))
+	assertResult(t, `set()`, eval(t, p, "test/upper", map[string]interface{}{"s": "fail"}))
+
+	var input interface{} = map[string]interface{}{"s": "fail"}
+	_, err := p.Eval(context.Background(), EvalOpts{Entrypoint: "test/upper", Input: &input, StrictBuiltinErrors: true})
+	if err == nil || err.Error() != "failed" {
+		t.Fatal("expected built-in error but got:", err)
+	}
+
+	input = map[string]interface{}{"s": "halt"}
+	_, err = p.Eval(context.Background(), EvalOpts{Entrypoint: "test/upper", Input: &input})
+	if err == nil || err.Error() != "halted" {
+		t.Fatal("expected halt error but got:", err)
+	}
+}
+
+func TestPolicyMissingBuiltin(t *testing.T) {
+	p := NewPolicy(Compiled{
+		Entrypoints: []Entrypoint{{Name: "test", Eval: allow}},
+		Builtins:    []string{"custom.builtin"},
+	})
+
+	_, err := p.Eval(context.Background(), EvalOpts{})
+	if err == nil || err.Error() != "missing built-in function: custom.builtin" {
+		t.Fatal("unexpected error:", err)
+	}
+
+	p.WithBuiltin("custom.builtin", func(topdown.BuiltinContext, []*ast.Term) (*ast.Term, error) {
+		return nil, nil
+	})
+
+	if _, err := p.Eval(context.Background(), EvalOpts{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextCallRelation(t *testing.T) {
+	p := NewPolicy(Compiled{
+		Entrypoints: []Entrypoint{{Name: "test", Eval: func(c *Context, input, data ast.Value) {
+			c.Result(c.Call(0, ast.MustParseTerm(`{"a": 1}`).Value))
+		}}},
+		Builtins: []string{"walk"},
+	})
+
+	rs, err := p.Eval(context.Background(), EvalOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertResult(t, `{[[[], {"a": 1}], [["a"], 1]]}`, rs)
+}
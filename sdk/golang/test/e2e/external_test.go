@@ -0,0 +1,486 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+//go:build golang_sdk_e2e
+// +build golang_sdk_e2e
+
+// Package e2e contains the conformance tests of the go target. The test
+// cases are planned, compiled into Go packages and evaluated by a generated
+// program. The results are checked against the expectations of the test
+// cases and against topdown.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/internal/compiler/golang"
+	"github.com/open-policy-agent/opa/ir"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/test/cases"
+	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/types"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const opaRootDir = "../../../../"
+
+// pkgPath is the import path of this package. The generated packages are
+// imported relative to it.
+const pkgPath = "github.com/open-policy-agent/opa/sdk/golang/test/e2e"
+
+const target = "go-e2e"
+
+var caseDir = flag.String("case-dir", filepath.Join(opaRootDir, "test/cases/testdata"), "set directory to load test cases from")
+var exceptionsFile = flag.String("exceptions", "./exceptions.yaml", "set file to load a list of test names to exclude")
+var keep = flag.Bool("keep", false, "keep the generated code")
+
+var exceptions map[string]string
+
+var capture = &planCapture{}
+
+func TestMain(m *testing.M) {
+	exceptions = map[string]string{}
+
+	bs, err := os.ReadFile(*exceptionsFile)
+	if err != nil {
+		fmt.Println("Unable to load exceptions file: " + err.Error())
+		os.Exit(1)
+	}
+	err = util.Unmarshal(bs, &exceptions)
+	if err != nil {
+		fmt.Println("Unable to parse exceptions file: " + err.Error())
+		os.Exit(1)
+	}
+
+	addTestSleepBuiltin()
+	rego.RegisterPlugin(target, capture)
+
+	os.Exit(m.Run())
+}
+
+// compiled is a test case and the package generated for it.
+type compiled struct {
+	tc  cases.TestCase
+	pkg string
+	err error
+}
+
+// outcome is the outcome of the evaluation of a test case by the generated
+// code.
+type outcome struct {
+	Result string `json:"result,omitempty"` // result set in Rego syntax
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+func TestGolangE2E(t *testing.T) {
+
+	ctx := context.Background()
+
+	if err := os.MkdirAll("testdata", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := os.MkdirTemp("testdata", "gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *keep {
+		t.Logf("Keeping generated code in %v", dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+
+	var all, generated []*compiled
+
+	for i, tc := range cases.MustLoad(*caseDir).Sorted().Cases {
+		c := &compiled{tc: tc, pkg: fmt.Sprintf("c%d", i)}
+		all = append(all, c)
+		if _, ok := exceptions[tc.Note]; ok {
+			continue
+		}
+		if c.err = generate(ctx, tc, filepath.Join(dir, c.pkg)); c.err == nil {
+			generated = append(generated, c)
+		}
+	}
+
+	outcomes, err := run(dir, generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range all {
+		c := c
+		name := fmt.Sprintf("%s/%s", strings.TrimPrefix(c.tc.Filename, opaRootDir), c.tc.Note)
+		t.Run(name, func(t *testing.T) {
+
+			if reason, ok := exceptions[c.tc.Note]; ok {
+				t.Log("Skipping test case: " + reason)
+				t.SkipNow()
+			}
+
+			if c.err != nil {
+				t.Fatal(c.err)
+			}
+
+			o, ok := outcomes[c.pkg]
+			if !ok {
+				t.Fatal("missing outcome")
+			}
+
+			assert(t, c.tc, o)
+			assertTopdown(ctx, t, c.tc, o)
+		})
+	}
+}
+
+// planCapture is a rego target plugin that captures the plan of the query
+// prepared last.
+type planCapture struct {
+	policy *ir.Policy
+}
+
+func (*planCapture) IsTarget(t string) bool {
+	return t == target
+}
+
+func (p *planCapture) PrepareForEval(_ context.Context, policy *ir.Policy, _ ...rego.PrepareOption) (rego.TargetPluginEval, error) {
+	p.policy = policy
+	return p, nil
+}
+
+func (*planCapture) Eval(context.Context, *rego.EvalContext, ast.Value) (ast.Value, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+// generate writes the package compiled from the test case to dir.
+func generate(ctx context.Context, tc cases.TestCase, dir string) error {
+
+	opts := []func(*rego.Rego){
+		rego.Query(tc.Query),
+		rego.Target(target),
+	}
+	for i := range tc.Modules {
+		opts = append(opts, rego.Module(fmt.Sprintf("module-%d.rego", i), tc.Modules[i]))
+	}
+
+	if _, err := rego.New(opts...).PrepareForEval(ctx); err != nil {
+		return err
+	}
+
+	var data []byte
+	if tc.Data != nil {
+		var err error
+		if data, err = json.Marshal(tc.Data); err != nil {
+			return err
+		}
+	}
+
+	src, err := golang.New().WithPolicy(capture.policy).WithData(data).Compile()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, "policy.go"), src, 0o644)
+}
+
+var mainTmpl = template.Must(template.New("main").Parse(`package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/sdk/golang"
+	"github.com/open-policy-agent/opa/topdown"
+{{range .}}
+	{{.Pkg}} "{{.Path}}"
+{{- end}}
+)
+
+type outcome struct {
+	Result string ` + "`json:\"result,omitempty\"`" + `
+	Error  string ` + "`json:\"error,omitempty\"`" + `
+	Code   string ` + "`json:\"code,omitempty\"`" + `
+}
+
+func sleep(_ topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error) {
+	d, _ := time.ParseDuration(string(operands[0].Value.(ast.String)))
+	time.Sleep(d)
+	return ast.NullTerm(), nil
+}
+
+func eval(p *golang.Policy, input string, strict bool) outcome {
+	opts := golang.EvalOpts{StrictBuiltinErrors: strict}
+	if input != "" {
+		var x interface{} = ast.MustParseTerm(input)
+		opts.Input = &x
+	}
+	rs, err := p.WithBuiltin("test.sleep", sleep).Eval(context.Background(), opts)
+	if err != nil {
+		o := outcome{Error: err.Error()}
+		var topdownErr *topdown.Error
+		if errors.As(err, &topdownErr) {
+			o.Code = topdownErr.Code
+		}
+		return o
+	}
+	return outcome{Result: rs.String()}
+}
+
+func main() {
+	outcomes := map[string]outcome{}
+{{range .}}
+	outcomes[{{printf "%q" .Pkg}}] = eval({{.Pkg}}.New(), {{printf "%q" .Input}}, {{.Strict}})
+{{- end}}
+	if err := json.NewEncoder(os.Stdout).Encode(outcomes); err != nil {
+		panic(err)
+	}
+}
+`))
+
+// run builds and runs a program that evaluates the generated packages in dir.
+func run(dir string, generated []*compiled) (map[string]outcome, error) {
+
+	type entry struct {
+		Pkg    string
+		Path   string
+		Input  string
+		Strict bool
+	}
+
+	var entries []entry
+
+	for _, c := range generated {
+		e := entry{
+			Pkg:    c.pkg,
+			Path:   pkgPath + "/" + filepath.ToSlash(filepath.Join(dir, c.pkg)),
+			Strict: c.tc.StrictError,
+		}
+		if c.tc.InputTerm != nil {
+			e.Input = *c.tc.InputTerm
+		} else if c.tc.Input != nil {
+			bs, err := json.Marshal(*c.tc.Input)
+			if err != nil {
+				return nil, err
+			}
+			e.Input = string(bs)
+		}
+		entries = append(entries, e)
+	}
+
+	f, err := os.Create(filepath.Join(dir, "main.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	err = mainTmpl.Execute(f, entries)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("go", "run", "./"+filepath.ToSlash(dir))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, stderr.String())
+	}
+
+	var outcomes map[string]outcome
+	if err := util.UnmarshalJSON(stdout.Bytes(), &outcomes); err != nil {
+		return nil, err
+	}
+
+	return outcomes, nil
+}
+
+func assert(t *testing.T, tc cases.TestCase, o outcome) {
+	t.Helper()
+	switch {
+	case tc.WantErrorCode != nil || tc.WantError != nil:
+		if o.Error == "" {
+			t.Fatalf("expected error, got result %v", o.Result)
+		}
+		if tc.WantErrorCode != nil && *tc.WantErrorCode != o.Code {
+			t.Fatalf("expected error code %q but got %q (%v)", *tc.WantErrorCode, o.Code, o.Error)
+		}
+	case tc.WantDefined != nil:
+		if o.Error != "" {
+			t.Fatalf("unexpected error: %v", o.Error)
+		}
+		got := parseResultSet(t, o).Len() > 0
+		if got != *tc.WantDefined {
+			t.Fatalf("expected defined to be %v but got %v", *tc.WantDefined, got)
+		}
+	case tc.WantResult != nil:
+		if o.Error != "" {
+			t.Fatalf("unexpected error: %v", o.Error)
+		}
+		assertResultSet(t, *tc.WantResult, tc.SortBindings, o)
+	}
+}
+
+// assertTopdown checks that the outcome matches the evaluation of the test
+// case by topdown.
+func assertTopdown(ctx context.Context, t *testing.T, tc cases.TestCase, o outcome) {
+	t.Helper()
+
+	modules := map[string]string{}
+	for i, module := range tc.Modules {
+		modules[fmt.Sprintf("module-%d.rego", i)] = module
+	}
+
+	compiler := ast.MustCompileModules(modules)
+	query, err := compiler.QueryCompiler().Compile(ast.MustParseBody(tc.Query))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var store storage.Store
+
+	if tc.Data != nil {
+		store = inmem.NewFromObject(*tc.Data)
+	} else {
+		store = inmem.New()
+	}
+
+	txn := storage.NewTransactionOrDie(ctx, store)
+	defer store.Abort(ctx, txn)
+
+	var input *ast.Term
+
+	if tc.InputTerm != nil {
+		input = ast.MustParseTerm(*tc.InputTerm)
+	} else if tc.Input != nil {
+		input = ast.NewTerm(ast.MustInterfaceToValue(*tc.Input))
+	}
+
+	qrs, err := topdown.NewQuery(query).
+		WithCompiler(compiler).
+		WithStore(store).
+		WithTransaction(txn).
+		WithInput(input).
+		WithStrictBuiltinErrors(tc.StrictError).
+		Run(ctx)
+	if err != nil {
+		if o.Error == "" {
+			t.Fatalf("expected error %v as in topdown, got result %v", err, o.Result)
+		}
+		return
+	}
+
+	if o.Error != "" {
+		t.Fatalf("expected result as in topdown, got error %v", o.Error)
+	}
+
+	exp := ast.NewSet()
+	for _, qr := range qrs {
+		obj := ast.NewObject()
+		for k, v := range qr {
+			if !k.IsWildcard() && !k.IsGenerated() {
+				obj.Insert(ast.StringTerm(string(k)), ast.NewTerm(normalize(v.Value, tc.SortBindings)))
+			}
+		}
+		exp.Add(ast.NewTerm(obj))
+	}
+
+	if got := normalizeResultSet(parseResultSet(t, o), tc.SortBindings); exp.Compare(got) != 0 {
+		t.Fatalf("expected %v as in topdown but got %v", exp, got)
+	}
+}
+
+func assertResultSet(t *testing.T, want []map[string]interface{}, sortBindings bool, o outcome) {
+	t.Helper()
+
+	exp := ast.NewSet()
+	for _, b := range want {
+		obj := ast.NewObject()
+		for k, v := range b {
+			obj.Insert(ast.StringTerm(k), ast.NewTerm(ast.MustInterfaceToValue(v)))
+		}
+		exp.Add(ast.NewTerm(obj))
+	}
+
+	if got := normalizeResultSet(parseResultSet(t, o), sortBindings); exp.Compare(got) != 0 {
+		t.Fatalf("expected %v but got %v", exp, got)
+	}
+}
+
+func parseResultSet(t *testing.T, o outcome) ast.Set {
+	t.Helper()
+	term, err := ast.ParseTerm(o.Result)
+	if err != nil {
+		t.Fatalf("illegal result set %q: %v", o.Result, err)
+	}
+	rs, ok := term.Value.(ast.Set)
+	if !ok {
+		t.Fatalf("illegal result set %v", o.Result)
+	}
+	return rs
+}
+
+// normalizeResultSet round trips the bindings of the result set through
+// JSON, so that they can be compared with the expected results.
+func normalizeResultSet(rs ast.Set, sortBindings bool) ast.Set {
+	result := ast.NewSet()
+	rs.Foreach(func(x *ast.Term) {
+		obj := ast.NewObject()
+		x.Value.(ast.Object).Foreach(func(k, v *ast.Term) {
+			obj.Insert(k, ast.NewTerm(normalize(v.Value, sortBindings)))
+		})
+		result.Add(ast.NewTerm(obj))
+	})
+	return result
+}
+
+func normalize(v ast.Value, sortBindings bool) ast.Value {
+	x, err := ast.JSONWithOpt(v, ast.JSONOpt{SortSets: sortBindings})
+	if err != nil {
+		panic(err)
+	}
+	v = ast.MustInterfaceToValue(x)
+	if a, ok := v.(*ast.Array); ok && sortBindings {
+		return a.Sorted()
+	}
+	return v
+}
+
+func addTestSleepBuiltin() {
+	rego.RegisterBuiltin1(&rego.Function{
+		Name: "test.sleep",
+		Decl: types.NewFunction(types.Args(types.S), types.NewNull()),
+	}, func(_ rego.BuiltinContext, op *ast.Term) (*ast.Term, error) {
+		d, _ := time.ParseDuration(string(op.Value.(ast.String)))
+		time.Sleep(d)
+		return ast.NullTerm(), nil
+	})
+}
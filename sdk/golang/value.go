@@ -0,0 +1,189 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// Dot returns the value of key in the collection source, or nil if source
+// does not contain key or is not a collection. The value of a set member is
+// the member itself.
+func Dot(source, key ast.Value) ast.Value {
+	switch source := source.(type) {
+	case ast.Object:
+		if t := source.Get(ast.NewTerm(key)); t != nil {
+			return t.Value
+		}
+	case *ast.Array:
+		if n, ok := key.(ast.Number); ok {
+			if i, ok := n.Int(); ok && i >= 0 && i < source.Len() {
+				return source.Elem(i).Value
+			}
+		}
+	case ast.Set:
+		if source.Contains(ast.NewTerm(key)) {
+			return key
+		}
+	}
+	return nil
+}
+
+// Len returns the number of elements of a collection, or the length of a
+// string. The length of other values is zero.
+func Len(v ast.Value) ast.Value {
+	var n int
+	switch v := v.(type) {
+	case *ast.Array:
+		n = v.Len()
+	case ast.Object:
+		n = v.Len()
+	case ast.Set:
+		n = v.Len()
+	case ast.String:
+		n = len(v)
+	}
+	return ast.IntNumberTerm(n).Value
+}
+
+// Equal returns true if a and b are equal. Undefined values are only equal
+// to each other.
+func Equal(a, b ast.Value) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Compare(b) == 0
+}
+
+// NewArray returns an empty array with room for capacity elements.
+func NewArray(capacity int) ast.Value {
+	return ast.NewArray(make([]*ast.Term, 0, capacity)...)
+}
+
+// Append returns the array with v appended.
+func Append(array, v ast.Value) ast.Value {
+	return array.(*ast.Array).Append(ast.NewTerm(v))
+}
+
+// Insert inserts the key/value pair into the object, replacing the value of
+// an existing key.
+func Insert(object, key, value ast.Value) {
+	object.(ast.Object).Insert(ast.NewTerm(key), ast.NewTerm(value))
+}
+
+// Add adds v to the set.
+func Add(set, v ast.Value) {
+	set.(ast.Set).Add(ast.NewTerm(v))
+}
+
+// Merge returns the recursive merge of the objects a and b. Overlapping keys
+// keep the value of a unless both values are objects. If either value is not
+// an object, a is returned.
+func Merge(a, b ast.Value) ast.Value {
+	if a == nil {
+		return b
+	}
+
+	objA, okA := a.(ast.Object)
+	objB, okB := b.(ast.Object)
+	if !okA || !okB {
+		return a
+	}
+
+	result := ast.NewObject()
+
+	objA.Foreach(func(k, v *ast.Term) {
+		if other := objB.Get(k); other != nil {
+			result.Insert(k, ast.NewTerm(Merge(v.Value, other.Value)))
+		} else {
+			result.Insert(k, v)
+		}
+	})
+
+	objB.Foreach(func(k, v *ast.Term) {
+		if objA.Get(k) == nil {
+			result.Insert(k, v)
+		}
+	})
+
+	return result
+}
+
+// Upsert returns a copy of the object v with value inserted at path. The
+// objects along the path are copied, missing ones and values that are not
+// objects are replaced by new objects. The object v is not modified.
+func Upsert(v, value ast.Value, path ...ast.Value) ast.Value {
+	root := shallowCopy(v)
+	curr := root
+
+	for i := 0; i < len(path)-1; i++ {
+		next := shallowCopy(Dot(curr, path[i]))
+		curr.Insert(ast.NewTerm(path[i]), ast.NewTerm(next))
+		curr = next
+	}
+
+	curr.Insert(ast.NewTerm(path[len(path)-1]), ast.NewTerm(value))
+
+	return root
+}
+
+func shallowCopy(v ast.Value) ast.Object {
+	cpy := ast.NewObject()
+	if obj, ok := v.(ast.Object); ok {
+		obj.Foreach(func(k, v *ast.Term) {
+			cpy.Insert(k, v)
+		})
+	}
+	return cpy
+}
+
+// mapping is a tree of the rules that can be called dynamically, indexed by
+// the path of the documents they produce.
+type mapping struct {
+	fn       Func
+	children map[string]*mapping
+}
+
+func newMapping(funcs []MappedFunc) *mapping {
+	root := &mapping{}
+
+	for _, f := range funcs {
+		curr := root
+		for _, key := range f.Path {
+			if curr.children == nil {
+				curr.children = map[string]*mapping{}
+			}
+			next, ok := curr.children[key]
+			if !ok {
+				next = &mapping{}
+				curr.children[key] = next
+			}
+			curr = next
+		}
+		curr.fn = f.Func
+	}
+
+	return root
+}
+
+func (m *mapping) lookup(path []ast.Value) Func {
+	if len(path) == 0 {
+		return nil
+	}
+
+	curr := m
+
+	for _, v := range path {
+		key, ok := v.(ast.String)
+		if !ok {
+			return nil
+		}
+		if curr = curr.children[string(key)]; curr == nil {
+			return nil
+		}
+	}
+
+	return curr.fn
+}
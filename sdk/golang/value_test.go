@@ -0,0 +1,163 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package golang
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+func TestDot(t *testing.T) {
+
+	tests := []struct {
+		note   string
+		source string
+		key    string
+		exp    string // empty if undefined
+	}{
+		{"object", `{"a": 1}`, `"a"`, `1`},
+		{"object missing", `{"a": 1}`, `"b"`, ``},
+		{"array", `[1, 2]`, `1`, `2`},
+		{"array out of range", `[1, 2]`, `2`, ``},
+		{"array negative", `[1, 2]`, `-1`, ``},
+		{"array non-integer", `[1, 2]`, `0.5`, ``},
+		{"set", `{"a", "b"}`, `"b"`, `"b"`},
+		{"set missing", `{"a", "b"}`, `"c"`, ``},
+		{"scalar", `"a"`, `0`, ``},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			result := Dot(ast.MustParseTerm(tc.source).Value, ast.MustParseTerm(tc.key).Value)
+			if tc.exp == "" {
+				if result != nil {
+					t.Fatalf("expected undefined but got %v", result)
+				}
+				return
+			}
+			if exp := ast.MustParseTerm(tc.exp).Value; !Equal(exp, result) {
+				t.Fatalf("expected %v but got %v", exp, result)
+			}
+		})
+	}
+}
+
+func TestLen(t *testing.T) {
+	for source, exp := range map[string]int{
+		`[1, 2]`:    2,
+		`{"a": 1}`:  1,
+		`{1, 2, 3}`: 3,
+		`set()`:     0,
+		`"abc"`:     3,
+		`1`:         0,
+	} {
+		result := Len(ast.MustParseTerm(source).Value)
+		if !Equal(ast.IntNumberTerm(exp).Value, result) {
+			t.Fatalf("expected length of %v to be %d but got %v", source, exp, result)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+
+	tests := []struct {
+		note string
+		a    string
+		b    string
+		exp  string
+	}{
+		{"disjoint", `{"a": 1}`, `{"b": 2}`, `{"a": 1, "b": 2}`},
+		{"overlap", `{"a": 1}`, `{"a": 2}`, `{"a": 1}`},
+		{"nested", `{"a": {"b": 1}}`, `{"a": {"c": 2}, "d": 3}`, `{"a": {"b": 1, "c": 2}, "d": 3}`},
+		{"not objects", `[1]`, `{"a": 2}`, `[1]`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			result := Merge(ast.MustParseTerm(tc.a).Value, ast.MustParseTerm(tc.b).Value)
+			if exp := ast.MustParseTerm(tc.exp).Value; !Equal(exp, result) {
+				t.Fatalf("expected %v but got %v", exp, result)
+			}
+		})
+	}
+
+	b := ast.MustParseTerm(`{"a": 1}`).Value
+	if result := Merge(nil, b); result != b {
+		t.Fatalf("expected %v but got %v", b, result)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+
+	tests := []struct {
+		note  string
+		v     string
+		value string
+		path  []string
+		exp   string
+	}{
+		{"replace", `{"a": 1}`, `2`, []string{"a"}, `{"a": 2}`},
+		{"insert", `{"a": 1}`, `2`, []string{"b"}, `{"a": 1, "b": 2}`},
+		{"nested", `{"a": {"b": 1}}`, `2`, []string{"a", "c"}, `{"a": {"b": 1, "c": 2}}`},
+		{"missing", `{}`, `2`, []string{"a", "b"}, `{"a": {"b": 2}}`},
+		{"not object", `{"a": 1}`, `2`, []string{"a", "b"}, `{"a": {"b": 2}}`},
+		{"undefined", ``, `2`, []string{"a"}, `{"a": 2}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+
+			var v ast.Value
+			if tc.v != "" {
+				v = ast.MustParseTerm(tc.v).Value
+			}
+
+			path := make([]ast.Value, len(tc.path))
+			for i := range tc.path {
+				path[i] = ast.String(tc.path[i])
+			}
+
+			var before string
+			if v != nil {
+				before = v.String()
+			}
+
+			result := Upsert(v, ast.MustParseTerm(tc.value).Value, path...)
+			if exp := ast.MustParseTerm(tc.exp).Value; !Equal(exp, result) {
+				t.Fatalf("expected %v but got %v", exp, result)
+			}
+
+			if v != nil && v.String() != before {
+				t.Fatalf("expected %v not to be modified but got %v", before, v)
+			}
+		})
+	}
+}
+
+func TestMappingLookup(t *testing.T) {
+
+	f := func(*Context, ast.Value, ast.Value) ast.Value { return ast.Boolean(true) }
+
+	m := newMapping([]MappedFunc{
+		{Path: []string{"g0", "test", "p"}, Func: f},
+	})
+
+	if m.lookup([]ast.Value{ast.String("g0"), ast.String("test"), ast.String("p")}) == nil {
+		t.Fatal("expected function")
+	}
+
+	for _, path := range [][]ast.Value{
+		nil,
+		{ast.String("g0"), ast.String("test")},
+		{ast.String("g0"), ast.String("test"), ast.String("q")},
+		{ast.String("g0"), ast.String("test"), ast.String("p"), ast.String("x")},
+		{ast.String("g0"), ast.IntNumberTerm(1).Value, ast.String("p")},
+	} {
+		if m.lookup(path) != nil {
+			t.Fatalf("expected no function for %v", path)
+		}
+	}
+}
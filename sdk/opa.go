@@ -283,6 +283,156 @@ func (opa *OPA) Decision(ctx context.Context, options DecisionOptions) (*Decisio
 	return result, record.Error
 }
 
+// Decisions returns a named decision for every input in options. All inputs
+// are evaluated against the same compiled query inside a single storage
+// transaction. Each decision is logged individually and the returned items
+// are in the same order as the inputs. Errors that only affect a single input
+// (e.g., undefined decisions) are reported in the corresponding item, other
+// errors abort the batch. This function is threadsafe.
+func (opa *OPA) Decisions(ctx context.Context, options DecisionsOptions) ([]DecisionsItem, error) {
+	items := make([]DecisionsItem, 0, len(options.Inputs))
+	err := opa.DecisionsIter(ctx, options, func(item DecisionsItem) error {
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// DecisionsIter is like Decisions except that the items are passed to iter as
+// soon as they have been evaluated. If iter returns an error, the remaining
+// inputs are not evaluated and the error is returned. This function is
+// threadsafe.
+func (opa *OPA) DecisionsIter(ctx context.Context, options DecisionsOptions, iter func(DecisionsItem) error) error {
+
+	m := options.Metrics
+	if m == nil {
+		m = metrics.New()
+	}
+
+	m.Timer(metrics.SDKDecisionBatchEval).Start()
+	defer m.Timer(metrics.SDKDecisionBatchEval).Stop()
+
+	opa.mtx.Lock()
+	s := *opa.state
+	opa.mtx.Unlock()
+
+	now := options.Now
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+
+	path := options.Path
+	if path == "" {
+		path = *s.manager.Config.DefaultDecision
+	}
+
+	txn, err := s.manager.Store.NewTransaction(ctx, storage.TransactionParams{})
+	if err != nil {
+		return err
+	}
+
+	defer s.manager.Store.Abort(ctx, txn)
+
+	args := evalArgs{
+		runtime:             s.manager.Info,
+		printHook:           s.manager.PrintHook(),
+		compiler:            s.manager.GetCompiler(),
+		store:               s.manager.Store,
+		queryCache:          s.queryCache,
+		interQueryCache:     s.interQueryBuiltinCache,
+		txn:                 txn,
+		now:                 now,
+		path:                path,
+		m:                   m,
+		strictBuiltinErrors: options.StrictBuiltinErrors,
+		instrument:          options.Instrument,
+	}
+
+	pq, provenance, bundles, err := prepare(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	logger := logs.Lookup(s.manager)
+
+	for i := range options.Inputs {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		id, err := uuid.New(rand.Reader)
+		if err != nil {
+			return err
+		}
+
+		record := server.Info{
+			DecisionID: id,
+			Txn:        txn,
+			Timestamp:  now,
+			Path:       path,
+			Input:      &options.Inputs[i],
+			Bundles:    bundles,
+			Metrics:    metrics.New(),
+		}
+
+		args.input = options.Inputs[i]
+		args.m = record.Metrics
+		args.ndbcache = nil
+
+		if options.NDBCache {
+			args.ndbcache = builtins.NDBCache{}
+			var ndbc interface{} = args.ndbcache
+			record.NDBuiltinCache = &ndbc
+		}
+
+		item := DecisionsItem{Index: i, DecisionResult: DecisionResult{ID: id, Provenance: provenance}}
+
+		record.Metrics.Timer(metrics.SDKDecisionEval).Start()
+
+		item.Result, record.InputAST, item.Err = eval(ctx, pq, args)
+		if item.Err == nil {
+			record.Results = &item.Result
+		} else {
+			record.Error = item.Err
+		}
+
+		record.Metrics.Timer(metrics.SDKDecisionEval).Stop()
+
+		if logger != nil {
+			if err := logger.Log(ctx, &record); err != nil {
+				return fmt.Errorf("decision log: %w", err)
+			}
+		}
+
+		if err := iter(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DecisionsOptions contains parameters for the evaluation of a batch of
+// decisions.
+type DecisionsOptions struct {
+	Now                 time.Time       // specifies wallclock time used for time.now_ns(), decision log timestamps, etc.
+	Path                string          // specifies name of policy decision to evaluate (e.g., example/allow)
+	Inputs              []interface{}   // specifies the values of the input document to evaluate policy with, one per decision
+	NDBCache            bool            // if true, a non-deterministic builtins cache is recorded for each decision (see decision_logs.nd_builtin_cache)
+	StrictBuiltinErrors bool            // treat built-in function errors as fatal
+	Metrics             metrics.Metrics // specifies the metrics to use for preparing and evaluating the batch, optional
+	Instrument          bool            // if true, instrumentation will be enabled
+}
+
+// DecisionsItem contains the output of query evaluation for one input of a
+// batch.
+type DecisionsItem struct {
+	DecisionResult
+	Index int   // provides the index of the input in DecisionsOptions.Inputs
+	Err   error // provides the error that occurred during evaluation of this input, if any
+}
+
 // DecisionOptions contains parameters for query evaluation.
 type DecisionOptions struct {
 	Now                 time.Time           // specifies wallclock time used for time.now_ns(), decision log timestamp, etc.
@@ -495,6 +645,19 @@ type evalArgs struct {
 
 func evaluate(ctx context.Context, args evalArgs) (interface{}, types.ProvenanceV1, ast.Value, map[string]server.BundleInfo, error) {
 
+	pq, provenance, bundles, err := prepare(ctx, args)
+	if err != nil {
+		return nil, provenance, nil, bundles, err
+	}
+
+	result, inputAST, err := eval(ctx, pq, args)
+	return result, provenance, inputAST, bundles, err
+}
+
+// prepare returns the prepared query for the decision named by args.path along
+// with the provenance of the bundles it is evaluated against.
+func prepare(ctx context.Context, args evalArgs) (*rego.PreparedEvalQuery, types.ProvenanceV1, map[string]server.BundleInfo, error) {
+
 	provenance := types.ProvenanceV1{
 		Version:   version.Version,
 		Vcs:       version.Vcs,
@@ -504,7 +667,7 @@ func evaluate(ctx context.Context, args evalArgs) (interface{}, types.Provenance
 	}
 	bundles, err := bundles(ctx, args.store, args.txn)
 	if err != nil {
-		return nil, provenance, nil, nil, err
+		return nil, provenance, nil, err
 	}
 	for b, info := range bundles {
 		provenance.Bundles[b] = types.ProvenanceBundleV1{
@@ -514,7 +677,7 @@ func evaluate(ctx context.Context, args evalArgs) (interface{}, types.Provenance
 
 	r, err := ref.ParseDataPath(args.path)
 	if err != nil {
-		return nil, provenance, nil, bundles, err
+		return nil, provenance, bundles, err
 	}
 
 	pq, err := args.queryCache.Get(r.String(), func(query string) (*rego.PreparedEvalQuery, error) {
@@ -535,12 +698,18 @@ func evaluate(ctx context.Context, args evalArgs) (interface{}, types.Provenance
 		return &pq, err
 	})
 	if err != nil {
-		return nil, provenance, nil, bundles, err
+		return nil, provenance, bundles, err
 	}
 
+	return pq, provenance, bundles, nil
+}
+
+// eval evaluates pq with args.input and returns the value of the decision.
+func eval(ctx context.Context, pq *rego.PreparedEvalQuery, args evalArgs) (interface{}, ast.Value, error) {
+
 	inputAST, err := ast.InterfaceToValue(args.input)
 	if err != nil {
-		return nil, provenance, nil, bundles, err
+		return nil, nil, err
 	}
 
 	rs, err := pq.Eval(
@@ -557,12 +726,12 @@ func evaluate(ctx context.Context, args evalArgs) (interface{}, types.Provenance
 		rego.EvalInstrument(args.instrument),
 	)
 	if err != nil {
-		return nil, provenance, inputAST, bundles, err
+		return nil, inputAST, err
 	} else if len(rs) == 0 {
-		return nil, provenance, inputAST, bundles, undefinedDecisionErr(args.path)
+		return nil, inputAST, undefinedDecisionErr(args.path)
 	}
 
-	return rs[0].Expressions[0].Value, provenance, inputAST, bundles, nil
+	return rs[0].Expressions[0].Value, inputAST, nil
 }
 
 type partialEvalArgs struct {
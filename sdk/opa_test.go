@@ -30,6 +30,7 @@ import (
 	"github.com/open-policy-agent/opa/profiler"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/open-policy-agent/opa/sdk"
+	"github.com/open-policy-agent/opa/sdk/filter"
 	sdktest "github.com/open-policy-agent/opa/sdk/test"
 	"github.com/open-policy-agent/opa/server/types"
 	"github.com/open-policy-agent/opa/topdown"
@@ -813,6 +814,77 @@ allow {
 
 }
 
+func TestPartialWithFilterMapper(t *testing.T) {
+
+	ctx := context.Background()
+
+	server := sdktest.MustNewServer(
+		sdktest.MockBundle("/bundles/bundle.tar.gz", map[string]string{
+			"main.rego": `
+package test
+
+allow {
+	input.pets.owner == input.subject
+}
+`,
+		}),
+	)
+
+	defer server.Stop()
+
+	config := fmt.Sprintf(`{
+		"services": {
+			"test": {
+				"url": %q
+			}
+		},
+		"bundles": {
+			"test": {
+				"resource": "/bundles/bundle.tar.gz"
+			}
+		},
+		"decision_logs": {
+			"console": true
+		}
+	}`, server.URL())
+
+	testLogger := loggingtest.New()
+	opa, err := sdk.New(ctx, sdk.Options{
+		Config:        strings.NewReader(config),
+		ConsoleLogger: testLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer opa.Stop(ctx)
+
+	result, err := opa.Partial(ctx, sdk.PartialOptions{
+		Input:    map[string]interface{}{"subject": "bob"},
+		Query:    "data.test.allow = true",
+		Unknowns: []string{"input.pets"},
+		Mapper:   &filter.Mapper{Unknown: "input.pets"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := filter.Compare{Operator: filter.OpEq, Field: filter.Path{"owner"}, Value: "bob"}
+	if !reflect.DeepEqual(result.Result, exp) {
+		t.Fatalf("expected %v but got %v", exp, result.Result)
+	}
+
+	entries := testLogger.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 decision log event but got %d", len(entries))
+	}
+
+	expMapped := map[string]interface{}{"op": "eq", "field": []interface{}{"owner"}, "value": "bob"}
+	if !reflect.DeepEqual(entries[0].Fields["mapped_result"], expMapped) {
+		t.Fatalf("expected %v but got %v", expMapped, entries[0].Fields["mapped_result"])
+	}
+}
+
 func TestPartialWithStrictBuiltinErrors(t *testing.T) {
 
 	ctx := context.Background()
@@ -1414,6 +1486,220 @@ main = time.now_ns()
 
 }
 
+func TestDecisions(t *testing.T) {
+
+	ctx := context.Background()
+
+	server := sdktest.MustNewServer(
+		sdktest.MockBundle("/bundles/bundle.tar.gz", map[string]string{
+			"main.rego": `
+package system
+
+allow {
+	input.user == "alice"
+}
+
+owner = input.owner {
+	input.owner != "nobody"
+}
+
+nd = time.now_ns()
+`,
+		}),
+	)
+
+	defer server.Stop()
+
+	config := fmt.Sprintf(`{
+		"services": {
+			"test": {
+				"url": %q
+			}
+		},
+		"bundles": {
+			"test": {
+				"resource": "/bundles/bundle.tar.gz"
+			}
+		},
+		"decision_logs": {
+			"console": true,
+			"nd_builtin_cache": true
+		}
+	}`, server.URL())
+
+	testLogger := loggingtest.New()
+	opa, err := sdk.New(ctx, sdk.Options{
+		Config:        strings.NewReader(config),
+		ConsoleLogger: testLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer opa.Stop(ctx)
+
+	m := metrics.New()
+	items, err := opa.Decisions(ctx, sdk.DecisionsOptions{
+		Path: "/system/owner",
+		Inputs: []interface{}{
+			map[string]interface{}{"owner": "alice"},
+			map[string]interface{}{"owner": "nobody"},
+			map[string]interface{}{"owner": "bob"},
+		},
+		Metrics: m,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items but got %d", len(items))
+	}
+
+	for i, exp := range []interface{}{"alice", nil, "bob"} {
+		if items[i].Index != i {
+			t.Errorf("expected index %d but got %d", i, items[i].Index)
+		}
+		if exp == nil {
+			if !sdk.IsUndefinedErr(items[i].Err) {
+				t.Errorf("expected undefined error for item %d but got: %v", i, items[i].Err)
+			}
+		} else if items[i].Err != nil || items[i].Result != exp {
+			t.Errorf("expected %v for item %d but got: %v (err: %v)", exp, i, items[i].Result, items[i].Err)
+		}
+	}
+
+	if items[0].ID == "" || items[0].ID == items[1].ID || items[1].ID == items[2].ID {
+		t.Fatalf("expected unique decision IDs but got: %v, %v, %v", items[0].ID, items[1].ID, items[2].ID)
+	}
+
+	if _, ok := m.All()["timer_"+metrics.SDKDecisionBatchEval+"_ns"]; !ok {
+		t.Fatalf("expected batch timer but got: %v", m.All())
+	}
+
+	entries := testLogger.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 decision log events but got %d", len(entries))
+	}
+
+	for i := range entries {
+		if entries[i].Fields["decision_id"] != items[i].ID {
+			t.Errorf("expected decision ID %v but got %v", items[i].ID, entries[i].Fields["decision_id"])
+		}
+		if _, ok := entries[i].Fields["metrics"].(map[string]interface{})["timer_"+metrics.SDKDecisionEval+"_ns"]; !ok {
+			t.Errorf("expected decision timer in event %d but got: %v", i, entries[i].Fields["metrics"])
+		}
+	}
+
+	if _, ok := entries[1].Fields["error"]; !ok {
+		t.Errorf("expected error in event 1 but got: %v", entries[1].Fields)
+	}
+
+	// Verify that every decision gets its own ND builtins cache.
+	items, err = opa.Decisions(ctx, sdk.DecisionsOptions{
+		Now:      time.Unix(0, 1619868194450288000).UTC(),
+		Path:     "/system/nd",
+		Inputs:   []interface{}{nil, nil},
+		NDBCache: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries = testLogger.Entries()[3:]
+	for i := range entries {
+		cache, ok := entries[i].Fields["nd_builtin_cache"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("ND builtins cache missing in event %d", i)
+		}
+		if _, ok := cache["time.now_ns"]; !ok {
+			t.Fatalf("ND builtins cache did not observe time.now_ns call in event %d", i)
+		}
+		if items[i].Result != json.Number("1619868194450288000") {
+			t.Fatalf("expected time.now_ns() value but got: %v", items[i].Result)
+		}
+	}
+}
+
+func TestDecisionsIter(t *testing.T) {
+
+	ctx := context.Background()
+
+	server := sdktest.MustNewServer(
+		sdktest.MockBundle("/bundles/bundle.tar.gz", map[string]string{
+			"main.rego": `
+package system
+
+main = input.x * 2
+`,
+		}),
+	)
+
+	defer server.Stop()
+
+	config := fmt.Sprintf(`{
+		"services": {
+			"test": {
+				"url": %q
+			}
+		},
+		"bundles": {
+			"test": {
+				"resource": "/bundles/bundle.tar.gz"
+			}
+		}
+	}`, server.URL())
+
+	opa, err := sdk.New(ctx, sdk.Options{
+		Config: strings.NewReader(config),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer opa.Stop(ctx)
+
+	inputs := []interface{}{
+		map[string]interface{}{"x": 1},
+		map[string]interface{}{"x": "a"},
+		map[string]interface{}{"x": 3},
+		map[string]interface{}{"x": 4},
+	}
+
+	stop := errors.New("stop")
+
+	var results []interface{}
+	err = opa.DecisionsIter(ctx, sdk.DecisionsOptions{Inputs: inputs}, func(item sdk.DecisionsItem) error {
+		if item.Err != nil {
+			results = append(results, item.Err.Error())
+		} else {
+			results = append(results, item.Result)
+		}
+		if item.Index == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("expected stop error but got: %v", err)
+	}
+
+	exp := []interface{}{json.Number("2"), "opa_undefined_error: /system/main decision was undefined", json.Number("6")}
+	if !reflect.DeepEqual(results, exp) {
+		t.Fatalf("expected %v but got %v", exp, results)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := opa.DecisionsIter(cctx, sdk.DecisionsOptions{Inputs: inputs}, func(sdk.DecisionsItem) error {
+		t.Fatal("unexpected item")
+		return nil
+	}); err != context.Canceled {
+		t.Fatalf("expected context canceled error but got: %v", err)
+	}
+}
+
 func TestQueryCaching(t *testing.T) {
 
 	ctx := context.Background()
@@ -2,14 +2,16 @@
 // Use of this source code is governed by an Apache2
 // license that can be found in the LICENSE file.
 
-package opa
+package wasm
 
 import (
 	"encoding/json"
 	"os"
 
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa/errors"
+	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/internal/wasm/util"
+	"github.com/open-policy-agent/opa/sdk/wasm/errors"
+	"github.com/open-policy-agent/opa/topdown"
 )
 
 // WithPolicyFile configures a policy file to load.
@@ -95,6 +97,66 @@ func (o *OPA) WithPoolSize(size uint32) *OPA {
 	return o
 }
 
+// WithPoolMinSize configures the number of WASM instances constructed in
+// advance whenever the policy or data is set, so that the first evaluations
+// do not wait for new instances. It cannot exceed the pool size. The default
+// is to construct the instances as evaluations need them.
+func (o *OPA) WithPoolMinSize(size uint32) *OPA {
+	o.poolMinSize = size
+	return o
+}
+
+// WithEvalMemoryLimit configures the memory (in bytes) available to a single
+// policy evaluation, in addition to the memory used by the policy and data.
+// Evaluations exceeding it fail with an error matched by
+// errors.IsMemoryLimit. The memory limits configured with WithMemoryLimits
+// still apply.
+func (o *OPA) WithEvalMemoryLimit(limit uint32) *OPA {
+	if limit == 0 {
+		o.configErr = errors.New(errors.InvalidConfigErr, "evaluation memory limit")
+		return o
+	}
+
+	o.evalMemory = limit
+	return o
+}
+
+// WithFuelLimit configures the fuel available to a single policy evaluation.
+// The WebAssembly runtime consumes roughly one unit of fuel per instruction
+// executed. Evaluations exceeding it fail with an error matched by
+// errors.IsFuelLimit. Fuel consumed by built-in functions implemented in Go
+// is not accounted for.
+func (o *OPA) WithFuelLimit(fuel uint64) *OPA {
+	if fuel == 0 {
+		o.configErr = errors.New(errors.InvalidConfigErr, "fuel limit")
+		return o
+	}
+
+	o.fuel = fuel
+	return o
+}
+
+// WithBuiltin registers the Go implementation of a built-in function called
+// by the policy but not implemented in WebAssembly. It takes precedence over
+// the implementation of the built-in function in OPA, if any. As with the
+// built-in functions of OPA, errors make the call undefined, unless they are
+// topdown.Halt errors, which fail the evaluation.
+func (o *OPA) WithBuiltin(name string, builtin Builtin) *OPA {
+	if o.builtins == nil {
+		o.builtins = map[string]topdown.BuiltinFunc{}
+	}
+
+	o.builtins[name] = func(bctx topdown.BuiltinContext, operands []*ast.Term, iter func(*ast.Term) error) error {
+		result, err := builtin(bctx, operands)
+		if err != nil || result == nil {
+			return err
+		}
+		return iter(result)
+	}
+
+	return o
+}
+
 // WithErrorLogger configures an error logger invoked with all the errors.
 func (o *OPA) WithErrorLogger(logger func(error)) *OPA {
 	o.logError = logger
@@ -27,6 +27,12 @@ const (
 
 	// CancelledErr is the error code returned if the evaluation is cancelled.
 	CancelledErr string = "cancelled"
+
+	// MemoryLimitErr is the error code returned if the evaluation runs out of memory.
+	MemoryLimitErr string = "memory_limit_exceeded"
+
+	// FuelLimitErr is the error code returned if the evaluation runs out of fuel.
+	FuelLimitErr string = "fuel_limit_exceeded"
 )
 
 // Error is the error code type returned by the SDK functions when an error occurs.
@@ -38,7 +44,7 @@ type Error struct {
 // New returns a new error with the passed code
 func New(code, msg string) error {
 	switch code {
-	case InvalidConfigErr, InvalidPolicyOrDataErr, InvalidBundleErr, NotReadyErr, InternalErr, CancelledErr:
+	case InvalidConfigErr, InvalidPolicyOrDataErr, InvalidBundleErr, NotReadyErr, InternalErr, CancelledErr, MemoryLimitErr, FuelLimitErr:
 		return &Error{Code: code, Message: msg}
 	default:
 		panic("unknown error code: " + code)
@@ -59,7 +65,19 @@ func IsCancel(err error) bool {
 	return errorHasCode(err, CancelledErr)
 }
 
-// Is allows matching error types using errors.Is (see IsCancel).
+// IsMemoryLimit returns true if err was caused by the evaluation running out
+// of memory.
+func IsMemoryLimit(err error) bool {
+	return errorHasCode(err, MemoryLimitErr)
+}
+
+// IsFuelLimit returns true if err was caused by the evaluation running out of
+// fuel.
+func IsFuelLimit(err error) bool {
+	return errorHasCode(err, FuelLimitErr)
+}
+
+// Is allows matching error types using errors.Is (see IsCancel, IsMemoryLimit and IsFuelLimit).
 func (e *Error) Is(target error) bool {
 	var t *Error
 	if errors.As(target, &t) {
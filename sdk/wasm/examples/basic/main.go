@@ -9,7 +9,7 @@ import (
 	"os"
 	"path"
 
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa"
+	"github.com/open-policy-agent/opa/sdk/wasm"
 )
 
 // main demonstrates the loading and executing of OPA produced wasm
@@ -31,7 +31,7 @@ func main() {
 		return
 	}
 
-	rego, err := opa.New().WithPolicyBytes(policy).Init()
+	rego, err := wasm.New().WithPolicyBytes(policy).Init()
 	if err != nil {
 		fmt.Printf("error: %v\n", err)
 		return
@@ -60,7 +60,7 @@ func main() {
 		return
 	}
 
-	result, err := rego.Eval(ctx, opa.EvalOpts{Entrypoint: entrypointID, Input: &input})
+	result, err := rego.Eval(ctx, wasm.EvalOpts{Entrypoint: entrypointID, Input: &input})
 	if err != nil {
 		fmt.Printf("error: %v\n", err)
 		return
@@ -96,7 +96,7 @@ func main() {
 		return
 	}
 
-	result, err = rego.Eval(ctx, opa.EvalOpts{Entrypoint: entrypointID, Input: &input})
+	result, err = rego.Eval(ctx, wasm.EvalOpts{Entrypoint: entrypointID, Input: &input})
 	if err != nil {
 		fmt.Printf("error: %v\n", err)
 		return
@@ -11,15 +11,15 @@ import (
 	"os"
 	"time"
 
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa"
-	opaLoader "github.com/open-policy-agent/opa/internal/wasm/sdk/opa/loader"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa/loader/file"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa/loader/http"
+	"github.com/open-policy-agent/opa/sdk/wasm"
+	opaLoader "github.com/open-policy-agent/opa/sdk/wasm/loader"
+	"github.com/open-policy-agent/opa/sdk/wasm/loader/file"
+	"github.com/open-policy-agent/opa/sdk/wasm/loader/http"
 )
 
 var (
 	loader opaLoader.Loader
-	rego   *opa.OPA
+	rego   *wasm.OPA
 )
 
 func main() {
@@ -63,7 +63,7 @@ func main() {
 		return
 	}
 
-	result, err := rego.Eval(ctx, opa.EvalOpts{Entrypoint: entrypointID, Input: &input})
+	result, err := rego.Eval(ctx, wasm.EvalOpts{Entrypoint: entrypointID, Input: &input})
 	if err != nil {
 		fmt.Printf("error: %v\n", err)
 		return
@@ -74,7 +74,7 @@ func main() {
 
 func setup(u string, token string) error {
 	var err error
-	rego, err = opa.New().Init()
+	rego, err = wasm.New().Init()
 	if err != nil {
 		return err
 	}
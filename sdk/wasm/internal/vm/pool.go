@@ -2,7 +2,7 @@
 // Use of this source code is governed by an Apache2
 // license that can be found in the LICENSE file.
 
-package wasm
+package vm
 
 import (
 	"bytes"
@@ -11,45 +11,48 @@ import (
 
 	wasmtime "github.com/bytecodealliance/wasmtime-go/v3"
 
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa/errors"
 	"github.com/open-policy-agent/opa/internal/wasm/util"
 	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/sdk/wasm/errors"
+	"github.com/open-policy-agent/opa/topdown"
 )
 
 var errNotReady = errors.New(errors.NotReadyErr, "")
 
 // Pool maintains a pool of WebAssemly VM instances.
 type Pool struct {
-	engine         *wasmtime.Engine
-	available      chan struct{}
-	mutex          sync.Mutex
-	dataMtx        sync.Mutex
-	initialized    bool
-	closed         bool
-	policy         []byte
-	parsedData     []byte // Parsed parsedData memory segment, used to seed new VM's
-	parsedDataAddr int32  // Address for parsedData value root, used to seed new VM's
-	memoryMinPages uint32
-	memoryMaxPages uint32
-	vms            []*VM // All current VM instances, acquired or not.
-	acquired       []bool
-	pendingReinit  *VM
-	blockedReinit  chan struct{}
+	engine          *wasmtime.Engine
+	available       chan struct{}
+	mutex           sync.Mutex
+	dataMtx         sync.Mutex
+	initialized     bool
+	generation      uint64 // Incremented each time the policy or data is replaced.
+	closed          bool
+	policy          []byte
+	parsedData      []byte // Parsed parsedData memory segment, used to seed new VM's
+	parsedDataAddr  int32  // Address for parsedData value root, used to seed new VM's
+	memoryMinPages  uint32
+	memoryMaxPages  uint32
+	evalMemoryPages uint32 // Memory available to an evaluation, 0 means no limit.
+	fuel            uint64 // Fuel available to an evaluation, 0 means no limit.
+	minSize         uint32
+	builtins        map[string]topdown.BuiltinFunc
+	vms             []*VM // All current VM instances, acquired or not.
+	acquired        []bool
+	pendingReinit   *VM
+	blockedReinit   chan struct{}
 }
 
 // NewPool constructs a new pool with the pool and VM configuration provided.
 func NewPool(poolSize, memoryMinPages, memoryMaxPages uint32) *Pool {
 
-	cfg := wasmtime.NewConfig()
-	cfg.SetEpochInterruption(true)
-
 	available := make(chan struct{}, poolSize)
 	for i := uint32(0); i < poolSize; i++ {
 		available <- struct{}{}
 	}
 
 	return &Pool{
-		engine:         wasmtime.NewEngineWithConfig(cfg),
+		engine:         newEngine(false),
 		memoryMinPages: memoryMinPages,
 		memoryMaxPages: memoryMaxPages,
 		available:      available,
@@ -58,6 +61,41 @@ func NewPool(poolSize, memoryMinPages, memoryMaxPages uint32) *Pool {
 	}
 }
 
+func newEngine(consumeFuel bool) *wasmtime.Engine {
+	cfg := wasmtime.NewConfig()
+	cfg.SetEpochInterruption(true)
+	cfg.SetConsumeFuel(consumeFuel)
+	return wasmtime.NewEngineWithConfig(cfg)
+}
+
+// WithMinSize configures the number of VMs constructed in advance when the
+// policy and data are set.
+func (p *Pool) WithMinSize(size uint32) *Pool {
+	p.minSize = size
+	return p
+}
+
+// WithEvalMemoryLimit configures the number of pages of memory available to
+// a single evaluation, in addition to the memory used by the policy and data.
+func (p *Pool) WithEvalMemoryLimit(pages uint32) *Pool {
+	p.evalMemoryPages = pages
+	return p
+}
+
+// WithFuelLimit configures the fuel available to a single evaluation.
+func (p *Pool) WithFuelLimit(fuel uint64) *Pool {
+	p.fuel = fuel
+	p.engine = newEngine(fuel > 0)
+	return p
+}
+
+// WithBuiltins configures the built-in functions implemented by the host,
+// in addition to or in place of the topdown ones.
+func (p *Pool) WithBuiltins(builtins map[string]topdown.BuiltinFunc) *Pool {
+	p.builtins = builtins
+	return p
+}
+
 // ParsedData returns a reference to the pools parsed external data used to
 // initialize new VM's.
 func (p *Pool) ParsedData() (int32, []byte) {
@@ -95,6 +133,7 @@ func (p *Pool) Acquire(ctx context.Context, metrics metrics.Metrics) (*VM, error
 	defer p.mutex.Unlock()
 
 	if !p.initialized || p.closed {
+		p.available <- struct{}{}
 		return nil, errNotReady
 	}
 
@@ -105,17 +144,11 @@ func (p *Pool) Acquire(ctx context.Context, metrics metrics.Metrics) (*VM, error
 		}
 	}
 
-	policy, parsedData, parsedDataAddr := p.policy, p.parsedData, p.parsedDataAddr
+	opts := p.cloneOpts(p.policy, p.parsedData, p.parsedDataAddr, p.memoryMinPages)
+	generation := p.generation
 
 	p.mutex.Unlock()
-	vm, err := newVM(vmOpts{
-		policy:         policy,
-		data:           nil,
-		parsedData:     parsedData,
-		parsedDataAddr: parsedDataAddr,
-		memoryMin:      p.memoryMinPages,
-		memoryMax:      p.memoryMaxPages,
-	}, p.engine)
+	vm, err := newVM(opts, p.engine)
 	p.mutex.Lock()
 
 	if err != nil {
@@ -123,6 +156,12 @@ func (p *Pool) Acquire(ctx context.Context, metrics metrics.Metrics) (*VM, error
 		return nil, errors.New(errors.InternalErr, err.Error())
 	}
 
+	// The policy or data was replaced while constructing the VM: the VM is
+	// used for this evaluation only.
+	if generation != p.generation {
+		return vm, nil
+	}
+
 	p.acquired = append(p.acquired, true)
 	p.vms = append(p.vms, vm)
 	return vm, nil
@@ -158,59 +197,73 @@ func (p *Pool) Release(vm *VM, metrics metrics.Metrics) {
 	p.available <- struct{}{}
 }
 
-// SetPolicyData re-initializes the vms within the pool with the new policy
-// and data. The re-initialization takes place atomically: all new vms
-// are constructed in advance before touching the pool.  Returns
-// either ErrNotReady, ErrInvalidPolicy or ErrInternal if an error
-// occurs.
+// SetPolicyData replaces the policy and data of the pool. The VMs with the
+// new policy and data are constructed in advance and swapped in atomically:
+// the evaluations in flight complete with the previous policy and data, and
+// their VMs are discarded when released. Returns either ErrNotReady,
+// ErrInvalidPolicyOrData or ErrInternal if an error occurs.
 func (p *Pool) SetPolicyData(ctx context.Context, policy []byte, data []byte) error {
 	p.dataMtx.Lock()
 	defer p.dataMtx.Unlock()
 
 	p.mutex.Lock()
 
-	if !p.initialized {
-		vm, err := newVM(vmOpts{
-			policy:         policy,
-			data:           data,
-			parsedData:     nil,
-			parsedDataAddr: 0,
-			memoryMin:      p.memoryMinPages,
-			memoryMax:      p.memoryMaxPages,
-		}, p.engine)
-
-		if err == nil {
-			parsedDataAddr, parsedData := vm.cloneDataSegment()
-			p.memoryMinPages = util.Pages(uint32(vm.memory.DataSize(vm.store)))
-			p.vms = append(p.vms, vm)
-			p.acquired = append(p.acquired, false)
-			p.initialized = true
-			p.policy, p.parsedData, p.parsedDataAddr = policy, parsedData, parsedDataAddr
-		} else {
-			err = errors.New(errors.InvalidPolicyOrDataErr, err.Error())
-		}
-
+	if p.closed {
 		p.mutex.Unlock()
-		return err
+		return errNotReady
 	}
 
-	if p.closed {
+	if p.initialized && bytes.Equal(policy, p.policy) && bytes.Equal(data, p.parsedData) {
 		p.mutex.Unlock()
-		return errNotReady
+		return nil
 	}
 
-	currentPolicy, currentData := p.policy, p.parsedData
 	p.mutex.Unlock()
 
-	if bytes.Equal(policy, currentPolicy) && bytes.Equal(data, currentData) {
-		return nil
+	vm, err := newVM(vmOpts{
+		policy:    policy,
+		data:      data,
+		memoryMin: p.memoryMinPages,
+		memoryMax: p.memoryMaxPages,
+		fuel:      p.fuel,
+		builtins:  p.builtins,
+	}, p.engine)
+	if err != nil {
+		return errors.New(errors.InvalidPolicyOrDataErr, err.Error())
 	}
 
-	err := p.setPolicyData(ctx, policy, data)
-	if err != nil {
-		return errors.New(errors.InternalErr, err.Error())
+	parsedDataAddr, parsedData := vm.cloneDataSegment()
+	memoryMinPages := util.Pages(uint32(vm.memory.DataSize(vm.store)))
+	opts := p.cloneOpts(policy, parsedData, parsedDataAddr, memoryMinPages)
+
+	// The VM parsing the data is only kept if its memory does not have to
+	// be limited. At least one VM is kept for the data updates to apply to.
+	vms := []*VM{vm}
+	if opts.memoryMax != p.memoryMaxPages {
+		vms = nil
 	}
 
+	for len(vms) == 0 || uint32(len(vms)) < p.minSize {
+		vm, err := newVM(opts, p.engine)
+		if err != nil {
+			return errors.New(errors.InternalErr, err.Error())
+		}
+		vms = append(vms, vm)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return errNotReady
+	}
+
+	p.vms = vms
+	p.acquired = make([]bool, len(vms))
+	p.initialized = true
+	p.generation++
+	p.policy, p.parsedData, p.parsedDataAddr, p.memoryMinPages = policy, parsedData, parsedDataAddr, memoryMinPages
+
 	return nil
 }
 
@@ -220,7 +273,7 @@ func (p *Pool) SetPolicyData(ctx context.Context, policy []byte, data []byte) er
 func (p *Pool) SetDataPath(ctx context.Context, path []string, value interface{}) error {
 	p.dataMtx.Lock()
 	defer p.dataMtx.Unlock()
-	return p.updateVMs(func(vm *VM, opts vmOpts) error {
+	return p.updateVMs(func(vm *VM) error {
 		return vm.SetDataPath(ctx, path, value)
 	})
 }
@@ -231,29 +284,16 @@ func (p *Pool) SetDataPath(ctx context.Context, path []string, value interface{}
 func (p *Pool) RemoveDataPath(ctx context.Context, path []string) error {
 	p.dataMtx.Lock()
 	defer p.dataMtx.Unlock()
-	return p.updateVMs(func(vm *VM, _ vmOpts) error {
+	return p.updateVMs(func(vm *VM) error {
 		return vm.RemoveDataPath(ctx, path)
 	})
 }
 
-// setPolicyData reinitializes the VMs one at a time.
-func (p *Pool) setPolicyData(ctx context.Context, policy []byte, data []byte) error {
-	return p.updateVMs(func(vm *VM, opts vmOpts) error {
-		opts.policy = policy
-		opts.data = data
-		return vm.SetPolicyData(ctx, opts)
-	})
-}
-
 // updateVMs Iterates over each VM, waiting for each to safely acquire them,
 // and applies the update function. If the first update succeeds any subsequent
 // failures will remove the VM and continue through the pool. Otherwise an error
 // will be returned.
-func (p *Pool) updateVMs(update func(vm *VM, opts vmOpts) error) error {
-	var policy []byte
-	var parsedData []byte
-	var parsedDataAddr int32
-	seedMemorySize := p.memoryMinPages
+func (p *Pool) updateVMs(update func(vm *VM) error) error {
 	activated := false
 	i := 0
 	for {
@@ -263,13 +303,7 @@ func (p *Pool) updateVMs(update func(vm *VM, opts vmOpts) error) error {
 			return nil
 		}
 
-		err := update(vm, vmOpts{
-			policy:         policy,
-			parsedData:     parsedData,
-			parsedDataAddr: parsedDataAddr,
-			memoryMin:      seedMemorySize,
-			memoryMax:      p.memoryMaxPages, // The max pages cannot be changed while updating.
-		})
+		err := update(vm)
 
 		if err != nil {
 			// No guarantee about the VM state after an error; hence, remove.
@@ -287,10 +321,9 @@ func (p *Pool) updateVMs(update func(vm *VM, opts vmOpts) error) error {
 			if !activated {
 				// Activate the policy and data, now that a single VM has been reset without errors.
 				activated = true
-				policy = vm.policy
-				parsedDataAddr, parsedData = vm.cloneDataSegment()
-				seedMemorySize = util.Pages(uint32(vm.memory.DataSize(vm.store)))
-				p.activate(policy, parsedData, parsedDataAddr, seedMemorySize)
+				parsedDataAddr, parsedData := vm.cloneDataSegment()
+				seedMemorySize := util.Pages(uint32(vm.memory.DataSize(vm.store)))
+				p.activate(vm.policy, parsedData, parsedDataAddr, seedMemorySize)
 			}
 
 			p.Release(vm, metrics.New())
@@ -303,15 +336,20 @@ func (p *Pool) updateVMs(update func(vm *VM, opts vmOpts) error) error {
 
 // Close waits for all the evaluations to finish and then releases the VMs.
 func (p *Pool) Close() {
-	for range p.vms {
+	for i := 0; i < cap(p.available); i++ {
 		<-p.available
 	}
 
 	p.mutex.Lock()
-	defer p.mutex.Unlock()
-
 	p.closed = true
 	p.vms = nil
+	p.acquired = nil
+	p.mutex.Unlock()
+
+	// Acquire returns ErrNotReady from now on.
+	for i := 0; i < cap(p.available); i++ {
+		p.available <- struct{}{}
+	}
 }
 
 // Wait steals the i'th VM instance. The VM has to be released afterwards.
@@ -364,5 +402,24 @@ func (p *Pool) activate(policy []byte, data []byte, dataAddr int32, minMemoryPag
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
+	p.generation++
 	p.policy, p.parsedData, p.parsedDataAddr, p.memoryMinPages = policy, data, dataAddr, minMemoryPages
 }
+
+// cloneOpts returns the options for constructing a VM from the parsed data.
+func (p *Pool) cloneOpts(policy []byte, parsedData []byte, parsedDataAddr int32, memoryMinPages uint32) vmOpts {
+	memoryMaxPages := p.memoryMaxPages
+	if p.evalMemoryPages > 0 && memoryMinPages+p.evalMemoryPages < memoryMaxPages {
+		memoryMaxPages = memoryMinPages + p.evalMemoryPages
+	}
+
+	return vmOpts{
+		policy:         policy,
+		parsedData:     parsedData,
+		parsedDataAddr: parsedDataAddr,
+		memoryMin:      memoryMinPages,
+		memoryMax:      memoryMaxPages,
+		fuel:           p.fuel,
+		builtins:       p.builtins,
+	}
+}
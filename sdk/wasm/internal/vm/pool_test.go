@@ -5,7 +5,7 @@
 //go:build opa_wasm
 // +build opa_wasm
 
-package wasm_test
+package vm_test
 
 import (
 	"context"
@@ -17,9 +17,9 @@ import (
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/compile"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/internal/wasm"
 	wasm_util "github.com/open-policy-agent/opa/internal/wasm/util"
 	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/sdk/wasm/internal/vm"
 	"github.com/open-policy-agent/opa/topdown/builtins"
 	"github.com/open-policy-agent/opa/topdown/cache"
 	"github.com/open-policy-agent/opa/util"
@@ -165,9 +165,62 @@ func TestPoolCopyParsedDataUpdatePartial(t *testing.T) {
 	}
 }
 
-func ensurePoolResults(t *testing.T, ctx context.Context, testPool *wasm.Pool, poolSize int, input *interface{}, expected string) {
+func TestPoolMinSize(t *testing.T) {
+	ctx := context.Background()
+	module := `package test
+
+	p = data.a
+	`
+
+	policy := compileModule(t, module, "test/p")
+
+	for _, evalMemoryPages := range []uint32{0, 2} {
+		testPool := vm.NewPool(4, 16, 100).
+			WithMinSize(3).
+			WithEvalMemoryLimit(evalMemoryPages)
+
+		if err := testPool.SetPolicyData(ctx, policy, []byte(`{"a": 1}`)); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if testPool.Size() != 3 {
+			t.Fatalf("Expected 3 vms to be initialized, got %d", testPool.Size())
+		}
+
+		ensurePoolResults(t, ctx, testPool, 4, nil, `{{"result":1}}`)
+	}
+}
+
+func TestPoolSetPolicyDataDiscardsAcquiredVMs(t *testing.T) {
+	ctx := context.Background()
+	module := `package test
+
+	p = data.a
+	`
+
+	testPool := initPoolWithData(t, 2, module, "test/p", []byte(`{"a": 1}`))
+
+	acquired, err := testPool.Acquire(ctx, metrics.New())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if err := testPool.SetPolicyData(ctx, testPool.Policy(), []byte(`{"a": 2}`)); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	testPool.Release(acquired, metrics.New())
+
+	ensurePoolResults(t, ctx, testPool, 2, nil, `{{"result":2}}`)
+
+	if testPool.Size() != 2 {
+		t.Fatalf("Expected 2 vms, got %d", testPool.Size())
+	}
+}
+
+func ensurePoolResults(t *testing.T, ctx context.Context, testPool *vm.Pool, poolSize int, input *interface{}, expected string) {
 	t.Helper()
-	var toRelease []*wasm.VM
+	var toRelease []*vm.VM
 	for i := 0; i < poolSize; i++ {
 		vm, err := testPool.Acquire(ctx, metrics.New())
 		if err != nil {
@@ -190,7 +243,7 @@ func ensurePoolResults(t *testing.T, ctx context.Context, testPool *wasm.Pool, p
 	}
 }
 
-func initPoolWithData(t *testing.T, size uint32, module string, entrypoint string, data []byte) *wasm.Pool {
+func compileModule(t *testing.T, module string, entrypoint string) []byte {
 	t.Helper()
 
 	ctx := context.Background()
@@ -214,9 +267,16 @@ func initPoolWithData(t *testing.T, size uint32, module string, entrypoint strin
 		t.Fatalf("Unexpected error: %s", err)
 	}
 
-	testPool := wasm.NewPool(size, 16, 100)
+	return compiler.Bundle().WasmModules[0].Raw
+}
+
+func initPoolWithData(t *testing.T, size uint32, module string, entrypoint string, data []byte) *vm.Pool {
+	t.Helper()
+
+	ctx := context.Background()
+	testPool := vm.NewPool(size, 16, 100)
 
-	err = testPool.SetPolicyData(ctx, compiler.Bundle().WasmModules[0].Raw, data)
+	err := testPool.SetPolicyData(ctx, compileModule(t, module, entrypoint), data)
 	if err != nil {
 		t.Fatalf("Unexpected error: %s", err)
 	}
@@ -2,7 +2,7 @@
 // Use of this source code is governed by an Apache2
 // license that can be found in the LICENSE file.
 
-package wasm
+package vm
 
 import (
 	"bytes"
@@ -17,9 +17,9 @@ import (
 	wasmtime "github.com/bytecodealliance/wasmtime-go/v3"
 
 	"github.com/open-policy-agent/opa/ast"
-	sdk_errors "github.com/open-policy-agent/opa/internal/wasm/sdk/opa/errors"
 	"github.com/open-policy-agent/opa/internal/wasm/util"
 	"github.com/open-policy-agent/opa/metrics"
+	sdk_errors "github.com/open-policy-agent/opa/sdk/wasm/errors"
 	"github.com/open-policy-agent/opa/topdown"
 	"github.com/open-policy-agent/opa/topdown/builtins"
 	"github.com/open-policy-agent/opa/topdown/cache"
@@ -38,6 +38,7 @@ type VM struct {
 	memory               *wasmtime.Memory
 	memoryMin            uint32
 	memoryMax            uint32
+	fuel                 uint64 // Fuel available to an evaluation, 0 means no limit.
 	entrypointIDs        map[string]int32
 	baseHeapPtr          int32
 	dataAddr             int32
@@ -72,13 +73,29 @@ type vmOpts struct {
 	parsedDataAddr int32
 	memoryMin      uint32
 	memoryMax      uint32
+	fuel           uint64
+	builtins       map[string]topdown.BuiltinFunc // Built-in functions overriding the topdown ones.
 }
 
+// setupFuel is the fuel available to the calls into the VM that set up or
+// update the data, if the engine consumes fuel. The runtime stops adding fuel
+// once the total fuel added to the store overflows, hence the fuel is only
+// topped up as much as needed.
+const setupFuel = 1 << 40
+
+// mallocFailed is the message the VM aborts with if it cannot allocate memory.
+const mallocFailed = "opa_malloc: failed"
+
 func newVM(opts vmOpts, engine *wasmtime.Engine) (*VM, error) {
 	ctx := context.Background()
 	v := &VM{engine: engine}
 	store := wasmtime.NewStore(engine)
 	store.SetEpochDeadline(1)
+	if opts.fuel > 0 {
+		if err := store.AddFuel(setupFuel); err != nil {
+			return nil, err
+		}
+	}
 	memorytype := wasmtime.NewMemoryType(opts.memoryMin, true, opts.memoryMax)
 	memory, err := wasmtime.NewMemory(store, memorytype)
 	if err != nil {
@@ -124,6 +141,7 @@ func newVM(opts vmOpts, engine *wasmtime.Engine) (*VM, error) {
 	v.memory = memory
 	v.memoryMin = opts.memoryMin
 	v.memoryMax = opts.memoryMax
+	v.fuel = opts.fuel
 	v.entrypointIDs = make(map[string]int32)
 	v.dataAddr = 0
 	v.eval = func(ctx context.Context, a int32) error { return callVoid(ctx, v, "eval", a) }
@@ -229,7 +247,10 @@ func newVM(opts vmOpts, engine *wasmtime.Engine) (*VM, error) {
 	builtinMap := map[int32]topdown.BuiltinFunc{}
 
 	for name, id := range builtins.(map[string]interface{}) {
-		f := topdown.GetBuiltin(name)
+		f, ok := opts.builtins[name]
+		if !ok {
+			f = topdown.GetBuiltin(name)
+		}
 		if f == nil {
 			return nil, fmt.Errorf("builtin '%s' not found", name)
 		}
@@ -291,6 +312,12 @@ func (i *VM) Eval(ctx context.Context,
 	ndbCache builtins.NDBCache,
 	ph print.Hook,
 	capabilities *ast.Capabilities) ([]byte, error) {
+	if i.fuel > 0 {
+		if err := i.setFuel(i.fuel); err != nil {
+			return nil, err
+		}
+	}
+
 	if i.abiMinorVersion < int32(2) {
 		return i.evalCompat(ctx, entrypoint, input, metrics, seed, ns, iqbCache, ndbCache, ph, capabilities)
 	}
@@ -328,7 +355,7 @@ func (i *VM) Eval(ctx context.Context,
 		if rest > 0 { // need to grow memory
 			_, err := i.memory.Grow(i.store, uint64(util.Pages(uint32(rest))))
 			if err != nil {
-				return nil, fmt.Errorf("input: %w (max pages %d)", err, i.memoryMax)
+				return nil, sdk_errors.New(sdk_errors.MemoryLimitErr, fmt.Sprintf("input: %v (max pages %d)", err, i.memoryMax))
 			}
 		}
 		mem := i.memory.UnsafeData(i.store)
@@ -451,70 +478,6 @@ func (i *VM) evalCompat(ctx context.Context,
 	return data[0:n], nil
 }
 
-// SetPolicyData Will either update the VM's data or, if the policy changed,
-// re-initialize the VM.
-func (i *VM) SetPolicyData(ctx context.Context, opts vmOpts) error {
-
-	if !bytes.Equal(opts.policy, i.policy) {
-		// Swap the instance to a new one, with new policy.
-		n, err := newVM(opts, i.engine)
-		if err != nil {
-			return err
-		}
-
-		*i = *n
-		return nil
-	}
-
-	i.dataAddr = 0
-
-	// Release any stashed heap blocks since they will be above the base heap pointer
-	if err := i.heapStashClear(ctx); err != nil {
-		return err
-	}
-
-	if err := i.setHeapState(ctx, i.baseHeapPtr); err != nil {
-		return err
-	}
-
-	var err error
-	if opts.parsedData != nil {
-		if uint32(i.memory.DataSize(i.store))-uint32(i.baseHeapPtr) < uint32(len(opts.parsedData)) {
-			delta := uint32(len(opts.parsedData)) - (uint32(i.memory.DataSize(i.store)) - uint32(i.baseHeapPtr))
-			_, err := i.memory.Grow(i.store, uint64(util.Pages(delta)))
-			if err != nil {
-				return err
-			}
-		}
-		mem := i.memory.UnsafeData(i.store)
-		len := int32(len(opts.parsedData))
-		copy(mem[i.baseHeapPtr:i.baseHeapPtr+len], opts.parsedData)
-		i.dataAddr = opts.parsedDataAddr
-
-		i.evalHeapPtr = i.baseHeapPtr + len
-		err := i.setHeapState(ctx, i.evalHeapPtr)
-		if err != nil {
-			return err
-		}
-	} else if opts.data != nil {
-		if i.dataAddr, err = i.toRegoJSON(ctx, opts.data, true); err != nil {
-			return err
-		}
-	}
-
-	// Stash any free blocks so that eval()/setHeapState() won't leak them
-	if err := i.heapBlocksStash(ctx); err != nil {
-		return err
-	}
-
-	i.evalHeapPtr, err = i.getHeapState(ctx)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 type abortError struct {
 	message string
 }
@@ -547,6 +510,12 @@ func (i *VM) Entrypoints() map[string]int32 {
 // specified path. If an error occurs the instance is still in a valid state, however
 // the data will not have been modified.
 func (i *VM) SetDataPath(ctx context.Context, path []string, value interface{}) error {
+	if i.fuel > 0 {
+		if err := i.setFuel(setupFuel); err != nil {
+			return err
+		}
+	}
+
 	// Reset the heap ptr before patching the vm to try and keep any
 	// new allocations safe from subsequent heap resets on eval.
 	if err := i.setHeapState(ctx, i.evalHeapPtr); err != nil {
@@ -604,6 +573,12 @@ func (i *VM) SetDataPath(ctx context.Context, path []string, value interface{})
 // specified path. If an error occurs the instance is still in a valid state, however
 // the data will not have been modified.
 func (i *VM) RemoveDataPath(ctx context.Context, path []string) error {
+	if i.fuel > 0 {
+		if err := i.setFuel(setupFuel); err != nil {
+			return err
+		}
+	}
+
 	// Reset the heap ptr before patching the vm to try and keep any
 	// new allocations safe from subsequent heap resets on eval.
 	err := i.setHeapState(ctx, i.evalHeapPtr)
@@ -729,6 +704,32 @@ func (i *VM) setHeapState(ctx context.Context, ptr int32) error {
 	return i.heapPtrSet(ctx, ptr)
 }
 
+// setFuel sets the fuel remaining for the calls into the VM.
+func (i *VM) setFuel(fuel uint64) error {
+	// The store reports an error if it ran out of fuel.
+	remaining, err := i.store.ConsumeFuel(0)
+	if err != nil {
+		remaining = 0
+	}
+
+	if remaining > fuel {
+		_, err = i.store.ConsumeFuel(remaining - fuel)
+		return err
+	}
+
+	return i.store.AddFuel(fuel - remaining)
+}
+
+// outOfFuel returns true if the evaluation has consumed all of its fuel.
+func (i *VM) outOfFuel() bool {
+	if i.fuel == 0 {
+		return false
+	}
+
+	remaining, err := i.store.ConsumeFuel(0)
+	return err != nil || remaining == 0
+}
+
 func (i *VM) cloneDataSegment() (int32, []byte) {
 	// The parsed data values sit between the base heap address and end
 	// at the eval heap pointer address.
@@ -786,7 +787,11 @@ func callOrCancel(ctx context.Context, vm *VM, name string, args ...int32) (inte
 			if e := recover(); e != nil {
 				switch e := e.(type) {
 				case abortError:
-					err = sdk_errors.New(sdk_errors.InternalErr, e.message)
+					if e.message == mallocFailed {
+						err = sdk_errors.New(sdk_errors.MemoryLimitErr, e.message)
+					} else {
+						err = sdk_errors.New(sdk_errors.InternalErr, e.message)
+					}
 				case cancelledError:
 					err = sdk_errors.New(sdk_errors.CancelledErr, e.message)
 				case builtinError:
@@ -806,6 +811,9 @@ func callOrCancel(ctx context.Context, vm *VM, name string, args ...int32) (inte
 			if strings.Contains(t.Message(), "wasm trap: interrupt") {
 				return 0, sdk_errors.New(sdk_errors.CancelledErr, "interrupted")
 			}
+			if vm.outOfFuel() {
+				return 0, sdk_errors.New(sdk_errors.FuelLimitErr, fmt.Sprintf("evaluation used more than %d units of fuel", vm.fuel))
+			}
 			return 0, sdk_errors.New(sdk_errors.InternalErr, getStack(t.Frames(), "trapped"))
 		}
 		return 0, err
@@ -11,9 +11,9 @@ import (
 	"time"
 
 	"github.com/open-policy-agent/opa/bundle"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa/errors"
+	"github.com/open-policy-agent/opa/sdk/wasm/errors"
 
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa"
+	"github.com/open-policy-agent/opa/sdk/wasm"
 )
 
 const (
@@ -44,7 +44,7 @@ type policyData interface {
 
 // New constructs a new file loader periodically reloading the bundle
 // from a file.
-func New(opa *opa.OPA) *Loader {
+func New(opa *wasm.OPA) *Loader {
 	return new(opa)
 }
 
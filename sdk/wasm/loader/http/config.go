@@ -8,7 +8,7 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa/errors"
+	"github.com/open-policy-agent/opa/sdk/wasm/errors"
 )
 
 // WithURL configures the URL to download the bundle from.
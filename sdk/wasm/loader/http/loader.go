@@ -14,8 +14,8 @@ import (
 	"time"
 
 	"github.com/open-policy-agent/opa/bundle"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa/errors"
+	"github.com/open-policy-agent/opa/sdk/wasm"
+	"github.com/open-policy-agent/opa/sdk/wasm/errors"
 )
 
 const (
@@ -57,7 +57,7 @@ type policyData interface {
 
 // New constructs a new HTTP loader periodically downloading a bundle
 // over HTTP.
-func New(o *opa.OPA) *Loader {
+func New(o *wasm.OPA) *Loader {
 	return newLoader(o)
 }
 
@@ -2,7 +2,9 @@
 // Use of this source code is governed by an Apache2
 // license that can be found in the LICENSE file.
 
-package opa
+// Package wasm evaluates Rego policies compiled to WebAssembly, see
+// compile.TargetWasm, in a pool of sandboxed WebAssembly instances.
+package wasm
 
 import (
 	"context"
@@ -13,10 +15,12 @@ import (
 	"time"
 
 	"github.com/open-policy-agent/opa/ast"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/internal/wasm"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa/errors"
-	sdk_errors "github.com/open-policy-agent/opa/internal/wasm/sdk/opa/errors"
+	"github.com/open-policy-agent/opa/internal/wasm/util"
 	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/sdk/wasm/errors"
+	sdk_errors "github.com/open-policy-agent/opa/sdk/wasm/errors"
+	"github.com/open-policy-agent/opa/sdk/wasm/internal/vm"
+	"github.com/open-policy-agent/opa/topdown"
 	"github.com/open-policy-agent/opa/topdown/builtins"
 	"github.com/open-policy-agent/opa/topdown/cache"
 	"github.com/open-policy-agent/opa/topdown/print"
@@ -30,13 +34,21 @@ type OPA struct {
 	memoryMinPages uint32
 	memoryMaxPages uint32 // 0 means no limit.
 	poolSize       uint32
-	pool           *wasm.Pool
+	poolMinSize    uint32
+	evalMemory     uint32 // 0 means no limit.
+	fuel           uint64 // 0 means no limit.
+	builtins       map[string]topdown.BuiltinFunc
+	pool           *vm.Pool
 	mutex          sync.Mutex // To serialize access to SetPolicy, SetData and Close.
 	policy         []byte     // Current policy.
 	data           []byte     // Current data.
 	logError       func(error)
 }
 
+// Builtin is the Go implementation of a built-in function called by the
+// policy. It returns nil if the result of the call is undefined.
+type Builtin func(bctx topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error)
+
 // Result holds the evaluation result.
 type Result struct {
 	Result []byte
@@ -67,7 +79,15 @@ func (o *OPA) Init() (*OPA, error) {
 		return nil, o.configErr
 	}
 
-	o.pool = wasm.NewPool(o.poolSize, o.memoryMinPages, o.memoryMaxPages)
+	if o.poolMinSize > o.poolSize {
+		return nil, errors.New(errors.InvalidConfigErr, "pool minimum size exceeds pool size")
+	}
+
+	o.pool = vm.NewPool(o.poolSize, o.memoryMinPages, o.memoryMaxPages).
+		WithMinSize(o.poolMinSize).
+		WithEvalMemoryLimit(util.Pages(o.evalMemory)).
+		WithFuelLimit(o.fuel).
+		WithBuiltins(o.builtins)
 
 	if len(o.policy) != 0 {
 		if err := o.pool.SetPolicyData(ctx, o.policy, o.data); err != nil {
@@ -111,7 +131,8 @@ func (o *OPA) RemoveDataPath(ctx context.Context, path []string) error {
 	return o.pool.RemoveDataPath(ctx, path)
 }
 
-// SetPolicy updates the policy for the subsequent Eval calls.
+// SetPolicy updates the policy for the subsequent Eval calls. The
+// evaluations in flight complete with the previous policy.
 // Returns either ErrNotReady, ErrInvalidPolicy or ErrInternal if an
 // error occurs.
 func (o *OPA) SetPolicy(ctx context.Context, p []byte) error {
@@ -173,8 +194,9 @@ type EvalOpts struct {
 
 // Eval evaluates the policy with the given input, returning the
 // evaluation results. If no policy was configured at construction
-// time nor set after, the function returns ErrNotReady.  It returns
-// ErrInternal if any other error occurs.
+// time nor set after, the function returns ErrNotReady. It returns
+// ErrMemoryLimit or ErrFuelLimit if the evaluation exceeds the
+// configured limits, and ErrInternal if any other error occurs.
 func (o *OPA) Eval(ctx context.Context, opts EvalOpts) (*Result, error) {
 	if o.pool == nil {
 		return nil, errNotReady
@@ -2,24 +2,25 @@
 // Use of this source code is governed by an Apache2
 // license that can be found in the LICENSE file.
 
+//go:build opa_wasm
 // +build opa_wasm
 
-package opa_test
+package wasm_test
 
 import (
 	"context"
 	"fmt"
 	"testing"
 
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa"
 	"github.com/open-policy-agent/opa/internal/wasm/util"
 	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/sdk/wasm"
 	"github.com/open-policy-agent/opa/util/test"
 )
 
 func BenchmarkWasmRego(b *testing.B) {
 	policy := compileRegoToWasm("a = true", "data.p.a = x", false)
-	instance, _ := opa.New().
+	instance, _ := wasm.New().
 		WithPolicyBytes(policy).
 		WithPoolSize(1).
 		Init()
@@ -31,7 +32,7 @@ func BenchmarkWasmRego(b *testing.B) {
 	var input interface{} = make(map[string]interface{})
 
 	for i := 0; i < b.N; i++ {
-		if _, err := instance.Eval(ctx, opa.EvalOpts{Input: &input}); err != nil {
+		if _, err := instance.Eval(ctx, wasm.EvalOpts{Input: &input}); err != nil {
 			panic(err)
 		}
 	}
@@ -88,13 +89,13 @@ func BenchmarkWASMObjectIteration(b *testing.B) {
 	}
 }
 
-var r *opa.Result
+var r *wasm.Result
 
 func benchmarkIteration(b *testing.B, module string) {
 	query := "data.test.main = x"
 	policy := compileRegoToWasm(module, query, false)
 
-	instance, err := opa.New().
+	instance, err := wasm.New().
 		WithPolicyBytes(policy).
 		WithMemoryLimits(2*util.PageSize, 47*util.PageSize).
 		WithPoolSize(1).
@@ -108,7 +109,7 @@ func benchmarkIteration(b *testing.B, module string) {
 	var input interface{} = make(map[string]interface{})
 
 	for i := 0; i < b.N; i++ {
-		r, err = instance.Eval(ctx, opa.EvalOpts{Input: &input})
+		r, err = instance.Eval(ctx, wasm.EvalOpts{Input: &input})
 		if err != nil {
 			b.Fatalf("Unexpected query error: %v", err)
 		}
@@ -135,7 +136,7 @@ func BenchmarkWASMLargeJSON(b *testing.B) {
 			query := "data.keys[_] = x; data.values = y"
 			policy := compileRegoToWasm("", query, false)
 
-			instance, err := opa.New().
+			instance, err := wasm.New().
 				WithPolicyBytes(policy).
 				WithDataJSON(data).
 				WithMemoryLimits(200*util.PageSize, 600*util.PageSize). // This is rather much
@@ -149,7 +150,7 @@ func BenchmarkWASMLargeJSON(b *testing.B) {
 			var input interface{} = make(map[string]interface{})
 
 			for i := 0; i < b.N; i++ {
-				r, err = instance.Eval(ctx, opa.EvalOpts{Input: &input})
+				r, err = instance.Eval(ctx, wasm.EvalOpts{Input: &input})
 				if err != nil {
 					b.Fatalf("Unexpected query error: %v", err)
 				}
@@ -184,7 +185,7 @@ func runVirtualDocsBenchmark(b *testing.B, numTotalRules, numHitRules int) {
 
 	policy := compileRegoToWasm(module, query, false)
 
-	instance, err := opa.New().
+	instance, err := wasm.New().
 		WithPolicyBytes(policy).
 		WithMemoryLimits(8*util.PageSize, 8*util.PageSize).
 		WithPoolSize(1).
@@ -197,7 +198,7 @@ func runVirtualDocsBenchmark(b *testing.B, numTotalRules, numHitRules int) {
 	var inp interface{} = input
 
 	for i := 0; i < b.N; i++ {
-		r, err = instance.Eval(ctx, opa.EvalOpts{Input: &inp})
+		r, err = instance.Eval(ctx, wasm.EvalOpts{Input: &inp})
 		if err != nil {
 			b.Fatalf("Unexpected query error: %v", err)
 		}
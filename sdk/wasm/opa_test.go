@@ -5,10 +5,11 @@
 //go:build opa_wasm
 // +build opa_wasm
 
-package opa_test
+package wasm_test
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"os"
 	"strings"
@@ -17,9 +18,12 @@ import (
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/bundle"
 	"github.com/open-policy-agent/opa/compile"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa"
 	wasm_util "github.com/open-policy-agent/opa/internal/wasm/util"
 	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/sdk/wasm"
+	"github.com/open-policy-agent/opa/sdk/wasm/errors"
+	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/types"
 	"github.com/open-policy-agent/opa/util"
 )
 
@@ -239,7 +243,7 @@ a = "c" { input > 2 }`,
 			Evals: []Eval{
 				{Input: largeInput},
 			},
-			WantErr: "input: failed to grow memory by `2` (max pages 3)",
+			WantErr: "memory_limit_exceeded: input: failed to grow memory by `2` (max pages 3)",
 		},
 		{
 			Description: "input exceeds available memory, parsing it hits maximum",
@@ -250,7 +254,7 @@ a = "c" { input > 2 }`,
 			Evals: []Eval{
 				{Input: largeInput},
 			},
-			WantErr: "internal_error: opa_malloc: failed",
+			WantErr: "memory_limit_exceeded: opa_malloc: failed",
 		},
 		{
 			Description: "input exceeds available memory, grows successfully",
@@ -273,7 +277,7 @@ a = "c" { input > 2 }`,
 			if len(data) == 0 {
 				data = nil
 			}
-			o := opa.New().
+			o := wasm.New().
 				WithPolicyBytes(policy).
 				WithDataBytes(data).
 				WithPoolSize(1) // Minimal pool size to test pooling.
@@ -310,7 +314,7 @@ a = "c" { input > 2 }`,
 					}
 				}
 
-				r, err := instance.Eval(ctx, opa.EvalOpts{Input: parseJSON(eval.Input)})
+				r, err := instance.Eval(ctx, wasm.EvalOpts{Input: parseJSON(eval.Input)})
 				if err != nil {
 					if test.WantErr == "" { // no error desired
 						t.Fatal(err.Error())
@@ -363,7 +367,7 @@ func TestNamedEntrypoint(t *testing.T) {
 		t.Fatalf("Unexpected error: %s", err)
 	}
 
-	instance, err := opa.New().
+	instance, err := wasm.New().
 		WithPolicyBytes(compiler.Bundle().WasmModules[0].Raw).
 		WithPoolSize(1).
 		Init()
@@ -380,7 +384,7 @@ func TestNamedEntrypoint(t *testing.T) {
 		t.Fatalf("Expected 2 entrypoints, got: %+v", eps)
 	}
 
-	a, err := instance.Eval(ctx, opa.EvalOpts{Entrypoint: eps["test/a"]})
+	a, err := instance.Eval(ctx, wasm.EvalOpts{Entrypoint: eps["test/a"]})
 	if err != nil {
 		t.Fatalf("Unexpected error: %s", err)
 	}
@@ -391,7 +395,7 @@ func TestNamedEntrypoint(t *testing.T) {
 		t.Fatalf("Expected result for 'test/a' to be %s, got: %s", exp, actual)
 	}
 
-	b, err := instance.Eval(ctx, opa.EvalOpts{Entrypoint: eps["test/b"]})
+	b, err := instance.Eval(ctx, wasm.EvalOpts{Entrypoint: eps["test/b"]})
 	if err != nil {
 		t.Fatalf("Unexpected error: %s", err)
 	}
@@ -402,6 +406,231 @@ func TestNamedEntrypoint(t *testing.T) {
 	}
 }
 
+func TestEvalMemoryLimit(t *testing.T) {
+	ctx := context.Background()
+	policy := compileRegoToWasm(`a = count([x | x := numbers.range(1, input)[_]])`, "data.p.a = x", dump)
+
+	instance, err := wasm.New().
+		WithPolicyBytes(policy).
+		WithPoolSize(1).
+		WithEvalMemoryLimit(4 * wasm_util.PageSize).
+		Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer instance.Close()
+
+	_, err = instance.Eval(ctx, wasm.EvalOpts{Input: parseJSON("100000")})
+	if !errors.IsMemoryLimit(err) {
+		t.Fatalf("expected memory limit error, got %v", err)
+	}
+
+	// The instance is still usable after exceeding the limit.
+	r, err := instance.Eval(ctx, wasm.EvalOpts{Input: parseJSON("10")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp, act := ast.MustParseTerm(`{{"x": 10}}`), ast.MustParseTerm(string(r.Result)); !exp.Equal(act) {
+		t.Fatalf("expected %v, got %v", exp, act)
+	}
+}
+
+func TestFuelLimit(t *testing.T) {
+	ctx := context.Background()
+	policy := compileRegoToWasm(`a = count([x | x := numbers.range(1, input)[_]])`, "data.p.a = x", dump)
+
+	instance, err := wasm.New().
+		WithPolicyBytes(policy).
+		WithPoolSize(1).
+		WithFuelLimit(1000000).
+		Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer instance.Close()
+
+	_, err = instance.Eval(ctx, wasm.EvalOpts{Input: parseJSON("100000")})
+	if !errors.IsFuelLimit(err) {
+		t.Fatalf("expected fuel limit error, got %v", err)
+	}
+
+	// Each evaluation gets the full fuel limit.
+	for i := 0; i < 3; i++ {
+		r, err := instance.Eval(ctx, wasm.EvalOpts{Input: parseJSON("10")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if exp, act := ast.MustParseTerm(`{{"x": 10}}`), ast.MustParseTerm(string(r.Result)); !exp.Equal(act) {
+			t.Fatalf("expected %v, got %v", exp, act)
+		}
+	}
+}
+
+func TestLimitsConfig(t *testing.T) {
+	tests := []struct {
+		note string
+		opa  *wasm.OPA
+	}{
+		{
+			note: "zero eval memory limit",
+			opa:  wasm.New().WithEvalMemoryLimit(0),
+		},
+		{
+			note: "zero fuel limit",
+			opa:  wasm.New().WithFuelLimit(0),
+		},
+		{
+			note: "pool min size exceeds pool size",
+			opa:  wasm.New().WithPoolSize(2).WithPoolMinSize(3),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := tc.opa.Init()
+			if !stderrors.Is(err, &errors.Error{Code: errors.InvalidConfigErr}) {
+				t.Fatalf("expected invalid config error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	ctx := context.Background()
+
+	decl := &rego.Function{
+		Name: "custom.double",
+		Decl: types.NewFunction(types.Args(types.N), types.N),
+	}
+
+	cr, err := rego.New(
+		rego.Query("data.p.a = x"),
+		rego.Module("module.rego", `package p
+a = custom.double(input)`),
+		rego.Function1(decl, func(rego.BuiltinContext, *ast.Term) (*ast.Term, error) {
+			return nil, nil
+		}),
+	).Compile(ctx, rego.CompilePartial(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = wasm.New().WithPolicyBytes(cr.Bytes).Init()
+	if !stderrors.Is(err, &errors.Error{Code: errors.InvalidPolicyOrDataErr}) {
+		t.Fatalf("expected invalid policy error for unknown builtin, got %v", err)
+	}
+
+	instance, err := wasm.New().
+		WithPolicyBytes(cr.Bytes).
+		WithBuiltin("custom.double", func(_ topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error) {
+			n, ok := operands[0].Value.(ast.Number)
+			if !ok {
+				return nil, nil
+			}
+			x, _ := n.Int()
+			return ast.IntNumberTerm(2 * x), nil
+		}).
+		Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer instance.Close()
+
+	for _, tc := range []struct {
+		input  string
+		result string
+	}{
+		{input: "21", result: `{{"x": 42}}`},
+		{input: `"foo"`, result: `set()`},
+	} {
+		r, err := instance.Eval(ctx, wasm.EvalOpts{Input: parseJSON(tc.input)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if exp, act := ast.MustParseTerm(tc.result), ast.MustParseTerm(string(r.Result)); !exp.Equal(act) {
+			t.Fatalf("expected %v, got %v", exp, act)
+		}
+	}
+}
+
+func TestSetPolicyDuringEval(t *testing.T) {
+	ctx := context.Background()
+
+	decl := &rego.Function{
+		Name: "custom.wait",
+		Decl: types.NewFunction(types.Args(types.A), types.A),
+	}
+
+	compile := func(module string) []byte {
+		cr, err := rego.New(
+			rego.Query("data.p.a = x"),
+			rego.Module("module.rego", module),
+			rego.Function1(decl, func(_ rego.BuiltinContext, a *ast.Term) (*ast.Term, error) {
+				return a, nil
+			}),
+		).Compile(ctx, rego.CompilePartial(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cr.Bytes
+	}
+
+	started, unblock := make(chan struct{}), make(chan struct{})
+
+	instance, err := wasm.New().
+		WithPolicyBytes(compile(`package p
+a = custom.wait("old")`)).
+		WithPoolSize(2).
+		WithBuiltin("custom.wait", func(_ topdown.BuiltinContext, operands []*ast.Term) (*ast.Term, error) {
+			close(started)
+			<-unblock
+			return operands[0], nil
+		}).
+		Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer instance.Close()
+
+	done := make(chan *wasm.Result)
+	go func() {
+		r, err := instance.Eval(ctx, wasm.EvalOpts{})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- r
+	}()
+
+	<-started
+
+	// The policy is replaced without waiting for the evaluation in flight.
+	if err := instance.SetPolicy(ctx, compile(`package p
+a = "new"`)); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := instance.Eval(ctx, wasm.EvalOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp, act := ast.MustParseTerm(`{{"x": "new"}}`), ast.MustParseTerm(string(r.Result)); !exp.Equal(act) {
+		t.Fatalf("expected %v, got %v", exp, act)
+	}
+
+	close(unblock)
+
+	// The evaluation in flight completes with the previous policy.
+	if r := <-done; r != nil {
+		if exp, act := ast.MustParseTerm(`{{"x": "old"}}`), ast.MustParseTerm(string(r.Result)); !exp.Equal(act) {
+			t.Fatalf("expected %v, got %v", exp, act)
+		}
+	}
+}
+
 // compileRegoToWasm is shared with the benchmarking functions in opa_bench_test.go;
 // those function use helpers shared with topdown_bench_test.go, and they all use
 // `package test` -- whereas the callers in this file don't provide the package at
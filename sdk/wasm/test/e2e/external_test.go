@@ -20,8 +20,8 @@ import (
 	"time"
 
 	"github.com/open-policy-agent/opa/ast"
-	"github.com/open-policy-agent/opa/internal/wasm/sdk/opa"
 	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/sdk/wasm"
 	"github.com/open-policy-agent/opa/test/cases"
 	"github.com/open-policy-agent/opa/types"
 	"github.com/open-policy-agent/opa/util"
@@ -78,7 +78,7 @@ func TestWasmE2E(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			o := opa.New().WithPolicyBytes(cr.Bytes)
+			o := wasm.New().WithPolicyBytes(cr.Bytes)
 			if tc.Data != nil {
 				o = o.WithDataJSON(tc.Data)
 			}
@@ -96,7 +96,7 @@ func TestWasmE2E(t *testing.T) {
 				input = tc.Input
 			}
 
-			result, err := o.Eval(ctx, opa.EvalOpts{Input: input})
+			result, err := o.Eval(ctx, wasm.EvalOpts{Input: input})
 			assert(t, tc, result, err)
 		})
 	}
@@ -111,7 +111,7 @@ func shouldSkip(t *testing.T, tc cases.TestCase) bool {
 	return false
 }
 
-func assert(t *testing.T, tc cases.TestCase, result *opa.Result, err error) {
+func assert(t *testing.T, tc cases.TestCase, result *wasm.Result, err error) {
 	t.Helper()
 	if tc.WantDefined != nil {
 		if err != nil {
@@ -154,7 +154,7 @@ func (x defined) String() string {
 	return "undefined"
 }
 
-func assertDefined(t *testing.T, want defined, result *opa.Result) {
+func assertDefined(t *testing.T, want defined, result *wasm.Result) {
 	t.Helper()
 	var rs []interface{}
 	if err := util.NewJSONDecoder(bytes.NewReader(result.Result)).Decode(&rs); err != nil {
@@ -166,14 +166,14 @@ func assertDefined(t *testing.T, want defined, result *opa.Result) {
 	}
 }
 
-func assertEmptyResultSet(t *testing.T, result *opa.Result) {
+func assertEmptyResultSet(t *testing.T, result *wasm.Result) {
 	if result == nil {
 		t.Fatal("unexpected nil result")
 	}
 	assertResultSet(t, []map[string]interface{}{}, false, result)
 }
 
-func assertResultSet(t *testing.T, want []map[string]interface{}, sortBindings bool, result *opa.Result) {
+func assertResultSet(t *testing.T, want []map[string]interface{}, sortBindings bool, result *wasm.Result) {
 	t.Helper()
 
 	exp := ast.NewSet()
@@ -6,6 +6,7 @@
 package authorizer
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"net/http"
@@ -182,6 +183,10 @@ func makeInput(r *http.Request) (*http.Request, interface{}, error) {
 			if err := util.Unmarshal(rawBody, &body); err != nil {
 				return r, nil, err
 			}
+		} else if expectNDJSON(r) {
+			if body, err = unmarshalNDJSON(rawBody); err != nil {
+				return r, nil, err
+			}
 		} else if err := util.UnmarshalJSON(rawBody, &body); err != nil {
 			return r, nil, err
 		}
@@ -219,6 +224,9 @@ func expectBody(method string, path []interface{}) bool {
 		} else if len(path) >= 2 {
 			s1 := path[0].(string)
 			s2 := path[1].(string)
+			if s1 == "v1" && s2 == "batch" {
+				return len(path) >= 3 && path[2].(string) == "data"
+			}
 			return dataAPIVersions[s1] && s2 == "data"
 		}
 	}
@@ -232,6 +240,26 @@ func expectYAML(r *http.Request) bool {
 	return strings.Contains(r.Header.Get("Content-Type"), "yaml")
 }
 
+func expectNDJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Content-Type"), "ndjson")
+}
+
+// unmarshalNDJSON decodes a stream of newline-delimited JSON values into an
+// array so that batch requests are exposed to the policy like JSON arrays.
+func unmarshalNDJSON(bs []byte) (interface{}, error) {
+	result := []interface{}{}
+	dec := util.NewJSONDecoder(bytes.NewReader(bs))
+	for {
+		var x interface{}
+		if err := dec.Decode(&x); err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+		result = append(result, x)
+	}
+}
+
 func readBody(r *http.Request) ([]byte, error) {
 
 	bs, err := io.ReadAll(r.Body)
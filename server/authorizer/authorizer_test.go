@@ -344,6 +344,7 @@ func TestMakeInputWithBody(t *testing.T) {
 		path                   string
 		headers                map[string]string
 		body                   string
+		expBody                string
 		useYAML                bool
 		assertBodyExists       bool
 		assertBodyDoesNotExist bool
@@ -373,6 +374,20 @@ func TestMakeInputWithBody(t *testing.T) {
 			body:             `{"foo": "bar"}`,
 			assertBodyExists: true,
 		},
+		{
+			method:           "POST",
+			path:             "/v1/batch/data",
+			body:             `[{"id": "a", "input": {"foo": "bar"}}]`,
+			assertBodyExists: true,
+		},
+		{
+			method:           "POST",
+			path:             "/v1/batch/data/test",
+			headers:          map[string]string{"Content-Type": "application/x-ndjson"},
+			body:             "{\"id\": \"a\"}\n{\"id\": \"b\"}\n",
+			expBody:          `[{"id": "a"}, {"id": "b"}]`,
+			assertBodyExists: true,
+		},
 		{
 			method:                 "PUT",
 			path:                   "/v1/data",
@@ -411,6 +426,10 @@ func TestMakeInputWithBody(t *testing.T) {
 				req.Header.Set("Content-Type", "application/x-yaml")
 			}
 
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
 			req, input, err := makeInput(req)
 			if err != nil {
 				t.Fatal(err)
@@ -424,6 +443,8 @@ func TestMakeInputWithBody(t *testing.T) {
 					if err := util.Unmarshal([]byte(tc.body), &want); err != nil {
 						t.Fatal(err)
 					}
+				} else if tc.expBody != "" {
+					want = util.MustUnmarshalJSON([]byte(tc.expBody))
 				} else {
 					want = util.MustUnmarshalJSON([]byte(tc.body))
 				}
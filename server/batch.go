@@ -0,0 +1,320 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/logging"
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/server/authorizer"
+	"github.com/open-policy-agent/opa/server/types"
+	"github.com/open-policy-agent/opa/server/writer"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// v1BatchDataPost evaluates the document at the request path once for every
+// input in the request body. All inputs are evaluated against the same
+// prepared query inside a single read transaction. Results are streamed back
+// as newline-delimited JSON in request order; every item carries its own
+// decision ID and produces its own decision log event.
+func (s *Server) v1BatchDataPost(w http.ResponseWriter, r *http.Request) {
+	m := metrics.New()
+	m.Timer(metrics.ServerHandler).Start()
+	defer m.Timer(metrics.ServerHandler).Stop()
+
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	urlPath := vars["path"]
+	includeInstrumentation := getBoolParam(r.URL, types.ParamInstrumentV1, true)
+	partial := getBoolParam(r.URL, types.ParamPartialV1, true)
+	strictBuiltinErrors := getBoolParam(r.URL, types.ParamStrictBuiltinErrors, true)
+
+	next, err := readBatchInputsV1(r)
+	if err != nil {
+		writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, err)
+		return
+	}
+
+	txn, err := s.store.NewTransaction(ctx, storage.TransactionParams{Context: storage.NewContext().WithMetrics(m)})
+	if err != nil {
+		writer.ErrorAuto(w, err)
+		return
+	}
+
+	defer s.store.Abort(ctx, txn)
+
+	br, err := getRevisions(ctx, s.store, txn)
+	if err != nil {
+		writer.ErrorAuto(w, err)
+		return
+	}
+
+	preparedQuery, err := s.getPreparedDataQuery(ctx, partial, strictBuiltinErrors, txn, nil, urlPath, m, includeInstrumentation, nil)
+	if err != nil {
+		writer.ErrorAuto(w, err)
+		return
+	}
+
+	logger := s.getDecisionLogger(br)
+
+	w.Header().Add("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	for i := 0; ; i++ {
+		item, err := next()
+		if err == io.EOF {
+			return
+		}
+
+		var result types.BatchDataResponseItemV1
+		if err != nil {
+			// The rest of the stream cannot be decoded reliably, so report the
+			// error against the current position and stop.
+			result.ID = strconv.Itoa(i)
+			result.Error = types.NewErrorV1(types.CodeInvalidParameter, "%v", err)
+		} else {
+			if item.ID == "" {
+				item.ID = strconv.Itoa(i)
+			}
+			result = s.evalBatchItem(ctx, r, txn, preparedQuery, logger, urlPath, item, includeInstrumentation)
+		}
+
+		if encErr := enc.Encode(result); encErr != nil || err != nil {
+			return
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) evalBatchItem(ctx context.Context, r *http.Request, txn storage.Transaction, preparedQuery *rego.PreparedEvalQuery, logger decisionLogger, urlPath string, item *types.BatchDataRequestItemV1, includeInstrumentation bool) types.BatchDataResponseItemV1 {
+	m := metrics.New()
+	m.Timer(metrics.ServerHandler).Start()
+
+	decisionID := s.generateDecisionID()
+	ctx = logging.WithDecisionID(ctx, decisionID)
+	annotateSpan(ctx, decisionID)
+
+	result := types.BatchDataResponseItemV1{
+		ID:         item.ID,
+		DecisionID: decisionID,
+	}
+
+	var ndbCache builtins.NDBCache
+	if s.ndbCacheEnabled || s.shadow() != nil {
+		ndbCache = builtins.NDBCache{}
+	}
+
+	m.Timer(metrics.RegoInputParse).Start()
+
+	var input ast.Value
+	if item.Input != nil {
+		var err error
+		input, err = ast.InterfaceToValue(*item.Input)
+		if err != nil {
+			m.Timer(metrics.RegoInputParse).Stop()
+			m.Timer(metrics.ServerHandler).Stop()
+			_ = logger.Log(ctx, txn, urlPath, "", item.Input, nil, nil, ndbCache, err, m)
+			result.Error = types.NewErrorV1(types.CodeInvalidParameter, "could not parse input: %v", err)
+			return result
+		}
+	} else {
+		result.Warning = types.NewWarning(types.CodeAPIUsageWarn, types.MsgInputKeyMissing)
+	}
+
+	m.Timer(metrics.RegoInputParse).Stop()
+
+	rs, err := preparedQuery.Eval(
+		ctx,
+		rego.EvalTransaction(txn),
+		rego.EvalParsedInput(input),
+		rego.EvalMetrics(m),
+		rego.EvalInterQueryBuiltinCache(s.interQueryBuiltinCache),
+		rego.EvalInstrument(includeInstrumentation),
+		rego.EvalNDBuiltinCache(ndbCache),
+	)
+
+	m.Timer(metrics.ServerHandler).Stop()
+
+	s.evalShadow(ctx, shadowDecision{
+		logger:              logger,
+		path:                urlPath,
+		strictBuiltinErrors: getBoolParam(r.URL, types.ParamStrictBuiltinErrors, true),
+		input:               input,
+		goInput:             item.Input,
+		result:              firstResult(rs),
+		err:                 err,
+		ndbCache:            ndbCache,
+	})
+
+	if includeMetrics(r) || includeInstrumentation {
+		result.Metrics = m.All()
+	}
+
+	if err != nil {
+		_ = logger.Log(ctx, txn, urlPath, "", item.Input, input, nil, ndbCache, err, m)
+		_, result.Error = writer.AutoErrorV1(err)
+		return result
+	}
+
+	if len(rs) > 0 {
+		result.Result = &rs[0].Expressions[0].Value
+	}
+
+	if err := logger.Log(ctx, txn, urlPath, "", item.Input, input, result.Result, ndbCache, nil, m); err != nil {
+		// Do not return results that could not be logged.
+		result.Result = nil
+		_, result.Error = writer.AutoErrorV1(err)
+	}
+
+	return result
+}
+
+// readBatchInputsV1 returns a function that yields the items of a Batch Data
+// API request one at a time. The function returns io.EOF once all items have
+// been read. The request body is read completely before readBatchInputsV1
+// returns: the HTTP/1.x server closes the request body once the response is
+// flushed, so items cannot be read while results are streamed. An error
+// decoding an item is returned after the items that precede it.
+func readBatchInputsV1(r *http.Request) (func() (*types.BatchDataRequestItemV1, error), error) {
+
+	next, err := decodeBatchInputsV1(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*types.BatchDataRequestItemV1
+	var itemErr error
+
+	for {
+		item, err := next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			itemErr = err
+			break
+		}
+		items = append(items, item)
+	}
+
+	var i int
+	return func() (*types.BatchDataRequestItemV1, error) {
+		if i < len(items) {
+			i++
+			return items[i-1], nil
+		}
+		if itemErr != nil {
+			err := itemErr
+			itemErr = nil
+			return nil, err
+		}
+		return nil, io.EOF
+	}, nil
+}
+
+// decodeBatchInputsV1 returns a function that decodes the items of a Batch
+// Data API request one at a time. If the authorizer already parsed the body,
+// the items are taken from the parsed value instead of the request body.
+func decodeBatchInputsV1(r *http.Request) (func() (*types.BatchDataRequestItemV1, error), error) {
+
+	if parsed, ok := authorizer.GetBodyOnContext(r.Context()); ok {
+		items, ok := parsed.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("body must contain an array or a stream of input items")
+		}
+		var i int
+		return func() (*types.BatchDataRequestItemV1, error) {
+			if i >= len(items) {
+				return nil, io.EOF
+			}
+			obj, ok := items[i].(map[string]interface{})
+			i++
+			if !ok {
+				return nil, fmt.Errorf("body contains malformed input item: expected object")
+			}
+			var item types.BatchDataRequestItemV1
+			if id, ok := obj["id"]; ok {
+				if item.ID, ok = id.(string); !ok {
+					return nil, fmt.Errorf("body contains malformed input item: id must be a string")
+				}
+			}
+			if input, ok := obj["input"]; ok {
+				item.Input = &input
+			}
+			return &item, nil
+		}, nil
+	}
+
+	body, err := readPlainBody(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress the body: %w", err)
+	}
+
+	buf := bufio.NewReader(body)
+	isArray, err := peekJSONArray(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := util.NewJSONDecoder(buf)
+
+	if isArray {
+		if _, err := dec.Token(); err != nil {
+			return nil, fmt.Errorf("body contains malformed input items: %w", err)
+		}
+	}
+
+	return func() (*types.BatchDataRequestItemV1, error) {
+		if isArray && !dec.More() {
+			return nil, io.EOF
+		}
+		var item types.BatchDataRequestItemV1
+		if err := dec.Decode(&item); err != nil {
+			if err == io.EOF && !isArray {
+				return nil, err
+			}
+			return nil, fmt.Errorf("body contains malformed input item: %w", err)
+		}
+		return &item, nil
+	}, nil
+}
+
+// peekJSONArray reports whether the next non-whitespace byte in buf opens a
+// JSON array. An empty body is treated as an empty stream.
+func peekJSONArray(buf *bufio.Reader) (bool, error) {
+	for {
+		b, err := buf.Peek(1)
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b[0])) {
+			return b[0] == '[', nil
+		}
+		if _, err := buf.Discard(1); err != nil {
+			return false, err
+		}
+	}
+}
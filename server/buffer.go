@@ -34,6 +34,15 @@ type Info struct {
 	Metrics        metrics.Metrics
 	Trace          []*topdown.Event
 	RequestID      uint64
+	Shadow         *ShadowInfo // set if the shadow evaluation of the decision diverged
+}
+
+// ShadowInfo contains the outcome of evaluating a decision against the shadow
+// bundles.
+type ShadowInfo struct {
+	Bundles map[string]BundleInfo
+	Results *interface{}
+	Error   error
 }
 
 // BundleInfo contains information describing a bundle.
@@ -101,13 +101,18 @@ func (w *compressResponseWriter) Write(bytes []byte) (int, error) {
 }
 
 func (w *compressResponseWriter) Flush() {
-	if w.isGzipInitialized() {
-		w.gzipWriter.Flush()
-		flusher, canFlush := w.ResponseWriter.(http.Flusher)
-		if canFlush {
-			flusher.Flush()
+	if !w.isGzipInitialized() {
+		// Flushing indicates a streaming response, which cannot be held back
+		// until the threshold is reached, so compression starts right away.
+		if err := w.doCompressedResponse(); err != nil {
+			return
 		}
 	}
+	w.gzipWriter.Flush()
+	flusher, canFlush := w.ResponseWriter.(http.Flusher)
+	if canFlush {
+		flusher.Flush()
+	}
 }
 
 func (w *compressResponseWriter) Close() error {
@@ -130,14 +135,15 @@ func (w *compressResponseWriter) doCompressedResponse() error {
 	w.ResponseWriter.Header().Set(contentEncodingHeader, gzipEncodingValue)
 	w.Header().Del(contentLengthHeader)
 	w.writeHeader()
-	// there's nothing to write
-	if w.buffer == nil || len(w.buffer) <= 0 {
-		return nil
-	}
 	gzipWriter := gzipPool.Get().(*gzip.Writer)
 	gzipWriter.Reset(w.ResponseWriter)
 	w.gzipWriter = gzipWriter
+	// there's nothing to write
+	if len(w.buffer) == 0 {
+		return nil
+	}
 	_, err := w.gzipWriter.Write(w.buffer)
+	w.buffer = nil
 	return err
 }
 
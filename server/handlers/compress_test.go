@@ -152,6 +152,35 @@ func TestHandlerOnEndpointsWithoutCompression(t *testing.T) {
 	}
 }
 
+func TestCompressHandlerFlushesStreamingResponses(t *testing.T) {
+	w := httptest.NewRecorder()
+	CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := 0; i < 2; i++ {
+			if _, err := io.WriteString(w, requestBody); err != nil {
+				log.Fatalf("Error writing the request body: %v", err)
+			}
+			w.(http.Flusher).Flush()
+		}
+	}), 1024, defaultCompressionLevel).ServeHTTP(w, &http.Request{
+		URL:    &url.URL{Path: "/v1/data"},
+		Method: "GET",
+		Header: http.Header{
+			"Accept-Encoding": []string{gzipEncoding},
+		},
+	})
+
+	if !w.Flushed {
+		t.Fatal("expected response to be flushed")
+	}
+	if w.Result().Header.Get("Content-Encoding") != gzipEncoding {
+		t.Fatal("expected streaming response to be compressed")
+	}
+	if body := unzip(w.Body.Bytes()); body != requestBody+requestBody {
+		t.Fatalf("wrong body, got %v", body)
+	}
+}
+
 func zipString(input string) []byte {
 	var b bytes.Buffer
 	gz := gzip.NewWriter(&b)
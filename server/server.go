@@ -26,6 +26,7 @@ import (
 	"time"
 
 	serverEncodingPlugin "github.com/open-policy-agent/opa/plugins/server/encoding"
+	serverShadowPlugin "github.com/open-policy-agent/opa/plugins/server/shadow"
 
 	"github.com/gorilla/mux"
 	"go.opentelemetry.io/otel/attribute"
@@ -54,6 +55,7 @@ import (
 	iCache "github.com/open-policy-agent/opa/topdown/cache"
 	"github.com/open-policy-agent/opa/topdown/lineage"
 	"github.com/open-policy-agent/opa/tracing"
+	"github.com/open-policy-agent/opa/translate"
 	"github.com/open-policy-agent/opa/util"
 	"github.com/open-policy-agent/opa/version"
 )
@@ -87,6 +89,7 @@ const defaultMinTLSVersion = tls.VersionTLS12
 const (
 	PromHandlerV0Data     = "v0/data"
 	PromHandlerV1Data     = "v1/data"
+	PromHandlerV1Batch    = "v1/batch/data"
 	PromHandlerV1Query    = "v1/query"
 	PromHandlerV1Policies = "v1/policies"
 	PromHandlerV1Compile  = "v1/compile"
@@ -144,6 +147,8 @@ type Server struct {
 	distributedTracingOpts tracing.Options
 	ndbCacheEnabled        bool
 	unixSocketPerm         *string
+	watcher                *dataWatcher
+	shadowEvaluator        *shadowEvaluator
 }
 
 // Metrics defines the interface that the server requires for recording HTTP
@@ -182,6 +187,13 @@ func (s *Server) Init(ctx context.Context) (*Server, error) {
 		return nil, err
 	}
 
+	// Register a trigger to stream data changes to Data API watches.
+	s.watcher = newDataWatcher()
+	if _, err := s.store.Register(ctx, txn, storage.TriggerConfig{OnCommit: s.watcher.onCommit}); err != nil {
+		s.store.Abort(ctx, txn)
+		return nil, err
+	}
+
 	s.partials = map[string]rego.PartialResult{}
 	s.preparedEvalQueries = newCache(pqMaxCacheSize)
 	s.defaultDecisionPath = s.generateDefaultDecisionPath()
@@ -194,6 +206,10 @@ func (s *Server) Init(ctx context.Context) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	if err := s.initShadow(); err != nil {
+		return nil, err
+	}
 	s.DiagnosticHandler = s.initHandlerAuthn(s.DiagnosticHandler)
 
 	return s, s.store.Commit(ctx, txn)
@@ -203,6 +219,10 @@ func (s *Server) Init(ctx context.Context) (*Server, error) {
 // currently in use by the OPA Server. If any exceed the deadline specified
 // by the context an error will be returned.
 func (s *Server) Shutdown(ctx context.Context) error {
+	// Watches never become idle, so they are closed first.
+	if s.watcher != nil {
+		s.watcher.close()
+	}
 	errChan := make(chan error)
 	for _, srvr := range s.httpListeners {
 		go func(s httpListener) {
@@ -218,6 +238,14 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// Shadow evaluations outlive the requests that started them, wait for
+	// them so that they do not log decisions after the logs plugin stopped.
+	if s.shadowEvaluator != nil {
+		if err := s.shadowEvaluator.wait(ctx); err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+
 	if len(errorList) > 0 {
 		errMsg := "error while shutting down: "
 		for i, err := range errorList {
@@ -706,6 +734,22 @@ func (s *Server) initHandlerCompression(handler http.Handler) (http.Handler, err
 	return compressHandler, nil
 }
 
+func (s *Server) initShadow() error {
+	var shadowRawConfig json.RawMessage
+	serverConfig := s.manager.Config.Server
+	if serverConfig != nil {
+		shadowRawConfig = serverConfig.Shadow
+	}
+	shadowConfig, err := serverShadowPlugin.NewConfigBuilder().WithBytes(shadowRawConfig).Parse()
+	if err != nil {
+		return err
+	}
+	if !shadowConfig.Disabled {
+		s.shadowEvaluator = newShadowEvaluator(shadowConfig, s.manager.PrometheusRegister(), s.manager.Logger())
+	}
+	return nil
+}
+
 func (s *Server) initRouters() {
 	mainRouter := s.router
 	if mainRouter == nil {
@@ -767,6 +811,8 @@ func (s *Server) initRouters() {
 	mainRouter.Handle("/v1/data", s.instrumentHandler(s.v1DataPatch, PromHandlerV1Data)).Methods(http.MethodPatch)
 	mainRouter.Handle("/v1/data/{path:.+}", s.instrumentHandler(s.v1DataPost, PromHandlerV1Data)).Methods(http.MethodPost)
 	mainRouter.Handle("/v1/data", s.instrumentHandler(s.v1DataPost, PromHandlerV1Data)).Methods(http.MethodPost)
+	mainRouter.Handle("/v1/batch/data/{path:.+}", s.instrumentHandler(s.v1BatchDataPost, PromHandlerV1Batch)).Methods(http.MethodPost)
+	mainRouter.Handle("/v1/batch/data", s.instrumentHandler(s.v1BatchDataPost, PromHandlerV1Batch)).Methods(http.MethodPost)
 	mainRouter.Handle("/v1/policies", s.instrumentHandler(s.v1PoliciesList, PromHandlerV1Policies)).Methods(http.MethodGet)
 	mainRouter.Handle("/v1/policies/{path:.+}", s.instrumentHandler(s.v1PoliciesDelete, PromHandlerV1Policies)).Methods(http.MethodDelete)
 	mainRouter.Handle("/v1/policies/{path:.+}", s.instrumentHandler(s.v1PoliciesGet, PromHandlerV1Policies)).Methods(http.MethodGet)
@@ -1098,6 +1144,49 @@ func (s *Server) v0QueryPath(w http.ResponseWriter, r *http.Request, urlPath str
 	writer.JSONOK(w, rs[0].Expressions[0].Value, pretty(r))
 }
 
+// getPreparedDataQuery returns the prepared query for the Data API document at
+// urlPath, preparing and caching it if necessary.
+func (s *Server) getPreparedDataQuery(ctx context.Context, partial, strictBuiltinErrors bool, txn storage.Transaction, input ast.Value, urlPath string, m metrics.Metrics, includeInstrumentation bool, tracer topdown.QueryTracer) (*rego.PreparedEvalQuery, error) {
+	pqID := "v1DataPost::"
+	if partial {
+		pqID += "partial::"
+	}
+	if strictBuiltinErrors {
+		pqID += "strict-builtin-errors::"
+	}
+	pqID += urlPath
+	preparedQuery, ok := s.getCachedPreparedEvalQuery(pqID, m)
+	if ok {
+		return preparedQuery, nil
+	}
+
+	opts := []func(*rego.Rego){
+		rego.Compiler(s.getCompiler()),
+		rego.Store(s.store),
+	}
+
+	// Set resolvers on the base Rego object to avoid having them get
+	// re-initialized, and to propagate them to the prepared query.
+	for _, r := range s.manager.GetWasmResolvers() {
+		for _, entrypoint := range r.Entrypoints() {
+			opts = append(opts, rego.Resolver(entrypoint, r))
+		}
+	}
+
+	rego, err := s.makeRego(ctx, partial, strictBuiltinErrors, txn, input, urlPath, m, includeInstrumentation, tracer, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pq, err := rego.PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	preparedQuery = &pq
+	s.preparedEvalQueries.Insert(pqID, preparedQuery)
+	return preparedQuery, nil
+}
+
 func (s *Server) getCachedPreparedEvalQuery(key string, m metrics.Metrics) (*rego.PreparedEvalQuery, bool) {
 	pq, ok := s.preparedEvalQueries.Get(key)
 	m.Counter(metrics.ServerQueryCacheHit) // Creates the counter on the metrics if it doesn't exist, starts at 0
@@ -1323,7 +1412,7 @@ func (s *Server) v1CompilePost(w http.ResponseWriter, r *http.Request) {
 		buf = topdown.NewBufferTracer()
 	}
 
-	eval := rego.New(
+	opts := []func(*rego.Rego){
 		rego.Compiler(s.getCompiler()),
 		rego.Store(s.store),
 		rego.Transaction(txn),
@@ -1338,19 +1427,52 @@ func (s *Server) v1CompilePost(w http.ResponseWriter, r *http.Request) {
 		rego.UnsafeBuiltins(unsafeBuiltinsMap),
 		rego.InterQueryBuiltinCache(s.interQueryBuiltinCache),
 		rego.PrintHook(s.manager.PrintHook()),
-	)
+	}
+
+	// In validation mode, partial evaluation is restricted to the subset of
+	// Rego that can be translated into the target.
+	if request.Options.Validate {
+		opts = append(opts, translate.Restrict(request.Options.Target))
+	}
+
+	eval := rego.New(opts...)
 
 	pq, err := eval.Partial(ctx)
 	if err != nil {
 		switch err := err.(type) {
 		case ast.Errors:
-			writer.Error(w, http.StatusBadRequest, types.NewErrorV1(types.CodeInvalidParameter, types.MsgCompileModuleError).WithASTErrors(err))
+			msg := types.MsgCompileModuleError
+			if len(err) > 0 && err[0].Code == translate.TranslationErr {
+				msg = types.MsgTranslationError
+			}
+			writer.Error(w, http.StatusBadRequest, types.NewErrorV1(types.CodeInvalidParameter, msg).WithASTErrors(err))
 		default:
 			writer.ErrorAuto(w, err)
 		}
 		return
 	}
 
+	pr := types.PartialEvaluationResultV1{
+		Queries: pq.Queries,
+		Support: pq.Support,
+	}
+
+	if target := request.Options.Target; target != "" {
+		translation, err := translate.Translate(pq, target, request.Unknowns)
+		if err != nil {
+			if errs, ok := err.(ast.Errors); ok {
+				writer.Error(w, http.StatusBadRequest, types.NewErrorV1(types.CodeInvalidParameter, types.MsgTranslationError).WithASTErrors(errs))
+			} else {
+				writer.ErrorAuto(w, err)
+			}
+			return
+		}
+		// In validation mode, the translation is not returned.
+		if !request.Options.Validate {
+			pr.Translation = translation
+		}
+	}
+
 	m.Timer(metrics.ServerHandler).Stop()
 
 	result := types.CompileResponseV1{}
@@ -1363,10 +1485,7 @@ func (s *Server) v1CompilePost(w http.ResponseWriter, r *http.Request) {
 		result.Explanation = s.getExplainResponse(explainMode, *buf, pretty(r))
 	}
 
-	var i interface{} = types.PartialEvaluationResultV1{
-		Queries: pq.Queries,
-		Support: pq.Support,
-	}
+	var i interface{} = pr
 
 	result.Result = &i
 
@@ -1374,6 +1493,11 @@ func (s *Server) v1CompilePost(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) v1DataGet(w http.ResponseWriter, r *http.Request) {
+	if getBoolParam(r.URL, types.ParamWatchV1, true) {
+		s.v1DataWatch(w, r)
+		return
+	}
+
 	m := metrics.New()
 
 	m.Timer(metrics.ServerHandler).Start()
@@ -1434,7 +1558,7 @@ func (s *Server) v1DataGet(w http.ResponseWriter, r *http.Request) {
 	logger := s.getDecisionLogger(br)
 
 	var ndbCache builtins.NDBCache
-	if s.ndbCacheEnabled {
+	if s.ndbCacheEnabled || s.shadow() != nil {
 		ndbCache = builtins.NDBCache{}
 	}
 
@@ -1497,6 +1621,17 @@ func (s *Server) v1DataGet(w http.ResponseWriter, r *http.Request) {
 
 	m.Timer(metrics.ServerHandler).Stop()
 
+	s.evalShadow(ctx, shadowDecision{
+		logger:              logger,
+		path:                urlPath,
+		strictBuiltinErrors: strictBuiltinErrors,
+		input:               input,
+		goInput:             goInput,
+		result:              firstResult(rs),
+		err:                 err,
+		ndbCache:            ndbCache,
+	})
+
 	// Handle results.
 	if err != nil {
 		_ = logger.Log(ctx, txn, urlPath, "", goInput, input, nil, ndbCache, err, m)
@@ -1663,7 +1798,7 @@ func (s *Server) v1DataPost(w http.ResponseWriter, r *http.Request) {
 	logger := s.getDecisionLogger(br)
 
 	var ndbCache builtins.NDBCache
-	if s.ndbCacheEnabled {
+	if s.ndbCacheEnabled || s.shadow() != nil {
 		ndbCache = builtins.NDBCache{}
 	}
 
@@ -1673,44 +1808,11 @@ func (s *Server) v1DataPost(w http.ResponseWriter, r *http.Request) {
 		buf = topdown.NewBufferTracer()
 	}
 
-	pqID := "v1DataPost::"
-	if partial {
-		pqID += "partial::"
-	}
-	if strictBuiltinErrors {
-		pqID += "strict-builtin-errors::"
-	}
-	pqID += urlPath
-	preparedQuery, ok := s.getCachedPreparedEvalQuery(pqID, m)
-	if !ok {
-		opts := []func(*rego.Rego){
-			rego.Compiler(s.getCompiler()),
-			rego.Store(s.store),
-		}
-
-		// Set resolvers on the base Rego object to avoid having them get
-		// re-initialized, and to propagate them to the prepared query.
-		for _, r := range s.manager.GetWasmResolvers() {
-			for _, entrypoint := range r.Entrypoints() {
-				opts = append(opts, rego.Resolver(entrypoint, r))
-			}
-		}
-
-		rego, err := s.makeRego(ctx, partial, strictBuiltinErrors, txn, input, urlPath, m, includeInstrumentation, buf, opts)
-		if err != nil {
-			_ = logger.Log(ctx, txn, urlPath, "", goInput, input, nil, ndbCache, err, m)
-			writer.ErrorAuto(w, err)
-			return
-		}
-
-		pq, err := rego.PrepareForEval(ctx)
-		if err != nil {
-			_ = logger.Log(ctx, txn, urlPath, "", goInput, input, nil, ndbCache, err, m)
-			writer.ErrorAuto(w, err)
-			return
-		}
-		preparedQuery = &pq
-		s.preparedEvalQueries.Insert(pqID, preparedQuery)
+	preparedQuery, err := s.getPreparedDataQuery(ctx, partial, strictBuiltinErrors, txn, input, urlPath, m, includeInstrumentation, buf)
+	if err != nil {
+		_ = logger.Log(ctx, txn, urlPath, "", goInput, input, nil, ndbCache, err, m)
+		writer.ErrorAuto(w, err)
+		return
 	}
 
 	evalOpts := []rego.EvalOption{
@@ -1730,6 +1832,17 @@ func (s *Server) v1DataPost(w http.ResponseWriter, r *http.Request) {
 
 	m.Timer(metrics.ServerHandler).Stop()
 
+	s.evalShadow(ctx, shadowDecision{
+		logger:              logger,
+		path:                urlPath,
+		strictBuiltinErrors: strictBuiltinErrors,
+		input:               input,
+		goInput:             goInput,
+		result:              firstResult(rs),
+		err:                 err,
+		ndbCache:            ndbCache,
+	})
+
 	// Handle results.
 	if err != nil {
 		_ = logger.Log(ctx, txn, urlPath, "", goInput, input, nil, ndbCache, err, m)
@@ -1949,7 +2062,10 @@ func (s *Server) v1PoliciesDelete(w http.ResponseWriter, r *http.Request) {
 
 	delete(modules, id)
 
-	c := ast.NewCompiler().SetErrorLimit(s.errLimit)
+	c := ast.NewCompiler().
+		SetErrorLimit(s.errLimit).
+		WithEnablePrintStatements(s.manager.EnablePrintStatements()).
+		WithIncremental(s.getCompiler())
 
 	m.Timer(metrics.RegoModuleCompile).Start()
 
@@ -1962,6 +2078,10 @@ func (s *Server) v1PoliciesDelete(w http.ResponseWriter, r *http.Request) {
 
 	m.Timer(metrics.RegoModuleCompile).Stop()
 
+	// Hand the compiler to the plugin manager so that it does not have to
+	// recompile the policies when the transaction is committed.
+	plugins.SetCompilerOnContext(params.Context, c)
+
 	if err := s.store.DeletePolicy(ctx, txn, id); err != nil {
 		s.abortAuto(ctx, txn, w, err)
 		return
@@ -2144,7 +2264,8 @@ func (s *Server) v1PoliciesPut(w http.ResponseWriter, r *http.Request) {
 	c := ast.NewCompiler().
 		SetErrorLimit(s.errLimit).
 		WithPathConflictsCheck(storage.NonEmpty(ctx, s.store, txn)).
-		WithEnablePrintStatements(s.manager.EnablePrintStatements())
+		WithEnablePrintStatements(s.manager.EnablePrintStatements()).
+		WithIncremental(s.getCompiler())
 
 	m.Timer(metrics.RegoModuleCompile).Start()
 
@@ -2157,6 +2278,10 @@ func (s *Server) v1PoliciesPut(w http.ResponseWriter, r *http.Request) {
 
 	m.Timer(metrics.RegoModuleCompile).Stop()
 
+	// Hand the compiler to the plugin manager so that it does not have to
+	// recompile the policies when the transaction is committed.
+	plugins.SetCompilerOnContext(params.Context, c)
+
 	if err := s.store.UpsertPolicy(ctx, txn, id, buf); err != nil {
 		s.abortAuto(ctx, txn, w, err)
 		return
@@ -2413,6 +2538,7 @@ func (s *Server) getDecisionLogger(br bundleRevisions) (logger decisionLogger) {
 		logger.revisions = br.Revisions
 	}
 	logger.logger = s.logger
+	logger.ndbCacheEnabled = s.ndbCacheEnabled
 	return logger
 }
 
@@ -2828,6 +2954,8 @@ type compileRequest struct {
 
 type compileRequestOptions struct {
 	DisableInlining []string
+	Target          translate.Target
+	Validate        bool
 }
 
 func readInputCompilePostV1(r io.ReadCloser) (*compileRequest, *types.ErrorV1) {
@@ -2870,12 +2998,24 @@ func readInputCompilePostV1(r io.ReadCloser) (*compileRequest, *types.ErrorV1) {
 		}
 	}
 
+	var target translate.Target
+	if request.Options.Target != "" {
+		target, err = translate.ParseTarget(request.Options.Target)
+		if err != nil {
+			return nil, types.NewErrorV1(types.CodeInvalidParameter, "%v (supported targets: %v)", err, strings.Join(translate.Targets(), ", "))
+		}
+	} else if request.Options.Validate {
+		return nil, types.NewErrorV1(types.CodeInvalidParameter, "validation requires a translation target")
+	}
+
 	result := &compileRequest{
 		Query:    query,
 		Input:    input,
 		Unknowns: unknowns,
 		Options: compileRequestOptions{
 			DisableInlining: request.Options.DisableInlining,
+			Target:          target,
+			Validate:        request.Options.Validate,
 		},
 	}
 
@@ -2940,12 +3080,23 @@ Query:<br>
 `)
 
 type decisionLogger struct {
-	revisions map[string]string
-	revision  string // Deprecated: Use `revisions` instead.
-	logger    func(context.Context, *Info) error
+	revisions       map[string]string
+	revision        string // Deprecated: Use `revisions` instead.
+	logger          func(context.Context, *Info) error
+	ndbCacheEnabled bool // the cache may also be kept for shadow evaluation, but is only logged if enabled
 }
 
 func (l decisionLogger) Log(ctx context.Context, txn storage.Transaction, path string, query string, goInput *interface{}, astInput ast.Value, goResults *interface{}, ndbCache builtins.NDBCache, err error, m metrics.Metrics) error {
+	return l.log(ctx, txn, path, query, goInput, astInput, goResults, ndbCache, err, m, nil)
+}
+
+// logShadow logs a decision whose shadow evaluation diverged. The event
+// carries the live decision and the shadow result.
+func (l decisionLogger) logShadow(ctx context.Context, txn storage.Transaction, path string, goInput *interface{}, astInput ast.Value, goResults *interface{}, err error, shadow *ShadowInfo, m metrics.Metrics) error {
+	return l.log(ctx, txn, path, "", goInput, astInput, goResults, nil, err, m, shadow)
+}
+
+func (l decisionLogger) log(ctx context.Context, txn storage.Transaction, path string, query string, goInput *interface{}, astInput ast.Value, goResults *interface{}, ndbCache builtins.NDBCache, err error, m metrics.Metrics, shadow *ShadowInfo) error {
 
 	bundles := map[string]BundleInfo{}
 	for name, rev := range l.revisions {
@@ -2973,9 +3124,10 @@ func (l decisionLogger) Log(ctx context.Context, txn storage.Transaction, path s
 		Error:      err,
 		Metrics:    m,
 		RequestID:  rctx.ReqID,
+		Shadow:     shadow,
 	}
 
-	if ndbCache != nil {
+	if ndbCache != nil && l.ndbCacheEnabled {
 		x, err := ast.JSON(ndbCache.AsValue())
 		if err != nil {
 			return err
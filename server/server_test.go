@@ -1071,6 +1071,120 @@ func TestCompileV1UnsafeBuiltin(t *testing.T) {
 	}
 }
 
+func TestCompileV1Translation(t *testing.T) {
+
+	mod := `package test
+
+	allow { input.pets.owner == input.subject }
+
+	allow { input.pets.public }
+
+	unsupported { count(input.pets.name) > 3 }
+	`
+
+	tests := []struct {
+		note string
+		trs  []tr
+	}{
+		{
+			note: "sql",
+			trs: []tr{
+				{http.MethodPut, "/policies/test", mod, 200, ""},
+				{http.MethodPost, "/compile", `{
+					"unknowns": ["input.pets"],
+					"input": {"subject": "bob"},
+					"query": "data.test.allow = true",
+					"options": {"target": "sql+postgres"}
+				}`, 200, fmt.Sprintf(`{"result": {"queries": [%v, %v], "translation": {"where": "pets.owner = $1 OR pets.public = $2", "args": ["bob", true]}}}`,
+					string(util.MustMarshalJSON(ast.MustParseBody(`"bob" = input.pets.owner`))),
+					string(util.MustMarshalJSON(ast.MustParseBody(`input.pets.public`))))},
+			},
+		},
+		{
+			note: "elasticsearch",
+			trs: []tr{
+				{http.MethodPost, "/compile", `{
+					"unknowns": ["input.pets"],
+					"query": "input.pets.name = \"rex\"",
+					"options": {"target": "elasticsearch"}
+				}`, 200, fmt.Sprintf(`{"result": {"queries": [%v], "translation": {"term": {"name": "rex"}}}}`,
+					string(util.MustMarshalJSON(ast.MustParseBody(`input.pets.name = "rex"`))))},
+			},
+		},
+		{
+			note: "validate",
+			trs: []tr{
+				{http.MethodPost, "/compile", `{
+					"unknowns": ["input.pets"],
+					"query": "input.pets.name = \"rex\"",
+					"options": {"target": "sql+mysql", "validate": true}
+				}`, 200, fmt.Sprintf(`{"result": {"queries": [%v]}}`,
+					string(util.MustMarshalJSON(ast.MustParseBody(`input.pets.name = "rex"`))))},
+			},
+		},
+		{
+			note: "error: unsupported",
+			trs: []tr{
+				{http.MethodPut, "/policies/test", mod, 200, ""},
+				{http.MethodPost, "/compile", `{
+					"unknowns": ["input.pets"],
+					"query": "data.test.unsupported = true",
+					"options": {"target": "sql+sqlite"}
+				}`, 400, `{
+					"code": "invalid_parameter",
+					"message": "error(s) occurred while translating partial evaluation result",
+					"errors": [
+						{
+							"code": "rego_translation_error",
+							"message": "comparison does not refer to a field: gt(count(input.pets.name), 3)",
+							"location": {"file": "test", "row": 7, "col": 16}
+						}
+					]
+				}`},
+			},
+		},
+		{
+			note: "error: validate unsupported",
+			trs: []tr{
+				{http.MethodPut, "/policies/test", mod, 200, ""},
+				{http.MethodPost, "/compile", `{
+					"unknowns": ["input.pets"],
+					"query": "data.test.unsupported = true",
+					"options": {"target": "sql+sqlite", "validate": true}
+				}`, 400, `{
+					"code": "invalid_parameter",
+					"message": "error(s) occurred while translating partial evaluation result",
+					"errors": [
+						{
+							"code": "rego_translation_error",
+							"message": "built-in function count cannot be translated: count(input.pets.name)",
+							"location": {"file": "test", "row": 7, "col": 16}
+						}
+					]
+				}`},
+			},
+		},
+		{
+			note: "error: unknown target",
+			trs: []tr{
+				{http.MethodPost, "/compile", `{"query": "true", "options": {"target": "mongodb"}}`, 400, ""},
+			},
+		},
+		{
+			note: "error: validate without target",
+			trs: []tr{
+				{http.MethodPost, "/compile", `{"query": "true", "options": {"validate": true}}`, 400, ""},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			executeRequests(t, tc.trs, variant{"inmem", nil})
+		})
+	}
+}
+
 func TestDataV1Redirection(t *testing.T) {
 	f := newFixture(t)
 	// Testing redirect at the root level
@@ -1640,6 +1754,228 @@ func TestDataV1Metrics(t *testing.T) {
 	})
 }
 
+func TestBatchDataV1(t *testing.T) {
+	f := newFixture(t)
+
+	if err := f.v1(http.MethodPut, "/policies/test", `package test
+
+allow { input.user == "alice" }
+
+deny[msg] { input.user == "bob"; msg := "bob is denied" }
+
+err { 1 / input.zero }`, 200, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		note        string
+		path        string
+		contentType string
+		body        string
+		code        int
+		exp         []string
+	}{
+		{
+			note: "json array",
+			path: "/batch/data/test/allow",
+			body: `[{"id": "a", "input": {"user": "alice"}}, {"id": "b", "input": {"user": "bob"}}]`,
+			code: 200,
+			exp:  []string{`{"id": "a", "result": true}`, `{"id": "b"}`},
+		},
+		{
+			note:        "ndjson stream",
+			path:        "/batch/data/test/deny",
+			contentType: "application/x-ndjson",
+			body:        "{\"id\": \"a\", \"input\": {\"user\": \"alice\"}}\n{\"id\": \"b\", \"input\": {\"user\": \"bob\"}}\n",
+			code:        200,
+			exp:         []string{`{"id": "a", "result": []}`, `{"id": "b", "result": ["bob is denied"]}`},
+		},
+		{
+			note: "default ids and missing input",
+			path: "/batch/data/test/allow",
+			body: `[{"input": {"user": "alice"}}, {}]`,
+			code: 200,
+			exp: []string{`{"id": "0", "result": true}`, `{
+				"id": "1",
+				"warning": {"code": "api_usage_warning", "message": "'input' key missing from the request"}
+			}`},
+		},
+		{
+			note: "empty",
+			path: "/batch/data/test/allow",
+			body: `[]`,
+			code: 200,
+		},
+		{
+			note: "per-item errors",
+			path: "/batch/data/test/err?strict-builtin-errors",
+			body: `[{"id": "a", "input": {"zero": 0}}, {"id": "b", "input": {"zero": 1}}]`,
+			code: 200,
+			exp: []string{`{"id": "a", "error": {
+				"code": "internal_error",
+				"message": "error(s) occurred while evaluating query",
+				"errors": [{"code": "eval_builtin_error", "message": "div: divide by zero", "location": {"file": "test", "row": 7, "col": 7}}]
+			}}`, `{"id": "b", "result": true}`},
+		},
+		{
+			note: "malformed item",
+			path: "/batch/data/test/allow",
+			body: `[{"id": "a", "input": {"user": "alice"}}, {"id": 7}]`,
+			code: 200,
+			exp: []string{`{"id": "a", "result": true}`, `{"id": "1", "error": {
+				"code": "invalid_parameter",
+				"message": "body contains malformed input item: json: cannot unmarshal number into Go struct field BatchDataRequestItemV1.id of type string"
+			}}`},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			req := newReqV1(http.MethodPost, tc.path, tc.body)
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			f.reset()
+			f.server.Handler.ServeHTTP(f.recorder, req)
+
+			if f.recorder.Code != tc.code {
+				t.Fatalf("Expected code %d but got %d: %v", tc.code, f.recorder.Code, f.recorder.Body)
+			}
+
+			if ct := f.recorder.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Fatalf("Unexpected content type: %v", ct)
+			}
+
+			var lines []string
+			for _, line := range strings.Split(f.recorder.Body.String(), "\n") {
+				if line != "" {
+					lines = append(lines, line)
+				}
+			}
+
+			if len(lines) != len(tc.exp) {
+				t.Fatalf("Expected %d items but got %d: %v", len(tc.exp), len(lines), lines)
+			}
+
+			for i := range tc.exp {
+				result := util.MustUnmarshalJSON([]byte(lines[i]))
+				expected := util.MustUnmarshalJSON([]byte(tc.exp[i]))
+				if !reflect.DeepEqual(result, expected) {
+					t.Errorf("Expected item %d to be:\n\n%v\n\nGot:\n\n%v", i, tc.exp[i], lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBatchDataV1OverHTTP(t *testing.T) {
+	f := newFixture(t)
+
+	if err := f.v1(http.MethodPut, "/policies/test", `package test
+
+allow { input.user == "alice" }`, 200, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The response recorder does not close the request body when the response
+	// is flushed, so the items are streamed through a server.
+	ts := httptest.NewServer(f.server.Handler)
+	defer ts.Close()
+
+	const n = 2000
+
+	var body strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&body, "{\"id\": \"%d\", \"input\": {\"user\": \"alice\", \"padding\": %q}}\n", i, strings.Repeat("x", 64))
+	}
+
+	resp, err := http.Post(ts.URL+"/v1/batch/data/test/allow", "application/x-ndjson", strings.NewReader(body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected code 200 but got %d", resp.StatusCode)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for i := 0; i < n; i++ {
+		var item types.BatchDataResponseItemV1
+		if err := dec.Decode(&item); err != nil {
+			t.Fatalf("Expected %d items but got %d: %v", n, i, err)
+		}
+		if item.ID != fmt.Sprint(i) || item.Error != nil || item.Result == nil || *item.Result != true {
+			t.Fatalf("Unexpected item %d: %+v", i, item)
+		}
+	}
+
+	if dec.More() {
+		t.Fatal("Expected no more items")
+	}
+}
+
+func TestBatchDataV1DecisionLogging(t *testing.T) {
+	f := newFixture(t)
+
+	decisions := []*Info{}
+	var nextID int
+
+	f.server = f.server.WithDecisionIDFactory(func() string {
+		nextID++
+		return fmt.Sprint(nextID)
+	}).WithDecisionLoggerWithErr(func(_ context.Context, info *Info) error {
+		decisions = append(decisions, info)
+		return nil
+	})
+
+	if err := f.v1(http.MethodPut, "/policies/test", `package test
+
+allow { input.user == "alice" }`, 200, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	req := newReqV1(http.MethodPost, "/batch/data/test/allow", `[{"id": "a", "input": {"user": "alice"}}, {"id": "b", "input": {"user": "bob"}}]`)
+	f.reset()
+	f.server.Handler.ServeHTTP(f.recorder, req)
+
+	if f.recorder.Code != 200 {
+		t.Fatalf("Expected success but got %v", f.recorder)
+	}
+
+	exp := `{"id": "a", "decision_id": "1", "result": true}
+{"id": "b", "decision_id": "2"}
+`
+	var result, expected []interface{}
+	for _, x := range strings.Split(strings.TrimSpace(f.recorder.Body.String()), "\n") {
+		result = append(result, util.MustUnmarshalJSON([]byte(x)))
+	}
+	for _, x := range strings.Split(strings.TrimSpace(exp), "\n") {
+		expected = append(expected, util.MustUnmarshalJSON([]byte(x)))
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Expected %v but got %v", expected, result)
+	}
+
+	if len(decisions) != 2 {
+		t.Fatalf("Expected 2 decisions but got %d", len(decisions))
+	}
+
+	for i, d := range decisions {
+		if d.DecisionID != fmt.Sprint(i+1) || d.Path != "test/allow" || d.Input == nil {
+			t.Errorf("Unexpected decision %d: %+v", i, d)
+		}
+	}
+
+	if decisions[0].Results == nil || *decisions[0].Results != true {
+		t.Errorf("Expected first decision to be logged with result true but got %v", decisions[0].Results)
+	}
+
+	if decisions[1].Results != nil {
+		t.Errorf("Expected second decision to be logged without result but got %v", *decisions[1].Results)
+	}
+}
+
 func TestConfigV1(t *testing.T) {
 	f := newFixture(t)
 
@@ -4236,6 +4572,39 @@ func TestServerUsesAuthorizerParsedBody(t *testing.T) {
 	if exp.Value.Compare(inp) != 0 {
 		t.Fatalf("expected %v but got %v", exp, inp)
 	}
+
+	// Check that the batch reader function behaves correctly.
+	ctx = authorizer.SetBodyOnContext(req.Context(), []interface{}{
+		map[string]interface{}{
+			"id": "a",
+			"input": map[string]interface{}{
+				"foo": "good",
+			},
+		},
+	})
+
+	next, err := readBatchInputsV1(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inp, err = ast.InterfaceToValue(*item.Input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if item.ID != "a" || exp.Value.Compare(inp) != 0 {
+		t.Fatalf("expected %v but got %v", exp, inp)
+	}
+
+	if _, err := next(); err != io.EOF {
+		t.Fatalf("expected EOF but got %v", err)
+	}
 }
 
 func TestServerReloadTrigger(t *testing.T) {
@@ -0,0 +1,295 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/logging"
+	"github.com/open-policy-agent/opa/metrics"
+	bundlePlugin "github.com/open-policy-agent/opa/plugins/bundle"
+	shadowConfig "github.com/open-policy-agent/opa/plugins/server/shadow"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/open-policy-agent/opa/util"
+)
+
+// shadowEvaluator evaluates Data API decisions a second time against the
+// shadow bundles of the bundle plugin. The evaluation runs asynchronously
+// after the live decision has been made, so it never affects the response.
+// Decisions whose shadow result diverges from the live result are logged as
+// decision log events carrying the shadow result and are counted.
+type shadowEvaluator struct {
+	timeout   time.Duration
+	sem       chan struct{} // bounds the number of concurrent evaluations
+	wg        sync.WaitGroup
+	ctx       context.Context // parent context of the evaluations
+	cancel    context.CancelFunc
+	evaluated prometheus.Counter
+	diverged  prometheus.Counter
+	dropped   prometheus.Counter
+
+	mtx      sync.Mutex
+	compiler *ast.Compiler                      // compiler the queries were prepared with
+	queries  map[string]*rego.PreparedEvalQuery // prepared queries by path
+}
+
+// shadowDecision contains the live decision that is evaluated against the
+// shadow bundles.
+type shadowDecision struct {
+	logger              decisionLogger
+	path                string
+	strictBuiltinErrors bool
+	input               ast.Value
+	goInput             *interface{}
+	result              *interface{}
+	err                 error
+	ndbCache            builtins.NDBCache
+}
+
+func newShadowEvaluator(config *shadowConfig.Config, register prometheus.Registerer, logger logging.Logger) *shadowEvaluator {
+	e := &shadowEvaluator{
+		timeout: time.Duration(*config.TimeoutSeconds) * time.Second,
+		sem:     make(chan struct{}, *config.MaxConcurrentEvaluations),
+		evaluated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "shadow_evaluations_counter",
+			Help: "Counter for the decisions evaluated against the shadow bundles."}),
+		diverged: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "shadow_divergences_counter",
+			Help: "Counter for the shadow decisions that diverged from the live decisions."}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "shadow_dropped_counter",
+			Help: "Counter for the shadow evaluations dropped because too many were in progress."}),
+		queries: map[string]*rego.PreparedEvalQuery{},
+	}
+
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	if register != nil {
+		for _, c := range []prometheus.Collector{e.evaluated, e.diverged, e.dropped} {
+			if err := register.Register(c); err != nil {
+				logger.Error("Shadow metric failed to register on prometheus: %v.", err)
+			}
+		}
+	}
+
+	return e
+}
+
+// shadow returns the shadow bundles of the bundle plugin if shadow evaluation
+// is enabled and a shadow bundle is active.
+func (s *Server) shadow() *bundlePlugin.Shadow {
+	if s.shadowEvaluator == nil {
+		return nil
+	}
+	p := bundlePlugin.Lookup(s.manager)
+	if p == nil || p.Shadow().Compiler() == nil {
+		return nil
+	}
+	return p.Shadow()
+}
+
+// evalShadow starts the evaluation of the decision against the shadow
+// bundles. If too many evaluations are in progress, the decision is dropped.
+func (s *Server) evalShadow(ctx context.Context, d shadowDecision) {
+
+	shadow := s.shadow()
+	if shadow == nil {
+		return
+	}
+
+	compiler := shadow.Compiler()
+	if compiler == nil {
+		return
+	}
+
+	e := s.shadowEvaluator
+
+	select {
+	case e.sem <- struct{}{}:
+	default:
+		e.dropped.Inc()
+		return
+	}
+
+	// The request context is canceled once the response has been written,
+	// only the values needed for decision logging are carried over.
+	sctx := trace.ContextWithSpanContext(e.ctx, trace.SpanFromContext(ctx).SpanContext())
+	if decisionID, ok := logging.DecisionIDFromContext(ctx); ok {
+		sctx = logging.WithDecisionID(sctx, decisionID)
+	}
+	if rctx, ok := logging.FromContext(ctx); ok {
+		sctx = logging.NewContext(sctx, rctx)
+	}
+
+	// The shadow evaluation replays the non-deterministic built-in calls of
+	// the live evaluation, e.g., time.now_ns, so that they do not cause
+	// divergences.
+	if d.ndbCache != nil {
+		cache := make(builtins.NDBCache, len(d.ndbCache))
+		for name, obj := range d.ndbCache {
+			cache[name] = obj.Copy()
+		}
+		d.ndbCache = cache
+	} else {
+		d.ndbCache = builtins.NDBCache{}
+	}
+
+	e.wg.Add(1)
+
+	go func() {
+		defer func() {
+			<-e.sem
+			e.wg.Done()
+		}()
+
+		sctx, cancel := context.WithTimeout(sctx, e.timeout)
+		defer cancel()
+
+		if err := s.evalShadowDecision(sctx, compiler, shadow.Store(), d); err != nil {
+			s.manager.Logger().Error("Shadow evaluation failed: %v.", err)
+		}
+	}()
+}
+
+// wait waits for the evaluations in progress to complete. If ctx is done
+// first, the evaluations are canceled.
+func (e *shadowEvaluator) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		e.cancel()
+		return fmt.Errorf("shadow evaluations did not complete: %w", ctx.Err())
+	}
+}
+
+func (s *Server) evalShadowDecision(ctx context.Context, compiler *ast.Compiler, store storage.Store, d shadowDecision) error {
+
+	e := s.shadowEvaluator
+	m := metrics.New()
+
+	txn, err := store.NewTransaction(ctx, storage.TransactionParams{Context: storage.NewContext().WithMetrics(m)})
+	if err != nil {
+		return err
+	}
+	defer store.Abort(ctx, txn)
+
+	br, err := getRevisions(ctx, store, txn)
+	if err != nil {
+		return err
+	}
+
+	pq, err := e.prepare(ctx, s, compiler, store, d.path, d.strictBuiltinErrors)
+
+	var rs rego.ResultSet
+	if err == nil {
+		rs, err = pq.Eval(ctx,
+			rego.EvalTransaction(txn),
+			rego.EvalParsedInput(d.input),
+			rego.EvalMetrics(m),
+			rego.EvalNDBuiltinCache(d.ndbCache),
+		)
+	}
+
+	info := &ShadowInfo{Bundles: map[string]BundleInfo{}, Error: err}
+	for name, rev := range br.Revisions {
+		info.Bundles[name] = BundleInfo{Revision: rev}
+	}
+
+	if err == nil && len(rs) > 0 {
+		info.Results = &rs[0].Expressions[0].Value
+	}
+
+	e.evaluated.Inc()
+
+	if !shadowDiverged(d.result, d.err, info.Results, info.Error) {
+		return nil
+	}
+
+	e.diverged.Inc()
+
+	// Decision log mask and drop policies are evaluated against the live
+	// store.
+	liveTxn, err := s.store.NewTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.store.Abort(ctx, liveTxn)
+
+	return d.logger.logShadow(ctx, liveTxn, d.path, d.goInput, d.input, d.result, d.err, info, m)
+}
+
+func (e *shadowEvaluator) prepare(ctx context.Context, s *Server, compiler *ast.Compiler, store storage.Store, path string, strictBuiltinErrors bool) (*rego.PreparedEvalQuery, error) {
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	// Prepared queries are discarded whenever the shadow bundles change.
+	if e.compiler != compiler {
+		e.compiler = compiler
+		e.queries = map[string]*rego.PreparedEvalQuery{}
+	}
+
+	key := path
+	if strictBuiltinErrors {
+		key = "strict-builtin-errors::" + path
+	}
+
+	if pq, ok := e.queries[key]; ok {
+		return pq, nil
+	}
+
+	pq, err := rego.New(
+		rego.Compiler(compiler),
+		rego.Store(store),
+		rego.Query(stringPathToDataRef(path).String()),
+		rego.Runtime(s.runtime),
+		rego.UnsafeBuiltins(unsafeBuiltinsMap),
+		rego.StrictBuiltinErrors(strictBuiltinErrors),
+		rego.PrintHook(s.manager.PrintHook()),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	e.queries[key] = &pq
+	return &pq, nil
+}
+
+// shadowDiverged returns true if the shadow decision differs from the live
+// decision. Decisions that fail in both evaluations do not diverge.
+func shadowDiverged(liveResult *interface{}, liveErr error, shadowResult *interface{}, shadowErr error) bool {
+	if liveErr != nil || shadowErr != nil {
+		return (liveErr == nil) != (shadowErr == nil)
+	}
+	if liveResult == nil || shadowResult == nil {
+		return liveResult != shadowResult
+	}
+	return util.Compare(*liveResult, *shadowResult) != 0
+}
+
+// firstResult returns the value of the first result in rs, or nil if the
+// result set is empty, i.e., if the decision is undefined.
+func firstResult(rs rego.ResultSet) *interface{} {
+	if len(rs) == 0 {
+		return nil
+	}
+	return &rs[0].Expressions[0].Value
+}
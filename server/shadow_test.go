@@ -0,0 +1,222 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	pluginBundle "github.com/open-policy-agent/opa/plugins/bundle"
+	shadowConfig "github.com/open-policy-agent/opa/plugins/server/shadow"
+	"github.com/open-policy-agent/opa/util"
+)
+
+func TestShadowEvaluation(t *testing.T) {
+
+	ctx := context.Background()
+	f := newFixture(t)
+
+	if err := f.v1("PUT", "/policies/authz", `package authz
+
+allow { input.user == "alice" }
+allow { input.user == "bob" }`, 200, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The shadow bundle no longer allows bob.
+	shadowModule := `package authz
+
+allow { input.user == "alice" }`
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bundle.tar.gz")
+
+	fd, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = bundle.NewWriter(fd).Write(bundle.Bundle{
+		Manifest: bundle.Manifest{Revision: "canary-1", Roots: &[]string{"authz"}},
+		Data:     map[string]interface{}{},
+		Modules: []bundle.ModuleFile{
+			{URL: "/authz.rego", Path: "/authz.rego", Raw: []byte(shadowModule), Parsed: ast.MustParseModule(shadowModule)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fd.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bp := pluginBundle.New(&pluginBundle.Config{Bundles: map[string]*pluginBundle.Source{
+		"canary": {Resource: "file://" + path, Shadow: true, SizeLimitBytes: bundle.DefaultSizeLimitBytes},
+	}}, f.server.manager)
+	f.server.manager.Register(pluginBundle.Name, bp)
+
+	if err := bp.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := util.WaitFunc(func() bool {
+		return bp.Shadow().Compiler() != nil
+	}, 10*time.Millisecond, 5*time.Second); err != nil {
+		t.Fatal("Shadow bundle was not activated")
+	}
+
+	var mtx sync.Mutex
+	decisions := []*Info{}
+
+	f.server = f.server.WithDecisionLoggerWithErr(func(_ context.Context, info *Info) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		decisions = append(decisions, info)
+		return nil
+	})
+
+	reqs := []tr{
+		{"POST", "/data/authz/allow", `{"input": {"user": "alice"}}`, 200, `{"result": true}`},
+		{"POST", "/data/authz/allow", `{"input": {"user": "bob"}}`, 200, `{"result": true}`},
+		{"GET", "/data/authz/allow?input=" + `{"user":"carol"}`, "", 200, `{}`},
+	}
+
+	for _, tr := range reqs {
+		if err := f.v1(tr.method, tr.path, tr.body, tr.code, tr.resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Shutdown waits for the shadow evaluations in progress.
+	if err := f.server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.ToFloat64(f.server.shadowEvaluator.evaluated); n != 3 {
+		t.Fatalf("Expected 3 shadow evaluations but got %v", n)
+	}
+
+	if n := testutil.ToFloat64(f.server.shadowEvaluator.diverged); n != 1 {
+		t.Fatalf("Expected 1 divergence but got %v", n)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	// Each request is logged, followed by the divergent shadow decision.
+	if len(decisions) != 4 {
+		t.Fatalf("Expected 4 decisions but got %d", len(decisions))
+	}
+
+	var shadow *Info
+	for _, d := range decisions {
+		if d.Shadow != nil {
+			if shadow != nil {
+				t.Fatal("Expected a single shadow decision")
+			}
+			shadow = d
+		}
+	}
+
+	if shadow == nil {
+		t.Fatal("Expected a shadow decision")
+	}
+
+	if shadow.Path != "authz/allow" || shadow.Results == nil || *shadow.Results != true {
+		t.Fatalf("Unexpected live decision: %+v", shadow)
+	}
+
+	if shadow.Shadow.Results != nil || shadow.Shadow.Error != nil {
+		t.Fatalf("Expected undefined shadow decision but got %+v", shadow.Shadow)
+	}
+
+	if shadow.Shadow.Bundles["canary"].Revision != "canary-1" {
+		t.Fatalf("Unexpected shadow bundles: %v", shadow.Shadow.Bundles)
+	}
+
+	if len(shadow.Bundles) != 0 {
+		t.Fatalf("Expected shadow bundles to be kept out of the live bundles but got %v", shadow.Bundles)
+	}
+}
+
+func TestShadowEvaluatorWaitCancel(t *testing.T) {
+	e := newShadowEvaluator(&shadowConfig.Config{
+		TimeoutSeconds:           new(int64),
+		MaxConcurrentEvaluations: new(int),
+	}, nil, nil)
+
+	canceled := make(chan struct{})
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		<-e.ctx.Done()
+		close(canceled)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := e.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded but got %v", err)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected evaluation in progress to be canceled")
+	}
+
+	if err := e.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShadowDiverged(t *testing.T) {
+
+	value := func(x interface{}) *interface{} {
+		return &x
+	}
+
+	tests := []struct {
+		note         string
+		liveResult   *interface{}
+		liveErr      error
+		shadowResult *interface{}
+		shadowErr    error
+		exp          bool
+	}{
+		{note: "both undefined"},
+		{note: "same result", liveResult: value(true), shadowResult: value(true)},
+		{note: "different result", liveResult: value(true), shadowResult: value(false), exp: true},
+		{note: "undefined shadow", liveResult: value(true), exp: true},
+		{note: "undefined live", shadowResult: value(true), exp: true},
+		{
+			note:         "same object",
+			liveResult:   value(map[string]interface{}{"a": []interface{}{"b"}}),
+			shadowResult: value(map[string]interface{}{"a": []interface{}{"b"}}),
+		},
+		{note: "both failed", liveErr: errors.New("a"), shadowErr: errors.New("b")},
+		{note: "shadow failed", liveResult: value(true), shadowErr: errors.New("b"), exp: true},
+		{note: "live failed", liveErr: errors.New("a"), shadowResult: value(true), exp: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			if got := shadowDiverged(tc.liveResult, tc.liveErr, tc.shadowResult, tc.shadowErr); got != tc.exp {
+				t.Fatalf("Expected %v but got %v", tc.exp, got)
+			}
+		})
+	}
+}
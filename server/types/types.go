@@ -81,6 +81,7 @@ const (
 	MsgMissingError               = "document missing"
 	MsgFoundUndefinedError        = "document undefined"
 	MsgPluginConfigError          = "error(s) occurred while configuring plugin(s)"
+	MsgTranslationError           = "error(s) occurred while translating partial evaluation result"
 )
 
 // PatchV1 models a single patch operation against a document.
@@ -142,6 +143,40 @@ type DataRequestV1 struct {
 	Input *interface{} `json:"input"`
 }
 
+// BatchDataRequestItemV1 models a single item of a Batch Data API request.
+// Requests are sent either as a JSON array of items or as a stream of
+// newline-delimited items.
+type BatchDataRequestItemV1 struct {
+	ID    string       `json:"id"`
+	Input *interface{} `json:"input"`
+}
+
+// BatchDataResponseItemV1 models a single item of a Batch Data API response.
+// The server streams one item per request item as newline-delimited JSON.
+type BatchDataResponseItemV1 struct {
+	ID         string       `json:"id"`
+	DecisionID string       `json:"decision_id,omitempty"`
+	Metrics    MetricsV1    `json:"metrics,omitempty"`
+	Result     *interface{} `json:"result,omitempty"`
+	Warning    *Warning     `json:"warning,omitempty"`
+	Error      *ErrorV1     `json:"error,omitempty"`
+}
+
+// DataWatchEventV1 models a single change streamed by the Data API watch
+// operation. Changes committed in the same transaction share a revision.
+type DataWatchEventV1 struct {
+	Revision uint64           `json:"revision"`
+	Op       string           `json:"op"`
+	Path     string           `json:"path"`
+	Value    *json.RawMessage `json:"value,omitempty"`
+}
+
+// Operations reported by the Data API watch operation.
+const (
+	DataWatchOpUpsert = "upsert"
+	DataWatchOpRemove = "remove"
+)
+
 // DataResponseV1 models the response message for Data API read operations.
 type DataResponseV1 struct {
 	DecisionID  string        `json:"decision_id,omitempty"`
@@ -373,6 +408,8 @@ type CompileRequestV1 struct {
 	Unknowns *[]string    `json:"unknowns"`
 	Options  struct {
 		DisableInlining []string `json:"disableInlining,omitempty"`
+		Target          string   `json:"target,omitempty"`
+		Validate        bool     `json:"validate,omitempty"`
 	} `json:"options,omitempty"`
 }
 
@@ -386,8 +423,9 @@ type CompileResponseV1 struct {
 // PartialEvaluationResultV1 represents the output of partial evaluation and is
 // included in Compile API responses.
 type PartialEvaluationResultV1 struct {
-	Queries []ast.Body    `json:"queries,omitempty"`
-	Support []*ast.Module `json:"support,omitempty"`
+	Queries     []ast.Body    `json:"queries,omitempty"`
+	Support     []*ast.Module `json:"support,omitempty"`
+	Translation interface{}   `json:"translation,omitempty"`
 }
 
 // QueryRequestV1 models the request message for Query API operations.
@@ -471,6 +509,14 @@ const (
 	// ParamStrictBuiltinErrors names the HTTP URL parameter that indicates the client
 	// wants built-in function errors to be treated as fatal.
 	ParamStrictBuiltinErrors = "strict-builtin-errors"
+
+	// ParamWatchV1 defines the name of the HTTP URL parameter that indicates
+	// the client wants to receive a stream of changes to a document.
+	ParamWatchV1 = "watch"
+
+	// ParamRevisionV1 defines the name of the HTTP URL parameter that specifies
+	// the last revision seen by a client resuming a watch.
+	ParamRevisionV1 = "revision"
 )
 
 // BadRequestErr represents an error condition raised if the caller passes
@@ -0,0 +1,428 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/open-policy-agent/opa/server/types"
+	"github.com/open-policy-agent/opa/server/writer"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const (
+	// watchHistoryMaxBytes bounds the size of the changes kept for clients
+	// resuming a watch.
+	watchHistoryMaxBytes = 16 << 20
+
+	// watchBufferSize is the number of revisions buffered for each watch
+	// before the client is considered too slow and disconnected.
+	watchBufferSize = 64
+)
+
+// dataWatcher records the data changes committed to the store and delivers
+// them to the clients watching the Data API. Every commit that modifies data
+// is assigned the next revision. Revisions start at the server start time (in
+// microseconds), so revisions handed out by a previous process are never
+// resumed by mistake.
+//
+// Changes are only recorded while at least one watch is active, so the store's
+// triggers do not pay for encoding the changes otherwise. Once the last watch
+// disconnects the history is dropped, and clients reconnecting afterwards start
+// over with the current state.
+type dataWatcher struct {
+	mtx       sync.Mutex
+	revision  uint64                  // revision of the last commit
+	base      uint64                  // history contains all changes after this revision
+	history   []watchRevision         // recorded changes, oldest first
+	size      int                     // size of the recorded changes in bytes
+	recording bool                    // true if changes are recorded
+	closed    bool                    // true if the server is shutting down
+	watches   map[*dataWatch]struct{} // active watches
+}
+
+// watchRevision contains the changes committed in a single transaction.
+type watchRevision struct {
+	revision uint64
+	changes  []watchChange
+}
+
+type watchChange struct {
+	path    storage.Path
+	removed bool
+	value   json.RawMessage
+}
+
+// dataWatch receives the revisions committed while a client is watching. The
+// channel is closed if the client cannot keep up or the server shuts down.
+type dataWatch struct {
+	ch chan watchRevision
+}
+
+func newDataWatcher() *dataWatcher {
+	revision := uint64(time.Now().UnixMicro())
+	return &dataWatcher{
+		revision: revision,
+		base:     revision,
+		watches:  map[*dataWatch]struct{}{},
+	}
+}
+
+func (dw *dataWatcher) onCommit(_ context.Context, _ storage.Transaction, event storage.TriggerEvent) {
+
+	if !event.DataChanged() {
+		return
+	}
+
+	dw.mtx.Lock()
+	defer dw.mtx.Unlock()
+
+	dw.revision++
+
+	if !dw.recording {
+		dw.base = dw.revision
+		return
+	}
+
+	rev := watchRevision{revision: dw.revision, changes: make([]watchChange, 0, len(event.Data))}
+
+	// The values are encoded immediately because the store may modify them
+	// once the transaction is done.
+	for _, e := range event.Data {
+		c := watchChange{path: e.Path, removed: e.Removed}
+		if !e.Removed {
+			bs, err := json.Marshal(e.Data)
+			if err != nil {
+				// Clients cannot be sent this change, so they have to start
+				// over from the current state of the store.
+				dw.reset()
+				return
+			}
+			c.value = bs
+			dw.size += len(bs)
+		}
+		rev.changes = append(rev.changes, c)
+	}
+
+	dw.history = append(dw.history, rev)
+
+	for dw.size > watchHistoryMaxBytes && len(dw.history) > 0 {
+		oldest := dw.history[0]
+		for _, c := range oldest.changes {
+			dw.size -= len(c.value)
+		}
+		dw.history[0] = watchRevision{}
+		dw.history = dw.history[1:]
+		dw.base = oldest.revision
+	}
+
+	for w := range dw.watches {
+		select {
+		case w.ch <- rev:
+		default:
+			close(w.ch)
+			delete(dw.watches, w)
+		}
+	}
+
+	dw.stopRecordingIfIdle()
+}
+
+// reset drops the history and disconnects all watches. It must be called
+// while holding the lock.
+func (dw *dataWatcher) reset() {
+	dw.history = nil
+	dw.size = 0
+	dw.base = dw.revision
+	for w := range dw.watches {
+		close(w.ch)
+		delete(dw.watches, w)
+	}
+	dw.stopRecordingIfIdle()
+}
+
+// stopRecordingIfIdle stops recording changes and drops the history if no
+// watch is active anymore. It must be called while holding the lock.
+func (dw *dataWatcher) stopRecordingIfIdle() {
+	if len(dw.watches) > 0 {
+		return
+	}
+	dw.recording = false
+	dw.history = nil
+	dw.size = 0
+	dw.base = dw.revision
+}
+
+// watch registers a new watch. If since refers to a revision that can be
+// resumed, that revision and the ones committed after it are returned.
+// Otherwise, the caller has to send the current state of the store as of the
+// returned revision. Changes delivered on the watch may already be contained in
+// that state, which is harmless because changes carry absolute values. The
+// watch is nil if the server is shutting down.
+func (dw *dataWatcher) watch(since *uint64) (w *dataWatch, backlog []watchRevision, revision uint64, resumed bool) {
+
+	dw.mtx.Lock()
+	defer dw.mtx.Unlock()
+
+	if dw.closed {
+		return nil, nil, 0, false
+	}
+
+	dw.recording = true
+
+	if since != nil && dw.base < *since && *since <= dw.revision {
+		resumed = true
+		for _, rev := range dw.history {
+			if rev.revision >= *since {
+				backlog = append(backlog, rev)
+			}
+		}
+	}
+
+	w = &dataWatch{ch: make(chan watchRevision, watchBufferSize)}
+	dw.watches[w] = struct{}{}
+
+	return w, backlog, dw.revision, resumed
+}
+
+func (dw *dataWatcher) unwatch(w *dataWatch) {
+	dw.mtx.Lock()
+	defer dw.mtx.Unlock()
+	delete(dw.watches, w)
+	dw.stopRecordingIfIdle()
+}
+
+// close disconnects all watches and rejects new ones, so that the server can
+// shut down without waiting for the clients.
+func (dw *dataWatcher) close() {
+	dw.mtx.Lock()
+	defer dw.mtx.Unlock()
+	dw.closed = true
+	for w := range dw.watches {
+		close(w.ch)
+		delete(dw.watches, w)
+	}
+	dw.stopRecordingIfIdle()
+}
+
+// v1DataWatch streams the changes to the base document at the request path.
+// The response starts with the current value of the document unless the client
+// resumes from a revision that is still available, in which case the changes
+// committed in and after that revision are replayed instead.
+func (s *Server) v1DataWatch(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	path, ok := storage.ParsePathEscaped("/" + strings.Trim(vars["path"], "/"))
+	if !ok {
+		writer.Error(w, http.StatusBadRequest, types.NewErrorV1(types.CodeInvalidParameter, "bad path: %v", vars["path"]))
+		return
+	}
+
+	since, err := getWatchRevision(r)
+	if err != nil {
+		writer.ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, err)
+		return
+	}
+
+	watch, backlog, revision, resumed := s.watcher.watch(since)
+	if watch == nil {
+		writer.ErrorString(w, http.StatusServiceUnavailable, types.CodeInternal, fmt.Errorf("server is shutting down"))
+		return
+	}
+
+	defer s.watcher.unwatch(watch)
+
+	if !resumed {
+		initial, err := s.readWatchedDocument(ctx, path)
+		if err != nil {
+			writer.ErrorAuto(w, err)
+			return
+		}
+		backlog = []watchRevision{{revision: revision, changes: []watchChange{initial}}}
+	}
+
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+
+	send := func(rev watchRevision) error {
+		for _, c := range rev.changes {
+			c, ok := relativeWatchChange(c, path)
+			if !ok {
+				continue
+			}
+			event := types.DataWatchEventV1{
+				Revision: rev.revision,
+				Op:       types.DataWatchOpUpsert,
+				Path:     c.path.String(),
+			}
+			if c.removed {
+				event.Op = types.DataWatchOpRemove
+			} else {
+				event.Value = &c.value
+			}
+			bs, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if sse {
+				_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", rev.revision, bs)
+			} else {
+				_, err = fmt.Fprintf(w, "%s\n", bs)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	for _, rev := range backlog {
+		if err := send(rev); err != nil {
+			return
+		}
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case rev, ok := <-watch.ch:
+			if !ok {
+				// The client resumes from the last revision it received.
+				return
+			}
+			if err := send(rev); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readWatchedDocument returns the current value of the document at path as a
+// change.
+func (s *Server) readWatchedDocument(ctx context.Context, path storage.Path) (watchChange, error) {
+
+	result := watchChange{path: path}
+
+	txn, err := s.store.NewTransaction(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	defer s.store.Abort(ctx, txn)
+
+	value, err := s.store.Read(ctx, txn, path)
+	if err != nil {
+		if storage.IsNotFound(err) {
+			result.removed = true
+			return result, nil
+		}
+		return result, err
+	}
+
+	result.value, err = json.Marshal(value)
+	return result, err
+}
+
+// getWatchRevision returns the revision the client wants to resume from, i.e.,
+// the last revision it received, if any. The revision is taken from the URL or, for clients using Server-Sent
+// Events, from the Last-Event-ID header.
+func getWatchRevision(r *http.Request) (*uint64, error) {
+	value := r.URL.Query().Get(types.ParamRevisionV1)
+	if value == "" {
+		value = r.Header.Get("Last-Event-ID")
+	}
+	if value == "" {
+		return nil, nil
+	}
+	revision, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revision: %v", value)
+	}
+	return &revision, nil
+}
+
+// relativeWatchChange returns the part of the change c that affects the
+// document at path. Changes to documents that contain path are narrowed down
+// to path.
+func relativeWatchChange(c watchChange, path storage.Path) (watchChange, bool) {
+
+	if c.path.HasPrefix(path) {
+		return c, true
+	}
+
+	if !path.HasPrefix(c.path) {
+		return c, false
+	}
+
+	result := watchChange{path: path, removed: true}
+
+	if c.removed {
+		return result, true
+	}
+
+	var value interface{}
+	if err := util.UnmarshalJSON(c.value, &value); err != nil {
+		return result, true
+	}
+
+	for _, key := range path[len(c.path):] {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, ok := v[key]
+			if !ok {
+				return result, true
+			}
+			value = child
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return result, true
+			}
+			value = v[idx]
+		default:
+			return result, true
+		}
+	}
+
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return result, true
+	}
+
+	result.removed = false
+	result.value = bs
+
+	return result, true
+}
@@ -0,0 +1,314 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/server/types"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/util"
+)
+
+type watchStream struct {
+	t      *testing.T
+	resp   *http.Response
+	events chan string
+}
+
+func newWatchStream(t *testing.T, ts *httptest.Server, path string, header http.Header) *watchStream {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 but got %v", resp.StatusCode)
+	}
+
+	ws := &watchStream{t: t, resp: resp, events: make(chan string, 100)}
+
+	go func() {
+		defer close(ws.events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				ws.events <- line
+			}
+		}
+	}()
+
+	return ws
+}
+
+func (ws *watchStream) next() string {
+	ws.t.Helper()
+	select {
+	case line, ok := <-ws.events:
+		if !ok {
+			ws.t.Fatal("stream closed")
+		}
+		return line
+	case <-time.After(5 * time.Second):
+		ws.t.Fatal("timed out waiting for event")
+	}
+	return ""
+}
+
+func (ws *watchStream) nextEvent() types.DataWatchEventV1 {
+	ws.t.Helper()
+	var event types.DataWatchEventV1
+	if err := json.Unmarshal([]byte(ws.next()), &event); err != nil {
+		ws.t.Fatal(err)
+	}
+	return event
+}
+
+func (ws *watchStream) close() {
+	ws.resp.Body.Close()
+}
+
+func assertWatchEvent(t *testing.T, event types.DataWatchEventV1, op, path, value string) {
+	t.Helper()
+	if event.Op != op || event.Path != path {
+		t.Fatalf("expected %v %v but got %v %v", op, path, event.Op, event.Path)
+	}
+	if value == "" {
+		if event.Value != nil {
+			t.Fatalf("expected no value but got %s", *event.Value)
+		}
+		return
+	}
+	if event.Value == nil {
+		t.Fatalf("expected value %v but got none", value)
+	}
+	exp := util.MustUnmarshalJSON([]byte(value))
+	if actual := util.MustUnmarshalJSON(*event.Value); util.Compare(exp, actual) != 0 {
+		t.Fatalf("expected value %v but got %v", exp, actual)
+	}
+}
+
+func TestDataWatch(t *testing.T) {
+
+	f := newFixture(t)
+	ts := httptest.NewServer(f.server.Handler)
+	defer ts.Close()
+
+	if err := f.v1(http.MethodPut, "/data/a", `{"b": 1}`, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ws := newWatchStream(t, ts, "/v1/data/a?watch", nil)
+	defer ws.close()
+
+	initial := ws.nextEvent()
+	assertWatchEvent(t, initial, "upsert", "/a", `{"b": 1}`)
+
+	if err := f.v1(http.MethodPut, "/data/a/c", `2`, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	added := ws.nextEvent()
+	assertWatchEvent(t, added, "upsert", "/a/c", `2`)
+
+	if added.Revision <= initial.Revision {
+		t.Fatalf("expected revision to increase but got %d after %d", added.Revision, initial.Revision)
+	}
+
+	// Changes outside of the watched path are not sent. Changes above the
+	// watched path are narrowed down to it.
+	if err := f.v1(http.MethodPut, "/data/x", `1`, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.v1(http.MethodPut, "/data", `{"a": {"e": 5}, "x": 1}`, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	replaced := ws.nextEvent()
+	assertWatchEvent(t, replaced, "upsert", "/a", `{"e": 5}`)
+
+	if replaced.Revision != added.Revision+2 {
+		t.Fatalf("expected revision %d but got %d", added.Revision+2, replaced.Revision)
+	}
+
+	if err := f.v1(http.MethodDelete, "/data/a", "", 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	assertWatchEvent(t, ws.nextEvent(), "remove", "/a", "")
+
+	// Resuming replays the changes from the given revision on.
+	resumed := newWatchStream(t, ts, fmt.Sprintf("/v1/data/a?watch=true&revision=%d", added.Revision), nil)
+	defer resumed.close()
+
+	assertWatchEvent(t, resumed.nextEvent(), "upsert", "/a/c", `2`)
+	assertWatchEvent(t, resumed.nextEvent(), "upsert", "/a", `{"e": 5}`)
+	assertWatchEvent(t, resumed.nextEvent(), "remove", "/a", "")
+
+	// Revisions that cannot be resumed start over with the current state.
+	fresh := newWatchStream(t, ts, "/v1/data/a?watch=true&revision=1", nil)
+	defer fresh.close()
+
+	assertWatchEvent(t, fresh.nextEvent(), "remove", "/a", "")
+}
+
+func TestDataWatchBundleActivation(t *testing.T) {
+
+	ctx := context.Background()
+	f := newFixture(t)
+	ts := httptest.NewServer(f.server.Handler)
+	defer ts.Close()
+
+	ws := newWatchStream(t, ts, "/v1/data/roles?watch=true", nil)
+	defer ws.close()
+
+	assertWatchEvent(t, ws.nextEvent(), "remove", "/roles", "")
+
+	err := storage.Txn(ctx, f.server.store, storage.WriteParams, func(txn storage.Transaction) error {
+		return bundle.Activate(&bundle.ActivateOpts{
+			Ctx:      ctx,
+			Store:    f.server.store,
+			Txn:      txn,
+			Compiler: ast.NewCompiler(),
+			Metrics:  metrics.New(),
+			Bundles: map[string]*bundle.Bundle{
+				"b1": {
+					Manifest: bundle.Manifest{Revision: "r1", Roots: &[]string{"roles"}},
+					Data:     map[string]interface{}{"roles": map[string]interface{}{"admin": []interface{}{"alice"}}},
+				},
+			},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := ws.nextEvent()
+	for event.Op == "remove" {
+		// Bundle activations erase the bundle roots first.
+		event = ws.nextEvent()
+	}
+
+	assertWatchEvent(t, event, "upsert", "/roles", `{"admin": ["alice"]}`)
+}
+
+func TestDataWatchServerSentEvents(t *testing.T) {
+
+	f := newFixture(t)
+	ts := httptest.NewServer(f.server.Handler)
+	defer ts.Close()
+
+	if err := f.v1(http.MethodPut, "/data/a", `1`, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes are only kept for resuming while some watch is active.
+	other := newWatchStream(t, ts, "/v1/data/b?watch=true", nil)
+	defer other.close()
+	other.next()
+
+	ws := newWatchStream(t, ts, "/v1/data/a?watch=true", http.Header{"Accept": {"text/event-stream"}})
+	defer ws.close()
+
+	if ct := ws.resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type: %v", ct)
+	}
+
+	id := ws.next()
+	if !strings.HasPrefix(id, "id: ") {
+		t.Fatalf("expected event id but got %q", id)
+	}
+
+	if data := ws.next(); data != `data: {"revision":`+strings.TrimPrefix(id, "id: ")+`,"op":"upsert","path":"/a","value":1}` {
+		t.Fatalf("unexpected event data: %q", data)
+	}
+
+	if err := f.v1(http.MethodPut, "/data/a", `2`, 204, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	id = ws.next()
+	ws.next()
+	ws.close()
+
+	// Clients using Server-Sent Events resume with the last event ID.
+	resumed := newWatchStream(t, ts, "/v1/data/a?watch=true", http.Header{"Accept": {"text/event-stream"}, "Last-Event-Id": {strings.TrimPrefix(id, "id: ")}})
+	defer resumed.close()
+
+	if next := resumed.next(); next != id {
+		t.Fatalf("expected %q but got %q", id, next)
+	}
+	if data := resumed.next(); !strings.Contains(data, `"op":"upsert","path":"/a","value":2`) {
+		t.Fatalf("unexpected event data: %q", data)
+	}
+}
+
+func TestDataWatchBadRevision(t *testing.T) {
+	f := newFixture(t)
+	if err := f.v1(http.MethodGet, "/data/a?watch=true&revision=x", "", 400, `{
+		"code": "invalid_parameter",
+		"message": "invalid revision: x"
+	}`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDataWatcherStopsRecordingWhenIdle(t *testing.T) {
+
+	ctx := context.Background()
+	dw := newDataWatcher()
+	event := storage.TriggerEvent{Data: []storage.DataEvent{{Path: storage.MustParsePath("/a"), Data: 1}}}
+
+	dw.onCommit(ctx, nil, event)
+
+	if len(dw.history) != 0 {
+		t.Fatalf("expected no history before the first watch but got %d revisions", len(dw.history))
+	}
+
+	w, _, since, _ := dw.watch(nil)
+	dw.onCommit(ctx, nil, event)
+
+	if len(dw.history) != 1 {
+		t.Fatalf("expected 1 revision but got %d", len(dw.history))
+	}
+
+	dw.unwatch(w)
+
+	if dw.recording || dw.history != nil || dw.size != 0 {
+		t.Fatalf("expected recording to stop but got recording=%v, %d revisions of %d bytes", dw.recording, len(dw.history), dw.size)
+	}
+
+	dw.onCommit(ctx, nil, event)
+
+	if len(dw.history) != 0 {
+		t.Fatalf("expected no history without watches but got %d revisions", len(dw.history))
+	}
+
+	since++
+	if _, backlog, _, resumed := dw.watch(&since); resumed || len(backlog) != 0 {
+		t.Fatalf("expected watch to start over but got resumed=%v with %d revisions", resumed, len(backlog))
+	}
+}
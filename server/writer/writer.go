@@ -25,19 +25,27 @@ func HTTPStatus(code int) http.HandlerFunc {
 // ErrorAuto writes a response with status and code set automatically based on
 // the type of err.
 func ErrorAuto(w http.ResponseWriter, err error) {
+	status, e := AutoErrorV1(err)
+	Error(w, status, e)
+}
+
+// AutoErrorV1 returns the status and error response that ErrorAuto would write
+// for err. It is useful for handlers that report errors inside a response body
+// rather than as the response itself.
+func AutoErrorV1(err error) (int, *types.ErrorV1) {
 	switch {
 	case types.IsBadRequest(err):
-		ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, err)
+		return http.StatusBadRequest, types.NewErrorV1(types.CodeInvalidParameter, err.Error())
 	case storage.IsWriteConflictError(err):
-		ErrorString(w, http.StatusNotFound, types.CodeResourceConflict, err)
+		return http.StatusNotFound, types.NewErrorV1(types.CodeResourceConflict, err.Error())
 	case topdown.IsError(err):
-		Error(w, http.StatusInternalServerError, types.NewErrorV1(types.CodeInternal, types.MsgEvaluationError).WithError(err))
+		return http.StatusInternalServerError, types.NewErrorV1(types.CodeInternal, types.MsgEvaluationError).WithError(err)
 	case storage.IsInvalidPatch(err):
-		ErrorString(w, http.StatusBadRequest, types.CodeInvalidParameter, err)
+		return http.StatusBadRequest, types.NewErrorV1(types.CodeInvalidParameter, err.Error())
 	case storage.IsNotFound(err):
-		ErrorString(w, http.StatusNotFound, types.CodeResourceNotFound, err)
+		return http.StatusNotFound, types.NewErrorV1(types.CodeResourceNotFound, err.Error())
 	default:
-		ErrorString(w, http.StatusInternalServerError, types.CodeInternal, err)
+		return http.StatusInternalServerError, types.NewErrorV1(types.CodeInternal, err.Error())
 	}
 }
 
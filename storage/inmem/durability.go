@@ -0,0 +1,581 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package inmem
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+
+	"github.com/open-policy-agent/opa/config"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/internal/ptr"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const (
+	defaultSnapshotThreshold = 1000
+	walFile                  = "wal"
+	snapshotFile             = "snapshot.json"
+	walRecordHeaderSize      = 8 // payload length and CRC-32 of the payload
+)
+
+// bundlesBasePath is the storage path of the bundle metadata. It mirrors
+// bundle.BundlesBasePath, which cannot be imported here.
+var bundlesBasePath = storage.MustParsePath("/system/bundles")
+
+// DurabilityConfig represents the configuration of the durability mode of the
+// in-memory store.
+type DurabilityConfig struct {
+	Directory         string `json:"directory"`                    // directory holding the snapshot and write-ahead log
+	AutoCreate        bool   `json:"auto_create"`                  // if true, the directory is created if it does not exist
+	SnapshotThreshold *int   `json:"snapshot_threshold,omitempty"` // number of logged transactions after which a snapshot is written
+	Sync              bool   `json:"sync"`                         // if true, the write-ahead log is synced to disk on every commit
+}
+
+func (c *DurabilityConfig) validateAndInjectDefaults() error {
+
+	if c.Directory == "" {
+		return fmt.Errorf("missing directory in inmem storage")
+	}
+
+	if _, err := os.Stat(c.Directory); err != nil {
+		if os.IsNotExist(err) && c.AutoCreate {
+			err = os.MkdirAll(c.Directory, 0700) // overwrite err
+		}
+		if err != nil {
+			return fmt.Errorf("directory %v invalid: %w", c.Directory, err)
+		}
+	}
+
+	if c.SnapshotThreshold == nil {
+		threshold := defaultSnapshotThreshold
+		c.SnapshotThreshold = &threshold
+	} else if *c.SnapshotThreshold <= 0 {
+		return fmt.Errorf("snapshot_threshold must be positive in inmem storage")
+	}
+
+	return nil
+}
+
+// DurabilityConfigFromConfig parses the passed config, extracts the inmem
+// storage settings, validates them, and returns a *DurabilityConfig on
+// success. If durability is not configured, nil is returned.
+func DurabilityConfigFromConfig(raw []byte, id string) (*DurabilityConfig, error) {
+	parsedConfig, err := config.ParseConfig(raw, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsedConfig.Storage == nil || len(parsedConfig.Storage.Inmem) == 0 {
+		return nil, nil
+	}
+
+	var c DurabilityConfig
+	if err := util.Unmarshal(parsedConfig.Storage.Inmem, &c); err != nil {
+		return nil, err
+	}
+
+	if err := c.validateAndInjectDefaults(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// walRecord is the payload of a write-ahead log record. Every record holds
+// the changes of one committed transaction.
+type walRecord struct {
+	Seq      uint64        `json:"seq"`
+	Data     []walDataOp   `json:"data,omitempty"`
+	Policies []walPolicyOp `json:"policies,omitempty"`
+}
+
+type walDataOp struct {
+	Path    storage.Path `json:"path"`
+	Value   interface{}  `json:"value,omitempty"`
+	Removed bool         `json:"removed,omitempty"`
+}
+
+type walPolicyOp struct {
+	ID      string `json:"id"`
+	Value   []byte `json:"value,omitempty"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+// walSnapshot is the content of the snapshot file. Seq is the sequence number
+// of the last record included in the snapshot.
+type walSnapshot struct {
+	Seq      uint64                 `json:"seq"`
+	Data     map[string]interface{} `json:"data"`
+	Policies map[string][]byte      `json:"policies"`
+}
+
+// durability implements the durability mode of the store. Every committed
+// write transaction is appended to the write-ahead log before it becomes
+// visible. Once the number of records exceeds the snapshot threshold, the
+// store content is written to a snapshot file and the log is truncated.
+//
+// Data owned by bundles (i.e., data below the roots of activated bundles and
+// the bundle metadata itself) and the policies written by bundle activations
+// are not persisted, since bundles are activated again after a restart.
+//
+// Every record consists of the payload length and CRC-32 followed by the
+// payload. When the store is opened, incomplete or corrupted records at the
+// end of the log (e.g., because OPA was killed during a write) are truncated.
+type durability struct {
+	config         DurabilityConfig
+	wal            *os.File
+	seq            uint64              // sequence number of the last record
+	records        int                 // number of records since the last snapshot
+	bundlePolicies map[string]struct{} // ids of policies written by bundle activations
+}
+
+// openDurability recovers the content of db from the snapshot and the
+// write-ahead log in the configured directory.
+func openDurability(db *store, c DurabilityConfig) (*durability, error) {
+
+	if err := c.validateAndInjectDefaults(); err != nil {
+		return nil, err
+	}
+
+	d := &durability{
+		config:         c,
+		bundlePolicies: map[string]struct{}{},
+	}
+
+	if err := d.readSnapshot(db); err != nil {
+		return nil, err
+	}
+
+	if err := d.replay(db); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(d.path(walFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	d.wal = f
+
+	return d, nil
+}
+
+func (d *durability) path(name string) string {
+	return filepath.Join(d.config.Directory, name)
+}
+
+func (d *durability) readSnapshot(db *store) error {
+
+	f, err := os.Open(d.path(snapshotFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	defer f.Close()
+
+	var snapshot walSnapshot
+	if err := util.NewJSONDecoder(bufio.NewReader(f)).Decode(&snapshot); err != nil {
+		return fmt.Errorf("corrupted snapshot %v: %w", d.path(snapshotFile), err)
+	}
+
+	if snapshot.Data != nil {
+		db.data = snapshot.Data
+	}
+
+	for id, bs := range snapshot.Policies {
+		db.policies[id] = bs
+	}
+
+	d.seq = snapshot.Seq
+
+	return nil
+}
+
+// replay applies the records following the snapshot to db and truncates the
+// log at the first invalid record.
+func (d *durability) replay(db *store) error {
+
+	f, err := os.OpenFile(d.path(walFile), os.O_RDWR, 0600)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	header := make([]byte, walRecordHeaderSize)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+
+		size := binary.BigEndian.Uint32(header[0:4])
+		bs := make([]byte, size)
+		if _, err := io.ReadFull(r, bs); err != nil || crc32.ChecksumIEEE(bs) != binary.BigEndian.Uint32(header[4:8]) {
+			break
+		}
+
+		var record walRecord
+		if err := util.UnmarshalJSON(bs, &record); err != nil {
+			break
+		}
+
+		offset += int64(walRecordHeaderSize) + int64(size)
+
+		// Records that are already included in the snapshot are skipped. They
+		// remain if OPA was stopped between writing the snapshot and
+		// truncating the log.
+		if record.Seq <= d.seq {
+			continue
+		}
+
+		if err := apply(db, record); err != nil {
+			return fmt.Errorf("replay record %d: %w", record.Seq, err)
+		}
+
+		d.seq = record.Seq
+		d.records++
+	}
+
+	return f.Truncate(offset)
+}
+
+func apply(db *store, record walRecord) error {
+
+	for _, op := range record.Data {
+		if len(op.Path) == 0 {
+			obj, ok := op.Value.(map[string]interface{})
+			if !ok {
+				return invalidPatchError(rootMustBeObjectMsg)
+			}
+			db.data = obj
+			continue
+		}
+		if err := set(db.data, op.Path, op.Value, op.Removed); err != nil {
+			return err
+		}
+	}
+
+	for _, op := range record.Policies {
+		if op.Removed {
+			delete(db.policies, op.ID)
+		} else {
+			db.policies[op.ID] = op.Value
+		}
+	}
+
+	return nil
+}
+
+// set sets (or removes) the value at path. Missing objects along the path are
+// created, since their creation may not have been logged if they are owned by
+// a bundle.
+func set(data interface{}, path storage.Path, value interface{}, remove bool) error {
+
+	for i := 0; i < len(path)-1; i++ {
+		switch node := data.(type) {
+		case map[string]interface{}:
+			child, ok := node[path[i]]
+			if !ok {
+				if remove {
+					return nil
+				}
+				child = map[string]interface{}{}
+				node[path[i]] = child
+			}
+			data = child
+		case []interface{}:
+			idx, err := ptr.ValidateArrayIndex(node, path[i], path)
+			if err != nil {
+				return err
+			}
+			data = node[idx]
+		default:
+			return invalidPatchError("%v: invalid patch path", path)
+		}
+	}
+
+	key := path[len(path)-1]
+
+	switch node := data.(type) {
+	case map[string]interface{}:
+		if remove {
+			delete(node, key)
+		} else {
+			node[key] = value
+		}
+		return nil
+	case []interface{}:
+		idx, err := strconv.Atoi(key)
+		if err != nil || idx < 0 || idx >= len(node) || remove {
+			return invalidPatchError("%v: invalid patch path", path)
+		}
+		node[idx] = value
+		return nil
+	}
+
+	return invalidPatchError("%v: invalid patch path", path)
+}
+
+// log appends the changes of txn to the write-ahead log. It must be called
+// before txn is committed.
+func (d *durability) log(txn *transaction) error {
+
+	excluded, bundleTxn, err := d.excludedPaths(txn)
+	if err != nil {
+		return err
+	}
+
+	record := walRecord{Seq: d.seq + 1}
+
+	for curr := txn.updates.Front(); curr != nil; curr = curr.Next() {
+		update := curr.Value.(*update)
+		if isExcluded(update.path, excluded) {
+			continue
+		}
+		op := walDataOp{Path: update.path, Removed: update.remove}
+		if !update.remove {
+			op.Value = prune(update.path, update.value, excluded)
+		}
+		record.Data = append(record.Data, op)
+	}
+
+	// Bundle activations modify the bundle metadata. The policies written by
+	// them are owned by the bundles.
+	for id, update := range txn.policies {
+		if bundleTxn {
+			if update.remove {
+				delete(d.bundlePolicies, id)
+			} else {
+				d.bundlePolicies[id] = struct{}{}
+			}
+			continue
+		}
+		delete(d.bundlePolicies, id)
+		record.Policies = append(record.Policies, walPolicyOp{ID: id, Value: update.value, Removed: update.remove})
+	}
+
+	if len(record.Data) == 0 && len(record.Policies) == 0 {
+		return nil
+	}
+
+	bs, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, walRecordHeaderSize+len(bs))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(bs)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(bs))
+	copy(buf[walRecordHeaderSize:], bs)
+
+	// A single write keeps the log readable up to the last complete record if
+	// OPA is stopped in the middle of it.
+	if _, err := d.wal.Write(buf); err != nil {
+		return err
+	}
+
+	if d.config.Sync {
+		if err := d.wal.Sync(); err != nil {
+			return err
+		}
+	}
+
+	d.seq = record.Seq
+	d.records++
+
+	return nil
+}
+
+// excludedPaths returns the bundle metadata path and the roots of the bundles
+// that are activated before or after txn is committed. It also reports if txn
+// modifies the bundle metadata, i.e., if it activates or deactivates bundles.
+func (d *durability) excludedPaths(txn *transaction) ([]storage.Path, bool, error) {
+
+	result := []storage.Path{bundlesBasePath}
+
+	before, err := ptr.Ptr(txn.data, bundlesBasePath)
+	if err != nil && !storage.IsNotFound(err) {
+		return nil, false, err
+	}
+
+	after, err := txn.Read(bundlesBasePath)
+	if err != nil && !storage.IsNotFound(err) {
+		return nil, false, err
+	}
+
+	changed := !reflect.DeepEqual(before, after)
+
+	for _, bundles := range []interface{}{before, after} {
+		obj, ok := bundles.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name := range obj {
+			roots, err := ptr.Ptr(obj, storage.Path{name, "manifest", "roots"})
+			if err != nil {
+				// Manifests without roots claim the entire data tree.
+				return []storage.Path{{}}, changed, nil
+			}
+			arr, ok := roots.([]interface{})
+			if !ok {
+				continue
+			}
+			for _, root := range arr {
+				s, ok := root.(string)
+				if !ok {
+					continue
+				}
+				if s == "" {
+					return []storage.Path{{}}, changed, nil
+				}
+				p, ok := storage.ParsePathEscaped("/" + s)
+				if ok {
+					result = append(result, p)
+				}
+			}
+		}
+	}
+
+	return result, changed, nil
+}
+
+func isExcluded(path storage.Path, excluded []storage.Path) bool {
+	for _, p := range excluded {
+		if path.HasPrefix(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// prune returns value, which is stored at path, without the subtrees at the
+// excluded paths below path. Objects on the way to the pruned subtrees are
+// copied; value is not modified.
+func prune(path storage.Path, value interface{}, excluded []storage.Path) interface{} {
+	for _, p := range excluded {
+		if len(p) > len(path) && p.HasPrefix(path) {
+			value = without(value, p[len(path):])
+		}
+	}
+	return value
+}
+
+func without(value interface{}, path storage.Path) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	child, ok := obj[path[0]]
+	if !ok {
+		return value
+	}
+	cpy := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		cpy[k] = v
+	}
+	if len(path) == 1 {
+		delete(cpy, path[0])
+	} else {
+		cpy[path[0]] = without(child, path[1:])
+	}
+	return cpy
+}
+
+// maybeSnapshot writes a snapshot of db and truncates the write-ahead log if
+// the snapshot threshold has been reached. It must be called while holding the
+// write lock, i.e., while the data cannot be modified.
+func (d *durability) maybeSnapshot(db *store) error {
+
+	if d.records < *d.config.SnapshotThreshold {
+		return nil
+	}
+
+	excluded, _, err := d.excludedPaths(newTransaction(0, false, nil, db))
+	if err != nil {
+		return err
+	}
+
+	snapshot := walSnapshot{
+		Seq:      d.seq,
+		Data:     map[string]interface{}{},
+		Policies: make(map[string][]byte, len(db.policies)),
+	}
+
+	if !isExcluded(storage.Path{}, excluded) {
+		snapshot.Data = prune(storage.Path{}, db.data, excluded).(map[string]interface{})
+	}
+
+	for id, bs := range db.policies {
+		if _, ok := d.bundlePolicies[id]; !ok {
+			snapshot.Policies[id] = bs
+		}
+	}
+
+	tmp := d.path(snapshotFile + ".tmp")
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	err = json.NewEncoder(w).Encode(snapshot)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, d.path(snapshotFile)); err != nil {
+		return err
+	}
+
+	// The log only holds records that are included in the snapshot now.
+	if err := d.wal.Truncate(0); err != nil {
+		return err
+	}
+
+	d.records = 0
+
+	return nil
+}
+
+func (d *durability) close() error {
+	if d.wal == nil {
+		return nil
+	}
+	err := d.wal.Close()
+	d.wal = nil
+	if errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,330 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package inmem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/util"
+)
+
+func openDurableStore(t *testing.T, dir string, threshold int) storage.Store {
+	t.Helper()
+	store, err := Open(OptDurability(DurabilityConfig{Directory: dir, SnapshotThreshold: &threshold}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func closeStore(t *testing.T, s storage.Store) {
+	t.Helper()
+	if err := s.(*store).Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustWrite(t *testing.T, store storage.Store, op storage.PatchOp, path string, value string) {
+	t.Helper()
+	ctx := context.Background()
+	err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		var v interface{}
+		if value != "" {
+			v = util.MustUnmarshalJSON([]byte(value))
+		}
+		return store.Write(ctx, txn, op, storage.MustParsePath(path), v)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertData(t *testing.T, store storage.Store, exp string) {
+	t.Helper()
+	result, err := storage.ReadOne(context.Background(), store, storage.Path{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := util.MustUnmarshalJSON([]byte(exp)); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %v but got %v", expected, result)
+	}
+}
+
+func assertPolicies(t *testing.T, store storage.Store, exp map[string]string) {
+	t.Helper()
+	ctx := context.Background()
+	txn := storage.NewTransactionOrDie(ctx, store)
+	defer store.Abort(ctx, txn)
+	ids, err := store.ListPolicies(ctx, txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := map[string]string{}
+	for _, id := range ids {
+		bs, err := store.GetPolicy(ctx, txn, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result[id] = string(bs)
+	}
+	if !reflect.DeepEqual(result, exp) {
+		t.Fatalf("expected policies %v but got %v", exp, result)
+	}
+}
+
+func TestDurabilityRecovery(t *testing.T) {
+
+	for _, threshold := range []int{1000, 2} {
+		dir := t.TempDir()
+		ctx := context.Background()
+
+		store := openDurableStore(t, dir, threshold)
+
+		mustWrite(t, store, storage.AddOp, "/a", `{"b": [1, 2, 3], "c": "x"}`)
+		mustWrite(t, store, storage.ReplaceOp, "/a/b/1", `20`)
+		mustWrite(t, store, storage.AddOp, "/a/b/-", `4`)
+		mustWrite(t, store, storage.RemoveOp, "/a/c", ``)
+		mustWrite(t, store, storage.AddOp, "/d", `null`)
+
+		err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+			if err := store.UpsertPolicy(ctx, txn, "p1", []byte("package p1")); err != nil {
+				return err
+			}
+			return store.UpsertPolicy(ctx, txn, "p2", []byte("package p2"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+			return store.DeletePolicy(ctx, txn, "p2")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		closeStore(t, store)
+
+		if _, err := os.Stat(filepath.Join(dir, snapshotFile)); (threshold == 2) != (err == nil) {
+			t.Fatalf("threshold %d: unexpected snapshot state: %v", threshold, err)
+		}
+
+		store = openDurableStore(t, dir, threshold)
+
+		assertData(t, store, `{"a": {"b": [1, 20, 3, 4]}, "d": null}`)
+		assertPolicies(t, store, map[string]string{"p1": "package p1"})
+
+		// Verify that the recovered store keeps logging.
+		mustWrite(t, store, storage.AddOp, "/e", `"y"`)
+		closeStore(t, store)
+
+		store = openDurableStore(t, dir, threshold)
+		assertData(t, store, `{"a": {"b": [1, 20, 3, 4]}, "d": null, "e": "y"}`)
+		closeStore(t, store)
+	}
+}
+
+func TestDurabilityTruncatesInvalidRecords(t *testing.T) {
+
+	dir := t.TempDir()
+
+	store := openDurableStore(t, dir, 1000)
+	mustWrite(t, store, storage.AddOp, "/a", `1`)
+	mustWrite(t, store, storage.AddOp, "/b", `2`)
+	closeStore(t, store)
+
+	path := filepath.Join(dir, walFile)
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a write that was interrupted.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0, 0, 1, 0, 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	store = openDurableStore(t, dir, 1000)
+	assertData(t, store, `{"a": 1, "b": 2}`)
+
+	if fi2, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if fi2.Size() != fi.Size() {
+		t.Fatalf("expected log to be truncated to %d bytes but got %d", fi.Size(), fi2.Size())
+	}
+
+	mustWrite(t, store, storage.AddOp, "/c", `3`)
+	closeStore(t, store)
+
+	store = openDurableStore(t, dir, 1000)
+	assertData(t, store, `{"a": 1, "b": 2, "c": 3}`)
+	closeStore(t, store)
+}
+
+func TestDurabilityExcludesBundles(t *testing.T) {
+
+	for _, threshold := range []int{1000, 1} {
+		dir := t.TempDir()
+		ctx := context.Background()
+
+		store := openDurableStore(t, dir, threshold)
+
+		// Activate a bundle owning /x.
+		err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+			if err := storage.MakeDir(ctx, store, txn, storage.MustParsePath("/system/bundles/b1")); err != nil {
+				return err
+			}
+			manifest := util.MustUnmarshalJSON([]byte(`{"revision": "r1", "roots": ["x"]}`))
+			if err := store.Write(ctx, txn, storage.AddOp, storage.MustParsePath("/system/bundles/b1/manifest"), manifest); err != nil {
+				return err
+			}
+			if err := store.Write(ctx, txn, storage.AddOp, storage.MustParsePath("/x"), map[string]interface{}{"y": 1}); err != nil {
+				return err
+			}
+			return store.UpsertPolicy(ctx, txn, "b1/x.rego", []byte("package x"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Direct writes outside of the bundle roots are persisted.
+		mustWrite(t, store, storage.AddOp, "/z", `{"w": true}`)
+
+		err = storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+			return store.UpsertPolicy(ctx, txn, "user.rego", []byte("package user"))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Writes above the bundle roots are persisted without the bundle owned
+		// data.
+		mustWrite(t, store, storage.ReplaceOp, "/system", `{"config": {"k": "v"}, "bundles": {"b1": {"manifest": {"revision": "r1", "roots": ["x"]}}}}`)
+
+		assertData(t, store, `{
+			"system": {"config": {"k": "v"}, "bundles": {"b1": {"manifest": {"revision": "r1", "roots": ["x"]}}}},
+			"x": {"y": 1},
+			"z": {"w": true}
+		}`)
+
+		closeStore(t, store)
+
+		store = openDurableStore(t, dir, threshold)
+
+		assertData(t, store, `{"system": {"config": {"k": "v"}}, "z": {"w": true}}`)
+		assertPolicies(t, store, map[string]string{"user.rego": "package user"})
+
+		closeStore(t, store)
+	}
+}
+
+func TestDurabilityTriggers(t *testing.T) {
+
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store := openDurableStore(t, dir, 1)
+	mustWrite(t, store, storage.AddOp, "/a", `1`)
+	closeStore(t, store)
+
+	store = openDurableStore(t, dir, 1)
+
+	var paths []string
+	err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		_, err := store.Register(ctx, txn, storage.TriggerConfig{
+			OnCommit: func(_ context.Context, _ storage.Transaction, event storage.TriggerEvent) {
+				for _, e := range event.Data {
+					paths = append(paths, e.Path.String())
+				}
+			},
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustWrite(t, store, storage.AddOp, "/b", `2`)
+	mustWrite(t, store, storage.AddOp, "/c", `3`)
+
+	sort.Strings(paths)
+
+	if exp := []string{"/b", "/c"}; !reflect.DeepEqual(paths, exp) {
+		t.Fatalf("expected %v but got %v", exp, paths)
+	}
+
+	closeStore(t, store)
+}
+
+func TestDurabilityConfigFromConfig(t *testing.T) {
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		note   string
+		config string
+		exp    *DurabilityConfig
+		err    string
+	}{
+		{
+			note:   "not configured",
+			config: `{}`,
+		},
+		{
+			note:   "defaults",
+			config: `{"storage": {"inmem": {"directory": "` + dir + `"}}}`,
+			exp:    &DurabilityConfig{Directory: dir, SnapshotThreshold: intPtr(defaultSnapshotThreshold)},
+		},
+		{
+			note:   "auto create",
+			config: `{"storage": {"inmem": {"directory": "` + filepath.Join(dir, "new") + `", "auto_create": true, "snapshot_threshold": 5, "sync": true}}}`,
+			exp:    &DurabilityConfig{Directory: filepath.Join(dir, "new"), AutoCreate: true, SnapshotThreshold: intPtr(5), Sync: true},
+		},
+		{
+			note:   "missing directory",
+			config: `{"storage": {"inmem": {"directory": "` + filepath.Join(dir, "missing") + `"}}}`,
+			err:    "directory " + filepath.Join(dir, "missing") + " invalid",
+		},
+		{
+			note:   "invalid threshold",
+			config: `{"storage": {"inmem": {"directory": "` + dir + `", "snapshot_threshold": 0}}}`,
+			err:    "snapshot_threshold must be positive in inmem storage",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			c, err := DurabilityConfigFromConfig([]byte(tc.config), "id")
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q but got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c, tc.exp) {
+				t.Fatalf("expected %+v but got %+v", tc.exp, c)
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -7,7 +7,10 @@
 //
 // The in-memory store is used as the default storage layer implementation. The
 // in-memory store supports multi-reader/single-writer concurrency with
-// rollback.
+// rollback. Read transactions see a snapshot of the store taken when they are
+// started: they do not block writers and are not affected by transactions
+// committed while they are open. Committed versions share all unmodified data
+// and are garbage collected once no transaction refers to them.
 //
 // Callers should assume the in-memory store does not make copies of written
 // data. Once data is written to the in-memory store, it should not be modified
@@ -35,7 +38,21 @@ func New() storage.Store {
 }
 
 // NewWithOpts returns an empty in-memory store, with extra options passed.
+// If durability is enabled with OptDurability and the store cannot be
+// recovered, NewWithOpts panics; use Open to handle the error instead.
 func NewWithOpts(opts ...Opt) storage.Store {
+	s, err := Open(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Open returns an in-memory store, with extra options passed. If durability
+// is enabled with OptDurability, the store content is recovered from the
+// snapshot and write-ahead log in the configured directory. The returned store
+// implements Close, which releases the write-ahead log.
+func Open(opts ...Opt) (storage.Store, error) {
 	s := &store{
 		data:             map[string]interface{}{},
 		triggers:         map[*handle]storage.TriggerConfig{},
@@ -47,7 +64,15 @@ func NewWithOpts(opts ...Opt) storage.Store {
 		opt(s)
 	}
 
-	return s
+	if s.durabilityConfig != nil {
+		d, err := openDurability(s, *s.durabilityConfig)
+		if err != nil {
+			return nil, fmt.Errorf("open inmem store: %w", err)
+		}
+		s.durability = d
+	}
+
+	return s, nil
 }
 
 // NewFromObject returns a new in-memory store from the supplied data object.
@@ -91,16 +116,22 @@ func NewFromReaderWithOpts(r io.Reader, opts ...Opt) storage.Store {
 }
 
 type store struct {
-	rmu      sync.RWMutex                      // reader-writer lock
-	wmu      sync.Mutex                        // writer lock
-	xid      uint64                            // last generated transaction id
-	data     map[string]interface{}            // raw data
-	policies map[string][]byte                 // raw policies
-	triggers map[*handle]storage.TriggerConfig // registered triggers
+	rmu       sync.RWMutex                      // reader-writer lock, held by readers while taking a snapshot
+	wmu       sync.Mutex                        // writer lock
+	xid       uint64                            // last generated transaction id
+	readers   int64                             // number of open read transactions
+	snapshots uint64                            // number of snapshots taken by read transactions
+	copier    copier                            // applies updates while read transactions are open
+	data      map[string]interface{}            // raw data
+	policies  map[string][]byte                 // raw policies
+	triggers  map[*handle]storage.TriggerConfig // registered triggers
 
 	// roundTripOnWrite, if true, means that every call to Write round trips the
 	// data through JSON before adding the data to the store. Defaults to true.
 	roundTripOnWrite bool
+
+	durabilityConfig *DurabilityConfig // set by OptDurability
+	durability       *durability       // persists committed transactions, if enabled
 }
 
 type handle struct {
@@ -117,10 +148,16 @@ func (db *store) NewTransaction(_ context.Context, params ...storage.Transaction
 	xid := atomic.AddUint64(&db.xid, uint64(1))
 	if write {
 		db.wmu.Lock()
-	} else {
-		db.rmu.RLock()
-	}
-	return newTransaction(xid, write, ctx, db), nil
+		return newTransaction(xid, write, ctx, db), nil
+	}
+	// The reader lock is only held while taking the snapshot, which ensures
+	// that commits see every reader that may refer to the current version.
+	db.rmu.RLock()
+	atomic.AddInt64(&db.readers, 1)
+	atomic.AddUint64(&db.snapshots, 1)
+	txn := newTransaction(xid, write, ctx, db)
+	db.rmu.RUnlock()
+	return txn, nil
 }
 
 // Truncate implements the storage.Store interface. This method must be called within a transaction.
@@ -212,6 +249,15 @@ func (db *store) Commit(ctx context.Context, txn storage.Transaction) error {
 		return err
 	}
 	if underlying.write {
+		if db.durability != nil {
+			// The transaction is logged before it becomes visible. If that
+			// fails, the transaction is aborted.
+			if err := db.durability.log(underlying); err != nil {
+				underlying.stale = true
+				db.wmu.Unlock()
+				return wrapDurabilityError(err)
+			}
+		}
 		db.rmu.Lock()
 		event := underlying.Commit()
 		db.runOnCommitTriggers(ctx, txn, event)
@@ -219,13 +265,30 @@ func (db *store) Commit(ctx context.Context, txn storage.Transaction) error {
 		// perform store operations if needed.
 		underlying.stale = true
 		db.rmu.Unlock()
+		// Snapshots are taken while holding the writer lock only, so readers
+		// are not blocked. Failures are not fatal because the transaction has
+		// been logged; the snapshot is retried on the next commit.
+		if db.durability != nil {
+			_ = db.durability.maybeSnapshot(db)
+		}
 		db.wmu.Unlock()
 	} else {
-		db.rmu.RUnlock()
+		atomic.AddInt64(&db.readers, -1)
 	}
 	return nil
 }
 
+// Close releases the write-ahead log if durability is enabled. The store must
+// not be used after it has been closed.
+func (db *store) Close(context.Context) error {
+	db.wmu.Lock()
+	defer db.wmu.Unlock()
+	if db.durability == nil {
+		return nil
+	}
+	return wrapDurabilityError(db.durability.close())
+}
+
 func (db *store) Abort(_ context.Context, txn storage.Transaction) {
 	underlying, err := db.underlying(txn)
 	if err != nil {
@@ -235,7 +298,7 @@ func (db *store) Abort(_ context.Context, txn storage.Transaction) {
 	if underlying.write {
 		db.wmu.Unlock()
 	} else {
-		db.rmu.RUnlock()
+		atomic.AddInt64(&db.readers, -1)
 	}
 }
 
@@ -355,6 +418,16 @@ func (db *store) underlying(txn storage.Transaction) (*transaction, error) {
 	return underlying, nil
 }
 
+func wrapDurabilityError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &storage.Error{
+		Code:    storage.InternalErr,
+		Message: fmt.Sprintf("write-ahead log: %v", err),
+	}
+}
+
 const rootMustBeObjectMsg = "root must be object"
 const rootCannotBeRemovedMsg = "root cannot be removed"
 
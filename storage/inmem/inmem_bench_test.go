@@ -0,0 +1,84 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package inmem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/open-policy-agent/opa/storage"
+)
+
+// BenchmarkMixedReadWrite measures the throughput of writers while readers
+// keep scanning the store in long-running transactions, e.g., like policies
+// that walk large documents.
+func BenchmarkMixedReadWrite(b *testing.B) {
+
+	const n = 1000
+	ctx := context.Background()
+
+	for _, readers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("readers=%d", readers), func(b *testing.B) {
+
+			users := make(map[string]interface{}, n)
+			paths := make([]storage.Path, n)
+			for i := 0; i < n; i++ {
+				key := fmt.Sprintf("user%d", i)
+				users[key] = map[string]interface{}{"name": key, "count": json.Number("0")}
+				paths[i] = storage.Path{"users", key, "count"}
+			}
+
+			store := NewFromObject(map[string]interface{}{"users": users})
+
+			var reads int64
+			var wg sync.WaitGroup
+			done := make(chan struct{})
+
+			for i := 0; i < readers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-done:
+							return
+						default:
+						}
+						txn := storage.NewTransactionOrDie(ctx, store)
+						for _, path := range paths {
+							if _, err := store.Read(ctx, txn, path); err != nil {
+								panic(err)
+							}
+						}
+						store.Abort(ctx, txn)
+						atomic.AddInt64(&reads, 1)
+					}
+				}()
+			}
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				txn := storage.NewTransactionOrDie(ctx, store, storage.WriteParams)
+				if err := store.Write(ctx, txn, storage.ReplaceOp, paths[i%n], json.Number(fmt.Sprint(i))); err != nil {
+					b.Fatal(err)
+				}
+				if err := store.Commit(ctx, txn); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.StopTimer()
+			close(done)
+			wg.Wait()
+
+			b.ReportMetric(float64(atomic.LoadInt64(&reads))/float64(b.N), "scans/op")
+		})
+	}
+}
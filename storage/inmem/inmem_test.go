@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"runtime"
 	"testing"
 
 	"github.com/open-policy-agent/opa/bundle"
@@ -710,6 +711,165 @@ func TestInMemoryTxnPolicies(t *testing.T) {
 
 }
 
+func TestInMemorySnapshotReads(t *testing.T) {
+
+	ctx := context.Background()
+	store := NewFromObject(map[string]interface{}{
+		"a": map[string]interface{}{"b": json.Number("1"), "c": []interface{}{json.Number("2")}},
+		"d": map[string]interface{}{"e": json.Number("3")},
+	})
+
+	err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		return store.UpsertPolicy(ctx, txn, "p1", []byte("package p1"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := storage.NewTransactionOrDie(ctx, store)
+	unmodified, err := store.Read(ctx, before, storage.MustParsePath("/d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writers are not blocked by the open read transaction.
+	err = storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+		for _, w := range []struct {
+			op    storage.PatchOp
+			path  string
+			value interface{}
+		}{
+			{storage.ReplaceOp, "/a/b", json.Number("10")},
+			{storage.AddOp, "/a/c/-", json.Number("20")},
+			{storage.RemoveOp, "/a/c/0", nil},
+			{storage.AddOp, "/f", "x"},
+		} {
+			if err := store.Write(ctx, txn, w.op, storage.MustParsePath(w.path), w.value); err != nil {
+				return err
+			}
+		}
+		if err := store.DeletePolicy(ctx, txn, "p1"); err != nil {
+			return err
+		}
+		return store.UpsertPolicy(ctx, txn, "p2", []byte("package p2"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := storage.NewTransactionOrDie(ctx, store)
+
+	for _, tc := range []struct {
+		txn      storage.Transaction
+		data     string
+		policies []string
+	}{
+		{before, `{"a": {"b": 1, "c": [2]}, "d": {"e": 3}}`, []string{"p1"}},
+		{after, `{"a": {"b": 10, "c": [20]}, "d": {"e": 3}, "f": "x"}`, []string{"p2"}},
+	} {
+		result, err := store.Read(ctx, tc.txn, storage.Path{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := util.MustUnmarshalJSON([]byte(tc.data)); util.Compare(exp, result) != 0 {
+			t.Errorf("expected %v but got %v", exp, result)
+		}
+		ids, err := store.ListPolicies(ctx, tc.txn)
+		if err != nil || !reflect.DeepEqual(ids, tc.policies) {
+			t.Errorf("expected policies %v but got %v (err: %v)", tc.policies, ids, err)
+		}
+		if _, err := store.GetPolicy(ctx, tc.txn, tc.policies[0]); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Data that was not modified is shared between versions.
+	shared, err := store.Read(ctx, after, storage.MustParsePath("/d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.ValueOf(shared).Pointer() != reflect.ValueOf(unmodified).Pointer() {
+		t.Error("expected unmodified data to be shared")
+	}
+
+	store.Abort(ctx, before)
+	store.Abort(ctx, after)
+
+	// Without open read transactions, updates are applied in place.
+	mustWrite(t, store, storage.AddOp, "/d/g", `4`)
+
+	if e, ok := unmodified.(map[string]interface{})["g"]; !ok || util.Compare(e, json.Number("4")) != 0 {
+		t.Errorf("expected update to be applied in place but got %v", unmodified)
+	}
+}
+
+func TestInMemoryConcurrentReadWrite(t *testing.T) {
+
+	ctx := context.Background()
+	store := NewFromObject(map[string]interface{}{
+		"x": map[string]interface{}{"a": json.Number("0"), "b": json.Number("0")},
+	})
+
+	const writes = 100
+	done := make(chan struct{})
+	errs := make(chan error, 4)
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					errs <- nil
+					return
+				default:
+				}
+				// Both values are always written in the same transaction, so
+				// every snapshot must contain equal values.
+				err := storage.Txn(ctx, store, storage.TransactionParams{}, func(txn storage.Transaction) error {
+					a, err := store.Read(ctx, txn, storage.MustParsePath("/x/a"))
+					if err != nil {
+						return err
+					}
+					runtime.Gosched()
+					b, err := store.Read(ctx, txn, storage.MustParsePath("/x/b"))
+					if err != nil {
+						return err
+					}
+					if a != b {
+						return fmt.Errorf("inconsistent snapshot: a=%v b=%v", a, b)
+					}
+					return nil
+				})
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= writes; i++ {
+		err := storage.Txn(ctx, store, storage.WriteParams, func(txn storage.Transaction) error {
+			v := json.Number(fmt.Sprint(i))
+			if err := store.Write(ctx, txn, storage.ReplaceOp, storage.MustParsePath("/x/a"), v); err != nil {
+				return err
+			}
+			return store.Write(ctx, txn, storage.ReplaceOp, storage.MustParsePath("/x/b"), v)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(done)
+
+	for i := 0; i < 4; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestInMemoryTriggers(t *testing.T) {
 
 	ctx := context.Background()
@@ -23,3 +23,17 @@ func OptRoundTripOnWrite(enabled bool) Opt {
 		s.roundTripOnWrite = enabled
 	}
 }
+
+// OptDurability enables the durability mode of the store. Every committed
+// write transaction is appended to a write-ahead log in the configured
+// directory and the log is periodically compacted into a snapshot. When the
+// store is created, its content is recovered from the snapshot and the log.
+//
+// Data below the roots of activated bundles, the bundle metadata and the
+// policies written by bundle activations are not persisted. Triggers are not
+// run for recovered data.
+func OptDurability(c DurabilityConfig) Opt {
+	return func(s *store) {
+		s.durabilityConfig = &c
+	}
+}
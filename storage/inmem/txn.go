@@ -7,7 +7,9 @@ package inmem
 import (
 	"container/list"
 	"encoding/json"
+	"reflect"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/open-policy-agent/opa/internal/deepcopy"
 	"github.com/open-policy-agent/opa/storage"
@@ -30,16 +32,21 @@ import (
 //
 // - Otherwise, new update is added.
 //
-// Read transactions do not require any special handling and simply passthrough
-// to the underlying store. Read transactions do not support upgrade.
+// Transactions read from the version of the store that was current when they
+// were started. Since committed versions are never modified while other
+// transactions may be reading them, read transactions do not require any
+// special handling and simply passthrough to that version. Read transactions do
+// not support upgrade.
 type transaction struct {
-	xid      uint64
-	write    bool
-	stale    bool
-	db       *store
-	updates  *list.List
-	policies map[string]policyUpdate
-	context  *storage.Context
+	xid        uint64
+	write      bool
+	stale      bool
+	db         *store
+	data       map[string]interface{} // version of the data the transaction reads from
+	dbPolicies map[string][]byte      // version of the policies the transaction reads from
+	updates    *list.List
+	policies   map[string]policyUpdate
+	context    *storage.Context
 }
 
 type policyUpdate struct {
@@ -49,12 +56,14 @@ type policyUpdate struct {
 
 func newTransaction(xid uint64, write bool, context *storage.Context, db *store) *transaction {
 	return &transaction{
-		xid:      xid,
-		write:    write,
-		db:       db,
-		policies: map[string]policyUpdate{},
-		updates:  list.New(),
-		context:  context,
+		xid:        xid,
+		write:      write,
+		db:         db,
+		data:       db.data,
+		dbPolicies: db.policies,
+		policies:   map[string]policyUpdate{},
+		updates:    list.New(),
+		context:    context,
 	}
 }
 
@@ -119,7 +128,7 @@ func (txn *transaction) Write(op storage.PatchOp, path storage.Path, value inter
 		curr = curr.Next()
 	}
 
-	update, err := newUpdate(txn.db.data, op, path, 0, value)
+	update, err := newUpdate(txn.data, op, path, 0, value)
 	if err != nil {
 		return err
 	}
@@ -144,12 +153,25 @@ func (txn *transaction) updateRoot(op storage.PatchOp, value interface{}) error
 	return nil
 }
 
+// Commit makes the updates visible to transactions started afterwards. If
+// read transactions are open, the versions they read from are left intact: the
+// updates are applied to copies of the objects and arrays they modify and the
+// new version shares everything else with the current one. Otherwise, the
+// updates are applied in place.
 func (txn *transaction) Commit() (result storage.TriggerEvent) {
 	result.Context = txn.context
+	shared := atomic.LoadInt64(&txn.db.readers) > 0
+	if shared {
+		txn.db.copier.reset(atomic.LoadUint64(&txn.db.snapshots))
+	}
+	var data interface{} = txn.db.data
 	for curr := txn.updates.Front(); curr != nil; curr = curr.Next() {
 		action := curr.Value.(*update)
-		updated := action.Apply(txn.db.data)
-		txn.db.data = updated.(map[string]interface{})
+		if shared {
+			data = txn.db.copier.Apply(action, data)
+		} else {
+			data = action.Apply(data)
+		}
 
 		result.Data = append(result.Data, storage.DataEvent{
 			Path:    action.path,
@@ -157,6 +179,14 @@ func (txn *transaction) Commit() (result storage.TriggerEvent) {
 			Removed: action.remove,
 		})
 	}
+	txn.db.data = data.(map[string]interface{})
+	if shared && len(txn.policies) > 0 {
+		policies := make(map[string][]byte, len(txn.db.policies)+len(txn.policies))
+		for id, bs := range txn.db.policies {
+			policies[id] = bs
+		}
+		txn.db.policies = policies
+	}
 	for id, update := range txn.policies {
 		if update.remove {
 			delete(txn.db.policies, id)
@@ -176,7 +206,7 @@ func (txn *transaction) Commit() (result storage.TriggerEvent) {
 func (txn *transaction) Read(path storage.Path) (interface{}, error) {
 
 	if !txn.write {
-		return ptr.Ptr(txn.db.data, path)
+		return ptr.Ptr(txn.data, path)
 	}
 
 	merge := []*update{}
@@ -197,7 +227,7 @@ func (txn *transaction) Read(path storage.Path) (interface{}, error) {
 		}
 	}
 
-	data, err := ptr.Ptr(txn.db.data, path)
+	data, err := ptr.Ptr(txn.data, path)
 
 	if err != nil {
 		return nil, err
@@ -218,7 +248,7 @@ func (txn *transaction) Read(path storage.Path) (interface{}, error) {
 
 func (txn *transaction) ListPolicies() []string {
 	var ids []string
-	for id := range txn.db.policies {
+	for id := range txn.dbPolicies {
 		if _, ok := txn.policies[id]; !ok {
 			ids = append(ids, id)
 		}
@@ -238,7 +268,7 @@ func (txn *transaction) GetPolicy(id string) ([]byte, error) {
 		}
 		return nil, errors.NewNotFoundErrorf("policy id %q", id)
 	}
-	if exist, ok := txn.db.policies[id]; ok {
+	if exist, ok := txn.dbPolicies[id]; ok {
 		return exist, nil
 	}
 	return nil, errors.NewNotFoundErrorf("policy id %q", id)
@@ -389,6 +419,77 @@ func (u *update) Apply(data interface{}) interface{} {
 	return data
 }
 
+// copier applies updates to data that may be shared with read transactions.
+// Objects and arrays on the path of an update are copied and all other values
+// are shared. Copies are owned by the copier until the next read transaction
+// takes a snapshot of the store, so consecutive updates to the same part of the
+// store only have to copy it once.
+type copier struct {
+	snapshots uint64                  // number of snapshots taken when the copies were made
+	owned     map[uintptr]interface{} // copies that are not visible to readers, by address
+}
+
+// reset releases the copies if a snapshot has been taken since they were made.
+func (c *copier) reset(snapshots uint64) {
+	if c.owned == nil || c.snapshots != snapshots {
+		c.snapshots = snapshots
+		c.owned = map[uintptr]interface{}{}
+	}
+}
+
+func (c *copier) Apply(u *update, data interface{}) interface{} {
+	return c.apply(data, u.path, u.remove, u.value)
+}
+
+func (c *copier) apply(data interface{}, path storage.Path, remove bool, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+	key := path[0]
+	switch data := data.(type) {
+	case map[string]interface{}:
+		obj := data
+		if !c.owns(reflect.ValueOf(data).Pointer()) {
+			obj = make(map[string]interface{}, len(data)+1)
+			for k, v := range data {
+				obj[k] = v
+			}
+			c.own(reflect.ValueOf(obj).Pointer(), obj)
+		}
+		if remove && len(path) == 1 {
+			delete(obj, key)
+		} else {
+			obj[key] = c.apply(data[key], path[1:], remove, value)
+		}
+		return obj
+	case []interface{}:
+		idx, err := strconv.Atoi(key)
+		if err != nil {
+			panic(err)
+		}
+		arr := data
+		if len(data) == 0 || !c.owns(reflect.ValueOf(data).Pointer()) {
+			arr = make([]interface{}, len(data))
+			copy(arr, data)
+			c.own(reflect.ValueOf(arr).Pointer(), arr)
+		}
+		arr[idx] = c.apply(data[idx], path[1:], remove, value)
+		return arr
+	}
+	panic(errors.NewNotFoundError(path))
+}
+
+func (c *copier) owns(addr uintptr) bool {
+	_, ok := c.owned[addr]
+	return addr != 0 && ok
+}
+
+func (c *copier) own(addr uintptr, v interface{}) {
+	if addr != 0 {
+		c.owned[addr] = v
+	}
+}
+
 func (u *update) Relative(path storage.Path) *update {
 	cpy := *u
 	cpy.path = cpy.path[len(path):]
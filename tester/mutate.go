@@ -0,0 +1,387 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package tester
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/storage"
+)
+
+// Mutation operators applied to policies during mutation testing.
+const (
+	MutateComparison = "flip-comparison"
+	MutateNegation   = "negate-expression"
+	MutateDrop       = "drop-expression"
+	MutateDefault    = "swap-default"
+	MutateConstant   = "change-constant"
+)
+
+// MutantStatus describes the outcome of running the tests against a mutant.
+type MutantStatus string
+
+const (
+	// MutantKilled indicates that at least one test failed for the mutant.
+	MutantKilled MutantStatus = "killed"
+
+	// MutantSurvived indicates that all tests passed for the mutant.
+	MutantSurvived MutantStatus = "survived"
+
+	// MutantInvalid indicates that the mutant could not be compiled, e.g.,
+	// because dropping an expression made variables unsafe.
+	MutantInvalid MutantStatus = "invalid"
+)
+
+// MutationOptions defines options specific to mutation testing.
+type MutationOptions struct {
+	// NewCompiler returns the compiler used for every mutant. If unset, the
+	// runner's default compiler configuration is used.
+	NewCompiler func() *ast.Compiler
+}
+
+// Mutant describes a modification of a policy that tests should detect.
+type Mutant struct {
+	Location    *ast.Location `json:"location"`
+	Operator    string        `json:"operator"`
+	Description string        `json:"description"`
+}
+
+func (m Mutant) String() string {
+	return fmt.Sprintf("%v: %v: %v", m.Location, m.Operator, m.Description)
+}
+
+// MutationResult represents the outcome of running the tests against a mutant.
+type MutationResult struct {
+	Mutant
+	Status   MutantStatus `json:"status"`
+	KilledBy string       `json:"killed_by,omitempty"` // first test that did not pass
+	Error    string       `json:"error,omitempty"`     // set if the mutant is invalid
+}
+
+// RunMutations applies mutation operators to the modules loaded on the runner
+// and executes the tests against every mutant. Modules containing tests are
+// not mutated. The tests must pass before any mutants are generated.
+func (r *Runner) RunMutations(ctx context.Context, txn storage.Transaction, options MutationOptions) (ch chan *MutationResult, err error) {
+
+	if len(r.bundles) > 0 {
+		return nil, fmt.Errorf("mutation testing is not supported for bundles")
+	}
+
+	failed, err := r.mutantRunner(r.modules, options).firstFailure(ctx, txn)
+	if err != nil {
+		return nil, err
+	} else if failed != "" {
+		return nil, fmt.Errorf("tests must pass before running mutation testing: %v did not pass", failed)
+	}
+
+	filenames := make([]string, 0, len(r.modules))
+	for name, mod := range r.modules {
+		if !hasTests(mod) {
+			filenames = append(filenames, name)
+		}
+	}
+
+	sort.Strings(filenames)
+
+	ch = make(chan *MutationResult)
+
+	go func() {
+		defer close(ch)
+		for _, name := range filenames {
+			mod := r.modules[name]
+			for i, m := range mutations(mod) {
+				if ctx.Err() != nil {
+					return
+				}
+
+				cpy := mod.Copy()
+				mutations(cpy)[i].apply()
+
+				modules := make(map[string]*ast.Module, len(r.modules))
+				for k, v := range r.modules {
+					modules[k] = v
+				}
+				modules[name] = cpy
+
+				mr := &MutationResult{Mutant: m.Mutant}
+
+				failed, err := r.mutantRunner(modules, options).firstFailure(ctx, txn)
+				switch {
+				case err != nil:
+					mr.Status = MutantInvalid
+					mr.Error = err.Error()
+				case failed != "":
+					mr.Status = MutantKilled
+					mr.KilledBy = failed
+				default:
+					mr.Status = MutantSurvived
+				}
+
+				ch <- mr
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// mutantRunner returns a runner for modules that shares the configuration of
+// r but compiles the modules from scratch.
+func (r *Runner) mutantRunner(modules map[string]*ast.Module, options MutationOptions) *Runner {
+	runner := &Runner{
+		store:          r.store,
+		runtime:        r.runtime,
+		timeout:        r.timeout,
+		modules:        modules,
+		filter:         r.filter,
+		target:         r.target,
+		customBuiltins: r.customBuiltins,
+	}
+	if options.NewCompiler != nil {
+		runner.compiler = options.NewCompiler()
+	}
+	return runner
+}
+
+// firstFailure runs the tests and returns the name of the first test that did
+// not pass. Remaining tests are not run once a test did not pass.
+func (r *Runner) firstFailure(ctx context.Context, txn storage.Transaction) (string, error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch, err := r.runTests(ctx, txn, false, r.runTest)
+	if err != nil {
+		return "", err
+	}
+
+	var failed string
+	for tr := range ch {
+		if failed == "" && !tr.Pass() && !tr.Skip {
+			failed = tr.Package + "." + tr.Name
+			cancel()
+		}
+	}
+
+	return failed, nil
+}
+
+func hasTests(mod *ast.Module) bool {
+	for _, rule := range mod.Rules {
+		if isTest(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// mutation is a single modification of a module. Mutations are applied to
+// copies of the module by enumerating the mutations of the copy, which yields
+// the same mutations in the same order.
+type mutation struct {
+	Mutant
+	apply func()
+}
+
+// mutations returns the mutations of mod.
+func mutations(mod *ast.Module) []mutation {
+	var result []mutation
+	for _, rule := range mod.Rules {
+		for r := rule; r != nil; r = r.Else {
+			result = append(result, headMutations(r)...)
+			if !hasGeneratedBody(r) {
+				result = append(result, bodyMutations(r)...)
+			}
+		}
+	}
+	return result
+}
+
+func headMutations(rule *ast.Rule) []mutation {
+
+	value := rule.Head.Value
+	if value == nil || value.Location == nil {
+		// The value of rules like p { ... } is not part of the source.
+		return nil
+	}
+
+	if b, ok := value.Value.(ast.Boolean); ok && rule.Default {
+		return []mutation{{
+			Mutant: Mutant{
+				Location:    value.Location,
+				Operator:    MutateDefault,
+				Description: fmt.Sprintf("replaced default value %v with %v", b, !b),
+			},
+			apply: func() { value.Value = !b },
+		}}
+	}
+
+	if m, ok := constantMutation(value); ok {
+		return []mutation{m}
+	}
+
+	return nil
+}
+
+// hasGeneratedBody returns true if the body of rule was not part of the
+// source, e.g., because the rule is a default rule or a constant.
+func hasGeneratedBody(rule *ast.Rule) bool {
+	if rule.Default {
+		return true
+	}
+	if len(rule.Body) != 1 || rule.Head.Value == nil || rule.Head.Value.Location == nil {
+		return false
+	}
+	return rule.Body[0].Location == rule.Head.Value.Location
+}
+
+func bodyMutations(rule *ast.Rule) []mutation {
+
+	var result []mutation
+
+	for i := range rule.Body {
+		expr := rule.Body[i]
+
+		if op, ok := flippedComparison(expr); ok {
+			orig := expr.Operator()
+			result = append(result, mutation{
+				Mutant: Mutant{
+					Location:    expr.Location,
+					Operator:    MutateComparison,
+					Description: fmt.Sprintf("replaced %v with %v", comparisonInfix(orig), op.Infix),
+				},
+				apply: func() {
+					terms := expr.Terms.([]*ast.Term)
+					terms[0] = ast.NewTerm(op.Ref()).SetLocation(terms[0].Location)
+				},
+			})
+		}
+
+		if canNegate(expr) {
+			desc := "negated expression"
+			if expr.Negated {
+				desc = "removed negation"
+			}
+			result = append(result, mutation{
+				Mutant: Mutant{
+					Location:    expr.Location,
+					Operator:    MutateNegation,
+					Description: desc,
+				},
+				apply: func() { expr.Negated = !expr.Negated },
+			})
+		}
+
+		if _, ok := expr.Terms.(*ast.SomeDecl); !ok {
+			i := i
+			result = append(result, mutation{
+				Mutant: Mutant{
+					Location:    expr.Location,
+					Operator:    MutateDrop,
+					Description: "removed expression",
+				},
+				apply: func() { rule.Body = dropExpr(rule.Body, i) },
+			})
+		}
+
+		for _, term := range exprConstants(expr) {
+			if m, ok := constantMutation(term); ok {
+				result = append(result, m)
+			}
+		}
+	}
+
+	return result
+}
+
+var comparisons = map[string]*ast.Builtin{
+	ast.Equal.Name:         ast.NotEqual,
+	ast.NotEqual.Name:      ast.Equal,
+	ast.LessThan.Name:      ast.GreaterThanEq,
+	ast.LessThanEq.Name:    ast.GreaterThan,
+	ast.GreaterThan.Name:   ast.LessThanEq,
+	ast.GreaterThanEq.Name: ast.LessThan,
+}
+
+func flippedComparison(expr *ast.Expr) (*ast.Builtin, bool) {
+	if !expr.IsCall() || len(expr.Operands()) != 2 {
+		return nil, false
+	}
+	op, ok := comparisons[expr.Operator().String()]
+	return op, ok
+}
+
+func comparisonInfix(ref ast.Ref) string {
+	return ast.BuiltinMap[ref.String()].Infix
+}
+
+func canNegate(expr *ast.Expr) bool {
+	switch expr.Terms.(type) {
+	case *ast.SomeDecl, *ast.Every:
+		return false
+	}
+	return !expr.IsAssignment()
+}
+
+// dropExpr removes the i-th expression from body. If body contains a single
+// expression, it is replaced by true.
+func dropExpr(body ast.Body, i int) ast.Body {
+	if len(body) == 1 {
+		return ast.NewBody(ast.NewExpr(ast.BooleanTerm(true).SetLocation(body[0].Location)).SetLocation(body[0].Location))
+	}
+	result := make(ast.Body, 0, len(body)-1)
+	result = append(result, body[:i]...)
+	result = append(result, body[i+1:]...)
+	for j := range result {
+		result[j].Index = j
+	}
+	return result
+}
+
+// exprConstants returns the scalar operands of expr. Scalars nested inside of
+// composite values are not mutated.
+func exprConstants(expr *ast.Expr) []*ast.Term {
+	switch terms := expr.Terms.(type) {
+	case *ast.Term:
+		return []*ast.Term{terms}
+	case []*ast.Term:
+		return terms[1:]
+	}
+	return nil
+}
+
+func constantMutation(term *ast.Term) (mutation, bool) {
+
+	var value ast.Value
+
+	switch v := term.Value.(type) {
+	case ast.Boolean:
+		value = !v
+	case ast.Number:
+		if i, ok := v.Int64(); ok {
+			value = ast.IntNumberTerm(int(i) + 1).Value
+		} else if f, ok := v.Float64(); ok {
+			value = ast.FloatNumberTerm(f + 1).Value
+		} else {
+			return mutation{}, false
+		}
+	case ast.String:
+		value = v + "_mutant"
+	default:
+		return mutation{}, false
+	}
+
+	return mutation{
+		Mutant: Mutant{
+			Location:    term.Location,
+			Operator:    MutateConstant,
+			Description: fmt.Sprintf("replaced %v with %v", term.Value, value),
+		},
+		apply: func() { term.Value = value },
+	}, true
+}
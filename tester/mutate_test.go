@@ -0,0 +1,152 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package tester
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+func TestRunMutations(t *testing.T) {
+
+	modules := map[string]*ast.Module{
+		"authz.rego": mustParseModule(t, "authz.rego", `package authz
+
+default allow := false
+
+allow {
+	input.user == "admin"
+}
+
+allow {
+	not input.blocked
+	count(input.roles) > 2
+}
+
+limit := 10
+`),
+		"authz_test.rego": mustParseModule(t, "authz_test.rego", `package authz
+
+test_admin {
+	allow with input as {"user": "admin"}
+}
+
+test_anonymous {
+	not allow with input as {"user": "bob"}
+}
+
+test_roles {
+	allow with input as {"user": "bob", "roles": [1, 2, 3]}
+}
+`),
+	}
+
+	ctx := context.Background()
+
+	ch, err := NewRunner().SetModules(modules).RunMutations(ctx, nil, MutationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result []string
+	for mr := range ch {
+		s := fmt.Sprintf("%v: %v", mr.Mutant, mr.Status)
+		if mr.KilledBy != "" {
+			s += " by " + mr.KilledBy
+		}
+		result = append(result, s)
+	}
+
+	exp := []string{
+		"authz.rego:3: swap-default: replaced default value false with true: killed by data.authz.test_anonymous",
+		"authz.rego:6: flip-comparison: replaced == with !=: killed by data.authz.test_admin",
+		"authz.rego:6: negate-expression: negated expression: killed by data.authz.test_admin",
+		"authz.rego:6: drop-expression: removed expression: killed by data.authz.test_anonymous",
+		`authz.rego:6: change-constant: replaced "admin" with "admin_mutant": killed by data.authz.test_admin`,
+		"authz.rego:10: negate-expression: removed negation: killed by data.authz.test_roles",
+		"authz.rego:10: drop-expression: removed expression: survived",
+		"authz.rego:11: flip-comparison: replaced > with <=: killed by data.authz.test_roles",
+		"authz.rego:11: negate-expression: negated expression: killed by data.authz.test_roles",
+		"authz.rego:11: drop-expression: removed expression: killed by data.authz.test_anonymous",
+		"authz.rego:11: change-constant: replaced 2 with 3: killed by data.authz.test_roles",
+		"authz.rego:14: change-constant: replaced 10 with 11: survived",
+	}
+
+	if strings.Join(result, "\n") != strings.Join(exp, "\n") {
+		t.Fatalf("Expected:\n\n%v\n\nGot:\n\n%v", strings.Join(exp, "\n"), strings.Join(result, "\n"))
+	}
+}
+
+func TestRunMutationsFailingTests(t *testing.T) {
+
+	modules := map[string]*ast.Module{
+		"test.rego": mustParseModule(t, "test.rego", `package test
+
+p := 1
+
+test_p {
+	p == 2
+}
+`),
+	}
+
+	_, err := NewRunner().SetModules(modules).RunMutations(context.Background(), nil, MutationOptions{})
+	if err == nil || !strings.Contains(err.Error(), "data.test.test_p did not pass") {
+		t.Fatalf("Expected error but got: %v", err)
+	}
+}
+
+func TestRunMutationsInvalid(t *testing.T) {
+
+	modules := map[string]*ast.Module{
+		"x.rego": mustParseModule(t, "x.rego", `package x
+
+p {
+	x := input.x
+	x > 1
+}
+`),
+		"x_test.rego": mustParseModule(t, "x_test.rego", `package x
+
+test_p {
+	p with input.x as 2
+}
+`),
+	}
+
+	ch, err := NewRunner().SetModules(modules).RunMutations(context.Background(), nil, MutationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var invalid []string
+	for mr := range ch {
+		if mr.Status == MutantInvalid {
+			if mr.Error == "" {
+				t.Fatalf("Expected error for invalid mutant %v", mr.Mutant)
+			}
+			invalid = append(invalid, mr.Mutant.String())
+		}
+	}
+
+	exp := []string{"x.rego:4: drop-expression: removed expression"}
+
+	if strings.Join(invalid, "\n") != strings.Join(exp, "\n") {
+		t.Fatalf("Expected invalid mutants:\n\n%v\n\nGot:\n\n%v", strings.Join(exp, "\n"), strings.Join(invalid, "\n"))
+	}
+}
+
+func mustParseModule(t *testing.T, filename, src string) *ast.Module {
+	t.Helper()
+	mod, err := ast.ParseModule(filename, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mod
+}
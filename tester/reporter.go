@@ -5,11 +5,14 @@
 package tester
 
 import (
+	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/cover"
@@ -175,6 +178,227 @@ func (r JSONReporter) Report(ch chan *Result) error {
 	return nil
 }
 
+// JUnitReporter reports test results in the JUnit XML format. Tests are
+// grouped into one test suite per package.
+type JUnitReporter struct {
+	Output io.Writer
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      string           `xml:"time,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+	duration  time.Duration
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Line      int           `xml:"line,attr,omitempty"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Details string `xml:",cdata"`
+}
+
+type junitSkipped struct{}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// Report prints the test report to the reporter's output.
+func (r JUnitReporter) Report(ch chan *Result) error {
+
+	report := junitTestSuites{}
+	suites := map[string]*junitTestSuite{}
+	var duration time.Duration
+
+	for tr := range ch {
+		suite, ok := suites[tr.Package]
+		if !ok {
+			suite = &junitTestSuite{Name: tr.Package}
+			suites[tr.Package] = suite
+			report.Suites = append(report.Suites, suite)
+		}
+
+		tc := &junitTestCase{
+			Name:      tr.Name,
+			ClassName: tr.Package,
+			Time:      junitTime(tr.Duration),
+		}
+
+		if len(tr.Output) > 0 {
+			tc.SystemOut = &junitOutput{Text: string(tr.Output)}
+		}
+
+		if tr.Location != nil {
+			tc.File = tr.Location.File
+			tc.Line = tr.Location.Row
+		}
+
+		switch {
+		case tr.Skip:
+			tc.Skipped = &junitSkipped{}
+			suite.Skipped++
+		case tr.Error != nil:
+			tc.Error = &junitFailure{Message: tr.Error.Error(), Details: resultDetails(tr)}
+			suite.Errors++
+		case tr.Fail:
+			tc.Failure = &junitFailure{Message: failureMessage(tr), Details: resultDetails(tr)}
+			suite.Failures++
+		}
+
+		suite.Tests++
+		suite.duration += tr.Duration
+		suite.TestCases = append(suite.TestCases, tc)
+		duration += tr.Duration
+	}
+
+	for _, suite := range report.Suites {
+		suite.Time = junitTime(suite.duration)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+	}
+
+	report.Time = junitTime(duration)
+
+	bs, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(r.Output, xml.Header)
+	fmt.Fprintln(r.Output, string(bs))
+	return nil
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// TAPReporter reports test results in the Test Anything Protocol (TAP)
+// version 13 format. Durations, failure messages, traces and print output are
+// reported in YAML diagnostic blocks.
+type TAPReporter struct {
+	Output io.Writer
+}
+
+// Report prints the test report to the reporter's output.
+func (r TAPReporter) Report(ch chan *Result) error {
+
+	results := make([]*Result, 0, len(ch))
+	for tr := range ch {
+		results = append(results, tr)
+	}
+
+	fmt.Fprintln(r.Output, "TAP version 13")
+	fmt.Fprintf(r.Output, "1..%d\n", len(results))
+
+	for i, tr := range results {
+		name := fmt.Sprintf("%v.%v", tr.Package, tr.Name)
+
+		if tr.Skip {
+			fmt.Fprintf(r.Output, "ok %d - %v # SKIP\n", i+1, name)
+			continue
+		}
+
+		if tr.Pass() {
+			fmt.Fprintf(r.Output, "ok %d - %v\n", i+1, name)
+		} else {
+			fmt.Fprintf(r.Output, "not ok %d - %v\n", i+1, name)
+		}
+
+		fmt.Fprintln(r.Output, "  ---")
+		fmt.Fprintf(r.Output, "  duration_ms: %.3f\n", float64(tr.Duration)/float64(time.Millisecond))
+
+		if tr.Location != nil {
+			fmt.Fprintf(r.Output, "  location: %v\n", tapString(tr.Location.String()))
+		}
+
+		if tr.Error != nil {
+			fmt.Fprintf(r.Output, "  message: %v\n", tapString(tr.Error.Error()))
+		} else if tr.Fail {
+			fmt.Fprintf(r.Output, "  message: %v\n", tapString(failureMessage(tr)))
+		}
+
+		if len(tr.Output) > 0 {
+			r.block("output", string(tr.Output))
+		}
+
+		if !tr.Pass() && len(tr.Trace) > 0 {
+			var buf bytes.Buffer
+			topdown.PrettyTraceWithLocation(&buf, tr.Trace)
+			r.block("trace", buf.String())
+		}
+
+		fmt.Fprintln(r.Output, "  ...")
+	}
+
+	return nil
+}
+
+// block prints s as a YAML literal block scalar.
+func (r TAPReporter) block(key string, s string) {
+	// The indentation indicator is required if the first line is indented.
+	fmt.Fprintf(r.Output, "  %v: |2\n", key)
+	for _, line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		fmt.Fprintf(r.Output, "    %v\n", line)
+	}
+}
+
+// tapString returns s as a YAML double-quoted string.
+func tapString(s string) string {
+	bs, _ := json.Marshal(s)
+	return string(bs)
+}
+
+// failureMessage returns a message describing why test result tr failed.
+func failureMessage(tr *Result) string {
+	if tr.FailedAt != nil {
+		return fmt.Sprintf("test failed at %v: %v", tr.FailedAt.Location, tr.FailedAt)
+	}
+	return "test failed"
+}
+
+// resultDetails returns the trace and print output of test result tr.
+func resultDetails(tr *Result) string {
+	var buf bytes.Buffer
+	if len(tr.Trace) > 0 {
+		topdown.PrettyTraceWithLocation(&buf, tr.Trace)
+	}
+	if len(tr.Output) > 0 {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		buf.Write(tr.Output)
+	}
+	return buf.String()
+}
+
 // JSONCoverageReporter reports coverage as a JSON structure.
 type JSONCoverageReporter struct {
 	Cover     *cover.Cover
@@ -186,26 +410,178 @@ type JSONCoverageReporter struct {
 // Report prints the test report to the reporter's output. If any tests fail or
 // encounter errors, this function returns an error.
 func (r JSONCoverageReporter) Report(ch chan *Result) error {
+	report, err := coverageReport(ch, r.Cover, r.Modules, r.Threshold)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(r.Output)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// LCOVCoverageReporter reports coverage in the LCOV tracefile format.
+type LCOVCoverageReporter struct {
+	Cover     *cover.Cover
+	Modules   map[string]*ast.Module
+	Output    io.Writer
+	Threshold float64
+}
+
+// Report prints the test report to the reporter's output. If any tests fail or
+// encounter errors, this function returns an error.
+func (r LCOVCoverageReporter) Report(ch chan *Result) error {
+	report, err := coverageReport(ch, r.Cover, r.Modules, r.Threshold)
+	if err != nil {
+		return err
+	}
+	return report.WriteLCOV(r.Output)
+}
+
+// CoberturaCoverageReporter reports coverage in the Cobertura XML format.
+type CoberturaCoverageReporter struct {
+	Cover     *cover.Cover
+	Modules   map[string]*ast.Module
+	Output    io.Writer
+	Threshold float64
+}
+
+// Report prints the test report to the reporter's output. If any tests fail or
+// encounter errors, this function returns an error.
+func (r CoberturaCoverageReporter) Report(ch chan *Result) error {
+	report, err := coverageReport(ch, r.Cover, r.Modules, r.Threshold)
+	if err != nil {
+		return err
+	}
+	return report.WriteCobertura(r.Output)
+}
+
+// coverageReport returns the coverage report once all tests have passed. If
+// any tests fail or the coverage is below the threshold, an error is returned.
+func coverageReport(ch chan *Result, c *cover.Cover, modules map[string]*ast.Module, threshold float64) (cover.Report, error) {
 	for tr := range ch {
 		if !tr.Pass() {
 			if tr.Error != nil {
-				return tr.Error
+				return cover.Report{}, tr.Error
 			}
-			return errors.New(tr.String())
+			return cover.Report{}, errors.New(tr.String())
 		}
 	}
-	report := r.Cover.Report(r.Modules)
+	report := c.Report(modules)
 
-	if report.Coverage < r.Threshold {
-		return &cover.CoverageThresholdError{
+	if report.Coverage < threshold {
+		return cover.Report{}, &cover.CoverageThresholdError{
 			Coverage:  report.Coverage,
-			Threshold: r.Threshold,
+			Threshold: threshold,
 		}
 	}
 
-	encoder := json.NewEncoder(r.Output)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(report)
+	return report, nil
+}
+
+// MutationReporter defines the interface for reporting mutation testing
+// results.
+type MutationReporter interface {
+
+	// Report is called with a channel that will contain mutation results.
+	Report(ch chan *MutationResult) error
+}
+
+// PrettyMutationReporter reports mutation testing results in a simple human
+// readable format. Surviving mutants are always reported; killed and invalid
+// mutants are only reported in verbose mode.
+type PrettyMutationReporter struct {
+	Output  io.Writer
+	Verbose bool
+}
+
+// Report prints the mutation testing report to the reporter's output.
+func (r PrettyMutationReporter) Report(ch chan *MutationResult) error {
+
+	var killed, survived, invalid int
+	var results []*MutationResult
+
+	for mr := range ch {
+		switch mr.Status {
+		case MutantKilled:
+			killed++
+		case MutantSurvived:
+			survived++
+		case MutantInvalid:
+			invalid++
+		}
+		if r.Verbose || mr.Status == MutantSurvived {
+			results = append(results, mr)
+		}
+	}
+
+	if len(results) > 0 {
+		if r.Verbose {
+			fmt.Fprintln(r.Output, "MUTANTS")
+		} else {
+			fmt.Fprintln(r.Output, "SURVIVED MUTANTS")
+		}
+		r.hl()
+
+		for _, mr := range results {
+			if r.Verbose {
+				fmt.Fprintf(r.Output, "%v: %v\n", mr.Mutant, strings.ToUpper(string(mr.Status)))
+			} else {
+				fmt.Fprintln(r.Output, mr.Mutant)
+			}
+			if mr.Location != nil && len(mr.Location.Text) > 0 {
+				fmt.Fprintln(newIndentingWriter(r.Output), string(mr.Location.Text))
+			}
+			if mr.KilledBy != "" {
+				fmt.Fprintf(r.Output, "  killed by %v\n", mr.KilledBy)
+			}
+			if mr.Error != "" {
+				fmt.Fprintln(newIndentingWriter(r.Output), mr.Error)
+			}
+		}
+
+		r.hl()
+	}
+
+	total := killed + survived
+
+	fmt.Fprintln(r.Output, "KILLED:", fmt.Sprintf("%d/%d", killed, total))
+	fmt.Fprintln(r.Output, "SURVIVED:", fmt.Sprintf("%d/%d", survived, total))
+
+	if invalid != 0 {
+		fmt.Fprintln(r.Output, "INVALID:", invalid)
+	}
+
+	if total > 0 {
+		fmt.Fprintln(r.Output, "MUTATION SCORE:", fmt.Sprintf("%.2f%%", 100*float64(killed)/float64(total)))
+	}
+
+	return nil
+}
+
+func (r PrettyMutationReporter) hl() {
+	fmt.Fprintln(r.Output, strings.Repeat("-", 80))
+}
+
+// JSONMutationReporter reports mutation testing results as array of JSON
+// objects.
+type JSONMutationReporter struct {
+	Output io.Writer
+}
+
+// Report prints the mutation testing report to the reporter's output.
+func (r JSONMutationReporter) Report(ch chan *MutationResult) error {
+	report := []*MutationResult{}
+	for mr := range ch {
+		report = append(report, mr)
+	}
+
+	bs, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.Output, string(bs))
+	return nil
 }
 
 type indentingWriter struct {
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/topdown"
@@ -450,6 +451,261 @@ func TestJSONReporter(t *testing.T) {
 	}
 }
 
+func getReporterTestResults() []*Result {
+	return []*Result{
+		{
+			Package:  "data.foo.bar",
+			Name:     "test_baz",
+			Duration: 1500 * time.Microsecond,
+			Location: &ast.Location{File: "policy1.rego", Row: 3},
+		},
+		{
+			Package:  "data.foo.bar",
+			Name:     "test_qux",
+			Error:    fmt.Errorf("some err"),
+			Duration: time.Millisecond,
+			Location: &ast.Location{File: "policy1.rego", Row: 5},
+		},
+		{
+			Package:  "data.foo.bar",
+			Name:     "test_corge",
+			Fail:     true,
+			Trace:    getFakeTraceEvents(),
+			Output:   []byte("fake print output\n"),
+			Location: &ast.Location{File: "policy2.rego", Row: 7},
+		},
+		{
+			Package:  "data.foo.bar",
+			Name:     "todo_test_qux",
+			Skip:     true,
+			Location: &ast.Location{File: "policy2.rego", Row: 9},
+		},
+		{
+			Package:  "data.foo.baz",
+			Name:     "p.q.r.test_quz",
+			Output:   []byte("fake print output\n"),
+			Location: &ast.Location{File: "policy3.rego", Row: 1},
+		},
+	}
+}
+
+func TestJUnitReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := JUnitReporter{
+		Output: &buf,
+	}
+
+	if err := r.Report(resultsChan(getReporterTestResults())); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="5" failures="1" errors="1" skipped="1" time="0.003">
+  <testsuite name="data.foo.bar" tests="4" failures="1" errors="1" skipped="1" time="0.003">
+    <testcase name="test_baz" classname="data.foo.bar" file="policy1.rego" line="3" time="0.002"></testcase>
+    <testcase name="test_qux" classname="data.foo.bar" file="policy1.rego" line="5" time="0.001">
+      <error message="some err"></error>
+    </testcase>
+    <testcase name="test_corge" classname="data.foo.bar" file="policy2.rego" line="7" time="0.000">
+      <failure message="test failed"><![CDATA[query:1     | Fail true = false
+
+fake print output
+]]></failure>
+      <system-out><![CDATA[fake print output
+]]></system-out>
+    </testcase>
+    <testcase name="todo_test_qux" classname="data.foo.bar" file="policy2.rego" line="9" time="0.000">
+      <skipped></skipped>
+    </testcase>
+  </testsuite>
+  <testsuite name="data.foo.baz" tests="1" failures="0" errors="0" skipped="0" time="0.000">
+    <testcase name="p.q.r.test_quz" classname="data.foo.baz" file="policy3.rego" line="1" time="0.000">
+      <system-out><![CDATA[fake print output
+]]></system-out>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+
+	if str := buf.String(); exp != str {
+		t.Fatalf("Expected:\n\n%v\n\nGot:\n\n%v", exp, str)
+	}
+}
+
+func TestTAPReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := TAPReporter{
+		Output: &buf,
+	}
+
+	if err := r.Report(resultsChan(getReporterTestResults())); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `TAP version 13
+1..5
+ok 1 - data.foo.bar.test_baz
+  ---
+  duration_ms: 1.500
+  location: "policy1.rego:3"
+  ...
+not ok 2 - data.foo.bar.test_qux
+  ---
+  duration_ms: 1.000
+  location: "policy1.rego:5"
+  message: "some err"
+  ...
+not ok 3 - data.foo.bar.test_corge
+  ---
+  duration_ms: 0.000
+  location: "policy2.rego:7"
+  message: "test failed"
+  output: |2
+    fake print output
+  trace: |2
+    query:1     | Fail true = false
+  ...
+ok 4 - data.foo.bar.todo_test_qux # SKIP
+ok 5 - data.foo.baz.p.q.r.test_quz
+  ---
+  duration_ms: 0.000
+  location: "policy3.rego:1"
+  output: |2
+    fake print output
+  ...
+`
+
+	if str := buf.String(); exp != str {
+		t.Fatalf("Expected:\n\n%v\n\nGot:\n\n%v", exp, str)
+	}
+}
+
+func getMutationTestResults() []*MutationResult {
+	return []*MutationResult{
+		{
+			Mutant: Mutant{
+				Location:    &ast.Location{File: "policy.rego", Row: 5, Text: []byte(`input.user == "admin"`)},
+				Operator:    MutateComparison,
+				Description: "replaced == with !=",
+			},
+			Status:   MutantKilled,
+			KilledBy: "data.authz.test_admin",
+		},
+		{
+			Mutant: Mutant{
+				Location:    &ast.Location{File: "policy.rego", Row: 9, Text: []byte(`not input.blocked`)},
+				Operator:    MutateDrop,
+				Description: "removed expression",
+			},
+			Status: MutantSurvived,
+		},
+		{
+			Mutant: Mutant{
+				Location:    &ast.Location{File: "policy.rego", Row: 12, Text: []byte(`x := input.x`)},
+				Operator:    MutateDrop,
+				Description: "removed expression",
+			},
+			Status: MutantInvalid,
+			Error:  "var x is unsafe",
+		},
+	}
+}
+
+func mutationResultsChan(results []*MutationResult) chan *MutationResult {
+	ch := make(chan *MutationResult)
+	go func() {
+		defer close(ch)
+		for _, mr := range results {
+			ch <- mr
+		}
+	}()
+	return ch
+}
+
+func TestPrettyMutationReporter(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		verbose bool
+		exp     string
+	}{
+		{
+			note: "survived",
+			exp: `SURVIVED MUTANTS
+--------------------------------------------------------------------------------
+policy.rego:9: drop-expression: removed expression
+  not input.blocked
+--------------------------------------------------------------------------------
+KILLED: 1/2
+SURVIVED: 1/2
+INVALID: 1
+MUTATION SCORE: 50.00%
+`,
+		},
+		{
+			note:    "verbose",
+			verbose: true,
+			exp: `MUTANTS
+--------------------------------------------------------------------------------
+policy.rego:5: flip-comparison: replaced == with !=: KILLED
+  input.user == "admin"
+  killed by data.authz.test_admin
+policy.rego:9: drop-expression: removed expression: SURVIVED
+  not input.blocked
+policy.rego:12: drop-expression: removed expression: INVALID
+  x := input.x
+  var x is unsafe
+--------------------------------------------------------------------------------
+KILLED: 1/2
+SURVIVED: 1/2
+INVALID: 1
+MUTATION SCORE: 50.00%
+`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			r := PrettyMutationReporter{Output: &buf, Verbose: tc.verbose}
+
+			if err := r.Report(mutationResultsChan(getMutationTestResults())); err != nil {
+				t.Fatal(err)
+			}
+
+			if str := buf.String(); tc.exp != str {
+				t.Fatalf("Expected:\n\n%v\n\nGot:\n\n%v", tc.exp, str)
+			}
+		})
+	}
+}
+
+func TestJSONMutationReporter(t *testing.T) {
+	var buf bytes.Buffer
+
+	r := JSONMutationReporter{Output: &buf}
+
+	if err := r.Report(mutationResultsChan(getMutationTestResults()[1:2])); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := util.MustUnmarshalJSON([]byte(`[
+		{
+			"location": {"file": "policy.rego", "row": 9, "col": 0},
+			"operator": "drop-expression",
+			"description": "removed expression",
+			"status": "survived"
+		}
+	]`))
+
+	if result := util.MustUnmarshalJSON(buf.Bytes()); !reflect.DeepEqual(exp, result) {
+		t.Fatalf("Expected:\n\n%v\n\nGot:\n\n%v", exp, result)
+	}
+}
+
 func TestPrettyReporterVerboseBenchmark(t *testing.T) {
 	var buf bytes.Buffer
 
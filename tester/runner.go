@@ -9,21 +9,25 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/bundle"
-	wasm_errors "github.com/open-policy-agent/opa/internal/wasm/sdk/opa/errors"
 	"github.com/open-policy-agent/opa/loader"
 	"github.com/open-policy-agent/opa/metrics"
 	"github.com/open-policy-agent/opa/rego"
+	wasm_errors "github.com/open-policy-agent/opa/sdk/wasm/errors"
 	"github.com/open-policy-agent/opa/storage"
 	"github.com/open-policy-agent/opa/storage/inmem"
 	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/util"
 )
 
 // TestPrefix declares the prefix for all test rules.
@@ -32,6 +36,38 @@ const TestPrefix = "test_"
 // SkipTestPrefix declares the prefix for tests that should be skipped.
 const SkipTestPrefix = "todo_test_"
 
+// FixtureAnnotation declares the custom metadata key that names the fixture of
+// a parameterized test. The value is either a reference to a document, which
+// is resolved relative to the test's package unless it starts with data, or
+// the path of a fixture file, which is resolved relative to the file
+// containing the test.
+const FixtureAnnotation = "fixture"
+
+// fixtureFileSuffixes declares the suffixes of fixture files. Fixture files
+// are not loaded as data.
+var fixtureFileSuffixes = []string{"_fixture.json", "_fixture.yaml", "_fixture.yml"}
+
+// IsFixtureFile returns true if path names a JSON or YAML fixture file.
+func IsFixtureFile(path string) bool {
+	for _, suffix := range fixtureFileSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludeFixtureFiles returns a loader filter that excludes fixture files in
+// addition to the files excluded by filter.
+func ExcludeFixtureFiles(filter loader.Filter) loader.Filter {
+	return func(abspath string, info os.FileInfo, depth int) bool {
+		if !info.IsDir() && IsFixtureFile(info.Name()) {
+			return true
+		}
+		return filter != nil && filter(abspath, info, depth)
+	}
+}
+
 // Run executes all test cases found under files in path.
 func Run(ctx context.Context, paths ...string) ([]*Result, error) {
 	return RunWithFilter(ctx, nil, paths...)
@@ -267,12 +303,26 @@ func (r *Runner) RunTests(ctx context.Context, txn storage.Transaction) (ch chan
 // RunBenchmarks executes tests similar to tester.Runner#RunTests but will repeat
 // a number of times to get stable performance metrics.
 func (r *Runner) RunBenchmarks(ctx context.Context, txn storage.Transaction, options BenchmarkOptions) (ch chan *Result, err error) {
-	return r.runTests(ctx, txn, false, func(ctx context.Context, txn storage.Transaction, module *ast.Module, rule *ast.Rule) (result *Result, b bool) {
-		return r.runBenchmark(ctx, txn, module, rule, options)
+	return r.runTests(ctx, txn, false, func(ctx context.Context, txn storage.Transaction, tc *testCase) (result *Result, b bool) {
+		return r.runBenchmark(ctx, txn, tc, options)
 	})
 }
 
-type run func(context.Context, storage.Transaction, *ast.Module, *ast.Rule) (*Result, bool)
+type run func(context.Context, storage.Transaction, *testCase) (*Result, bool)
+
+// testCase is a single test to run. Parameterized tests run one test case for
+// every entry of their fixture.
+type testCase struct {
+	module *ast.Module
+	rule   *ast.Rule
+	name   string // name relative to the package, e.g., test_p/case
+	path   string // full name matched by the filter, e.g., data.x.test_p/case
+	query  ast.Body
+}
+
+func (tc *testCase) newResult(duration time.Duration, trace []*topdown.Event, output []byte) *Result {
+	return newResult(tc.rule.Loc(), tc.module.Package.Path.String(), tc.name, duration, trace, output)
+}
 
 func (r *Runner) runTests(ctx context.Context, txn storage.Transaction, enablePrintStatements bool, runFunc run) (chan *Result, error) {
 	var testRegex *regexp.Regexp
@@ -360,17 +410,32 @@ func (r *Runner) runTests(ctx context.Context, txn storage.Transaction, enablePr
 		for _, name := range filenames {
 			module := r.compiler.Modules[name]
 			for _, rule := range module.Rules {
-				if !r.shouldRun(rule, testRegex) {
+				if !isTest(rule) {
+					continue
+				}
+				cases, err := r.testCases(ctx, txn, module, rule)
+				if err != nil {
+					tc := &testCase{module: module, rule: rule, name: rule.Head.Ref().String(), path: rule.Ref().String()}
+					if shouldRun(tc, testRegex) {
+						tr := tc.newResult(0, nil, nil)
+						tr.Error = err
+						ch <- tr
+					}
 					continue
 				}
-				tr, stop := func() (*Result, bool) {
-					runCtx, cancel := context.WithTimeout(ctx, r.timeout)
-					defer cancel()
-					return runFunc(runCtx, txn, module, rule)
-				}()
-				ch <- tr
-				if stop {
-					return
+				for _, tc := range cases {
+					if !shouldRun(tc, testRegex) {
+						continue
+					}
+					tr, stop := func() (*Result, bool) {
+						runCtx, cancel := context.WithTimeout(ctx, r.timeout)
+						defer cancel()
+						return runFunc(runCtx, txn, tc)
+					}()
+					ch <- tr
+					if stop {
+						return
+					}
 				}
 			}
 		}
@@ -379,21 +444,185 @@ func (r *Runner) runTests(ctx context.Context, txn storage.Transaction, enablePr
 	return ch, nil
 }
 
-func (r *Runner) shouldRun(rule *ast.Rule, testRegex *regexp.Regexp) bool {
+func isTest(rule *ast.Rule) bool {
 	ruleName := ruleName(rule.Head)
 
 	// All tests must have the right prefix
-	if !strings.HasPrefix(ruleName, TestPrefix) && !strings.HasPrefix(ruleName, SkipTestPrefix) {
-		return false
+	return strings.HasPrefix(ruleName, TestPrefix) || strings.HasPrefix(ruleName, SkipTestPrefix)
+}
+
+func shouldRun(tc *testCase, testRegex *regexp.Regexp) bool {
+	// Tests need to pass the regex (if applicable). The cases of parameterized
+	// tests are matched individually.
+	return testRegex == nil || testRegex.MatchString(tc.path)
+}
+
+// testCases returns the test cases to run for rule. Rules run as a single test
+// case whereas functions of one argument run once for every entry of their
+// fixture.
+func (r *Runner) testCases(ctx context.Context, txn storage.Transaction, mod *ast.Module, rule *ast.Rule) ([]*testCase, error) {
+
+	name, path := rule.Head.Ref().String(), rule.Ref().String()
+
+	if len(rule.Head.Args) == 0 || strings.HasPrefix(ruleName(rule.Head), SkipTestPrefix) {
+		return []*testCase{{
+			module: mod,
+			rule:   rule,
+			name:   name,
+			path:   path,
+			query:  ast.NewBody(ast.NewExpr(ast.NewTerm(rule.Path()))),
+		}}, nil
+	}
+
+	if len(rule.Head.Args) != 1 {
+		return nil, fmt.Errorf("parameterized test must have exactly one argument")
 	}
 
-	// Even with the prefix it needs to pass the regex (if applicable)
-	fullName := rule.Ref().String()
-	if testRegex != nil && !testRegex.MatchString(fullName) {
-		return false
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	fixture, err := r.loadFixture(ctx, txn, mod, rule)
+	if err != nil {
+		return nil, err
 	}
 
-	return true
+	entries, err := fixtureEntries(fixture)
+	if err != nil {
+		return nil, err
+	}
+
+	cases := make([]*testCase, 0, len(entries))
+	for _, entry := range entries {
+		cases = append(cases, &testCase{
+			module: mod,
+			rule:   rule,
+			name:   name + "/" + entry.name,
+			path:   path + "/" + entry.name,
+			query:  ast.NewBody(ast.NewExpr([]*ast.Term{ast.NewTerm(rule.Path()), entry.value})),
+		})
+	}
+
+	return cases, nil
+}
+
+// loadFixture returns the fixture named by the rule's annotations.
+func (r *Runner) loadFixture(ctx context.Context, txn storage.Transaction, mod *ast.Module, rule *ast.Rule) (interface{}, error) {
+
+	var fixture string
+	for _, a := range r.compiler.GetAnnotationSet().GetRuleScope(rule) {
+		if s, ok := a.Custom[FixtureAnnotation].(string); ok {
+			fixture = s
+		}
+	}
+
+	if fixture == "" {
+		return nil, fmt.Errorf("parameterized test requires a %q annotation", "custom."+FixtureAnnotation)
+	}
+
+	switch filepath.Ext(fixture) {
+	case ".json", ".yaml", ".yml":
+		if !IsFixtureFile(fixture) {
+			return nil, fmt.Errorf("fixture file name must end with one of %v", strings.Join(fixtureFileSuffixes, ", "))
+		}
+		path := fixture
+		if !filepath.IsAbs(path) && rule.Location != nil {
+			path = filepath.Join(filepath.Dir(rule.Location.File), path)
+		}
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load fixture: %w", err)
+		}
+		var x interface{}
+		if err := util.Unmarshal(bs, &x); err != nil {
+			return nil, fmt.Errorf("unable to load fixture %v: %w", fixture, err)
+		}
+		return x, nil
+	}
+
+	term, err := ast.ParseTerm(fixture)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture: %w", err)
+	}
+
+	var ref ast.Ref
+	switch v := term.Value.(type) {
+	case ast.Var:
+		ref = ast.Ref{term}
+	case ast.Ref:
+		ref = v
+	default:
+		return nil, fmt.Errorf("invalid fixture: expected reference or file but got %v", fixture)
+	}
+
+	if !ref.HasPrefix(ast.DefaultRootRef) {
+		head := ast.StringTerm(string(ref[0].Value.(ast.Var)))
+		ref = mod.Package.Path.Append(head).Concat(ref[1:])
+	}
+
+	rs, err := rego.New(
+		rego.Store(r.store),
+		rego.Transaction(txn),
+		rego.Compiler(r.compiler),
+		rego.ParsedQuery(ast.NewBody(ast.NewExpr(ast.NewTerm(ref)))),
+		rego.Runtime(r.runtime),
+	).Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load fixture %v: %w", ref, err)
+	} else if len(rs) == 0 {
+		return nil, fmt.Errorf("fixture %v is undefined", ref)
+	}
+
+	return rs[0].Expressions[0].Value, nil
+}
+
+type fixtureEntry struct {
+	name  string
+	value *ast.Term
+}
+
+// fixtureEntries returns the entries of a fixture. Entries of objects are
+// named by their keys. Entries of arrays are named by their "name" field if
+// they have one and by their index otherwise.
+func fixtureEntries(fixture interface{}) ([]fixtureEntry, error) {
+
+	var names []string
+	var values []interface{}
+
+	switch x := fixture.(type) {
+	case []interface{}:
+		for i, v := range x {
+			name := strconv.Itoa(i)
+			if obj, ok := v.(map[string]interface{}); ok {
+				if s, ok := obj["name"].(string); ok {
+					name = s
+				}
+			}
+			names = append(names, name)
+			values = append(values, v)
+		}
+	case map[string]interface{}:
+		for k := range x {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			values = append(values, x[k])
+		}
+	default:
+		return nil, fmt.Errorf("fixture must be an array or an object")
+	}
+
+	entries := make([]fixtureEntry, len(names))
+	for i := range names {
+		v, err := ast.InterfaceToValue(values[i])
+		if err != nil {
+			return nil, err
+		}
+		// Whitespace is replaced so that case names can be matched easily.
+		entries[i] = fixtureEntry{name: strings.Join(strings.Fields(names[i]), "_"), value: ast.NewTerm(v)}
+	}
+
+	return entries, nil
 }
 
 // rewriteDuplicateTestNames will rewrite duplicate test names to have a numbered suffix.
@@ -441,7 +670,7 @@ func ruleName(h *ast.Head) string {
 	}
 }
 
-func (r *Runner) runTest(ctx context.Context, txn storage.Transaction, mod *ast.Module, rule *ast.Rule) (*Result, bool) {
+func (r *Runner) runTest(ctx context.Context, txn storage.Transaction, tc *testCase) (*Result, bool) {
 	var bufferTracer *topdown.BufferTracer
 	var bufFailureLineTracer *topdown.BufferTracer
 	var tracer topdown.QueryTracer
@@ -453,9 +682,9 @@ func (r *Runner) runTest(ctx context.Context, txn storage.Transaction, mod *ast.
 		tracer = bufferTracer
 	}
 
-	ruleName := ruleName(rule.Head)
+	ruleName := ruleName(tc.rule.Head)
 	if strings.HasPrefix(ruleName, SkipTestPrefix) { // TODO(sr): add test
-		tr := newResult(rule.Loc(), mod.Package.Path.String(), rule.Head.Ref().String(), 0*time.Second, nil, nil)
+		tr := tc.newResult(0*time.Second, nil, nil)
 		tr.Skip = true
 		return tr, false
 	}
@@ -466,7 +695,7 @@ func (r *Runner) runTest(ctx context.Context, txn storage.Transaction, mod *ast.
 		rego.Store(r.store),
 		rego.Transaction(txn),
 		rego.Compiler(r.compiler),
-		rego.Query(rule.Path().String()),
+		rego.ParsedQuery(tc.query),
 		rego.QueryTracer(tracer),
 		rego.Runtime(r.runtime),
 		rego.Target(r.target),
@@ -488,7 +717,7 @@ func (r *Runner) runTest(ctx context.Context, txn storage.Transaction, mod *ast.
 		trace = *bufferTracer
 	}
 
-	tr := newResult(rule.Loc(), mod.Package.Path.String(), rule.Head.Ref().String(), dt, trace, printbuf.Bytes())
+	tr := tc.newResult(dt, trace, printbuf.Bytes())
 	tr.Error = err
 	var stop bool
 
@@ -508,11 +737,11 @@ func (r *Runner) runTest(ctx context.Context, txn storage.Transaction, mod *ast.
 	return tr, stop
 }
 
-func (r *Runner) runBenchmark(ctx context.Context, txn storage.Transaction, mod *ast.Module, rule *ast.Rule, options BenchmarkOptions) (*Result, bool) {
+func (r *Runner) runBenchmark(ctx context.Context, txn storage.Transaction, tc *testCase, options BenchmarkOptions) (*Result, bool) {
 	tr := &Result{
-		Location: rule.Loc(),
-		Package:  mod.Package.Path.String(),
-		Name:     rule.Head.Ref().String(), // TODO(sr): test
+		Location: tc.rule.Loc(),
+		Package:  tc.module.Package.Path.String(),
+		Name:     tc.name, // TODO(sr): test
 	}
 
 	var stop bool
@@ -525,7 +754,7 @@ func (r *Runner) runBenchmark(ctx context.Context, txn storage.Transaction, mod
 			rego.Store(r.store),
 			rego.Transaction(txn),
 			rego.Compiler(r.compiler),
-			rego.Query(rule.Path().String()),
+			rego.ParsedQuery(tc.query),
 			rego.Runtime(r.runtime),
 			rego.Target(r.target),
 		).PrepareForEval(ctx)
@@ -590,7 +819,7 @@ func (r *Runner) runBenchmark(ctx context.Context, txn storage.Transaction, mod
 func Load(args []string, filter loader.Filter) (map[string]*ast.Module, storage.Store, error) {
 	loaded, err := loader.NewFileLoader().
 		WithProcessAnnotation(true).
-		Filtered(args, filter)
+		Filtered(args, ExcludeFixtureFiles(filter))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -336,6 +336,107 @@ func TestRunWithFilterRegex(t *testing.T) {
 	})
 }
 
+func TestRunParameterized(t *testing.T) {
+	files := map[string]string{
+		"/authz.rego": `package authz
+			default allow := false
+			allow { input.user == "admin" }
+			allow { input.method == "GET" }
+			`,
+		"/authz_test.rego": `package authz
+
+cases := [
+	{"name": "admin write", "input": {"user": "admin", "method": "POST"}, "allow": true},
+	{"name": "anonymous read", "input": {"user": "bob", "method": "GET"}, "allow": true},
+	{"name": "anonymous write", "input": {"user": "bob", "method": "POST"}, "allow": false},
+]
+
+# METADATA
+# custom:
+#   fixture: cases
+test_allow(tc) {
+	r := allow with input as tc.input
+	r == tc.allow
+}
+
+# METADATA
+# custom:
+#   fixture: data.other.methods
+test_methods(m) {
+	allow with input as {"user": "admin", "method": m}
+}
+
+# METADATA
+# custom:
+#   fixture: testdata/cases_fixture.yaml
+test_file(tc) {
+	allow with input as tc
+}
+
+test_missing_fixture(tc) { tc }
+
+# METADATA
+# custom:
+#   fixture: undefined_cases
+test_undefined_fixture(tc) { tc }
+
+todo_test_skip(tc) { tc }
+`,
+		"/other.rego": `package other
+			methods := {"get": "GET", "post": "POST"}
+			`,
+		// Fixture files are not loaded as data, i.e., they may contain arrays.
+		"/testdata/cases_fixture.yaml": `
+- name: read
+  user: bob
+  method: GET
+- name: write
+  user: bob
+  method: POST
+`,
+	}
+
+	cases := []struct {
+		note   string
+		filter string
+		tests  expectedTestResults
+	}{
+		{
+			note: "all",
+			tests: expectedTestResults{
+				{"data.authz", "test_allow/admin_write"}:     {false, false, false},
+				{"data.authz", "test_allow/anonymous_read"}:  {false, false, false},
+				{"data.authz", "test_allow/anonymous_write"}: {false, false, false},
+				{"data.authz", "test_methods/get"}:           {false, false, false},
+				{"data.authz", "test_methods/post"}:          {false, false, false},
+				{"data.authz", "test_file/read"}:             {false, false, false},
+				{"data.authz", "test_file/write"}:            {false, true, false},
+				{"data.authz", "test_missing_fixture"}:       {true, false, false},
+				{"data.authz", "test_undefined_fixture"}:     {true, false, false},
+				{"data.authz", "todo_test_skip"}:             {false, false, true},
+			},
+		},
+		{
+			note:   "filter cases",
+			filter: "test_allow/anonymous",
+			tests: expectedTestResults{
+				{"data.authz", "test_allow/anonymous_read"}:  {false, false, false},
+				{"data.authz", "test_allow/anonymous_write"}: {false, false, false},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.note, func(t *testing.T) {
+			test.WithTempFS(files, func(d string) {
+				conf := testRunConfig{filter: tc.filter}
+				rs, _ := doTestRunWithTmpDir(t, d, conf)
+				validateTestResults(t, tc.tests, rs, conf)
+			})
+		})
+	}
+}
+
 func TestRunnerCancel(t *testing.T) {
 	testCancel(t, false)
 }
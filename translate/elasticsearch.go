@@ -0,0 +1,108 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package translate
+
+import (
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/sdk/filter"
+)
+
+var esRangeOperators = map[filter.Op]string{
+	filter.OpLt:  "lt",
+	filter.OpLte: "lte",
+	filter.OpGt:  "gt",
+	filter.OpGte: "gte",
+}
+
+// ToElasticsearch converts pq into an Elasticsearch query. Column references
+// must have the form <root>.<index>.<field>, e.g., input.pets.owner, where
+// the field may refer to nested objects, e.g., input.pets.owner.name. The
+// index is not part of the query. Column references must refer to one of the
+// unknowns, which default to the input document.
+//
+// Disjunctions are rendered as bool queries with should clauses, conjunctions
+// as bool queries with filter clauses, and negations as bool queries with
+// must_not clauses.
+func ToElasticsearch(pq *rego.PartialQueries, unknowns []*ast.Term) (map[string]interface{}, error) {
+
+	expr, err := convert(converter(unknowns, true, nil), pq)
+	if err != nil {
+		return nil, err
+	}
+
+	return esQuery(expr), nil
+}
+
+type esObject = map[string]interface{}
+
+func esQuery(expr filter.Expr) esObject {
+	switch x := expr.(type) {
+	case filter.Or:
+		if len(x) == 0 {
+			return esObject{"match_none": esObject{}}
+		}
+		return esObject{"bool": esObject{"should": esQueries(x), "minimum_should_match": 1}}
+	case filter.And:
+		if len(x) == 0 {
+			return esObject{"match_all": esObject{}}
+		}
+		return esObject{"bool": esObject{"filter": esQueries(x)}}
+	case filter.Not:
+		return esNot(esQuery(x.Expr))
+	case filter.Compare:
+		field := esField(x.Field)
+		value := constant(x.Value)
+		switch {
+		case x.Value == nil && x.Operator == filter.OpEq:
+			return esNot(esObject{"exists": esObject{"field": field}})
+		case x.Value == nil:
+			return esObject{"exists": esObject{"field": field}}
+		case x.Operator == filter.OpEq:
+			return esObject{"term": esObject{field: value}}
+		case x.Operator == filter.OpNeq:
+			return esNot(esObject{"term": esObject{field: value}})
+		}
+		return esObject{"range": esObject{field: esObject{esRangeOperators[x.Operator]: value}}}
+	case filter.StringMatch:
+		field := esField(x.Field)
+		switch x.Operator {
+		case filter.OpStartsWith:
+			return esObject{"prefix": esObject{field: x.Value}}
+		case filter.OpEndsWith:
+			return esObject{"wildcard": esObject{field: esObject{"value": "*" + wildcardEscaper.Replace(x.Value)}}}
+		}
+		return esObject{"wildcard": esObject{field: esObject{"value": "*" + wildcardEscaper.Replace(x.Value) + "*"}}}
+	case filter.In:
+		values := make([]interface{}, len(x.Values))
+		for i := range x.Values {
+			values[i] = constant(x.Values[i])
+		}
+		return esObject{"terms": esObject{esField(x.Field): values}}
+	}
+	return nil
+}
+
+// esField returns the name of the field at path. The index is not part of the
+// name.
+func esField(path filter.Path) string {
+	return strings.Join(path[1:], ".")
+}
+
+func esQueries(exprs []filter.Expr) []interface{} {
+	result := make([]interface{}, len(exprs))
+	for i := range exprs {
+		result[i] = esQuery(exprs[i])
+	}
+	return result
+}
+
+func esNot(query esObject) esObject {
+	return esObject{"bool": esObject{"must_not": []interface{}{query}}}
+}
+
+var wildcardEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
@@ -0,0 +1,190 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package translate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/sdk/filter"
+)
+
+// SQL represents a parameterized SQL WHERE clause. The clause does not include
+// the WHERE keyword. Constants are passed as arguments, which are referred to
+// by placeholders in the clause, e.g., $1 for PostgreSQL or ? for MySQL and
+// SQLite.
+type SQL struct {
+	Where string        `json:"where"`
+	Args  []interface{} `json:"args"`
+}
+
+var sqlOperators = map[filter.Op]string{
+	filter.OpEq:  "=",
+	filter.OpNeq: "<>",
+	filter.OpLt:  "<",
+	filter.OpLte: "<=",
+	filter.OpGt:  ">",
+	filter.OpGte: ">=",
+}
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ToSQL converts pq into a WHERE clause for dialect, which must be one of the
+// SQL targets. Column references must have the form <root>.<table>.<column>,
+// e.g., input.pets.owner, and are rendered as <table>.<column>. They must refer
+// to one of the unknowns, which default to the input document.
+//
+// Note that negated conditions follow SQL semantics, i.e., unlike in Rego,
+// NOT (pets.age > 10) is not satisfied by rows where age is NULL.
+func ToSQL(pq *rego.PartialQueries, dialect Target, unknowns []*ast.Term) (*SQL, error) {
+
+	switch dialect {
+	case Postgres, MySQL, SQLite:
+	default:
+		return nil, fmt.Errorf("unknown SQL dialect %q", dialect)
+	}
+
+	c := converter(unknowns, false, func(path filter.Path) error {
+		for _, id := range path {
+			if !sqlIdentifier.MatchString(id) {
+				return fmt.Errorf("%q is not a valid SQL identifier", id)
+			}
+		}
+		return nil
+	})
+	c.CompareFields = true
+
+	expr, err := convert(c, pq)
+	if err != nil {
+		return nil, err
+	}
+
+	w := sqlWriter{dialect: dialect, args: []interface{}{}}
+	w.expr(expr, false)
+
+	return &SQL{Where: w.buf.String(), Args: w.args}, nil
+}
+
+type sqlWriter struct {
+	dialect Target
+	buf     strings.Builder
+	args    []interface{}
+}
+
+// expr writes expr. If nested is true, compound expressions are wrapped in
+// parentheses.
+func (w *sqlWriter) expr(expr filter.Expr, nested bool) {
+	switch x := expr.(type) {
+	case filter.Or:
+		if len(x) == 0 {
+			w.literal(false)
+			return
+		}
+		w.compound(x, " OR ", nested)
+	case filter.And:
+		if len(x) == 0 {
+			w.literal(true)
+			return
+		}
+		w.compound(x, " AND ", nested)
+	case filter.Not:
+		w.buf.WriteString("NOT (")
+		w.expr(x.Expr, false)
+		w.buf.WriteString(")")
+	case filter.Compare:
+		w.column(x.Field)
+		switch {
+		case x.Other != nil:
+			w.buf.WriteString(" " + sqlOperators[x.Operator] + " ")
+			w.column(x.Other)
+		case x.Value == nil && x.Operator == filter.OpEq:
+			w.buf.WriteString(" IS NULL")
+		case x.Value == nil:
+			w.buf.WriteString(" IS NOT NULL")
+		default:
+			w.buf.WriteString(" " + sqlOperators[x.Operator] + " ")
+			w.arg(x.Value)
+		}
+	case filter.StringMatch:
+		w.column(x.Field)
+		w.buf.WriteString(" LIKE ")
+		w.arg(likePattern(x.Operator, x.Value))
+		if w.dialect != MySQL {
+			// MySQL uses backslash as the escape character by default.
+			w.buf.WriteString(` ESCAPE '\'`)
+		}
+	case filter.In:
+		if len(x.Values) == 0 {
+			w.literal(false)
+			return
+		}
+		w.column(x.Field)
+		w.buf.WriteString(" IN (")
+		for i, v := range x.Values {
+			if i > 0 {
+				w.buf.WriteString(", ")
+			}
+			w.arg(v)
+		}
+		w.buf.WriteString(")")
+	}
+}
+
+func (w *sqlWriter) compound(exprs []filter.Expr, sep string, nested bool) {
+	if nested {
+		w.buf.WriteString("(")
+	}
+	for i := range exprs {
+		if i > 0 {
+			w.buf.WriteString(sep)
+		}
+		w.expr(exprs[i], true)
+	}
+	if nested {
+		w.buf.WriteString(")")
+	}
+}
+
+func (w *sqlWriter) column(path filter.Path) {
+	w.buf.WriteString(strings.Join(path, "."))
+}
+
+func (w *sqlWriter) arg(v interface{}) {
+	w.args = append(w.args, constant(v))
+	if w.dialect == Postgres {
+		fmt.Fprintf(&w.buf, "$%d", len(w.args))
+	} else {
+		w.buf.WriteString("?")
+	}
+}
+
+func (w *sqlWriter) literal(b bool) {
+	switch {
+	case w.dialect == SQLite && b:
+		w.buf.WriteString("1")
+	case w.dialect == SQLite:
+		w.buf.WriteString("0")
+	case b:
+		w.buf.WriteString("TRUE")
+	default:
+		w.buf.WriteString("FALSE")
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func likePattern(op filter.Op, s string) string {
+	s = likeEscaper.Replace(s)
+	switch op {
+	case filter.OpStartsWith:
+		return s + "%"
+	case filter.OpEndsWith:
+		return "%" + s
+	}
+	return "%" + s + "%"
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+// Package translate converts the results of partial evaluation into queries
+// for external data stores, e.g., SQL WHERE clauses or Elasticsearch queries.
+//
+// Partial evaluation results are translated if every residual query only
+// consists of comparisons between columns and constants, string matching and
+// membership tests. Column references must refer to a table (or index) and a
+// column (or field) below the root document, e.g., input.pets.owner refers to
+// the owner column of the pets table, and they must refer to one of the
+// unknowns that partial evaluation was run with. Results that contain support
+// modules, i.e., rules that could not be inlined, cannot be translated. The
+// results are converted into filter expressions by the sdk/filter package's
+// Converter, which the SDK's filter Mapper uses as well, before they are
+// rendered in the target language.
+//
+// Partial evaluation can be restricted to the translatable subset of Rego with
+// the Restrict option, which rejects policies that apply unsupported constructs
+// to the unknowns before partial evaluation.
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/sdk/filter"
+)
+
+// TranslationErr indicates that a partial evaluation result cannot be
+// translated.
+const TranslationErr = "rego_translation_error"
+
+// Target names a query language that partial evaluation results can be
+// translated into.
+type Target string
+
+const (
+	// Postgres translates into PostgreSQL WHERE clauses.
+	Postgres Target = "sql+postgres"
+
+	// MySQL translates into MySQL WHERE clauses.
+	MySQL Target = "sql+mysql"
+
+	// SQLite translates into SQLite WHERE clauses.
+	SQLite Target = "sql+sqlite"
+
+	// Elasticsearch translates into Elasticsearch query DSL.
+	Elasticsearch Target = "elasticsearch"
+)
+
+// Targets returns the names of the supported targets.
+func Targets() []string {
+	return []string{string(Postgres), string(MySQL), string(SQLite), string(Elasticsearch)}
+}
+
+// ParseTarget returns the target named s.
+func ParseTarget(s string) (Target, error) {
+	for _, t := range Targets() {
+		if s == t {
+			return Target(s), nil
+		}
+	}
+	return "", fmt.Errorf("unknown translation target %q", s)
+}
+
+// Translate converts pq into a query for target. The unknowns are the ones
+// that partial evaluation was run with; if none are given, the input document
+// is unknown. SQL targets return a *SQL value, the Elasticsearch target returns
+// the query as a map. If pq cannot be translated, the returned ast.Errors
+// contain every unsupported construct.
+func Translate(pq *rego.PartialQueries, target Target, unknowns []*ast.Term) (interface{}, error) {
+	switch target {
+	case Postgres, MySQL, SQLite:
+		return ToSQL(pq, target, unknowns)
+	case Elasticsearch:
+		return ToElasticsearch(pq, unknowns)
+	}
+	return nil, fmt.Errorf("unknown translation target %q", target)
+}
+
+// converter returns a converter for columns below the unknowns. Columns are
+// converted into paths that start with the table (or index) followed by the
+// column (or field). If nested is false, columns cannot refer to nested
+// fields. If check is set, it is called for every column.
+func converter(unknowns []*ast.Term, nested bool, check func(filter.Path) error) *filter.Converter {
+	refs := unknownRefs(unknowns)
+	return &filter.Converter{
+		Field: func(ref ast.Ref) (filter.Path, error) {
+			if len(ref) < 3 || (!nested && len(ref) > 3) || !isUnknown(refs, ref) {
+				return nil, nil
+			}
+			if _, ok := ref[0].Value.(ast.Var); !ok {
+				return nil, nil
+			}
+			path := make(filter.Path, 0, len(ref)-1)
+			for _, x := range ref[1:] {
+				s, ok := x.Value.(ast.String)
+				if !ok {
+					return nil, nil
+				}
+				path = append(path, string(s))
+			}
+			if check != nil {
+				return path, check(path)
+			}
+			return path, nil
+		},
+	}
+}
+
+// unknownRefs returns the references to the unknowns. If there are no
+// unknowns, the input document is unknown.
+func unknownRefs(unknowns []*ast.Term) []ast.Ref {
+	if len(unknowns) == 0 {
+		return []ast.Ref{ast.InputRootRef}
+	}
+	refs := make([]ast.Ref, 0, len(unknowns))
+	for _, u := range unknowns {
+		switch v := u.Value.(type) {
+		case ast.Ref:
+			refs = append(refs, v)
+		case ast.Var:
+			refs = append(refs, ast.Ref{u})
+		}
+	}
+	return refs
+}
+
+// isUnknown returns true if ref refers to one of the unknowns.
+func isUnknown(unknowns []ast.Ref, ref ast.Ref) bool {
+	for _, u := range unknowns {
+		if ref.HasPrefix(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// convert converts pq with c. Conversion errors are reported as translation
+// errors.
+func convert(c *filter.Converter, pq *rego.PartialQueries) (filter.Expr, error) {
+	expr, err := c.Convert(pq)
+	if errs, ok := err.(ast.Errors); ok {
+		for _, e := range errs {
+			e.Code = TranslationErr
+		}
+	}
+	return expr, err
+}
+
+// constant returns v as a Go value. Numbers are converted into integers or
+// floating point numbers.
+func constant(v interface{}) interface{} {
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
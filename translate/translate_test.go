@@ -0,0 +1,468 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/util"
+)
+
+const testPolicy = `package pets
+
+import future.keywords.in
+
+allow {
+	input.pets.owner == input.subject
+}
+
+allow {
+	input.pets.public
+	input.pets.name in {"rex", "fido"}
+	startswith(input.pets.name, "r%")
+	not input.pets.age > 10
+	input.pets.vet == null
+}
+
+own {
+	input.pets.owner == input.subject
+}
+
+old {
+	18 <= input.pets.age
+}
+
+wildcard {
+	contains(input.pets.name, "*x_")
+}
+
+nested {
+	input.pets.owner.name == "bob"
+}
+
+columns {
+	input.pets.owner == input.users.name
+}
+
+never {
+	input.pets.owner == "bob"
+	false
+}
+
+always {
+	input.subject == "bob"
+}
+
+unsupported {
+	count(input.pets.name) > 3
+	input.pets.tags[_] == "dog"
+	input.pets.tags == ["dog"]
+}
+
+support[x] {
+	x := input.pets.name
+}
+
+support_query {
+	support["rex"]
+}
+`
+
+var testUnknowns = []*ast.Term{ast.MustParseTerm("input.pets"), ast.MustParseTerm("input.users")}
+
+func partial(t *testing.T, query string, opts ...func(*rego.Rego)) *rego.PartialQueries {
+	t.Helper()
+
+	opts = append(opts,
+		rego.Query(query),
+		rego.Module("pets.rego", testPolicy),
+		rego.Input(map[string]interface{}{"subject": "bob"}),
+		rego.ParsedUnknowns(testUnknowns),
+	)
+
+	pq, err := rego.New(opts...).Partial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pq
+}
+
+func TestToSQL(t *testing.T) {
+
+	tests := []struct {
+		note    string
+		query   string
+		dialect Target
+		where   string
+		args    []interface{}
+	}{
+		{
+			note:    "postgres",
+			query:   "data.pets.allow == true",
+			dialect: Postgres,
+			where:   `pets.owner = $1 OR (pets.public = $2 AND pets.name IN ($3, $4) AND pets.name LIKE $5 ESCAPE '\' AND NOT (pets.age > $6) AND pets.vet IS NULL)`,
+			args:    []interface{}{"bob", true, "fido", "rex", `r\%%`, int64(10)},
+		},
+		{
+			note:    "mysql",
+			query:   "data.pets.allow == true",
+			dialect: MySQL,
+			where:   `pets.owner = ? OR (pets.public = ? AND pets.name IN (?, ?) AND pets.name LIKE ? AND NOT (pets.age > ?) AND pets.vet IS NULL)`,
+			args:    []interface{}{"bob", true, "fido", "rex", `r\%%`, int64(10)},
+		},
+		{
+			note:    "sqlite",
+			query:   "data.pets.allow == true",
+			dialect: SQLite,
+			where:   `pets.owner = ? OR (pets.public = ? AND pets.name IN (?, ?) AND pets.name LIKE ? ESCAPE '\' AND NOT (pets.age > ?) AND pets.vet IS NULL)`,
+			args:    []interface{}{"bob", true, "fido", "rex", `r\%%`, int64(10)},
+		},
+		{
+			note:    "constant on the left",
+			query:   "data.pets.old == true",
+			dialect: Postgres,
+			where:   `pets.age >= $1`,
+			args:    []interface{}{int64(18)},
+		},
+		{
+			note:    "contains",
+			query:   "data.pets.wildcard == true",
+			dialect: Postgres,
+			where:   `pets.name LIKE $1 ESCAPE '\'`,
+			args:    []interface{}{`%*x\_%`},
+		},
+		{
+			note:    "columns",
+			query:   "data.pets.columns == true",
+			dialect: Postgres,
+			where:   `pets.owner = users.name`,
+			args:    []interface{}{},
+		},
+		{
+			note:    "never",
+			query:   "data.pets.never == true",
+			dialect: Postgres,
+			where:   `FALSE`,
+			args:    []interface{}{},
+		},
+		{
+			note:    "always",
+			query:   "data.pets.always == true",
+			dialect: MySQL,
+			where:   `TRUE`,
+			args:    []interface{}{},
+		},
+		{
+			note:    "always sqlite",
+			query:   "data.pets.always == true",
+			dialect: SQLite,
+			where:   `1`,
+			args:    []interface{}{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			result, err := ToSQL(partial(t, tc.query), tc.dialect, testUnknowns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Where != tc.where {
+				t.Fatalf("expected:\n\n%v\n\ngot:\n\n%v", tc.where, result.Where)
+			}
+			if !reflect.DeepEqual(result.Args, tc.args) {
+				t.Fatalf("expected args %v but got %v", tc.args, result.Args)
+			}
+		})
+	}
+}
+
+func TestToElasticsearch(t *testing.T) {
+
+	tests := []struct {
+		note  string
+		query string
+		exp   string
+	}{
+		{
+			note:  "allow",
+			query: "data.pets.allow == true",
+			exp: `{"bool": {"minimum_should_match": 1, "should": [
+				{"term": {"owner": "bob"}},
+				{"bool": {"filter": [
+					{"term": {"public": true}},
+					{"terms": {"name": ["fido", "rex"]}},
+					{"prefix": {"name": "r%"}},
+					{"bool": {"must_not": [{"range": {"age": {"gt": 10}}}]}},
+					{"bool": {"must_not": [{"exists": {"field": "vet"}}]}}
+				]}}
+			]}}`,
+		},
+		{
+			note:  "single condition",
+			query: "data.pets.own == true",
+			exp:   `{"term": {"owner": "bob"}}`,
+		},
+		{
+			note:  "wildcard",
+			query: "data.pets.wildcard == true",
+			exp:   `{"wildcard": {"name": {"value": "*\\*x_*"}}}`,
+		},
+		{
+			note:  "nested",
+			query: "data.pets.nested == true",
+			exp:   `{"term": {"owner.name": "bob"}}`,
+		},
+		{
+			note:  "never",
+			query: "data.pets.never == true",
+			exp:   `{"match_none": {}}`,
+		},
+		{
+			note:  "always",
+			query: "data.pets.always == true",
+			exp:   `{"match_all": {}}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			result, err := ToElasticsearch(partial(t, tc.query), testUnknowns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bs, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := util.MustUnmarshalJSON(bs)
+
+			if exp := util.MustUnmarshalJSON([]byte(tc.exp)); !reflect.DeepEqual(exp, actual) {
+				t.Fatalf("expected:\n\n%v\n\ngot:\n\n%s", tc.exp, bs)
+			}
+		})
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+
+	tests := []struct {
+		note     string
+		query    string
+		opts     []func(*rego.Rego)
+		target   Target
+		unknowns []*ast.Term
+		exp      []string
+	}{
+		{
+			note:   "unsupported expressions",
+			query:  "data.pets.unsupported == true",
+			target: Postgres,
+			exp: []string{
+				"pets.rego:47: rego_translation_error: comparison does not refer to a field: gt(count(input.pets.name), 3)",
+				"pets.rego:48: rego_translation_error: comparison does not refer to a field",
+				"pets.rego:49: rego_translation_error: field can only be compared with a constant",
+			},
+		},
+		{
+			note:   "nested columns in sql",
+			query:  "data.pets.nested == true",
+			target: MySQL,
+			exp: []string{
+				"pets.rego:30: rego_translation_error: comparison does not refer to a field",
+			},
+		},
+		{
+			note:   "columns in elasticsearch",
+			query:  "data.pets.columns == true",
+			target: Elasticsearch,
+			exp: []string{
+				"pets.rego:34: rego_translation_error: comparison between fields cannot be converted",
+			},
+		},
+		{
+			note:     "columns outside of unknowns",
+			query:    "data.pets.columns == true",
+			target:   Postgres,
+			unknowns: testUnknowns[:1],
+			exp: []string{
+				"pets.rego:34: rego_translation_error: field can only be compared with a constant: input.pets.owner = input.users.name",
+			},
+		},
+		{
+			note:   "support",
+			query:  "data.pets.support_query == true",
+			opts:   []func(*rego.Rego){rego.DisableInlining([]string{"data.pets.support"})},
+			target: SQLite,
+			exp: []string{
+				"rego_translation_error: support rule data.partial.pets.support cannot be converted",
+				"pets.rego:57: rego_translation_error: expression cannot be converted: data.partial.pets.support.rex",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			unknowns := tc.unknowns
+			if unknowns == nil {
+				unknowns = testUnknowns
+			}
+			_, err := Translate(partial(t, tc.query, tc.opts...), tc.target, unknowns)
+			errs, ok := err.(ast.Errors)
+			if !ok {
+				t.Fatalf("expected ast.Errors but got: %v", err)
+			}
+			if len(errs) != len(tc.exp) {
+				t.Fatalf("expected %d errors but got: %v", len(tc.exp), errs)
+			}
+			for i := range tc.exp {
+				if !strings.Contains(errs[i].Error(), tc.exp[i]) {
+					t.Errorf("expected error %q but got %q", tc.exp[i], errs[i].Error())
+				}
+			}
+		})
+	}
+}
+
+func TestTranslateUnknownTarget(t *testing.T) {
+	if _, err := Translate(&rego.PartialQueries{}, "mongodb", nil); err == nil || err.Error() != `unknown translation target "mongodb"` {
+		t.Fatalf("expected error but got: %v", err)
+	}
+}
+
+const testRestrictedPolicy = `package restricted
+
+known {
+	count(input.subject) > 1
+	input.pets.owner == input.subject
+}
+
+f(x) {
+	lower(x) == "rex"
+}
+
+function {
+	f(input.pets.name)
+}
+
+name := upper(input.pets.name)
+
+dependency {
+	name == "REX"
+}
+
+with_keyword {
+	data.pets.own with input.subject as "alice"
+}
+`
+
+func TestValidate(t *testing.T) {
+
+	tests := []struct {
+		note   string
+		query  string
+		target Target
+		exp    []string
+	}{
+		{
+			note:   "translatable",
+			query:  "data.pets.allow == true",
+			target: Postgres,
+		},
+		{
+			note:   "unknowns not referenced",
+			query:  "data.restricted.known == true",
+			target: Postgres,
+		},
+		{
+			note:   "nested columns in elasticsearch",
+			query:  "data.pets.nested == true",
+			target: Elasticsearch,
+		},
+		{
+			note:   "nested columns in sql",
+			query:  "data.pets.nested == true",
+			target: MySQL,
+			exp: []string{
+				"pets.rego:30: rego_translation_error: nested column cannot be translated: input.pets.owner.name == \"bob\"",
+			},
+		},
+		{
+			note:   "unsupported expressions",
+			query:  "data.pets.unsupported == true",
+			target: Postgres,
+			exp: []string{
+				"pets.rego:47: rego_translation_error: built-in function count cannot be translated: count(input.pets.name)",
+				"pets.rego:48: rego_translation_error: reference to a column cannot contain variables: input.pets.tags[_] == \"dog\"",
+			},
+		},
+		{
+			note:   "functions",
+			query:  "data.restricted.function == true",
+			target: SQLite,
+			exp: []string{
+				"restricted.rego:9: rego_translation_error: built-in function lower cannot be translated",
+			},
+		},
+		{
+			note:   "rule dependencies",
+			query:  "data.restricted.dependency == true",
+			target: Elasticsearch,
+			exp: []string{
+				"restricted.rego:16: rego_translation_error: built-in function upper cannot be translated",
+			},
+		},
+		{
+			note:   "with keyword",
+			query:  "data.restricted.with_keyword == true",
+			target: Postgres,
+			exp: []string{
+				"restricted.rego:23: rego_translation_error: with keyword cannot be translated",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.note, func(t *testing.T) {
+			_, err := rego.New(
+				rego.Query(tc.query),
+				rego.Module("pets.rego", testPolicy),
+				rego.Module("restricted.rego", testRestrictedPolicy),
+				rego.Input(map[string]interface{}{"subject": "bob"}),
+				rego.ParsedUnknowns(testUnknowns),
+				Restrict(tc.target),
+			).Partial(context.Background())
+
+			if len(tc.exp) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			errs, ok := err.(ast.Errors)
+			if !ok {
+				t.Fatalf("expected ast.Errors but got: %v", err)
+			}
+			if len(errs) != len(tc.exp) {
+				t.Fatalf("expected %d errors but got: %v", len(tc.exp), errs)
+			}
+			for i := range tc.exp {
+				if !strings.Contains(errs[i].Error(), tc.exp[i]) {
+					t.Errorf("expected error %q but got %q", tc.exp[i], errs[i].Error())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2023 The OPA Authors.  All rights reserved.
+// Use of this source code is governed by an Apache2
+// license that can be found in the LICENSE file.
+
+package translate
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// translatable contains the built-in functions that can be applied to the
+// unknowns. Other built-in functions would remain in the residual queries.
+var translatable = map[string]struct{}{
+	ast.Equality.Name:      {},
+	ast.Equal.Name:         {},
+	ast.NotEqual.Name:      {},
+	ast.LessThan.Name:      {},
+	ast.LessThanEq.Name:    {},
+	ast.GreaterThan.Name:   {},
+	ast.GreaterThanEq.Name: {},
+	ast.StartsWith.Name:    {},
+	ast.EndsWith.Name:      {},
+	ast.Contains.Name:      {},
+	ast.Member.Name:        {},
+}
+
+// Restrict returns an option that restricts partial evaluation to the subset
+// of Rego that can be translated into target. Queries that could produce
+// untranslatable results are rejected before partial evaluation, see Validate.
+func Restrict(target Target) func(*rego.Rego) {
+	return rego.PartialCheck(func(compiler *ast.Compiler, query ast.Body, unknowns []*ast.Term) error {
+		return Validate(compiler, query, unknowns, target)
+	})
+}
+
+// Validate returns an error if partial evaluation of query with the given
+// unknowns could produce results that cannot be translated into target. The
+// query must have been compiled by compiler. The query and the rules it
+// depends on are checked for expressions on the unknowns that cannot be
+// translated, e.g., calls to built-in functions other than comparisons, string
+// matching and membership tests, iteration over the unknowns, or the with
+// keyword. The returned ast.Errors refer to these expressions in the policy.
+//
+// Validate does not guarantee that the results can be translated, e.g.,
+// columns may still be compared with composite values, so the results should
+// still be passed to Translate.
+func Validate(compiler *ast.Compiler, query ast.Body, unknowns []*ast.Term, target Target) error {
+
+	v := &validator{
+		compiler: compiler,
+		unknowns: unknownRefs(unknowns),
+		nested:   target == Elasticsearch,
+		checked:  map[*ast.Rule]struct{}{},
+	}
+
+	v.taintRules()
+	v.body(query, ast.VarSet{})
+
+	if len(v.errs) > 0 {
+		v.errs.Sort()
+		return v.errs
+	}
+
+	return nil
+}
+
+// validator checks expressions that depend on the unknowns. Rules depend on
+// the unknowns if they refer to them directly or through other rules, local
+// variables depend on the unknowns if they are bound in expressions that do.
+type validator struct {
+	compiler *ast.Compiler
+	unknowns []ast.Ref
+	nested   bool
+	tainted  map[*ast.Rule]struct{} // rules that depend on the unknowns
+	checked  map[*ast.Rule]struct{}
+	errs     ast.Errors
+}
+
+func (v *validator) errorf(loc *ast.Location, f string, a ...interface{}) {
+	v.errs = append(v.errs, ast.NewError(TranslationErr, loc, f, a...))
+}
+
+// source returns the source text of expr. Compiled expressions refer to
+// generated variables, so the source is easier to relate to the policy.
+func source(expr *ast.Expr) string {
+	if expr.Location != nil && len(expr.Location.Text) > 0 {
+		return string(expr.Location.Text)
+	}
+	return expr.String()
+}
+
+// taintRules finds the rules that depend on the unknowns.
+func (v *validator) taintRules() {
+
+	v.tainted = map[*ast.Rule]struct{}{}
+
+	var queue []*ast.Rule
+
+	for _, module := range v.compiler.Modules {
+		ast.WalkRules(module, func(rule *ast.Rule) bool {
+			if v.refersToUnknowns(rule, rule.Else) {
+				v.tainted[rule] = struct{}{}
+				queue = append(queue, rule)
+			}
+			return false
+		})
+	}
+
+	for len(queue) > 0 {
+		rule := queue[0]
+		queue = queue[1:]
+		for node := range v.compiler.Graph.Dependents(rule) {
+			dep := node.(*ast.Rule)
+			if _, ok := v.tainted[dep]; !ok {
+				v.tainted[dep] = struct{}{}
+				queue = append(queue, dep)
+			}
+		}
+	}
+}
+
+// refersToUnknowns returns true if x refers to the unknowns. The else clause
+// of a rule, if any, is skipped.
+func (v *validator) refersToUnknowns(x interface{}, skip *ast.Rule) bool {
+	found := false
+	ast.NewGenericVisitor(func(x interface{}) bool {
+		switch x := x.(type) {
+		case *ast.Rule:
+			return found || (skip != nil && x == skip)
+		case ast.Ref:
+			found = found || v.unknown(x)
+		}
+		return found
+	}).Walk(x)
+	return found
+}
+
+// unknown returns true if ref refers to an unknown or to a document that
+// contains one.
+func (v *validator) unknown(ref ast.Ref) bool {
+	prefix := ref.ConstantPrefix()
+	for _, u := range v.unknowns {
+		if ref.HasPrefix(u) || u.HasPrefix(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// dependsOnUnknowns returns true if expr refers to the unknowns, to rules that
+// depend on them or to the local variables in vars.
+func (v *validator) dependsOnUnknowns(expr *ast.Expr, vars ast.VarSet) bool {
+	found := false
+	ast.NewGenericVisitor(func(x interface{}) bool {
+		switch x := x.(type) {
+		case ast.Ref:
+			found = found || v.unknown(x) || len(v.taintedRules(x)) > 0
+		case ast.Var:
+			found = found || vars.Contains(x)
+		}
+		return found
+	}).Walk(expr)
+	return found
+}
+
+func (v *validator) taintedRules(ref ast.Ref) []*ast.Rule {
+	if !ref.HasPrefix(ast.DefaultRootRef) {
+		return nil
+	}
+	var result []*ast.Rule
+	for _, rule := range v.compiler.GetRules(ref) {
+		for ; rule != nil; rule = rule.Else {
+			if _, ok := v.tainted[rule]; ok {
+				result = append(result, rule)
+			}
+		}
+	}
+	return result
+}
+
+// body checks the expressions in body that depend on the unknowns. The vars
+// contain the local variables that depend on the unknowns initially.
+func (v *validator) body(body ast.Body, vars ast.VarSet) {
+
+	vars = vars.Copy()
+	params := ast.VarVisitorParams{SkipRefHead: true, SkipClosures: true}
+
+	for changed := true; changed; {
+		changed = false
+		for _, expr := range body {
+			if !v.dependsOnUnknowns(expr, vars) {
+				continue
+			}
+			for x := range expr.Vars(params) {
+				if !vars.Contains(x) {
+					vars.Add(x)
+					changed = true
+				}
+			}
+		}
+	}
+
+	for _, expr := range body {
+		if v.dependsOnUnknowns(expr, vars) {
+			v.expr(expr)
+		}
+	}
+}
+
+func (v *validator) expr(expr *ast.Expr) {
+
+	if len(expr.With) > 0 {
+		v.errorf(expr.Location, "with keyword cannot be translated: %v", source(expr))
+		return
+	}
+
+	switch terms := expr.Terms.(type) {
+	case *ast.SomeDecl:
+		return
+	case *ast.Term:
+		switch terms.Value.(type) {
+		case ast.Ref, ast.Var:
+		default:
+			v.errorf(expr.Location, "expression cannot be translated: %v", source(expr))
+			return
+		}
+	case []*ast.Term:
+		name := expr.Operator()
+		if name.HasPrefix(ast.DefaultRootRef) {
+			for _, rule := range v.compiler.GetRulesExact(name) {
+				v.rule(rule)
+			}
+		} else if _, ok := translatable[name.String()]; !ok {
+			v.errorf(expr.Location, "built-in function %v cannot be translated: %v", name, source(expr))
+			return
+		}
+	default:
+		v.errorf(expr.Location, "expression cannot be translated: %v", source(expr))
+		return
+	}
+
+	ast.WalkRefs(expr, func(ref ast.Ref) bool {
+		v.ref(expr, ref)
+		return false
+	})
+}
+
+// ref checks that ref refers to a column if it refers to an unknown and checks
+// the rules that ref refers to.
+func (v *validator) ref(expr *ast.Expr, ref ast.Ref) {
+
+	for _, rule := range v.taintedRules(ref) {
+		v.rule(rule)
+	}
+
+	for _, u := range v.unknowns {
+		if !ref.HasPrefix(u) {
+			continue
+		}
+		for _, x := range ref[1:] {
+			if _, ok := x.Value.(ast.String); !ok {
+				v.errorf(expr.Location, "reference to a column cannot contain variables: %v", source(expr))
+				return
+			}
+		}
+		if !v.nested && len(ref) > 3 {
+			v.errorf(expr.Location, "nested column cannot be translated: %v", source(expr))
+		}
+		return
+	}
+}
+
+// rule checks the body of rule. Functions are inlined into the expressions
+// that call them, so their arguments are assumed to depend on the unknowns.
+func (v *validator) rule(rule *ast.Rule) {
+
+	if _, ok := v.checked[rule]; ok {
+		return
+	}
+
+	v.checked[rule] = struct{}{}
+
+	vars := ast.VarSet{}
+	for _, arg := range rule.Head.Args {
+		vars.Update(arg.Vars())
+	}
+
+	v.body(rule.Body, vars)
+}